@@ -0,0 +1,21 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// adminAssets holds the admin dashboard, a static page that calls the /api/v1 routes from the browser
+//
+//go:embed admin
+var adminAssets embed.FS
+
+// adminFS serves the dashboard assets from the root of /admin
+func adminFS() http.FileSystem {
+	assets, err := fs.Sub(adminAssets, "admin")
+	if err != nil {
+		panic(err) // The directory is embedded at build time
+	}
+	return http.FS(assets)
+}
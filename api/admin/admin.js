@@ -0,0 +1,389 @@
+// Admin dashboard: browses collections, documents and chunks, runs test queries and deletes data
+// through the /api/v1 routes, with the tenant and API key kept in local storage.
+"use strict";
+
+const api = "/api/v1";
+const pageSize = 25;
+
+const state = {
+  collection: "",
+  offset: 0,
+  source: "",
+};
+
+function $(id) {
+  return document.getElementById(id);
+}
+
+// el creates an element with attributes and children; strings become text, never markup
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [name, value] of Object.entries(attrs || {})) {
+    if (name === "onclick") {
+      node.addEventListener("click", value);
+    } else {
+      node.setAttribute(name, value);
+    }
+  }
+  for (const child of children.flat()) {
+    if (child !== null && child !== undefined) {
+      node.append(child instanceof Node ? child : String(child));
+    }
+  }
+  return node;
+}
+
+function showStatus(message, isError) {
+  const status = $("status");
+  status.textContent = message;
+  status.className = isError ? "error" : "";
+  clearTimeout(showStatus.timer);
+  showStatus.timer = setTimeout(() => (status.textContent = ""), 5000);
+}
+
+async function request(method, path, body) {
+  const headers = { "Content-Type": "application/json" };
+  const tenant = localStorage.getItem("ragTenant");
+  const key = localStorage.getItem("ragAPIKey");
+  if (tenant) headers["X-Tenant-ID"] = tenant;
+  if (key) headers["X-API-Key"] = key;
+
+  const response = await fetch(api + path, {
+    method,
+    headers,
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  const data = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    throw new Error(data.error || response.status + " " + response.statusText);
+  }
+  return data;
+}
+
+function formatScore(score) {
+  return typeof score === "number" ? score.toFixed(3) : "";
+}
+
+function formatTime(value) {
+  return value ? new Date(value).toLocaleString() : "";
+}
+
+// Collections
+
+async function loadCollections() {
+  const name = $("collection-name").value.trim();
+  const query = name ? "?name=" + encodeURIComponent(name) : "";
+  try {
+    const data = await request("GET", "/collections" + query);
+    const list = $("collections");
+    list.replaceChildren();
+    for (const collection of data.collections) {
+      list.append(
+        el("li", { class: collection.name === state.collection ? "selected" : "", onclick: () => selectCollection(collection.name) },
+          el("strong", {}, collection.name),
+          el("small", {}, collection.doc_count + " docs, " + collection.chunk_count + " chunks"))
+      );
+    }
+    if (data.collections.length === 0) {
+      list.append(el("li", { class: "empty" }, "No collections"));
+    }
+  } catch (err) {
+    showStatus("Failed to list collections: " + err.message, true);
+  }
+}
+
+function selectCollection(name) {
+  state.collection = name;
+  state.offset = 0;
+  state.source = "";
+  $("document-source").value = "";
+  $("collection-title").textContent = name;
+  $("delete-documents").disabled = false;
+  $("delete-collection").disabled = false;
+  $("chunks").replaceChildren();
+  $("query-result").replaceChildren();
+  loadCollections();
+  loadStats();
+  loadDocuments();
+}
+
+async function loadStats() {
+  $("collection-stats").textContent = "";
+  try {
+    const stats = await request("GET", "/collections/" + encodeURIComponent(state.collection));
+    const parts = [];
+    if (stats.document_count !== undefined) parts.push(stats.document_count + " documents");
+    if (stats.chunk_count !== undefined) parts.push(stats.chunk_count + " chunks");
+    $("collection-stats").textContent = parts.join(", ");
+  } catch (err) {
+    // Collections that only exist through their documents have no stats
+  }
+}
+
+async function deleteCollection() {
+  if (!confirm("Delete collection '" + state.collection + "' with all of its documents?")) return;
+  try {
+    await request("DELETE", "/collections/" + encodeURIComponent(state.collection));
+    showStatus("Deleted collection " + state.collection);
+    state.collection = "";
+    $("collection-title").textContent = "Select a collection";
+    $("collection-stats").textContent = "";
+    $("delete-documents").disabled = true;
+    $("delete-collection").disabled = true;
+    $("documents").replaceChildren();
+    $("chunks").replaceChildren();
+    loadCollections();
+  } catch (err) {
+    showStatus("Failed to delete collection: " + err.message, true);
+  }
+}
+
+async function deleteAllDocuments() {
+  if (!confirm("Delete every document of '" + state.collection + "'?")) return;
+  try {
+    await request("DELETE", "/collections/" + encodeURIComponent(state.collection) + "/documents");
+    showStatus("Deleted the documents of " + state.collection);
+    selectCollection(state.collection);
+  } catch (err) {
+    showStatus("Failed to delete documents: " + err.message, true);
+  }
+}
+
+// Documents
+
+async function loadDocuments() {
+  if (!state.collection) return;
+  const params = new URLSearchParams({ limit: pageSize, offset: state.offset });
+  if (state.source) params.set("source", state.source);
+  try {
+    const data = await request("GET", "/collections/" + encodeURIComponent(state.collection) + "/documents?" + params);
+    const rows = $("documents");
+    rows.replaceChildren();
+    for (const doc of data.documents) {
+      rows.append(
+        el("tr", {},
+          el("td", { class: "source", title: doc.id }, doc.source || doc.id),
+          el("td", {}, doc.doc_type),
+          el("td", {}, doc.chunk_count),
+          el("td", {}, formatTime(doc.created_at)),
+          el("td", {}, formatTime(doc.expires_at)),
+          el("td", { class: "actions" },
+            el("button", { onclick: () => loadChunks(doc) }, "Chunks"),
+            el("button", { class: "danger", onclick: () => deleteDocument(doc) }, "Delete")))
+      );
+    }
+    if (data.documents.length === 0) {
+      rows.append(el("tr", {}, el("td", { colspan: 6, class: "empty" }, "No documents")));
+    }
+    const last = state.offset + data.documents.length;
+    $("page-info").textContent = data.total ? state.offset + 1 + "–" + last + " of " + data.total : "";
+    $("previous-page").disabled = state.offset === 0;
+    $("next-page").disabled = !data.has_more;
+  } catch (err) {
+    showStatus("Failed to list documents: " + err.message, true);
+  }
+}
+
+async function deleteDocument(doc) {
+  if (!confirm("Delete document '" + (doc.source || doc.id) + "' and its chunks?")) return;
+  try {
+    await request("DELETE", "/documents/" + encodeURIComponent(doc.id));
+    showStatus("Deleted " + (doc.source || doc.id));
+    $("chunks").replaceChildren();
+    loadDocuments();
+    loadCollections();
+    loadStats();
+  } catch (err) {
+    showStatus("Failed to delete document: " + err.message, true);
+  }
+}
+
+async function loadChunks(doc) {
+  try {
+    const data = await request("GET", "/documents/" + encodeURIComponent(doc.id) + "/chunks");
+    const panel = $("chunks");
+    panel.replaceChildren(el("h3", {}, (doc.source || doc.id) + " — " + data.total + " chunks"));
+    for (const chunk of data.chunks) {
+      panel.append(chunkCard(chunk, [
+        "#" + chunk.chunk_index,
+        chunk.chunk_type,
+        chunk.section,
+        "chars " + chunk.start_pos + "–" + chunk.end_pos,
+        chunk.parent_chunk_id ? "parent " + chunk.parent_chunk_id : "",
+        chunk.revision ? "revision " + chunk.revision : "",
+      ]));
+    }
+    panel.scrollIntoView({ behavior: "smooth" });
+  } catch (err) {
+    showStatus("Failed to list chunks: " + err.message, true);
+  }
+}
+
+// chunkCard renders a chunk with a line of facts about it, and its keywords and metadata
+function chunkCard(chunk, facts) {
+  const details = [];
+  if (chunk.keywords && chunk.keywords.length) {
+    details.push(el("div", { class: "keywords" }, "Keywords: " + chunk.keywords.join(", ")));
+  }
+  if (chunk.metadata && Object.keys(chunk.metadata).length) {
+    details.push(el("pre", { class: "metadata" }, JSON.stringify(chunk.metadata, null, 2)));
+  }
+  return el("article", { class: "chunk" },
+    el("div", { class: "facts" }, facts.filter(Boolean).join(" · ")),
+    el("p", {}, chunk.text),
+    details);
+}
+
+// Test queries
+
+async function runQuery(event) {
+  event.preventDefault();
+  if (!state.collection) {
+    showStatus("Select a collection first", true);
+    return;
+  }
+  const generate = $("query-generate").checked;
+  const body = {
+    collection_name: state.collection,
+    query: $("query-text").value.trim(),
+    top_k: Number($("query-top-k").value) || 5,
+    reranker_enabled: $("query-reranker").checked,
+    query_expansion: $("query-expansion").checked,
+  };
+  if (generate) {
+    body.verify_faithfulness = $("query-verify").checked;
+  }
+  if (!body.query) return;
+
+  const result = $("query-result");
+  result.replaceChildren(el("p", { class: "empty" }, "Running…"));
+  try {
+    const data = await request("POST", generate ? "/query" : "/search", body);
+    result.replaceChildren(...(generate ? explainQuery(data) : explainSearch(data)));
+  } catch (err) {
+    result.replaceChildren();
+    showStatus("Query failed: " + err.message, true);
+  }
+}
+
+// explainQuery shows a generated answer with what it was based on: every retrieved chunk with
+// its scores, the confidence signals, fallbacks and the verdict on each sentence
+function explainQuery(data) {
+  const nodes = [
+    el("h3", {}, "Answer"),
+    el("p", { class: "answer" }, data.answer),
+    el("div", { class: "facts" },
+      "Confidence " + formatScore(data.confidence) + " · " + (data.is_grounded ? "grounded" : "not grounded") +
+      " · " + formatScore(data.processing_time) + "s"),
+  ];
+  if (data.degradations && data.degradations.length) {
+    nodes.push(el("div", { class: "warning" }, "Degraded: " + data.degradations.join(", ")));
+  }
+  if (data.expanded_queries && data.expanded_queries.length) {
+    nodes.push(el("div", { class: "facts" }, "Queries: " + data.expanded_queries.join(" | ")));
+  }
+  if (data.confidence_details) {
+    nodes.push(el("h3", {}, "Confidence signals"), el("pre", {}, JSON.stringify(data.confidence_details, null, 2)));
+  }
+  if (data.faithfulness) {
+    nodes.push(el("h3", {}, "Faithfulness (" + data.faithfulness.backend + ", score " + formatScore(data.faithfulness.score) + ")"));
+    nodes.push(el("ol", { class: "verdicts" },
+      data.faithfulness.sentences.map((s) => el("li", { class: s.verdict }, el("strong", {}, s.verdict + ": "), s.text))));
+  }
+
+  const cited = new Set((data.citations || []).map((c) => c.chunk_id));
+  const chunks = data.enhanced_chunks || [];
+  nodes.push(el("h3", {}, "Retrieved chunks (" + chunks.length + ")"));
+  chunks.forEach((chunk, i) => {
+    nodes.push(chunkCard(chunk, [
+      "[" + (i + 1) + "]",
+      "similarity " + formatScore((data.similarity_scores || [])[i]),
+      data.reranked_scores && data.reranked_scores.length ? "reranked " + formatScore(data.reranked_scores[i]) : "",
+      cited.has(chunk.id) ? "cited" : "",
+      chunk.section,
+      "document " + chunk.document_id,
+    ]));
+  });
+  return nodes;
+}
+
+// explainSearch shows the ranking of a search with its scores and the retrieval settings applied
+function explainSearch(data) {
+  const nodes = [
+    el("div", { class: "facts" }, data.chunks_found + " chunks · " + formatScore(data.processing_time) + "s"),
+  ];
+  if (data.message) nodes.push(el("p", { class: "empty" }, data.message));
+  const degradations = (data.metadata && data.metadata.degradations) || [];
+  if (degradations.length) {
+    nodes.push(el("div", { class: "warning" }, "Degraded: " + degradations.join(", ")));
+  }
+  nodes.push(el("h3", {}, "Retrieval"), el("pre", {}, JSON.stringify(data.metadata, null, 2)));
+  nodes.push(el("h3", {}, "Ranking"));
+  (data.chunks || []).forEach((chunk, i) => {
+    nodes.push(chunkCard(chunk, [
+      "#" + (i + 1),
+      "similarity " + formatScore(chunk.similarity_score),
+      chunk.reranked_score !== undefined ? "reranked " + formatScore(chunk.reranked_score) : "",
+      chunk.section,
+      "document " + chunk.document_id,
+    ]));
+  });
+  return nodes;
+}
+
+// Wiring
+
+function showTab(name) {
+  for (const button of document.querySelectorAll("#tabs button")) {
+    button.classList.toggle("active", button.dataset.tab === name);
+  }
+  $("documents-tab").classList.toggle("hidden", name !== "documents");
+  $("query-tab").classList.toggle("hidden", name !== "query");
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  $("tenant").value = localStorage.getItem("ragTenant") || "";
+  $("api-key").value = localStorage.getItem("ragAPIKey") || "";
+  $("credentials").addEventListener("submit", (event) => {
+    event.preventDefault();
+    localStorage.setItem("ragTenant", $("tenant").value.trim());
+    localStorage.setItem("ragAPIKey", $("api-key").value.trim());
+    showStatus("Saved");
+    loadCollections();
+  });
+
+  $("collection-filter").addEventListener("submit", (event) => {
+    event.preventDefault();
+    loadCollections();
+  });
+  $("collection-name").addEventListener("keydown", (event) => {
+    // Shift+Enter opens a collection by name, including one that exists only through its documents
+    if (event.key === "Enter" && event.shiftKey && event.target.value.trim()) {
+      event.preventDefault();
+      selectCollection(event.target.value.trim());
+    }
+  });
+  $("document-filter").addEventListener("submit", (event) => {
+    event.preventDefault();
+    state.source = $("document-source").value.trim();
+    state.offset = 0;
+    loadDocuments();
+  });
+  $("previous-page").addEventListener("click", () => {
+    state.offset = Math.max(0, state.offset - pageSize);
+    loadDocuments();
+  });
+  $("next-page").addEventListener("click", () => {
+    state.offset += pageSize;
+    loadDocuments();
+  });
+  $("delete-documents").addEventListener("click", deleteAllDocuments);
+  $("delete-collection").addEventListener("click", deleteCollection);
+  $("query-form").addEventListener("submit", runQuery);
+  $("query-generate").addEventListener("change", (event) => ($("query-verify").disabled = !event.target.checked));
+  for (const button of document.querySelectorAll("#tabs button")) {
+    button.addEventListener("click", () => showTab(button.dataset.tab));
+  }
+
+  loadCollections();
+});
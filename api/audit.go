@@ -0,0 +1,255 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"rag-go-app/core"
+	"rag-go-app/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditResponseBytes caps how much of a response is kept to read the audited resource from
+const maxAuditResponseBytes = 256 << 10
+
+// auditedRoutes names the action recorded for each route that creates, updates or deletes
+// something. Routes not listed, such as queries, are not audited.
+var auditedRoutes = map[string]string{
+	"POST /api/v1/collections":                          "collection.create",
+	"DELETE /api/v1/collections/:name":                  "collection.delete",
+	"POST /api/v1/collections/:name/reembed":            "collection.reembed",
+	"POST /api/v1/collections/:name/sync":               "collection.sync",
+	"POST /api/v1/collections/:name/sources/s3":         "collection.sync_s3",
+	"POST /api/v1/collections/:name/sources/web":        "collection.crawl",
+	"POST /api/v1/documents":                            "document.create",
+	"POST /api/v1/documents/import":                     "document.import",
+	"POST /api/v1/documents/batch":                      "document.batch_create",
+	"POST /api/v1/collections/:name/import":             "document.import_export",
+	"DELETE /api/v1/documents/:id":                      "document.delete",
+	"DELETE /api/v1/collections/:name/documents":        "document.delete_all",
+	"POST /api/v1/collections/:name/duplicates/resolve": "document.resolve_duplicates",
+	"PATCH /api/v1/chunks/:id":                          "chunk.update",
+	"POST /api/v1/admin/replication/sync":               "replication.sync",
+	"POST /api/v1/admin/replication/snapshot":           "replication.receive",
+	"POST /api/v1/admin/backup":                         "backup.create",
+	"POST /api/v1/admin/restore":                        "backup.restore",
+	"POST /api/v1/admin/maintenance":                    "maintenance.run",
+	"POST /api/v1/admin/fsck":                           "maintenance.fsck",
+	"PUT /api/v1/admin/read-only":                       "server.read_only",
+	"POST /api/v1/admin/encryption/rotate":              "encryption.rotate",
+	"PUT /api/v1/admin/roles":                           "role.assign",
+	"DELETE /api/v1/admin/roles":                        "role.revoke",
+}
+
+// auditedResponseFields are the response fields copied into an entry's details. They are listed
+// explicitly so titles, summaries and chunk text, which may be encrypted at rest, stay out of the log.
+var auditedResponseFields = []string{
+	"message", "error", "status", "document_id", "source", "file_path", "name",
+	"chunks_embedded", "chunks_reused", "chunks_deduplicated", "chunks_supplied", "total_documents", "total_chunks",
+	"pages_fetched", "truncated", "revision", "restored", "safety_backup", "kind", "subject", "role",
+	"keep", "removed", "repair", "consistent", "read_only", "reason",
+}
+
+// auditCSVHeader is the first row of CSV exports
+var auditCSVHeader = []string{
+	"id", "created_at", "tenant", "actor_kind", "actor", "client_ip", "method", "path",
+	"action", "collection", "resource_id", "status", "details",
+}
+
+// auditResponseWriter keeps the start of the response so the audited resource can be read from it
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if room := maxAuditResponseBytes - w.body.Len(); room > 0 {
+		w.body.Write(data[:min(len(data), room)])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// AuditMiddleware records every request to a route in auditedRoutes in the audit log: who made
+// it, when, what it changed and how it was answered. It runs before authentication so refused
+// attempts are recorded too. A failure to record is only logged.
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		action, ok := auditedRoutes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+		writer := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		entry := &core.AuditEntry{
+			Tenant:     c.GetString(tenantContextKey),
+			ClientIP:   c.ClientIP(),
+			Method:     c.Request.Method,
+			Path:       c.FullPath(),
+			Action:     action,
+			Collection: c.Param("name"),
+			ResourceID: c.Param("id"),
+			Status:     writer.Status(),
+		}
+		entry.ActorKind, entry.Actor = auditActor(c)
+
+		var response map[string]interface{}
+		if json.Unmarshal(writer.body.Bytes(), &response) == nil {
+			if entry.Collection == "" {
+				entry.Collection, _ = response["collection_name"].(string)
+			}
+			if entry.Collection == "" && action == "collection.create" {
+				entry.Collection, _ = response["name"].(string)
+			}
+			if entry.ResourceID == "" {
+				entry.ResourceID, _ = response["document_id"].(string)
+			}
+			for _, field := range auditedResponseFields {
+				if value, ok := response[field]; ok && value != nil {
+					if entry.Details == nil {
+						entry.Details = make(map[string]interface{})
+					}
+					entry.Details[field] = value
+				}
+			}
+		}
+
+		if err := vectorDB.RecordAudit(entry); err != nil {
+			log.Printf("Error recording audit entry for %s %s: %v", entry.Method, c.Request.URL.Path, err)
+		}
+	}
+}
+
+// auditActor identifies who made a request: the caller authorization established, otherwise the
+// API key it carried
+func auditActor(c *gin.Context) (string, string) {
+	if caller := requestIdentity(c); caller != nil {
+		switch caller.Kind {
+		case core.RoleSubjectUser:
+			return core.AuditActorUser, caller.Subject
+		case core.RoleSubjectAPIKey:
+			return core.AuditActorAPIKey, core.APIKeySubject(requestAPIKey(c.Request))
+		}
+		return core.AuditActorAnonymous, ""
+	}
+	token := requestAPIKey(c.Request)
+	switch {
+	case token == "":
+		return core.AuditActorAnonymous, ""
+	case looksLikeJWT(token):
+		return core.AuditActorUser, "" // A token that failed verification names no one reliably
+	}
+	return core.AuditActorAPIKey, core.APIKeySubject(token)
+}
+
+// AuditLogHandler returns a page of the audit log, newest first by default
+func AuditLogHandler(c *gin.Context) {
+	var req models.AuditLogRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, total, err := vectorDB.AuditLog(&req)
+	if err != nil {
+		log.Printf("Error listing audit log: %v", err)
+		if strings.Contains(err.Error(), "invalid list options") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit log"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries":  entries,
+		"total":    total,
+		"offset":   req.Offset,
+		"limit":    req.Limit,
+		"has_more": req.Offset+len(entries) < total,
+	})
+}
+
+// AuditExportHandler streams the matching audit entries as NDJSON or CSV for evidence collection.
+// Without a limit, every match is exported.
+func AuditExportHandler(c *gin.Context) {
+	var req models.AuditLogRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Order == "" {
+		req.Order = "asc" // Exports read in the order things happened
+	}
+
+	format := req.Format
+	if format == "" {
+		format = "ndjson"
+	}
+	contentType := "application/x-ndjson"
+	if format == "csv" {
+		contentType = "text/csv"
+	}
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+
+	// Headers go out with the first entry, so a bad filter can still be answered with an error
+	csvWriter := csv.NewWriter(c.Writer)
+	encoder := json.NewEncoder(c.Writer)
+	started := false
+	start := func() {
+		started = true
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Status(http.StatusOK)
+		if format == "csv" {
+			csvWriter.Write(auditCSVHeader)
+		}
+	}
+	err := vectorDB.EachAuditEntry(&req, func(entry *core.AuditEntry) error {
+		if !started {
+			start()
+		}
+		if format != "csv" {
+			return encoder.Encode(entry)
+		}
+		details := ""
+		if len(entry.Details) > 0 {
+			data, _ := json.Marshal(entry.Details)
+			details = string(data)
+		}
+		return csvWriter.Write([]string{
+			strconv.FormatInt(entry.ID, 10), entry.CreatedAt.UTC().Format(time.RFC3339), entry.Tenant, entry.ActorKind,
+			entry.Actor, entry.ClientIP, entry.Method, entry.Path, entry.Action, entry.Collection, entry.ResourceID,
+			strconv.Itoa(entry.Status), details,
+		})
+	})
+	switch {
+	case err != nil && !started:
+		log.Printf("Error exporting audit log: %v", err)
+		if strings.Contains(err.Error(), "invalid list options") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export audit log"})
+		}
+		return
+	case err != nil:
+		// The status is already sent, so a failure can only cut the export short
+		log.Printf("Error exporting audit log: %v", err)
+	case !started:
+		start()
+	}
+	csvWriter.Flush()
+}
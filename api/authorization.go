@@ -0,0 +1,296 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"rag-go-app/config"
+	"rag-go-app/core"
+	"rag-go-app/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// identityContextKey stores the authenticated caller in the gin context
+const identityContextKey = "identity"
+
+// authorizer authenticates callers and resolves their role; nil when authorization is disabled
+var authorizer *roleAuthorizer
+
+// identity is the caller of a request as established by AuthorizationMiddleware
+type identity struct {
+	Kind    string   // core.RoleSubjectAPIKey, core.RoleSubjectUser for JWTs, or "" for anonymous callers
+	Subject string   // User claim of a JWT; empty for API keys
+	Groups  []string // Groups claim of a JWT
+	Role    string
+	Tenant  string // Tenant claim of a JWT
+}
+
+type roleAuthorizer struct {
+	cfg config.AuthorizationConfig
+	jwt *jwtVerifier
+}
+
+// newRoleAuthorizer checks the configured roles and loads the JWT key
+func newRoleAuthorizer(cfg config.AuthorizationConfig) (*roleAuthorizer, error) {
+	for _, role := range cfg.APIKeyRoles {
+		if core.RoleRank(role) == 0 {
+			return nil, fmt.Errorf("unknown role '%s' in api_key_roles (use reader, writer or admin)", role)
+		}
+	}
+	if cfg.AnonymousRole != "" && core.RoleRank(cfg.AnonymousRole) == 0 {
+		return nil, fmt.Errorf("unknown anonymous_role '%s' (use reader, writer or admin)", cfg.AnonymousRole)
+	}
+	if cfg.TokenRole != "" && core.RoleRank(cfg.TokenRole) == 0 {
+		return nil, fmt.Errorf("unknown token_role '%s' (use reader, writer or admin)", cfg.TokenRole)
+	}
+	if cfg.JWT.RoleClaim == "" {
+		cfg.JWT.RoleClaim = "roles"
+	}
+	if cfg.JWT.TenantClaim == "" {
+		cfg.JWT.TenantClaim = "tenant"
+	}
+	if cfg.JWT.UserClaim == "" {
+		cfg.JWT.UserClaim = "sub"
+	}
+	if cfg.JWT.GroupsClaim == "" {
+		cfg.JWT.GroupsClaim = "groups"
+	}
+	verifier, err := newJWTVerifier(cfg.JWT)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DisableAPIKeys && verifier == nil {
+		return nil, errors.New("disable_api_keys needs a JWT secret, public key, JWKS URL or issuer")
+	}
+	return &roleAuthorizer{cfg: cfg, jwt: verifier}, nil
+}
+
+// AuthorizationMiddleware authenticates the caller of each request by API key or JWT and resolves
+// their role, which RequireRole checks per route. It does nothing unless authorization is enabled.
+func AuthorizationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authorizer == nil {
+			c.Next()
+			return
+		}
+		caller, status, err := authorizer.authenticate(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(identityContextKey, caller)
+		c.Next()
+	}
+}
+
+// RequireRole rejects requests whose caller's role ranks below role
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authorizer == nil {
+			c.Next()
+			return
+		}
+		caller := requestIdentity(c)
+		if caller == nil || core.RoleRank(caller.Role) < core.RoleRank(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("This operation requires the %s role", role)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// requestIdentity returns the caller established by AuthorizationMiddleware, or nil
+func requestIdentity(c *gin.Context) *identity {
+	caller, _ := c.Get(identityContextKey)
+	id, _ := caller.(*identity)
+	return id
+}
+
+// authenticate resolves the caller and role of a request. Bearer tokens in JWT form are verified
+// as JWTs when a JWT secret, key or issuer is configured; anything else is taken as an API key.
+func (a *roleAuthorizer) authenticate(r *http.Request) (*identity, int, error) {
+	token := requestAPIKey(r)
+	if token == "" {
+		if a.cfg.AnonymousRole == "" {
+			return nil, http.StatusUnauthorized, errors.New("API key or bearer token required")
+		}
+		return &identity{Role: a.cfg.AnonymousRole}, 0, nil
+	}
+
+	if a.jwt != nil && looksLikeJWT(token) {
+		claims, err := a.jwt.verify(token, time.Now())
+		if err != nil {
+			return nil, http.StatusUnauthorized, fmt.Errorf("invalid bearer token: %w", err)
+		}
+		caller := &identity{Kind: core.RoleSubjectUser, Groups: claimStrings(claims[a.cfg.JWT.GroupsClaim])}
+		caller.Subject, _ = claims[a.cfg.JWT.UserClaim].(string)
+		caller.Tenant, _ = claims[a.cfg.JWT.TenantClaim].(string)
+
+		// Role claim values may be role names themselves; they and the groups may also be assigned a role
+		claimValues := claimStrings(claims[a.cfg.JWT.RoleClaim])
+		for _, value := range claimValues {
+			if core.RoleRank(value) > core.RoleRank(caller.Role) {
+				caller.Role = value
+			}
+		}
+		claimValues = append(claimValues, caller.Groups...)
+		if err := a.raiseToAssigned(caller, core.RoleSubjectClaim, claimValues...); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if caller.Subject != "" {
+			if err := a.raiseToAssigned(caller, core.RoleSubjectUser, caller.Subject); err != nil {
+				return nil, http.StatusInternalServerError, err
+			}
+		}
+		if caller.Role == "" {
+			caller.Role = a.cfg.TokenRole
+		}
+		if caller.Role == "" {
+			return nil, http.StatusForbidden, errors.New("no role is assigned to this token")
+		}
+		return caller, 0, nil
+	}
+	if a.cfg.DisableAPIKeys {
+		return nil, http.StatusUnauthorized, errors.New("API keys are not accepted; send a bearer token from the identity provider")
+	}
+
+	caller := &identity{Kind: core.RoleSubjectAPIKey, Role: a.cfg.APIKeyRoles[token]}
+	if err := a.raiseToAssigned(caller, core.RoleSubjectAPIKey, core.APIKeySubject(token)); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if caller.Role == "" {
+		// A key that tenancy knows is valid, just not granted anything
+		if _, ok := config.AppConfig.Tenancy.APIKeys[token]; ok {
+			return nil, http.StatusForbidden, errors.New("no role is assigned to this API key")
+		}
+		return nil, http.StatusUnauthorized, errors.New("invalid API key")
+	}
+	return caller, 0, nil
+}
+
+// raiseToAssigned gives the caller the role stored for any of the subjects if it ranks higher
+func (a *roleAuthorizer) raiseToAssigned(caller *identity, kind string, subjects ...string) error {
+	if len(subjects) == 0 {
+		return nil
+	}
+	role, err := vectorDB.AssignedRole(kind, subjects...)
+	if err != nil {
+		log.Printf("Error reading role assignments: %v", err)
+		return errors.New("failed to read role assignments")
+	}
+	if core.RoleRank(role) > core.RoleRank(caller.Role) {
+		caller.Role = role
+	}
+	return nil
+}
+
+// applyCallerPrincipal makes a query run for the user of a JWT, so document ACLs apply to them and
+// the query log records them. It replaces any principal in the request, so token holders can't
+// query as someone else; other callers keep the principal they send.
+func applyCallerPrincipal(c *gin.Context, req *models.QueryRequest) {
+	if principal := callerPrincipal(c); principal != nil {
+		req.Principal = principal
+	}
+}
+
+// callerPrincipal returns the principal of a caller identified as a user, or nil for other callers
+func callerPrincipal(c *gin.Context) *models.Principal {
+	if caller := requestIdentity(c); caller != nil && caller.Kind == core.RoleSubjectUser {
+		return &models.Principal{User: caller.Subject, Groups: caller.Groups}
+	}
+	return nil
+}
+
+// roleSubject returns the kind and stored subject of the identity a role request names
+func roleSubject(req *models.RoleAssignmentRequest) (string, string, error) {
+	var kind, subject string
+	named := 0
+	if req.APIKey != "" {
+		kind, subject = core.RoleSubjectAPIKey, core.APIKeySubject(req.APIKey)
+		named++
+	}
+	if req.User != "" {
+		kind, subject = core.RoleSubjectUser, req.User
+		named++
+	}
+	if req.Claim != "" {
+		kind, subject = core.RoleSubjectClaim, req.Claim
+		named++
+	}
+	if named != 1 {
+		return "", "", errors.New("exactly one of api_key, user or claim is required")
+	}
+	return kind, subject, nil
+}
+
+// ListRolesHandler lists the roles assigned through the API. Roles from api_key_roles in the
+// configuration are not included.
+func ListRolesHandler(c *gin.Context) {
+	assignments, err := vectorDB.RoleAssignments()
+	if err != nil {
+		log.Printf("Error listing role assignments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list role assignments"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": authorizer != nil,
+		"roles":   assignments,
+	})
+}
+
+// AssignRoleHandler grants a role to an API key, a JWT subject or a JWT claim value
+func AssignRoleHandler(c *gin.Context) {
+	var req models.RoleAssignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	kind, subject, err := roleSubject(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if core.RoleRank(req.Role) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown role '%s' (use reader, writer or admin)", req.Role)})
+		return
+	}
+	if err := vectorDB.AssignRole(kind, subject, req.Role); err != nil {
+		log.Printf("Error assigning role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Assigned the %s role", req.Role),
+		"kind":    kind,
+		"subject": subject,
+		"role":    req.Role,
+	})
+}
+
+// RevokeRoleHandler removes the role assigned to an API key, a JWT subject or a JWT claim value
+func RevokeRoleHandler(c *gin.Context) {
+	var req models.RoleAssignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	kind, subject, err := roleSubject(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	revoked, err := vectorDB.RevokeRole(kind, subject)
+	if err != nil {
+		log.Printf("Error revoking role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke role"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No role is assigned to this identity"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role revoked", "kind": kind, "subject": subject})
+}
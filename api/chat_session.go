@@ -0,0 +1,362 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"rag-go-app/config"
+	"rag-go-app/core"
+	"rag-go-app/models"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	defaultChatHistoryTurns  = 20
+	defaultChatHistoryTokens = 8000
+	chatCharsPerToken        = 4 // Rough estimate of the tokens in a message
+)
+
+// chatSessions tracks open chat sessions. The HTTP server's Shutdown doesn't wait for hijacked
+// connections, so CloseChatSessions ends them and Cleanup waits for them.
+var chatSessions = struct {
+	sync.Mutex
+	open    map[*chatSession]struct{}
+	closing bool
+	done    sync.WaitGroup
+}{open: make(map[*chatSession]struct{})}
+
+// chatSession is a conversation over a WebSocket. Questions are answered one at a time, each with
+// context retrieved for it, and the recent conversation is sent to the chat model with each one.
+type chatSession struct {
+	c       *gin.Context
+	conn    *websocket.Conn
+	id      string
+	limiter *rateLimiter
+
+	send sync.Mutex // Serializes writes to conn
+
+	mu      sync.Mutex                     // Guards the fields below
+	history []models.ChatCompletionMessage // Questions and answers in pairs, capped by trimChatHistory
+	rag     json.RawMessage
+	turn    int
+	cancel  context.CancelFunc // Stops the answer in progress; nil between questions
+	answers sync.WaitGroup
+}
+
+// ChatSessionHandler upgrades the request to a WebSocket carrying a chat session. Each question
+// counts against the query rate limit.
+func ChatSessionHandler(limiter *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if shuttingDown.Load() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The server is shutting down"})
+			return
+		}
+		if !allowedOrigin(c.Request) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Chat sessions may not be opened from " + c.GetHeader("Origin")})
+			return
+		}
+		server := websocket.Server{
+			Handler: func(conn *websocket.Conn) {
+				if maxBytes := config.AppConfig.Limits.MaxBodyBytes; maxBytes > 0 {
+					conn.MaxPayloadBytes = int(maxBytes)
+				}
+				session := &chatSession{c: c, conn: conn, id: uuid.New().String(), limiter: limiter}
+				session.run()
+			},
+		}
+		server.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// allowedOrigin reports whether a page may open a chat session: one served by this server, or one
+// of an origin listed in chat_proxy.allowed_origins. Browsers send client certificates with
+// cross-origin WebSocket handshakes, and without authentication there is nothing to send, so any
+// page could otherwise read answers from the user's collections. Clients other than browsers send
+// no Origin and are allowed.
+func allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	if strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range config.AppConfig.ChatProxy.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CloseChatSessions ends every chat session, stopping answers in progress, and refuses new ones
+func CloseChatSessions() {
+	chatSessions.Lock()
+	defer chatSessions.Unlock()
+	chatSessions.closing = true
+	for session := range chatSessions.open {
+		session.emit(models.ChatSessionEvent{Type: models.ChatEventError, Error: "The server is shutting down"})
+		session.conn.Close()
+	}
+}
+
+// run reads the client's messages until the connection closes
+func (s *chatSession) run() {
+	chatSessions.Lock()
+	if chatSessions.closing {
+		chatSessions.Unlock()
+		s.conn.Close()
+		return
+	}
+	chatSessions.open[s] = struct{}{}
+	chatSessions.done.Add(1)
+	chatSessions.Unlock()
+	defer func() {
+		chatSessions.Lock()
+		delete(chatSessions.open, s)
+		chatSessions.Unlock()
+		chatSessions.done.Done()
+	}()
+
+	ctx, cancel := context.WithCancel(s.c.Request.Context())
+	defer func() {
+		cancel()
+		s.answers.Wait()
+		s.conn.Close()
+	}()
+
+	log.Printf("Chat session %s opened", s.id)
+	s.emit(models.ChatSessionEvent{Type: models.ChatEventSession, SessionID: s.id})
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(s.conn, &data); err != nil {
+			break
+		}
+		var msg models.ChatSessionMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.emit(models.ChatSessionEvent{Type: models.ChatEventError, Error: "invalid message: " + err.Error()})
+			continue
+		}
+
+		switch msg.Type {
+		case models.ChatSessionAsk:
+			s.ask(ctx, &msg)
+		case models.ChatSessionCancel:
+			s.stop()
+		case models.ChatSessionReset:
+			s.reset()
+		default:
+			s.emit(models.ChatSessionEvent{Type: models.ChatEventError,
+				Error: fmt.Sprintf("unknown message type %q (expected %q, %q or %q)", msg.Type, models.ChatSessionAsk, models.ChatSessionCancel, models.ChatSessionReset)})
+		}
+	}
+	log.Printf("Chat session %s closed", s.id)
+}
+
+// ask validates a question and starts answering it in the background, so a cancel can arrive
+// while it is answered
+func (s *chatSession) ask(ctx context.Context, msg *models.ChatSessionMessage) {
+	question := strings.TrimSpace(msg.Content)
+	if question == "" {
+		s.emit(models.ChatSessionEvent{Type: models.ChatEventError, Error: "content is required"})
+		return
+	}
+	if s.limiter != nil {
+		if allowed, wait := s.limiter.allow(rateLimitClient(s.c), time.Now()); !allowed {
+			s.emit(models.ChatSessionEvent{Type: models.ChatEventError, Error: "rate limit exceeded",
+				RetryAfter: int(math.Ceil(wait.Seconds()))})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.emit(models.ChatSessionEvent{Type: models.ChatEventError, Turn: s.turn,
+			Error: "a question is already being answered; cancel it first"})
+		return
+	}
+
+	rag := s.rag
+	if len(msg.RAG) > 0 {
+		rag = msg.RAG
+	}
+	messages := append(slices.Clone(s.history), models.ChatCompletionMessage{Role: "user", Content: question})
+	proxied, err := s.proxiedChat(msg.Model, messages, rag)
+	if err != nil {
+		s.emit(models.ChatSessionEvent{Type: models.ChatEventError, Error: err.Error()})
+		return
+	}
+
+	s.rag = rag
+	s.turn++
+	answerCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.answers.Add(1)
+	go func(turn int) {
+		defer s.answers.Done()
+		defer cancel()
+		s.answer(answerCtx, turn, proxied, messages[len(messages)-1])
+	}(s.turn)
+}
+
+// proxiedChat builds the conversation to answer as if it came to /v1/chat/completions, so it gets
+// the same retrieval options, collection defaults and access control
+func (s *chatSession) proxiedChat(model string, messages []models.ChatCompletionMessage, rag json.RawMessage) (*core.ProxiedChat, error) {
+	body, err := json.Marshal(struct {
+		Model    string                         `json:"model,omitempty"`
+		Messages []models.ChatCompletionMessage `json:"messages"`
+		RAG      json.RawMessage                `json:"rag,omitempty"`
+	}{model, messages, rag})
+	if err != nil {
+		return nil, err
+	}
+	proxied, err := core.ParseProxiedChat(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareChatRetrieval(s.c, proxied); err != nil {
+		return nil, err
+	}
+	return proxied, nil
+}
+
+// answer retrieves context for a question and streams the chat model's answer, reporting progress
+// as it goes. An answer that completes, or is cancelled after it began, joins the conversation.
+func (s *chatSession) answer(ctx context.Context, turn int, proxied *core.ProxiedChat, question models.ChatCompletionMessage) {
+	s.emit(models.ChatSessionEvent{Type: models.ChatEventStatus, Turn: turn, Stage: models.ChatStageSearching,
+		Message: fmt.Sprintf("searching %s…", proxied.RAG.CollectionName)})
+	retrieved, err := tenantRAG(s.c).AugmentChat(ctx, proxied)
+	if err != nil {
+		s.finish(ctx, turn, question, "", err, "Failed to retrieve context")
+		return
+	}
+	found := len(retrieved.Chunks)
+	s.emit(models.ChatSessionEvent{Type: models.ChatEventStatus, Turn: turn, Stage: models.ChatStageRetrieved,
+		Message: fmt.Sprintf("found %d %s", found, pluralize(found, "chunk")), Chunks: &found, Degradations: retrieved.Degradations})
+
+	s.emit(models.ChatSessionEvent{Type: models.ChatEventStatus, Turn: turn, Stage: models.ChatStageGenerating, Message: "generating…"})
+	answer, err := core.StreamChatCompletion(ctx, proxied.Messages(), models.GenerationOptions{Model: proxied.Model}, func(token string) {
+		s.emit(models.ChatSessionEvent{Type: models.ChatEventToken, Turn: turn, Content: token})
+	})
+	if err != nil {
+		s.finish(ctx, turn, question, answer, err, "Failed to generate an answer")
+		return
+	}
+
+	s.finish(ctx, turn, question, answer, nil, "")
+	s.emit(models.ChatSessionEvent{Type: models.ChatEventDone, Turn: turn, Answer: answer, Chunks: &found, Degradations: retrieved.Degradations})
+}
+
+// finish ends the answer of a turn, adding it to the conversation unless it failed, so the next
+// question can be asked as soon as the client hears of it. A failure is reported here.
+func (s *chatSession) finish(ctx context.Context, turn int, question models.ChatCompletionMessage, answer string, err error, failure string) {
+	cancelled := err != nil && errors.Is(ctx.Err(), context.Canceled)
+
+	s.mu.Lock()
+	s.cancel = nil
+	if err == nil || (cancelled && answer != "") {
+		s.history = trimChatHistory(append(s.history, question, models.ChatCompletionMessage{Role: "assistant", Content: answer}),
+			config.AppConfig.ChatProxy)
+	}
+	s.mu.Unlock()
+
+	switch {
+	case err == nil:
+	case cancelled:
+		s.emit(models.ChatSessionEvent{Type: models.ChatEventCancelled, Turn: turn, Answer: answer})
+	default:
+		log.Printf("Chat session %s failed to answer question %d: %v", s.id, turn, err)
+		message := failure
+		if errors.Is(err, context.DeadlineExceeded) {
+			message = "Timed out answering the question"
+		}
+		var mismatch *core.EmbeddingDimensionError
+		if errors.As(err, &mismatch) {
+			message = mismatch.Error()
+		}
+		s.emit(models.ChatSessionEvent{Type: models.ChatEventError, Turn: turn, Error: message, Answer: answer})
+	}
+}
+
+// trimChatHistory drops the oldest turns of a conversation until it has at most the configured
+// number of turns and its estimated tokens fit the configured budget
+func trimChatHistory(history []models.ChatCompletionMessage, cfg config.ChatProxyConfig) []models.ChatCompletionMessage {
+	maxTurns, maxTokens := cfg.HistoryTurns, cfg.HistoryTokens
+	if maxTurns <= 0 {
+		maxTurns = defaultChatHistoryTurns
+	}
+	if maxTokens <= 0 {
+		maxTokens = defaultChatHistoryTokens
+	}
+
+	chars := 0
+	for _, message := range history {
+		chars += len(message.Content)
+	}
+	drop := 0
+	for drop < len(history) && ((len(history)-drop)/2 > maxTurns || chars/chatCharsPerToken > maxTokens) {
+		chars -= len(history[drop].Content) + len(history[drop+1].Content)
+		drop += 2
+	}
+	if drop == 0 {
+		return history
+	}
+	// Copy, so the dropped turns don't stay reachable through the backing array
+	return slices.Clone(history[drop:])
+}
+
+// stop cancels the answer in progress, which reports the cancellation when it stops
+func (s *chatSession) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel == nil {
+		s.emit(models.ChatSessionEvent{Type: models.ChatEventError, Error: "no question is being answered"})
+		return
+	}
+	s.cancel()
+}
+
+// reset forgets the conversation and its retrieval options, answering with a session event
+func (s *chatSession) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.emit(models.ChatSessionEvent{Type: models.ChatEventError, Turn: s.turn,
+			Error: "a question is being answered; cancel it first"})
+		return
+	}
+	s.history, s.rag, s.turn = nil, nil, 0
+	s.emit(models.ChatSessionEvent{Type: models.ChatEventSession, SessionID: s.id})
+}
+
+// emit sends an event to the client; a closed connection is noticed by the reading loop
+func (s *chatSession) emit(event models.ChatSessionEvent) {
+	s.send.Lock()
+	defer s.send.Unlock()
+	websocket.JSON.Send(s.conn, event)
+}
+
+// pluralize returns noun, with an s unless count is 1
+func pluralize(count int, noun string) string {
+	if count == 1 {
+		return noun
+	}
+	return noun + "s"
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+	"testing"
+)
+
+func TestAllowedOrigin(t *testing.T) {
+	saved := config.AppConfig.ChatProxy.AllowedOrigins
+	t.Cleanup(func() { config.AppConfig.ChatProxy.AllowedOrigins = saved })
+
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"no origin", "", nil, true},
+		{"same origin", "http://rag.internal:8080", nil, true},
+		{"same origin with other scheme", "https://rag.internal:8080", nil, true},
+		{"other site", "https://evil.example", nil, false},
+		{"other port", "http://rag.internal:9090", nil, false},
+		{"malformed", "not a url", nil, false},
+		{"null origin", "null", nil, false},
+		{"listed", "https://chat.example.com", []string{"https://chat.example.com/"}, true},
+		{"listed case-insensitively", "https://Chat.Example.com", []string{"https://chat.example.com"}, true},
+		{"not listed", "https://evil.example", []string{"https://chat.example.com"}, false},
+		{"wildcard", "https://evil.example", []string{"*"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig.ChatProxy.AllowedOrigins = tt.allowed
+			req := httptest.NewRequest("GET", "http://rag.internal:8080/ws/chat", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if got := allowedOrigin(req); got != tt.want {
+				t.Errorf("allowedOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimChatHistory(t *testing.T) {
+	// conversation returns turns questions and answers, each of chars characters
+	conversation := func(turns, chars int) []models.ChatCompletionMessage {
+		var history []models.ChatCompletionMessage
+		for i := 1; i <= turns; i++ {
+			history = append(history,
+				models.ChatCompletionMessage{Role: "user", Content: fmt.Sprintf("q%d", i) + strings.Repeat(".", chars-2)},
+				models.ChatCompletionMessage{Role: "assistant", Content: fmt.Sprintf("a%d", i) + strings.Repeat(".", chars-2)})
+		}
+		return history
+	}
+
+	tests := []struct {
+		name      string
+		history   []models.ChatCompletionMessage
+		cfg       config.ChatProxyConfig
+		wantFirst string // Prefix of the first question kept; empty when none are
+		wantTurns int
+	}{
+		{"within limits", conversation(3, 40), config.ChatProxyConfig{HistoryTurns: 5, HistoryTokens: 1000}, "q1", 3},
+		{"too many turns", conversation(8, 40), config.ChatProxyConfig{HistoryTurns: 5, HistoryTokens: 1000}, "q4", 5},
+		{"too many tokens", conversation(8, 400), config.ChatProxyConfig{HistoryTurns: 50, HistoryTokens: 1000}, "q4", 5},
+		{"one turn over budget", conversation(1, 4000), config.ChatProxyConfig{HistoryTurns: 50, HistoryTokens: 1000}, "", 0},
+		{"default turns", conversation(defaultChatHistoryTurns+3, 4), config.ChatProxyConfig{}, "q4", defaultChatHistoryTurns},
+		{"default tokens", conversation(10, chatCharsPerToken*defaultChatHistoryTokens/10), config.ChatProxyConfig{}, "q6", 5},
+	}
+	for _, tt := range tests {
+		got := trimChatHistory(tt.history, tt.cfg)
+		if len(got) != 2*tt.wantTurns {
+			t.Errorf("%s: kept %d messages, want %d turns", tt.name, len(got), tt.wantTurns)
+			continue
+		}
+		if tt.wantTurns > 0 && !strings.HasPrefix(got[0].Content, tt.wantFirst) {
+			t.Errorf("%s: first kept message %.4q, want %q", tt.name, got[0].Content, tt.wantFirst)
+		}
+		if len(got) > 0 && got[len(got)-1] != tt.history[len(tt.history)-1] {
+			t.Errorf("%s: the latest answer was dropped", tt.name)
+		}
+	}
+}
@@ -1,99 +1,319 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"rag-go-app/config"
 	"rag-go-app/core"
 	"rag-go-app/models"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
 )
 
 var (
 	vectorDB   *core.VectorDB
 	ragService *core.RAGService
+	replicator *core.Replicator
+	webhooks   *core.WebhookDispatcher
+	sweeper    *core.ExpirySweeper
+	backups    *core.BackupManager
+	maintainer *core.MaintenanceScheduler
+	crawler    *core.CrawlScheduler
+	warmup     *core.Warmup
+	annIndexes *core.ANNIndexes
+	profiling  *http.Server
+	tracer     *core.Tracer
 )
 
 func InitializeServices(dbPath string) error {
 	var err error
 
+	if _, err := core.CurrentProvider(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
 	// Initialize vector database
 	vectorDB, err = core.NewVectorDB(dbPath)
 	if err != nil {
 		return fmt.Errorf("failed to initialize vector database: %w", err)
 	}
 
+	// Export traces of requests and their query stages if tracing is enabled
+	tracer, err = core.NewTracer(config.AppConfig.Tracing)
+	if err != nil {
+		return fmt.Errorf("invalid tracing configuration: %w", err)
+	}
+	if tracer != nil {
+		tracer.Start()
+		core.SetTracer(tracer)
+	}
+
+	// Enforce roles on the API routes if authorization is enabled
+	authorizer = nil
+	if config.AppConfig.Authorization.Enabled {
+		authorizer, err = newRoleAuthorizer(config.AppConfig.Authorization)
+		if err != nil {
+			return fmt.Errorf("invalid authorization configuration: %w", err)
+		}
+	}
+	if err := checkProfilingAccess(config.AppConfig.Profiling, config.AppConfig.Authorization); err != nil {
+		return fmt.Errorf("invalid profiling configuration: %w", err)
+	}
+
+	// Refuse changes from the start if the server is configured read-only
+	core.ConfigureReadOnly(config.AppConfig.ReadOnly)
+
+	// Reuse stored embeddings for repeated texts and the recorded dimensions of embedding models
+	core.SetEmbeddingCache(vectorDB)
+	core.SetModelRegistry(vectorDB)
+
 	// Initialize services
 	embeddingService := core.NewEmbeddingService()
 	llmService := core.NewLLMService()
 	ragService = core.NewRAGService(vectorDB, embeddingService, llmService)
 
+	// Ship snapshots to a warm standby if replication is configured
+	if config.AppConfig.Replication.Enabled {
+		replicator, err = core.NewReplicator(vectorDB, config.AppConfig.Replication)
+		if err != nil {
+			return fmt.Errorf("failed to initialize replication: %w", err)
+		}
+		replicator.Start()
+	}
+
+	// Notify webhook endpoints of document and collection events if any are configured
+	if len(config.AppConfig.Webhooks.Endpoints) > 0 {
+		webhooks, err = core.NewWebhookDispatcher(config.AppConfig.Webhooks)
+		if err != nil {
+			return fmt.Errorf("failed to initialize webhooks: %w", err)
+		}
+		webhooks.Start()
+		core.SetWebhookDispatcher(webhooks)
+	}
+
+	// Delete documents added with an expiry once it passes
+	if sweeper = core.NewExpirySweeper(vectorDB, config.AppConfig.Expiry); sweeper != nil {
+		sweeper.Start()
+	}
+
+	// Back up the database on demand, and on a schedule if an interval is set
+	if config.AppConfig.Backup.Directory != "" {
+		backups, err = core.NewBackupManager(vectorDB, config.AppConfig.Backup)
+		if err != nil {
+			return fmt.Errorf("failed to initialize backups: %w", err)
+		}
+		backups.Start()
+	}
+
+	// Prune orphaned rows, rebuild the indexes and vacuum the database on a schedule
+	maintainer, err = core.NewMaintenanceScheduler(vectorDB, config.AppConfig.Maintenance)
+	if err != nil {
+		return fmt.Errorf("failed to initialize maintenance: %w", err)
+	}
+	maintainer.Start()
+
+	// Crawl the configured websites into their collections on a schedule
+	if len(config.AppConfig.Crawler.Sites) > 0 {
+		crawler, err = core.NewCrawlScheduler(ragService, config.AppConfig.Crawler, defaultChunkingConfig())
+		if err != nil {
+			return fmt.Errorf("failed to initialize crawler: %w", err)
+		}
+		crawler.Start()
+	}
+
+	// Keep HNSW graphs of the configured collections in memory, so their searches skip the scan
+	annIndexes, err = core.NewANNIndexes(vectorDB, config.AppConfig.ANNIndex)
+	if err != nil {
+		return fmt.Errorf("invalid ann_index configuration: %w", err)
+	}
+	if annIndexes != nil {
+		core.SetANNIndexes(annIndexes)
+		annIndexes.Start()
+	}
+
+	// Serve runtime profiles on a port of their own if one is configured
+	if address := config.AppConfig.Profiling.ListenAddress; address != "" {
+		profiling, err = startProfilingServer(address)
+		if err != nil {
+			return fmt.Errorf("failed to start profiling server: %w", err)
+		}
+	}
+
+	// Read the database into memory before reporting ready, so the first queries are fast
+	if warmup = core.NewWarmup(vectorDB, config.AppConfig.Warmup); warmup != nil {
+		warmup.Start()
+	}
+
 	log.Println("Services initialized successfully")
 	return nil
 }
 
 func CreateCollectionHandler(c *gin.Context) {
-	var req struct {
-		Name        string `json:"name" binding:"required"`
-		Description string `json:"description"`
-	}
+	var req models.CreateCollectionRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	err := vectorDB.CreateCollection(req.Name, req.Description)
+	if err := core.ValidateCollectionDefaults(req.Defaults); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := tenantDB(c).CreateCollection(req.Name, req.Description, req.Defaults, req.Quantization)
 	if err != nil {
 		log.Printf("Error creating collection: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create collection"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	response := gin.H{
 		"message":     "Collection created successfully",
 		"name":        req.Name,
 		"description": req.Description,
-	})
+	}
+	if req.Defaults != nil {
+		response["defaults"] = req.Defaults
+	}
+	if req.Quantization != nil {
+		response["quantization"] = req.Quantization
+	}
+
+	c.JSON(http.StatusCreated, response)
 }
 
-func AddDocumentHandler(c *gin.Context) {
+// PreviewDocumentHandler shows how a document would be parsed and chunked, without ingesting it
+func PreviewDocumentHandler(c *gin.Context) {
 	var req models.AddDocumentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Set default chunking strategy if none provided
+	// Preview with the config ingestion would use
 	if req.ChunkingConfig == nil {
-		req.ChunkingConfig = &models.ChunkingConfig{
-			Strategy:           models.StructuralStrategy,
-			FixedSize:          500,
-			Overlap:            50,
-			MinChunkSize:       100,
-			MaxChunkSize:       2000,
-			PreserveParagraphs: true,
-			ExtractKeywords:    true,
+		req.ChunkingConfig = collectionChunkingConfig(c, req.CollectionName)
+	}
+
+	preview, err := tenantRAG(c).PreviewDocument(c.Request.Context(), req.CollectionName, &req)
+	if err != nil {
+		log.Printf("Error previewing document for collection %s: %v", req.CollectionName, err)
+		if abortOnContextError(c, err) {
+			return
 		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+func AddDocumentHandler(c *gin.Context) {
+	var req models.AddDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := core.ValidateExpiry(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Use the collection's chunking config, or the default strategy, if none provided
+	if req.ChunkingConfig == nil {
+		req.ChunkingConfig = collectionChunkingConfig(c, req.CollectionName)
 	}
 
 	// Document type is stored for metadata but doesn't affect chunking strategy
 	// All documents use the configured or default strategy
 
-	err := ragService.AddDocument(req.CollectionName, &req)
+	result, err := tenantRAG(c).IngestDocument(c.Request.Context(), req.CollectionName, &req)
 	if err != nil {
 		log.Printf("Error adding document to collection %s: %v", req.CollectionName, err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		if abortOnDimensionMismatch(c, err) {
+			return
+		}
+		if abortOnQuotaExceeded(c, err) {
+			return
+		}
+		if abortOnInvalidEmbeddings(c, err) {
+			return
+		}
+		if abortOnCollectionNotFound(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add document"})
 		return
 	}
 
+	strategy := string(req.ChunkingConfig.Strategy)
+	if len(req.Chunks) > 0 {
+		strategy = "imported"
+	}
 	response := gin.H{
-		"message":           "Document added successfully",
-		"collection_name":   req.CollectionName,
-		"chunking_strategy": string(req.ChunkingConfig.Strategy),
+		"message":             "Document added successfully",
+		"collection_name":     req.CollectionName,
+		"chunking_strategy":   strategy,
+		"status":              result.Status,
+		"document_id":         result.DocumentID,
+		"chunks_embedded":     result.ChunksEmbedded,
+		"chunks_reused":       result.ChunksReused,
+		"chunks_deduplicated": result.ChunksDeduplicated,
+	}
+	if req.ExtractGraph {
+		response["graph_entities"] = result.GraphEntities
+		response["graph_relations"] = result.GraphRelations
+		response["graph_failed_chunks"] = result.GraphFailedChunks
+	}
+	if req.SummaryTree {
+		response["summaries"] = result.Summaries
+		response["summary_failures"] = result.SummaryFailures
+	}
+	if req.SummarizeTables {
+		response["tables_summarized"] = result.TablesSummarized
+		response["table_summary_failures"] = result.TableSummaryFailures
+	}
+	if req.DocumentSummary {
+		response["title"] = result.Title
+		response["summary"] = result.Summary
+		response["document_summary_failed"] = result.DocumentSummaryFailed
+	}
+	if req.GenerateQuestions {
+		response["questions_generated"] = result.QuestionsGenerated
+		response["question_failures"] = result.QuestionFailures
+	}
+	if len(req.Chunks) > 0 {
+		response["chunks_supplied"] = result.ChunksSupplied
+	}
+	if result.ChunksSplit > 0 {
+		response["chunks_split"] = result.ChunksSplit
+		response["warning"] = fmt.Sprintf("%d chunks were too large for the embedding model and were embedded in pieces; "+
+			"a smaller chunk size would keep their embeddings precise", result.ChunksSplit)
+	}
+	if result.PagesRecognized > 0 {
+		response["pages_recognized"] = result.PagesRecognized
+		response["low_confidence_chunks"] = result.LowConfidenceChunks
+	}
+	if result.ExpiresAt != nil {
+		response["expires_at"] = result.ExpiresAt
 	}
 
 	if req.Source != "" {
@@ -103,215 +323,527 @@ func AddDocumentHandler(c *gin.Context) {
 		response["file_path"] = req.FilePath
 	}
 
-	c.JSON(http.StatusCreated, response)
+	status := http.StatusCreated
+	switch result.Status {
+	case core.IngestUpdated:
+		response["message"] = "Document updated successfully"
+	case core.IngestUnchanged:
+		response["message"] = "Document unchanged"
+		status = http.StatusOK
+	}
+
+	c.JSON(status, response)
 }
 
-func QueryHandler(c *gin.Context) {
-	var req models.QueryRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+// collectionChunkingConfig returns the chunking config stored in the collection's defaults,
+// falling back to the server default
+func collectionChunkingConfig(c *gin.Context, collectionName string) *models.ChunkingConfig {
+	config, err := tenantRAG(c).DefaultChunkingConfig(collectionName)
+	if err != nil {
+		log.Printf("Using default chunking config for collection %s: %v", collectionName, err)
+	}
+	if config == nil {
+		config = defaultChunkingConfig()
 	}
+	return config
+}
 
-	// Set defaults for enhanced features
-	if req.TopK <= 0 {
-		req.TopK = 5
+// bindQueryRequest binds a query request and fills the parameters it leaves out from its collection's
+// defaults. It returns the JSON fields the request set.
+func bindQueryRequest(c *gin.Context, req *models.QueryRequest) (map[string]bool, error) {
+	if err := c.ShouldBindBodyWith(req, binding.JSON); err != nil {
+		return nil, err
 	}
 
-	response, err := ragService.Query(&req)
-	if err != nil {
-		log.Printf("Error processing query for collection %s: %v", req.CollectionName, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process query"})
-		return
+	var fields map[string]json.RawMessage
+	if body, ok := c.Get(gin.BodyBytesKey); ok {
+		_ = json.Unmarshal(body.([]byte), &fields)
+	}
+	explicit := make(map[string]bool, len(fields))
+	for field := range fields {
+		explicit[field] = true
 	}
 
-	c.JSON(http.StatusOK, response)
+	if err := tenantRAG(c).ApplyQueryDefaults(req, explicit); err != nil {
+		log.Printf("Ignoring defaults of collection %s: %v", req.CollectionName, err)
+	}
+	applyCallerPrincipal(c, req)
+	return explicit, core.ValidateQueryFilters(req)
 }
 
-// SearchHandler performs only retrieval without LLM generation
-// Returns all context and metadata needed for external LLM processing
-func SearchHandler(c *gin.Context) {
-	var req models.QueryRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+// statusClientClosedRequest is the nginx convention for a client that went away before the response
+const statusClientClosedRequest = 499
+
+// abortOnContextError answers a request whose work ended because its context did: 504 when a
+// backend stage timed out, 499 when the client disconnected. It reports whether it responded.
+func abortOnContextError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out: " + err.Error()})
+	case errors.Is(err, context.Canceled) || c.Request.Context().Err() != nil:
+		c.AbortWithStatus(statusClientClosedRequest)
+	default:
+		return false
 	}
+	return true
+}
 
-	// Set defaults
-	if req.TopK <= 0 {
-		req.TopK = 5
+// abortOnDimensionMismatch answers 409 Conflict when err says the embedding model no longer matches
+// the stored embeddings, so the operator learns to re-embed instead of seeing a generic 500
+func abortOnDimensionMismatch(c *gin.Context, err error) bool {
+	var mismatch *core.EmbeddingDimensionError
+	if !errors.As(err, &mismatch) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": mismatch.Error()})
+	return true
+}
+
+// abortOnQuotaExceeded answers 413 Request Entity Too Large when err says a document would take its
+// collection or tenant past a quota
+func abortOnQuotaExceeded(c *gin.Context, err error) bool {
+	var quota *core.QuotaExceededError
+	if !errors.As(err, &quota) {
+		return false
 	}
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": quota.Error()})
+	return true
+}
 
-	startTime := time.Now()
+// abortOnInvalidEmbeddings responds 400 when embeddings supplied with a request can't be stored
+func abortOnInvalidEmbeddings(c *gin.Context, err error) bool {
+	var invalid *core.SuppliedEmbeddingError
+	if !errors.As(err, &invalid) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+	return true
+}
+
+// abortOnCollectionNotFound answers 404 Not Found when err says the collection documents were sent
+// to doesn't exist
+func abortOnCollectionNotFound(c *gin.Context, err error) bool {
+	var missing *core.CollectionNotFoundError
+	if !errors.As(err, &missing) {
+		return false
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": missing.Error()})
+	return true
+}
+
+// defaultChunkingConfig is used when a request does not specify how to chunk
+func defaultChunkingConfig() *models.ChunkingConfig {
+	return &models.ChunkingConfig{
+		Strategy:           models.StructuralStrategy,
+		FixedSize:          500,
+		Overlap:            50,
+		MinChunkSize:       100,
+		MaxChunkSize:       2000,
+		PreserveParagraphs: true,
+		ExtractKeywords:    true,
+	}
+}
 
-	// Use the original query (query expansion disabled for search-only mode)
-	query := req.Query
+// ImportDocumentsHandler bulk-loads documents whose chunks were embedded offline
+func ImportDocumentsHandler(c *gin.Context) {
+	var req models.ImportEmbeddingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Generate query embedding
-	embeddingClient := core.NewEmbeddingService()
-	queryEmbedding, err := embeddingClient.GetEmbedding(query)
+	results, err := tenantRAG(c).ImportDocuments(&req)
 	if err != nil {
-		log.Printf("Error generating query embedding: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate query embedding"})
+		log.Printf("Error importing documents into collection %s: %v", req.CollectionName, err)
+		var quota *core.QuotaExceededError
+		if abortOnCollectionNotFound(c, err) {
+			return
+		} else if strings.Contains(err.Error(), "invalid import") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if errors.As(err, &quota) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error(), "imported": results})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":    "Failed to import documents",
+				"imported": results,
+			})
+		}
 		return
 	}
 
-	// Build metadata filters
-	filters := make(map[string]interface{})
-	for key, value := range req.MetadataFilters {
-		filters[key] = value
+	totalChunks := 0
+	for _, result := range results {
+		totalChunks += result.ChunkCount
 	}
 
-	// Search for similar chunks
-	chunks, scores, err := vectorDB.QuerySimilarChunks(
-		req.CollectionName,
-		queryEmbedding,
-		req.TopK*2, // Get more for potential re-ranking
-		filters,
-	)
+	c.JSON(http.StatusCreated, gin.H{
+		"message":         "Documents imported successfully",
+		"collection_name": req.CollectionName,
+		"documents":       results,
+		"total_documents": len(results),
+		"total_chunks":    totalChunks,
+	})
+}
+
+// ImportFrameworkExportHandler imports a corpus exported by LangChain or LlamaIndex, sent as the
+// request body, into a collection
+func ImportFrameworkExportHandler(c *gin.Context) {
+	collectionName := c.Param("name")
+	var req models.FrameworkImportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	export, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		log.Printf("Error searching similar chunks: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search similar chunks"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the export: " + err.Error()})
 		return
 	}
 
-	if len(chunks) == 0 {
-		c.JSON(http.StatusOK, gin.H{
-			"query":           req.Query,
-			"expanded_query":  query,
-			"collection_name": req.CollectionName,
-			"chunks_found":    0,
-			"chunks":          []interface{}{},
-			"context":         "",
-			"processing_time": time.Since(startTime).Seconds(),
-			"metadata": gin.H{
-				"semantic_threshold": req.SemanticThreshold,
-				"metadata_filters":   req.MetadataFilters,
-				"query_expansion":    req.QueryExpansion,
-				"include_parents":    req.IncludeParents,
-				"reranker_enabled":   req.RerankerEnabled,
-			},
-		})
+	results, err := tenantRAG(c).ImportFrameworkExport(c.Request.Context(), collectionName, req.Format, export, req.IgnoreEmbeddings)
+	if err != nil {
+		log.Printf("Error importing %s export into collection %s: %v", req.Format, collectionName, err)
+		var quota *core.QuotaExceededError
+		if strings.Contains(err.Error(), "invalid import") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if errors.As(err, &quota) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error(), "imported": results})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":    "Failed to import documents",
+				"imported": results,
+			})
+		}
 		return
 	}
 
-	// Apply semantic threshold filtering
-	if req.SemanticThreshold > 0 {
-		filteredChunks := make([]*models.EnhancedChunk, 0)
-		filteredScores := make([]float64, 0)
+	totalChunks, chunksEmbedded := 0, 0
+	for _, result := range results {
+		totalChunks += result.ChunkCount
+		chunksEmbedded += result.ChunksEmbedded
+	}
 
-		for i, score := range scores {
-			if score >= req.SemanticThreshold {
-				filteredChunks = append(filteredChunks, chunks[i])
-				filteredScores = append(filteredScores, score)
-			}
-		}
+	c.JSON(http.StatusCreated, gin.H{
+		"message":         "Documents imported successfully",
+		"collection_name": collectionName,
+		"format":          req.Format,
+		"documents":       results,
+		"total_documents": len(results),
+		"total_chunks":    totalChunks,
+		"chunks_embedded": chunksEmbedded,
+	})
+}
 
-		chunks = filteredChunks
-		scores = filteredScores
-
-		if len(chunks) == 0 {
-			c.JSON(http.StatusOK, gin.H{
-				"query":           req.Query,
-				"expanded_query":  query,
-				"collection_name": req.CollectionName,
-				"chunks_found":    0,
-				"chunks":          []interface{}{},
-				"context":         "",
-				"message":         "No chunks met the semantic similarity threshold",
-				"processing_time": time.Since(startTime).Seconds(),
-				"metadata": gin.H{
-					"semantic_threshold": req.SemanticThreshold,
-					"metadata_filters":   req.MetadataFilters,
-					"query_expansion":    req.QueryExpansion,
-					"include_parents":    req.IncludeParents,
-					"reranker_enabled":   req.RerankerEnabled,
-				},
-			})
+// ndjsonContentTypes mark a batch ingestion body as a stream of one JSON document per line
+var ndjsonContentTypes = map[string]bool{
+	"application/x-ndjson": true,
+	"application/ndjson":   true,
+	"application/jsonl":    true,
+	"application/x-jsonl":  true,
+}
+
+// BatchIngestHandler adds many documents in one request: a JSON body with a documents array, or
+// an NDJSON stream of one document per line, with the collection and batch size as query parameters.
+// Every document gets its own status; one that fails does not stop the others.
+func BatchIngestHandler(c *gin.Context) {
+	var req models.BatchIngestRequest
+	stream := ndjsonContentTypes[c.ContentType()]
+	if stream {
+		req.CollectionName = c.Query("collection_name")
+		batchSize, err := strconv.Atoi(c.DefaultQuery("batch_size", "0"))
+		if req.CollectionName == "" || err != nil || batchSize < 0 || batchSize > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "NDJSON batches need a collection_name query parameter, and batch_size must be between 1 and 500"})
 			return
 		}
+		req.BatchSize = batchSize
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Note: Advanced features like parent inclusion and re-ranking
-	// are available in the full query endpoint (/api/v1/query)
-	// This search endpoint provides basic retrieval functionality
-
-	// Limit to TopK results
-	if len(chunks) > req.TopK {
-		chunks = chunks[:req.TopK]
-		scores = scores[:req.TopK]
+	if err := tenantDB(c).RequireCollection(req.CollectionName); err != nil {
+		if !abortOnCollectionNotFound(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ingest batch"})
+		}
+		return
 	}
 
-	// Prepare response with detailed chunk information
-	responseChunks := make([]gin.H, len(chunks))
-	for i, chunk := range chunks {
-		chunkInfo := gin.H{
-			"id":               chunk.ID,
-			"document_id":      chunk.DocumentID,
-			"text":             chunk.Text,
-			"section":          chunk.Section,
-			"subsection":       chunk.Subsection,
-			"chunk_type":       chunk.ChunkType,
-			"start_pos":        chunk.StartPos,
-			"end_pos":          chunk.EndPos,
-			"chunk_index":      chunk.ChunkIndex,
-			"keywords":         chunk.Keywords,
-			"confidence":       chunk.Confidence,
-			"similarity_score": scores[i],
+	// Documents without a chunking config use the collection's, or the default strategy
+	chunkingConfig := collectionChunkingConfig(c, req.CollectionName)
+	ingester := tenantRAG(c).NewBatchIngester(c.Request.Context(), req.CollectionName, req.BatchSize)
+	add := func(doc *models.AddDocumentRequest) error {
+		if doc.ChunkingConfig == nil {
+			config := *chunkingConfig
+			doc.ChunkingConfig = &config
 		}
+		return ingester.Add(doc)
+	}
 
-		// Add parent/child relationship info
-		if chunk.ParentChunkID != nil {
-			chunkInfo["parent_chunk_id"] = *chunk.ParentChunkID
+	var err error
+	if stream {
+		err = readDocumentStream(c.Request.Body, ingester, add)
+	} else {
+		for i := range req.Documents {
+			if err = add(&req.Documents[i]); err != nil {
+				break
+			}
 		}
-		if len(chunk.ChildChunkIDs) > 0 {
-			chunkInfo["child_chunk_ids"] = chunk.ChildChunkIDs
+	}
+	results, closeErr := ingester.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("Error ingesting batch into collection %s: %v", req.CollectionName, err)
+		if abortOnContextError(c, err) {
+			return
 		}
-
-		// Add metadata if available
-		if chunk.Metadata != nil {
-			chunkInfo["metadata"] = chunk.Metadata
+		if abortOnDimensionMismatch(c, err) {
+			return
 		}
-
-		responseChunks[i] = chunkInfo
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		var quota *core.QuotaExceededError
+		if errors.As(err, &tooLarge) || errors.As(err, &quota) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": err.Error(), "results": results})
+		return
 	}
 
-	// Prepare context string (concatenated chunks for easy LLM processing)
-	contextStrings := make([]string, len(chunks))
-	for i, chunk := range chunks {
-		contextStrings[i] = fmt.Sprintf("Context %d: %s", i+1, chunk.Text)
+	summary := make(map[string]int)
+	for _, result := range results {
+		summary[result.Status]++
 	}
-	context := strings.Join(contextStrings, "\n\n")
 
-	// Build comprehensive response
-	response := gin.H{
-		"query":           req.Query,
-		"expanded_query":  query,
+	c.JSON(http.StatusOK, gin.H{
 		"collection_name": req.CollectionName,
-		"chunks_found":    len(chunks),
-		"chunks":          responseChunks,
-		"context":         context,
-		"context_strings": contextStrings, // Alternative format for easier processing
-		"processing_time": time.Since(startTime).Seconds(),
-		"metadata": gin.H{
-			"semantic_threshold": req.SemanticThreshold,
-			"metadata_filters":   req.MetadataFilters,
-			"filters_applied":    len(req.MetadataFilters) > 0,
-			"note":               "Advanced features available in /api/v1/query endpoint",
-		},
-	}
+		"results":         results,
+		"summary":         summary,
+		"total_documents": len(results),
+	})
+}
 
-	// Add statistics
-	if len(scores) > 0 {
-		minScore := scores[0]
-		maxScore := scores[0]
-		totalScore := 0.0
-		for _, score := range scores {
-			if score < minScore {
-				minScore = score
-			}
-			if score > maxScore {
-				maxScore = score
+// readDocumentStream passes each line of an NDJSON stream to add; a malformed line is rejected
+// without stopping the stream
+func readDocumentStream(body io.Reader, ingester *core.BatchIngester, add func(*models.AddDocumentRequest) error) error {
+	reader := bufio.NewReader(body)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var doc models.AddDocumentRequest
+			if err := json.Unmarshal(line, &doc); err != nil {
+				ingester.Reject(fmt.Errorf("invalid document: %w", err))
+			} else if err := add(&doc); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read document stream: %w", readErr)
+		}
+	}
+}
+
+func QueryHandler(c *gin.Context) {
+	var req models.QueryRequest
+	explicit, err := bindQueryRequest(c, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tenantRAG(c).RouteQuery(&req, explicit); err != nil {
+		log.Printf("Not routing query for collection %s: %v", req.CollectionName, err)
+	}
+
+	// Set defaults for enhanced features
+	if req.TopK <= 0 {
+		req.TopK = 5
+	}
+
+	response, err := tenantRAG(c).Query(c.Request.Context(), &req)
+	if err != nil {
+		log.Printf("Error processing query for collection %s: %v", req.CollectionName, err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		if abortOnDimensionMismatch(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process query"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SearchHandler performs only retrieval without LLM generation
+// Returns all context and metadata needed for external LLM processing
+func SearchHandler(c *gin.Context) {
+	var req models.QueryRequest
+	if _, err := bindQueryRequest(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	startTime := time.Now()
+
+	// Same retrieval pipeline as /query (expansion, parents, re-ranking, MMR), without generation
+	rag := tenantRAG(c)
+	retrieved, err := rag.Retrieve(c.Request.Context(), &req)
+	if err != nil {
+		log.Printf("Error searching similar chunks: %v", err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		if abortOnDimensionMismatch(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search similar chunks"})
+		return
+	}
+	chunks, scores := retrieved.Chunks, retrieved.Scores
+	elapsed := time.Since(startTime)
+	rag.LogQuery(core.QueryLogSearch, &req, chunks, "", core.QueryTiming{Retrieval: elapsed, Total: elapsed})
+
+	metadata := gin.H{
+		"semantic_threshold": req.SemanticThreshold,
+		"metadata_filters":   req.MetadataFilters,
+		"filters_applied":    len(req.MetadataFilters) > 0,
+		"query_expansion":    req.QueryExpansion,
+		"include_parents":    req.IncludeParents,
+		"reranker_enabled":   req.RerankerEnabled,
+		"reranking_applied":  len(retrieved.RerankedScores) > 0,
+		"mmr_enabled":        req.MMREnabled,
+		"deduplicate_chunks": req.DeduplicateChunks,
+		"graph_rag":          req.GraphRAG,
+		"group_by_document":  req.GroupByDocument,
+		"degradations":       retrieved.Degradations,
+	}
+	if len(retrieved.GraphEntities) > 0 {
+		metadata["graph_entities"] = retrieved.GraphEntities
+	}
+	metadata["retrieval_granularity"] = req.RetrievalGranularity
+	if req.RetrievalGranularity == "" {
+		metadata["retrieval_granularity"] = models.ChunkGranularity
+	}
+	if retrieved.Collections != nil {
+		metadata["collections"] = retrieved.Collections
+		metadata["score_merge"] = "similarity"
+		if retrieved.RankFused {
+			metadata["score_merge"] = "rrf"
+		}
+	}
+	if len(req.Retrievers) > 0 {
+		metadata["retrievers"] = req.Retrievers
+		metadata["fusion"] = req.Fusion
+		if req.Fusion == "" {
+			metadata["fusion"] = models.RRFFusion
+		}
+	}
+
+	if len(chunks) == 0 {
+		response := gin.H{
+			"query":           req.Query,
+			"expanded_query":  retrieved.ExpandedQuery,
+			"collection_name": req.CollectionName,
+			"chunks_found":    0,
+			"chunks":          []interface{}{},
+			"context":         "",
+			"processing_time": time.Since(startTime).Seconds(),
+			"metadata":        metadata,
+		}
+		if retrieved.BelowThreshold {
+			response["message"] = "No chunks met the semantic similarity threshold"
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// Prepare response with detailed chunk information
+	responseChunks := make([]gin.H, len(chunks))
+	for i, chunk := range chunks {
+		chunkInfo := gin.H{
+			"id":               chunk.ID,
+			"document_id":      chunk.DocumentID,
+			"text":             chunk.Text,
+			"section":          chunk.Section,
+			"subsection":       chunk.Subsection,
+			"chunk_type":       chunk.ChunkType,
+			"start_pos":        chunk.StartPos,
+			"end_pos":          chunk.EndPos,
+			"chunk_index":      chunk.ChunkIndex,
+			"keywords":         chunk.Keywords,
+			"confidence":       chunk.Confidence,
+			"similarity_score": scores[i],
+		}
+		if i < len(retrieved.RerankedScores) {
+			chunkInfo["reranked_score"] = retrieved.RerankedScores[i]
+		}
+		if chunk.Collection != "" {
+			chunkInfo["collection"] = chunk.Collection
+		}
+
+		// Add parent/child relationship info
+		if chunk.ParentChunkID != nil {
+			chunkInfo["parent_chunk_id"] = *chunk.ParentChunkID
+		}
+		if len(chunk.ChildChunkIDs) > 0 {
+			chunkInfo["child_chunk_ids"] = chunk.ChildChunkIDs
+		}
+
+		// Add metadata if available
+		if chunk.Metadata != nil {
+			chunkInfo["metadata"] = chunk.Metadata
+		}
+
+		responseChunks[i] = chunkInfo
+	}
+
+	// Prepare context string (concatenated chunks for easy LLM processing)
+	contextStrings := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		contextStrings[i] = fmt.Sprintf("Context %d: %s", i+1, chunk.Text)
+	}
+	context := strings.Join(contextStrings, "\n\n")
+
+	// Build comprehensive response
+	response := gin.H{
+		"query":           req.Query,
+		"expanded_query":  retrieved.ExpandedQuery,
+		"collection_name": req.CollectionName,
+		"chunks_found":    len(chunks),
+		"chunks":          responseChunks,
+		"context":         context,
+		"context_strings": contextStrings, // Alternative format for easier processing
+		"processing_time": time.Since(startTime).Seconds(),
+		"metadata":        metadata,
+	}
+	if len(retrieved.ExpandedQueries) > 0 {
+		response["expanded_queries"] = retrieved.ExpandedQueries
+	}
+	if retrieved.Groups != nil {
+		response["documents"] = retrieved.Groups
+	}
+	if len(retrieved.SuppressedDuplicates) > 0 {
+		response["suppressed_duplicates"] = retrieved.SuppressedDuplicates
+	}
+
+	// Add statistics
+	if len(scores) > 0 {
+		minScore := scores[0]
+		maxScore := scores[0]
+		totalScore := 0.0
+		for _, score := range scores {
+			if score < minScore {
+				minScore = score
+			}
+			if score > maxScore {
+				maxScore = score
 			}
 			totalScore += score
 		}
@@ -327,13 +859,225 @@ func SearchHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// SearchDocumentsHandler finds whole documents similar to a query or to another document by their
+// document embeddings
+func SearchDocumentsHandler(c *gin.Context) {
+	var req models.DocumentSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if principal := callerPrincipal(c); principal != nil {
+		req.Principal = principal
+	}
+
+	resp, err := tenantRAG(c).SearchDocuments(c.Request.Context(), &req)
+	if err != nil {
+		log.Printf("Error searching documents: %v", err)
+		switch {
+		case errors.Is(err, core.ErrInvalidDocumentSearch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case strings.Contains(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			if abortOnContextError(c, err) {
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search documents"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DiscoverTopicsHandler clusters the chunks of a collection into labeled topics
+func DiscoverTopicsHandler(c *gin.Context) {
+	collectionName := c.Param("name")
+	if collectionName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name is required"})
+		return
+	}
+
+	// The body is optional; without one the number of topics follows the collection's size
+	var req models.TopicsRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if principal := callerPrincipal(c); principal != nil {
+		req.Principal = principal
+	}
+
+	resp, err := tenantRAG(c).DiscoverTopics(c.Request.Context(), collectionName, &req)
+	if err != nil {
+		log.Printf("Error finding topics of collection %s: %v", collectionName, err)
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if abortOnContextError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find topics"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ChatCompletionsHandler is an OpenAI-compatible chat completions endpoint that retrieves context
+// for the latest user message, injects it into the conversation and forwards it to the chat model.
+// Retrieval options go in an optional "rag" field, which OpenAI SDKs can send as an extra body field.
+func ChatCompletionsHandler(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	proxied, err := core.ParseProxiedChat(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if proxied.Stream && !core.SupportsChatPassthrough() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "streaming requires the openai provider"})
+		return
+	}
+	if err := prepareChatRetrieval(c, proxied); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	retrieved, err := tenantRAG(c).AugmentChat(c.Request.Context(), proxied)
+	if err != nil {
+		log.Printf("Error retrieving chat context for collection %s: %v", proxied.RAG.CollectionName, err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		if abortOnDimensionMismatch(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve context"})
+		return
+	}
+	c.Header("X-RAG-Chunks", fmt.Sprint(len(retrieved.Chunks)))
+	if len(retrieved.Degradations) > 0 {
+		c.Header("X-RAG-Degradations", strings.Join(retrieved.Degradations, ","))
+	}
+
+	// Providers without an OpenAI chat API get the plain text conversation and a built response
+	if !core.SupportsChatPassthrough() {
+		answer, err := core.GenerateChatCompletion(c.Request.Context(), proxied.Messages(), models.GenerationOptions{Model: proxied.Model})
+		if err != nil {
+			log.Printf("Error generating proxied chat completion: %v", err)
+			if abortOnContextError(c, err) {
+				return
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to generate chat completion"})
+			return
+		}
+		model := proxied.Model
+		if model == "" {
+			model = config.AppConfig.ChatModel
+		}
+		c.JSON(http.StatusOK, models.ChatCompletionResponse{
+			ID:      "chatcmpl-" + uuid.New().String(),
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   model,
+			Choices: []models.ChatChoice{{
+				Message:      models.ChatCompletionMessage{Role: "assistant", Content: answer},
+				FinishReason: "stop",
+			}},
+		})
+		return
+	}
+
+	forward, err := proxied.Body()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resp, err := core.ForwardChatCompletion(c.Request.Context(), forward)
+	if err != nil {
+		log.Printf("Error forwarding chat completion: %v", err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to reach the chat model"})
+		return
+	}
+	defer resp.Body.Close()
+
+	// Relay the model server's answer as is, flushing streamed events as they arrive
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	c.Status(resp.StatusCode)
+	buf := make([]byte, 4096)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := c.Writer.Write(buf[:n]); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				log.Printf("Chat completion stream ended early: %v", readErr)
+			}
+			return
+		}
+	}
+}
+
+// prepareChatRetrieval completes the retrieval options of a proxied conversation with the defaults
+// of its collection and the caller's principal, and validates them
+func prepareChatRetrieval(c *gin.Context, proxied *core.ProxiedChat) error {
+	if proxied.RAG.CollectionName == "" {
+		return errors.New("rag.collection_name is required when chat_proxy.collection is not configured")
+	}
+	if err := tenantRAG(c).ApplyQueryDefaults(&proxied.RAG, proxied.RAGFields); err != nil {
+		log.Printf("Ignoring defaults of collection %s: %v", proxied.RAG.CollectionName, err)
+	}
+	applyCallerPrincipal(c, &proxied.RAG)
+	if err := binding.Validator.ValidateStruct(&proxied.RAG); err != nil {
+		return fmt.Errorf("invalid rag options: %w", err)
+	}
+	if err := core.ValidateQueryFilters(&proxied.RAG); err != nil {
+		return fmt.Errorf("invalid rag options: %w", err)
+	}
+	return nil
+}
+
+// EmbeddingsHandler is an OpenAI-compatible embeddings endpoint. It embeds through the same cache
+// and batching as ingestion, so other services can share them instead of calling the model server directly.
+func EmbeddingsHandler(c *gin.Context) {
+	var req models.OpenAIEmbeddingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := core.EmbedForEndpoint(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, core.ErrEmbeddingInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error generating embeddings: %v", err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to reach the embedding model"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
 // Enhanced query endpoint with chunking strategy analysis
 func AnalyzeDocumentHandler(c *gin.Context) {
-	var req struct {
-		CollectionName string `json:"collection_name" binding:"required"`
-		Query          string `json:"query" binding:"required"`
-		ShowMetadata   bool   `json:"show_metadata"`
-	}
+	var req models.AnalyzeRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -350,10 +1094,14 @@ func AnalyzeDocumentHandler(c *gin.Context) {
 		QueryExpansion:    true,
 		SemanticThreshold: 0.1,
 	}
+	applyCallerPrincipal(c, queryReq)
 
-	response, err := ragService.Query(queryReq)
+	response, err := tenantRAG(c).Query(c.Request.Context(), queryReq)
 	if err != nil {
 		log.Printf("Error analyzing document for collection %s: %v", req.CollectionName, err)
+		if abortOnContextError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyze document"})
 		return
 	}
@@ -407,11 +1155,7 @@ func AnalyzeDocumentHandler(c *gin.Context) {
 
 // Endpoint to test different chunking strategies
 func CompareChunkingHandler(c *gin.Context) {
-	var req struct {
-		Content    string                    `json:"content" binding:"required"`
-		DocType    string                    `json:"doc_type"`
-		Strategies []models.ChunkingStrategy `json:"strategies"`
-	}
+	var req models.CompareChunkingRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -431,15 +1175,7 @@ func CompareChunkingHandler(c *gin.Context) {
 	results := make([]gin.H, 0, len(req.Strategies))
 
 	for _, strategy := range req.Strategies {
-		config := &models.ChunkingConfig{
-			Strategy:           strategy,
-			FixedSize:          500,
-			Overlap:            50,
-			MinChunkSize:       100,
-			MaxChunkSize:       2000,
-			PreserveParagraphs: true,
-			ExtractKeywords:    true,
-		}
+		config := core.StrategyChunkingConfig(strategy)
 
 		doc, err := core.ProcessDocumentContent(req.Content, "test_content", req.DocType, config)
 		if err != nil {
@@ -487,28 +1223,99 @@ func CompareChunkingHandler(c *gin.Context) {
 	})
 }
 
-// Health check endpoint
-func HealthHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "healthy",
-		"service": "rag-go-app",
-	})
+// shuttingDown is set once the server has received SIGTERM, so readiness probes fail and the
+// orchestrator stops routing traffic while in-flight requests finish
+var shuttingDown atomic.Bool
+
+// BeginShutdown marks the server as draining
+func BeginShutdown() {
+	shuttingDown.Store(true)
+}
+
+// Health check endpoint. Reports the state of every dependency, but always with status 200:
+// queries can still be served when the model server is down if degradation is enabled.
+func HealthHandler(c *gin.Context) {
+	status := "healthy"
+	checks := core.CheckDependencies(c.Request.Context(), vectorDB)
+	for _, check := range checks {
+		if !check.OK {
+			status = "degraded"
+		}
+	}
+
+	response := gin.H{
+		"status":        status,
+		"service":       "rag-go-app",
+		"checks":        checks,
+		"model_servers": core.BackendStatuses(),
+	}
+	if warmup != nil {
+		response["warmup"] = warmup.Status()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// LivenessHandler answers as long as the process can serve HTTP, without checking dependencies,
+// so an orchestrator doesn't restart the server because the model server is down
+func LivenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// ReadinessHandler returns 200 when the warm-up is done, the database is open and the model server
+// is reachable, and 503 otherwise or once the server is shutting down
+func ReadinessHandler(c *gin.Context) {
+	if shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+		return
+	}
+	if warmup != nil {
+		switch status := warmup.Status(); status.State {
+		case core.WarmupRunning:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "warming_up", "warmup": status})
+			return
+		case core.WarmupFailed:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "warmup_failed", "warmup": status})
+			return
+		}
+	}
+
+	checks := core.CheckDependencies(c.Request.Context(), vectorDB)
+	for _, check := range checks {
+		if !check.OK {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready", "checks": checks})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
 }
 
 // Collection management handlers
 
-// ListCollectionsHandler returns all collections with metadata
+// ListCollectionsHandler returns a page of collections with metadata
 func ListCollectionsHandler(c *gin.Context) {
-	collections, err := vectorDB.ListCollections()
+	var req models.ListCollectionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collections, total, err := tenantDB(c).ListCollections(&req)
 	if err != nil {
 		log.Printf("Error listing collections: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list collections"})
+		if strings.Contains(err.Error(), "invalid list options") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list collections"})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"collections": collections,
-		"total":       len(collections),
+		"total":       total,
+		"offset":      req.Offset,
+		"limit":       req.Limit,
+		"has_more":    req.Offset+len(collections) < total,
 	})
 }
 
@@ -520,7 +1327,7 @@ func DeleteCollectionHandler(c *gin.Context) {
 		return
 	}
 
-	err := vectorDB.DeleteCollection(collectionName)
+	err := tenantDB(c).DeleteCollection(collectionName)
 	if err != nil {
 		log.Printf("Error deleting collection %s: %v", collectionName, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
@@ -541,7 +1348,7 @@ func GetCollectionStatsHandler(c *gin.Context) {
 		return
 	}
 
-	stats, err := vectorDB.GetCollectionStats(collectionName)
+	stats, err := tenantDB(c).GetCollectionStats(collectionName)
 	if err != nil {
 		log.Printf("Error getting collection stats for %s: %v", collectionName, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get collection statistics"})
@@ -553,7 +1360,7 @@ func GetCollectionStatsHandler(c *gin.Context) {
 
 // Document management handlers
 
-// ListDocumentsHandler returns all documents in a collection
+// ListDocumentsHandler returns a page of documents in a collection
 func ListDocumentsHandler(c *gin.Context) {
 	collectionName := c.Param("name")
 	if collectionName == "" {
@@ -561,17 +1368,349 @@ func ListDocumentsHandler(c *gin.Context) {
 		return
 	}
 
-	documents, err := vectorDB.ListDocuments(collectionName)
+	var req models.ListDocumentsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Users of a JWT only see the documents their ACL allows
+	documents, total, err := tenantDB(c).ListDocuments(collectionName, &req, callerPrincipal(c))
 	if err != nil {
 		log.Printf("Error listing documents in collection %s: %v", collectionName, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list documents"})
+		if strings.Contains(err.Error(), "invalid list options") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list documents"})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"collection_name": collectionName,
 		"documents":       documents,
-		"total":           len(documents),
+		"total":           total,
+		"offset":          req.Offset,
+		"limit":           req.Limit,
+		"has_more":        req.Offset+len(documents) < total,
+	})
+}
+
+// SyncCollectionHandler reconciles a collection with a manifest of sources and content hashes
+func SyncCollectionHandler(c *gin.Context) {
+	collectionName := c.Param("name")
+	if collectionName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name is required"})
+		return
+	}
+
+	var req models.SyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range req.Documents {
+		if req.Documents[i].ChunkingConfig == nil {
+			req.Documents[i].ChunkingConfig = collectionChunkingConfig(c, collectionName)
+		}
+	}
+
+	results, err := tenantRAG(c).SyncCollection(c.Request.Context(), collectionName, &req)
+	if err != nil {
+		log.Printf("Error syncing collection %s: %v", collectionName, err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		if abortOnDimensionMismatch(c, err) {
+			return
+		}
+		if abortOnQuotaExceeded(c, err) {
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync collection"})
+		}
+		return
+	}
+
+	summary := make(map[string]int)
+	for _, result := range results {
+		summary[result.Status]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"collection_name": collectionName,
+		"results":         results,
+		"summary":         summary,
+	})
+}
+
+// SyncS3SourceHandler ingests the objects under a prefix of an S3-compatible bucket into a
+// collection, downloading only those whose ETag changed since the last sync
+func SyncS3SourceHandler(c *gin.Context) {
+	collectionName := c.Param("name")
+	if collectionName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name is required"})
+		return
+	}
+
+	var req models.S3SourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ChunkingConfig == nil {
+		req.ChunkingConfig = collectionChunkingConfig(c, collectionName)
+	}
+
+	results, err := tenantRAG(c).SyncS3Source(c.Request.Context(), collectionName, &req)
+	if err != nil {
+		log.Printf("Error syncing collection %s from s3://%s/%s: %v", collectionName, req.Bucket, req.Prefix, err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		if abortOnDimensionMismatch(c, err) {
+			return
+		}
+		if abortOnQuotaExceeded(c, err) {
+			return
+		}
+		if abortOnCollectionNotFound(c, err) {
+			return
+		}
+		var s3Err *core.S3Error
+		switch {
+		case errors.Is(err, core.ErrInvalidS3Source):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, core.ErrPrivateAddress):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The endpoint is on a private network; it must be listed in s3_sources.private_endpoints"})
+		case errors.As(err, &s3Err):
+			// The bucket could not be listed: wrong credentials, endpoint or bucket name
+			c.JSON(http.StatusBadGateway, gin.H{"error": s3Err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync collection from s3"})
+		}
+		return
+	}
+
+	summary := make(map[string]int)
+	for _, result := range results {
+		summary[result.Status]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"collection_name": collectionName,
+		"source":          "s3://" + req.Bucket + "/" + req.Prefix,
+		"results":         results,
+		"summary":         summary,
+	})
+}
+
+// CrawlWebsiteHandler crawls a website into a collection from its sitemap or a seed page
+func CrawlWebsiteHandler(c *gin.Context) {
+	collectionName := c.Param("name")
+	if collectionName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name is required"})
+		return
+	}
+
+	var req models.CrawlRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := core.ValidateCrawlRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ChunkingConfig == nil {
+		req.ChunkingConfig = collectionChunkingConfig(c, collectionName)
+	}
+
+	report, err := tenantRAG(c).CrawlWebsite(c.Request.Context(), collectionName, &req)
+	if err != nil {
+		log.Printf("Error crawling %s%s into collection %s: %v", req.SitemapURL, req.SeedURL, collectionName, err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		if abortOnDimensionMismatch(c, err) {
+			return
+		}
+		if abortOnQuotaExceeded(c, err) {
+			return
+		}
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case strings.Contains(err.Error(), "sitemap"):
+			// The sitemap could not be fetched or parsed
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to crawl website"})
+		}
+		return
+	}
+
+	summary := make(map[string]int)
+	for _, result := range report.Results {
+		summary[result.Status]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"collection_name": collectionName,
+		"source":          req.SitemapURL + req.SeedURL,
+		"results":         report.Results,
+		"summary":         summary,
+		"pages_fetched":   report.PagesFetched,
+		"truncated":       report.Truncated,
+	})
+}
+
+// ReembedCollectionHandler starts re-embedding a collection in the background. Progress is
+// reported by ReembedStatusHandler.
+func ReembedCollectionHandler(c *gin.Context) {
+	collectionName := c.Param("name")
+	if collectionName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name is required"})
+		return
+	}
+
+	// The body is optional; without one the configured model re-embeds in default batches
+	var req models.ReembedRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := tenantRAG(c).StartReembed(collectionName, &req)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case strings.Contains(err.Error(), "already running"):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Error starting re-embedding of collection %s: %v", collectionName, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start re-embedding"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, status)
+}
+
+// ReembedStatusHandler reports the progress of the latest re-embedding of a collection
+func ReembedStatusHandler(c *gin.Context) {
+	collectionName := c.Param("name")
+	status, ok := tenantRAG(c).ReembedStatus(collectionName)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No re-embedding has run for collection '%s'", collectionName)})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// EvaluateHandler runs a test set against a grid of retrieval parameters and reports quality metrics
+func EvaluateHandler(c *gin.Context) {
+	var req models.EvaluateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := core.ValidateEvaluateRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	startTime := time.Now()
+	runs, err := tenantRAG(c).Evaluate(c.Request.Context(), &req)
+	if err != nil {
+		log.Printf("Error evaluating collection %s: %v", req.CollectionName, err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case strings.Contains(err.Error(), "no documents"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run evaluation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"collection_name": req.CollectionName,
+		"cases":           len(req.TestSet),
+		"runs":            runs,
+		"processing_time": time.Since(startTime).Seconds(),
+	})
+}
+
+// GetDocumentHandler returns a document with its content, metadata and an outline of its chunks;
+// include=chunks adds the chunks themselves
+func GetDocumentHandler(c *gin.Context) {
+	documentID := c.Param("id")
+	if documentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Document ID is required"})
+		return
+	}
+
+	includeChunks := false
+	if include := c.Query("include"); include != "" {
+		for _, part := range strings.Split(include, ",") {
+			switch strings.TrimSpace(part) {
+			case "chunks":
+				includeChunks = true
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown include %q; supported: chunks", part)})
+				return
+			}
+		}
+	}
+
+	// Users of a JWT only see documents their ACL allows; others get the same 404 as for a missing one
+	document, err := tenantDB(c).GetDocument(documentID, includeChunks, callerPrincipal(c))
+	if err != nil {
+		log.Printf("Error getting document %s: %v", documentID, err)
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get document"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, document)
+}
+
+// DocumentChunksHandler lists the chunks a document was split into, in document order
+func DocumentChunksHandler(c *gin.Context) {
+	documentID := c.Param("id")
+	if documentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Document ID is required"})
+		return
+	}
+
+	// Like GetDocumentHandler, documents the caller's ACL doesn't allow are not found
+	chunks, err := tenantDB(c).GetDocumentChunks(documentID, callerPrincipal(c))
+	if err != nil {
+		log.Printf("Error listing chunks of document %s: %v", documentID, err)
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list document chunks"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_id": documentID,
+		"chunks":      chunks,
+		"total":       len(chunks),
 	})
 }
 
@@ -583,7 +1722,7 @@ func DeleteDocumentHandler(c *gin.Context) {
 		return
 	}
 
-	err := vectorDB.DeleteDocument(documentID)
+	err := tenantDB(c).DeleteDocument(documentID)
 	if err != nil {
 		log.Printf("Error deleting document %s: %v", documentID, err)
 		if strings.Contains(err.Error(), "not found") {
@@ -600,6 +1739,146 @@ func DeleteDocumentHandler(c *gin.Context) {
 	})
 }
 
+// SimilarChunksHandler returns the chunks most similar to a chunk by its stored embedding, for
+// related-passage suggestions
+func SimilarChunksHandler(c *gin.Context) {
+	var req models.SimilarChunksRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Principal = callerPrincipal(c)
+
+	resp, err := tenantRAG(c).SimilarChunks(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		log.Printf("Error finding chunks similar to %s: %v", c.Param("id"), err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find similar chunks"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DuplicatesReportHandler reports the groups of duplicate and near-duplicate documents of a
+// collection, with the documents each group suggests removing
+func DuplicatesReportHandler(c *gin.Context) {
+	collectionName := c.Param("name")
+	if collectionName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name is required"})
+		return
+	}
+
+	var req models.DuplicatesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Principal = callerPrincipal(c)
+
+	report, err := tenantRAG(c).FindDuplicates(c.Request.Context(), collectionName, &req)
+	if err != nil {
+		log.Printf("Error finding duplicates in collection %s: %v", collectionName, err)
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if abortOnContextError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find duplicates"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ResolveDuplicatesHandler deletes duplicates of a kept document, as a duplicate group suggests
+func ResolveDuplicatesHandler(c *gin.Context) {
+	collectionName := c.Param("name")
+	if collectionName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name is required"})
+		return
+	}
+
+	var req models.ResolveDuplicatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := tenantRAG(c).ResolveDuplicates(c.Request.Context(), collectionName, &req)
+	if err != nil {
+		log.Printf("Error resolving duplicates in collection %s: %v", collectionName, err)
+		switch {
+		case errors.Is(err, core.ErrInvalidResolution):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case strings.Contains(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			if abortOnContextError(c, err) {
+				return
+			}
+			body := gin.H{"error": "Failed to resolve duplicates"}
+			if resp != nil {
+				// Documents removed before the failure stay removed
+				body["removed"] = resp.Removed
+			}
+			c.JSON(http.StatusInternalServerError, body)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateChunkHandler replaces a chunk's text (e.g. an OCR correction) and re-embeds it, unless the
+// request supplies the embedding
+func UpdateChunkHandler(c *gin.Context) {
+	chunkID := c.Param("id")
+	if chunkID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chunk ID is required"})
+		return
+	}
+
+	var req models.UpdateChunkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	chunk, err := tenantRAG(c).UpdateChunkText(c.Request.Context(), chunkID, req.Text, req.Embedding)
+	if err != nil {
+		log.Printf("Error updating chunk %s: %v", chunkID, err)
+		if abortOnContextError(c, err) {
+			return
+		}
+		if abortOnDimensionMismatch(c, err) {
+			return
+		}
+		if abortOnInvalidEmbeddings(c, err) {
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else if strings.Contains(err.Error(), "cannot be empty") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chunk"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Chunk updated successfully",
+		"chunk":    chunk,
+		"revision": chunk.Revision,
+	})
+}
+
 // DeleteAllDocumentsHandler deletes all documents in a collection
 func DeleteAllDocumentsHandler(c *gin.Context) {
 	collectionName := c.Param("name")
@@ -618,7 +1897,7 @@ func DeleteAllDocumentsHandler(c *gin.Context) {
 		return
 	}
 
-	err := vectorDB.DeleteAllDocumentsInCollection(collectionName)
+	err := tenantDB(c).DeleteAllDocumentsInCollection(collectionName)
 	if err != nil {
 		log.Printf("Error deleting all documents in collection %s: %v", collectionName, err)
 		if strings.Contains(err.Error(), "no documents found") {
@@ -635,8 +1914,317 @@ func DeleteAllDocumentsHandler(c *gin.Context) {
 	})
 }
 
+// EmbeddingMetricsHandler reports the work of the embedding path: cache hits, model server
+// batches and failures, and /v1/embeddings traffic
+func EmbeddingMetricsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, core.GetEmbeddingMetrics())
+}
+
+// WebhookStatusHandler reports the deliveries to each configured webhook endpoint
+func WebhookStatusHandler(c *gin.Context) {
+	if webhooks == nil {
+		c.JSON(http.StatusOK, core.WebhookStatus{Enabled: false})
+		return
+	}
+	c.JSON(http.StatusOK, webhooks.Status())
+}
+
+// QueryAnalyticsHandler aggregates the tenant's logged queries: top and unanswered queries,
+// average latency and the most retrieved documents
+func QueryAnalyticsHandler(c *gin.Context) {
+	var req models.QueryAnalyticsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	analytics, err := tenantDB(c).QueryAnalytics(&req)
+	if err != nil {
+		log.Printf("Error aggregating query log: %v", err)
+		if strings.Contains(err.Error(), "invalid analytics options") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate query log"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, analytics)
+}
+
+// UsageHandler reports what the tenant and its collections store and the quotas that apply
+func UsageHandler(c *gin.Context) {
+	report, err := tenantDB(c).Usage(c.Query("collection_name"))
+	if err != nil {
+		log.Printf("Error reading usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read usage"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// SystemInfoHandler reports the configured models, the embedding dimension, the reachability of
+// the backends, the database and what the tenant stores
+func SystemInfoHandler(c *gin.Context) {
+	info, err := tenantRAG(c).SystemInfo(c.Request.Context())
+	if err != nil {
+		log.Printf("Error reading system information: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read system information"})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// Replication handlers
+
+// ReplicationStatusHandler reports the state of warm standby replication
+func ReplicationStatusHandler(c *gin.Context) {
+	if replicator == nil {
+		c.JSON(http.StatusOK, core.ReplicationStatus{Enabled: false})
+		return
+	}
+	c.JSON(http.StatusOK, replicator.Status())
+}
+
+// ReplicationSyncHandler ships a snapshot immediately instead of waiting for the next interval
+func ReplicationSyncHandler(c *gin.Context) {
+	if replicator == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Replication is not enabled"})
+		return
+	}
+
+	if err := replicator.Sync(); err != nil {
+		log.Printf("Error running replication sync: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to replicate snapshot",
+			"status": replicator.Status(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Snapshot replicated successfully",
+		"status":  replicator.Status(),
+	})
+}
+
+// ReceiveSnapshotHandler stores a snapshot shipped by a primary when this instance is a follower
+func ReceiveSnapshotHandler(c *gin.Context) {
+	standbyPath := config.AppConfig.Replication.StandbyPath
+	checksum := c.GetHeader(core.ReplicationChecksumHeader)
+
+	size, err := core.ReceiveSnapshot(standbyPath, c.Request.Body, checksum, config.AppConfig.Replication.MaxSnapshotBytes)
+	if err != nil {
+		log.Printf("Error receiving replicated snapshot: %v", err)
+		switch {
+		case errors.Is(err, core.ErrSnapshotTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case strings.Contains(err.Error(), "invalid snapshot") || strings.Contains(err.Error(), "not configured"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store snapshot"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Snapshot stored successfully",
+		"standby_path": standbyPath,
+		"bytes":        size,
+	})
+}
+
+// Backup handlers
+
+// BackupStatusHandler lists the backups on disk and reports the outcome of the last one
+func BackupStatusHandler(c *gin.Context) {
+	if backups == nil {
+		c.JSON(http.StatusOK, core.BackupStatus{Enabled: false, Backups: []core.BackupInfo{}})
+		return
+	}
+	status, err := backups.Status()
+	if err != nil {
+		log.Printf("Error listing backups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list backups"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// BackupHandler takes a consistent backup of the database now
+func BackupHandler(c *gin.Context) {
+	if backups == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Backups are not configured"})
+		return
+	}
+
+	info, err := backups.Backup()
+	if err != nil {
+		log.Printf("Error backing up database: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to back up database"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Backup created successfully",
+		"backup":  info,
+	})
+}
+
+// RestoreHandler replaces the database with a backup, after backing up the current contents
+func RestoreHandler(c *gin.Context) {
+	if backups == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Backups are not configured"})
+		return
+	}
+
+	var req models.RestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := backups.Restore(c.Request.Context(), req.Name)
+	if err != nil {
+		log.Printf("Error restoring backup %s: %v", req.Name, err)
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case strings.Contains(err.Error(), "invalid backup"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore backup"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Backup restored successfully",
+		"restored":      result.Restored,
+		"safety_backup": result.SafetyBackup,
+	})
+}
+
+// Maintenance handlers
+
+// MaintenanceStatusHandler reports the maintenance schedule and the outcome of the last run
+func MaintenanceStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, maintainer.Status())
+}
+
+// MaintenanceHandler runs database maintenance now, every step or those named in the body
+func MaintenanceHandler(c *gin.Context) {
+	var req models.MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := maintainer.Run(core.MaintenanceManual, req.Steps)
+	if err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, core.ErrReadOnly) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "Maintenance completed successfully"
+	if report.Error != "" {
+		message = "Maintenance completed with errors"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"report":  report,
+	})
+}
+
+// FsckHandler checks the referential integrity of the database, repairing what it finds with ?repair=true
+func FsckHandler(c *gin.Context) {
+	report, err := vectorDB.Fsck(c.Query("repair") == "true")
+	if err != nil {
+		log.Printf("Error checking database consistency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check database consistency"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// Crawler handlers
+
+// CrawlerStatusHandler reports the websites crawled on a schedule and the outcome of their last crawl
+func CrawlerStatusHandler(c *gin.Context) {
+	if crawler == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false, "sites": []core.CrawlSiteStatus{}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "sites": crawler.Status()})
+}
+
+// Encryption handlers
+
+// EncryptionStatusHandler reports the encryption mode and how many documents and chunks are sealed
+// with each key
+func EncryptionStatusHandler(c *gin.Context) {
+	status, err := vectorDB.EncryptionStatus()
+	if err != nil {
+		log.Printf("Error reading encryption status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read encryption status"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// KeyRotationHandler starts re-encrypting the stored text not sealed with the current key
+func KeyRotationHandler(c *gin.Context) {
+	progress, err := vectorDB.StartKeyRotation()
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Key rotation started",
+		"rotation": progress,
+	})
+}
+
 // Cleanup function
 func Cleanup() {
+	chatSessions.done.Wait()
+	if warmup != nil {
+		warmup.Stop()
+	}
+	if annIndexes != nil {
+		core.SetANNIndexes(nil)
+		annIndexes.Stop()
+	}
+	if profiling != nil {
+		stopProfilingServer(profiling)
+		profiling = nil
+	}
+	if crawler != nil {
+		crawler.Stop()
+	}
+	if backups != nil {
+		backups.Stop()
+	}
+	if maintainer != nil {
+		maintainer.Stop()
+	}
+	if sweeper != nil {
+		sweeper.Stop()
+	}
+	if replicator != nil {
+		replicator.Stop()
+	}
+	if webhooks != nil {
+		core.SetWebhookDispatcher(nil)
+		webhooks.Stop()
+	}
+	if tracer != nil {
+		core.SetTracer(nil)
+		tracer.Stop()
+	}
 	if vectorDB != nil {
 		vectorDB.Close()
 	}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rag-go-app/config"
+	"rag-go-app/core"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReceiveSnapshotSizeLimit(t *testing.T) {
+	saved := config.AppConfig.Replication
+	t.Cleanup(func() { config.AppConfig.Replication = saved })
+	standby := filepath.Join(t.TempDir(), "standby.db")
+	config.AppConfig.Replication = config.ReplicationConfig{StandbyPath: standby, MaxSnapshotBytes: 64}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/snapshot", MaxBodySizeMiddleware(config.AppConfig.Replication.MaxSnapshotBytes), ReceiveSnapshotHandler)
+	post := func(body io.Reader) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/snapshot", body))
+		return w.Code
+	}
+
+	if code := post(strings.NewReader(strings.Repeat("x", 64))); code != http.StatusOK {
+		t.Fatalf("snapshot at the limit: status %d, want 200", code)
+	}
+	// A declared length over the limit is refused up front, and a body without one is cut off
+	if code := post(strings.NewReader(strings.Repeat("y", 65))); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("snapshot over the limit: status %d, want 413", code)
+	}
+	if code := post(io.MultiReader(strings.NewReader(strings.Repeat("z", 1000)))); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("streamed snapshot over the limit: status %d, want 413", code)
+	}
+	if data, _ := os.ReadFile(standby); string(data) != strings.Repeat("x", 64) {
+		t.Error("a refused snapshot replaced the stored one")
+	}
+}
+
+// useTestDB points the handlers at a database in a temporary directory holding the collection
+// "shared" with a public document, one only alice may see and one for the engineering group
+func useTestDB(t *testing.T) {
+	t.Helper()
+	db, err := core.NewVectorDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewVectorDB: %v", err)
+	}
+	savedDB, savedRAG := vectorDB, ragService
+	vectorDB, ragService = db, core.NewRAGService(db, nil, nil)
+	t.Cleanup(func() {
+		vectorDB, ragService = savedDB, savedRAG
+		db.Close()
+	})
+
+	if err := db.CreateCollection("shared", "", nil, nil); err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	document := func(id string, acl *models.DocumentACL) models.ImportedDocument {
+		return models.ImportedDocument{ID: id, Source: id + ".txt", ACL: acl, Chunks: []models.ImportedChunk{
+			{Text: id + " first", Embedding: []float32{1, 0, 0, 0}},
+			{Text: id + " second", Embedding: []float32{0, 1, 0, 0}},
+		}}
+	}
+	_, err = ragService.ImportDocuments(&models.ImportEmbeddingsRequest{CollectionName: "shared", Documents: []models.ImportedDocument{
+		document("public", nil),
+		document("alice-only", &models.DocumentACL{Users: []string{"alice"}}),
+		document("engineering", &models.DocumentACL{Groups: []string{"engineering"}}),
+	}})
+	if err != nil {
+		t.Fatalf("ImportDocuments: %v", err)
+	}
+}
+
+// documentRouter serves route with the caller authenticated as a JWT user, or as an API key
+// when user is empty
+func documentRouter(route string, handler gin.HandlerFunc, user string, groups ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET(route, func(c *gin.Context) {
+		caller := &identity{Kind: core.RoleSubjectAPIKey, Role: core.RoleReader}
+		if user != "" {
+			caller = &identity{Kind: core.RoleSubjectUser, Subject: user, Groups: groups, Role: core.RoleReader}
+		}
+		c.Set(identityContextKey, caller)
+	}, handler)
+	return r
+}
+
+// getStatus sends a GET request and returns the status
+func getStatus(r *gin.Engine, target string) int {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	return w.Code
+}
+
+func TestGetDocumentHonoursACL(t *testing.T) {
+	useTestDB(t)
+
+	tests := []struct {
+		name     string
+		user     string
+		groups   []string
+		document string
+		want     int
+	}{
+		{"public document", "bob", nil, "public", http.StatusOK},
+		{"listed user", "alice", nil, "alice-only", http.StatusOK},
+		{"other user", "bob", nil, "alice-only", http.StatusNotFound},
+		{"listed group", "bob", []string{"engineering"}, "engineering", http.StatusOK},
+		{"other group", "bob", []string{"sales"}, "engineering", http.StatusNotFound},
+		{"missing document", "alice", nil, "missing", http.StatusNotFound},
+		{"API key", "", nil, "alice-only", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := documentRouter("/documents/:id", GetDocumentHandler, tt.user, tt.groups...)
+			if code := getStatus(r, "/documents/"+tt.document+"?include=chunks"); code != tt.want {
+				t.Errorf("GET /documents/%s as %q: status %d, want %d", tt.document, tt.user, code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentChunksHonoursACL(t *testing.T) {
+	useTestDB(t)
+
+	tests := []struct {
+		name     string
+		user     string
+		groups   []string
+		document string
+		want     int
+	}{
+		{"public document", "bob", nil, "public", http.StatusOK},
+		{"listed user", "alice", nil, "alice-only", http.StatusOK},
+		{"other user", "bob", []string{"engineering"}, "alice-only", http.StatusNotFound},
+		{"listed group", "carol", []string{"engineering"}, "engineering", http.StatusOK},
+		{"API key", "", nil, "engineering", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := documentRouter("/documents/:id/chunks", DocumentChunksHandler, tt.user, tt.groups...)
+			if code := getStatus(r, "/documents/"+tt.document+"/chunks"); code != tt.want {
+				t.Errorf("GET /documents/%s/chunks as %q: status %d, want %d", tt.document, tt.user, code, tt.want)
+			}
+		})
+	}
+}
+
+func TestListDocumentsHonoursACL(t *testing.T) {
+	useTestDB(t)
+
+	tests := []struct {
+		name   string
+		user   string
+		groups []string
+		want   []string
+	}{
+		{"other user", "bob", nil, []string{"public"}},
+		{"listed user", "alice", nil, []string{"alice-only", "public"}},
+		{"listed group", "bob", []string{"engineering"}, []string{"engineering", "public"}},
+		{"API key", "", nil, []string{"alice-only", "engineering", "public"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := documentRouter("/collections/:name/documents", ListDocumentsHandler, tt.user, tt.groups...)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/collections/shared/documents", nil))
+			var resp struct {
+				Documents []struct {
+					ID string `json:"id"`
+				} `json:"documents"`
+				Total int `json:"total"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", w.Code, w.Body.String())
+			}
+			var ids []string
+			for _, doc := range resp.Documents {
+				ids = append(ids, doc.ID)
+			}
+			sort.Strings(ids)
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") || resp.Total != len(tt.want) {
+				t.Errorf("listed %v of %d, want %v", ids, resp.Total, tt.want)
+			}
+		})
+	}
+}
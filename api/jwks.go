@@ -0,0 +1,177 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSRefresh = time.Hour
+	jwksMinRefresh     = time.Minute // Unknown key IDs trigger a fetch at most this often
+	maxJWKSBytes       = 1 << 20
+)
+
+// jwksClient fetches OIDC discovery documents and key sets
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+// jwksCache holds the signing keys an OIDC provider publishes, fetched on first use, again once
+// they are older than refresh, and sooner when a token names a key ID not seen yet, so keys the
+// provider rotates in are picked up right away. A failed fetch keeps the keys it had.
+type jwksCache struct {
+	url     string // Key set URL; found through discovery on the first fetch when empty
+	issuer  string
+	refresh time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey // By key ID
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func newJWKSCache(url, issuer string, refresh time.Duration) *jwksCache {
+	return &jwksCache{url: url, issuer: issuer, refresh: refresh}
+}
+
+// key returns the public key with the given ID. Without an ID, it returns the only key of the
+// set.
+func (j *jwksCache) key(kid string, now time.Time) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, known := j.keys[kid]
+	stale := now.Sub(j.fetchedAt) > j.refresh
+	if (stale || (!known && kid != "")) && now.Sub(j.attemptedAt) >= jwksMinRefresh {
+		j.attemptedAt = now
+		if err := j.fetch(); err != nil {
+			log.Printf("Failed to fetch JWKS: %v", err)
+		} else {
+			j.fetchedAt = now
+		}
+	}
+
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, nil
+		}
+	}
+	key, ok := j.keys[kid]
+	if !ok {
+		if j.keys == nil {
+			return nil, errors.New("signing keys of the token issuer are unavailable")
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// fetch downloads the key set, discovering its URL from the issuer first if needed
+func (j *jwksCache) fetch() error {
+	if j.url == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := getJSON(strings.TrimRight(j.issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return fmt.Errorf("OIDC discovery failed: %w", err)
+		}
+		if discovery.Issuer != j.issuer {
+			return fmt.Errorf("OIDC discovery returned issuer %q, not %q", discovery.Issuer, j.issuer)
+		}
+		if discovery.JWKSURI == "" {
+			return errors.New("OIDC discovery returned no jwks_uri")
+		}
+		j.url = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(j.url, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("no usable signing keys in JWKS")
+	}
+	j.keys = keys
+	return nil
+}
+
+// jsonWebKey is an RSA or EC public key of a JWKS
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("malformed RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("malformed EC key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC key is not on its curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// getJSON decodes the JSON document at url
+func getJSON(url string, out interface{}) error {
+	resp, err := jwksClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(out); err != nil {
+		return fmt.Errorf("GET %s: %w", url, err)
+	}
+	return nil
+}
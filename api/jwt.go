@@ -0,0 +1,203 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"rag-go-app/config"
+	"strings"
+	"time"
+)
+
+// jwtLeeway tolerates clock drift between the token issuer and this server
+const jwtLeeway = time.Minute
+
+// jwtVerifier checks the signature and registered claims of JWT bearer tokens
+type jwtVerifier struct {
+	secret    []byte
+	publicKey crypto.PublicKey
+	jwks      *jwksCache // Keys of an OIDC provider, when neither secret nor publicKey is set
+	issuer    string
+	audience  string
+}
+
+// newJWTVerifier returns a verifier for the configured secret, public key or JWKS, or nil when
+// none is set and JWTs are not accepted. With only an issuer, its JWKS is found through OIDC
+// discovery.
+func newJWTVerifier(cfg config.JWTConfig) (*jwtVerifier, error) {
+	if cfg.Secret == "" && cfg.PublicKeyFile == "" && cfg.JWKSURL == "" && cfg.Issuer == "" {
+		return nil, nil
+	}
+	verifier := &jwtVerifier{secret: []byte(cfg.Secret), issuer: cfg.Issuer, audience: cfg.Audience}
+	switch {
+	case cfg.PublicKeyFile != "":
+		pemBytes, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT public key: %w", err)
+		}
+		block, _ := pem.Decode(pemBytes)
+		if block == nil {
+			return nil, fmt.Errorf("no PEM block in JWT public key file %s", cfg.PublicKeyFile)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT public key: %w", err)
+		}
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+		default:
+			return nil, fmt.Errorf("JWT public key must be RSA or ECDSA, not %T", key)
+		}
+		verifier.publicKey = key
+	case cfg.Secret == "":
+		refresh := time.Duration(cfg.JWKSRefreshSeconds) * time.Second
+		if refresh <= 0 {
+			refresh = defaultJWKSRefresh
+		}
+		verifier.jwks = newJWKSCache(cfg.JWKSURL, cfg.Issuer, refresh)
+	}
+	return verifier, nil
+}
+
+// looksLikeJWT tells bearer tokens in JWT form apart from API keys
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && strings.HasPrefix(token, "eyJ")
+}
+
+// verify checks a token's signature, expiry, issuer and audience and returns its claims
+func (v *jwtVerifier) verify(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	var key interface{} = v.secret
+	if v.publicKey != nil {
+		key = v.publicKey
+	} else if v.jwks != nil {
+		if key, err = v.jwks.key(header.Kid, now); err != nil {
+			return nil, err
+		}
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not valid yet")
+	}
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return nil, errors.New("token issuer not accepted")
+	}
+	if v.audience != "" && !containsString(claimStrings(claims["aud"]), v.audience) {
+		return nil, errors.New("token audience not accepted")
+	}
+	return claims, nil
+}
+
+// verifySignature checks the signature of the token's header and payload with an HMAC secret or
+// a public key. The algorithm must match the kind of key, so an RSA public key can't be used as
+// an HMAC secret.
+func verifySignature(alg string, key interface{}, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch key := key.(type) {
+	case []byte:
+		if alg != "HS256" {
+			break
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			break
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			break
+		}
+		// JWS signatures are r and s as fixed-size big-endian integers, not ASN.1
+		if len(signature) != 64 {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("token algorithm %q not accepted", alg)
+}
+
+// decodeJWTPart decodes a base64url JSON segment of a token
+func decodeJWTPart(part string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
+
+// claimStrings reads a claim holding a string or a list of strings
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rag-go-app/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://issuer.example"
+	testAudience = "rag"
+)
+
+// signJWT builds a token from header and claims, signed with an HMAC secret ([]byte), an RSA
+// private key, or not at all (nil)
+func signJWT(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// testClaims returns claims valid at now, with the changes applied
+func testClaims(now time.Time, changes map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": "alice",
+		"iss": testIssuer,
+		"aud": testAudience,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for name, value := range changes {
+		claims[name] = value
+	}
+	return claims
+}
+
+// newRSAKey generates an RSA key pair and writes its public key as PEM into a temporary file
+func newRSAKey(t *testing.T) (*rsa.PrivateKey, string, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	path := filepath.Join(t.TempDir(), "public.pem")
+	if err := os.WriteFile(path, pemBytes, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return key, path, pemBytes
+}
+
+func TestJWTVerifierRejectsInvalidTokens(t *testing.T) {
+	now := time.Now()
+	secret := []byte("a shared secret of enough length")
+	rsaKey, publicKeyFile, publicPEM := newRSAKey(t)
+
+	hsVerifier, err := newJWTVerifier(config.JWTConfig{Secret: string(secret), Issuer: testIssuer, Audience: testAudience})
+	if err != nil {
+		t.Fatalf("newJWTVerifier(secret): %v", err)
+	}
+	rsVerifier, err := newJWTVerifier(config.JWTConfig{PublicKeyFile: publicKeyFile, Issuer: testIssuer, Audience: testAudience})
+	if err != nil {
+		t.Fatalf("newJWTVerifier(public key): %v", err)
+	}
+
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	rs256 := map[string]interface{}{"alg": "RS256", "typ": "JWT"}
+	tamper := func(token string) string {
+		parts := strings.Split(token, ".")
+		parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"mallory","iss":"` + testIssuer + `","aud":"` + testAudience + `"}`))
+		return strings.Join(parts, ".")
+	}
+
+	tests := []struct {
+		name     string
+		verifier *jwtVerifier
+		token    string
+		wantErr  string // Empty when the token is accepted
+	}{
+		{"valid HS256", hsVerifier, signJWT(t, hs256, testClaims(now, nil), secret), ""},
+		{"valid RS256", rsVerifier, signJWT(t, rs256, testClaims(now, nil), rsaKey), ""},
+		{"alg none to a secret", hsVerifier, signJWT(t, map[string]interface{}{"alg": "none"}, testClaims(now, nil), nil), "not accepted"},
+		{"alg none to a public key", rsVerifier, signJWT(t, map[string]interface{}{"alg": "none"}, testClaims(now, nil), nil), "not accepted"},
+		{"HS256 signed with the public key", rsVerifier, signJWT(t, hs256, testClaims(now, nil), publicPEM), "not accepted"},
+		{"RS256 to a secret", hsVerifier, signJWT(t, rs256, testClaims(now, nil), rsaKey), "not accepted"},
+		{"wrong secret", hsVerifier, signJWT(t, hs256, testClaims(now, nil), []byte("another secret")), "invalid token signature"},
+		{"tampered payload", rsVerifier, tamper(signJWT(t, rs256, testClaims(now, nil), rsaKey)), "invalid token signature"},
+		{"expired", hsVerifier, signJWT(t, hs256, testClaims(now, map[string]interface{}{"exp": now.Add(-2 * jwtLeeway).Unix()}), secret), "expired"},
+		{"expired within leeway", hsVerifier, signJWT(t, hs256, testClaims(now, map[string]interface{}{"exp": now.Add(-jwtLeeway / 2).Unix()}), secret), ""},
+		{"not yet valid", hsVerifier, signJWT(t, hs256, testClaims(now, map[string]interface{}{"nbf": now.Add(2 * jwtLeeway).Unix()}), secret), "not valid yet"},
+		{"wrong issuer", hsVerifier, signJWT(t, hs256, testClaims(now, map[string]interface{}{"iss": "https://evil.example"}), secret), "issuer"},
+		{"no issuer", rsVerifier, signJWT(t, rs256, testClaims(now, map[string]interface{}{"iss": nil}), rsaKey), "issuer"},
+		{"wrong audience", hsVerifier, signJWT(t, hs256, testClaims(now, map[string]interface{}{"aud": "other"}), secret), "audience"},
+		{"audience among others", hsVerifier, signJWT(t, hs256, testClaims(now, map[string]interface{}{"aud": []string{"other", testAudience}}), secret), ""},
+		{"missing signature", hsVerifier, "eyJhbGciOiJIUzI1NiJ9.e30", "malformed"},
+		{"undecodable signature", hsVerifier, "eyJhbGciOiJIUzI1NiJ9.e30.not base64", "malformed"},
+	}
+	for _, tt := range tests {
+		_, err := tt.verifier.verify(tt.token, now)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: rejected: %v", tt.name, err)
+		case tt.wantErr != "" && err == nil:
+			t.Errorf("%s: accepted, want an error containing %q", tt.name, tt.wantErr)
+		case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+			t.Errorf("%s: got error %q, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// testJWKS serves a key set whose keys can be swapped while it runs, counting the fetches
+type testJWKS struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetches int
+}
+
+func (j *testJWKS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.fetches++
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	for kid, key := range j.keys {
+		set.Keys = append(set.Keys, jsonWebKey{
+			Kty: "RSA", Kid: kid, Use: "sig",
+			N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	json.NewEncoder(w).Encode(set)
+}
+
+func (j *testJWKS) serve(keys map[string]*rsa.PublicKey) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys = keys
+}
+
+func TestJWKSVerifierKeys(t *testing.T) {
+	oldKey, _, _ := newRSAKey(t)
+	newKey, _, _ := newRSAKey(t)
+	jwks := &testJWKS{keys: map[string]*rsa.PublicKey{"old": &oldKey.PublicKey}}
+	server := httptest.NewServer(jwks)
+	defer server.Close()
+
+	verifier, err := newJWTVerifier(config.JWTConfig{JWKSURL: server.URL, Issuer: testIssuer, Audience: testAudience})
+	if err != nil {
+		t.Fatalf("newJWTVerifier: %v", err)
+	}
+	now := time.Now()
+	// Tokens stay valid past the refresh interval, so only the key set decides each step
+	token := func(kid string, key *rsa.PrivateKey) string {
+		header := map[string]interface{}{"alg": "RS256"}
+		if kid != "" {
+			header["kid"] = kid
+		}
+		return signJWT(t, header, testClaims(now, map[string]interface{}{"exp": now.Add(2 * defaultJWKSRefresh).Unix()}), key)
+	}
+
+	steps := []struct {
+		name    string
+		rotate  bool // The provider replaces the old key with the new one before this step
+		at      time.Time
+		token   string
+		wantErr string
+		fetches int // Fetches of the key set after this step
+	}{
+		{"known key", false, now, token("old", oldKey), "", 1},
+		{"no key ID with a single key", false, now, token("", oldKey), "", 1},
+		{"known key signed by another", false, now, token("old", newKey), "invalid token signature", 1},
+		{"unknown key before a refetch is allowed", false, now.Add(jwksMinRefresh / 2), token("unknown", oldKey), "unknown signing key", 1},
+		{"unknown key", false, now.Add(jwksMinRefresh), token("unknown", oldKey), "unknown signing key", 2},
+		{"rotated key before a refetch is allowed", true, now.Add(jwksMinRefresh + time.Second), token("new", newKey), "unknown signing key", 2},
+		{"rotated key", false, now.Add(2 * jwksMinRefresh), token("new", newKey), "", 3},
+		{"retired key", false, now.Add(2*jwksMinRefresh + time.Second), token("old", oldKey), "unknown signing key", 3},
+		{"known key while fresh", false, now.Add(3 * jwksMinRefresh), token("new", newKey), "", 3},
+		{"known key once stale", false, now.Add(2*jwksMinRefresh + defaultJWKSRefresh + time.Second), token("new", newKey), "", 4},
+	}
+	for _, step := range steps {
+		if step.rotate {
+			jwks.serve(map[string]*rsa.PublicKey{"new": &newKey.PublicKey})
+		}
+		_, err := verifier.verify(step.token, step.at)
+		switch {
+		case step.wantErr == "" && err != nil:
+			t.Errorf("%s: rejected: %v", step.name, err)
+		case step.wantErr != "" && (err == nil || !strings.Contains(err.Error(), step.wantErr)):
+			t.Errorf("%s: got error %v, want one containing %q", step.name, err, step.wantErr)
+		}
+		jwks.mu.Lock()
+		fetches := jwks.fetches
+		jwks.mu.Unlock()
+		if fetches != step.fetches {
+			t.Errorf("%s: key set fetched %d times, want %d", step.name, fetches, step.fetches)
+		}
+	}
+}
+
+func TestJWKSVerifierWithoutKeys(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	verifier, err := newJWTVerifier(config.JWTConfig{JWKSURL: server.URL})
+	if err != nil {
+		t.Fatalf("newJWTVerifier: %v", err)
+	}
+	key, _, _ := newRSAKey(t)
+	now := time.Now()
+	token := signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "k"}, testClaims(now, nil), key)
+	if _, err := verifier.verify(token, now); err == nil || !strings.Contains(err.Error(), "unavailable") {
+		t.Errorf("verify() with an unreachable key set = %v, want keys unavailable", err)
+	}
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"rag-go-app/config"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bucketIdleTimeout is how long an unused client bucket is kept before it is dropped
+const bucketIdleTimeout = 10 * time.Minute
+
+// rateLimiter keeps a token bucket per client
+type rateLimiter struct {
+	rate  float64 // Tokens added per second
+	burst float64 // Bucket capacity
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing rate requests per second with bursts of up to burst
+// requests, or nil when the rate is not positive
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the client's bucket. When the bucket is empty it reports how long
+// until the next token is available.
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets of clients that have been idle long enough to be full again
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketIdleTimeout {
+		return
+	}
+	l.lastSweep = now
+	for client, bucket := range l.buckets {
+		if now.Sub(bucket.last) > bucketIdleTimeout {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// RateLimitMiddleware rejects requests beyond the client's budget with 429 and a Retry-After header.
+// A nil limiter lets every request through.
+func RateLimitMiddleware(limiter *rateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		allowed, wait := limiter.allow(rateLimitClient(c), time.Now())
+		if !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "rate limit exceeded",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitClient identifies the client by API key when it sent one that was validated, otherwise
+// by IP address. Keys nothing checks can't be trusted: a client sending a new one with each request
+// would get a fresh bucket every time.
+func rateLimitClient(c *gin.Context) string {
+	if key := requestAPIKey(c.Request); key != "" && validatedAPIKey(c, key) {
+		return "key:" + key
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// validatedAPIKey reports whether the API key or bearer token of a request identifies a known
+// caller: one authorization accepted, or a key tenancy maps to a tenant
+func validatedAPIKey(c *gin.Context, key string) bool {
+	if caller := requestIdentity(c); caller != nil && caller.Kind != "" {
+		return true
+	}
+	tenancy := config.AppConfig.Tenancy
+	_, known := tenancy.APIKeys[key]
+	return tenancy.Enabled && known
+}
+
+// ingestQueue caps how many ingestion requests run at once across all clients. Requests beyond
+// the cap wait for a slot in a bounded queue, first come first served.
+type ingestQueue struct {
+	slots    int
+	maxQueue int
+	timeout  time.Duration // Longest wait for a slot
+
+	mu      sync.Mutex
+	running int
+	waiting []chan struct{} // Closed when handed a slot, in arrival order
+	average time.Duration   // Moving average of how long requests hold a slot
+}
+
+// queueFullError refuses a request arriving at a full queue, or one that waited too long
+type queueFullError struct {
+	reason   string
+	position int // Place in the queue the request had, or would have had
+	queued   int // Requests waiting
+}
+
+func (e *queueFullError) Error() string {
+	return e.reason
+}
+
+// newIngestQueue returns a queue running up to slots requests at once, with up to queueSize more
+// waiting for up to timeout, or nil when slots is not positive
+func newIngestQueue(slots, queueSize int, timeout time.Duration) *ingestQueue {
+	if slots <= 0 {
+		return nil
+	}
+	return &ingestQueue{slots: slots, maxQueue: max(queueSize, 0), timeout: timeout}
+}
+
+// acquire takes a slot, waiting in the queue while all are taken. It returns the place in the
+// queue the request had on arrival, 0 when a slot was free, and a *queueFullError when the queue
+// is full or the wait times out. A request whose context ends while waiting gets its error.
+func (q *ingestQueue) acquire(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	if q.running < q.slots {
+		q.running++
+		q.mu.Unlock()
+		return 0, nil
+	}
+	if len(q.waiting) >= q.maxQueue {
+		err := &queueFullError{reason: "ingestion queue is full", position: len(q.waiting) + 1, queued: len(q.waiting)}
+		q.mu.Unlock()
+		return 0, err
+	}
+	ready := make(chan struct{})
+	q.waiting = append(q.waiting, ready)
+	position := len(q.waiting)
+	q.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if q.timeout > 0 {
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ready:
+		return position, nil
+	case <-ctx.Done():
+		if q.leave(ready) < 0 {
+			q.release(0) // Handed a slot as the request gave up
+		}
+		return position, ctx.Err()
+	case <-timeout:
+		place := q.leave(ready)
+		if place < 0 {
+			return position, nil // Handed a slot just in time
+		}
+		return position, &queueFullError{reason: "timed out waiting for an ingestion slot", position: place + 1, queued: q.queued()}
+	}
+}
+
+// leave takes a waiter out of the queue, returning its index, or -1 when it was already handed a slot
+func (q *ingestQueue) leave(ready chan struct{}) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, waiter := range q.waiting {
+		if waiter == ready {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return i
+		}
+	}
+	return -1
+}
+
+// release frees the slot of a request that held it for held, handing it to the first request
+// waiting
+func (q *ingestQueue) release(held time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if held > 0 {
+		if q.average == 0 {
+			q.average = held
+		} else {
+			q.average = (q.average*4 + held) / 5
+		}
+	}
+	if len(q.waiting) > 0 {
+		close(q.waiting[0])
+		q.waiting = q.waiting[1:]
+		return
+	}
+	q.running--
+}
+
+// queued returns the number of requests waiting for a slot
+func (q *ingestQueue) queued() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiting)
+}
+
+// retryAfter estimates when a request at a place in the queue would get a slot, from how long
+// requests have held one; at least a second
+func (q *ingestQueue) retryAfter(position int) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return max(q.average*time.Duration(position)/time.Duration(q.slots), time.Second)
+}
+
+// IngestQueueMiddleware runs at most the queue's number of ingestion requests at once. Others wait
+// for a slot; a request finding the queue full, or waiting longer than its timeout, gets 503 with
+// a Retry-After header and its place in the queue. Requests that waited report their place in the
+// X-Queue-Position header. A nil queue lets every request through.
+func IngestQueueMiddleware(queue *ingestQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if queue == nil {
+			c.Next()
+			return
+		}
+
+		position, err := queue.acquire(c.Request.Context())
+		var full *queueFullError
+		if errors.As(err, &full) {
+			retryAfter := int(math.Ceil(queue.retryAfter(full.position).Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":          full.Error(),
+				"queue_position": full.position,
+				"queued":         full.queued,
+				"retry_after":    retryAfter,
+			})
+			return
+		}
+		if err != nil {
+			// The client went away while waiting
+			c.Abort()
+			return
+		}
+
+		start := time.Now()
+		defer func() { queue.release(time.Since(start)) }()
+		if position > 0 {
+			c.Header("X-Queue-Position", strconv.Itoa(position))
+		}
+		c.Next()
+	}
+}
+
+// MaxBodySizeMiddleware rejects bodies larger than limit bytes with 413. Bodies without a declared
+// length are cut off at the limit, which makes binding them fail. A limit of 0 disables the check.
+func MaxBodySizeMiddleware(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("request body exceeds the limit of %d bytes", limit),
+			})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"rag-go-app/config"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitedRouter serves a route allowing one request per client, behind the tenant middleware
+func limitedRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/limited", AuthorizationMiddleware(), TenantMiddleware(), RateLimitMiddleware(newRateLimiter(0.001, 1)),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+// getWithKey sends a request from one address with an API key and returns the status
+func getWithKey(r *gin.Engine, key string) int {
+	req := httptest.NewRequest("GET", "/limited", nil)
+	req.RemoteAddr = "203.0.113.7:40000"
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRateLimitIgnoresUnvalidatedKeys(t *testing.T) {
+	saved := config.AppConfig.Tenancy
+	t.Cleanup(func() { config.AppConfig.Tenancy = saved })
+	config.AppConfig.Tenancy = config.TenancyConfig{}
+
+	// Without authorization or tenancy keys, nothing checks the key, so the address is limited
+	r := limitedRouter()
+	if code := getWithKey(r, "random-1"); code != http.StatusOK {
+		t.Fatalf("first request: status %d, want 200", code)
+	}
+	for i := 2; i <= 3; i++ {
+		if code := getWithKey(r, fmt.Sprintf("random-%d", i)); code != http.StatusTooManyRequests {
+			t.Errorf("request with fresh key %d: status %d, want 429", i, code)
+		}
+	}
+}
+
+func TestRateLimitByValidatedKey(t *testing.T) {
+	saved := config.AppConfig.Tenancy
+	t.Cleanup(func() { config.AppConfig.Tenancy = saved })
+	config.AppConfig.Tenancy = config.TenancyConfig{
+		Enabled: true,
+		APIKeys: map[string]string{"key-acme": "acme", "key-globex": "globex"},
+	}
+
+	// Keys tenancy knows get buckets of their own, even from one address
+	r := limitedRouter()
+	for _, key := range []string{"key-acme", "key-globex"} {
+		if code := getWithKey(r, key); code != http.StatusOK {
+			t.Errorf("first request with %s: status %d, want 200", key, code)
+		}
+	}
+	if code := getWithKey(r, "key-acme"); code != http.StatusTooManyRequests {
+		t.Errorf("second request with key-acme: status %d, want 429", code)
+	}
+	// Unknown keys are refused before they reach the limiter
+	if code := getWithKey(r, "made-up"); code != http.StatusUnauthorized {
+		t.Errorf("request with an unknown key: status %d, want 401", code)
+	}
+}
@@ -0,0 +1,513 @@
+package api
+
+import (
+	"net/http"
+	"rag-go-app/core"
+	"rag-go-app/models"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeDoc describes one route for the generated OpenAPI document.
+// Request and Response are zero values of the Go types bound or returned by the handler.
+type routeDoc struct {
+	Summary     string
+	Tag         string
+	Request     interface{}
+	Response    interface{}
+	QueryParams []queryParamDoc
+	RawBody     string // Content type of a non-JSON request body
+}
+
+type queryParamDoc struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// routeDocs documents every route registered in SetupRoutes, keyed by "METHOD path"
+var routeDocs = map[string]routeDoc{
+	"GET /health":  {Summary: "Health check with dependency status", Tag: "Health"},
+	"GET /healthz": {Summary: "Liveness probe", Tag: "Health"},
+	"GET /readyz":  {Summary: "Readiness probe (warm-up, database and model server)", Tag: "Health"},
+
+	"POST /api/v1/collections":         {Summary: "Create collection", Tag: "Collections", Request: models.CreateCollectionRequest{}},
+	"GET /api/v1/collections/:name":    {Summary: "Get collection statistics", Tag: "Collections"},
+	"DELETE /api/v1/collections/:name": {Summary: "Delete collection", Tag: "Collections"},
+	"GET /api/v1/collections": {
+		Summary: "List collections",
+		Tag:     "Collections",
+		QueryParams: append(listQueryParams("created_at, name, doc_count or chunk_count"),
+			queryParamDoc{Name: "name", Type: "string", Description: "Case-insensitive substring of the collection name"},
+		),
+	},
+	"POST /api/v1/collections/:name/topics":  {Summary: "Cluster a collection into labeled topics", Tag: "Collections", Request: models.TopicsRequest{}, Response: models.TopicsResponse{}},
+	"POST /api/v1/collections/:name/reembed": {Summary: "Re-embed collection with a new model", Tag: "Collections", Request: models.ReembedRequest{}, Response: core.ReembedStatus{}},
+	"GET /api/v1/collections/:name/reembed":  {Summary: "Re-embedding progress", Tag: "Collections", Response: core.ReembedStatus{}},
+
+	"POST /api/v1/documents":        {Summary: "Add document", Tag: "Documents", Request: models.AddDocumentRequest{}},
+	"POST /api/v1/documents/import": {Summary: "Import pre-embedded documents", Tag: "Documents", Request: models.ImportEmbeddingsRequest{}},
+	"POST /api/v1/documents/batch":  {Summary: "Add documents in bulk (JSON or NDJSON)", Tag: "Documents", Request: models.BatchIngestRequest{}},
+	"POST /api/v1/collections/:name/import": {
+		Summary: "Import a LangChain or LlamaIndex export",
+		Tag:     "Documents",
+		RawBody: "application/json",
+		QueryParams: []queryParamDoc{
+			{Name: "format", Type: "string", Description: "langchain (Document JSONL or array) or llamaindex (node array or docstore)"},
+			{Name: "ignore_embeddings", Type: "boolean", Description: "Embed every chunk with the configured model instead of storing the export's embeddings"},
+		},
+	},
+	"POST /api/v1/documents/preview": {
+		Summary:  "Preview how a document would be parsed and chunked, without ingesting it",
+		Tag:      "Documents",
+		Request:  models.AddDocumentRequest{},
+		Response: models.DocumentPreview{},
+	},
+	"GET /api/v1/collections/:name/documents": {
+		Summary: "List documents in collection",
+		Tag:     "Documents",
+		QueryParams: append(listQueryParams("created_at, source, doc_type or chunk_count"),
+			queryParamDoc{Name: "doc_type", Type: "string", Description: "Only documents of this type"},
+			queryParamDoc{Name: "source", Type: "string", Description: "Case-insensitive substring of the document source"},
+		),
+	},
+	"GET /api/v1/collections/:name/duplicates": {
+		Summary:  "Report duplicate and near-duplicate documents",
+		Tag:      "Documents",
+		Response: models.DuplicatesReport{},
+		QueryParams: []queryParamDoc{
+			{Name: "threshold", Type: "number", Description: "Cosine similarity of document embeddings above which documents are near-duplicates; defaults to 0.95"},
+		},
+	},
+	"POST /api/v1/collections/:name/duplicates/resolve": {
+		Summary:  "Delete duplicates of a kept document",
+		Tag:      "Documents",
+		Request:  models.ResolveDuplicatesRequest{},
+		Response: models.ResolveDuplicatesResponse{},
+	},
+	"POST /api/v1/collections/:name/sync":        {Summary: "Sync collection with a manifest of content hashes", Tag: "Documents", Request: models.SyncRequest{}},
+	"POST /api/v1/collections/:name/sources/s3":  {Summary: "Sync collection with the objects of an S3 bucket", Tag: "Documents", Request: models.S3SourceRequest{}},
+	"POST /api/v1/collections/:name/sources/web": {Summary: "Crawl a website into a collection", Tag: "Documents", Request: models.CrawlRequest{}},
+	"GET /api/v1/documents/:id":                  {Summary: "Get a document with its content and chunk outline", Tag: "Documents", Response: models.DocumentDetails{}},
+	"GET /api/v1/documents/:id/chunks":           {Summary: "List the chunks of a document", Tag: "Documents"},
+	"DELETE /api/v1/documents/:id":               {Summary: "Delete specific document", Tag: "Documents"},
+	"DELETE /api/v1/collections/:name/documents": {
+		Summary: "Delete all documents in collection",
+		Tag:     "Documents",
+		QueryParams: []queryParamDoc{
+			{Name: "confirm", Type: "boolean", Description: "Must be true to confirm the deletion"},
+		},
+	},
+
+	"PATCH /api/v1/chunks/:id": {Summary: "Correct chunk text and re-embed", Tag: "Chunks", Request: models.UpdateChunkRequest{}},
+	"GET /api/v1/chunks/:id/similar": {
+		Summary:  "Chunks of the collection most similar to a chunk",
+		Tag:      "Chunks",
+		Response: models.SimilarChunksResponse{},
+		QueryParams: []queryParamDoc{
+			{Name: "top_k", Type: "integer", Description: "Chunks to return, 1-50; defaults to 5"},
+			{Name: "exclude_same_document", Type: "boolean", Description: "Only return chunks of other documents"},
+		},
+	},
+
+	"POST /api/v1/query":            {Summary: "Query documents with LLM answer generation", Tag: "Query", Request: models.QueryRequest{}, Response: models.QueryResponse{}},
+	"POST /api/v1/search":           {Summary: "Search documents without LLM generation", Tag: "Query", Request: models.QueryRequest{}},
+	"POST /api/v1/search/documents": {Summary: "Find documents similar to a query or document", Tag: "Query", Request: models.DocumentSearchRequest{}, Response: models.DocumentSearchResponse{}},
+	"POST /api/v1/analyze":          {Summary: "Analyze document with metadata", Tag: "Query", Request: models.AnalyzeRequest{}},
+	"POST /api/v1/compare-chunking": {Summary: "Compare chunking strategies", Tag: "Chunking", Request: models.CompareChunkingRequest{}},
+	"POST /api/v1/evaluate":         {Summary: "Evaluate retrieval and answers over a parameter grid", Tag: "Evaluation", Request: models.EvaluateRequest{}},
+
+	"GET /api/v1/analytics/queries": {
+		Summary:  "Query analytics: top, zero-result and unanswered queries, latency, most retrieved documents",
+		Tag:      "Analytics",
+		Response: core.QueryAnalytics{},
+		QueryParams: []queryParamDoc{
+			{Name: "collection_name", Type: "string", Description: "Only queries of this collection"},
+			{Name: "created_after", Type: "string", Description: "Only queries asked at or after this time (RFC 3339 or YYYY-MM-DD)"},
+			{Name: "created_before", Type: "string", Description: "Only queries asked before this time (RFC 3339 or YYYY-MM-DD)"},
+			{Name: "limit", Type: "integer", Description: "Entries per ranking, 1-100; defaults to 10"},
+		},
+	},
+
+	"POST /v1/chat/completions": {Summary: "OpenAI-compatible chat completions with retrieved context", Tag: "Query", Request: models.ChatProxyRequest{}, Response: models.ChatCompletionResponse{}},
+	"POST /v1/embeddings":       {Summary: "OpenAI-compatible embeddings through the embedding cache", Tag: "Query", Request: models.OpenAIEmbeddingsRequest{}, Response: models.OpenAIEmbeddingsResponse{}},
+
+	"GET /ws/chat": {Summary: "Chat session over a WebSocket, with answers streamed as generated, retrieval status events and cancellation", Tag: "Query"},
+
+	"GET /api/v1/system/info": {
+		Summary:  "Configured models, probed embedding dimension, backend reachability and database information",
+		Tag:      "Analytics",
+		Response: core.SystemInfo{},
+	},
+
+	"GET /api/v1/usage": {
+		Summary:  "Documents, characters and chunks stored against the quotas",
+		Tag:      "Analytics",
+		Response: core.UsageReport{},
+		QueryParams: []queryParamDoc{
+			{Name: "collection_name", Type: "string", Description: "Only list this collection"},
+		},
+	},
+
+	"GET /api/v1/admin/replication":           {Summary: "Replication status", Tag: "Administration", Response: core.ReplicationStatus{}},
+	"POST /api/v1/admin/replication/sync":     {Summary: "Replicate a snapshot now", Tag: "Administration"},
+	"POST /api/v1/admin/replication/snapshot": {Summary: "Receive a snapshot (follower)", Tag: "Administration", RawBody: "application/octet-stream"},
+	"GET /api/v1/admin/backup":                {Summary: "List backups", Tag: "Administration", Response: core.BackupStatus{}},
+	"POST /api/v1/admin/backup":               {Summary: "Back up the database now", Tag: "Administration"},
+	"POST /api/v1/admin/restore":              {Summary: "Restore a backup", Tag: "Administration", Request: models.RestoreRequest{}, Response: core.RestoreResult{}},
+	"GET /api/v1/admin/maintenance":           {Summary: "Maintenance schedule and last run", Tag: "Administration", Response: core.MaintenanceStatus{}},
+	"POST /api/v1/admin/maintenance":          {Summary: "Run database maintenance now", Tag: "Administration", Request: models.MaintenanceRequest{}},
+	"GET /api/v1/admin/read-only":             {Summary: "Whether the server refuses changes", Tag: "Administration", Response: core.ReadOnlyStatus{}},
+	"PUT /api/v1/admin/read-only":             {Summary: "Switch read-only mode on or off", Tag: "Administration", Request: models.ReadOnlyRequest{}},
+	"GET /api/v1/admin/crawler":               {Summary: "Scheduled website crawls", Tag: "Administration"},
+	"GET /api/v1/admin/webhooks":              {Summary: "Webhook delivery status", Tag: "Administration", Response: core.WebhookStatus{}},
+	"GET /api/v1/admin/embeddings":            {Summary: "Embedding cache and model server metrics", Tag: "Administration", Response: core.EmbeddingMetrics{}},
+	"GET /api/v1/admin/encryption":            {Summary: "Encryption mode and keys in use", Tag: "Administration", Response: core.EncryptionStatus{}},
+	"POST /api/v1/admin/encryption/rotate":    {Summary: "Re-encrypt stored text with the current key", Tag: "Administration"},
+	"GET /api/v1/admin/roles":                 {Summary: "List role assignments", Tag: "Administration"},
+	"PUT /api/v1/admin/roles":                 {Summary: "Assign a role to an API key, user or claim", Tag: "Administration", Request: models.RoleAssignmentRequest{}},
+	"DELETE /api/v1/admin/roles":              {Summary: "Revoke a role assignment", Tag: "Administration", Request: models.RoleAssignmentRequest{}},
+	"POST /api/v1/admin/fsck": {
+		Summary:     "Check the database for orphaned and inconsistent rows",
+		Tag:         "Administration",
+		Response:    core.FsckReport{},
+		QueryParams: []queryParamDoc{{Name: "repair", Type: "boolean", Description: "Repair what the checks find"}},
+	},
+	"GET /api/v1/admin/audit": {
+		Summary:     "Audit log of creates, updates and deletes",
+		Tag:         "Administration",
+		QueryParams: append(listQueryParams("created_at or action"), auditFilterParams...),
+	},
+	"GET /api/v1/admin/debug/pprof/*profile": {
+		Summary: "Runtime profile (heap, allocs, goroutine, profile, trace...) or, at the root, the list of them",
+		Tag:     "Administration",
+		QueryParams: []queryParamDoc{
+			{Name: "seconds", Type: "integer", Description: "Duration of a CPU profile or trace, or of a delta heap or allocs profile"},
+			{Name: "debug", Type: "integer", Description: "1 or 2 for a text profile instead of the protobuf format"},
+			{Name: "gc", Type: "integer", Description: "1 to collect garbage before a heap profile"},
+		},
+	},
+	"GET /api/v1/admin/debug/vars": {Summary: "Memory statistics and other runtime variables (expvar)", Tag: "Administration"},
+	"GET /api/v1/admin/audit/export": {
+		Summary: "Export the audit log as NDJSON or CSV",
+		Tag:     "Administration",
+		QueryParams: append(append(listQueryParams("created_at or action"), auditFilterParams...),
+			queryParamDoc{Name: "format", Type: "string", Description: "ndjson or csv; defaults to ndjson"},
+		),
+	},
+}
+
+// auditFilterParams documents the filters of the audit log endpoints
+var auditFilterParams = []queryParamDoc{
+	{Name: "tenant", Type: "string", Description: "Only entries of this tenant"},
+	{Name: "actor", Type: "string", Description: "Only entries of this actor: sha256:<hash> of an API key, a JWT user, or expiry or crawler"},
+	{Name: "action", Type: "string", Description: "Only entries of this action, e.g. document.delete"},
+	{Name: "collection", Type: "string", Description: "Only entries of this collection"},
+}
+
+// listQueryParams documents the paging and sorting parameters shared by the list endpoints
+func listQueryParams(sortKeys string) []queryParamDoc {
+	return []queryParamDoc{
+		{Name: "limit", Type: "integer", Description: "Page size, 1-1000; omitted returns every match"},
+		{Name: "offset", Type: "integer", Description: "Number of matches to skip"},
+		{Name: "sort_by", Type: "string", Description: "One of " + sortKeys + "; defaults to created_at"},
+		{Name: "order", Type: "string", Description: "asc or desc; defaults to desc for created_at and counts, asc otherwise"},
+		{Name: "created_after", Type: "string", Description: "Only entries created at or after this time (RFC 3339 or YYYY-MM-DD)"},
+		{Name: "created_before", Type: "string", Description: "Only entries created before this time (RFC 3339 or YYYY-MM-DD)"},
+	}
+}
+
+// enumValues lists the allowed values of string types that the schema generator cannot discover
+var enumValues = map[reflect.Type][]string{
+	reflect.TypeOf(models.ChunkingStrategy("")): {
+		string(models.FixedSizeStrategy),
+		string(models.SemanticStrategy),
+		string(models.StructuralStrategy),
+		string(models.SentenceWindowStrategy),
+		string(models.ParentDocumentStrategy),
+	},
+	reflect.TypeOf(models.ExpansionBackend("")): {
+		string(models.StaticExpansion),
+		string(models.LLMExpansion),
+	},
+	reflect.TypeOf(models.AbstractionLevel("")): {
+		string(models.AllLevels),
+		string(models.DetailLevel),
+		string(models.SummaryLevels),
+	},
+	reflect.TypeOf(models.HighlightBackend("")): {
+		string(models.EmbeddingHighlights),
+		string(models.LLMHighlights),
+	},
+	reflect.TypeOf(models.RetrieverName("")): {
+		string(models.VectorRetriever),
+		string(models.KeywordRetriever),
+		string(models.MetadataRetriever),
+	},
+	reflect.TypeOf(models.FusionMethod("")): {
+		string(models.RRFFusion),
+		string(models.WeightedFusion),
+	},
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPISpec map[string]interface{}
+)
+
+// OpenAPIHandler serves the OpenAPI 3.0 document generated from the router's registered routes
+func OpenAPIHandler(r *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		openAPIOnce.Do(func() {
+			openAPISpec = buildOpenAPISpec(r.Routes())
+		})
+		c.JSON(http.StatusOK, openAPISpec)
+	}
+}
+
+// SwaggerUIHandler serves a Swagger UI page that renders /openapi.json
+func SwaggerUIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8" />
+  <title>RAG Go Application API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css" />
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>`
+
+var ginPathParamPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// isTenantScoped reports whether a route runs behind TenantMiddleware
+func isTenantScoped(path string) bool {
+	return strings.HasPrefix(path, "/api/v1/") && !strings.HasPrefix(path, "/api/v1/admin/")
+}
+
+// buildOpenAPISpec converts the registered routes into an OpenAPI 3.0 document
+func buildOpenAPISpec(routes gin.RoutesInfo) map[string]interface{} {
+	gen := &schemaGenerator{components: map[string]interface{}{}}
+	paths := map[string]map[string]interface{}{}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	for _, route := range routes {
+		// The documentation endpoints and the admin dashboard do not document themselves
+		if route.Path == "/openapi.json" || route.Path == "/docs" || strings.HasPrefix(route.Path, "/admin/") {
+			continue
+		}
+
+		doc, ok := routeDocs[route.Method+" "+route.Path]
+		if !ok {
+			doc = routeDoc{Summary: route.Method + " " + route.Path}
+		}
+
+		operation := map[string]interface{}{
+			"summary":     doc.Summary,
+			"operationId": operationID(route.Method, route.Path),
+		}
+		if doc.Tag != "" {
+			operation["tags"] = []string{doc.Tag}
+		}
+
+		var parameters []interface{}
+		for _, match := range ginPathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, param := range doc.QueryParams {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        param.Name,
+				"in":          "query",
+				"description": param.Description,
+				"schema":      map[string]interface{}{"type": param.Type},
+			})
+		}
+		if isTenantScoped(route.Path) {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        TenantHeader,
+				"in":          "header",
+				"description": "Tenant to act as when multi-tenancy is enabled and no API key is configured",
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if doc.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": gen.schemaFor(reflect.TypeOf(doc.Request)),
+					},
+				},
+			}
+		} else if doc.RawBody != "" {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					doc.RawBody: map[string]interface{}{
+						"schema": map[string]interface{}{"type": "string", "format": "binary"},
+					},
+				},
+			}
+		}
+
+		responseSchema := map[string]interface{}{"type": "object"}
+		if doc.Response != nil {
+			responseSchema = gen.schemaFor(reflect.TypeOf(doc.Response))
+		}
+		operation["responses"] = map[string]interface{}{
+			"2XX": map[string]interface{}{
+				"description": "Success",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": responseSchema},
+				},
+			},
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}},
+				},
+			},
+		}
+
+		openAPIPath := ginPathParamPattern.ReplaceAllString(route.Path, "{$1}")
+		if paths[openAPIPath] == nil {
+			paths[openAPIPath] = map[string]interface{}{}
+		}
+		paths[openAPIPath][strings.ToLower(route.Method)] = operation
+	}
+
+	gen.components["Error"] = map[string]interface{}{
+		"type":       "object",
+		"required":   []string{"error"},
+		"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "RAG Go Application API",
+			"description": "Advanced Document Search & Analysis Server",
+			"version":     "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": gen.components},
+	}
+}
+
+// operationID derives a stable identifier such as "post_api_v1_collections_name_documents"
+func operationID(method, path string) string {
+	cleaned := strings.NewReplacer("/", "_", ":", "", "*", "", "-", "_").Replace(path)
+	return strings.ToLower(method) + strings.TrimRight(cleaned, "_")
+}
+
+// schemaGenerator builds JSON schemas from Go types, registering named structs as reusable components
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) schemaFor(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		return g.schemaFor(t.Elem())
+	}
+
+	if values, ok := enumValues[t]; ok {
+		return map[string]interface{}{"type": "string", "enum": values}
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, exists := g.components[t.Name()]; !exists {
+			// Reserve the name first so self-referencing types terminate
+			g.components[t.Name()] = map[string]interface{}{}
+			g.components[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	return map[string]interface{}{}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = g.schemaFor(field.Type)
+		// Only an unconditional rule on the field itself, not required_without or one after dive
+		if strings.Split(field.Tag.Get("binding"), ",")[0] == "required" {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"rag-go-app/config"
+	"rag-go-app/core"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} { return runtime.NumGoroutine() }))
+}
+
+// PprofHandler serves the runtime profiles of net/http/pprof: the index at the root of the route,
+// and a profile such as heap, allocs, goroutine or profile (CPU) below it
+func PprofHandler(c *gin.Context) {
+	servePprof(c.Writer, c.Request, strings.TrimPrefix(c.Param("profile"), "/"))
+}
+
+// ExpvarHandler serves the published variables of expvar, among them the runtime's memstats
+func ExpvarHandler(c *gin.Context) {
+	expvar.Handler().ServeHTTP(c.Writer, c.Request)
+}
+
+// servePprof serves one profile by name, or the index of them when name is empty
+func servePprof(w http.ResponseWriter, r *http.Request, name string) {
+	switch name {
+	case "":
+		pprof.Index(w, r)
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
+
+// checkProfilingAccess refuses to serve profiles under /api/v1/admin/debug unless only admins
+// can reach them: without authorization, or with anonymous callers made admins, anyone could read
+// the server's memory and command line and slow it down with CPU profiles
+func checkProfilingAccess(profiling config.ProfilingConfig, authorization config.AuthorizationConfig) error {
+	if !profiling.Enabled {
+		return nil
+	}
+	if !authorization.Enabled {
+		return errors.New("profiling.enabled needs authorization.enabled, so only admins reach the profiles; " +
+			"use profiling.listen_address on a loopback address to profile without it")
+	}
+	if authorization.AnonymousRole == core.RoleAdmin {
+		return errors.New("profiling.enabled would serve the profiles to anonymous callers, whose role is admin")
+	}
+	return nil
+}
+
+// startProfilingServer serves the profiles and variables at the paths the Go tools expect,
+// /debug/pprof/ and /debug/vars, on a listener of their own. Nothing there is authenticated, so
+// the listener must be on a loopback address, reachable only from the host.
+func startProfilingServer(address string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	if tcp, ok := listener.Addr().(*net.TCPAddr); !ok || !tcp.IP.IsLoopback() {
+		listener.Close()
+		return nil, fmt.Errorf("%s is not a loopback address; the profiling listener is unauthenticated, so it only listens on one such as 127.0.0.1:6060", address)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", func(w http.ResponseWriter, r *http.Request) {
+		servePprof(w, r, strings.TrimPrefix(r.URL.Path, "/debug/pprof/"))
+	})
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	// No write timeout: CPU profiles and traces stream for as many seconds as asked
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Profiling server stopped: %v", err)
+		}
+	}()
+	log.Printf("Profiling endpoints listening on %s", listener.Addr())
+	return server, nil
+}
+
+// stopProfilingServer closes the profiling listener, abandoning profiles still being taken
+func stopProfilingServer(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"rag-go-app/config"
+	"rag-go-app/core"
+	"testing"
+)
+
+func TestCheckProfilingAccess(t *testing.T) {
+	tests := []struct {
+		name          string
+		profiling     config.ProfilingConfig
+		authorization config.AuthorizationConfig
+		wantErr       bool
+	}{
+		{"disabled", config.ProfilingConfig{}, config.AuthorizationConfig{}, false},
+		{"listener only", config.ProfilingConfig{ListenAddress: "127.0.0.1:6060"}, config.AuthorizationConfig{}, false},
+		{"without authorization", config.ProfilingConfig{Enabled: true}, config.AuthorizationConfig{}, true},
+		{"anonymous admins", config.ProfilingConfig{Enabled: true}, config.AuthorizationConfig{Enabled: true, AnonymousRole: core.RoleAdmin}, true},
+		{"anonymous readers", config.ProfilingConfig{Enabled: true}, config.AuthorizationConfig{Enabled: true, AnonymousRole: core.RoleReader}, false},
+	}
+	for _, tt := range tests {
+		err := checkProfilingAccess(tt.profiling, tt.authorization)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkProfilingAccess() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestProfilingServerListensOnLoopbackOnly(t *testing.T) {
+	for _, address := range []string{":0", "0.0.0.0:0"} {
+		if server, err := startProfilingServer(address); err == nil {
+			stopProfilingServer(server)
+			t.Errorf("startProfilingServer(%q) listened on a non-loopback address", address)
+		}
+	}
+
+	server, err := startProfilingServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("startProfilingServer(127.0.0.1:0): %v", err)
+	}
+	stopProfilingServer(server)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"rag-go-app/core"
+	"rag-go-app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOnlyAllowedRoutes are the audited routes still served in read-only mode: they copy the
+// database without changing it, receive a primary's snapshot into the standby file, or switch
+// read-only mode itself
+var readOnlyAllowedRoutes = map[string]bool{
+	"POST /api/v1/admin/replication/sync":     true,
+	"POST /api/v1/admin/replication/snapshot": true,
+	"POST /api/v1/admin/backup":               true,
+	"PUT /api/v1/admin/read-only":             true,
+}
+
+// ReadOnlyMiddleware refuses, while the server is read-only, every request to a route that
+// creates, updates or deletes something, as listed in auditedRoutes, except those in
+// readOnlyAllowedRoutes. A consistency check is allowed unless it asks for repairs.
+func ReadOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		if _, changes := auditedRoutes[route]; !changes || readOnlyAllowedRoutes[route] {
+			c.Next()
+			return
+		}
+		if route == "POST /api/v1/admin/fsck" && c.Query("repair") != "true" {
+			c.Next()
+			return
+		}
+		if status := core.GetReadOnlyStatus(); status.ReadOnly {
+			body := gin.H{"error": "The server is in read-only mode"}
+			if status.Reason != "" {
+				body["reason"] = status.Reason
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, body)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ReadOnlyStatusHandler reports whether the server refuses changes
+func ReadOnlyStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, core.GetReadOnlyStatus())
+}
+
+// SetReadOnlyHandler switches read-only mode on or off until the server restarts
+func SetReadOnlyHandler(c *gin.Context) {
+	var req models.ReadOnlyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := core.SetReadOnly(*req.ReadOnly, req.Reason)
+	message := "Read-only mode disabled"
+	if status.ReadOnly {
+		message = "Read-only mode enabled"
+	}
+	if req.Reason != "" {
+		log.Printf("%s at runtime: %s", message, req.Reason)
+	} else {
+		log.Printf("%s at runtime", message)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    message,
+		"read_only":  status.ReadOnly,
+		"reason":     status.Reason,
+		"changed_at": status.ChangedAt,
+	})
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"rag-go-app/core"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadOnlyMiddleware(t *testing.T) {
+	t.Cleanup(func() { core.ConfigureReadOnly(false) })
+	core.SetReadOnly(true, "maintenance window")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ReadOnlyMiddleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/api/v1/admin/maintenance", ok)
+	r.POST("/api/v1/admin/backup", ok)
+	r.POST("/api/v1/admin/fsck", ok)
+	r.POST("/api/v1/search", ok)
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/api/v1/admin/maintenance", http.StatusForbidden},
+		{"/api/v1/admin/fsck?repair=true", http.StatusForbidden},
+		{"/api/v1/admin/fsck", http.StatusOK},
+		{"/api/v1/admin/backup", http.StatusOK},
+		{"/api/v1/search", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", tt.target, nil))
+		if w.Code != tt.want {
+			t.Errorf("POST %s while read-only: status %d, want %d", tt.target, w.Code, tt.want)
+		}
+	}
+}
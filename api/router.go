@@ -1,6 +1,10 @@
 package api
 
 import (
+	"rag-go-app/config"
+	"rag-go-app/core"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	// Import your handlers package if it were separate, e.g.:
 	// "rag-go-app/api/handlers"
@@ -16,32 +20,163 @@ func SetupRoutes() *gin.Engine {
 	// config.AllowOrigins = []string{"http://localhost:3000"} // Adjust for your Electron app's origin
 	// r.Use(cors.New(config))
 
+	// With mutual TLS, everything but the probes needs a verified client certificate
+	r.Use(ClientCertMiddleware(config.AppConfig.TLS))
+
 	// Health check
 	r.GET("/health", HealthHandler)
+	r.GET("/healthz", LivenessHandler)
+	r.GET("/readyz", ReadinessHandler)
+
+	// API documentation
+	r.GET("/openapi.json", OpenAPIHandler(r))
+	r.GET("/docs", SwaggerUIHandler)
+
+	// Admin dashboard for browsing and cleaning up what is indexed; it calls the routes below
+	r.StaticFS("/admin", adminFS())
 
-	// API v1 routes
-	v1 := r.Group("/api/v1")
+	// Queries and ingestion are rate limited separately so bulk loads can't starve interactive requests,
+	// and ingestion from all clients together queues for a fixed number of slots
+	limits := config.AppConfig.Limits
+	var queryLimiter, ingestLimiter *rateLimiter
+	if limits.RateLimitEnabled {
+		queryLimiter = newRateLimiter(limits.RequestsPerSecond, limits.Burst)
+		ingestLimiter = newRateLimiter(limits.IngestRequestsPerSecond, limits.IngestBurst)
+	}
+	ingestSlots := newIngestQueue(limits.MaxConcurrentIngestions, limits.IngestQueueSize,
+		time.Duration(limits.IngestQueueTimeoutSeconds)*time.Second)
+
+	// With authorization enabled, every route checks the caller's role: readers query, writers
+	// ingest and change documents, admins delete collections and administer the server
+	reader, writer, admin := RequireRole(core.RoleReader), RequireRole(core.RoleWriter), RequireRole(core.RoleAdmin)
+
+	// API v1 routes; each is traced when tracing is enabled, and changes are audited before
+	// authentication, so refused attempts are recorded too. In read-only mode changes are refused
+	// after authentication.
+	v1 := r.Group("/api/v1", TracingMiddleware(), AuditMiddleware(), AuthorizationMiddleware(), ReadOnlyMiddleware())
 	{
+		// Tenant-scoped routes; the tenant comes from the API key or X-Tenant-ID header
+		tenant := v1.Group("", TenantMiddleware())
+
+		interactive := tenant.Group("", RateLimitMiddleware(queryLimiter), MaxBodySizeMiddleware(limits.MaxBodyBytes))
+		ingest := tenant.Group("", RateLimitMiddleware(ingestLimiter), MaxBodySizeMiddleware(limits.MaxBodyBytes), IngestQueueMiddleware(ingestSlots))
+		bulkImport := tenant.Group("", RateLimitMiddleware(ingestLimiter), MaxBodySizeMiddleware(limits.MaxImportBodyBytes), IngestQueueMiddleware(ingestSlots))
+
 		// Collection management
-		v1.POST("/collections", CreateCollectionHandler)
-		v1.GET("/collections", ListCollectionsHandler)
-		v1.GET("/collections/:name", GetCollectionStatsHandler)
-		v1.DELETE("/collections/:name", DeleteCollectionHandler)
+		interactive.POST("/collections", writer, CreateCollectionHandler)
+		interactive.GET("/collections", reader, ListCollectionsHandler)
+		interactive.GET("/collections/:name", reader, GetCollectionStatsHandler)
+		interactive.DELETE("/collections/:name", admin, DeleteCollectionHandler)
+		ingest.POST("/collections/:name/reembed", writer, ReembedCollectionHandler)
+		interactive.GET("/collections/:name/reembed", reader, ReembedStatusHandler)
 
 		// Document management
-		v1.POST("/documents", AddDocumentHandler)
-		v1.GET("/collections/:name/documents", ListDocumentsHandler)
-		v1.DELETE("/documents/:id", DeleteDocumentHandler)
-		v1.DELETE("/collections/:name/documents", DeleteAllDocumentsHandler)
+		ingest.POST("/documents", writer, AddDocumentHandler)
+		ingest.POST("/documents/preview", writer, PreviewDocumentHandler)
+		bulkImport.POST("/documents/import", writer, ImportDocumentsHandler)
+		bulkImport.POST("/documents/batch", writer, BatchIngestHandler)
+		bulkImport.POST("/collections/:name/import", writer, ImportFrameworkExportHandler)
+		interactive.GET("/collections/:name/documents", reader, ListDocumentsHandler)
+		ingest.POST("/collections/:name/sync", writer, SyncCollectionHandler)
+		ingest.POST("/collections/:name/sources/s3", writer, SyncS3SourceHandler)
+		ingest.POST("/collections/:name/sources/web", writer, CrawlWebsiteHandler)
+		interactive.GET("/documents/:id", reader, GetDocumentHandler)
+		interactive.GET("/documents/:id/chunks", reader, DocumentChunksHandler)
+		interactive.DELETE("/documents/:id", writer, DeleteDocumentHandler)
+		interactive.DELETE("/collections/:name/documents", admin, DeleteAllDocumentsHandler)
+
+		// Chunk management
+		interactive.PATCH("/chunks/:id", writer, UpdateChunkHandler)
+		interactive.GET("/chunks/:id/similar", reader, SimilarChunksHandler)
 
 		// Query endpoints
-		v1.POST("/query", QueryHandler)   // Full RAG with LLM generation
-		v1.POST("/search", SearchHandler) // Search-only without LLM
-		v1.POST("/analyze", AnalyzeDocumentHandler)
+		interactive.POST("/query", reader, QueryHandler)   // Full RAG with LLM generation
+		interactive.POST("/search", reader, SearchHandler) // Search-only without LLM
+		interactive.POST("/search/documents", reader, SearchDocumentsHandler)
+		interactive.POST("/analyze", reader, AnalyzeDocumentHandler)
 
 		// Chunking strategy comparison
-		v1.POST("/compare-chunking", CompareChunkingHandler)
+		interactive.POST("/compare-chunking", reader, CompareChunkingHandler)
+
+		// Topic discovery clusters a collection's embeddings and asks the chat model to name every
+		// cluster, so it shares the ingestion budget
+		ingest.POST("/collections/:name/topics", reader, DiscoverTopicsHandler)
+
+		// Duplicate reports compare every document of a collection with the others
+		ingest.GET("/collections/:name/duplicates", reader, DuplicatesReportHandler)
+		interactive.POST("/collections/:name/duplicates/resolve", writer, ResolveDuplicatesHandler)
+
+		// Evaluation re-chunks collections and runs many queries, so it shares the ingestion budget
+		ingest.POST("/evaluate", writer, EvaluateHandler)
+
+		// Query analytics
+		interactive.GET("/analytics/queries", reader, QueryAnalyticsHandler)
+
+		// Storage used against the quotas
+		interactive.GET("/usage", reader, UsageHandler)
+
+		// Models, embedding dimension, backends and database, for clients checking their setup
+		interactive.GET("/system/info", reader, SystemInfoHandler)
+
+		// Replication (whole database, not tenant-scoped); snapshots are whole database files, so
+		// they have their own size limit
+		v1.GET("/admin/replication", admin, ReplicationStatusHandler)
+		v1.POST("/admin/replication/sync", admin, MaxBodySizeMiddleware(limits.MaxBodyBytes), ReplicationSyncHandler)
+		v1.POST("/admin/replication/snapshot", admin, MaxBodySizeMiddleware(config.AppConfig.Replication.MaxSnapshotBytes), ReceiveSnapshotHandler)
+
+		// Backups (whole database, not tenant-scoped)
+		v1.GET("/admin/backup", admin, BackupStatusHandler)
+		v1.POST("/admin/backup", admin, MaxBodySizeMiddleware(limits.MaxBodyBytes), BackupHandler)
+		v1.POST("/admin/restore", admin, MaxBodySizeMiddleware(limits.MaxBodyBytes), RestoreHandler)
+
+		// Database maintenance (whole database, not tenant-scoped)
+		v1.GET("/admin/maintenance", admin, MaintenanceStatusHandler)
+		v1.POST("/admin/maintenance", admin, MaintenanceHandler)
+		v1.POST("/admin/fsck", admin, FsckHandler)
+
+		// Read-only mode, for disaster recovery replicas and maintenance windows (whole server)
+		v1.GET("/admin/read-only", admin, ReadOnlyStatusHandler)
+		v1.PUT("/admin/read-only", admin, SetReadOnlyHandler)
+
+		// Scheduled website crawls (every tenant's)
+		v1.GET("/admin/crawler", admin, CrawlerStatusHandler)
+
+		// Webhook deliveries (every tenant's)
+		v1.GET("/admin/webhooks", admin, WebhookStatusHandler)
+
+		// Embedding cache and model server traffic (every tenant's)
+		v1.GET("/admin/embeddings", admin, EmbeddingMetricsHandler)
+
+		// Encryption at rest (whole database, not tenant-scoped)
+		v1.GET("/admin/encryption", admin, EncryptionStatusHandler)
+		v1.POST("/admin/encryption/rotate", admin, KeyRotationHandler)
+
+		// Role assignments (every tenant's)
+		v1.GET("/admin/roles", admin, ListRolesHandler)
+		v1.PUT("/admin/roles", admin, AssignRoleHandler)
+		v1.DELETE("/admin/roles", admin, RevokeRoleHandler)
+
+		// Audit log of every change (every tenant's)
+		v1.GET("/admin/audit", admin, AuditLogHandler)
+		v1.GET("/admin/audit/export", admin, AuditExportHandler)
+
+		// Runtime profiles and memory statistics, if enabled (whole process)
+		if config.AppConfig.Profiling.Enabled {
+			v1.GET("/admin/debug/pprof/*profile", admin, PprofHandler)
+			v1.GET("/admin/debug/vars", admin, ExpvarHandler)
+		}
 	}
 
+	// OpenAI-compatible chat completions with retrieved context and embeddings, at the paths OpenAI
+	// SDKs expect under a base URL of http://host:port/v1. They share the query rate limit.
+	openAI := r.Group("/v1", AuthorizationMiddleware(), TenantMiddleware(), RateLimitMiddleware(queryLimiter), MaxBodySizeMiddleware(limits.MaxBodyBytes))
+	openAI.POST("/chat/completions", reader, ChatCompletionsHandler)
+	openAI.POST("/embeddings", reader, EmbeddingsHandler)
+
+	// Interactive chat sessions over a WebSocket, with answers streamed as they are generated and
+	// cancellable while they are. Each question counts against the query rate limit.
+	ws := r.Group("/ws", AuthorizationMiddleware(), TenantMiddleware())
+	ws.GET("/chat", reader, ChatSessionHandler(queryLimiter))
+
 	return r
 }
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"rag-go-app/config"
+	"rag-go-app/core"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantHeader selects the tenant of a request when no API key is configured
+const TenantHeader = "X-Tenant-ID"
+
+// tenantContextKey stores the resolved tenant in the gin context
+const tenantContextKey = "tenant"
+
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// tenantError carries the HTTP status for a request whose tenant could not be resolved
+type tenantError struct {
+	status int
+	err    error
+}
+
+// TenantMiddleware resolves the tenant of each request and rejects requests that can't be mapped to one
+func TenantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, tErr := resolveTenant(c.Request, requestIdentity(c))
+		if tErr != nil {
+			c.AbortWithStatusJSON(tErr.status, gin.H{"error": tErr.err.Error()})
+			return
+		}
+		c.Set(tenantContextKey, tenant)
+		c.Next()
+	}
+}
+
+// resolveTenant maps a request to a tenant: from the tenant claim of a JWT caller, from its API
+// key when keys are configured, otherwise from the X-Tenant-ID header, falling back to the
+// default tenant
+func resolveTenant(r *http.Request, caller *identity) (string, *tenantError) {
+	cfg := config.AppConfig.Tenancy
+	if !cfg.Enabled {
+		return core.DefaultTenant, nil
+	}
+
+	header := strings.TrimSpace(r.Header.Get(TenantHeader))
+
+	jwtCaller := caller != nil && caller.Kind == core.RoleSubjectUser
+	if jwtCaller && caller.Tenant != "" {
+		if !tenantIDPattern.MatchString(caller.Tenant) {
+			return "", &tenantError{http.StatusForbidden, errors.New("invalid tenant claim in bearer token")}
+		}
+		if header != "" && header != caller.Tenant {
+			return "", &tenantError{http.StatusForbidden, fmt.Errorf("bearer token is not valid for tenant '%s'", header)}
+		}
+		return caller.Tenant, nil
+	}
+	if jwtCaller && len(cfg.APIKeys) > 0 {
+		// Tenants are bound to credentials, so the header alone can't choose one
+		return "", &tenantError{http.StatusForbidden, errors.New("bearer token has no tenant claim")}
+	}
+
+	if len(cfg.APIKeys) > 0 {
+		key := requestAPIKey(r)
+		if key == "" {
+			return "", &tenantError{http.StatusUnauthorized, errors.New("API key required")}
+		}
+		tenant, ok := cfg.APIKeys[key]
+		if !ok {
+			return "", &tenantError{http.StatusUnauthorized, errors.New("invalid API key")}
+		}
+		if header != "" && header != tenant {
+			return "", &tenantError{http.StatusForbidden, fmt.Errorf("API key is not valid for tenant '%s'", header)}
+		}
+		return tenant, nil
+	}
+
+	if header == "" {
+		if cfg.RequireTenant {
+			return "", &tenantError{http.StatusBadRequest, fmt.Errorf("%s header is required", TenantHeader)}
+		}
+		return core.DefaultTenant, nil
+	}
+
+	if !tenantIDPattern.MatchString(header) {
+		return "", &tenantError{http.StatusBadRequest, fmt.Errorf("invalid %s header", TenantHeader)}
+	}
+	return header, nil
+}
+
+// requestAPIKey reads the key from "Authorization: Bearer <key>" or the X-API-Key header
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// tenantDB returns the database scoped to the tenant of the request
+func tenantDB(c *gin.Context) *core.VectorDB {
+	return vectorDB.ForTenant(c.GetString(tenantContextKey))
+}
+
+// tenantRAG returns the RAG service scoped to the tenant of the request
+func tenantRAG(c *gin.Context) *core.RAGService {
+	return ragService.ForTenant(c.GetString(tenantContextKey))
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"rag-go-app/config"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	clientAuthRequire       = "require"
+	clientAuthVerifyIfGiven = "verify_if_given"
+)
+
+// TLSEnabled reports whether the server is configured to serve HTTPS
+func TLSEnabled(cfg config.TLSConfig) bool {
+	return cfg.CertFile != "" && cfg.KeyFile != ""
+}
+
+// ServerTLSConfig builds the TLS settings of the server from the configuration. The certificate is
+// loaded now, so a missing or mismatched file fails startup, and again whenever one of its files
+// changes. Client certificates are verified during the handshake when presented; whether one is
+// required is left to ClientCertMiddleware, so the probes can be reached without one.
+func ServerTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("tls needs both cert_file and key_file")
+	}
+	certs := &certificateReloader{certFile: cfg.CertFile, keyFile: cfg.KeyFile}
+	if _, err := certs.certificate(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certs.certificate()
+		},
+	}
+	switch cfg.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported tls min_version %q (use \"1.2\" or \"1.3\")", cfg.MinVersion)
+	}
+
+	switch cfg.ClientAuth {
+	case "", clientAuthRequire, clientAuthVerifyIfGiven:
+	default:
+		return nil, fmt.Errorf("unsupported tls client_auth %q (use %q or %q)", cfg.ClientAuth, clientAuthRequire, clientAuthVerifyIfGiven)
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in client CA file %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// ClientCertMiddleware rejects requests that did not present a client certificate verified
+// against the client CAs, when mutual TLS is configured with client_auth "require". The liveness
+// and readiness probes are let through without one.
+func ClientCertMiddleware(cfg config.TLSConfig) gin.HandlerFunc {
+	required := TLSEnabled(cfg) && cfg.ClientCAFile != "" && cfg.ClientAuth != clientAuthVerifyIfGiven
+	return func(c *gin.Context) {
+		if !required || c.Request.URL.Path == "/healthz" || c.Request.URL.Path == "/readyz" {
+			c.Next()
+			return
+		}
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "A client certificate signed by a trusted CA is required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// certificateReloader serves the certificate in a pair of files, reading them again when either
+// has changed since it was loaded
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+// certificate returns the current certificate. While a changed pair fails to load, e.g. because
+// only one of the files was replaced yet, the previous certificate keeps being served.
+func (r *certificateReloader) certificate() (*tls.Certificate, error) {
+	certInfo, certErr := os.Stat(r.certFile)
+	keyInfo, keyErr := os.Stat(r.keyFile)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cert != nil && (certErr != nil || keyErr != nil ||
+		(certInfo.ModTime().Equal(r.certTime) && keyInfo.ModTime().Equal(r.keyTime))) {
+		return r.cert, nil
+	}
+	if certErr != nil {
+		return nil, fmt.Errorf("failed to read TLS certificate: %w", certErr)
+	}
+	if keyErr != nil {
+		return nil, fmt.Errorf("failed to read TLS key: %w", keyErr)
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil // Files are mid-replacement; keep serving the previous pair
+		}
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	r.cert = &cert
+	r.certTime = certInfo.ModTime()
+	r.keyTime = keyInfo.ModTime()
+	return r.cert, nil
+}
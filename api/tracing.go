@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"rag-go-app/core"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TraceIDHeader returns the ID of a traced request's trace, to look it up in the collector
+const TraceIDHeader = "X-Trace-ID"
+
+// TracingMiddleware records a server span for each request, named after its route, under which
+// the spans of the query pipeline nest. A W3C traceparent header continues the caller's trace.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := core.ContextWithTraceParent(c.Request.Context(), c.GetHeader("traceparent"))
+		route := c.FullPath()
+		ctx, span := core.StartSpan(ctx, c.Request.Method+" "+route, core.SpanKindServer)
+		if span == nil {
+			c.Next()
+			return
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(TraceIDHeader, span.TraceID())
+		span.SetAttribute("http.request.method", c.Request.Method)
+		span.SetAttribute("http.route", route)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.response.status_code", status)
+		if tenant := c.GetString(tenantContextKey); tenant != "" {
+			span.SetAttribute("rag.tenant", tenant)
+		}
+		var err error
+		if status >= http.StatusInternalServerError {
+			err = errors.New(http.StatusText(status))
+			if last := c.Errors.Last(); last != nil {
+				err = last.Err
+			}
+		}
+		span.End(err)
+	}
+}
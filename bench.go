@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"rag-go-app/config"
+	"rag-go-app/core"
+	"syscall"
+	"time"
+)
+
+// runBenchCommand runs the bench subcommand with its arguments and returns the exit code
+func runBenchCommand(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	dbPath := flags.String("db", "", "Database holding the synthetic collections; defaults to a temporary one removed afterwards")
+	tenant := flags.String("tenant", core.DefaultTenant, "Tenant owning the synthetic collections")
+	mock := flags.Bool("mock", false, "Answer embedding and chat requests with a built-in mock model server instead of the configured one")
+	mockLatency := flags.Duration("mock-latency", 0, "Delay of each response of the mock model server, e.g. 20ms")
+	jsonOutput := flags.Bool("json", false, "Print the report as JSON")
+	opts := core.BenchOptions{}
+	flags.IntVar(&opts.Collections, "collections", 1, "Synthetic collections to create")
+	flags.IntVar(&opts.Documents, "documents", 1000, "Documents per collection")
+	flags.IntVar(&opts.DocumentWords, "words", 300, "Words per document")
+	flags.IntVar(&opts.Queries, "queries", 500, "Queries to run")
+	flags.IntVar(&opts.Concurrency, "concurrency", 8, "Queries in flight at a time")
+	flags.IntVar(&opts.TopK, "top-k", 5, "Chunks retrieved per query")
+	flags.BoolVar(&opts.Generate, "generate", false, "Generate an answer for each query instead of only retrieving chunks")
+	flags.BoolVar(&opts.ANNIndex, "ann", false, "Search through in-memory ANN indexes of the synthetic collections")
+	flags.Int64Var(&opts.Seed, "seed", 1, "Seed of the synthetic documents and queries")
+	flags.Usage = func() {
+		log.Printf("Usage: %s bench [options]\n", os.Args[0])
+		log.Println("\nFills synthetic collections, runs a concurrent query workload against them and")
+		log.Println("reports the latency of retrieval and generation and the throughput.")
+		log.Println("\nOptions:")
+		flags.PrintDefaults()
+		log.Println("\nExamples:")
+		log.Printf("  %s bench -mock -documents=10000 -concurrency=16\n", os.Args[0])
+		log.Printf("  %s bench -generate -queries=200 -json > before.json\n", os.Args[0])
+	}
+	flags.Parse(args)
+
+	config.LoadConfig(*configPath)
+	if *mock {
+		server, err := core.StartBenchModelServer(*mockLatency)
+		if err != nil {
+			log.Printf("Failed to start mock model server: %v", err)
+			return 1
+		}
+		defer server.Stop()
+		config.AppConfig.Provider = core.ProviderOpenAI
+		config.AppConfig.LlamaCPPBaseURL = server.URL
+		config.AppConfig.LlamaCPPFailoverURLs = nil
+		log.Printf("Mock model server listening at %s", server.URL)
+	}
+
+	report, err := runBench(*dbPath, *tenant, opts)
+	if err != nil {
+		log.Printf("Benchmark failed: %v", err)
+		return 1
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		printBenchReport(report)
+	}
+	return 0
+}
+
+// runBench runs a benchmark against the database at dbPath, or a temporary one when it is empty.
+// The embedding cache is left out, so every query is embedded and runs are comparable.
+func runBench(dbPath, tenant string, opts core.BenchOptions) (*core.BenchReport, error) {
+	if _, err := core.CurrentProvider(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if dbPath == "" {
+		dir, err := os.MkdirTemp("", "rag-bench-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		dbPath = filepath.Join(dir, "bench.db")
+	}
+
+	vectorDB, err := core.NewVectorDB(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize vector database: %w", err)
+	}
+	defer vectorDB.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ragService := core.NewRAGService(vectorDB, core.NewEmbeddingService(), core.NewLLMService()).ForTenant(tenant)
+	return ragService.Benchmark(ctx, opts)
+}
+
+// printBenchReport prints a report as a table
+func printBenchReport(report *core.BenchReport) {
+	opts := report.Options
+	fmt.Printf("Collections: %d x %d documents of %d words (seed %d)\n", opts.Collections, opts.Documents, opts.DocumentWords, opts.Seed)
+	if report.Ingestion.Documents > 0 {
+		fmt.Printf("Ingestion:   %d documents, %d chunks in %v (%.1f documents/s)\n", report.Ingestion.Documents, report.Ingestion.Chunks,
+			time.Duration(report.Ingestion.DurationMS)*time.Millisecond, report.Ingestion.DocumentsPerSecond)
+	} else {
+		fmt.Println("Ingestion:   reused the existing collections")
+	}
+	fmt.Printf("Queries:     %d succeeded, %d failed in %v, %d at a time, top %d, ANN index %v\n", report.Queries, report.Failed,
+		time.Duration(report.DurationMS)*time.Millisecond, opts.Concurrency, opts.TopK, opts.ANNIndex)
+	fmt.Printf("Throughput:  %.1f queries/s\n", report.Throughput)
+	if report.FirstError != "" {
+		fmt.Printf("First error: %s\n", report.FirstError)
+	}
+	fmt.Println()
+	fmt.Printf("%-12s %10s %10s %10s %10s %10s\n", "Stage (ms)", "p50", "p95", "p99", "mean", "max")
+	row := func(name string, l core.BenchLatency) {
+		fmt.Printf("%-12s %10.2f %10.2f %10.2f %10.2f %10.2f\n", name, l.P50, l.P95, l.P99, l.Mean, l.Max)
+	}
+	row("retrieval", report.Retrieval)
+	if report.Generation != nil {
+		row("generation", *report.Generation)
+	}
+	row("total", report.Total)
+}
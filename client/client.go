@@ -0,0 +1,290 @@
+// Package client is a typed Go client for the RAG server's REST API.
+//
+//	c := client.New("http://localhost:8080", client.WithAPIKey(key))
+//	resp, err := c.Search(ctx, &client.QueryRequest{CollectionName: "docs", Query: "pricing"})
+//
+// Every method takes a context, which bounds the request including its retries. Reads are retried
+// on connection errors, 429 and 5xx responses, writes only on 429 and 503, with exponential backoff
+// honouring Retry-After. Failed requests return an *APIError with the status and the server's
+// message. ChatCompletionStream reads an answer as the chat model generates it.
+//
+// The package is a module of its own that only uses the standard library, so it can be imported
+// without building the server:
+//
+//	go get github.com/aruntemme/go-rag/client
+//
+// Runnable programs are in client/examples.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout    = 180 * time.Second // Matches the server's own backend timeout
+	defaultMaxRetries = 3
+	defaultRetryWait  = 500 * time.Millisecond
+	maxRetryWait      = 10 * time.Second
+)
+
+// Client calls the RAG server's /api/v1 endpoints
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+	retryWait  time.Duration
+	headers    http.Header
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithTLSConfig sets the TLS settings of the HTTP client, e.g. a client certificate for a server
+// requiring mutual TLS or the CA that issued its certificate. Pass it after WithHTTPClient.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *Client) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		c.httpClient.Transport = transport
+	}
+}
+
+// WithRetries sets how many times a failed request is retried and the initial backoff.
+// The backoff doubles after each attempt. Pass 0 retries to disable retrying.
+func WithRetries(maxRetries int, initialWait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryWait = initialWait
+	}
+}
+
+// WithHeader adds a header to every request, e.g. an Authorization token
+func WithHeader(key, value string) Option {
+	return func(c *Client) { c.headers.Add(key, value) }
+}
+
+// WithTenant sends every request as the given tenant via the X-Tenant-ID header
+func WithTenant(tenant string) Option {
+	return WithHeader("X-Tenant-ID", tenant)
+}
+
+// WithAPIKey authenticates every request with a bearer API key, which also selects the tenant
+func WithAPIKey(key string) Option {
+	return WithHeader("Authorization", "Bearer "+key)
+}
+
+// New returns a client for the server at baseURL, e.g. "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		maxRetries: defaultMaxRetries,
+		retryWait:  defaultRetryWait,
+		headers:    http.Header{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// APIError is returned when the server responds with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string // The "error" field of the response body
+	Body       []byte
+	RetryAfter time.Duration // From the Retry-After header, set on 429 and 503 responses
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("rag api: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+	}
+	return fmt.Sprintf("rag api: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// IsNotFound reports whether err is an APIError with status 404
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// bodyFunc produces a fresh request body for every attempt so retries can resend it
+type bodyFunc func() (io.Reader, string, error)
+
+// jsonBody encodes v once and replays the bytes on every attempt
+func jsonBody(v interface{}) bodyFunc {
+	payload, err := json.Marshal(v)
+	return func() (io.Reader, string, error) {
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal request: %w", err)
+		}
+		return bytes.NewReader(payload), "application/json", nil
+	}
+}
+
+// rawBody replays data as the body of every attempt
+func rawBody(data []byte, contentType string) bodyFunc {
+	return func() (io.Reader, string, error) {
+		return bytes.NewReader(data), contentType, nil
+	}
+}
+
+// streamingJSONBody encodes v directly into the request body without buffering the whole payload,
+// which keeps memory flat for large imports. It is re-encoded on every attempt.
+func streamingJSONBody(v interface{}) bodyFunc {
+	return func() (io.Reader, string, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(json.NewEncoder(pw).Encode(v))
+		}()
+		return pr, "application/json", nil
+	}
+}
+
+// do sends a request and decodes a JSON response into out (if non-nil), retrying with
+// exponential backoff. Safe requests are retried on connection errors, 429 and 5xx responses;
+// requests that create data are only retried on 429 and 503, where the server did not act on them.
+func (c *Client) do(ctx context.Context, method, path string, body bodyFunc, out interface{}, safe bool) error {
+	return c.retry(ctx, safe, func() (int, error) {
+		return c.attempt(ctx, method, path, body, out)
+	})
+}
+
+// retry calls send until it succeeds, with exponential backoff between attempts, deciding like do
+// which failures are retried. send returns the response status as attempt does.
+func (c *Client) retry(ctx context.Context, safe bool, send func() (int, error)) error {
+	wait := c.retryWait
+	var lastErr error
+
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			// Full jitter keeps concurrent clients from retrying in lockstep
+			sleep := time.Duration(rand.Int63n(int64(wait) + 1))
+
+			// Never retry before the server said it would accept the request
+			var apiErr *APIError
+			if errors.As(lastErr, &apiErr) && apiErr.RetryAfter > sleep {
+				sleep = min(apiErr.RetryAfter, maxRetryWait)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(sleep):
+			}
+			wait *= 2
+			if wait > maxRetryWait {
+				wait = maxRetryWait
+			}
+		}
+
+		status, err := send()
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !isRetryable(status, safe) || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", c.maxRetries+1, lastErr)
+}
+
+// isRetryable decides whether a failed attempt should be retried; status is 0 for transport errors
+func isRetryable(status int, safe bool) bool {
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		return true
+	case status == 0 || status >= 500:
+		return safe
+	}
+	return false
+}
+
+// attempt performs a single HTTP round trip and decodes a JSON response into out (if non-nil). It
+// returns the response status, or 0 if no response was received; status is -1 for failures that
+// happen before sending and must not be retried.
+func (c *Client) attempt(ctx context.Context, method, path string, body bodyFunc, out interface{}) (int, error) {
+	resp, status, err := c.send(ctx, method, path, body, "application/json")
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return -1, fmt.Errorf("failed to decode response from %s: %w", path, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// send performs a single HTTP round trip and returns the response, whose body the caller must
+// close, when its status is 2xx; any other status is returned as an APIError. The status is
+// reported as attempt reports it.
+func (c *Client) send(ctx context.Context, method, path string, body bodyFunc, accept string) (*http.Response, int, error) {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		var err error
+		reader, contentType, err = body()
+		if err != nil {
+			return nil, -1, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range c.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", accept)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("request to %s failed: %w", path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		apiErr := &APIError{StatusCode: resp.StatusCode, Body: respBody}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		var errBody struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &errBody) == nil {
+			apiErr.Message = errBody.Error
+		}
+		return nil, resp.StatusCode, apiErr
+	}
+	return resp, resp.StatusCode, nil
+}
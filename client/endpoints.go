@@ -0,0 +1,728 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const apiPrefix = "/api/v1"
+
+// Health checks that the server is up and reports the state of its dependencies
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	var resp HealthResponse
+	if err := c.do(ctx, http.MethodGet, "/health", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Live checks that the server process answers, as a liveness probe does. It isn't retried.
+func (c *Client) Live(ctx context.Context) error {
+	_, err := c.attempt(ctx, http.MethodGet, "/healthz", nil, nil)
+	return err
+}
+
+// Ready reports whether the server is ready for traffic, as a readiness probe does. A server that
+// isn't ready yet is reported by the status of the response, not as an error. It isn't retried.
+func (c *Client) Ready(ctx context.Context) (*ReadinessResponse, error) {
+	var resp ReadinessResponse
+	_, err := c.attempt(ctx, http.MethodGet, "/readyz", nil, &resp)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable &&
+		json.Unmarshal(apiErr.Body, &resp) == nil && resp.Status != "" {
+		return &resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// OpenAPISpec returns the server's OpenAPI 3 document, to generate clients in other languages
+func (c *Client) OpenAPISpec(ctx context.Context) (json.RawMessage, error) {
+	var spec json.RawMessage
+	if err := c.do(ctx, http.MethodGet, "/openapi.json", nil, &spec, true); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Collection management
+
+// CreateCollection creates a collection; creating an existing collection is a no-op
+func (c *Client) CreateCollection(ctx context.Context, req *CreateCollectionRequest) (*CreateCollectionResponse, error) {
+	var resp CreateCollectionResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/collections", jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListCollections returns a page of collections with document and chunk counts; nil options
+// return every collection
+func (c *Client) ListCollections(ctx context.Context, opts *ListCollectionsRequest) (*ListCollectionsResponse, error) {
+	var resp ListCollectionsResponse
+	query := url.Values{}
+	if opts != nil {
+		query = listValues(opts.ListOptions)
+		setValue(query, "name", opts.Name)
+	}
+	if err := c.do(ctx, http.MethodGet, withQuery(apiPrefix+"/collections", query), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetCollectionStats returns detailed statistics for a collection
+func (c *Client) GetCollectionStats(ctx context.Context, name string) (*CollectionStats, error) {
+	var resp CollectionStats
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/collections/"+url.PathEscape(name), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteCollection deletes a collection and all its documents
+func (c *Client) DeleteCollection(ctx context.Context, name string) (*MessageResponse, error) {
+	var resp MessageResponse
+	if err := c.do(ctx, http.MethodDelete, apiPrefix+"/collections/"+url.PathEscape(name), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Reembed starts re-embedding a collection in the background, e.g. after switching embedding
+// models; nil options use the configured model. Poll ReembedStatus for progress.
+func (c *Client) Reembed(ctx context.Context, name string, req *ReembedRequest) (*ReembedStatus, error) {
+	var resp ReembedStatus
+	if req == nil {
+		req = &ReembedRequest{}
+	}
+	path := apiPrefix + "/collections/" + url.PathEscape(name) + "/reembed"
+	if err := c.do(ctx, http.MethodPost, path, jsonBody(req), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReembedStatus reports the progress of the latest re-embedding of a collection
+func (c *Client) ReembedStatus(ctx context.Context, name string) (*ReembedStatus, error) {
+	var resp ReembedStatus
+	path := apiPrefix + "/collections/" + url.PathEscape(name) + "/reembed"
+	if err := c.do(ctx, http.MethodGet, path, nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Document management
+
+// AddDocument chunks, embeds and stores a document
+func (c *Client) AddDocument(ctx context.Context, req *AddDocumentRequest) (*AddDocumentResponse, error) {
+	var resp AddDocumentResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/documents", jsonBody(req), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PreviewDocument reports how a document would be parsed and chunked, without embedding or storing it
+func (c *Client) PreviewDocument(ctx context.Context, req *AddDocumentRequest) (*DocumentPreview, error) {
+	var resp DocumentPreview
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/documents/preview", jsonBody(req), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AddDocuments adds many documents in one request; their chunks are embedded together and each
+// document gets its own status. The request is streamed to the server as it is encoded.
+func (c *Client) AddDocuments(ctx context.Context, req *BatchIngestRequest) (*BatchIngestResponse, error) {
+	var resp BatchIngestResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/documents/batch", streamingJSONBody(req), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ImportDocuments bulk-loads pre-embedded documents. The request is streamed to the server
+// as it is encoded, so large imports are never held in memory twice.
+func (c *Client) ImportDocuments(ctx context.Context, req *ImportEmbeddingsRequest) (*ImportResponse, error) {
+	var resp ImportResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/documents/import", streamingJSONBody(req), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ImportFrameworkExport imports a corpus exported by a Python RAG framework into a collection:
+// LangChain Documents as JSONL with format "langchain", or LlamaIndex nodes or a persisted docstore
+// with format "llamaindex". Embeddings in the export are stored unless ignoreEmbeddings is set, in
+// which case the server embeds every chunk.
+func (c *Client) ImportFrameworkExport(ctx context.Context, collectionName, format string, export []byte, ignoreEmbeddings bool) (*FrameworkImportResponse, error) {
+	query := url.Values{"format": {format}}
+	if ignoreEmbeddings {
+		query.Set("ignore_embeddings", "true")
+	}
+	path := apiPrefix + "/collections/" + url.PathEscape(collectionName) + "/import"
+	var resp FrameworkImportResponse
+	if err := c.do(ctx, http.MethodPost, withQuery(path, query), rawBody(export, "application/json"), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListDocuments returns a page of documents in a collection; nil options return every document
+func (c *Client) ListDocuments(ctx context.Context, collectionName string, opts *ListDocumentsRequest) (*ListDocumentsResponse, error) {
+	var resp ListDocumentsResponse
+	query := url.Values{}
+	if opts != nil {
+		query = listValues(opts.ListOptions)
+		setValue(query, "doc_type", opts.DocType)
+		setValue(query, "source", opts.Source)
+	}
+	path := apiPrefix + "/collections/" + url.PathEscape(collectionName) + "/documents"
+	if err := c.do(ctx, http.MethodGet, withQuery(path, query), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// listValues encodes the paging parameters shared by the list endpoints, leaving out unset ones
+func listValues(opts ListOptions) url.Values {
+	query := url.Values{}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		query.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	setValue(query, "sort_by", opts.SortBy)
+	setValue(query, "order", opts.Order)
+	setValue(query, "created_after", opts.CreatedAfter)
+	setValue(query, "created_before", opts.CreatedBefore)
+	return query
+}
+
+// setValue sets a query parameter unless value is empty
+func setValue(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+// withQuery appends encoded query parameters to a path
+func withQuery(path string, query url.Values) string {
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
+
+// SyncCollection reconciles a collection with a manifest; entries whose hash matches are skipped,
+// and entries reported as "needs_content" must be sent again with their content
+func (c *Client) SyncCollection(ctx context.Context, collectionName string, req *SyncRequest) (*SyncResponse, error) {
+	var resp SyncResponse
+	path := apiPrefix + "/collections/" + url.PathEscape(collectionName) + "/sync"
+	if err := c.do(ctx, http.MethodPost, path, jsonBody(req), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SyncS3Source ingests the objects under a bucket prefix into a collection. Objects whose ETag
+// is unchanged since the last sync are not downloaded again.
+func (c *Client) SyncS3Source(ctx context.Context, collectionName string, req *S3SourceRequest) (*S3SyncResponse, error) {
+	var resp S3SyncResponse
+	path := apiPrefix + "/collections/" + url.PathEscape(collectionName) + "/sources/s3"
+	if err := c.do(ctx, http.MethodPost, path, jsonBody(req), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CrawlWebsite crawls a website into a collection from its sitemap or a seed page. Pages whose
+// content is unchanged since the last crawl are not embedded again.
+func (c *Client) CrawlWebsite(ctx context.Context, collectionName string, req *CrawlRequest) (*CrawlResponse, error) {
+	var resp CrawlResponse
+	path := apiPrefix + "/collections/" + url.PathEscape(collectionName) + "/sources/web"
+	if err := c.do(ctx, http.MethodPost, path, jsonBody(req), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DiscoverTopics clusters the chunks of a collection into topics labeled by the chat model; a nil
+// request chooses the number of topics from the collection's size
+func (c *Client) DiscoverTopics(ctx context.Context, collectionName string, req *TopicsRequest) (*TopicsResponse, error) {
+	var resp TopicsResponse
+	if req == nil {
+		req = &TopicsRequest{}
+	}
+	path := apiPrefix + "/collections/" + url.PathEscape(collectionName) + "/topics"
+	if err := c.do(ctx, http.MethodPost, path, jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// FindDuplicates reports the groups of duplicate and near-duplicate documents of a collection; a
+// threshold of 0 uses the server's default similarity
+func (c *Client) FindDuplicates(ctx context.Context, collectionName string, threshold float64) (*DuplicatesReport, error) {
+	var resp DuplicatesReport
+	query := url.Values{}
+	if threshold > 0 {
+		query.Set("threshold", strconv.FormatFloat(threshold, 'f', -1, 64))
+	}
+	path := apiPrefix + "/collections/" + url.PathEscape(collectionName) + "/duplicates"
+	if err := c.do(ctx, http.MethodGet, withQuery(path, query), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ResolveDuplicates deletes the duplicates of a kept document, as a duplicate group suggests
+func (c *Client) ResolveDuplicates(ctx context.Context, collectionName string, req *ResolveDuplicatesRequest) (*ResolveDuplicatesResponse, error) {
+	var resp ResolveDuplicatesResponse
+	path := apiPrefix + "/collections/" + url.PathEscape(collectionName) + "/duplicates/resolve"
+	if err := c.do(ctx, http.MethodPost, path, jsonBody(req), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetDocument returns a document with its content, metadata and an outline of its chunks. With
+// includeChunks the chunks themselves are returned too.
+func (c *Client) GetDocument(ctx context.Context, documentID string, includeChunks bool) (*DocumentDetails, error) {
+	var resp DocumentDetails
+	path := apiPrefix + "/documents/" + url.PathEscape(documentID)
+	if includeChunks {
+		path += "?include=chunks"
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DocumentChunks lists the chunks a document was split into, in document order
+func (c *Client) DocumentChunks(ctx context.Context, documentID string) (*DocumentChunksResponse, error) {
+	var resp DocumentChunksResponse
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/documents/"+url.PathEscape(documentID)+"/chunks", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteDocument deletes a document and its chunks
+func (c *Client) DeleteDocument(ctx context.Context, documentID string) (*MessageResponse, error) {
+	var resp MessageResponse
+	if err := c.do(ctx, http.MethodDelete, apiPrefix+"/documents/"+url.PathEscape(documentID), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteAllDocuments deletes every document in a collection; the confirmation is sent automatically
+func (c *Client) DeleteAllDocuments(ctx context.Context, collectionName string) (*MessageResponse, error) {
+	var resp MessageResponse
+	path := apiPrefix + "/collections/" + url.PathEscape(collectionName) + "/documents?confirm=true"
+	if err := c.do(ctx, http.MethodDelete, path, nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Chunk management
+
+// UpdateChunk replaces a chunk's text and re-embeds it, unless the request supplies the embedding
+func (c *Client) UpdateChunk(ctx context.Context, chunkID string, req *UpdateChunkRequest) (*UpdateChunkResponse, error) {
+	var resp UpdateChunkResponse
+	if err := c.do(ctx, http.MethodPatch, apiPrefix+"/chunks/"+url.PathEscape(chunkID), jsonBody(req), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SimilarChunks returns the chunks of a chunk's collection most similar to it; nil options return
+// the default number from any document
+func (c *Client) SimilarChunks(ctx context.Context, chunkID string, opts *SimilarChunksRequest) (*SimilarChunksResponse, error) {
+	var resp SimilarChunksResponse
+	query := url.Values{}
+	if opts != nil {
+		if opts.TopK > 0 {
+			query.Set("top_k", strconv.Itoa(opts.TopK))
+		}
+		if opts.ExcludeSameDocument {
+			query.Set("exclude_same_document", "true")
+		}
+	}
+	path := apiPrefix + "/chunks/" + url.PathEscape(chunkID) + "/similar"
+	if err := c.do(ctx, http.MethodGet, withQuery(path, query), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Query & analysis
+
+// Query retrieves context and generates an answer with the chat model
+func (c *Client) Query(ctx context.Context, req *QueryRequest) (*QueryResponse, error) {
+	var resp QueryResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/query", jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Search retrieves context without calling the chat model
+func (c *Client) Search(ctx context.Context, req *QueryRequest) (*SearchResponse, error) {
+	var resp SearchResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/search", jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SearchDocuments finds whole documents similar to a query, or to another document of the
+// collection when DocumentID is set
+func (c *Client) SearchDocuments(ctx context.Context, req *DocumentSearchRequest) (*DocumentSearchResponse, error) {
+	var resp DocumentSearchResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/search/documents", jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ChatCompletion sends a conversation through the OpenAI-compatible endpoint, which retrieves
+// context for the latest user message before calling the chat model. ChatCompletionStream streams it.
+func (c *Client) ChatCompletion(ctx context.Context, req *ChatProxyRequest) (*ChatCompletionResponse, error) {
+	var resp ChatCompletionResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/chat/completions", jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Embeddings embeds texts through the server's OpenAI-compatible endpoint, which serves repeated
+// texts from its embedding cache. An empty model uses the server's embedding model.
+func (c *Client) Embeddings(ctx context.Context, texts []string, model string) (*EmbeddingsResponse, error) {
+	var resp EmbeddingsResponse
+	req := &EmbeddingsRequest{Input: texts, Model: model}
+	if err := c.do(ctx, http.MethodPost, "/v1/embeddings", jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Analyze runs a query with all enhancements enabled and returns per-chunk analysis
+func (c *Client) Analyze(ctx context.Context, req *AnalyzeRequest) (*AnalyzeResponse, error) {
+	var resp AnalyzeResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/analyze", jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CompareChunking runs several chunking strategies over the same content
+func (c *Client) CompareChunking(ctx context.Context, req *CompareChunkingRequest) (*CompareChunkingResponse, error) {
+	var resp CompareChunkingResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/compare-chunking", jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Evaluate scores retrieval and, optionally, generated answers for a test set over a grid of
+// parameters. Evaluations can run for minutes, so failed requests are not retried.
+func (c *Client) Evaluate(ctx context.Context, req *EvaluateRequest) (*EvaluateResponse, error) {
+	var resp EvaluateResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/evaluate", jsonBody(req), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// QueryAnalytics aggregates the logged queries: top and unanswered queries, average latency and
+// the most retrieved documents; nil options cover every collection and time
+func (c *Client) QueryAnalytics(ctx context.Context, opts *QueryAnalyticsRequest) (*QueryAnalytics, error) {
+	var resp QueryAnalytics
+	query := url.Values{}
+	if opts != nil {
+		setValue(query, "collection_name", opts.CollectionName)
+		setValue(query, "user", opts.User)
+		setValue(query, "created_after", opts.CreatedAfter)
+		setValue(query, "created_before", opts.CreatedBefore)
+		if opts.Limit > 0 {
+			query.Set("limit", strconv.Itoa(opts.Limit))
+		}
+	}
+	if err := c.do(ctx, http.MethodGet, withQuery(apiPrefix+"/analytics/queries", query), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Usage reports the documents, characters and chunks the tenant and its collections store, with
+// the quotas that apply. A non-empty collectionName lists only that collection.
+func (c *Client) Usage(ctx context.Context, collectionName string) (*UsageReport, error) {
+	var resp UsageReport
+	query := url.Values{}
+	setValue(query, "collection_name", collectionName)
+	if err := c.do(ctx, http.MethodGet, withQuery(apiPrefix+"/usage", query), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SystemInfo reports the configured models, the dimension of the embedding model's embeddings,
+// the reachability of the database and model servers, and what the tenant stores
+func (c *Client) SystemInfo(ctx context.Context) (*SystemInfo, error) {
+	var resp SystemInfo
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/system/info", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Administration
+
+// ReplicationStatus reports the state of warm standby replication
+func (c *Client) ReplicationStatus(ctx context.Context) (*ReplicationStatus, error) {
+	var resp ReplicationStatus
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/admin/replication", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SyncReplication ships a snapshot to the standby immediately
+func (c *Client) SyncReplication(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, apiPrefix+"/admin/replication/sync", nil, nil, true)
+}
+
+// SendSnapshot streams a database snapshot to a follower instance. The reader is consumed once,
+// so the request is not retried.
+func (c *Client) SendSnapshot(ctx context.Context, snapshot io.Reader, checksum string) error {
+	body := func() (io.Reader, string, error) {
+		return snapshot, "application/octet-stream", nil
+	}
+	noRetry := *c
+	noRetry.maxRetries = 0
+	noRetry.headers = c.headers.Clone()
+	if checksum != "" {
+		noRetry.headers.Set("X-Snapshot-Checksum", checksum)
+	}
+	return noRetry.do(ctx, http.MethodPost, apiPrefix+"/admin/replication/snapshot", body, nil, false)
+}
+
+// BackupStatus lists the backups on the server, newest first
+func (c *Client) BackupStatus(ctx context.Context) (*BackupStatus, error) {
+	var resp BackupStatus
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/admin/backup", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Backup takes a consistent backup of the database now
+func (c *Client) Backup(ctx context.Context) (*BackupInfo, error) {
+	var resp struct {
+		Backup BackupInfo `json:"backup"`
+	}
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/admin/backup", nil, &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp.Backup, nil
+}
+
+// Restore replaces the database with the named backup. The server backs up the current contents
+// first and reports that backup as SafetyBackup.
+func (c *Client) Restore(ctx context.Context, name string) (*RestoreResponse, error) {
+	var resp RestoreResponse
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/admin/restore", jsonBody(&RestoreRequest{Name: name}), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// MaintenanceStatus reports the maintenance schedule and the outcome of the last run
+func (c *Client) MaintenanceStatus(ctx context.Context) (*MaintenanceStatus, error) {
+	var resp MaintenanceStatus
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/admin/maintenance", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RunMaintenance prunes orphaned rows, rebuilds the indexes and vacuums the database now. steps
+// picks some of "prune_orphans", "rebuild_fts", "vacuum", "analyze" and "rebuild_ann"; none runs
+// them all.
+func (c *Client) RunMaintenance(ctx context.Context, steps ...string) (*MaintenanceReport, error) {
+	var resp struct {
+		Report MaintenanceReport `json:"report"`
+	}
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/admin/maintenance", jsonBody(&MaintenanceRequest{Steps: steps}), &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp.Report, nil
+}
+
+// Fsck checks the database for chunks without documents, embeddings and full-text entries
+// without chunks, dangling parent and duplicate chunk IDs and wrong chunk counts. With repair the
+// server fixes what it finds.
+func (c *Client) Fsck(ctx context.Context, repair bool) (*FsckReport, error) {
+	query := url.Values{}
+	if repair {
+		query.Set("repair", "true")
+	}
+	var resp FsckReport
+	if err := c.do(ctx, http.MethodPost, withQuery(apiPrefix+"/admin/fsck", query), nil, &resp, !repair); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReadOnlyStatus reports whether the server refuses changes
+func (c *Client) ReadOnlyStatus(ctx context.Context) (*ReadOnlyStatus, error) {
+	var resp ReadOnlyStatus
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/admin/read-only", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SetReadOnly switches read-only mode on or off until the server restarts. While it is on, the
+// server answers requests that would change what it stores with 403. reason may be empty.
+func (c *Client) SetReadOnly(ctx context.Context, readOnly bool, reason string) (*ReadOnlyStatus, error) {
+	var resp ReadOnlyStatus
+	req := &ReadOnlyRequest{ReadOnly: &readOnly, Reason: reason}
+	if err := c.do(ctx, http.MethodPut, apiPrefix+"/admin/read-only", jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CrawlerStatus reports the websites crawled on a schedule and the outcome of their last crawl
+func (c *Client) CrawlerStatus(ctx context.Context) (*CrawlerStatus, error) {
+	var resp CrawlerStatus
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/admin/crawler", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// EmbeddingMetrics reports the server's embedding cache hits, model server batches and /v1/embeddings traffic
+func (c *Client) EmbeddingMetrics(ctx context.Context) (*EmbeddingMetrics, error) {
+	var resp EmbeddingMetrics
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/admin/embeddings", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// EncryptionStatus reports the server's encryption mode and how many documents and chunks are
+// sealed with each key
+func (c *Client) EncryptionStatus(ctx context.Context) (*EncryptionStatus, error) {
+	var resp EncryptionStatus
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/admin/encryption", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RotateKeys starts re-encrypting the stored text not sealed with the server's current key. Poll
+// EncryptionStatus for its progress.
+func (c *Client) RotateKeys(ctx context.Context) (*KeyRotation, error) {
+	var resp struct {
+		Rotation KeyRotation `json:"rotation"`
+	}
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/admin/encryption/rotate", nil, &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp.Rotation, nil
+}
+
+// ListRoles lists the roles assigned to API keys, JWT users and JWT claim values through the API
+func (c *Client) ListRoles(ctx context.Context) (*RoleAssignments, error) {
+	var resp RoleAssignments
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/admin/roles", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AssignRole grants a role to the API key, user or claim value named in the request, replacing
+// the role it had
+func (c *Client) AssignRole(ctx context.Context, req *RoleAssignmentRequest) (*MessageResponse, error) {
+	var resp MessageResponse
+	if err := c.do(ctx, http.MethodPut, apiPrefix+"/admin/roles", jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RevokeRole removes the role assigned to the API key, user or claim value named in the request
+func (c *Client) RevokeRole(ctx context.Context, req *RoleAssignmentRequest) (*MessageResponse, error) {
+	var resp MessageResponse
+	if err := c.do(ctx, http.MethodDelete, apiPrefix+"/admin/roles", jsonBody(req), &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AuditLog returns a page of the audit log, newest first unless opts says otherwise
+func (c *Client) AuditLog(ctx context.Context, opts *AuditLogRequest) (*AuditLogResponse, error) {
+	var resp AuditLogResponse
+	if err := c.do(ctx, http.MethodGet, withQuery(apiPrefix+"/admin/audit", auditValues(opts)), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExportAuditLog streams the audit log, oldest first unless opts says otherwise, as NDJSON or, with
+// opts.Format "csv", as CSV. The caller must close the returned body.
+func (c *Client) ExportAuditLog(ctx context.Context, opts *AuditLogRequest) (io.ReadCloser, error) {
+	path := withQuery(apiPrefix+"/admin/audit/export", auditValues(opts))
+	var export io.ReadCloser
+	err := c.retry(ctx, true, func() (int, error) {
+		resp, status, err := c.send(ctx, http.MethodGet, path, nil, "*/*")
+		if err != nil {
+			return status, err
+		}
+		export = resp.Body
+		return status, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// auditValues encodes the filters of an audit log request as query parameters
+func auditValues(opts *AuditLogRequest) url.Values {
+	if opts == nil {
+		return url.Values{}
+	}
+	query := listValues(opts.ListOptions)
+	setValue(query, "tenant", opts.Tenant)
+	setValue(query, "actor", opts.Actor)
+	setValue(query, "action", opts.Action)
+	setValue(query, "collection", opts.Collection)
+	setValue(query, "format", opts.Format)
+	return query
+}
+
+// WebhookStatus reports the deliveries to each configured webhook endpoint
+func (c *Client) WebhookStatus(ctx context.Context) (*WebhookStatus, error) {
+	var resp WebhookStatus
+	if err := c.do(ctx, http.MethodGet, apiPrefix+"/admin/webhooks", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
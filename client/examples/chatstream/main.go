@@ -0,0 +1,63 @@
+// Command chatstream asks a question through the OpenAI-compatible chat endpoint and prints the
+// answer as the chat model generates it. The server must use the openai provider.
+//
+//	cd client && go run ./examples/chatstream -server http://localhost:8080 -collection quickstart "What happens on day one?"
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/aruntemme/go-rag/client"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "Base URL of the RAG server")
+	collection := flag.String("collection", "quickstart", "Collection to retrieve context from")
+	flag.Parse()
+	question := strings.Join(flag.Args(), " ")
+	if question == "" {
+		log.Fatal("Usage: chatstream [flags] question")
+	}
+
+	// Ctrl-C stops the stream
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var opts []client.Option
+	if key := os.Getenv("RAG_API_KEY"); key != "" {
+		opts = append(opts, client.WithAPIKey(key))
+	}
+	c := client.New(*server, opts...)
+
+	stream, err := c.ChatCompletionStream(ctx, &client.ChatProxyRequest{
+		Messages: []client.ChatCompletionMessage{{Role: "user", Content: question}},
+		RAG:      &client.QueryRequest{CollectionName: *collection},
+	})
+	if err != nil {
+		log.Fatalf("Failed to start chat completion: %v", err)
+	}
+	defer stream.Close()
+	log.Printf("Answering from %d retrieved chunks", stream.RetrievedChunks)
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Stream failed: %v", err)
+		}
+		for _, choice := range chunk.Choices {
+			fmt.Print(choice.Delta.Content)
+		}
+	}
+	fmt.Println()
+}
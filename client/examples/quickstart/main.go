@@ -0,0 +1,55 @@
+// Command quickstart creates a collection, adds a document and asks a question about it with the
+// Go client.
+//
+//	cd client && go run ./examples/quickstart -server http://localhost:8080
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aruntemme/go-rag/client"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "Base URL of the RAG server")
+	collection := flag.String("collection", "quickstart", "Collection to create and query")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	var opts []client.Option
+	if key := os.Getenv("RAG_API_KEY"); key != "" {
+		opts = append(opts, client.WithAPIKey(key))
+	}
+	c := client.New(*server, opts...)
+
+	if _, err := c.CreateCollection(ctx, &client.CreateCollectionRequest{Name: *collection}); err != nil {
+		log.Fatalf("Failed to create collection: %v", err)
+	}
+
+	added, err := c.AddDocument(ctx, &client.AddDocumentRequest{
+		CollectionName: *collection,
+		Source:         "onboarding.md",
+		Content: "# Onboarding\n\nNew engineers get a laptop on their first day and pair with a buddy " +
+			"for their first two weeks. Production access is granted after the security training.",
+	})
+	if err != nil {
+		log.Fatalf("Failed to add document: %v", err)
+	}
+	fmt.Printf("Document %s %s, %d chunks embedded\n", added.DocumentID, added.Status, added.ChunksEmbedded)
+
+	resp, err := c.Query(ctx, &client.QueryRequest{CollectionName: *collection, Query: "When do new engineers get production access?"})
+	if err != nil {
+		if client.IsNotFound(err) {
+			log.Fatalf("Collection %s does not exist", *collection)
+		}
+		log.Fatalf("Query failed: %v", err)
+	}
+	fmt.Println(resp.Answer)
+}
@@ -0,0 +1,3 @@
+module github.com/aruntemme/go-rag/client
+
+go 1.23.0
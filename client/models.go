@@ -0,0 +1,923 @@
+package client
+
+import "time"
+
+// The request and response types below are the server's, from its models package. They are copied
+// rather than imported, so the client builds without the server and its cgo dependencies;
+// models_test.go checks they still have the server's JSON fields.
+
+// Document represents a text document to be processed.
+type Document struct {
+	ID        string                 `json:"id"`
+	Content   string                 `json:"content"`
+	Chunks    []*EnhancedChunk       `json:"-"`                  // Enhanced chunks with metadata
+	Source    string                 `json:"source,omitempty"`   // e.g., filename
+	Metadata  map[string]interface{} `json:"metadata,omitempty"` // Document-level metadata
+	DocType   string                 `json:"doc_type,omitempty"` // e.g., "resume", "bible", "article"
+	CreatedAt time.Time              `json:"created_at"`
+
+	ContentHash string       `json:"content_hash,omitempty"` // SHA-256 of the raw source, used to skip unchanged re-ingests
+	ACL         *DocumentACL `json:"acl,omitempty"`          // Who may retrieve the document; nil means everyone
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty"`   // When the document is deleted; nil means never
+}
+
+// DocumentDetails is a stored document with an outline of its chunks, for rendering the source
+// of an answer.
+type DocumentDetails struct {
+	Document
+	CollectionName   string           `json:"collection_name"`
+	ChunkingStrategy string           `json:"chunking_strategy,omitempty"`
+	ChunkCount       int              `json:"chunk_count"`
+	ChunkSummaries   []ChunkSummary   `json:"chunk_summaries"`  // In document order
+	Chunks           []*EnhancedChunk `json:"chunks,omitempty"` // In document order, only when requested with include=chunks
+}
+
+// ChunkSummary outlines a chunk of a document: where it lies in the content and how it starts.
+type ChunkSummary struct {
+	ID            string  `json:"id"`
+	ChunkIndex    int     `json:"chunk_index"`
+	ChunkType     string  `json:"chunk_type,omitempty"`
+	Section       string  `json:"section,omitempty"`
+	Subsection    string  `json:"subsection,omitempty"`
+	StartPos      int     `json:"start_pos"` // Character offsets into the document content
+	EndPos        int     `json:"end_pos"`
+	ParentChunkID *string `json:"parent_chunk_id,omitempty"`
+	Characters    int     `json:"characters"`
+	Preview       string  `json:"preview"` // The start of the chunk's text, whitespace collapsed
+}
+
+// DocumentPreview is what ingesting a document would produce, worked out without embedding or
+// storing anything.
+type DocumentPreview struct {
+	CollectionName     string                 `json:"collection_name"`
+	Source             string                 `json:"source,omitempty"`
+	Status             string                 `json:"status"`                         // "added", "updated" or "unchanged", as ingestion would report it
+	ExistingDocumentID string                 `json:"existing_document_id,omitempty"` // The stored version a new one would replace
+	RequestedConfig    *ChunkingConfig        `json:"requested_config"`               // The request's or the collection's config, before adaptation
+	Strategy           string                 `json:"strategy"`                       // The strategy the pipeline chose for the document
+	Analysis           map[string]interface{} `json:"analysis"`                       // What the pipeline found: length, category, structure, language...
+	ContentLength      int                    `json:"content_length"`
+	ChunkCount         int                    `json:"chunk_count"`
+	Sections           []PreviewSection       `json:"sections"` // In document order
+	Chunks             []*EnhancedChunk       `json:"chunks"`   // In document order
+}
+
+// PreviewSection is a section detected in a previewed document and the span of its chunks.
+type PreviewSection struct {
+	Section    string `json:"section"`
+	Subsection string `json:"subsection,omitempty"`
+	StartPos   int    `json:"start_pos"`
+	EndPos     int    `json:"end_pos"`
+	Chunks     int    `json:"chunks"`
+}
+
+// DocumentACL restricts a document to the listed users and the members of the listed groups.
+type DocumentACL struct {
+	Users  []string `json:"users,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Principal identifies the user a query runs for, so retrieval skips documents they may not see.
+type Principal struct {
+	User   string   `json:"user,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// EnhancedChunk represents a piece of a document with rich metadata and relationships.
+type EnhancedChunk struct {
+	ID         string    `json:"id"`
+	DocumentID string    `json:"document_id"`
+	Text       string    `json:"text"`
+	Embedding  []float32 `json:"-"`
+
+	// Hierarchical information
+	ParentChunkID *string  `json:"parent_chunk_id,omitempty"` // For parent-child relationships
+	ChildChunkIDs []string `json:"child_chunk_ids,omitempty"` // Child chunks
+
+	// Structural metadata
+	Section    string `json:"section,omitempty"`    // e.g., "Professional Summary", "Experience"
+	Subsection string `json:"subsection,omitempty"` // e.g., specific job, skill category
+	ChunkType  string `json:"chunk_type"`           // e.g., "sentence", "paragraph", "section", "parent"
+
+	// Position and context
+	StartPos   int `json:"start_pos"`   // Character (rune) offset in original document
+	EndPos     int `json:"end_pos"`     // End character (rune) offset
+	ChunkIndex int `json:"chunk_index"` // Sequential index in document
+
+	// Semantic metadata
+	Keywords   []string               `json:"keywords,omitempty"`   // Extracted keywords
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`   // Flexible metadata
+	Confidence float64                `json:"confidence,omitempty"` // Relevance confidence for retrieval
+	Revision   int                    `json:"revision,omitempty"`   // Incremented each time the chunk text is edited
+
+	// Deduplication
+	ContentHash string  `json:"content_hash,omitempty"` // SHA-256 of the text the chunk is embedded from: its own, after any table description
+	DuplicateOf *string `json:"duplicate_of,omitempty"` // Chunk holding the embedding for identical text elsewhere in the collection
+
+	Collection string `json:"collection,omitempty"` // Collection the chunk was retrieved from, set by federated queries
+}
+
+// ChunkingStrategy defines different approaches to text chunking.
+type ChunkingStrategy string
+
+// ExpansionBackend selects how a query is expanded when query expansion is enabled.
+type ExpansionBackend string
+
+// HighlightBackend selects how the passages of a retrieved chunk that support an answer are found.
+type HighlightBackend string
+
+// DuplicateMethod selects how retrieved chunks are compared when near-duplicates are suppressed.
+type DuplicateMethod string
+
+// VerificationBackend selects how the sentences of an answer are checked against the retrieved chunks.
+type VerificationBackend string
+
+// UnsupportedAction is what faithfulness verification does with sentences the chunks don't support.
+type UnsupportedAction string
+
+// AnswerMode selects whether a query's answer is written by the chat model or quoted from the chunks.
+type AnswerMode string
+
+// AbstractionLevel restricts retrieval to detail chunks or to the summaries of documents ingested
+// with a summary tree.
+type AbstractionLevel string
+
+// RetrievalGranularity chooses between returning the chunks that matched and returning their parents.
+type RetrievalGranularity string
+
+// RetrieverName selects one of the retrievers a query can combine.
+type RetrieverName string
+
+// FusionMethod selects how the rankings of several retrievers are merged.
+type FusionMethod string
+
+// ChunkingConfig contains parameters for different chunking strategies.
+type ChunkingConfig struct {
+	Strategy           ChunkingStrategy `json:"strategy"`
+	FixedSize          int              `json:"fixed_size,omitempty"`           // For fixed size chunking
+	Overlap            int              `json:"overlap,omitempty"`              // Overlap between chunks
+	SentenceWindowSize int              `json:"sentence_window_size,omitempty"` // For sentence window strategy
+	MinChunkSize       int              `json:"min_chunk_size,omitempty"`       // Minimum chunk size
+	MaxChunkSize       int              `json:"max_chunk_size,omitempty"`       // Maximum chunk size
+	PreserveParagraphs bool             `json:"preserve_paragraphs,omitempty"`  // Try to keep paragraphs intact
+	ExtractKeywords    bool             `json:"extract_keywords,omitempty"`     // Extract keywords from chunks
+}
+
+// CreateCollectionRequest is the structure for requests to create a collection.
+type CreateCollectionRequest struct {
+	Name         string              `json:"name"`
+	Description  string              `json:"description"`
+	Defaults     *CollectionDefaults `json:"defaults,omitempty"`     // Settings applied to requests that omit them
+	Quantization *QuantizationConfig `json:"quantization,omitempty"` // How embeddings are stored; fixed once the collection is created
+}
+
+// QuantizationType selects how a collection's embeddings are compressed for search
+type QuantizationType string
+
+// QuantizationConfig stores a collection's embeddings quantized instead of as float32.
+// With Rescore the float vectors are kept as well, and the top candidates of the quantized
+// search are ranked again by their exact distance.
+type QuantizationConfig struct {
+	Type       QuantizationType `json:"type"`
+	Rescore    bool             `json:"rescore,omitempty"`
+	Oversample int              `json:"oversample,omitempty"` // Candidates rescored per result (default: 4)
+}
+
+// CollectionDefaults holds per-collection settings used when a request leaves them out.
+type CollectionDefaults struct {
+	ChunkingConfig *ChunkingConfig `json:"chunking_config,omitempty"` // Used when adding a document without a chunking config
+	Query          *QueryDefaults  `json:"query,omitempty"`
+	Routing        *RoutingConfig  `json:"routing,omitempty"` // Classify queries by intent and adjust their retrieval to it
+}
+
+// QueryIntent is the kind of question the query router classifies a query as.
+type QueryIntent string
+
+// RoutingConfig turns on query routing for a collection. Each intent has built-in retrieval
+// settings; Routes replaces the settings it sets.
+type RoutingConfig struct {
+	Enabled bool                          `json:"enabled"`
+	Routes  map[QueryIntent]RouteSettings `json:"routes,omitempty"`
+}
+
+// RouteSettings are the retrieval settings applied to the queries of one intent, unless the
+// query sets them itself.
+type RouteSettings struct {
+	TopK            int    `json:"top_k,omitempty"`
+	RerankerEnabled *bool  `json:"reranker_enabled,omitempty"`
+	MMREnabled      *bool  `json:"mmr_enabled,omitempty"`
+	QueryExpansion  *bool  `json:"query_expansion,omitempty"`
+	SkipRetrieval   *bool  `json:"skip_retrieval,omitempty"` // Answer with reply, without retrieving or calling the chat model
+	Reply           string `json:"reply,omitempty"`          // The answer to queries skipping retrieval
+}
+
+// QueryRoute reports how the query router classified a query and what it changed.
+type QueryRoute struct {
+	Intent           QueryIntent            `json:"intent"`
+	Cue              string                 `json:"cue,omitempty"`     // The words the intent was recognized by; empty when the query set intent or none matched
+	Applied          map[string]interface{} `json:"applied,omitempty"` // Settings the route gave the query
+	RetrievalSkipped bool                   `json:"retrieval_skipped,omitempty"`
+	Reply            string                 `json:"-"` // The answer when retrieval is skipped
+}
+
+// QueryDefaults are the query parameters a collection supplies when a query or search omits them.
+type QueryDefaults struct {
+	TopK              int      `json:"top_k,omitempty"`
+	RerankerEnabled   *bool    `json:"reranker_enabled,omitempty"`
+	SemanticThreshold *float64 `json:"semantic_threshold,omitempty"`
+}
+
+// AddDocumentRequest is the structure for requests to add a new document.
+type AddDocumentRequest struct {
+	CollectionName    string          `json:"collection_name"`
+	FilePath          string          `json:"file_path,omitempty"`          // For server-side file access
+	Content           string          `json:"content,omitempty"`            // For direct content submission
+	Source            string          `json:"source,omitempty"`             // e.g. filename if content is direct
+	DocType           string          `json:"doc_type,omitempty"`           // Document type for strategy selection
+	ChunkingConfig    *ChunkingConfig `json:"chunking_config,omitempty"`    // Custom chunking configuration
+	ExtractGraph      bool            `json:"extract_graph,omitempty"`      // Extract entities and relations for graph_rag queries
+	SummaryTree       bool            `json:"summary_tree,omitempty"`       // Add a tree of LLM summaries of the chunks, up to a document summary
+	SummarizeTables   bool            `json:"summarize_tables,omitempty"`   // Describe each table with the chat model and embed the description with it
+	DocumentSummary   bool            `json:"document_summary,omitempty"`   // Generate a title and summary, stored in the document's metadata and embedded as a summary chunk
+	GenerateQuestions bool            `json:"generate_questions,omitempty"` // Embed 2-3 questions each chunk answers, matched in its place at query time
+	ACL               *DocumentACL    `json:"acl,omitempty"`                // Restrict retrieval to these users and groups; re-ingests without one keep the stored ACL
+
+	// Expiry deletes the document, its chunks and embeddings automatically; re-ingests without one keep the stored expiry
+	ExpiresAt  string `json:"expires_at,omitempty"`  // RFC 3339 or YYYY-MM-DD
+	TTLSeconds int64  `json:"ttl_seconds,omitempty"` // Seconds from ingestion; exclusive with expires_at
+
+	// DeterministicIDs derives the document and chunk IDs from the source, content hash and chunk
+	// index instead of drawing random ones, so ingesting the same content twice stores it once.
+	// The server's deterministic_ids setting turns it on for every request.
+	DeterministicIDs bool `json:"deterministic_ids,omitempty"`
+
+	// Chunks, embedded by the client, are stored as they are instead of chunking the content and
+	// embedding the chunks. The content defaults to their texts joined.
+	Chunks []ImportedChunk `json:"chunks,omitempty"`
+}
+
+// SyncManifestEntry describes one source the client expects a collection to contain.
+// Content or FilePath is only needed when the stored hash differs from ContentHash.
+type SyncManifestEntry struct {
+	Source         string          `json:"source"`
+	ContentHash    string          `json:"content_hash,omitempty"` // SHA-256 hex of the raw source
+	Content        string          `json:"content,omitempty"`
+	FilePath       string          `json:"file_path,omitempty"`
+	DocType        string          `json:"doc_type,omitempty"`
+	ChunkingConfig *ChunkingConfig `json:"chunking_config,omitempty"`
+}
+
+// SyncRequest reconciles a collection with a manifest of sources.
+type SyncRequest struct {
+	Documents     []SyncManifestEntry `json:"documents"`
+	DeleteMissing bool                `json:"delete_missing,omitempty"` // Delete stored documents whose source is not in the manifest
+}
+
+// S3SourceRequest syncs a collection with the objects under a prefix of an S3-compatible bucket.
+// Objects whose ETag has not changed since the last sync are not downloaded again.
+type S3SourceRequest struct {
+	Bucket          string          `json:"bucket"`
+	Prefix          string          `json:"prefix,omitempty"`   // Only objects whose key starts with it are ingested
+	Endpoint        string          `json:"endpoint,omitempty"` // e.g. http://minio:9000; defaults to AWS S3 for the region
+	Region          string          `json:"region,omitempty"`   // Signing region; defaults to us-east-1
+	AccessKeyID     string          `json:"access_key_id"`
+	SecretAccessKey string          `json:"secret_access_key"`
+	SessionToken    string          `json:"session_token,omitempty"`
+	DocType         string          `json:"doc_type,omitempty"`
+	ChunkingConfig  *ChunkingConfig `json:"chunking_config,omitempty"`
+	DeleteMissing   bool            `json:"delete_missing,omitempty"` // Delete documents ingested from objects no longer under the prefix
+}
+
+// CrawlRequest crawls a website into a collection, starting from its sitemap or from a seed page.
+// Pages are fetched politely: robots.txt is respected and requests to a host are spaced out.
+type CrawlRequest struct {
+	SitemapURL     string          `json:"sitemap_url,omitempty"`     // sitemap.xml or sitemap index listing the pages to ingest
+	SeedURL        string          `json:"seed_url,omitempty"`        // Page whose links are followed when the site has no sitemap
+	MaxDepth       int             `json:"max_depth,omitempty"`       // Links followed away from the seed page; defaults to 3
+	MaxPages       int             `json:"max_pages,omitempty"`       // Pages fetched per crawl; defaults to 100
+	AllowedDomains []string        `json:"allowed_domains,omitempty"` // Hosts pages may be on, subdomains included; defaults to the host of the start URL
+	PathPrefix     string          `json:"path_prefix,omitempty"`     // Only pages whose path starts with it are crawled, e.g. "/docs/"
+	DocType        string          `json:"doc_type,omitempty"`
+	ChunkingConfig *ChunkingConfig `json:"chunking_config,omitempty"`
+	DeleteMissing  bool            `json:"delete_missing,omitempty"` // Delete documents of pages in scope that the crawl no longer reaches
+}
+
+// ImportedChunk is a chunk supplied by the client together with its pre-computed embedding.
+type ImportedChunk struct {
+	Text       string                 `json:"text"`
+	Embedding  []float32              `json:"embedding"`
+	Section    string                 `json:"section,omitempty"`
+	Subsection string                 `json:"subsection,omitempty"`
+	ChunkType  string                 `json:"chunk_type,omitempty"` // Defaults to "imported"
+	StartPos   int                    `json:"start_pos,omitempty"`
+	EndPos     int                    `json:"end_pos,omitempty"`
+	Keywords   []string               `json:"keywords,omitempty"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ImportedDocument groups pre-embedded chunks belonging to one source document.
+type ImportedDocument struct {
+	ID       string                 `json:"id,omitempty"`      // Generated if empty
+	Content  string                 `json:"content,omitempty"` // Defaults to the joined chunk texts
+	Source   string                 `json:"source,omitempty"`
+	DocType  string                 `json:"doc_type,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Chunks   []ImportedChunk        `json:"chunks"`
+	ACL      *DocumentACL           `json:"acl,omitempty"`
+}
+
+// ImportEmbeddingsRequest bulk-loads documents whose chunks were embedded offline.
+type ImportEmbeddingsRequest struct {
+	CollectionName string             `json:"collection_name"`
+	Documents      []ImportedDocument `json:"documents"`
+}
+
+// BatchIngestRequest adds many documents to one collection. Their chunks are embedded together and
+// they are stored BatchSize documents per transaction. A document's collection_name may be left out.
+type BatchIngestRequest struct {
+	CollectionName string               `json:"collection_name"`
+	Documents      []AddDocumentRequest `json:"documents"`
+	BatchSize      int                  `json:"batch_size,omitempty"` // Documents per transaction (default: 20)
+}
+
+// ListOptions holds the paging, sorting and creation time parameters shared by the list endpoints.
+// A zero Limit returns every match. Times are RFC 3339 or YYYY-MM-DD.
+type ListOptions struct {
+	Limit         int    `form:"limit"`
+	Offset        int    `form:"offset"`
+	SortBy        string `form:"sort_by"`        // Defaults to created_at
+	Order         string `form:"order"`          // Defaults to desc for created_at and counts, asc otherwise
+	CreatedAfter  string `form:"created_after"`  // Inclusive
+	CreatedBefore string `form:"created_before"` // Exclusive
+}
+
+// ListCollectionsRequest filters and pages the collections of a tenant.
+type ListCollectionsRequest struct {
+	ListOptions
+	Name string `form:"name"` // Case-insensitive substring of the collection name
+}
+
+// ListDocumentsRequest filters and pages the documents of a collection.
+type ListDocumentsRequest struct {
+	ListOptions
+	DocType string `form:"doc_type"`
+	Source  string `form:"source"` // Case-insensitive substring of the document source
+}
+
+// QueryAnalyticsRequest selects the logged queries aggregated by the analytics endpoint. Times are
+// RFC 3339 or YYYY-MM-DD.
+type QueryAnalyticsRequest struct {
+	CollectionName string `form:"collection_name"` // Every collection when empty
+	User           string `form:"user"`            // Only queries run for this principal user
+	CreatedAfter   string `form:"created_after"`   // Inclusive
+	CreatedBefore  string `form:"created_before"`  // Exclusive
+	Limit          int    `form:"limit"`           // Entries per ranking; defaults to 10
+}
+
+// SimilarChunksRequest selects the chunks returned as similar to a chunk
+type SimilarChunksRequest struct {
+	TopK                int        `form:"top_k"`                 // Defaults to 5
+	ExcludeSameDocument bool       `form:"exclude_same_document"` // Only chunks of other documents
+	Principal           *Principal `form:"-"`                     // Only chunks of documents this user or their groups may see
+}
+
+// SimilarChunksResponse lists the chunks most similar to a chunk of a collection, most similar first
+type SimilarChunksResponse struct {
+	ChunkID        string           `json:"chunk_id"`
+	DocumentID     string           `json:"document_id"`
+	CollectionName string           `json:"collection_name"`
+	Chunks         []*EnhancedChunk `json:"chunks"`
+	Scores         []float64        `json:"similarity_scores"` // Aligned with chunks
+}
+
+// AuditLogRequest filters and pages the audit log. Format only applies to exports.
+type AuditLogRequest struct {
+	ListOptions
+	Tenant     string `form:"tenant"`
+	Actor      string `form:"actor"`  // "sha256:<hash>" of an API key, a JWT user or a system component
+	Action     string `form:"action"` // e.g. document.delete
+	Collection string `form:"collection"`
+	Format     string `form:"format"` // Defaults to ndjson
+}
+
+// UpdateChunkRequest carries corrected text, and optionally its embedding, for a single chunk.
+type UpdateChunkRequest struct {
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding,omitempty"` // Embedded by the client; the server embeds the text when empty
+}
+
+// ReembedRequest starts re-embedding a collection, e.g. after switching embedding models.
+type ReembedRequest struct {
+	Model     string `json:"model,omitempty"`      // Embedding model to use; defaults to the configured one
+	BatchSize int    `json:"batch_size,omitempty"` // Chunks embedded and written per batch; defaults to 64
+}
+
+// RestoreRequest names the backup to restore, as listed by GET /admin/backup.
+type RestoreRequest struct {
+	Name string `json:"name"`
+}
+
+// MaintenanceRequest picks the maintenance steps to run now; none runs them all.
+type MaintenanceRequest struct {
+	Steps []string `json:"steps,omitempty"`
+}
+
+// ReadOnlyRequest switches read-only mode on or off. Reason is reported with the status and in
+// refusals until the next switch.
+type ReadOnlyRequest struct {
+	ReadOnly *bool  `json:"read_only"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// RoleAssignmentRequest grants or revokes the role of one identity: an API key, the user of a JWT
+// or a value of its role or groups claim. Role is ignored when revoking.
+type RoleAssignmentRequest struct {
+	APIKey string `json:"api_key,omitempty"`
+	User   string `json:"user,omitempty"`  // JWT user claim, sub by default
+	Claim  string `json:"claim,omitempty"` // Value of the JWT role or groups claim
+	Role   string `json:"role,omitempty"`  // "reader", "writer" or "admin"
+}
+
+// QueryRequest is the structure for requests to query the RAG system.
+type QueryRequest struct {
+	CollectionName    string                 `json:"collection_name"`
+	CollectionNames   []string               `json:"collection_names,omitempty"` // Search several collections concurrently; "*" searches them all
+	Query             string                 `json:"query"`
+	TopK              int                    `json:"top_k,omitempty"`
+	RerankerEnabled   bool                   `json:"reranker_enabled,omitempty"`   // Enable re-ranking
+	MetadataFilters   map[string]interface{} `json:"metadata_filters,omitempty"`   // Filter by metadata
+	IncludeParents    bool                   `json:"include_parents,omitempty"`    // Include parent chunks in results
+	QueryExpansion    bool                   `json:"query_expansion,omitempty"`    // Expand query with synonyms/related terms
+	ExpansionBackend  ExpansionBackend       `json:"expansion_backend,omitempty"`  // "static" (default) or "llm"
+	ExpansionQueries  int                    `json:"expansion_queries,omitempty"`  // Paraphrases generated by the llm backend, 2-4; defaults to 3
+	SemanticThreshold float64                `json:"semantic_threshold,omitempty"` // Minimum similarity threshold
+	MMREnabled        bool                   `json:"mmr_enabled,omitempty"`        // Diversify results with maximal marginal relevance
+	MMRLambda         float64                `json:"mmr_lambda,omitempty"`         // Relevance vs. diversity trade-off in (0, 1]; defaults to 0.5
+	MMRCandidates     int                    `json:"mmr_candidates,omitempty"`     // Candidate pool MMR selects from; defaults to 4×top_k
+	GraphRAG          bool                   `json:"graph_rag,omitempty"`          // Expand retrieval along knowledge graph relations
+	GraphHops         int                    `json:"graph_hops,omitempty"`         // Relations followed from retrieved chunks, 1-3; defaults to 2
+	Abstraction       AbstractionLevel       `json:"abstraction,omitempty"`        // "all" (default), "detail" or "summary" chunks of summary trees
+
+	// Small-to-big retrieval matches the precise child chunks of the parent_document strategy but returns their parents
+	RetrievalGranularity RetrievalGranularity `json:"retrieval_granularity,omitempty"` // "chunk" (default) or "small_to_big"
+
+	// Several retrievers can run concurrently, their rankings fused into one
+	Retrievers       []RetrieverName    `json:"retrievers,omitempty"`        // Retrievers run concurrently and fused; defaults to vector search alone
+	Fusion           FusionMethod       `json:"fusion,omitempty"`            // "rrf" (default) or "weighted"
+	RetrieverWeights map[string]float64 `json:"retriever_weights,omitempty"` // Weight per retriever name; missing ones weigh 1
+
+	Principal *Principal `json:"principal,omitempty"` // Only retrieve documents this user or their groups may see; omitted means no restriction
+
+	// Range filters and recency, for collections where fresher documents matter
+	CreatedAfter        string                   `json:"created_after,omitempty"`          // Only documents added at or after this time (RFC 3339 or YYYY-MM-DD)
+	CreatedBefore       string                   `json:"created_before,omitempty"`         // Only documents added before this time
+	MetadataRanges      map[string]MetadataRange `json:"metadata_ranges,omitempty"`        // Numeric bounds on chunk or document metadata, e.g. {"year": {"gte": 2020}}
+	RecencyHalfLifeDays float64                  `json:"recency_half_life_days,omitempty"` // Boost newer documents; the boost halves every this many days
+	RecencyWeight       float64                  `json:"recency_weight,omitempty"`         // Share of the score given to recency; defaults to 0.3
+
+	// Near-duplicate suppression drops chunks that repeat a higher-ranked one, as overlapping chunks do
+	DeduplicateChunks  bool            `json:"deduplicate_chunks,omitempty"`  // Drop near-duplicate chunks before top_k are selected, listing them in suppressed_duplicates
+	DuplicateMethod    DuplicateMethod `json:"duplicate_method,omitempty"`    // "shingles" (default) or "embedding"
+	DuplicateThreshold float64         `json:"duplicate_threshold,omitempty"` // Similarity from which a chunk is a duplicate; defaults to 0.8 with shingles, 0.95 with embedding
+
+	// Grouping collapses the chunks of each document into one result, as search engines do
+	GroupByDocument     bool `json:"group_by_document,omitempty"`     // top_k counts documents, each returned as its best chunk with sibling snippets and a document score
+	SnippetsPerDocument int  `json:"snippets_per_document,omitempty"` // Sibling snippets per document; defaults to 2
+
+	// Highlighting locates the passages of each retrieved chunk that support the answer (query only)
+	Highlights       bool             `json:"highlights,omitempty"`        // Return supporting passages with offsets into chunk and document
+	HighlightBackend HighlightBackend `json:"highlight_backend,omitempty"` // "embedding" (default) or "llm"
+	MaxHighlights    int              `json:"max_highlights,omitempty"`    // Passages per chunk; defaults to 2
+
+	SelfCheck bool `json:"self_check,omitempty"` // Ask the chat model whether the chunks support the answer, refining confidence and is_grounded (query only)
+
+	// Faithfulness verification checks every sentence of the answer against the chunks (query only)
+	VerifyFaithfulness  bool                `json:"verify_faithfulness,omitempty"`  // Check each answer sentence and return a faithfulness report
+	VerificationBackend VerificationBackend `json:"verification_backend,omitempty"` // "llm" (default) or "embedding"
+	UnsupportedAction   UnsupportedAction   `json:"unsupported_action,omitempty"`   // "flag" (default) or "strip"
+
+	Generation *GenerationOptions `json:"generation,omitempty"` // Chat model and sampling parameters for the answer (query only)
+
+	AnswerMode AnswerMode `json:"answer_mode,omitempty"` // "abstractive" (default), "extractive" or "both" (query only)
+
+	SuggestQuestions bool `json:"suggest_questions,omitempty"` // Suggest 3 follow-up questions the retrieved chunks answer (query only)
+
+	// Query routing, when the collection's defaults enable it (query only)
+	Intent QueryIntent `json:"intent,omitempty"` // Route as this intent instead of classifying the query
+	Route  *QueryRoute `json:"-"`                // Set by the router
+
+	// Agentic retrieval lets the chat model search several times before the answer is written (query only)
+	Agentic       bool `json:"agentic,omitempty"`        // Decompose the question and retrieve per sub-question, then answer from everything found
+	MaxIterations int  `json:"max_iterations,omitempty"` // Searches the agent may run; defaults to 4
+}
+
+// GenerationOptions choose the chat model and its sampling parameters for one answer. Parameters
+// left out use the model server's defaults; the model defaults to chat_model.
+type GenerationOptions struct {
+	Model        string   `json:"model,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	TopP         *float64 `json:"top_p,omitempty"`
+	MaxTokens    int      `json:"max_tokens,omitempty"`
+	SystemPrompt string   `json:"system_prompt,omitempty"` // Sent as the system message, replacing the default assistant instructions
+}
+
+// MetadataRange bounds a numeric metadata value of a chunk or its document; bounds left out are open.
+type MetadataRange struct {
+	Gt  *float64 `json:"gt,omitempty"`
+	Gte *float64 `json:"gte,omitempty"`
+	Lt  *float64 `json:"lt,omitempty"`
+	Lte *float64 `json:"lte,omitempty"`
+}
+
+// AnalyzeRequest is the structure for requests to analyze a query with full chunk metadata.
+type AnalyzeRequest struct {
+	CollectionName string `json:"collection_name"`
+	Query          string `json:"query"`
+	ShowMetadata   bool   `json:"show_metadata"`
+}
+
+// CompareChunkingRequest is the structure for requests to compare chunking strategies on sample content.
+type CompareChunkingRequest struct {
+	Content    string             `json:"content"`
+	DocType    string             `json:"doc_type"`
+	Strategies []ChunkingStrategy `json:"strategies"`
+}
+
+// EvaluationCase is one question of an evaluation test set, with the answer and/or documents it should find.
+type EvaluationCase struct {
+	Question            string   `json:"question"`
+	ExpectedAnswer      string   `json:"expected_answer,omitempty"`       // Scored against generated answers
+	RelevantDocumentIDs []string `json:"relevant_document_ids,omitempty"` // Scored against retrieved documents
+}
+
+// EvaluationGrid lists the parameter values to evaluate; every combination is run.
+type EvaluationGrid struct {
+	ChunkingStrategies []ChunkingStrategy `json:"chunking_strategies,omitempty"` // Re-chunk the collection with each strategy; empty evaluates the stored chunks
+	TopK               []int              `json:"top_k,omitempty"`
+	RerankerEnabled    []bool             `json:"reranker_enabled,omitempty"`
+}
+
+// EvaluateRequest is the structure for requests to evaluate retrieval and answer quality on a test set.
+type EvaluateRequest struct {
+	CollectionName  string           `json:"collection_name"`
+	TestSet         []EvaluationCase `json:"test_set"`
+	Grid            EvaluationGrid   `json:"grid"`
+	GenerateAnswers bool             `json:"generate_answers"` // Also generate answers and score them
+}
+
+// DocumentSearchRequest finds the documents of a collection most similar to a query, or to one of
+// its documents, by their document embeddings. Exactly one of Query and DocumentID is required.
+type DocumentSearchRequest struct {
+	CollectionName string     `json:"collection_name"`
+	Query          string     `json:"query,omitempty"`       // Find documents about this text
+	DocumentID     string     `json:"document_id,omitempty"` // Find documents like this one, which is left out of the results
+	TopK           int        `json:"top_k,omitempty"`       // Documents to return, 10 by default
+	DocType        string     `json:"doc_type,omitempty"`    // Only documents of this type
+	Principal      *Principal `json:"principal,omitempty"`   // Only documents this user or their groups may see; omitted means no restriction
+}
+
+// DocumentSearchResponse lists the documents found, most similar first
+type DocumentSearchResponse struct {
+	CollectionName string          `json:"collection_name"`
+	Query          string          `json:"query,omitempty"`
+	DocumentID     string          `json:"document_id,omitempty"`
+	Documents      []DocumentMatch `json:"documents"`
+	Unembedded     int             `json:"unembedded,omitempty"` // Documents without embedded chunks, which can't be found
+	ProcessingTime float64         `json:"processing_time"`
+}
+
+// DocumentMatch is a document found by document search
+type DocumentMatch struct {
+	DocumentID string    `json:"document_id"`
+	Source     string    `json:"source"`
+	DocType    string    `json:"doc_type,omitempty"`
+	Title      string    `json:"title,omitempty"` // Generated title, when the document was summarized
+	ChunkCount int       `json:"chunk_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	Score      float64   `json:"score"` // Cosine similarity of the document embeddings, or of the query and the document embedding
+}
+
+// TopicsRequest clusters the chunks of a collection into topics. Every field is optional.
+type TopicsRequest struct {
+	NumTopics  int        `json:"num_topics,omitempty"`  // Clusters to find; chosen from the collection's size when omitted
+	MaxChunks  int        `json:"max_chunks,omitempty"`  // Chunks clustered, spread evenly over the collection; 5000 by default
+	Exemplars  int        `json:"exemplars,omitempty"`   // Exemplar documents and representative chunks per topic; 3 by default
+	SkipLabels bool       `json:"skip_labels,omitempty"` // Name topics by their keywords without asking the chat model
+	Principal  *Principal `json:"principal,omitempty"`   // Only chunks of documents this user or their groups may see
+}
+
+// TopicsResponse lists the topics of a collection, largest first
+type TopicsResponse struct {
+	CollectionName  string   `json:"collection_name"`
+	Topics          []Topic  `json:"topics"`
+	ChunksClustered int      `json:"chunks_clustered"`
+	ChunksTotal     int      `json:"chunks_total"` // Embedded passages of the collection, of which ChunksClustered were sampled
+	Degradations    []string `json:"degradations,omitempty"`
+	ProcessingTime  float64  `json:"processing_time"`
+}
+
+// Topic is a cluster of similar chunks
+type Topic struct {
+	ID                   int             `json:"id"`
+	Label                string          `json:"label"`
+	Keywords             []string        `json:"keywords"`       // Most frequent keywords of its chunks
+	ChunkCount           int             `json:"chunk_count"`    // Of the clustered chunks
+	DocumentCount        int             `json:"document_count"` // Documents with a chunk in the topic
+	Share                float64         `json:"share"`          // Fraction of the clustered chunks
+	ExemplarDocuments    []TopicDocument `json:"exemplar_documents"`
+	RepresentativeChunks []TopicChunk    `json:"representative_chunks"` // Nearest the cluster's center
+}
+
+// TopicDocument is a document with many chunks in a topic
+type TopicDocument struct {
+	DocumentID string `json:"document_id"`
+	Source     string `json:"source"`
+	Title      string `json:"title,omitempty"`
+	ChunkCount int    `json:"chunk_count"` // Of its chunks in the topic
+}
+
+// TopicChunk is a chunk near the center of a topic
+type TopicChunk struct {
+	ChunkID    string  `json:"chunk_id"`
+	DocumentID string  `json:"document_id"`
+	Text       string  `json:"text"`
+	Similarity float64 `json:"similarity"` // Cosine similarity to the center
+}
+
+// DuplicatesReport lists the groups of duplicate documents of a collection, largest first
+type DuplicatesReport struct {
+	CollectionName     string           `json:"collection_name"`
+	Threshold          float64          `json:"threshold"`
+	Groups             []DuplicateGroup `json:"groups"`
+	DocumentsScanned   int              `json:"documents_scanned"`
+	RedundantDocuments int              `json:"redundant_documents"`  // Documents the suggestions would remove
+	Unembedded         int              `json:"unembedded,omitempty"` // Documents without embedded chunks, only compared by content hash
+	ProcessingTime     float64          `json:"processing_time"`
+}
+
+// DuplicateGroup is a set of documents with the same or nearly the same content, with a
+// suggestion of which to keep
+type DuplicateGroup struct {
+	ID              int                 `json:"id"`
+	Match           string              `json:"match"`          // "exact" when every document has the same content hash, otherwise "near"
+	MinSimilarity   float64             `json:"min_similarity"` // Lowest similarity of a document to the one to keep
+	Documents       []DuplicateDocument `json:"documents"`      // The one to keep first
+	Keep            string              `json:"keep"`
+	Remove          []string            `json:"remove"`
+	SuggestedAction string              `json:"suggested_action"` // "delete" for exact copies, "merge" for near-duplicates worth a look first
+}
+
+// DuplicateDocument is a document of a duplicate group
+type DuplicateDocument struct {
+	DocumentID  string    `json:"document_id"`
+	Source      string    `json:"source"`
+	DocType     string    `json:"doc_type,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	ChunkCount  int       `json:"chunk_count"`
+	CharCount   int       `json:"char_count,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	ContentHash string    `json:"content_hash,omitempty"`
+	Similarity  float64   `json:"similarity"` // To the document to keep; 1 for exact copies
+}
+
+// ResolveDuplicatesRequest deletes duplicates of a document, optionally merging their metadata into it
+type ResolveDuplicatesRequest struct {
+	Keep          string   `json:"keep"`
+	Remove        []string `json:"remove"`
+	MergeMetadata bool     `json:"merge_metadata,omitempty"` // Copy the metadata fields the kept document lacks from the removed ones and record their sources
+}
+
+// ResolveDuplicatesResponse reports what resolving duplicates changed
+type ResolveDuplicatesResponse struct {
+	CollectionName string   `json:"collection_name"`
+	Keep           string   `json:"keep"`
+	Removed        []string `json:"removed"`
+	MergedFields   []string `json:"merged_fields,omitempty"`  // Metadata fields copied to the kept document
+	MergedSources  []string `json:"merged_sources,omitempty"` // Sources of the removed documents, recorded in the kept document's duplicate_sources metadata
+}
+
+// QueryResponse is the structure for the RAG system's answer.
+type QueryResponse struct {
+	Answer           string           `json:"answer"`
+	RetrievedContext []string         `json:"retrieved_context,omitempty"`
+	EnhancedChunks   []*EnhancedChunk `json:"enhanced_chunks,omitempty"`   // Full chunk metadata
+	SimilarityScores []float64        `json:"similarity_scores,omitempty"` // Similarity scores for chunks
+	RerankedScores   []float64        `json:"reranked_scores,omitempty"`   // Re-ranking scores
+	ProcessingTime   float64          `json:"processing_time,omitempty"`   // Query processing time
+	MetadataUsed     bool             `json:"metadata_used,omitempty"`     // Whether metadata filtering was applied
+	Degradations     []string         `json:"degradations,omitempty"`      // Fallbacks applied because a backend was unavailable
+	Citations        []Citation       `json:"citations,omitempty"`         // Sources referenced by [n] markers in the answer
+	ExpandedQueries  []string         `json:"expanded_queries,omitempty"`  // Queries retrieved for by LLM expansion, original first
+	GraphEntities    []string         `json:"graph_entities,omitempty"`    // Entities reached by graph_rag expansion
+	Highlights       []ChunkHighlight `json:"highlights,omitempty"`        // Passages supporting the answer, aligned with enhanced_chunks
+
+	// Whether to trust the answer or escalate it to a human
+	Confidence        float64           `json:"confidence"`                   // Estimated chance, 0-1, that the answer is correct and supported by the chunks
+	IsGrounded        bool              `json:"is_grounded"`                  // The answer is backed by the retrieved chunks
+	ConfidenceDetails *AnswerConfidence `json:"confidence_details,omitempty"` // The signals confidence was estimated from
+
+	Faithfulness *FaithfulnessReport `json:"faithfulness,omitempty"` // Sentence-by-sentence verification, when verify_faithfulness was set
+
+	Collections []string `json:"collections,omitempty"` // Collections searched by a federated query
+
+	Model string `json:"model,omitempty"` // Chat model that generated the answer; empty for extractive answers
+
+	Documents []DocumentGroup `json:"documents,omitempty"` // Documents of enhanced_chunks, aligned with them, when group_by_document was set
+
+	Coalesced bool `json:"coalesced,omitempty"` // Answered by an identical query that was already running
+
+	SuppressedDuplicates []SuppressedDuplicate `json:"suppressed_duplicates,omitempty"` // Chunks left out as near-duplicates, when deduplicate_chunks was set
+
+	// Verbatim passages supporting the answer, with answer_mode extractive or both
+	ExtractiveAnswer string          `json:"extractive_answer,omitempty"` // The passages quoted as an answer, with answer_mode both
+	Passages         []AnswerPassage `json:"passages,omitempty"`          // The quoted passages, best first
+
+	SuggestedQuestions []string `json:"suggested_questions,omitempty"` // Follow-up questions the retrieved chunks answer, when suggest_questions was set
+
+	Route *QueryRoute `json:"route,omitempty"` // How the query was routed, when the collection routes queries
+
+	AgentTrace []AgentStep `json:"agent_trace,omitempty"` // The searches the agent ran and why it stopped, when agentic was set
+}
+
+// AgentStep is one decision of agentic retrieval: a search the chat model asked for, the answer
+// it moved on to, or the reason the loop stopped.
+type AgentStep struct {
+	Step      int      `json:"step"`
+	Action    string   `json:"action"`               // "search", "answer" or "stop"
+	Query     string   `json:"query,omitempty"`      // What a search looked for
+	Reason    string   `json:"reason,omitempty"`     // Why the model chose the action, or why the loop stopped
+	ChunkIDs  []string `json:"chunk_ids,omitempty"`  // Chunks a search found, best first
+	NewChunks int      `json:"new_chunks,omitempty"` // Of those, the chunks no earlier search found
+}
+
+// AnswerPassage is a sentence of a retrieved chunk quoted verbatim in an extractive answer.
+// Offsets count characters (runes), like the chunk's start_pos and end_pos.
+type AnswerPassage struct {
+	Text       string  `json:"text"`
+	Marker     int     `json:"marker"` // The n of the [n] marker quoting it, the chunk's context number
+	ChunkID    string  `json:"chunk_id"`
+	DocumentID string  `json:"document_id"`
+	Score      float64 `json:"score"`       // Share of the query terms the passage contains
+	ChunkStart int     `json:"chunk_start"` // Offset of the passage in the chunk text
+	ChunkEnd   int     `json:"chunk_end"`
+	StartPos   int     `json:"start_pos"` // Offset of the passage in the document; -1 when the chunk can't be located in it
+	EndPos     int     `json:"end_pos"`
+}
+
+// SuppressedDuplicate is a retrieved chunk left out because it nearly repeats a higher-ranked one
+type SuppressedDuplicate struct {
+	ChunkID     string  `json:"chunk_id"`
+	DocumentID  string  `json:"document_id"`
+	DuplicateOf string  `json:"duplicate_of"` // The chunk kept in its place
+	Similarity  float64 `json:"similarity"`   // Similarity of the two chunks by the duplicate method
+	Score       float64 `json:"score"`        // Similarity score of the left-out chunk to the query
+	Text        string  `json:"text"`
+}
+
+// DocumentGroup is one document of a query grouped by document: its best chunk, which is returned
+// in place of its other chunks, and snippets of those.
+type DocumentGroup struct {
+	DocumentID    string         `json:"document_id"`
+	ChunkID       string         `json:"chunk_id"`       // The document's best chunk
+	Score         float64        `json:"score"`          // Aggregate of the scores of the document's chunks
+	MatchedChunks int            `json:"matched_chunks"` // Chunks of the document among the candidates
+	Snippets      []ChunkSnippet `json:"snippets,omitempty"`
+}
+
+// ChunkSnippet is a shortened sibling chunk of a document's best chunk
+type ChunkSnippet struct {
+	ChunkID    string  `json:"chunk_id"`
+	ChunkIndex int     `json:"chunk_index"`
+	Section    string  `json:"section,omitempty"`
+	Text       string  `json:"text"`
+	Score      float64 `json:"score"`
+}
+
+// FaithfulnessReport lists the verdict on every sentence of an answer.
+type FaithfulnessReport struct {
+	Backend        VerificationBackend `json:"backend"`
+	Score          float64             `json:"score"`                     // Share of sentences the chunks support, 0-1
+	Supported      int                 `json:"supported"`                 // Sentences the chunks support
+	Unsupported    int                 `json:"unsupported"`               // Sentences the chunks don't support, contradicted ones included
+	Contradicted   int                 `json:"contradicted"`              // Sentences the chunks state otherwise (llm backend only)
+	Stripped       int                 `json:"stripped"`                  // Unsupported sentences removed from the answer
+	OriginalAnswer string              `json:"original_answer,omitempty"` // The answer before stripping, when sentences were removed
+	Sentences      []SentenceVerdict   `json:"sentences"`
+}
+
+// SentenceVerdict is the verdict on one sentence of an answer. Offsets count characters (runes) of
+// the answer as generated.
+type SentenceVerdict struct {
+	Text       string   `json:"text"`
+	Verdict    string   `json:"verdict"` // "supported", "unsupported" or "contradicted"
+	Start      int      `json:"start"`
+	End        int      `json:"end"`
+	ChunkIDs   []string `json:"chunk_ids,omitempty"`  // Chunks supporting, or contradicting, the sentence
+	Similarity *float64 `json:"similarity,omitempty"` // Similarity of the closest passage (embedding backend)
+}
+
+// AnswerConfidence lists the signals an answer's confidence was estimated from.
+type AnswerConfidence struct {
+	Retrieval         float64  `json:"retrieval"`                    // From the similarity scores of the retrieved chunks, 0-1
+	Cited             bool     `json:"cited"`                        // The answer cites at least one chunk
+	NotFound          bool     `json:"not_found"`                    // The answer says the chunks don't answer the question
+	SelfCheck         *float64 `json:"self_check,omitempty"`         // The chat model's confidence in the answer, 0-1, when self_check ran
+	Verdict           string   `json:"verdict,omitempty"`            // Self-check verdict: "supported", "partially_supported" or "unsupported"
+	UnsupportedClaims []string `json:"unsupported_claims,omitempty"` // Claims the self-check found no support for
+	Faithfulness      *float64 `json:"faithfulness,omitempty"`       // Faithfulness score of the answer, when verify_faithfulness was set
+}
+
+// ChunkHighlight lists the passages of one retrieved chunk that support the answer.
+type ChunkHighlight struct {
+	ChunkID    string          `json:"chunk_id"`
+	DocumentID string          `json:"document_id"`
+	Spans      []HighlightSpan `json:"spans"` // In text order; empty when nothing in the chunk supports the answer
+}
+
+// HighlightSpan is a passage of a chunk, located in the chunk text and in the original document.
+// Offsets count characters (runes), like the chunk's start_pos and end_pos.
+type HighlightSpan struct {
+	Text       string  `json:"text"`
+	Score      float64 `json:"score"`       // Similarity to the answer; 1 for quotes picked by the llm backend
+	ChunkStart int     `json:"chunk_start"` // Offset of the passage in the chunk text
+	ChunkEnd   int     `json:"chunk_end"`
+	StartPos   int     `json:"start_pos"` // Offset of the passage in the document; -1 when the chunk can't be located in it
+	EndPos     int     `json:"end_pos"`
+}
+
+// Citation maps an [n] marker in a generated answer to the chunk it refers to.
+type Citation struct {
+	Marker          int      `json:"marker"`               // The n in [n], matching the context index given to the LLM
+	ChunkID         string   `json:"chunk_id"`             // Cited chunk
+	DocumentID      string   `json:"document_id"`          // Document the chunk belongs to
+	Collection      string   `json:"collection,omitempty"` // Collection of the chunk, in federated queries
+	Source          string   `json:"source,omitempty"`     // Document source, e.g. filename
+	Section         string   `json:"section,omitempty"`    // Section of the cited chunk
+	StartPos        int      `json:"start_pos"`            // Character offset of the chunk in the source document
+	EndPos          int      `json:"end_pos"`              // End character offset of the chunk in the source document
+	AnswerPositions []int    `json:"answer_positions"`     // Character offsets of each occurrence of the marker in the answer
+	StartTime       *float64 `json:"start_time,omitempty"` // Seconds into the recording where a transcript chunk starts
+	EndTime         *float64 `json:"end_time,omitempty"`
+}
+
+// EmbeddingsRequest is the body of the OpenAI-compatible POST /v1/embeddings endpoint.
+type EmbeddingsRequest struct {
+	Input          interface{} `json:"input"`                     // A string or an array of strings
+	Model          string      `json:"model,omitempty"`           // Defaults to the configured embedding model
+	EncodingFormat string      `json:"encoding_format,omitempty"` // "float" (default) or "base64"
+	User           string      `json:"user,omitempty"`            // Accepted for compatibility and ignored
+}
+
+// EmbeddingsUsage reports the tokens an embeddings request used.
+type EmbeddingsUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// ChatCompletionMessage represents a single message in a chat completion request/response.
+type ChatCompletionMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatProxyRequest is the body of the OpenAI-compatible /v1/chat/completions endpoint. Other
+// OpenAI fields, such as temperature, are forwarded to the chat model unchanged.
+type ChatProxyRequest struct {
+	Model    string                  `json:"model,omitempty"` // Defaults to chat_model
+	Messages []ChatCompletionMessage `json:"messages"`
+	Stream   bool                    `json:"stream,omitempty"` // Relay the model's server-sent events; openai provider only
+	RAG      *QueryRequest           `json:"rag,omitempty"`    // Retrieval options; the query is the latest user message
+}
+
+// ChatChoice represents one of the completion choices from the API.
+type ChatChoice struct {
+	Index        int                   `json:"index"`
+	Message      ChatCompletionMessage `json:"message"`
+	FinishReason string                `json:"finish_reason"`
+}
+
+// ChatCompletionResponse is the top-level structure for responses from the chat completion API.
+type ChatCompletionResponse struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+}
+
+// ChatCompletionChunk is one server-sent event of a streamed chat completion from an
+// OpenAI-compatible API.
+type ChatCompletionChunk struct {
+	ID      string            `json:"id"`
+	Object  string            `json:"object"` // "chat.completion.chunk"
+	Created int64             `json:"created"`
+	Model   string            `json:"model"`
+	Choices []ChatChunkChoice `json:"choices"`
+}
+
+// ChatChunkChoice carries the text a choice gained since the previous chunk.
+type ChatChunkChoice struct {
+	Index        int                   `json:"index"`
+	Delta        ChatCompletionMessage `json:"delta"`
+	FinishReason string                `json:"finish_reason"` // Empty until the last chunk of the choice
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// serverModels is the server's models package, next to the client in the repository
+const serverModels = "../models/types.go"
+
+// renamedModels are the server types the client names differently
+var renamedModels = map[string]string{"EmbeddingsRequest": "OpenAIEmbeddingsRequest"}
+
+// jsonFields returns the JSON field names of every struct type declared in a file, by type name
+func jsonFields(t *testing.T, path string) map[string][]string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		t.Fatalf("parse %s: %v", path, err)
+	}
+	types := make(map[string][]string)
+	ast.Inspect(file, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		st, ok := spec.Type.(*ast.StructType)
+		if !ok {
+			return false
+		}
+		fields := []string{}
+		for _, field := range st.Fields.List {
+			if field.Tag == nil {
+				continue
+			}
+			tag, _ := strconv.Unquote(field.Tag.Value)
+			fields = append(fields, reflect.StructTag(tag).Get("json"))
+		}
+		types[spec.Name.Name] = fields
+		return false
+	})
+	return types
+}
+
+func TestModelsMatchServer(t *testing.T) {
+	if _, err := os.Stat(serverModels); err != nil {
+		t.Skip("the server's models package is not next to the client")
+	}
+	server := jsonFields(t, serverModels)
+	for name, fields := range jsonFields(t, "models.go") {
+		serverName := name
+		if renamed, ok := renamedModels[name]; ok {
+			serverName = renamed
+		}
+		serverFields, ok := server[serverName]
+		if !ok {
+			t.Errorf("%s is not a type of the server", serverName)
+			continue
+		}
+		if !reflect.DeepEqual(fields, serverFields) {
+			t.Errorf("%s has JSON fields %v, the server's %v", name, fields, serverFields)
+		}
+	}
+}
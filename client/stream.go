@@ -0,0 +1,105 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ChatStream reads the events of a streamed chat completion. Call Recv until it returns io.EOF,
+// and Close when done, including when stopping early.
+type ChatStream struct {
+	RetrievedChunks int      // Chunks retrieved as context, from the X-RAG-Chunks header
+	Degradations    []string // Retrieval steps skipped to answer, from the X-RAG-Degradations header
+
+	body   io.ReadCloser
+	reader *bufio.Reader
+	done   bool
+}
+
+// ChatCompletionStream sends a conversation through the OpenAI-compatible endpoint with streaming
+// on and returns the chat model's answer as it is generated. Opening the stream is retried like
+// other requests; a stream that breaks once open fails Recv instead. The server must use the openai
+// provider, or the request gets a 400.
+func (c *Client) ChatCompletionStream(ctx context.Context, req *ChatProxyRequest) (*ChatStream, error) {
+	streamed := *req
+	streamed.Stream = true
+	body := jsonBody(&streamed)
+
+	var stream *ChatStream
+	err := c.retry(ctx, true, func() (int, error) {
+		resp, status, err := c.send(ctx, http.MethodPost, "/v1/chat/completions", body, "text/event-stream")
+		if err != nil {
+			return status, err
+		}
+		stream = &ChatStream{body: resp.Body, reader: bufio.NewReader(resp.Body)}
+		stream.RetrievedChunks, _ = strconv.Atoi(resp.Header.Get("X-RAG-Chunks"))
+		if degradations := resp.Header.Get("X-RAG-Degradations"); degradations != "" {
+			stream.Degradations = strings.Split(degradations, ",")
+		}
+		return status, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Recv returns the next chunk of the answer, or io.EOF once the model has finished
+func (s *ChatStream) Recv() (*ChatCompletionChunk, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+
+	// An event is one or more data lines ended by a blank line; other fields and comments are skipped
+	var data bytes.Buffer
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read chat completion stream: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+		}
+		if line != "" && err == nil {
+			continue
+		}
+
+		if data.Len() > 0 {
+			return s.decode(data.Bytes())
+		}
+		if err == io.EOF {
+			s.done = true
+			return nil, io.EOF
+		}
+	}
+}
+
+// decode parses the data of an event, which is a chunk or the [DONE] marker ending the stream
+func (s *ChatStream) decode(data []byte) (*ChatCompletionChunk, error) {
+	if string(data) == "[DONE]" {
+		s.done = true
+		return nil, io.EOF
+	}
+	var chunk ChatCompletionChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil, fmt.Errorf("failed to decode chat completion chunk: %w", err)
+	}
+	return &chunk, nil
+}
+
+// Close releases the connection of the stream
+func (s *ChatStream) Close() error {
+	s.done = true
+	return s.body.Close()
+}
@@ -0,0 +1,751 @@
+package client
+
+import "time"
+
+// HealthResponse is returned by GET /health
+type HealthResponse struct {
+	Status  string            `json:"status"` // "healthy", or "degraded" when a dependency is down
+	Service string            `json:"service"`
+	Checks  []DependencyCheck `json:"checks"`
+
+	ModelServers []ModelServerStatus `json:"model_servers"` // Circuit state of each model server, in failover order
+}
+
+// ModelServerStatus is the circuit state of one model server
+type ModelServerStatus struct {
+	URL                 string     `json:"url"`
+	Circuit             string     `json:"circuit"` // "closed", or "open" while the server is skipped
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// DependencyCheck is the state of one dependency of the server
+type DependencyCheck struct {
+	Name      string `json:"name"` // "database" or "model_server"
+	OK        bool   `json:"ok"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// MessageResponse is returned by endpoints that only confirm an action
+type MessageResponse struct {
+	Message        string `json:"message"`
+	CollectionName string `json:"collection_name,omitempty"`
+	DocumentID     string `json:"document_id,omitempty"`
+}
+
+// CreateCollectionResponse is returned by POST /collections
+type CreateCollectionResponse struct {
+	Message      string              `json:"message"`
+	Name         string              `json:"name"`
+	Description  string              `json:"description"`
+	Defaults     *CollectionDefaults `json:"defaults,omitempty"`
+	Quantization *QuantizationConfig `json:"quantization,omitempty"`
+}
+
+// CollectionSummary is one entry of ListCollectionsResponse
+type CollectionSummary struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"created_at"`
+	DocCount    int    `json:"doc_count"`
+	ChunkCount  int    `json:"chunk_count"`
+}
+
+// ListCollectionsResponse is returned by GET /collections
+type ListCollectionsResponse struct {
+	Collections []CollectionSummary `json:"collections"`
+	Total       int                 `json:"total"` // Collections matching the filters, across all pages
+	Offset      int                 `json:"offset"`
+	Limit       int                 `json:"limit"`
+	HasMore     bool                `json:"has_more"`
+}
+
+// CollectionStats is returned by GET /collections/:name
+type CollectionStats struct {
+	Name          string              `json:"name"`
+	Description   string              `json:"description"`
+	CreatedAt     string              `json:"created_at"`
+	DocumentCount int                 `json:"document_count"`
+	ChunkCount    int                 `json:"chunk_count"`
+	ChunkTypes    map[string]int      `json:"chunk_types"`
+	DocumentTypes map[string]int      `json:"document_types"`
+	Defaults      *CollectionDefaults `json:"defaults,omitempty"`
+	Quantization  *QuantizationConfig `json:"quantization,omitempty"`
+}
+
+// AddDocumentResponse is returned by POST /documents
+type AddDocumentResponse struct {
+	Message               string     `json:"message"`
+	CollectionName        string     `json:"collection_name"`
+	ChunkingStrategy      string     `json:"chunking_strategy"`
+	Status                string     `json:"status"` // "added", "updated" or "unchanged"
+	DocumentID            string     `json:"document_id"`
+	ChunksEmbedded        int        `json:"chunks_embedded"`
+	ChunksReused          int        `json:"chunks_reused"`
+	ChunksDeduplicated    int        `json:"chunks_deduplicated"`
+	ChunksSupplied        int        `json:"chunks_supplied,omitempty"` // Set when the request supplied its chunks
+	ChunksSplit           int        `json:"chunks_split,omitempty"`    // Too large for the embedding model, so embedded in pieces
+	Warning               string     `json:"warning,omitempty"`
+	GraphEntities         int        `json:"graph_entities,omitempty"` // Set when ExtractGraph was requested
+	GraphRelations        int        `json:"graph_relations,omitempty"`
+	GraphFailedChunks     int        `json:"graph_failed_chunks,omitempty"`
+	Summaries             int        `json:"summaries,omitempty"` // Set when SummaryTree was requested
+	SummaryFailures       int        `json:"summary_failures,omitempty"`
+	TablesSummarized      int        `json:"tables_summarized,omitempty"` // Set when SummarizeTables was requested
+	TableSummaryFailures  int        `json:"table_summary_failures,omitempty"`
+	Title                 string     `json:"title,omitempty"` // Set when DocumentSummary was requested
+	Summary               string     `json:"summary,omitempty"`
+	DocumentSummaryFailed bool       `json:"document_summary_failed,omitempty"`
+	QuestionsGenerated    int        `json:"questions_generated,omitempty"` // Set when GenerateQuestions was requested
+	QuestionFailures      int        `json:"question_failures,omitempty"`
+	PagesRecognized       int        `json:"pages_recognized,omitempty"` // Set when OCR read pages of a PDF or image
+	LowConfidenceChunks   int        `json:"low_confidence_chunks,omitempty"`
+	ExpiresAt             *time.Time `json:"expires_at,omitempty"` // Set when the document expires
+	Source                string     `json:"source,omitempty"`
+	FilePath              string     `json:"file_path,omitempty"`
+}
+
+// SyncResult reports one manifest entry, bucket object or deleted document
+type SyncResult struct {
+	Source             string `json:"source"`
+	Status             string `json:"status"` // "added", "updated", "unchanged", "needs_content", "skipped", "deleted" or "failed"
+	DocumentID         string `json:"document_id,omitempty"`
+	ChunksEmbedded     int    `json:"chunks_embedded"`
+	ChunksReused       int    `json:"chunks_reused"`
+	ChunksDeduplicated int    `json:"chunks_deduplicated"`
+	ChunksSplit        int    `json:"chunks_split,omitempty"`
+	Error              string `json:"error,omitempty"`
+}
+
+// SyncResponse is returned by POST /collections/:name/sync
+type SyncResponse struct {
+	CollectionName string         `json:"collection_name"`
+	Results        []SyncResult   `json:"results"`
+	Summary        map[string]int `json:"summary"` // Number of results per status
+}
+
+// S3SyncResponse is returned by POST /collections/:name/sources/s3
+type S3SyncResponse struct {
+	CollectionName string         `json:"collection_name"`
+	Source         string         `json:"source"` // s3://bucket/prefix
+	Results        []SyncResult   `json:"results"`
+	Summary        map[string]int `json:"summary"`
+}
+
+// CrawlResponse is returned by POST /collections/:name/sources/web
+type CrawlResponse struct {
+	CollectionName string         `json:"collection_name"`
+	Source         string         `json:"source"` // Sitemap or seed URL
+	Results        []SyncResult   `json:"results"`
+	Summary        map[string]int `json:"summary"`
+	PagesFetched   int            `json:"pages_fetched"`
+	Truncated      bool           `json:"truncated"` // max_pages was reached; nothing was deleted
+}
+
+// BatchIngestResult reports one document of a bulk ingestion
+type BatchIngestResult struct {
+	Index              int    `json:"index"` // Position of the document in the request
+	Source             string `json:"source,omitempty"`
+	Status             string `json:"status"` // "added", "updated", "unchanged" or "failed"
+	DocumentID         string `json:"document_id,omitempty"`
+	ChunksEmbedded     int    `json:"chunks_embedded"`
+	ChunksReused       int    `json:"chunks_reused"`
+	ChunksDeduplicated int    `json:"chunks_deduplicated"`
+	ChunksSplit        int    `json:"chunks_split,omitempty"`
+	Error              string `json:"error,omitempty"`
+}
+
+// BatchIngestResponse is returned by POST /documents/batch
+type BatchIngestResponse struct {
+	CollectionName string              `json:"collection_name"`
+	Results        []BatchIngestResult `json:"results"`
+	Summary        map[string]int      `json:"summary"` // Number of results per status
+	TotalDocuments int                 `json:"total_documents"`
+}
+
+// ImportResult reports one imported document
+type ImportResult struct {
+	DocumentID string `json:"document_id"`
+	Source     string `json:"source,omitempty"`
+	ChunkCount int    `json:"chunk_count"`
+
+	ChunksEmbedded int `json:"chunks_embedded,omitempty"`
+}
+
+// ImportResponse is returned by POST /documents/import
+type ImportResponse struct {
+	Message        string         `json:"message"`
+	CollectionName string         `json:"collection_name"`
+	Documents      []ImportResult `json:"documents"`
+	TotalDocuments int            `json:"total_documents"`
+	TotalChunks    int            `json:"total_chunks"`
+}
+
+// FrameworkImportResponse is returned by POST /collections/{name}/import
+type FrameworkImportResponse struct {
+	ImportResponse
+	Format         string `json:"format"`
+	ChunksEmbedded int    `json:"chunks_embedded"`
+}
+
+// DocumentSummary is one entry of ListDocumentsResponse
+type DocumentSummary struct {
+	ID                string       `json:"id"`
+	Source            string       `json:"source"`
+	DocType           string       `json:"doc_type"`
+	CreatedAt         string       `json:"created_at"`
+	ChunkCount        int          `json:"chunk_count"`
+	ContentHash       string       `json:"content_hash,omitempty"`
+	ACL               *DocumentACL `json:"acl,omitempty"`
+	ExpiresAt         *time.Time   `json:"expires_at,omitempty"`
+	Title             string       `json:"title,omitempty"`   // Set for documents added with DocumentSummary
+	Summary           string       `json:"summary,omitempty"` // Set for documents added with DocumentSummary
+	FirstChunkCreated string       `json:"first_chunk_created,omitempty"`
+	LastChunkCreated  string       `json:"last_chunk_created,omitempty"`
+}
+
+// ListDocumentsResponse is returned by GET /collections/:name/documents
+type ListDocumentsResponse struct {
+	CollectionName string            `json:"collection_name"`
+	Documents      []DocumentSummary `json:"documents"`
+	Total          int               `json:"total"` // Documents matching the filters, across all pages
+	Offset         int               `json:"offset"`
+	Limit          int               `json:"limit"`
+	HasMore        bool              `json:"has_more"`
+}
+
+// DocumentChunksResponse is returned by GET /documents/:id/chunks
+type DocumentChunksResponse struct {
+	DocumentID string          `json:"document_id"`
+	Chunks     []EnhancedChunk `json:"chunks"`
+	Total      int             `json:"total"`
+}
+
+// UpdateChunkResponse is returned by PATCH /chunks/:id
+type UpdateChunkResponse struct {
+	Message  string        `json:"message"`
+	Chunk    EnhancedChunk `json:"chunk"`
+	Revision int           `json:"revision"`
+}
+
+// SearchChunk is a retrieved chunk with its similarity score
+type SearchChunk struct {
+	ID              string                 `json:"id"`
+	DocumentID      string                 `json:"document_id"`
+	Text            string                 `json:"text"`
+	Section         string                 `json:"section"`
+	Subsection      string                 `json:"subsection"`
+	ChunkType       string                 `json:"chunk_type"`
+	StartPos        int                    `json:"start_pos"`
+	EndPos          int                    `json:"end_pos"`
+	ChunkIndex      int                    `json:"chunk_index"`
+	Keywords        []string               `json:"keywords"`
+	Confidence      float64                `json:"confidence"`
+	SimilarityScore float64                `json:"similarity_score"`
+	RerankedScore   float64                `json:"reranked_score,omitempty"`
+	ParentChunkID   string                 `json:"parent_chunk_id,omitempty"`
+	ChildChunkIDs   []string               `json:"child_chunk_ids,omitempty"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ScoreStatistics summarizes the similarity scores of a search
+type ScoreStatistics struct {
+	MinSimilarity float64 `json:"min_similarity"`
+	MaxSimilarity float64 `json:"max_similarity"`
+	AvgSimilarity float64 `json:"avg_similarity"`
+	TotalScores   int     `json:"total_scores"`
+}
+
+// SearchResponse is returned by POST /search
+type SearchResponse struct {
+	Query           string                 `json:"query"`
+	ExpandedQuery   string                 `json:"expanded_query"`
+	ExpandedQueries []string               `json:"expanded_queries,omitempty"`
+	CollectionName  string                 `json:"collection_name"`
+	ChunksFound     int                    `json:"chunks_found"`
+	Chunks          []SearchChunk          `json:"chunks"`
+	Context         string                 `json:"context"`
+	ContextStrings  []string               `json:"context_strings,omitempty"`
+	Message         string                 `json:"message,omitempty"`
+	ProcessingTime  float64                `json:"processing_time"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+	ScoreStatistics *ScoreStatistics       `json:"score_statistics,omitempty"`
+	Documents       []DocumentGroup        `json:"documents,omitempty"` // Aligned with Chunks when grouped by document
+
+	SuppressedDuplicates []SuppressedDuplicate `json:"suppressed_duplicates,omitempty"` // Chunks left out as near-duplicates
+}
+
+// ChunkAnalysis describes one chunk in an AnalyzeResponse
+type ChunkAnalysis struct {
+	ChunkID         string   `json:"chunk_id"`
+	ChunkType       string   `json:"chunk_type"`
+	Section         string   `json:"section"`
+	Subsection      string   `json:"subsection"`
+	TextLength      int      `json:"text_length"`
+	Keywords        []string `json:"keywords"`
+	SimilarityScore float64  `json:"similarity_score"`
+	RerankedScore   float64  `json:"reranked_score,omitempty"`
+	HasParent       bool     `json:"has_parent,omitempty"`
+	ParentChunkID   string   `json:"parent_chunk_id,omitempty"`
+	ChildCount      int      `json:"child_count,omitempty"`
+}
+
+// AnalyzeResponse is returned by POST /analyze
+type AnalyzeResponse struct {
+	Query                string          `json:"query"`
+	Answer               string          `json:"answer"`
+	ProcessingTime       float64         `json:"processing_time"`
+	ChunksFound          int             `json:"chunks_found"`
+	RerankingApplied     bool            `json:"reranking_applied"`
+	ParentChunksIncluded bool            `json:"parent_chunks_included"`
+	QueryExpansion       bool            `json:"query_expansion"`
+	ChunkAnalysis        []ChunkAnalysis `json:"chunk_analysis,omitempty"`
+}
+
+// StrategyChunk describes one chunk produced by a strategy in CompareChunkingResponse
+type StrategyChunk struct {
+	ID         string   `json:"id"`
+	TextLength int      `json:"text_length"`
+	ChunkType  string   `json:"chunk_type"`
+	Section    string   `json:"section"`
+	Subsection string   `json:"subsection"`
+	Keywords   []string `json:"keywords"`
+	HasParent  bool     `json:"has_parent,omitempty"`
+	ChildCount int      `json:"child_count,omitempty"`
+}
+
+// StrategyResult is the outcome of one chunking strategy
+type StrategyResult struct {
+	Strategy   string          `json:"strategy"`
+	ChunkCount int             `json:"chunk_count"`
+	Chunks     []StrategyChunk `json:"chunks"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// CompareChunkingResponse is returned by POST /compare-chunking
+type CompareChunkingResponse struct {
+	ContentLength int              `json:"content_length"`
+	DocType       string           `json:"doc_type"`
+	Strategies    []StrategyResult `json:"strategies"`
+}
+
+// EvaluationMetrics are the scores of one parameter combination, averaged over the test set
+type EvaluationMetrics struct {
+	HitRate            float64  `json:"hit_rate"`
+	MRR                float64  `json:"mrr"`
+	NDCG               float64  `json:"ndcg"`
+	Faithfulness       *float64 `json:"faithfulness,omitempty"`
+	AnswerF1           *float64 `json:"answer_f1,omitempty"`
+	RetrievalCases     int      `json:"retrieval_cases"`
+	AnswerCases        int      `json:"answer_cases"`
+	FailedCases        int      `json:"failed_cases"`
+	AvgLatencySeconds  float64  `json:"avg_latency_seconds"`
+	ChunksInCollection int      `json:"chunks_in_collection,omitempty"`
+}
+
+// EvaluationCaseResult is the outcome of one test case in one run
+type EvaluationCaseResult struct {
+	Question             string   `json:"question"`
+	RetrievedDocumentIDs []string `json:"retrieved_document_ids"`
+	FirstRelevantRank    int      `json:"first_relevant_rank"`
+	NDCG                 *float64 `json:"ndcg,omitempty"`
+	Answer               string   `json:"answer,omitempty"`
+	Faithfulness         *float64 `json:"faithfulness,omitempty"`
+	AnswerF1             *float64 `json:"answer_f1,omitempty"`
+	Error                string   `json:"error,omitempty"`
+}
+
+// EvaluationRun is the result of one combination of the parameter grid
+type EvaluationRun struct {
+	ChunkingStrategy string                 `json:"chunking_strategy,omitempty"`
+	TopK             int                    `json:"top_k"`
+	RerankerEnabled  bool                   `json:"reranker_enabled"`
+	Metrics          EvaluationMetrics      `json:"metrics"`
+	Cases            []EvaluationCaseResult `json:"cases"`
+}
+
+// EvaluateResponse is returned by POST /evaluate
+type EvaluateResponse struct {
+	CollectionName string          `json:"collection_name"`
+	Cases          int             `json:"cases"`
+	Runs           []EvaluationRun `json:"runs"`
+	ProcessingTime float64         `json:"processing_time"`
+}
+
+// QueryAnalytics is returned by GET /analytics/queries
+type QueryAnalytics struct {
+	CollectionName         string               `json:"collection_name,omitempty"`
+	User                   string               `json:"user,omitempty"`
+	TotalQueries           int                  `json:"total_queries"`
+	ZeroResultCount        int                  `json:"zero_result_count"`
+	NotFoundCount          int                  `json:"not_found_count"`
+	QueriesByEndpoint      map[string]int       `json:"queries_by_endpoint"` // "query", "search" or "chat"
+	AverageLatency         QueryLatency         `json:"average_latency_ms"`
+	TopQueries             []QueryCount         `json:"top_queries"`
+	ZeroResultQueries      []QueryCount         `json:"zero_result_queries"`
+	NotFoundQueries        []QueryCount         `json:"not_found_queries"`
+	MostRetrievedDocuments []DocumentRetrievals `json:"most_retrieved_documents"`
+}
+
+// QueryLatency holds average latencies in milliseconds
+type QueryLatency struct {
+	Retrieval  float64 `json:"retrieval"`
+	Generation float64 `json:"generation"`
+	Total      float64 `json:"total"`
+}
+
+// QueryCount is a query asked repeatedly, ignoring case and whitespace
+type QueryCount struct {
+	Query        string  `json:"query"`
+	Count        int     `json:"count"`
+	ZeroResults  int     `json:"zero_results"`
+	NotFound     int     `json:"not_found"`
+	AverageTotal float64 `json:"average_total_ms"`
+	LastAskedAt  string  `json:"last_asked_at"`
+}
+
+// DocumentRetrievals counts the logged queries that returned chunks of a document
+type DocumentRetrievals struct {
+	DocumentID     string `json:"document_id"`
+	Source         string `json:"source,omitempty"`
+	CollectionName string `json:"collection_name,omitempty"`
+	Queries        int    `json:"queries"`
+}
+
+// UsageReport is returned by GET /usage
+type UsageReport struct {
+	Tenant      string            `json:"tenant"`
+	Usage       QuotaUsage        `json:"usage"`
+	Limits      QuotaLimits       `json:"limits"` // Across all collections of the tenant
+	Collections []CollectionUsage `json:"collections"`
+}
+
+// SystemInfo is returned by GET /system/info
+type SystemInfo struct {
+	Provider       string              `json:"provider"` // "openai" or "ollama"
+	EmbeddingModel EmbeddingModelInfo  `json:"embedding_model"`
+	ChatModel      string              `json:"chat_model"`
+	Checks         []DependencyCheck   `json:"checks"`
+	ModelServers   []ModelServerStatus `json:"model_servers"`
+	Database       DatabaseInfo        `json:"database"`
+	Counts         SystemCounts        `json:"counts"` // What the tenant stores
+}
+
+// EmbeddingModelInfo is the server's embedding model and the dimension of its embeddings
+type EmbeddingModelInfo struct {
+	Name              string     `json:"name"`
+	Dimension         int        `json:"dimension,omitempty"`   // Zero when the model server couldn't be probed
+	ProbedAt          *time.Time `json:"probed_at,omitempty"`   // When the dimension was found
+	ProbeError        string     `json:"probe_error,omitempty"` // Why the dimension is unknown
+	StoredDimension   int        `json:"stored_dimension"`      // Of most of the stored embeddings; 0 before any are stored
+	DimensionMismatch bool       `json:"dimension_mismatch,omitempty"`
+
+	MismatchedCollections []string `json:"mismatched_collections,omitempty"` // Collections to re-embed with the model
+}
+
+// DatabaseInfo describes the server's SQLite database
+type DatabaseInfo struct {
+	SQLiteVersion    string `json:"sqlite_version"`
+	SQLiteVecVersion string `json:"sqlite_vec_version"`
+	SizeBytes        int64  `json:"size_bytes"`
+}
+
+// SystemCounts counts the collections, documents and chunks a tenant stores
+type SystemCounts struct {
+	Collections int64 `json:"collections"`
+	Documents   int64 `json:"documents"`
+	Chunks      int64 `json:"chunks"`
+}
+
+// CollectionUsage is what one collection stores and the quota that applies to it
+type CollectionUsage struct {
+	CollectionName string      `json:"collection_name"`
+	Usage          QuotaUsage  `json:"usage"`
+	Limits         QuotaLimits `json:"limits"`
+}
+
+// QuotaUsage counts what a collection or tenant stores
+type QuotaUsage struct {
+	Documents  int64 `json:"documents"`
+	Characters int64 `json:"characters"`
+	Chunks     int64 `json:"chunks"`
+}
+
+// QuotaLimits are the most a collection or tenant may store; zero or missing limits are unlimited
+type QuotaLimits struct {
+	MaxDocuments  int64 `json:"max_documents,omitempty"`
+	MaxCharacters int64 `json:"max_characters,omitempty"`
+	MaxChunks     int64 `json:"max_chunks,omitempty"`
+}
+
+// ReembedStatus is returned by POST and GET /collections/:name/reembed
+type ReembedStatus struct {
+	CollectionName string `json:"collection_name,omitempty"`
+	Model          string `json:"model"`
+	State          string `json:"state"` // "running", "completed" or "failed"
+	TotalChunks    int    `json:"total_chunks"`
+	EmbeddedChunks int    `json:"embedded_chunks"`
+	Dimension      int    `json:"dimension,omitempty"`
+	StartedAt      string `json:"started_at"`
+	FinishedAt     string `json:"finished_at,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// ReadinessResponse is returned by GET /readyz
+type ReadinessResponse struct {
+	Status string            `json:"status"` // "ready", "warming_up", "warmup_failed", "not_ready" or "shutting_down"
+	Checks []DependencyCheck `json:"checks,omitempty"`
+	Warmup *WarmupStatus     `json:"warmup,omitempty"` // Set while the warm-up runs or after it failed
+}
+
+// WarmupStatus reports the progress of the server's warm-up
+type WarmupStatus struct {
+	State      string       `json:"state"` // "running", "done" or "failed"
+	StartedAt  string       `json:"started_at"`
+	FinishedAt string       `json:"finished_at,omitempty"`
+	Steps      []WarmupStep `json:"steps"`
+}
+
+// WarmupStep is one finished step of the warm-up
+type WarmupStep struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"` // "ok", "failed" or "skipped"
+	DurationMS int64  `json:"duration_ms"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// EmbeddingsResponse is returned by POST /v1/embeddings with the float encoding
+type EmbeddingsResponse struct {
+	Object string          `json:"object"`
+	Data   []Embedding     `json:"data"`
+	Model  string          `json:"model"`
+	Usage  EmbeddingsUsage `json:"usage"`
+}
+
+// Embedding is the embedding of one input, at Index in the request
+type Embedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// EmbeddingMetrics is returned by GET /admin/embeddings
+type EmbeddingMetrics struct {
+	Texts            int64   `json:"texts"`
+	CacheHits        int64   `json:"cache_hits"`
+	CacheHitRate     float64 `json:"cache_hit_rate"`
+	BackendTexts     int64   `json:"backend_texts"`
+	BackendBatches   int64   `json:"backend_batches"`
+	BackendFailures  int64   `json:"backend_failures"`
+	AvgBatchMS       float64 `json:"avg_batch_ms"`
+	EndpointRequests int64   `json:"endpoint_requests"`
+	EndpointInputs   int64   `json:"endpoint_inputs"`
+	EndpointErrors   int64   `json:"endpoint_errors"`
+	Since            string  `json:"since"`
+}
+
+// EncryptionStatus is returned by GET /admin/encryption
+type EncryptionStatus struct {
+	Mode       string         `json:"mode"`
+	CurrentKey string         `json:"current_key,omitempty"`
+	Documents  map[string]int `json:"documents"` // Documents per key ID; "plaintext" counts unencrypted ones
+	Chunks     map[string]int `json:"chunks"`
+	Rotation   *KeyRotation   `json:"rotation,omitempty"`
+}
+
+// KeyRotation describes the latest re-encryption of stored text
+type KeyRotation struct {
+	Status          string               `json:"status"` // "running", "completed", "incomplete" or "failed"
+	Documents       int                  `json:"documents"`
+	Chunks          int                  `json:"chunks"`
+	Failed          int                  `json:"failed"` // Documents and chunks whose text couldn't be re-encrypted
+	FailedDocuments []KeyRotationFailure `json:"failed_documents,omitempty"`
+	FailedChunks    []KeyRotationFailure `json:"failed_chunks,omitempty"`
+	Error           string               `json:"error,omitempty"`
+	StartedAt       string               `json:"started_at"`
+	CompletedAt     string               `json:"completed_at,omitempty"`
+}
+
+// KeyRotationFailure is a document or chunk a key rotation left as it was
+type KeyRotationFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// RoleAssignments is returned by GET /admin/roles
+type RoleAssignments struct {
+	Enabled bool             `json:"enabled"` // Whether the server enforces roles
+	Roles   []RoleAssignment `json:"roles"`
+}
+
+// RoleAssignment is a role granted through the roles API
+type RoleAssignment struct {
+	Kind      string `json:"kind"`    // "api_key", "user" or "claim"
+	Subject   string `json:"subject"` // API keys are listed as "sha256:<hash>"
+	Role      string `json:"role"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// AuditLogResponse is returned by GET /admin/audit
+type AuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"` // Entries matching the filters, across all pages
+	Offset  int          `json:"offset"`
+	Limit   int          `json:"limit"`
+	HasMore bool         `json:"has_more"`
+}
+
+// AuditEntry records one create, update or delete made through the API or by the server itself
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	CreatedAt  string                 `json:"created_at"`
+	Tenant     string                 `json:"tenant,omitempty"`
+	ActorKind  string                 `json:"actor_kind"` // "api_key", "user", "anonymous" or "system"
+	Actor      string                 `json:"actor,omitempty"`
+	ClientIP   string                 `json:"client_ip,omitempty"`
+	Method     string                 `json:"method,omitempty"`
+	Path       string                 `json:"path,omitempty"`
+	Action     string                 `json:"action"` // e.g. "collection.create" or "document.delete"
+	Collection string                 `json:"collection,omitempty"`
+	ResourceID string                 `json:"resource_id,omitempty"`
+	Status     int                    `json:"status"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// WebhookStatus is returned by GET /admin/webhooks
+type WebhookStatus struct {
+	Enabled   bool                    `json:"enabled"`
+	Endpoints []WebhookEndpointStatus `json:"endpoints,omitempty"`
+}
+
+// WebhookEndpointStatus reports the deliveries to one webhook endpoint
+type WebhookEndpointStatus struct {
+	URL             string   `json:"url"`
+	Events          []string `json:"events,omitempty"`
+	Tenant          string   `json:"tenant,omitempty"`
+	Queued          int      `json:"queued"`
+	Delivered       int      `json:"delivered"`
+	Failed          int      `json:"failed"`
+	Dropped         int      `json:"dropped"`
+	LastDeliveredAt string   `json:"last_delivered_at,omitempty"`
+	LastError       string   `json:"last_error,omitempty"`
+	LastErrorAt     string   `json:"last_error_at,omitempty"`
+}
+
+// BackupInfo describes one backup file
+type BackupInfo struct {
+	Name      string `json:"name"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt string `json:"created_at"`
+	Checksum  string `json:"checksum,omitempty"`
+	S3Key     string `json:"s3_key,omitempty"`
+}
+
+// BackupStatus is returned by GET /admin/backup
+type BackupStatus struct {
+	Enabled         bool         `json:"enabled"`
+	Directory       string       `json:"directory,omitempty"`
+	IntervalSeconds int          `json:"interval_seconds,omitempty"`
+	Retain          int          `json:"retain,omitempty"`
+	S3Bucket        string       `json:"s3_bucket,omitempty"`
+	LastBackup      *BackupInfo  `json:"last_backup,omitempty"`
+	LastError       string       `json:"last_error,omitempty"`
+	LastErrorAt     string       `json:"last_error_at,omitempty"`
+	Backups         []BackupInfo `json:"backups"`
+}
+
+// RestoreResponse is returned by POST /admin/restore
+type RestoreResponse struct {
+	Message      string     `json:"message"`
+	Restored     BackupInfo `json:"restored"`
+	SafetyBackup BackupInfo `json:"safety_backup"`
+}
+
+// MaintenanceStep reports one step of a maintenance run
+type MaintenanceStep struct {
+	Name       string `json:"name"`
+	Rows       int64  `json:"rows,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// MaintenanceReport reports a maintenance run
+type MaintenanceReport struct {
+	Trigger         string            `json:"trigger"`
+	StartedAt       string            `json:"started_at"`
+	DurationMS      int64             `json:"duration_ms"`
+	SizeBytesBefore int64             `json:"size_bytes_before"`
+	SizeBytesAfter  int64             `json:"size_bytes_after"`
+	ReclaimedBytes  int64             `json:"reclaimed_bytes"`
+	Steps           []MaintenanceStep `json:"steps"`
+	Error           string            `json:"error,omitempty"`
+}
+
+// MaintenanceStatus is returned by GET /admin/maintenance
+type MaintenanceStatus struct {
+	IntervalSeconds int                `json:"interval_seconds"`
+	Running         bool               `json:"running"`
+	NextRunAt       string             `json:"next_run_at,omitempty"`
+	LastRun         *MaintenanceReport `json:"last_run,omitempty"`
+}
+
+// FsckCheck reports one consistency check of POST /admin/fsck
+type FsckCheck struct {
+	Name     string   `json:"name"`
+	Found    int      `json:"found"`
+	Repaired int64    `json:"repaired,omitempty"`
+	Samples  []string `json:"samples,omitempty"`
+}
+
+// FsckReport is returned by POST /admin/fsck
+type FsckReport struct {
+	Repair     bool        `json:"repair"`
+	Consistent bool        `json:"consistent"`
+	Checks     []FsckCheck `json:"checks"`
+	DurationMS int64       `json:"duration_ms"`
+}
+
+// ReadOnlyStatus is returned by GET and PUT /admin/read-only
+type ReadOnlyStatus struct {
+	ReadOnly  bool   `json:"read_only"`
+	Reason    string `json:"reason,omitempty"`
+	ChangedAt string `json:"changed_at,omitempty"`
+}
+
+// CrawlSiteStatus describes a website crawled on a schedule and the outcome of its last crawl
+type CrawlSiteStatus struct {
+	Collection      string         `json:"collection"`
+	Tenant          string         `json:"tenant,omitempty"`
+	URL             string         `json:"url"`
+	IntervalSeconds int            `json:"interval_seconds"`
+	Running         bool           `json:"running"`
+	LastCrawlAt     string         `json:"last_crawl_at,omitempty"`
+	PagesFetched    int            `json:"pages_fetched"`
+	Truncated       bool           `json:"truncated"`
+	Summary         map[string]int `json:"summary,omitempty"`
+	LastError       string         `json:"last_error,omitempty"`
+	LastErrorAt     string         `json:"last_error_at,omitempty"`
+}
+
+// CrawlerStatus is returned by GET /admin/crawler
+type CrawlerStatus struct {
+	Enabled bool              `json:"enabled"`
+	Sites   []CrawlSiteStatus `json:"sites"`
+}
+
+// ReplicationStatus is returned by GET /admin/replication
+type ReplicationStatus struct {
+	Enabled           bool   `json:"enabled"`
+	Mode              string `json:"mode,omitempty"`
+	Target            string `json:"target,omitempty"`
+	IntervalSeconds   int    `json:"interval_seconds,omitempty"`
+	LastSnapshotAt    string `json:"last_snapshot_at,omitempty"`
+	LastShippedAt     string `json:"last_shipped_at,omitempty"`
+	LastChecksum      string `json:"last_checksum,omitempty"`
+	LastSnapshotBytes int64  `json:"last_snapshot_bytes,omitempty"`
+	SnapshotsShipped  int    `json:"snapshots_shipped"`
+	LastError         string `json:"last_error,omitempty"`
+	LastErrorAt       string `json:"last_error_at,omitempty"`
+}
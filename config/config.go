@@ -13,6 +13,427 @@ type Config struct {
 	ChatModel       string `json:"chat_model"`
 	VectorDBPath    string `json:"vector_db_path"` // For SQLite
 	DefaultTopK     int    `json:"default_top_k"`
+
+	// LlamaCPPFailoverURLs are tried in order when the server at LlamaCPPBaseURL keeps failing.
+	// They must speak the same provider API and serve the same models.
+	LlamaCPPFailoverURLs []string `json:"llamacpp_failover_urls"`
+
+	// Provider selects the API spoken by the model server at LlamaCPPBaseURL: "openai"
+	// (OpenAI-compatible, e.g. llama.cpp) or "ollama" (Ollama's native API)
+	Provider string `json:"provider"`
+
+	// EmbeddingConcurrency is the number of embedding batches sent in parallel (1 = serial)
+	EmbeddingConcurrency int `json:"embedding_concurrency"`
+
+	// Resilience retries failed calls to the model servers and stops calling a failing one for a while
+	Resilience ResilienceConfig `json:"resilience"`
+
+	// Degradation controls how queries behave when a backend is unavailable
+	Degradation DegradationPolicy `json:"degradation"`
+
+	// Replication ships database snapshots to a warm standby
+	Replication ReplicationConfig `json:"replication"`
+
+	// Tenancy scopes collections, documents and chunks to the tenant of each request
+	Tenancy TenancyConfig `json:"tenancy"`
+
+	// Limits throttles clients and caps request body sizes
+	Limits LimitsConfig `json:"limits"`
+
+	// Quotas caps how many documents, characters and chunks collections and tenants may store
+	Quotas QuotaConfig `json:"quotas"`
+
+	// Timeouts bounds each call to the model server and database
+	Timeouts TimeoutsConfig `json:"timeouts"`
+
+	// ChatProxy configures the OpenAI-compatible /v1/chat/completions endpoint
+	ChatProxy ChatProxyConfig `json:"chat_proxy"`
+
+	// Webhooks notifies other systems when documents and collections change
+	Webhooks WebhooksConfig `json:"webhooks"`
+
+	// QueryLog records queries for the analytics endpoint
+	QueryLog QueryLogConfig `json:"query_log"`
+
+	// OCR reads scanned PDFs and PNG and JPEG images added as files
+	OCR OCRConfig `json:"ocr"`
+
+	// Transcription turns audio files added by path into timestamped transcripts
+	Transcription TranscriptionConfig `json:"transcription"`
+
+	// Expiry deletes documents added with expires_at or ttl_seconds once they expire
+	Expiry ExpiryConfig `json:"expiry"`
+
+	// Backup takes consistent copies of the database on demand and on a schedule
+	Backup BackupConfig `json:"backup"`
+
+	// Maintenance compacts the database and rebuilds its indexes on a schedule
+	Maintenance MaintenanceConfig `json:"maintenance"`
+
+	// Crawler fetches websites into collections, on request and on a schedule
+	Crawler CrawlerConfig `json:"crawler"`
+
+	// S3Sources controls the buckets collections are synced from
+	S3Sources S3SourcesConfig `json:"s3_sources"`
+
+	// Encryption encrypts document and chunk text, or the whole database, at rest
+	Encryption EncryptionConfig `json:"encryption"`
+
+	// TLS serves HTTPS directly, optionally requiring client certificates
+	TLS TLSConfig `json:"tls"`
+
+	// Authorization restricts API routes by role: reader, writer or admin
+	Authorization AuthorizationConfig `json:"authorization"`
+
+	// Warmup prepares the database and models after the server starts, before it reports ready
+	Warmup WarmupConfig `json:"warmup"`
+
+	// ANNIndex keeps in-memory HNSW indexes of frequently queried collections
+	ANNIndex ANNIndexConfig `json:"ann_index"`
+
+	// Profiling exposes Go's runtime profiles and memory statistics
+	Profiling ProfilingConfig `json:"profiling"`
+
+	// Tracing exports traces of API requests and their query stages over OTLP
+	Tracing TracingConfig `json:"tracing"`
+
+	// DeterministicIDs derives document and chunk IDs from each document's source and content,
+	// for every ingestion, so repeated ingestion of the same content is idempotent
+	DeterministicIDs bool `json:"deterministic_ids"`
+
+	// ReadOnly refuses every request that would change what is stored, for disaster recovery
+	// replicas and maintenance windows. Admins can switch it at runtime until the next restart.
+	ReadOnly bool `json:"read_only"`
+}
+
+// DegradationPolicy defines which fallbacks are allowed when a provider is down.
+// Every fallback that is applied is reported in the response metadata.
+type DegradationPolicy struct {
+	SkipReranker      bool `json:"skip_reranker"`      // Skip re-ranking if the reranker fails
+	ExtractiveAnswers bool `json:"extractive_answers"` // Return verbatim passages if the chat model is down
+	LexicalSearch     bool `json:"lexical_search"`     // Use keyword-only search if the embedding server is down
+}
+
+// ResilienceConfig controls how calls to a model server survive transient failures. Connection
+// errors and 5xx responses are retried with exponential backoff. A server failing BreakerThreshold
+// calls in a row is skipped, in favour of the next failover URL, until BreakerCooldownSeconds have
+// passed; then one trial call decides whether it is used again.
+type ResilienceConfig struct {
+	MaxRetries             int `json:"max_retries"`              // Retries per server after the first attempt
+	InitialBackoffMS       int `json:"initial_backoff_ms"`       // Wait before the first retry; doubles with every further retry
+	MaxBackoffMS           int `json:"max_backoff_ms"`           // Longest wait between retries
+	BreakerThreshold       int `json:"breaker_threshold"`        // Consecutive failures that open a server's circuit; 0 disables the breaker
+	BreakerCooldownSeconds int `json:"breaker_cooldown_seconds"` // How long an open circuit skips the server
+}
+
+// ReplicationConfig controls warm standby replication of the SQLite database.
+// Each interval a consistent snapshot is taken. "file" and "follower" ship it whole; "s3" splits
+// it into segments and uploads only the segments that changed since the last snapshot.
+type ReplicationConfig struct {
+	Enabled         bool   `json:"enabled"`
+	Mode            string `json:"mode"`             // "file", "follower" or "s3"
+	TargetPath      string `json:"target_path"`      // Destination file for "file" mode
+	FollowerURL     string `json:"follower_url"`     // Base URL of the standby instance for "follower" mode
+	FollowerAPIKey  string `json:"follower_api_key"` // Admin API key of the follower, when it enforces roles
+	IntervalSeconds int    `json:"interval_seconds"` // How often a snapshot is taken
+	StandbyPath     string `json:"standby_path"`     // Where this instance stores snapshots received as a follower or pulled from S3
+
+	MaxSnapshotBytes int64 `json:"max_snapshot_bytes"` // Largest snapshot accepted as a follower; 0 disables the limit
+
+	S3 S3Config `json:"s3"` // Bucket and prefix snapshots are shipped to in "s3" mode
+}
+
+// TenancyConfig controls how API requests are mapped to tenants. When disabled, all data belongs
+// to the default tenant. When API keys are configured, the tenant comes from the key and a bare
+// X-Tenant-ID header is no longer trusted.
+type TenancyConfig struct {
+	Enabled       bool              `json:"enabled"`
+	RequireTenant bool              `json:"require_tenant"` // Reject requests without a tenant instead of using the default tenant
+	APIKeys       map[string]string `json:"api_keys"`       // API key -> tenant ID
+}
+
+// LimitsConfig controls per-client rate limiting and request body size limits. Clients are
+// identified by API key when authorization or tenancy validates the one they send, otherwise by IP. Ingestion (adding, syncing and
+// importing documents) has its own budget so bulk loads cannot starve interactive queries, and a
+// cap on how much of it runs at once across all clients, so the embedding backend isn't overrun.
+type LimitsConfig struct {
+	RateLimitEnabled        bool    `json:"rate_limit_enabled"`
+	RequestsPerSecond       float64 `json:"requests_per_second"`        // Sustained rate of query and management requests per client
+	Burst                   int     `json:"burst"`                      // Requests a client may send at once before being throttled
+	IngestRequestsPerSecond float64 `json:"ingest_requests_per_second"` // Sustained rate of ingestion requests per client
+	IngestBurst             int     `json:"ingest_burst"`
+	MaxBodyBytes            int64   `json:"max_body_bytes"`        // Largest accepted request body; 0 disables the limit
+	MaxImportBodyBytes      int64   `json:"max_import_body_bytes"` // Limit for /documents/import, which carries embeddings
+
+	// Ingestion requests beyond the cap wait in a queue; a full queue or a long wait gets 503
+	MaxConcurrentIngestions   int `json:"max_concurrent_ingestions"`    // Ingestion requests run at once; 0 removes the cap
+	IngestQueueSize           int `json:"ingest_queue_size"`            // Requests that may wait for a slot
+	IngestQueueTimeoutSeconds int `json:"ingest_queue_timeout_seconds"` // Longest wait for a slot; 0 waits as long as the client does
+}
+
+// QuotaConfig caps what ingestion may store, so a runaway client can't fill the disk. Collection
+// limits apply to each collection and tenant limits to all collections of a tenant together; the
+// entries for a named collection or tenant override the limits they set. A zero limit is unlimited.
+type QuotaConfig struct {
+	Collection  QuotaLimits            `json:"collection"`  // Limits of every collection
+	Tenant      QuotaLimits            `json:"tenant"`      // Limits of every tenant
+	Collections map[string]QuotaLimits `json:"collections"` // By collection name
+	Tenants     map[string]QuotaLimits `json:"tenants"`     // By tenant ID
+}
+
+// QuotaLimits are the most a collection or tenant may store
+type QuotaLimits struct {
+	MaxDocuments  int64 `json:"max_documents,omitempty"`
+	MaxCharacters int64 `json:"max_characters,omitempty"` // Characters of document content
+	MaxChunks     int64 `json:"max_chunks,omitempty"`     // Including summary and question chunks
+}
+
+// TimeoutsConfig bounds each stage of a request, in seconds; 0 leaves a stage limited only by the
+// HTTP client's 180 s timeout. Every stage is also cancelled as soon as the client disconnects.
+type TimeoutsConfig struct {
+	EmbeddingSeconds int `json:"embedding_seconds"` // Per embedding request to the model server
+	ChatSeconds      int `json:"chat_seconds"`      // Per chat completion
+	SearchSeconds    int `json:"search_seconds"`    // Per vector or keyword search in the database
+	ShutdownSeconds  int `json:"shutdown_seconds"`  // Time in-flight requests get to finish after SIGTERM
+}
+
+// ChatProxyConfig controls the OpenAI-compatible chat completions endpoint, which retrieves context
+// for the latest user message before forwarding the conversation to the chat model.
+type ChatProxyConfig struct {
+	Collection string `json:"collection"` // Searched when a request names no collection in its "rag" field
+
+	// AllowedOrigins lists the origins, such as "https://chat.example.com", of other sites whose
+	// pages may open /ws/chat sessions; "*" allows any. Pages served by this server always may.
+	AllowedOrigins []string `json:"allowed_origins"`
+
+	// A /ws/chat session sends at most HistoryTurns earlier questions and answers with each
+	// question, and fewer when they would exceed about HistoryTokens tokens; the oldest are dropped
+	// first. 0 uses the defaults of 20 turns and 8000 tokens.
+	HistoryTurns  int `json:"history_turns"`
+	HistoryTokens int `json:"history_tokens"`
+}
+
+// WebhooksConfig lists the endpoints that receive a signed POST for each document and collection
+// event. Events are delivered in the background, retried with exponential backoff, and dropped
+// once the attempts run out.
+type WebhooksConfig struct {
+	Endpoints      []WebhookEndpoint `json:"endpoints"`
+	TimeoutSeconds int               `json:"timeout_seconds"` // Per delivery attempt
+	MaxAttempts    int               `json:"max_attempts"`    // Deliveries tried per event before it is dropped
+}
+
+// WebhookEndpoint is a URL receiving events, signed with its own secret
+type WebhookEndpoint struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`           // HMAC-SHA256 key of the X-Webhook-Signature header
+	Events []string `json:"events,omitempty"` // Event types to send; empty sends every type
+	Tenant string   `json:"tenant,omitempty"` // Only send events of this tenant; empty sends every tenant's
+}
+
+// QueryLogConfig controls the log of queries, searches and proxied chats kept for analytics
+type QueryLogConfig struct {
+	Enabled       bool `json:"enabled"`
+	RetentionDays int  `json:"retention_days"` // Entries older than this are deleted; 0 keeps them forever
+}
+
+// OCRConfig controls text recognition for files added by path. PDF pages with a text layer are read
+// with pdftotext; the others are rendered with pdftoppm (both from poppler-utils) and recognised by
+// the engine, like PNG and JPEG images. Pages recognised below MinConfidence are flagged on their chunks.
+type OCRConfig struct {
+	Enabled        bool    `json:"enabled"`
+	Engine         string  `json:"engine"`          // "tesseract" (local binary) or "api" (HTTP OCR service)
+	TesseractPath  string  `json:"tesseract_path"`  // Tesseract executable
+	Languages      string  `json:"languages"`       // Tesseract language codes, e.g. "eng+deu"
+	APIURL         string  `json:"api_url"`         // Receives each page image as a POST body for the "api" engine
+	APIKey         string  `json:"api_key"`         // Sent as a bearer token to APIURL when set
+	PDFToTextPath  string  `json:"pdftotext_path"`  // Extracts the text layer of PDF pages
+	PDFToPPMPath   string  `json:"pdftoppm_path"`   // Renders PDF pages without a text layer to images
+	DPI            int     `json:"dpi"`             // Resolution PDF pages are rendered at
+	MinConfidence  float64 `json:"min_confidence"`  // 0-100; pages recognised below it are flagged
+	TimeoutSeconds int     `json:"timeout_seconds"` // Per page
+}
+
+// TranscriptionConfig controls transcribing audio with a Whisper-compatible /audio/transcriptions
+// endpoint. The transcript's segments become timestamped chunks, like an uploaded SRT or VTT file.
+type TranscriptionConfig struct {
+	Enabled        bool   `json:"enabled"`
+	BaseURL        string `json:"base_url"`        // Defaults to llamacpp_base_url
+	Model          string `json:"model"`           // e.g. "whisper-1"
+	APIKey         string `json:"api_key"`         // Sent as a bearer token when set
+	Language       string `json:"language"`        // ISO 639-1 hint; empty lets the model detect the language
+	TimeoutSeconds int    `json:"timeout_seconds"` // Per audio file
+}
+
+// ExpiryConfig controls the background sweep that deletes expired documents
+type ExpiryConfig struct {
+	SweepIntervalSeconds int `json:"sweep_interval_seconds"` // How often expired documents are deleted; 0 disables the sweep
+}
+
+// BackupConfig controls backups of the SQLite database. Each backup is a consistent copy written
+// to Directory and, when a bucket is set, uploaded to S3 or an S3-compatible store.
+type BackupConfig struct {
+	Directory       string   `json:"directory"`        // Where backups are written and restored from
+	IntervalSeconds int      `json:"interval_seconds"` // How often a backup is taken automatically; 0 disables the schedule
+	Retain          int      `json:"retain"`           // Backups kept in Directory, the oldest are deleted first; 0 keeps all
+	S3              S3Config `json:"s3"`
+}
+
+// S3Config is the bucket backups, or replicated snapshots in "s3" mode, are uploaded to. Bucket
+// lifecycle rules decide how long backups are kept.
+type S3Config struct {
+	Bucket          string `json:"bucket"`   // Uploads are disabled when empty
+	Prefix          string `json:"prefix"`   // Prepended to the object names, e.g. "rag/"
+	Region          string `json:"region"`   // Signing region
+	Endpoint        string `json:"endpoint"` // Defaults to AWS S3 for the region; set for MinIO and other compatible stores
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token,omitempty"` // For temporary credentials
+}
+
+// MaintenanceConfig controls the scheduled maintenance that prunes orphaned embeddings, rebuilds
+// the full-text and ANN indexes, refreshes the query planner's statistics and vacuums the database
+type MaintenanceConfig struct {
+	IntervalSeconds int `json:"interval_seconds"` // How often maintenance runs automatically; 0 disables the schedule
+}
+
+// CrawlerConfig controls how websites are fetched and which are crawled on a schedule
+type CrawlerConfig struct {
+	UserAgent      string      `json:"user_agent"`       // Sent with every request and matched against robots.txt groups
+	RequestDelayMS int         `json:"request_delay_ms"` // Pause between requests to a host; a longer robots.txt Crawl-delay wins
+	TimeoutSeconds int         `json:"timeout_seconds"`  // Per page request
+	MaxPageBytes   int64       `json:"max_page_bytes"`   // Larger pages are not ingested
+	Sites          []CrawlSite `json:"sites"`
+
+	// AllowPrivateNetworks lets crawls reach loopback, private and link-local addresses, such as
+	// intranet sites. It is off because any writer can start a crawl and read back what it fetched.
+	AllowPrivateNetworks bool `json:"allow_private_networks"`
+}
+
+// S3SourcesConfig controls syncing collections from S3-compatible buckets. Writers choose the
+// endpoint of a sync, so only public endpoints may be used unless they are listed here.
+type S3SourcesConfig struct {
+	PrivateEndpoints []string `json:"private_endpoints"` // Endpoints on private networks, e.g. "http://minio:9000"
+}
+
+// CrawlSite is a website crawled into a collection every IntervalSeconds, starting when the server starts
+type CrawlSite struct {
+	Collection      string   `json:"collection"`
+	Tenant          string   `json:"tenant,omitempty"` // Owner of the collection when tenancy is enabled
+	SitemapURL      string   `json:"sitemap_url,omitempty"`
+	SeedURL         string   `json:"seed_url,omitempty"`
+	MaxDepth        int      `json:"max_depth,omitempty"`
+	MaxPages        int      `json:"max_pages,omitempty"`
+	AllowedDomains  []string `json:"allowed_domains,omitempty"`
+	PathPrefix      string   `json:"path_prefix,omitempty"`
+	DeleteMissing   bool     `json:"delete_missing,omitempty"`
+	IntervalSeconds int      `json:"interval_seconds"`
+}
+
+// EncryptionConfig controls encryption at rest. The "columns" mode seals document content and
+// chunk text with AES-256-GCM and indexes keyword search on keyed hashes of words; everything else,
+// such as titles, summaries and other metadata, keywords, the knowledge graph, the query log and
+// embeddings, stays readable. The "sqlcipher" mode encrypts the whole file, embeddings
+// included, and needs the server linked against SQLCipher. Keys are 32 random bytes, base64-encoded.
+// To rotate, make the new key current and move the old one to PreviousKeys until stored text is
+// re-encrypted.
+type EncryptionConfig struct {
+	Mode         string   `json:"mode"`          // "columns", "sqlcipher" or "" to store text unencrypted
+	Key          string   `json:"key"`           // Current key; new text is encrypted with it
+	KeyFile      string   `json:"key_file"`      // File holding the current key, read instead of Key
+	PreviousKeys []string `json:"previous_keys"` // Older keys, still used to read text encrypted with them
+}
+
+// TLSConfig serves HTTPS instead of HTTP when CertFile and KeyFile are set. The files are read
+// again when they change, so renewed certificates are picked up without a restart. With
+// ClientCAFile, clients must present a certificate signed by one of its CAs (mutual TLS); the
+// liveness and readiness probes stay open so orchestrators can reach them without one.
+type TLSConfig struct {
+	CertFile     string `json:"cert_file"`      // PEM server certificate, followed by any intermediates
+	KeyFile      string `json:"key_file"`       // PEM private key of the server certificate
+	ClientCAFile string `json:"client_ca_file"` // PEM CA certificates client certificates must chain to; enables mTLS
+	ClientAuth   string `json:"client_auth"`    // "require" (default with ClientCAFile) or "verify_if_given"
+	MinVersion   string `json:"min_version"`    // "1.2" (default) or "1.3"
+}
+
+// WarmupConfig controls the warm-up run when the server starts. It verifies the database, indexes
+// chunks missing from the keyword index and reads collection statistics and stored embeddings, so
+// the first queries don't wait on the disk. Readiness probes fail until it completes.
+type WarmupConfig struct {
+	Skip            bool `json:"skip"`             // Report ready without warming up
+	VerifyIntegrity bool `json:"verify_integrity"` // Run SQLite's quick_check; slow on large databases
+	LoadModels      bool `json:"load_models"`      // Embed a text and generate a token, so the model server loads both models
+	TimeoutSeconds  int  `json:"timeout_seconds"`  // Steps still left after this are skipped; defaults to 300
+}
+
+// ANNIndexConfig lists the collections whose embeddings are also kept in an in-memory HNSW graph.
+// Vector searches of those collections walk the graph for candidates instead of scanning every
+// stored embedding; sqlite-vec stays the source of truth and answers while a graph is built.
+// Each vector takes its dimension times 4 bytes of memory, plus its links.
+type ANNIndexConfig struct {
+	Collections    []ANNCollection `json:"collections"`
+	M              int             `json:"m"`               // Links per node; defaults to 16
+	EfConstruction int             `json:"ef_construction"` // Candidates considered when linking a vector; defaults to 100
+	EfSearch       int             `json:"ef_search"`       // Candidates considered by a search; defaults to 64
+}
+
+// ANNCollection names a collection to index
+type ANNCollection struct {
+	Collection string `json:"collection"`
+	Tenant     string `json:"tenant,omitempty"` // Defaults to the default tenant
+}
+
+// ProfilingConfig serves the profiles of net/http/pprof and the memory statistics of expvar, to
+// investigate CPU use and memory growth. Both are off by default, since profiles reveal the
+// server's internals and taking one slows it down.
+type ProfilingConfig struct {
+	Enabled       bool   `json:"enabled"`        // Serve them under /api/v1/admin/debug, to admins; needs authorization enabled
+	ListenAddress string `json:"listen_address"` // Also serve them on this loopback address without authentication, e.g. "127.0.0.1:6060"
+}
+
+// TracingConfig exports OpenTelemetry traces to a collector over OTLP/HTTP, such as the
+// OpenTelemetry Collector, Jaeger or Grafana Tempo. Each API request is a trace, with spans for
+// the query, retrieval, each vector search, embedding call and chat completion, so a slow query
+// shows which stage took the time. Callers sending a W3C traceparent header get the spans added
+// to their own trace.
+type TracingConfig struct {
+	Enabled     bool              `json:"enabled"`
+	Endpoint    string            `json:"endpoint"`     // Base URL of the collector's OTLP/HTTP receiver, e.g. "http://localhost:4318"; spans go to /v1/traces
+	Headers     map[string]string `json:"headers"`      // Sent with every export, e.g. the authorization of a hosted collector
+	ServiceName string            `json:"service_name"` // Defaults to "rag-go-app"
+	SampleRatio float64           `json:"sample_ratio"` // Share of new traces exported, between 0 and 1; defaults to 1. Callers' sampling decisions are followed.
+}
+
+// AuthorizationConfig enforces roles on the API routes. Readers may query and search, writers may
+// also ingest and change documents, and admins may also delete collections and use the /admin
+// routes. Callers authenticate with an API key or a JWT bearer token. Roles come from
+// APIKeyRoles, from the role claim of a JWT, and from assignments stored in the database through
+// the roles API; the highest one applies.
+type AuthorizationConfig struct {
+	Enabled        bool              `json:"enabled"`
+	APIKeyRoles    map[string]string `json:"api_key_roles"`    // API key -> role; use it to create the first admin
+	AnonymousRole  string            `json:"anonymous_role"`   // Role of requests without credentials; "" rejects them
+	TokenRole      string            `json:"token_role"`       // Role of verified JWTs granted none, e.g. "reader" for every SSO user; "" rejects them
+	DisableAPIKeys bool              `json:"disable_api_keys"` // Accept only JWTs
+	JWT            JWTConfig         `json:"jwt"`
+}
+
+// JWTConfig verifies JWT bearer tokens, such as the ID or access tokens of an OIDC provider.
+// Tokens are signed with HS256 using Secret, or with RS256 or ES256 using the public key in
+// PublicKeyFile or the keys published at JWKSURL. With none of them set, the JWKS of Issuer is
+// found through OIDC discovery. Published keys are fetched again every JWKSRefreshSeconds, and
+// sooner when a token names a key not seen yet. Tokens must not be expired and must match Issuer
+// and Audience when those are set.
+type JWTConfig struct {
+	Secret             string `json:"secret"`          // Shared HS256 secret
+	PublicKeyFile      string `json:"public_key_file"` // PEM RSA or ECDSA public key
+	JWKSURL            string `json:"jwks_url"`        // JSON Web Key Set of the token issuer
+	JWKSRefreshSeconds int    `json:"jwks_refresh_seconds"`
+	Issuer             string `json:"issuer"` // Required iss claim, and the OIDC discovery URL
+	Audience           string `json:"audience"`
+	RoleClaim          string `json:"role_claim"`   // Claim holding role names or values assigned roles, a string or a list; defaults to "roles"
+	TenantClaim        string `json:"tenant_claim"` // Claim holding the tenant when tenancy is enabled; defaults to "tenant"
+	UserClaim          string `json:"user_claim"`   // Claim identifying the user for ACLs, role assignments and the query log; defaults to "sub"
+	GroupsClaim        string `json:"groups_claim"` // Claim listing the user's groups for ACLs; defaults to "groups"
 }
 
 var AppConfig Config
@@ -36,11 +457,116 @@ func LoadConfig(path string) error {
 
 func DefaultConfig() Config {
 	return Config{
-		ServerPort:      "8080",                     // Gin server port
-		LlamaCPPBaseURL: "http://localhost:8091/v1", // Your OpenAI-compatible API
-		EmbeddingModel:  "nomic-embed-text-v1.5",    // Specify model if LlamaCPP needs it
-		ChatModel:       "qwen3:8b",                 // Specify model for LlamaCPP
-		VectorDBPath:    "./rag_database.db",
-		DefaultTopK:     3,
+		ServerPort:           "8080",                     // Gin server port
+		LlamaCPPBaseURL:      "http://localhost:8091/v1", // Your OpenAI-compatible API
+		Provider:             "openai",                   // Or "ollama" with e.g. http://localhost:11434
+		EmbeddingModel:       "nomic-embed-text-v1.5",    // Specify model if LlamaCPP needs it
+		ChatModel:            "qwen3:8b",                 // Specify model for LlamaCPP
+		VectorDBPath:         "./rag_database.db",
+		DefaultTopK:          3,
+		EmbeddingConcurrency: 4,
+		Resilience: ResilienceConfig{
+			MaxRetries:             3,
+			InitialBackoffMS:       500,
+			MaxBackoffMS:           8000,
+			BreakerThreshold:       5,
+			BreakerCooldownSeconds: 30,
+		},
+		Degradation: DegradationPolicy{
+			SkipReranker:      true,
+			ExtractiveAnswers: true,
+			LexicalSearch:     true,
+		},
+		Replication: ReplicationConfig{
+			Mode:            "file",
+			IntervalSeconds: 30,
+			StandbyPath:     "./rag_database.standby.db",
+
+			MaxSnapshotBytes: 4 << 30, // 4 GiB
+		},
+		Limits: LimitsConfig{
+			RequestsPerSecond:       10,
+			Burst:                   20,
+			IngestRequestsPerSecond: 2,
+			IngestBurst:             5,
+			MaxBodyBytes:            10 << 20,  // 10 MiB
+			MaxImportBodyBytes:      512 << 20, // 512 MiB
+
+			MaxConcurrentIngestions:   4,
+			IngestQueueSize:           32,
+			IngestQueueTimeoutSeconds: 120,
+		},
+		Timeouts: TimeoutsConfig{
+			EmbeddingSeconds: 60,
+			ChatSeconds:      120,
+			SearchSeconds:    10,
+			ShutdownSeconds:  25,
+		},
+		Webhooks: WebhooksConfig{
+			TimeoutSeconds: 10,
+			MaxAttempts:    5,
+		},
+		ChatProxy: ChatProxyConfig{
+			HistoryTurns:  20,
+			HistoryTokens: 8000,
+		},
+		QueryLog: QueryLogConfig{
+			Enabled:       true,
+			RetentionDays: 30,
+		},
+		OCR: OCRConfig{
+			Engine:         "tesseract",
+			TesseractPath:  "tesseract",
+			Languages:      "eng",
+			PDFToTextPath:  "pdftotext",
+			PDFToPPMPath:   "pdftoppm",
+			DPI:            300,
+			MinConfidence:  60,
+			TimeoutSeconds: 120,
+		},
+		Transcription: TranscriptionConfig{
+			Model:          "whisper-1",
+			TimeoutSeconds: 600,
+		},
+		Expiry: ExpiryConfig{
+			SweepIntervalSeconds: 60,
+		},
+		Backup: BackupConfig{
+			Directory: "./backups",
+			Retain:    7,
+			S3: S3Config{
+				Region: "us-east-1",
+			},
+		},
+		Maintenance: MaintenanceConfig{
+			IntervalSeconds: 86400,
+		},
+		Crawler: CrawlerConfig{
+			UserAgent:      "rag-go-crawler/1.0",
+			RequestDelayMS: 500,
+			TimeoutSeconds: 30,
+			MaxPageBytes:   5 << 20, // 5 MiB
+		},
+		Authorization: AuthorizationConfig{
+			JWT: JWTConfig{
+				JWKSRefreshSeconds: 3600,
+				RoleClaim:          "roles",
+				TenantClaim:        "tenant",
+				UserClaim:          "sub",
+				GroupsClaim:        "groups",
+			},
+		},
+		Warmup: WarmupConfig{
+			TimeoutSeconds: 300,
+		},
+		ANNIndex: ANNIndexConfig{
+			M:              16,
+			EfConstruction: 100,
+			EfSearch:       64,
+		},
+		Tracing: TracingConfig{
+			ServiceName: "rag-go-app",
+			SampleRatio: 1,
+		},
 	}
 }
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"rag-go-app/models"
+	"strings"
+)
+
+// principalFilter is the filters key Retrieve puts the query's principal under. buildFilterConditions
+// only honours a *models.Principal there, so metadata_filters cannot set it.
+const principalFilter = "principal"
+
+// marshalACL serializes an ACL for the documents.acl column; a nil ACL is stored as NULL
+func marshalACL(acl *models.DocumentACL) (interface{}, error) {
+	if acl == nil {
+		return nil, nil
+	}
+	aclBytes, err := json.Marshal(acl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize ACL: %w", err)
+	}
+	return string(aclBytes), nil
+}
+
+// parseACL reads a documents.acl column back, returning nil for documents everyone may see
+func parseACL(aclJSON *string) *models.DocumentACL {
+	if aclJSON == nil {
+		return nil
+	}
+	acl := &models.DocumentACL{}
+	if err := json.Unmarshal([]byte(*aclJSON), acl); err != nil {
+		// An unreadable ACL grants nothing rather than everything
+		return &models.DocumentACL{}
+	}
+	return acl
+}
+
+// aclCondition restricts the enhanced_chunks alias "c" to chunks of documents without an ACL or
+// whose ACL lists the principal's user or one of their groups
+func aclCondition(principal *models.Principal) (string, []interface{}) {
+	condition, args := documentACLCondition(principal)
+	return "c.document_id IN (SELECT d.id FROM documents d WHERE " + condition + ")", args
+}
+
+// documentACLCondition restricts the documents alias "d" to documents without an ACL or whose ACL
+// lists the principal's user or one of their groups
+func documentACLCondition(principal *models.Principal) (string, []interface{}) {
+	allowed := []string{"d.acl IS NULL"}
+	var args []interface{}
+	if principal.User != "" {
+		allowed = append(allowed, "EXISTS (SELECT 1 FROM json_each(d.acl, '$.users') WHERE value = ?)")
+		args = append(args, principal.User)
+	}
+	if len(principal.Groups) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(principal.Groups)), ",")
+		allowed = append(allowed, "EXISTS (SELECT 1 FROM json_each(d.acl, '$.groups') WHERE value IN ("+placeholders+"))")
+		for _, group := range principal.Groups {
+			args = append(args, group)
+		}
+	}
+	return "(" + strings.Join(allowed, " OR ") + ")", args
+}
+
+// SetDocumentACL replaces the ACL of a stored document; nil makes it visible to everyone
+func (db *VectorDB) SetDocumentACL(documentID string, acl *models.DocumentACL) error {
+	aclJSON, err := marshalACL(acl)
+	if err != nil {
+		return err
+	}
+	result, err := db.conn.Exec(`UPDATE documents SET acl = ? WHERE id = ? AND tenant_id = ?`, aclJSON, documentID, db.tenant)
+	if err != nil {
+		return fmt.Errorf("failed to update document ACL: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("document '%s' not found", documentID)
+	}
+	return nil
+}
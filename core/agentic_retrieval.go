@@ -0,0 +1,195 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"strings"
+)
+
+const defaultAgentIterations = 4
+
+// Actions of agentic retrieval steps
+const (
+	AgentSearch = "search" // The model asked for a search
+	AgentAnswer = "answer" // The model found the contexts sufficient
+	AgentStop   = "stop"   // The loop ended without the model asking to answer
+)
+
+// agentPrompt asks the chat model for its next step: another search, or the answer
+const agentPrompt = `You are gathering context to answer a question from a document collection. You can search the collection one query at a time. Break the question into the sub-questions it depends on, such as one per item being compared, and search for each piece of information still missing. When the contexts below are enough to answer, stop searching.
+
+Respond with only a JSON object, either {"action": "search", "query": "...", "reason": "..."} to run a search, or {"action": "answer", "reason": "..."} when the contexts are enough. You have %d searches left.
+
+Question: %s
+
+Searches run so far:
+%s
+
+Contexts found so far:
+%s`
+
+// agentDecision is the chat model's choice of the next step
+type agentDecision struct {
+	Action string `json:"action"`
+	Query  string `json:"query"`
+	Reason string `json:"reason"`
+}
+
+// agentIterations returns the number of searches the agent may run
+func agentIterations(req *models.QueryRequest) int {
+	if req.MaxIterations <= 0 {
+		return defaultAgentIterations
+	}
+	return req.MaxIterations
+}
+
+// retrieveAgentically lets the chat model run up to max_iterations searches, one sub-question at a
+// time, seeing what earlier ones found, and merges the chunks of every search in the order they
+// were found. Each search runs the full retrieval pipeline of the request. When the model fails
+// before searching, the question is retrieved for once.
+func (r *RAGService) retrieveAgentically(ctx context.Context, req *models.QueryRequest) (*RetrievalResult, []models.AgentStep, error) {
+	ctx, span := startSpan(ctx, "RAGService.RetrieveAgentically")
+	result, trace, err := r.agentLoop(ctx, req)
+	span.SetAttribute("rag.agent_steps", len(trace))
+	if result != nil {
+		span.SetAttribute("rag.chunks", len(result.Chunks))
+	}
+	span.End(err)
+	return result, trace, err
+}
+
+// agentLoop is retrieveAgentically without its span
+func (r *RAGService) agentLoop(ctx context.Context, req *models.QueryRequest) (*RetrievalResult, []models.AgentStep, error) {
+	maxSearches := agentIterations(req)
+	result := &RetrievalResult{ExpandedQuery: req.Query}
+	found := make(map[string]bool)
+	var trace []models.AgentStep
+	var searches []string
+
+	search := func(query, reason string) error {
+		subReq := *req
+		subReq.Query = query
+		subReq.Agentic = false
+		retrieved, err := r.Retrieve(ctx, &subReq)
+		if err != nil {
+			return err
+		}
+		step := models.AgentStep{Step: len(trace) + 1, Action: AgentSearch, Query: query, Reason: reason, ChunkIDs: []string{}}
+		for i, chunk := range retrieved.Chunks {
+			step.ChunkIDs = append(step.ChunkIDs, chunk.ID)
+			if found[chunk.ID] {
+				continue
+			}
+			found[chunk.ID] = true
+			step.NewChunks++
+			result.Chunks = append(result.Chunks, chunk)
+			result.Scores = append(result.Scores, retrieved.Scores[i])
+		}
+		for _, degradation := range retrieved.Degradations {
+			if !contains(result.Degradations, degradation) {
+				result.Degradations = append(result.Degradations, degradation)
+			}
+		}
+		result.Collections = retrieved.Collections
+		result.RankFused = result.RankFused || retrieved.RankFused
+		trace = append(trace, step)
+		searches = append(searches, query)
+		return nil
+	}
+
+	stop := func(action, reason string) {
+		trace = append(trace, models.AgentStep{Step: len(trace) + 1, Action: action, Reason: reason})
+	}
+
+	for {
+		if len(searches) == maxSearches {
+			stop(AgentStop, "max_iterations reached")
+			break
+		}
+		decision, err := r.nextAgentStep(ctx, req.Query, searches, result.Chunks, maxSearches-len(searches))
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			log.Printf("Agentic retrieval stopped: %v", err)
+			if len(searches) == 0 {
+				result.Degradations = append(result.Degradations, DegradedSingleRetrieval)
+			}
+			stop(AgentStop, err.Error())
+			break
+		}
+		if decision.Action == AgentAnswer {
+			if len(searches) > 0 {
+				stop(AgentAnswer, decision.Reason)
+				break
+			}
+			// The answer needs some context; the question itself is the first search
+			decision.Query, decision.Reason = req.Query, "the model answered without searching, so the question was searched for"
+		}
+		if containsFold(searches, decision.Query) {
+			stop(AgentStop, fmt.Sprintf("repeated search %q", decision.Query))
+			break
+		}
+		if err := search(decision.Query, decision.Reason); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(searches) == 0 {
+		if err := search(req.Query, "the question itself, as the agent ran no search"); err != nil {
+			return nil, nil, err
+		}
+	}
+	log.Printf("Agentic retrieval ran %d searches and found %d chunks", len(searches), len(result.Chunks))
+	return result, trace, nil
+}
+
+// nextAgentStep asks the chat model whether to search again, and for what
+func (r *RAGService) nextAgentStep(ctx context.Context, question string, searches []string, chunks []*models.EnhancedChunk, remaining int) (*agentDecision, error) {
+	searchList, contexts := "(none)", "(none)"
+	if len(searches) > 0 {
+		searchList = "- " + strings.Join(searches, "\n- ")
+	}
+	if len(chunks) > 0 {
+		contexts = r.prepareContext(chunks)
+	}
+	output, err := r.llmClient.GenerateResponse(ctx, fmt.Sprintf(agentPrompt, remaining, question, searchList, contexts))
+	if err != nil {
+		return nil, err
+	}
+
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in model response")
+	}
+	var decision agentDecision
+	if err := json.Unmarshal([]byte(output[start:end+1]), &decision); err != nil {
+		return nil, fmt.Errorf("invalid agent step JSON in model response: %w", err)
+	}
+	decision.Action = strings.ToLower(strings.TrimSpace(decision.Action))
+	decision.Query = strings.TrimSpace(decision.Query)
+	switch decision.Action {
+	case AgentAnswer:
+	case AgentSearch:
+		if decision.Query == "" {
+			return nil, fmt.Errorf("search without a query in model response")
+		}
+	default:
+		return nil, fmt.Errorf("unknown agent action %q", decision.Action)
+	}
+	return &decision, nil
+}
+
+// containsFold reports whether list holds s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
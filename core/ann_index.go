@@ -0,0 +1,572 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the ANN index parameters
+const (
+	defaultANNM              = 16
+	defaultANNEfConstruction = 100
+	defaultANNEfSearch       = 64
+)
+
+// annCompactionThreshold is how many deleted vectors an index tolerates before it is rebuilt, once
+// they also outnumber the live ones
+const annCompactionThreshold = 1000
+
+// States of an ANN index
+const (
+	ANNIndexBuilding = "building" // Searches scan sqlite-vec until the first build is done
+	ANNIndexReady    = "ready"
+	ANNIndexFailed   = "failed" // The build failed; searches scan sqlite-vec
+)
+
+// ANNIndexStatus reports the state of the ANN index of a collection
+type ANNIndexStatus struct {
+	State   string     `json:"state"`
+	Vectors int        `json:"vectors"`
+	Deleted int        `json:"deleted"` // Removed or replaced vectors still linked until the index is rebuilt
+	BuiltAt *time.Time `json:"built_at,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// annChange adds, replaces or, with a nil vector, removes the vector of a chunk
+type annChange struct {
+	id     string
+	vector []float32
+}
+
+// annIndex is the in-memory HNSW graph of one collection's embeddings. The graph is a cache of
+// the embedding tables: it only proposes candidates, which are read back from the database.
+type annIndex struct {
+	owner              *ANNIndexes
+	tenant, collection string
+
+	mu      sync.RWMutex
+	graph   *hnswGraph // nil until the first build is done
+	state   string
+	err     string
+	builtAt time.Time
+
+	rebuilding   bool
+	rebuildAgain bool        // Another rebuild was asked for while one ran
+	journal      []annChange // Changes made while a rebuild loads the collection, replayed onto its graph
+}
+
+// ANNIndexes keeps an ANN index for each collection configured in ann_index, so vector searches
+// of frequently queried collections walk a graph instead of scanning every stored embedding.
+type ANNIndexes struct {
+	db  *VectorDB
+	cfg config.ANNIndexConfig
+
+	indexes map[string]*annIndex // By tenant and collection name, see annKey
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	built   chan struct{} // Closed once every index has been built once
+}
+
+var annIndexes *ANNIndexes
+
+// SetANNIndexes installs the indexes vector searches and writes use. Passing nil disables them.
+func SetANNIndexes(indexes *ANNIndexes) {
+	annIndexes = indexes
+}
+
+// annKey identifies the index of a collection
+func annKey(tenant, collectionName string) string {
+	return tenant + "\x00" + collectionName
+}
+
+// lookupANNIndex returns the index of a collection, or nil when it has none
+func lookupANNIndex(tenant, collectionName string) *annIndex {
+	if annIndexes == nil {
+		return nil
+	}
+	return annIndexes.indexes[annKey(tenant, collectionName)]
+}
+
+// NewANNIndexes returns the indexes of the configured collections, not yet built, or nil when no
+// collection is configured
+func NewANNIndexes(db *VectorDB, cfg config.ANNIndexConfig) (*ANNIndexes, error) {
+	if len(cfg.Collections) == 0 {
+		return nil, nil
+	}
+	if cfg.M <= 0 {
+		cfg.M = defaultANNM
+	}
+	if cfg.M < 2 {
+		return nil, fmt.Errorf("ann_index.m must be at least 2")
+	}
+	if cfg.EfConstruction <= 0 {
+		cfg.EfConstruction = defaultANNEfConstruction
+	}
+	if cfg.EfSearch <= 0 {
+		cfg.EfSearch = defaultANNEfSearch
+	}
+
+	a := &ANNIndexes{db: db, cfg: cfg, indexes: make(map[string]*annIndex)}
+	for _, c := range cfg.Collections {
+		if c.Collection == "" {
+			return nil, fmt.Errorf("ann_index.collections needs a collection name")
+		}
+		tenant := db.ForTenant(c.Tenant).Tenant()
+		a.indexes[annKey(tenant, c.Collection)] = &annIndex{owner: a, tenant: tenant, collection: c.Collection, state: ANNIndexBuilding}
+	}
+	return a, nil
+}
+
+// Start builds the indexes in the background, one at a time
+func (a *ANNIndexes) Start() {
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	a.built = make(chan struct{})
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		defer close(a.built)
+		for _, index := range a.indexes {
+			if a.ctx.Err() != nil {
+				return
+			}
+			a.rebuild(index, false)
+		}
+	}()
+	log.Printf("Building ANN indexes of %d collections", len(a.indexes))
+}
+
+// Stop abandons builds in progress and waits for them to end
+func (a *ANNIndexes) Stop() {
+	if a.cancel == nil {
+		return
+	}
+	a.cancel()
+	a.wg.Wait()
+}
+
+// Wait returns once every index has been built once, or when ctx is done
+func (a *ANNIndexes) Wait(ctx context.Context) error {
+	select {
+	case <-a.built:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status reports the state of the index of a collection, or nil when it has none
+func (a *ANNIndexes) Status(tenant, collectionName string) *ANNIndexStatus {
+	index := a.indexes[annKey(tenant, collectionName)]
+	if index == nil {
+		return nil
+	}
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	status := &ANNIndexStatus{State: index.state, Error: index.err}
+	if index.graph != nil {
+		status.Vectors, status.Deleted = index.graph.len(), index.graph.deleted
+		builtAt := index.builtAt
+		status.BuiltAt = &builtAt
+	}
+	return status
+}
+
+// rebuildAll rebuilds every index matching the tenant and collection in the background, an empty
+// one matching all. With discard, searches scan sqlite-vec until the rebuild is done, for when
+// the stored vectors were all replaced and the current graph no longer describes them.
+func (a *ANNIndexes) rebuildAll(tenant, collectionName string, discard bool) {
+	for _, index := range a.indexes {
+		if (tenant == "" || index.tenant == tenant) && (collectionName == "" || index.collection == collectionName) {
+			a.rebuildInBackground(index, discard)
+		}
+	}
+}
+
+// rebuildInBackground rebuilds an index unless the indexes are stopped
+func (a *ANNIndexes) rebuildInBackground(index *annIndex, discard bool) {
+	if a.ctx == nil || a.ctx.Err() != nil {
+		return
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.rebuild(index, discard)
+	}()
+}
+
+// rebuild loads the collection's embeddings into a new graph and swaps it in. Changes made while
+// they load are applied to the current graph and journaled, then replayed onto the new one.
+func (a *ANNIndexes) rebuild(index *annIndex, discard bool) {
+	index.mu.Lock()
+	if discard {
+		index.graph, index.state = nil, ANNIndexBuilding
+	}
+	if index.rebuilding {
+		index.rebuildAgain = true
+		index.mu.Unlock()
+		return
+	}
+	index.rebuilding = true
+	index.mu.Unlock()
+
+	for {
+		index.mu.Lock()
+		index.journal = []annChange{}
+		index.mu.Unlock()
+
+		start := time.Now()
+		graph, err := a.load(index)
+
+		index.mu.Lock()
+		if err != nil {
+			log.Printf("Failed to build ANN index of collection '%s': %v", index.collection, err)
+			index.err = err.Error()
+			if index.graph == nil {
+				index.state = ANNIndexFailed
+			}
+		} else {
+			for _, change := range index.journal {
+				graph.apply(change)
+			}
+			index.graph, index.state, index.err, index.builtAt = graph, ANNIndexReady, "", time.Now().UTC()
+			log.Printf("Built ANN index of collection '%s' with %d vectors in %v",
+				index.collection, graph.len(), time.Since(start).Round(time.Millisecond))
+		}
+		index.journal = nil
+		again := index.rebuildAgain && a.ctx.Err() == nil
+		index.rebuildAgain = false
+		if !again {
+			index.rebuilding = false
+			index.mu.Unlock()
+			return
+		}
+		index.mu.Unlock()
+	}
+}
+
+// load reads the float32 embeddings of a collection into a new graph
+func (a *ANNIndexes) load(index *annIndex) (*hnswGraph, error) {
+	graph := newHNSWGraph(a.cfg.M, a.cfg.EfConstruction)
+	dimension, err := a.db.ForTenant(index.tenant).storedDimension(a.db.conn, index.collection)
+	if err != nil || dimension == 0 {
+		return graph, err
+	}
+
+	rows, err := a.db.conn.QueryContext(a.ctx, `SELECT c.id, e.embedding
+		FROM enhanced_chunks c
+		CROSS JOIN `+floatEmbeddingTable(dimension)+` e ON e.chunk_id = c.id
+		WHERE c.collection_name = ? AND c.tenant_id = ?`, index.collection, index.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var blob []byte
+		if err := rows.Scan(&id, &blob); err != nil {
+			return nil, fmt.Errorf("failed to scan embedding: %w", err)
+		}
+		graph.add(id, deserializeFloat32(blob))
+		if n := graph.len(); n%50000 == 0 {
+			log.Printf("ANN index of collection '%s': %d vectors linked", index.collection, n)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read embeddings: %w", err)
+	}
+	return graph, nil
+}
+
+// apply makes a change to the graph
+func (g *hnswGraph) apply(change annChange) {
+	if change.vector == nil {
+		g.remove(change.id)
+	} else {
+		g.add(change.id, change.vector)
+	}
+}
+
+// change applies changes to the index, and journals them while it is being rebuilt. An index
+// whose deleted vectors have come to outnumber its live ones is rebuilt.
+func (index *annIndex) change(changes []annChange) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	if index.rebuilding {
+		index.journal = append(index.journal, changes...)
+	}
+	if index.graph == nil {
+		return
+	}
+	for _, change := range changes {
+		index.graph.apply(change)
+	}
+	if index.graph.deleted > annCompactionThreshold && index.graph.deleted > index.graph.len() && !index.rebuilding {
+		index.owner.rebuildInBackground(index, false)
+	}
+}
+
+// search returns the IDs of up to k chunks nearest to vector, nearest first. exhaustive reports
+// that the index holds no other live vectors, and ok is false while the index can't be searched.
+func (index *annIndex) search(vector []float32, k int) (ids []string, exhaustive, ok bool) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	if index.graph == nil || (index.graph.len() > 0 && len(vector) != index.graph.dimension) {
+		return nil, false, false
+	}
+	found := index.graph.search(vector, k, index.owner.cfg.EfSearch)
+	ids = make([]string, len(found))
+	for i, candidate := range found {
+		ids[i] = index.graph.nodes[candidate.node].id
+	}
+	return ids, len(found) >= index.graph.len(), true
+}
+
+// indexEmbeddings adds the embeddings of chunks to the ANN index of their collection, once the
+// transaction storing them has committed. Quantized collections are only indexed when they keep
+// float32 vectors.
+func (db *VectorDB) indexEmbeddings(collectionName string, quantization *models.QuantizationConfig, chunks []*models.EnhancedChunk) {
+	index := lookupANNIndex(db.tenant, collectionName)
+	if index == nil || !storesFloatEmbeddings(quantization) {
+		return
+	}
+	changes := make([]annChange, 0, len(chunks))
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) > 0 {
+			changes = append(changes, annChange{id: chunk.ID, vector: chunk.Embedding})
+		}
+	}
+	index.change(changes)
+}
+
+// unindexEmbeddings removes the embeddings of deleted chunks from the ANN index of their collection
+func (db *VectorDB) unindexEmbeddings(collectionName string, chunkIDs []string) {
+	index := lookupANNIndex(db.tenant, collectionName)
+	if index == nil {
+		return
+	}
+	changes := make([]annChange, len(chunkIDs))
+	for i, id := range chunkIDs {
+		changes[i] = annChange{id: id}
+	}
+	index.change(changes)
+}
+
+// indexStoredEmbeddings adds the stored embeddings of chunks to the ANN indexes of their
+// collections, for chunks that took over the embedding of another
+func (db *VectorDB) indexStoredEmbeddings(chunkIDs []string) {
+	if annIndexes == nil || len(chunkIDs) == 0 {
+		return
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunkIDs)), ",")
+	args := []interface{}{db.tenant}
+	for _, id := range chunkIDs {
+		args = append(args, id)
+	}
+	tables, err := existingEmbeddingTables(db.conn)
+	if err != nil {
+		log.Printf("Failed to read embeddings for the ANN index: %v", err)
+		return
+	}
+	for _, table := range tables {
+		if table.quantization == "" {
+			db.indexStoredEmbeddingsFrom(table.name, placeholders, args)
+		}
+	}
+}
+
+// indexStoredEmbeddingsFrom adds the embeddings of the chunks matching args stored in one table
+func (db *VectorDB) indexStoredEmbeddingsFrom(table, placeholders string, args []interface{}) {
+	rows, err := db.conn.Query(`SELECT c.id, c.collection_name, e.embedding
+		FROM enhanced_chunks c
+		CROSS JOIN `+table+` e ON e.chunk_id = c.id
+		WHERE c.tenant_id = ? AND c.id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		log.Printf("Failed to read embeddings for the ANN index: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, collectionName string
+		var blob []byte
+		if err := rows.Scan(&id, &collectionName, &blob); err != nil {
+			log.Printf("Failed to read embeddings for the ANN index: %v", err)
+			return
+		}
+		if index := lookupANNIndex(db.tenant, collectionName); index != nil {
+			index.change([]annChange{{id: id, vector: deserializeFloat32(blob)}})
+		}
+	}
+}
+
+// rebuildANNIndexes rebuilds the ANN indexes matching the tenant and collection, an empty one
+// matching all, after their stored vectors were replaced wholesale
+func rebuildANNIndexes(tenant, collectionName string) {
+	if annIndexes != nil {
+		annIndexes.rebuildAll(tenant, collectionName, true)
+	}
+}
+
+// searchANNIndex answers a vector search from the ANN index of a collection. Candidates are read
+// back from the database, which filters them and scores them by their stored vectors exactly
+// like a scan; those no longer stored in the collection are dropped from the index. ok is false
+// when the index can't supply topK matches, and the caller scans sqlite-vec instead.
+func (db *VectorDB) searchANNIndex(ctx context.Context, index *annIndex, collectionName string, queryEmbedding []float32, topK int, filters map[string]interface{}) (chunks []*models.EnhancedChunk, scores []float64, ok bool, err error) {
+	queryBlob, err := serializeEmbedding(queryEmbedding)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	// The caller checked that the query has the dimension of the collection's embeddings
+	table := floatEmbeddingTable(len(queryEmbedding))
+
+	k := topK
+	if len(filters) > 0 {
+		k *= filteredSearchOversample
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		ids, exhaustive, searchable := index.search(queryEmbedding, k)
+		if !searchable {
+			return nil, nil, false, nil
+		}
+		chunks, scores, err = db.readANNCandidates(ctx, table, collectionName, ids, queryBlob, filters)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if len(chunks) >= topK || exhaustive {
+			if len(chunks) > topK {
+				chunks, scores = chunks[:topK], scores[:topK]
+			}
+			return chunks, scores, true, nil
+		}
+		if err := db.dropStaleANNCandidates(ctx, index, table, collectionName, ids, chunks); err != nil {
+			return nil, nil, false, err
+		}
+		// Filters or stale entries took out too many; look further before giving up
+		k *= filteredSearchOversample
+	}
+	return nil, nil, false, nil
+}
+
+// readANNCandidates reads the candidate chunks that are stored in the collection and pass the
+// filters, scored by their embeddings in table and nearest first
+func (db *VectorDB) readANNCandidates(ctx context.Context, table, collectionName string, ids []string, queryBlob []byte, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, error) {
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := []interface{}{queryBlob}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, collectionName, db.tenant)
+
+	// CROSS JOIN keeps enhanced_chunks as the outer table, so vec0 answers one primary key lookup
+	// per candidate
+	query := `
+		SELECT c.id, c.document_id, rag_open(c.text), c.parent_chunk_id, c.child_chunk_ids,
+		       c.section, c.subsection, c.chunk_type, c.start_pos, c.end_pos,
+		       c.chunk_index, c.keywords, c.metadata, c.confidence,
+		       vec_distance_l2(e.embedding, ?) AS distance
+		FROM enhanced_chunks c
+		CROSS JOIN ` + table + ` e ON e.chunk_id = c.id
+		WHERE c.id IN (` + placeholders + `) AND c.collection_name = ? AND c.tenant_id = ?`
+	whereConditions, filterArgs := buildFilterConditions(filters)
+	if len(whereConditions) > 0 {
+		query += " AND " + strings.Join(whereConditions, " AND ")
+		args = append(args, filterArgs...)
+	}
+	query += " ORDER BY distance"
+
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query similar chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []*models.EnhancedChunk
+	var scores []float64
+	for rows.Next() {
+		chunk := &models.EnhancedChunk{}
+		var childIDsJSON, keywordsJSON, metadataJSON string
+		var distance float64
+
+		err := rows.Scan(
+			&chunk.ID, &chunk.DocumentID, &chunk.Text, &chunk.ParentChunkID, &childIDsJSON,
+			&chunk.Section, &chunk.Subsection, &chunk.ChunkType,
+			&chunk.StartPos, &chunk.EndPos, &chunk.ChunkIndex,
+			&keywordsJSON, &metadataJSON, &chunk.Confidence, &distance)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+
+		if childIDsJSON != "[]" {
+			json.Unmarshal([]byte(childIDsJSON), &chunk.ChildChunkIDs)
+		}
+		if keywordsJSON != "[]" {
+			json.Unmarshal([]byte(keywordsJSON), &chunk.Keywords)
+		}
+		if metadataJSON != "{}" {
+			json.Unmarshal([]byte(metadataJSON), &chunk.Metadata)
+		}
+
+		chunks = append(chunks, chunk)
+		scores = append(scores, 1.0-distance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to query similar chunks: %w", err)
+	}
+	return chunks, scores, nil
+}
+
+// dropStaleANNCandidates removes from the index the candidates no longer stored in the collection
+// with an embedding in table, such as chunks of deleted documents. Candidates read back were
+// found, and those only left out by filters are kept.
+func (db *VectorDB) dropStaleANNCandidates(ctx context.Context, index *annIndex, table, collectionName string, ids []string, found []*models.EnhancedChunk) error {
+	seen := make(map[string]bool, len(found))
+	for _, chunk := range found {
+		seen[chunk.ID] = true
+	}
+	var unseen []interface{}
+	for _, id := range ids {
+		if !seen[id] {
+			unseen = append(unseen, id)
+		}
+	}
+	if len(unseen) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(unseen)), ",")
+	stored, err := queryStringsContext(ctx, db, `SELECT c.id
+		FROM enhanced_chunks c
+		CROSS JOIN `+table+` e ON e.chunk_id = c.id
+		WHERE c.id IN (`+placeholders+`) AND c.collection_name = ? AND c.tenant_id = ?`,
+		append(unseen, collectionName, db.tenant)...)
+	if err != nil {
+		return fmt.Errorf("failed to check ANN candidates: %w", err)
+	}
+	alive := make(map[string]bool, len(stored))
+	for _, id := range stored {
+		alive[id] = true
+	}
+
+	var stale []annChange
+	for _, id := range unseen {
+		if !alive[id.(string)] {
+			stale = append(stale, annChange{id: id.(string)})
+		}
+	}
+	if len(stale) > 0 {
+		index.change(stale)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+)
+
+// Self-check verdicts
+const (
+	VerdictSupported   = "supported"
+	VerdictPartial     = "partially_supported"
+	VerdictUnsupported = "unsupported"
+)
+
+const (
+	groundedRetrievalFloor = 0.5 // Retrieval confidence an unchecked answer needs to count as grounded
+	uncitedFactor          = 0.7 // Confidence kept by an answer citing none of the chunks
+	notFoundFactor         = 0.2 // Confidence kept by an answer saying the chunks don't cover the question
+	selfCheckWeight        = 0.6 // Share of confidence given to the self-check when it ran
+)
+
+// verdictCeilings cap the confidence of answers the self-check found only partly or not supported
+var verdictCeilings = map[string]float64{
+	VerdictSupported:   1,
+	VerdictPartial:     0.6,
+	VerdictUnsupported: 0.2,
+}
+
+// selfCheckPrompt asks the chat model whether the contexts support an answer
+const selfCheckPrompt = `Below are a question, an answer and the numbered contexts the answer was written from. Check every claim of the answer against the contexts.
+
+Respond with only a JSON object, e.g. {"verdict": "supported", "confidence": 0.9, "unsupported_claims": []}. The verdict is "supported" when every claim is backed by the contexts, "partially_supported" when some are, and "unsupported" when none are or the answer says the contexts don't cover the question. The confidence, from 0 to 1, is how sure you are that the answer is correct and fully backed by the contexts. List the claims without support in unsupported_claims.
+
+Question: %s
+
+Answer: %s
+
+%s`
+
+// retrievalConfidence estimates from the similarity scores of the retrieved chunks how likely they
+// hold the answer: mostly the best score, and partly the mean of the best three, so a lone match
+// counts for less than several that agree. Scores are clamped to 0-1.
+func retrievalConfidence(scores []float64) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(scores))
+	for i, score := range scores {
+		sorted[i] = math.Max(0, math.Min(1, score))
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+
+	top := sorted[:min(3, len(sorted))]
+	var sum float64
+	for _, score := range top {
+		sum += score
+	}
+	return roundScore(0.7*sorted[0] + 0.3*sum/float64(len(top)))
+}
+
+// estimateConfidence scores an answer from its retrieval and its wording. An answer is grounded
+// when it cites the chunks (extractive answers quote them), doesn't say they lack the answer, and
+// was retrieved with enough confidence.
+func estimateConfidence(answer string, scores []float64, citations []models.Citation, extractive bool) (float64, bool, *models.AnswerConfidence) {
+	details := &models.AnswerConfidence{
+		Retrieval: retrievalConfidence(scores),
+		Cited:     len(citations) > 0 || extractive,
+		NotFound:  answerNotFound(answer),
+	}
+
+	confidence := details.Retrieval
+	switch {
+	case details.NotFound:
+		confidence *= notFoundFactor
+	case !details.Cited:
+		confidence *= uncitedFactor
+	}
+	grounded := !details.NotFound && details.Cited && details.Retrieval >= groundedRetrievalFloor
+	return roundScore(confidence), grounded, details
+}
+
+// selfCheck refines the confidence of a response with the chat model's verdict on whether the
+// chunks support its answer. The verdict decides is_grounded and caps the confidence, and the
+// model's own confidence outweighs the retrieval estimate.
+func (r *RAGService) selfCheck(ctx context.Context, query string, chunks []*models.EnhancedChunk, response *models.QueryResponse) error {
+	prompt := fmt.Sprintf(selfCheckPrompt, query, response.Answer, r.prepareContext(chunks))
+	output, err := r.llmClient.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return err
+	}
+
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return fmt.Errorf("no JSON object in model response")
+	}
+	var check struct {
+		Verdict           string   `json:"verdict"`
+		Confidence        float64  `json:"confidence"`
+		UnsupportedClaims []string `json:"unsupported_claims"`
+	}
+	if err := json.Unmarshal([]byte(output[start:end+1]), &check); err != nil {
+		return fmt.Errorf("invalid self-check JSON in model response: %w", err)
+	}
+
+	verdict := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(check.Verdict)), " ", "_")
+	switch verdict {
+	case VerdictSupported, VerdictUnsupported:
+	case VerdictPartial, "partial", "partly_supported":
+		verdict = VerdictPartial
+	default:
+		return fmt.Errorf("unknown self-check verdict %q", check.Verdict)
+	}
+	// Some models answer in percent
+	if check.Confidence > 1 && check.Confidence <= 100 {
+		check.Confidence /= 100
+	}
+	selfConfidence := roundScore(math.Max(0, math.Min(1, check.Confidence)))
+
+	details := response.ConfidenceDetails
+	details.SelfCheck = &selfConfidence
+	details.Verdict = verdict
+	details.UnsupportedClaims = check.UnsupportedClaims
+
+	blended := (1-selfCheckWeight)*response.Confidence + selfCheckWeight*selfConfidence
+	response.Confidence = roundScore(math.Min(blended, verdictCeilings[verdict]))
+	response.IsGrounded = verdict == VerdictSupported && !details.NotFound
+
+	log.Printf("Self-check: %s (confidence %.2f), answer confidence %.2f", verdict, selfConfidence, response.Confidence)
+	return nil
+}
+
+// roundScore keeps three decimals of a score
+func roundScore(score float64) float64 {
+	return math.Round(score*1000) / 1000
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"rag-go-app/models"
+	"time"
+)
+
+// Kinds of actors recorded in the audit log
+const (
+	AuditActorAPIKey    = "api_key"   // An API key, recorded as its SHA-256 hash
+	AuditActorUser      = "user"      // The user claim of a JWT
+	AuditActorAnonymous = "anonymous" // A request without credentials
+	AuditActorSystem    = "system"    // The server itself, e.g. the expiry sweeper or the crawl scheduler
+)
+
+// auditSortColumns are the sort keys of the audit log; ids grow with time, so created_at orders by id
+var auditSortColumns = map[string]string{
+	"created_at": "a.id",
+	"action":     "a.action",
+}
+
+// AuditEntry records one create, update or delete, whether it succeeded or was refused
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	CreatedAt  time.Time              `json:"created_at"`
+	Tenant     string                 `json:"tenant,omitempty"` // Empty for server-wide actions such as backups
+	ActorKind  string                 `json:"actor_kind"`       // "api_key", "user", "anonymous" or "system"
+	Actor      string                 `json:"actor,omitempty"`  // API keys are recorded as "sha256:<hash>"
+	ClientIP   string                 `json:"client_ip,omitempty"`
+	Method     string                 `json:"method,omitempty"`
+	Path       string                 `json:"path,omitempty"` // Route pattern, e.g. /api/v1/documents/:id
+	Action     string                 `json:"action"`         // e.g. collection.create or document.delete
+	Collection string                 `json:"collection,omitempty"`
+	ResourceID string                 `json:"resource_id,omitempty"` // Document or chunk the action applied to
+	Status     int                    `json:"status"`                // HTTP status of the response; 0 for system actions
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// RecordAudit appends an entry to the audit log, stamped with the current time unless it has one
+func (db *VectorDB) RecordAudit(entry *AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	var details *string
+	if len(entry.Details) > 0 {
+		data, err := json.Marshal(entry.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+		s := string(data)
+		details = &s
+	}
+	result, err := db.conn.Exec(`INSERT INTO audit_log (created_at, tenant_id, actor_kind, actor, client_ip, method, path, action, collection_name, resource_id, status, details)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.CreatedAt.UTC().Format("2006-01-02 15:04:05"), entry.Tenant, entry.ActorKind, entry.Actor, entry.ClientIP,
+		entry.Method, entry.Path, entry.Action, entry.Collection, entry.ResourceID, entry.Status, details)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	entry.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// AuditLog lists the audit entries matching the request, newest first by default, with the total
+// number of matches. Unlike the other list methods it spans every tenant unless one is requested.
+func (db *VectorDB) AuditLog(req *models.AuditLogRequest) ([]AuditEntry, int, error) {
+	q, err := db.auditQuery(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM audit_log a`+q.where(), q.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	entries := []AuditEntry{}
+	err = db.EachAuditEntry(req, func(entry *AuditEntry) error {
+		entries = append(entries, *entry)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// EachAuditEntry calls fn with every audit entry matching the request in order, so exports can
+// stream the log without holding it in memory
+func (db *VectorDB) EachAuditEntry(req *models.AuditLogRequest, fn func(*AuditEntry) error) error {
+	q, err := db.auditQuery(req)
+	if err != nil {
+		return err
+	}
+	rows, err := db.conn.Query(`SELECT a.id, a.created_at, a.tenant_id, a.actor_kind, a.actor, a.client_ip, a.method, a.path,
+		a.action, a.collection_name, a.resource_id, a.status, a.details
+		FROM audit_log a`+q.where()+q.orderBy+q.limit, q.args...)
+	if err != nil {
+		return fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry AuditEntry
+		var details sql.NullString
+		err := rows.Scan(&entry.ID, &entry.CreatedAt, &entry.Tenant, &entry.ActorKind, &entry.Actor, &entry.ClientIP, &entry.Method,
+			&entry.Path, &entry.Action, &entry.Collection, &entry.ResourceID, &entry.Status, &details)
+		if err != nil {
+			return fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		if details.Valid {
+			_ = json.Unmarshal([]byte(details.String), &entry.Details)
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// auditQuery translates the filters and paging of an audit log request into SQL
+func (db *VectorDB) auditQuery(req *models.AuditLogRequest) (*listQuery, error) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	for _, filter := range []struct{ column, value string }{
+		{"a.tenant_id", req.Tenant},
+		{"a.actor", req.Actor},
+		{"a.action", req.Action},
+		{"a.collection_name", req.Collection},
+	} {
+		if filter.value != "" {
+			conditions = append(conditions, filter.column+" = ?")
+			args = append(args, filter.value)
+		}
+	}
+	return buildListQuery(req.ListOptions, conditions, args, "a.created_at", "a.id", auditSortColumns)
+}
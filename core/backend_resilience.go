@@ -0,0 +1,219 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"rag-go-app/config"
+	"sync"
+	"time"
+)
+
+// backendStatusError is a response from a model server with a status other than 200
+type backendStatusError struct {
+	statusCode int
+	message    string
+}
+
+func (e *backendStatusError) Error() string {
+	return e.message
+}
+
+// modelServers returns the base URLs of the model servers in failover order
+func modelServers() []string {
+	servers := []string{config.AppConfig.LlamaCPPBaseURL}
+	for _, baseURL := range config.AppConfig.LlamaCPPFailoverURLs {
+		if baseURL != "" && !contains(servers, baseURL) {
+			servers = append(servers, baseURL)
+		}
+	}
+	return servers
+}
+
+// circuitBreaker counts the consecutive failures of one model server. Once they reach the
+// threshold, the circuit opens and the server is skipped until the cooldown has passed.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[string]*circuitBreaker) // By server base URL
+)
+
+// breakerFor returns the circuit breaker of a model server
+func breakerFor(baseURL string) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	breaker, ok := breakers[baseURL]
+	if !ok {
+		breaker = &circuitBreaker{}
+		breakers[baseURL] = breaker
+	}
+	return breaker
+}
+
+// allow reports whether the server may be called: always while the circuit is closed, and for one
+// trial call per cooldown while it is open
+func (b *circuitBreaker) allow(now time.Time, threshold int, cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if threshold <= 0 || b.failures < threshold {
+		return true
+	}
+	if now.Before(b.openUntil) {
+		return false
+	}
+	// Other calls keep skipping the server while the trial runs
+	b.openUntil = now.Add(cooldown)
+	return true
+}
+
+// success closes the circuit
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// failure counts a failed call and reports whether the circuit is now open
+func (b *circuitBreaker) failure(now time.Time, threshold int, cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if threshold <= 0 || b.failures < threshold {
+		return false
+	}
+	b.openUntil = now.Add(cooldown)
+	return true
+}
+
+// BackendStatus is the circuit state of one model server
+type BackendStatus struct {
+	URL                 string     `json:"url"`
+	Circuit             string     `json:"circuit"` // "closed" or "open"
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"` // When an open circuit lets a trial call through
+}
+
+// BackendStatuses reports the circuit state of every model server, in failover order
+func BackendStatuses() []BackendStatus {
+	threshold := config.AppConfig.Resilience.BreakerThreshold
+	var statuses []BackendStatus
+	for _, baseURL := range modelServers() {
+		breaker := breakerFor(baseURL)
+		breaker.mu.Lock()
+		status := BackendStatus{URL: baseURL, Circuit: "closed", ConsecutiveFailures: breaker.failures}
+		if threshold > 0 && breaker.failures >= threshold {
+			status.Circuit = "open"
+			retryAt := breaker.openUntil
+			status.RetryAt = &retryAt
+		}
+		breaker.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// isTransientBackendError reports whether a failed call may succeed if repeated: the server could
+// not be reached, dropped the connection or answered with a 5xx status. An oversized batch fails
+// the same way every time.
+func isTransientBackendError(err error) bool {
+	var statusErr *backendStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode >= 500 && !isOversizedBatchError(err)
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryBackoff returns the wait before retry number attempt+1: the initial backoff, doubled with
+// every retry up to the maximum
+func retryBackoff(attempt int, cfg config.ResilienceConfig) time.Duration {
+	backoff := time.Duration(cfg.InitialBackoffMS) * time.Millisecond
+	maxBackoff := time.Duration(cfg.MaxBackoffMS) * time.Millisecond
+	for i := 0; i < attempt && (maxBackoff <= 0 || backoff < maxBackoff); i++ {
+		backoff *= 2
+	}
+	if maxBackoff > 0 && backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// callModelServer runs call against the model servers in failover order until one succeeds, each
+// attempt bounded by stageSeconds; with 0, attempts are bounded by ctx alone, so what call returns
+// may outlive it. Transient failures are retried on the same server with
+// exponential backoff and count against its circuit breaker; a server whose circuit is open, or
+// whose attempt timed out, is left for the next one. Other errors are returned at once.
+func callModelServer(ctx context.Context, stageSeconds int, call func(ctx context.Context, provider Provider) error) error {
+	cfg := config.AppConfig.Resilience
+	cooldown := time.Duration(cfg.BreakerCooldownSeconds) * time.Second
+	servers := modelServers()
+
+	var lastErr error
+	for i, baseURL := range servers {
+		provider, err := providerAt(baseURL)
+		if err != nil {
+			return err
+		}
+		breaker := breakerFor(baseURL)
+		if !breaker.allow(time.Now(), cfg.BreakerThreshold, cooldown) {
+			if lastErr == nil {
+				lastErr = fmt.Errorf("model server %s is unavailable: too many consecutive failures", baseURL)
+			}
+			continue
+		}
+
+		for attempt := 0; ; attempt++ {
+			attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+			if stageSeconds > 0 {
+				attemptCtx, cancel = withStageTimeout(ctx, stageSeconds)
+			}
+			err := call(attemptCtx, provider)
+			cancel()
+			if err == nil {
+				breaker.success()
+				return nil
+			}
+			if ctx.Err() != nil {
+				return err
+			}
+			timedOut := errors.Is(err, context.DeadlineExceeded)
+			if !timedOut && !isTransientBackendError(err) {
+				// The server answered, so it is up
+				breaker.success()
+				return err
+			}
+
+			lastErr = fmt.Errorf("model server %s: %w", baseURL, err)
+			if breaker.failure(time.Now(), cfg.BreakerThreshold, cooldown) {
+				log.Printf("Model server %s keeps failing, skipping it for %v: %v", baseURL, cooldown, err)
+				break
+			}
+			// A server that timed out once would most likely time out again
+			if timedOut || attempt >= cfg.MaxRetries {
+				break
+			}
+
+			backoff := retryBackoff(attempt, cfg)
+			log.Printf("Model server %s failed, retrying in %v: %v", baseURL, backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if i < len(servers)-1 {
+			log.Printf("Failing over from model server %s to %s", baseURL, servers[i+1])
+		}
+	}
+	return lastErr
+}
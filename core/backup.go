@@ -0,0 +1,440 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"rag-go-app/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	backupPrefix = "rag-backup-"
+	backupSuffix = ".db"
+
+	// backupTimeLayout names backups by when they were taken, so they sort chronologically
+	backupTimeLayout = "20060102T150405.000Z"
+)
+
+// BackupInfo describes one backup file
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Bytes     int64     `json:"bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	Checksum  string    `json:"checksum,omitempty"` // sha256 of the file, known for backups taken since startup
+	S3Key     string    `json:"s3_key,omitempty"`   // Set when the backup was uploaded
+}
+
+// BackupStatus describes the backup settings, the outcome of the last backup and the backups on disk
+type BackupStatus struct {
+	Enabled         bool         `json:"enabled"`
+	Directory       string       `json:"directory,omitempty"`
+	IntervalSeconds int          `json:"interval_seconds,omitempty"`
+	Retain          int          `json:"retain,omitempty"`
+	S3Bucket        string       `json:"s3_bucket,omitempty"`
+	LastBackup      *BackupInfo  `json:"last_backup,omitempty"`
+	LastError       string       `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time   `json:"last_error_at,omitempty"`
+	Backups         []BackupInfo `json:"backups"` // Newest first
+}
+
+// RestoreResult describes a completed restore
+type RestoreResult struct {
+	Restored     BackupInfo `json:"restored"`
+	SafetyBackup BackupInfo `json:"safety_backup"` // The database as it was before the restore
+}
+
+// BackupManager takes consistent backups of the database with VACUUM INTO, on demand and every
+// configured interval, and restores them into the running database with SQLite's online backup API
+type BackupManager struct {
+	db       *VectorDB
+	cfg      config.BackupConfig
+	s3       *s3Client
+	interval time.Duration
+
+	mu         sync.Mutex // Serializes backups and restores and guards the fields below
+	lastBackup *BackupInfo
+	lastErr    string
+	lastErrAt  *time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBackupManager validates the backup settings and returns a manager whose schedule has not been started
+func NewBackupManager(db *VectorDB, cfg config.BackupConfig) (*BackupManager, error) {
+	if cfg.Directory == "" {
+		return nil, fmt.Errorf("backup requires a directory")
+	}
+	if cfg.IntervalSeconds < 0 || cfg.Retain < 0 {
+		return nil, fmt.Errorf("backup interval_seconds and retain cannot be negative")
+	}
+	s3, err := newS3Client(cfg.S3)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupManager{
+		db:       db,
+		cfg:      cfg,
+		s3:       s3,
+		interval: time.Duration(cfg.IntervalSeconds) * time.Second,
+	}, nil
+}
+
+// Start takes a backup every configured interval until Stop is called; without an interval it does nothing
+func (m *BackupManager) Start() {
+	if m.interval <= 0 {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := m.Backup(); err != nil {
+					log.Printf("Scheduled backup failed: %v", err)
+				}
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+
+	log.Printf("Backing up the database to %s every %v", m.cfg.Directory, m.interval)
+}
+
+// Stop ends the backup schedule
+func (m *BackupManager) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+	m.stop = nil
+}
+
+// Status returns the backup settings, the outcome of the last backup and the backups on disk
+func (m *BackupManager) Status() (BackupStatus, error) {
+	backups, err := m.List()
+	if err != nil {
+		return BackupStatus{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := BackupStatus{
+		Enabled:         true,
+		Directory:       m.cfg.Directory,
+		IntervalSeconds: m.cfg.IntervalSeconds,
+		Retain:          m.cfg.Retain,
+		S3Bucket:        m.cfg.S3.Bucket,
+		LastError:       m.lastErr,
+		LastErrorAt:     m.lastErrAt,
+		Backups:         backups,
+	}
+	if m.lastBackup != nil {
+		last := *m.lastBackup
+		status.LastBackup = &last
+	}
+	return status, nil
+}
+
+// List returns the backups in the directory, newest first
+func (m *BackupManager) List() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(m.cfg.Directory)
+	if os.IsNotExist(err) {
+		return []BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	backups := []BackupInfo{}
+	for _, entry := range entries {
+		createdAt, ok := backupTime(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupInfo{Name: entry.Name(), Bytes: info.Size(), CreatedAt: createdAt})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lastBackup != nil {
+		for i := range backups {
+			if backups[i].Name == m.lastBackup.Name {
+				backups[i] = *m.lastBackup
+			}
+		}
+	}
+	return backups, nil
+}
+
+// backupTime parses the time a backup was taken from its file name
+func backupTime(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(backupTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix))
+	return t, err == nil
+}
+
+// Backup writes a consistent copy of the database to the directory, uploads it to S3 if a bucket
+// is configured and deletes the backups beyond the retention count
+func (m *BackupManager) Backup() (BackupInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, err := m.backupLocked()
+	if err != nil {
+		now := time.Now()
+		m.lastErr = err.Error()
+		m.lastErrAt = &now
+		return BackupInfo{}, err
+	}
+	m.prune()
+	return info, nil
+}
+
+func (m *BackupManager) backupLocked() (BackupInfo, error) {
+	if err := os.MkdirAll(m.cfg.Directory, 0o755); err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	createdAt := time.Now().UTC()
+	name := backupPrefix + createdAt.Format(backupTimeLayout) + backupSuffix
+	path := filepath.Join(m.cfg.Directory, name)
+	tmpPath := path + ".tmp"
+
+	// VACUUM INTO refuses to overwrite an existing file. Writing under a temporary name keeps a
+	// half-written backup from being listed or restored.
+	os.Remove(tmpPath)
+	if _, err := m.db.conn.Exec(`VACUUM INTO ?`, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return BackupInfo{}, fmt.Errorf("failed to back up database: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return BackupInfo{}, fmt.Errorf("failed to move backup into place: %w", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to read backup: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to read backup: %w", err)
+	}
+	info := BackupInfo{Name: name, Bytes: size, CreatedAt: createdAt, Checksum: hex.EncodeToString(hash.Sum(nil))}
+
+	if m.s3 != nil {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return BackupInfo{}, fmt.Errorf("failed to read backup: %w", err)
+		}
+		if err := m.s3.Put(m.s3.prefixed(name), file, size, info.Checksum); err != nil {
+			return BackupInfo{}, fmt.Errorf("backup %s was written but not uploaded: %w", name, err)
+		}
+		info.S3Key = m.s3.prefixed(name)
+	}
+
+	m.lastBackup = &info
+	m.lastErr = ""
+	m.lastErrAt = nil
+	log.Printf("Backed up database to %s (%d bytes)", path, size)
+	return info, nil
+}
+
+// prune deletes the oldest backups in the directory beyond the retention count. Uploaded copies are
+// left to the bucket's lifecycle rules.
+func (m *BackupManager) prune() {
+	if m.cfg.Retain <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(m.cfg.Directory)
+	if err != nil {
+		log.Printf("Failed to list backups for pruning: %v", err)
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		if _, ok := backupTime(entry.Name()); ok && !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	for _, name := range names[min(m.cfg.Retain, len(names)):] {
+		if err := os.Remove(filepath.Join(m.cfg.Directory, name)); err != nil {
+			log.Printf("Failed to delete old backup %s: %v", name, err)
+			continue
+		}
+		log.Printf("Deleted old backup %s", name)
+	}
+}
+
+// Restore replaces the contents of the running database with the named backup, taken from the
+// directory or, when it is not there, downloaded from S3. The current database is backed up first,
+// so a restore can itself be undone.
+func (m *BackupManager) Restore(ctx context.Context, name string) (RestoreResult, error) {
+	createdAt, ok := backupTime(name)
+	if !ok || filepath.Base(name) != name {
+		return RestoreResult{}, fmt.Errorf("invalid backup name '%s'", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := filepath.Join(m.cfg.Directory, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if m.s3 == nil {
+			return RestoreResult{}, fmt.Errorf("backup '%s' not found", name)
+		}
+		if err := m.download(ctx, name, path); err != nil {
+			return RestoreResult{}, err
+		}
+	} else if err != nil {
+		return RestoreResult{}, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	if err := checkBackup(ctx, path); err != nil {
+		return RestoreResult{}, err
+	}
+
+	// The safety backup is not followed by pruning, which could delete the backup being restored
+	safety, err := m.backupLocked()
+	if err != nil {
+		return RestoreResult{}, fmt.Errorf("failed to back up the current database before restoring: %w", err)
+	}
+
+	size, err := m.db.restoreFrom(ctx, path)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	log.Printf("Restored database from %s; the previous contents are in %s", name, safety.Name)
+	// A backup taken before term statistics were kept has none
+	if err := m.db.ensureTermStatsTables(); err != nil {
+		log.Printf("Computing term statistics of the restored database failed: %v", err)
+	}
+	rebuildANNIndexes("", "")
+	return RestoreResult{
+		Restored:     BackupInfo{Name: name, Bytes: size, CreatedAt: createdAt},
+		SafetyBackup: safety,
+	}, nil
+}
+
+// download fetches a backup from S3 into path
+func (m *BackupManager) download(ctx context.Context, name, path string) error {
+	if err := os.MkdirAll(m.cfg.Directory, 0o755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+	defer os.Remove(tmpPath)
+
+	_, err = m.s3.Get(ctx, m.s3.prefixed(name), file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to move downloaded backup into place: %w", err)
+	}
+	return nil
+}
+
+// checkBackup reports whether the file at path is an intact database of this server
+func checkBackup(ctx context.Context, path string) error {
+	src, err := sql.Open(sqliteDriver, "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer src.Close()
+
+	var check string
+	if err := src.QueryRowContext(ctx, `PRAGMA quick_check`).Scan(&check); err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	if check != "ok" {
+		return fmt.Errorf("invalid backup: integrity check failed: %s", check)
+	}
+	var tables int
+	err = src.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name IN ('documents', 'enhanced_chunks')`).Scan(&tables)
+	if err != nil || tables != 2 {
+		return fmt.Errorf("invalid backup: not a database of this server")
+	}
+	return nil
+}
+
+// restoreFrom copies the database at path over the running database page by page. Other
+// connections see the restored contents as soon as the copy commits; writes made meanwhile wait
+// for it. It returns the size of the restored file.
+func (db *VectorDB) restoreFrom(ctx context.Context, path string) (int64, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	src, err := sql.Open(sqliteDriver, "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer src.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer srcConn.Close()
+	dstConn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer dstConn.Close()
+
+	err = dstConn.Raw(func(dst interface{}) error {
+		return srcConn.Raw(func(src interface{}) error {
+			backup, err := dst.(*sqlite3.SQLiteConn).Backup("main", src.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore database: %w", err)
+	}
+	return stat.Size(), nil
+}
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"time"
+)
+
+// defaultIngestBatchSize is the number of documents stored per transaction when a batch sets none
+const defaultIngestBatchSize = 20
+
+// BatchIngestResult reports the outcome of one document of a batch ingestion
+type BatchIngestResult struct {
+	Index  int    `json:"index"` // Position of the document in the request
+	Source string `json:"source,omitempty"`
+	IngestResult
+	Error string `json:"error,omitempty"`
+}
+
+// BatchIngester adds documents to a collection in groups of batchSize. The new chunks of a group
+// are embedded together, so requests to the model server are filled across documents, and the
+// group is stored in one transaction. Documents are added one at a time, so a stream never has to
+// be held in memory.
+type BatchIngester struct {
+	r              *RAGService
+	ctx            context.Context
+	collectionName string
+	batchSize      int
+
+	group   []*preparedDocument
+	indices []int           // Result index of each document in group
+	sources map[string]bool // Sources in group; a repeated one starts a new group so it replaces the first
+	results []BatchIngestResult
+}
+
+// NewBatchIngester starts a batch ingestion into a collection; batchSize 0 uses the default
+func (r *RAGService) NewBatchIngester(ctx context.Context, collectionName string, batchSize int) *BatchIngester {
+	if batchSize <= 0 {
+		batchSize = defaultIngestBatchSize
+	}
+	return &BatchIngester{
+		r:              r,
+		ctx:            ctx,
+		collectionName: collectionName,
+		batchSize:      batchSize,
+		sources:        make(map[string]bool),
+	}
+}
+
+// Add prepares a document and stores its group once the group is full. A document that cannot be
+// ingested gets a failed result; only a cancelled or timed out ctx returns an error.
+func (b *BatchIngester) Add(req *models.AddDocumentRequest) error {
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	index := len(b.results)
+	b.results = append(b.results, BatchIngestResult{Index: index, Source: req.Source})
+
+	if req.CollectionName != "" && req.CollectionName != b.collectionName {
+		b.fail(index, fmt.Errorf("document belongs to collection '%s', not '%s'", req.CollectionName, b.collectionName))
+		return nil
+	}
+
+	// The document must see an earlier version in the batch as its previous version
+	source := req.Source
+	if source == "" {
+		source = req.FilePath
+	}
+	if source != "" && b.sources[source] {
+		if err := b.Flush(); err != nil {
+			return err
+		}
+	}
+
+	prepared, err := b.r.prepareDocument(b.ctx, b.collectionName, req)
+	b.results[index].Source = req.Source
+	if err != nil {
+		b.fail(index, err)
+		return nil
+	}
+	if prepared.doc == nil {
+		b.results[index].IngestResult = *prepared.result
+		return nil
+	}
+
+	b.group = append(b.group, prepared)
+	b.indices = append(b.indices, index)
+	if source != "" {
+		b.sources[source] = true
+	}
+	if len(b.group) >= b.batchSize {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Reject records a document that could not even be read, such as a malformed line of a stream
+func (b *BatchIngester) Reject(err error) {
+	index := len(b.results)
+	b.results = append(b.results, BatchIngestResult{Index: index})
+	b.fail(index, err)
+}
+
+// Flush stores the documents added since the last flush. When the group cannot be stored, each of
+// its documents gets a failed result.
+func (b *BatchIngester) Flush() error {
+	group, indices := b.group, b.indices
+	b.group, b.indices, b.sources = nil, nil, make(map[string]bool)
+	if len(group) == 0 {
+		return nil
+	}
+	startTime := time.Now()
+
+	if err := b.r.storeDocuments(b.ctx, b.collectionName, group); err != nil {
+		if ctxErr := b.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		log.Printf("Failed to store a batch of %d documents in '%s': %v", len(group), b.collectionName, err)
+		for _, index := range indices {
+			b.fail(index, fmt.Errorf("failed to store document: %w", err))
+		}
+		return nil
+	}
+
+	for i, prepared := range group {
+		if err := b.r.finishDocument(b.ctx, b.collectionName, prepared); err != nil {
+			b.results[indices[i]].DocumentID = prepared.doc.ID
+			b.fail(indices[i], err)
+			continue
+		}
+		b.results[indices[i]].IngestResult = *prepared.result
+		b.r.publishIngestion(b.collectionName, prepared.req.Source, prepared.result, nil)
+	}
+
+	log.Printf("Stored a batch of %d documents in '%s' in %v", len(group), b.collectionName, time.Since(startTime))
+	return nil
+}
+
+// Close stores the last group and returns the result of every document, in the order they were added
+func (b *BatchIngester) Close() ([]BatchIngestResult, error) {
+	err := b.Flush()
+	return b.results, err
+}
+
+// fail marks a document of the batch as failed
+func (b *BatchIngester) fail(index int, err error) {
+	b.results[index].Status = IngestFailed
+	b.results[index].Error = err.Error()
+	b.r.publishIngestion(b.collectionName, b.results[index].Source, nil, err)
+}
+
+// storeDocuments embeds the new chunks of a group of documents together and stores the group in
+// one transaction. A chunk repeating the text of an earlier one in the group is stored as its
+// duplicate instead of being embedded again.
+func (r *RAGService) storeDocuments(ctx context.Context, collectionName string, group []*preparedDocument) error {
+	var toEmbed []*models.EnhancedChunk
+	canonical := make(map[string]string) // Content hash to the ID of the group's chunk holding its embedding
+	for _, prepared := range group {
+		prepared.toEmbed = prepared.toEmbed[:0]
+		for _, chunk := range prepared.doc.Chunks {
+			if chunk.DuplicateOf != nil {
+				continue
+			}
+			first, seen := canonical[chunk.ContentHash]
+			if !seen {
+				canonical[chunk.ContentHash] = chunk.ID
+			}
+			if len(chunk.Embedding) > 0 {
+				continue
+			}
+			if seen {
+				chunk.DuplicateOf = &first
+				prepared.result.ChunksDeduplicated++
+				continue
+			}
+			prepared.toEmbed = append(prepared.toEmbed, chunk)
+		}
+		toEmbed = append(toEmbed, prepared.toEmbed...)
+	}
+
+	if len(toEmbed) > 0 {
+		log.Printf("Generating embeddings for %d chunks of %d documents...", len(toEmbed), len(group))
+	}
+	results, stop := r.embedChunksAsync(ctx, toEmbed)
+	defer stop()
+
+	cacheEntries := make(map[string][]float32)
+	defer func() { r.embeddingClient.CacheEmbeddings(cacheEntries) }()
+	for batch := range results {
+		if batch.err != nil {
+			return batch.err
+		}
+		for key, embedding := range batch.cache {
+			cacheEntries[key] = embedding
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	docs := make([]*models.Document, len(group))
+	dimension := 0
+	for i, prepared := range group {
+		docs[i] = prepared.doc
+		for _, chunk := range prepared.doc.Chunks {
+			if len(chunk.Embedding) > 0 {
+				dimension = len(chunk.Embedding)
+			}
+		}
+	}
+	if err := r.vectorDB.addDocuments(ctx, collectionName, docs, dimension); err != nil {
+		return err
+	}
+
+	for _, prepared := range group {
+		prepared.result.ChunksEmbedded = len(prepared.toEmbed)
+		prepared.result.ChunksSplit = splitChunks(prepared.toEmbed)
+	}
+	return nil
+}
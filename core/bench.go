@@ -0,0 +1,323 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// benchCollectionPrefix names the synthetic collections of a benchmark: bench_0, bench_1, ...
+const benchCollectionPrefix = "bench_"
+
+// benchVocabularySize is the number of distinct words synthetic documents and queries draw from
+const benchVocabularySize = 5000
+
+// BenchOptions configures a benchmark run
+type BenchOptions struct {
+	Collections   int   `json:"collections"`    // Synthetic collections to query
+	Documents     int   `json:"documents"`      // Documents per collection
+	DocumentWords int   `json:"document_words"` // Words per document
+	Queries       int   `json:"queries"`        // Queries run in total, spread over the collections
+	Concurrency   int   `json:"concurrency"`    // Queries in flight at a time
+	TopK          int   `json:"top_k"`
+	Generate      bool  `json:"generate"`  // Generate an answer for each query; otherwise only retrieve
+	ANNIndex      bool  `json:"ann_index"` // Search the collections through in-memory ANN indexes
+	Seed          int64 `json:"seed"`      // Same seed, same documents and queries
+}
+
+// BenchLatency summarizes the latencies of one stage of the queries, in milliseconds
+type BenchLatency struct {
+	P50  float64 `json:"p50_ms"`
+	P95  float64 `json:"p95_ms"`
+	P99  float64 `json:"p99_ms"`
+	Mean float64 `json:"mean_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+// BenchIngestion reports how the synthetic collections were filled
+type BenchIngestion struct {
+	Documents          int     `json:"documents"` // Documents added by this run; 0 when the collections were reused
+	Chunks             int     `json:"chunks"`
+	DurationMS         int64   `json:"duration_ms"`
+	DocumentsPerSecond float64 `json:"documents_per_second"`
+}
+
+// BenchReport is the outcome of a benchmark run
+type BenchReport struct {
+	Options    BenchOptions   `json:"options"`
+	Ingestion  BenchIngestion `json:"ingestion"`
+	Queries    int            `json:"queries"` // Queries that succeeded; only they count towards the latencies
+	Failed     int            `json:"failed"`
+	DurationMS int64          `json:"duration_ms"`
+	Throughput float64        `json:"throughput_qps"` // Successful queries per second of the query phase
+	Retrieval  BenchLatency   `json:"retrieval"`
+	Generation *BenchLatency  `json:"generation,omitempty"` // Only when answers were generated
+	Total      BenchLatency   `json:"total"`
+	FirstError string         `json:"first_error,omitempty"`
+}
+
+// Benchmark fills synthetic collections, unless they already hold the requested documents, then
+// runs a query workload against them and reports the latency of retrieval and generation. Queries
+// bypass coalescing and the query log, so each one is measured on its own.
+func (r *RAGService) Benchmark(ctx context.Context, opts BenchOptions) (*BenchReport, error) {
+	if opts.Collections <= 0 || opts.Documents <= 0 || opts.DocumentWords <= 0 || opts.Queries <= 0 || opts.Concurrency <= 0 {
+		return nil, fmt.Errorf("collections, documents, document words, queries and concurrency must be positive")
+	}
+	if opts.TopK <= 0 {
+		opts.TopK = 5
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	vocabulary := benchVocabulary(rng)
+	report := &BenchReport{Options: opts}
+
+	ingestStart := time.Now()
+	for i := 0; i < opts.Collections; i++ {
+		added, chunks, err := r.fillBenchCollection(ctx, fmt.Sprintf("%s%d", benchCollectionPrefix, i), opts, vocabulary, rng)
+		if err != nil {
+			return nil, err
+		}
+		report.Ingestion.Documents += added
+		report.Ingestion.Chunks += chunks
+	}
+	report.Ingestion.DurationMS = time.Since(ingestStart).Milliseconds()
+	if report.Ingestion.Documents > 0 {
+		report.Ingestion.DocumentsPerSecond = float64(report.Ingestion.Documents) / time.Since(ingestStart).Seconds()
+	}
+
+	if opts.ANNIndex {
+		stop, err := r.startBenchANNIndexes(ctx, opts.Collections)
+		if err != nil {
+			return nil, err
+		}
+		defer stop()
+	}
+
+	// Queries are drawn up front, so the workload does not depend on how workers interleave
+	requests := make([]*models.QueryRequest, opts.Queries)
+	for i := range requests {
+		requests[i] = &models.QueryRequest{
+			Query:          benchText(vocabulary, rng, 3+rng.Intn(6)),
+			CollectionName: fmt.Sprintf("%s%d", benchCollectionPrefix, rng.Intn(opts.Collections)),
+			TopK:           opts.TopK,
+		}
+	}
+
+	log.Printf("Running %d queries, %d at a time", opts.Queries, opts.Concurrency)
+	timings := make([]QueryTiming, len(requests))
+	errs := make([]error, len(requests))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	queryStart := time.Now()
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				timings[i], errs[i] = r.benchQuery(ctx, requests[i], opts.Generate)
+			}
+		}()
+	}
+	for i := range requests {
+		if ctx.Err() != nil {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(queryStart)
+
+	var retrieval, generation, total []time.Duration
+	for i, timing := range timings {
+		if errs[i] != nil {
+			report.Failed++
+			if report.FirstError == "" {
+				report.FirstError = errs[i].Error()
+			}
+			continue
+		}
+		retrieval = append(retrieval, timing.Retrieval)
+		generation = append(generation, timing.Generation)
+		total = append(total, timing.Total)
+	}
+	report.Queries = len(total)
+	report.DurationMS = elapsed.Milliseconds()
+	report.Throughput = float64(report.Queries) / elapsed.Seconds()
+	report.Retrieval = benchLatency(retrieval)
+	report.Total = benchLatency(total)
+	if opts.Generate {
+		latency := benchLatency(generation)
+		report.Generation = &latency
+	}
+	return report, nil
+}
+
+// fillBenchCollection creates a synthetic collection and adds its documents. A collection that
+// already holds the requested number of documents is reused as it is, so runs against the same
+// database skip ingestion.
+func (r *RAGService) fillBenchCollection(ctx context.Context, name string, opts BenchOptions, vocabulary []string, rng *rand.Rand) (added, chunks int, err error) {
+	// Documents are drawn even for a reused collection, so the queries that follow stay the same
+	texts := make([]string, opts.Documents)
+	for i := range texts {
+		texts[i] = benchDocument(vocabulary, rng, opts.DocumentWords)
+	}
+
+	if stats, err := r.vectorDB.GetCollectionStats(name); err == nil {
+		count, _ := stats["document_count"].(int)
+		if count == opts.Documents {
+			log.Printf("Reusing collection '%s' with %d documents", name, count)
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("collection '%s' exists with %d documents instead of %d; use another database", name, count, opts.Documents)
+	}
+	if err := r.vectorDB.CreateCollection(name, "Synthetic benchmark collection", nil, nil); err != nil {
+		return 0, 0, err
+	}
+
+	log.Printf("Adding %d documents to '%s'", opts.Documents, name)
+	ingester := r.NewBatchIngester(ctx, name, 0)
+	for i, text := range texts {
+		if err := ingester.Add(&models.AddDocumentRequest{Content: text, Source: fmt.Sprintf("bench-%d.txt", i)}); err != nil {
+			return 0, 0, err
+		}
+	}
+	results, err := ingester.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			return 0, 0, fmt.Errorf("failed to add synthetic document: %s", result.Error)
+		}
+		chunks += result.ChunksEmbedded + result.ChunksReused + result.ChunksDeduplicated
+	}
+	return len(results), chunks, nil
+}
+
+// startBenchANNIndexes builds ANN indexes of the synthetic collections and installs them for the
+// query phase. The returned function removes them again.
+func (r *RAGService) startBenchANNIndexes(ctx context.Context, collections int) (func(), error) {
+	cfg := config.AppConfig.ANNIndex
+	cfg.Collections = nil
+	for i := 0; i < collections; i++ {
+		cfg.Collections = append(cfg.Collections, config.ANNCollection{
+			Collection: fmt.Sprintf("%s%d", benchCollectionPrefix, i),
+			Tenant:     r.vectorDB.tenant,
+		})
+	}
+	indexes, err := NewANNIndexes(r.vectorDB, cfg)
+	if err != nil {
+		return nil, err
+	}
+	previous := annIndexes
+	SetANNIndexes(indexes)
+	indexes.Start()
+	stop := func() {
+		SetANNIndexes(previous)
+		indexes.Stop()
+	}
+	if err := indexes.Wait(ctx); err != nil {
+		stop()
+		return nil, err
+	}
+	return stop, nil
+}
+
+// benchQuery runs one query of the workload and returns its timing
+func (r *RAGService) benchQuery(ctx context.Context, req *models.QueryRequest, generate bool) (QueryTiming, error) {
+	if generate {
+		outcome, err := r.runQuery(ctx, req)
+		if err != nil {
+			return QueryTiming{}, err
+		}
+		return outcome.timing, nil
+	}
+
+	start := time.Now()
+	if _, err := r.Retrieve(ctx, req); err != nil {
+		return QueryTiming{}, err
+	}
+	elapsed := time.Since(start)
+	return QueryTiming{Retrieval: elapsed, Total: elapsed}, nil
+}
+
+// benchLatency computes the percentiles of a set of latencies, by nearest rank
+func benchLatency(durations []time.Duration) BenchLatency {
+	if len(durations) == 0 {
+		return BenchLatency{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) float64 {
+		rank := int(p*float64(len(sorted))+0.999999) - 1
+		return milliseconds(sorted[min(max(rank, 0), len(sorted)-1)])
+	}
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	return BenchLatency{
+		P50:  percentile(0.50),
+		P95:  percentile(0.95),
+		P99:  percentile(0.99),
+		Mean: milliseconds(sum / time.Duration(len(sorted))),
+		Max:  milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+// benchVocabulary makes up the words of synthetic texts from random syllables
+func benchVocabulary(rng *rand.Rand) []string {
+	syllables := strings.Fields("ka lo mi ne ta ri su ve do pa zu fe no gi ra tu se ko ma li")
+	seen := make(map[string]bool, benchVocabularySize)
+	words := make([]string, 0, benchVocabularySize)
+	for len(words) < benchVocabularySize {
+		var b strings.Builder
+		for n := 2 + rng.Intn(3); n > 0; n-- {
+			b.WriteString(syllables[rng.Intn(len(syllables))])
+		}
+		if word := b.String(); !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// benchText draws n words, common ones more often as in natural text
+func benchText(vocabulary []string, rng *rand.Rand, n int) string {
+	zipf := rand.NewZipf(rng, 1.1, 1, uint64(len(vocabulary)-1))
+	words := make([]string, n)
+	for i := range words {
+		words[i] = vocabulary[zipf.Uint64()]
+	}
+	return strings.Join(words, " ")
+}
+
+// benchDocument draws a document of sentences of 8 to 20 words, in paragraphs of 5 sentences
+func benchDocument(vocabulary []string, rng *rand.Rand, words int) string {
+	var b strings.Builder
+	for sentence := 0; words > 0; sentence++ {
+		if sentence > 0 {
+			if sentence%5 == 0 {
+				b.WriteString("\n\n")
+			} else {
+				b.WriteString(" ")
+			}
+		}
+		n := min(8+rng.Intn(13), words)
+		text := benchText(vocabulary, rng, n)
+		b.WriteString(strings.ToUpper(text[:1]) + text[1:] + ".")
+		words -= n
+	}
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"rag-go-app/models"
+	"strings"
+	"time"
+)
+
+// benchEmbeddingDimension is the dimension of the embeddings of the mock model server
+const benchEmbeddingDimension = 384
+
+// BenchModelServer is an OpenAI-compatible model server answering on the loopback address, for
+// benchmarks that measure this server without a real model. Embeddings hash the words of a text,
+// so texts sharing words are similar; chat completions return a fixed answer.
+type BenchModelServer struct {
+	URL string // Base URL to use as llamacpp_base_url
+
+	latency time.Duration
+	server  *http.Server
+}
+
+// StartBenchModelServer starts a mock model server that waits latency before each response
+func StartBenchModelServer(latency time.Duration) (*BenchModelServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &BenchModelServer{URL: "http://" + listener.Addr().String(), latency: latency}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/embeddings", s.embeddings)
+	mux.HandleFunc("/chat/completions", s.chatCompletions)
+	mux.HandleFunc("/models", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"object": "list", "data": []interface{}{}})
+	})
+	s.server = &http.Server{Handler: mux}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// Stop shuts the server down
+func (s *BenchModelServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.server.Shutdown(ctx)
+}
+
+// wait delays a response by the configured latency, or until the request goes away
+func (s *BenchModelServer) wait(r *http.Request) {
+	if s.latency <= 0 {
+		return
+	}
+	select {
+	case <-time.After(s.latency):
+	case <-r.Context().Done():
+	}
+}
+
+func (s *BenchModelServer) embeddings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input []string `json:"input"`
+		Model string   `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.wait(r)
+
+	resp := models.EmbeddingAPIResponse{Model: req.Model, Object: "list"}
+	for i, text := range req.Input {
+		resp.Data = append(resp.Data, models.EmbeddingResponseData{Embedding: benchEmbedding(text), Index: i, Object: "embedding"})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *BenchModelServer) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req models.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.wait(r)
+
+	resp := models.ChatCompletionResponse{
+		ID:      "bench",
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []models.ChatChoice{{
+			Message:      models.ChatCompletionMessage{Role: "assistant", Content: "This is a benchmark answer based on the context [1]."},
+			FinishReason: "stop",
+		}},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// benchEmbedding counts the words of a text into hashed dimensions and normalizes the counts
+func benchEmbedding(text string) []float32 {
+	embedding := make([]float32, benchEmbeddingDimension)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		h := fnv.New32a()
+		h.Write([]byte(strings.Trim(word, ".,;:!?")))
+		embedding[h.Sum32()%benchEmbeddingDimension]++
+	}
+	var norm float64
+	for _, v := range embedding {
+		norm += float64(v * v)
+	}
+	if norm == 0 {
+		embedding[0] = 1
+		return embedding
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range embedding {
+		embedding[i] *= scale
+	}
+	return embedding
+}
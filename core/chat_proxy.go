@@ -0,0 +1,241 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+	"time"
+)
+
+// chatProxyPrompt introduces the retrieved context injected into proxied conversations
+const chatProxyPrompt = `Use the context below to answer the user's latest message when it is relevant. If the context doesn't contain the answer, say so rather than guessing. Cite the contexts you use by number in square brackets, e.g. [1] or [2, 3].
+
+Context:
+%s`
+
+// ProxiedChat is an OpenAI chat completion request received by the proxy. Fields the proxy
+// doesn't understand, such as temperature or tools, are forwarded to the model server untouched.
+type ProxiedChat struct {
+	Model  string
+	Stream bool
+
+	// RAG holds the retrieval options of the "rag" field, which is removed before forwarding.
+	// Its Query is the latest user message.
+	RAG       models.QueryRequest
+	RAGFields map[string]bool // Fields set in "rag", so collection defaults don't override them
+
+	fields   map[string]json.RawMessage
+	messages []map[string]json.RawMessage
+}
+
+// ParseProxiedChat reads a chat completion request and the text of its latest user message
+func ParseProxiedChat(body []byte) (*ProxiedChat, error) {
+	p := &ProxiedChat{RAGFields: make(map[string]bool)}
+	if err := json.Unmarshal(body, &p.fields); err != nil {
+		return nil, fmt.Errorf("invalid chat completion request: %w", err)
+	}
+	if err := json.Unmarshal(p.fields["messages"], &p.messages); err != nil || len(p.messages) == 0 {
+		return nil, fmt.Errorf("invalid chat completion request: messages must be a non-empty array")
+	}
+	if raw, ok := p.fields["model"]; ok {
+		json.Unmarshal(raw, &p.Model)
+	}
+	if raw, ok := p.fields["stream"]; ok {
+		json.Unmarshal(raw, &p.Stream)
+	}
+
+	if raw, ok := p.fields["rag"]; ok {
+		if err := json.Unmarshal(raw, &p.RAG); err != nil {
+			return nil, fmt.Errorf("invalid rag options: %w", err)
+		}
+		var ragFields map[string]json.RawMessage
+		json.Unmarshal(raw, &ragFields)
+		for field := range ragFields {
+			p.RAGFields[field] = true
+		}
+		delete(p.fields, "rag")
+	}
+	if p.RAG.CollectionName == "" {
+		p.RAG.CollectionName = config.AppConfig.ChatProxy.Collection
+	}
+
+	for i := len(p.messages) - 1; i >= 0; i-- {
+		if messageRole(p.messages[i]) == "user" {
+			p.RAG.Query = messageText(p.messages[i]["content"])
+			break
+		}
+	}
+	if strings.TrimSpace(p.RAG.Query) == "" {
+		return nil, fmt.Errorf("invalid chat completion request: messages must include a user message with text")
+	}
+	return p, nil
+}
+
+// messageRole returns the role of a raw chat message
+func messageRole(message map[string]json.RawMessage) string {
+	var role string
+	json.Unmarshal(message["role"], &role)
+	return role
+}
+
+// messageText returns the text of a message's content, which is either a string or an array of
+// typed parts of which only the text ones count
+func messageText(content json.RawMessage) string {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return text
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(content, &parts)
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// InjectContext adds retrieved context to the conversation: appended to a leading system message
+// with text content, or as a new system message in front, since many chat templates only accept
+// a system message at the start
+func (p *ProxiedChat) InjectContext(promptContext string) {
+	prompt := fmt.Sprintf(chatProxyPrompt, promptContext)
+
+	if first := p.messages[0]; messageRole(first) == "system" {
+		var text string
+		if json.Unmarshal(first["content"], &text) == nil {
+			first["content"], _ = json.Marshal(text + "\n\n" + prompt)
+			return
+		}
+	}
+
+	content, _ := json.Marshal(prompt)
+	system := map[string]json.RawMessage{"role": json.RawMessage(`"system"`), "content": content}
+	p.messages = append([]map[string]json.RawMessage{system}, p.messages...)
+}
+
+// Body returns the request to forward to the model server, with the chat model filled in if the
+// client sent none
+func (p *ProxiedChat) Body() ([]byte, error) {
+	if p.Model == "" {
+		p.Model = config.AppConfig.ChatModel
+	}
+	p.fields["model"], _ = json.Marshal(p.Model)
+
+	messages, err := json.Marshal(p.messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chat messages: %w", err)
+	}
+	p.fields["messages"] = messages
+	return json.Marshal(p.fields)
+}
+
+// Messages returns the conversation as plain text messages, for providers that can't forward the
+// request as is
+func (p *ProxiedChat) Messages() []models.ChatCompletionMessage {
+	messages := make([]models.ChatCompletionMessage, len(p.messages))
+	for i, message := range p.messages {
+		messages[i] = models.ChatCompletionMessage{Role: messageRole(message), Content: messageText(message["content"])}
+	}
+	return messages
+}
+
+// AugmentChat retrieves context for the latest user message of a proxied conversation and injects
+// it. A conversation nothing relevant was found for is forwarded unchanged.
+func (r *RAGService) AugmentChat(ctx context.Context, p *ProxiedChat) (*RetrievalResult, error) {
+	startTime := time.Now()
+	retrieved, err := r.Retrieve(ctx, &p.RAG)
+	if err != nil {
+		return nil, err
+	}
+	// The answer comes from the model server, so only retrieval is timed
+	elapsed := time.Since(startTime)
+	r.LogQuery(QueryLogChat, &p.RAG, retrieved.Chunks, "", QueryTiming{Retrieval: elapsed, Total: elapsed})
+	if len(retrieved.Chunks) > 0 {
+		p.InjectContext(r.prepareContext(retrieved.Chunks))
+	}
+	return retrieved, nil
+}
+
+// SupportsChatPassthrough reports whether the configured provider speaks the OpenAI chat API, so
+// proxied requests can be forwarded with all their options and streamed back
+func SupportsChatPassthrough() bool {
+	provider, err := CurrentProvider()
+	if err != nil {
+		return false
+	}
+	_, ok := provider.(openAIProvider)
+	return ok
+}
+
+// ForwardChatCompletion sends a proxied request to the model server's /chat/completions endpoint
+// and returns its response for the caller to relay. Connection errors and 5xx responses are retried
+// and failed over like any chat completion, so only the response of the last server tried may be
+// a 5xx. The chat timeout covers reading the body, so closing it releases the request.
+func ForwardChatCompletion(ctx context.Context, body []byte) (*http.Response, error) {
+	var resp, failed *http.Response
+	err := callModelServer(ctx, 0, func(ctx context.Context, provider Provider) error {
+		if failed != nil {
+			failed.Body.Close()
+			failed = nil
+		}
+
+		server, ok := provider.(openAIProvider)
+		if !ok {
+			return fmt.Errorf("the %s provider does not support chat passthrough", config.AppConfig.Provider)
+		}
+
+		ctx, cancel := withStageTimeout(ctx, config.AppConfig.Timeouts.ChatSeconds)
+		apiURL := fmt.Sprintf("%s/chat/completions", server.baseURL)
+		req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(body))
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to create chat completion request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		r, err := httpClient.Do(req)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to call chat completion API: %w", err)
+		}
+		r.Body = cancelOnClose{r.Body, cancel}
+		if r.StatusCode >= http.StatusInternalServerError {
+			// Kept open so it can still be relayed if no server does better
+			failed = r
+			return &backendStatusError{r.StatusCode, fmt.Sprintf("chat completion API request failed with status %s", r.Status)}
+		}
+		resp = r
+		return nil
+	})
+	if resp != nil {
+		return resp, nil
+	}
+	if failed != nil {
+		return failed, nil
+	}
+	return nil, err
+}
+
+// cancelOnClose releases a request's context once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+)
+
+// interruptedStreamError reports a streamed completion that failed after part of the reply was
+// passed on. It hides the cause from isTransientBackendError, as a retry would repeat that part.
+type interruptedStreamError struct {
+	err error
+}
+
+func (e *interruptedStreamError) Error() string {
+	return "chat completion stream interrupted: " + e.err.Error()
+}
+
+// StreamChatCompletion generates a reply like GenerateChatCompletion, passing each piece of it to
+// onToken as the model server produces it, and returns the whole reply. Failures before the first
+// piece are retried and failed over as usual; a stream that breaks later is not.
+func StreamChatCompletion(ctx context.Context, messages []models.ChatCompletionMessage, gen models.GenerationOptions, onToken func(string)) (string, error) {
+	if gen.Model == "" {
+		gen.Model = config.AppConfig.ChatModel
+	}
+	if gen.SystemPrompt != "" {
+		messages = append([]models.ChatCompletionMessage{{Role: "system", Content: gen.SystemPrompt}}, messages...)
+	}
+
+	ctx, span := StartSpan(ctx, "StreamChatCompletion", SpanKindClient)
+	span.SetAttribute("gen_ai.request.model", gen.Model)
+	span.SetAttribute("rag.messages", len(messages))
+
+	var reply strings.Builder
+	err := callModelServer(ctx, config.AppConfig.Timeouts.ChatSeconds, func(ctx context.Context, provider Provider) error {
+		err := provider.StreamChatCompletion(ctx, messages, gen, func(token string) {
+			reply.WriteString(token)
+			onToken(token)
+		})
+		if err != nil && reply.Len() > 0 {
+			return &interruptedStreamError{err}
+		}
+		return err
+	})
+	span.End(err)
+	return reply.String(), err
+}
+
+// StreamChatCompletion calls the OpenAI-compatible /chat/completions endpoint with streaming on. A
+// server that answers with a whole completion instead passes it on as one piece.
+func (p openAIProvider) StreamChatCompletion(ctx context.Context, messages []models.ChatCompletionMessage, gen models.GenerationOptions, onToken func(string)) error {
+	payloadBytes, err := json.Marshal(models.ChatCompletionRequest{
+		Model:       gen.Model,
+		Messages:    messages,
+		Stream:      true,
+		Temperature: gen.Temperature,
+		TopP:        gen.TopP,
+		MaxTokens:   gen.MaxTokens,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal chat completion request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create chat completion request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call chat completion API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &backendStatusError{resp.StatusCode, fmt.Sprintf("chat completion API request failed with status %s: %s", resp.Status, string(body))}
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var completion models.ChatCompletionResponse
+		if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+			return fmt.Errorf("failed to decode chat completion API response: %w", err)
+		}
+		if len(completion.Choices) == 0 {
+			return fmt.Errorf("no choices returned from chat completion API")
+		}
+		onToken(completion.Choices[0].Message.Content)
+		return nil
+	}
+
+	// Each event is a "data:" line holding a chunk, and the stream ends with "data: [DONE]"
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:"); ok {
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				return nil
+			}
+			var chunk models.ChatCompletionChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return fmt.Errorf("failed to decode chat completion chunk: %w", err)
+			}
+			if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+				onToken(chunk.Choices[0].Delta.Content)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read chat completion stream: %w", err)
+		}
+	}
+}
+
+// StreamChatCompletion calls /api/chat with streaming on, which answers with one JSON object per
+// line until one is marked done
+func (p ollamaProvider) StreamChatCompletion(ctx context.Context, messages []models.ChatCompletionMessage, gen models.GenerationOptions, onToken func(string)) error {
+	req := models.OllamaChatRequest{Model: gen.Model, Messages: messages, Stream: true}
+	if gen.Temperature != nil || gen.TopP != nil || gen.MaxTokens > 0 {
+		req.Options = &models.OllamaOptions{Temperature: gen.Temperature, TopP: gen.TopP, NumPredict: gen.MaxTokens}
+	}
+	resp, err := p.open(ctx, "/api/chat", req)
+	if err != nil {
+		return fmt.Errorf("chat completion API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk struct {
+			models.OllamaChatResponse
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read chat completion stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("chat completion stream failed: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			onToken(chunk.Message.Content)
+		}
+		if chunk.Done {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	questionChunkType = "question"
+	questionsPerChunk = 3 // Most questions kept per chunk
+)
+
+// questionPrompt asks the chat model for the questions a passage answers
+const questionPrompt = `Write 2 or 3 questions that a user might ask and that the following passage from the document "%s" answers. Phrase them the way a person would ask, not with the passage's wording, and make each one understandable without the passage.
+
+Output only the questions, one per line.
+
+%s`
+
+// questionPrefix matches list markers and numbering models put before questions
+var questionPrefix = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)]|Q\d*[:.])\s*`)
+
+// QuestionStats counts the questions generated for the chunks of a document
+type QuestionStats struct {
+	Questions int
+	Failed    int // Chunks the chat model returned no questions for
+}
+
+// generateChunkQuestions asks the chat model for the questions each chunk of a document answers,
+// and adds every question as a chunk of type "question" pointing back to its chunk in question_for.
+// Questions are embedded like any other chunk; retrieval replaces a matched question with its
+// chunk, so queries phrased unlike the document still find it. Chunks of the previous version
+// with the same text keep their questions without asking the chat model again.
+func (r *RAGService) generateChunkQuestions(ctx context.Context, doc *models.Document, previousID string) (*QuestionStats, error) {
+	previous := make(map[string][]string)
+	if previousID != "" {
+		var err error
+		if previous, err = r.vectorDB.chunkQuestions(previousID); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := &QuestionStats{}
+	var added []*models.EnhancedChunk
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, summaryWorkers)
+	for _, chunk := range doc.Chunks {
+		// Parents repeat their children, and summaries answer broad questions already
+		if len(chunk.ChildChunkIDs) > 0 || chunk.ChunkType == summaryChunkType {
+			continue
+		}
+		hash := ContentHash([]byte(chunk.Text))
+		if questions, ok := previous[hash]; ok {
+			added = append(added, questionChunks(doc, chunk, hash, questions)...)
+			stats.Questions += len(questions)
+			continue
+		}
+
+		wg.Add(1)
+		go func(chunk *models.EnhancedChunk) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			if ctx.Err() != nil {
+				return
+			}
+
+			response, err := r.llmClient.GenerateResponse(ctx, fmt.Sprintf(questionPrompt, doc.Source, chunk.Text))
+			questions := parseQuestions(response)
+			if err == nil && len(questions) == 0 {
+				err = fmt.Errorf("no questions in model response")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("Generating questions for a chunk of '%s' failed: %v", doc.Source, err)
+				stats.Failed++
+				return
+			}
+			added = append(added, questionChunks(doc, chunk, hash, questions)...)
+			stats.Questions += len(questions)
+		}(chunk)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, question := range added {
+		question.ChunkIndex = len(doc.Chunks) + i
+	}
+	doc.Chunks = append(doc.Chunks, added...)
+
+	log.Printf("Generated %d questions for the chunks of '%s' (%d failed)", stats.Questions, doc.Source, stats.Failed)
+	return stats, nil
+}
+
+// parseQuestions reads one question per line of a model response, without list markers, keeping
+// at most questionsPerChunk
+func parseQuestions(response string) []string {
+	var questions []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(response, "\n") {
+		question := strings.TrimSpace(questionPrefix.ReplaceAllString(line, ""))
+		key := strings.ToLower(question)
+		if len(question) < 5 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		questions = append(questions, question)
+		if len(questions) == questionsPerChunk {
+			break
+		}
+	}
+	return questions
+}
+
+// questionChunks returns the question chunks of a chunk. They share its section and metadata, so
+// filters select them alike, but not its table description, which would be embedded with them.
+func questionChunks(doc *models.Document, chunk *models.EnhancedChunk, hash string, questions []string) []*models.EnhancedChunk {
+	chunks := make([]*models.EnhancedChunk, len(questions))
+	for i, question := range questions {
+		metadata := make(map[string]interface{}, len(chunk.Metadata)+2)
+		for key, value := range chunk.Metadata {
+			if key != "table_summary" {
+				metadata[key] = value
+			}
+		}
+		metadata["question_for"] = chunk.ID
+		metadata["question_source_hash"] = hash
+
+		chunks[i] = &models.EnhancedChunk{
+			ID:         uuid.New().String(),
+			DocumentID: doc.ID,
+			Text:       question,
+			Section:    chunk.Section,
+			Subsection: chunk.Subsection,
+			ChunkType:  questionChunkType,
+			StartPos:   chunk.StartPos,
+			EndPos:     chunk.EndPos,
+			Metadata:   metadata,
+			Confidence: chunk.Confidence,
+		}
+	}
+	return chunks
+}
+
+// resolveQuestions replaces the question chunks among search results with the chunks they were
+// generated from, which record the question in matched_question. A chunk reached several times
+// keeps its first position and score.
+func (r *RAGService) resolveQuestions(chunks []*models.EnhancedChunk, scores []float64) ([]*models.EnhancedChunk, []float64, error) {
+	var sourceIDs []string
+	requested := make(map[string]bool)
+	for _, chunk := range chunks {
+		if chunk.ChunkType != questionChunkType {
+			continue
+		}
+		if id, _ := chunk.Metadata["question_for"].(string); id != "" && !requested[id] {
+			requested[id] = true
+			sourceIDs = append(sourceIDs, id)
+		}
+	}
+	if len(sourceIDs) == 0 {
+		return chunks, scores, nil
+	}
+
+	loaded, err := r.vectorDB.getChunksByIDs(sourceIDs, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	sources := make(map[string]*models.EnhancedChunk, len(loaded))
+	for _, source := range loaded {
+		sources[source.ID] = source
+	}
+
+	var resolved []*models.EnhancedChunk
+	var resolvedScores []float64
+	seen := make(map[string]bool)
+	for i, chunk := range chunks {
+		result := chunk
+		if chunk.ChunkType == questionChunkType {
+			id, _ := chunk.Metadata["question_for"].(string)
+			source := sources[id]
+			if source == nil {
+				continue // The chunk was removed since; its questions go with it on the next update
+			}
+			if !seen[source.ID] {
+				if source.Metadata == nil {
+					source.Metadata = make(map[string]interface{})
+				}
+				source.Metadata["matched_question"] = chunk.Text
+				source.Collection = chunk.Collection
+			}
+			result = source
+		}
+		if !seen[result.ID] {
+			seen[result.ID] = true
+			resolved = append(resolved, result)
+			resolvedScores = append(resolvedScores, scores[i])
+		}
+	}
+	return resolved, resolvedScores, nil
+}
+
+// chunkQuestions returns the questions stored for the chunks of a document, keyed by the hash of
+// the chunk text they were generated from
+func (db *VectorDB) chunkQuestions(documentID string) (map[string][]string, error) {
+	rows, err := db.conn.Query(`SELECT json_extract(metadata, '$.question_source_hash'), rag_open(text) FROM enhanced_chunks
+		WHERE document_id = ? AND tenant_id = ? AND chunk_type = ? ORDER BY chunk_index`, documentID, db.tenant, questionChunkType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read previous questions: %w", err)
+	}
+	defer rows.Close()
+
+	questions := make(map[string][]string)
+	for rows.Next() {
+		var hash *string
+		var text string
+		if err := rows.Scan(&hash, &text); err != nil {
+			return nil, fmt.Errorf("failed to scan previous question: %w", err)
+		}
+		if hash != nil {
+			questions[*hash] = append(questions[*hash], text)
+		}
+	}
+	return questions, rows.Err()
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"log"
+	"rag-go-app/models"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Chunk positions are rune offsets into the document content, and the text of a chunk is the
+// content between them, so highlights, citations and previews can point into the document.
+// Chunkers find byte spans of the text they split and convert them with a runeCounter.
+
+// runeCounter converts byte offsets of a text into rune offsets. It counts from the offset it
+// converted last, so a chunker converting offsets in document order counts each rune about once.
+type runeCounter struct {
+	text  string
+	bytes int
+	runes int
+}
+
+// newRuneCounter returns a runeCounter for text
+func newRuneCounter(text string) *runeCounter {
+	return &runeCounter{text: text}
+}
+
+// at returns the rune offset of a byte offset of the text
+func (c *runeCounter) at(offset int) int {
+	if offset >= c.bytes {
+		c.runes += utf8.RuneCountInString(c.text[c.bytes:offset])
+	} else {
+		c.runes -= utf8.RuneCountInString(c.text[offset:c.bytes])
+	}
+	c.bytes = offset
+	return c.runes
+}
+
+// span returns the rune offsets of a byte span of the text
+func (c *runeCounter) span(start, end int) (int, int) {
+	return c.at(start), c.at(end)
+}
+
+// trimSpan narrows a byte span of text to leave out surrounding whitespace
+func trimSpan(text string, start, end int) (int, int) {
+	segment := text[start:end]
+	trimmed := strings.TrimLeftFunc(segment, unicode.IsSpace)
+	start += len(segment) - len(trimmed)
+	return start, start + len(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+}
+
+// trimRunes narrows a span of runes to leave out surrounding whitespace
+func trimRunes(runes []rune, start, end int) (int, int) {
+	for start < end && unicode.IsSpace(runes[start]) {
+		start++
+	}
+	for end > start && unicode.IsSpace(runes[end-1]) {
+		end--
+	}
+	return start, end
+}
+
+// paragraphSpans returns the byte spans of the paragraphs of text, the runs of text between blank
+// lines, trimmed of surrounding whitespace. Blank paragraphs are left out.
+func paragraphSpans(text string) [][2]int {
+	var spans [][2]int
+	add := func(start, end int) {
+		if start, end = trimSpan(text, start, end); start < end {
+			spans = append(spans, [2]int{start, end})
+		}
+	}
+
+	start := 0
+	for {
+		index := strings.Index(text[start:], "\n\n")
+		if index < 0 {
+			break
+		}
+		add(start, start+index)
+		start += index + 2
+	}
+	add(start, len(text))
+	return spans
+}
+
+// groupParagraphs groups consecutive paragraphs of text into chunks, returning the byte span of
+// each group. A group ends at the paragraph where closes accepts its size, in runes from the start
+// of its first paragraph to the end of this one; last reports whether no paragraph follows.
+// Paragraphs after the last group that closes are dropped.
+func groupParagraphs(text string, paragraphs [][2]int, closes func(size int, last bool) bool) [][2]int {
+	var groups [][2]int
+	start := -1
+	for i, paragraph := range paragraphs {
+		if start < 0 {
+			start = paragraph[0]
+		}
+		if closes(utf8.RuneCountInString(text[start:paragraph[1]]), i == len(paragraphs)-1) {
+			groups = append(groups, [2]int{start, paragraph[1]})
+			start = -1
+		}
+	}
+	return groups
+}
+
+// derivedChunkTypes are the chunk types whose text isn't a span of the document: summaries and
+// questions are written by the chat model, and transcript chunks name the speaker of their first
+// cue. Their positions mark the part of the document they stand for.
+var derivedChunkTypes = map[string]bool{
+	summaryChunkType:    true,
+	questionChunkType:   true,
+	transcriptChunkType: true,
+}
+
+// verifyChunkSpans checks that the text of every chunk is the document content between its
+// positions. A chunk whose text is elsewhere in the content moves to the occurrence nearest its
+// recorded start; one whose text isn't in the content keeps its positions and is counted in the
+// document's unverified_spans metadata, so highlighting falls back to searching for it.
+func verifyChunkSpans(doc *models.Document) {
+	runes := []rune(doc.Content)
+	moved, unverified := 0, 0
+	for _, chunk := range doc.Chunks {
+		if derivedChunkTypes[chunk.ChunkType] || chunk.Text == "" {
+			continue
+		}
+		if chunk.StartPos >= 0 && chunk.StartPos <= chunk.EndPos && chunk.EndPos <= len(runes) &&
+			string(runes[chunk.StartPos:chunk.EndPos]) == chunk.Text {
+			continue
+		}
+
+		start := nearestOccurrence(doc.Content, chunk.Text, chunk.StartPos)
+		if start < 0 {
+			unverified++
+			continue
+		}
+		chunk.StartPos = start
+		chunk.EndPos = start + utf8.RuneCountInString(chunk.Text)
+		moved++
+	}
+
+	if moved > 0 {
+		log.Printf("Moved %d chunks of %s to where their text is in the document", moved, doc.Source)
+	}
+	if unverified > 0 {
+		doc.Metadata["unverified_spans"] = unverified
+		log.Printf("Warning: %d chunks of %s have text not found in the document", unverified, doc.Source)
+	}
+}
+
+// nearestOccurrence returns the rune offset of the occurrence of text in content nearest to a rune
+// offset, or -1 when content doesn't contain it
+func nearestOccurrence(content, text string, near int) int {
+	counter := newRuneCounter(content)
+	best := -1
+	for from := 0; from < len(content); {
+		index := strings.Index(content[from:], text)
+		if index < 0 {
+			break
+		}
+		start := counter.at(from + index)
+		if best < 0 || abs(start-near) < abs(best-near) {
+			best = start
+		}
+		if start >= near {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(content[from+index:])
+		from += index + size
+	}
+	return best
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"fmt"
+	"rag-go-app/models"
+	"strings"
+	"testing"
+)
+
+// spanContents returns documents in several scripts, with multibyte runes of one to four bytes and
+// runes that combine with the one before them, each long enough to need several chunks. With
+// markdown, their headings are Markdown headings.
+func spanContents(markdown bool) map[string]string {
+	return map[string]string{
+		"ascii": spanDocument(markdown, "Section %d",
+			"The quick brown fox jumps over the lazy dog near paragraph %d. It keeps running until it reaches the river bank. "+
+				"Then it rests for a while in the shade of an old oak tree."),
+		"cjk": spanDocument(markdown, "第%d章",
+			"这是第%d段的内容，讲述了一只敏捷的狐狸跳过懒狗的故事。它一直跑到河边才停下来。然后它在一棵老橡树的树荫下休息了一会儿。"+
+				"日本語の文章も混ざっています。"),
+		"emoji": spanDocument(markdown, "Part %d 🚀",
+			"Launch day %d 🚀 went well 👍🏽 and the team celebrated 🎉🎉. Family emoji 👨‍👩‍👧‍👦 join in. "+
+				"Flags 🇳🇱🇯🇵 wave while the rocket climbs higher and higher into the sky."),
+		"combining": spanDocument(markdown, "Chapitre %d",
+			"Le café numéro %d servait des crèmes brûlées. Anäis y allait chaque matin. "+
+				"Z̵a̶l̷g̸o̴ text stacks marks on every letter without spaces between them."),
+	}
+}
+
+// spanDocument builds a document of headed sections, each with several paragraphs
+func spanDocument(markdown bool, heading, paragraph string) string {
+	if markdown {
+		heading = "## " + heading
+	}
+	var b strings.Builder
+	for section := 1; section <= 4; section++ {
+		b.WriteString(fmt.Sprintf(heading, section) + "\n\n")
+		for i := 1; i <= 5; i++ {
+			b.WriteString(fmt.Sprintf(paragraph, section*10+i) + "\n\n")
+		}
+	}
+	return b.String()
+}
+
+// checkSpans fails the test for every chunk whose text isn't the content between its positions
+func checkSpans(t *testing.T, content string, chunks []*models.EnhancedChunk) {
+	t.Helper()
+	runes := []rune(content)
+	for _, chunk := range chunks {
+		if derivedChunkTypes[chunk.ChunkType] {
+			continue
+		}
+		if chunk.StartPos < 0 || chunk.StartPos > chunk.EndPos || chunk.EndPos > len(runes) {
+			t.Errorf("chunk %d (%s) has span [%d, %d) outside the %d runes of the content",
+				chunk.ChunkIndex, chunk.ChunkType, chunk.StartPos, chunk.EndPos, len(runes))
+			continue
+		}
+		if got := string(runes[chunk.StartPos:chunk.EndPos]); got != chunk.Text {
+			t.Errorf("chunk %d (%s) span [%d, %d) is %q, want its text %q",
+				chunk.ChunkIndex, chunk.ChunkType, chunk.StartPos, chunk.EndPos, got, chunk.Text)
+		}
+	}
+}
+
+func TestChunkerSpans(t *testing.T) {
+	chunkers := map[string]func(content string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error){
+		"fixed_size": func(content string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
+			return createFixedSizeChunks(content, "doc", config)
+		},
+		"semantic": func(content string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
+			return createSemanticChunks(content, "doc", config)
+		},
+		"structural": func(content string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
+			return createIntelligentStructuralChunks(content, "doc", config, analyzeDocument(content))
+		},
+		"sentence_window": func(content string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
+			return createSentenceWindowChunks(content, "doc", config)
+		},
+		"parent_document": func(content string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
+			return createParentDocumentChunks(content, "doc", config)
+		},
+		"minimal": func(content string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
+			return createMinimalChunks(content, "doc", config)
+		},
+	}
+
+	for strategy, chunk := range chunkers {
+		for script, content := range spanContents(false) {
+			t.Run(strategy+"/"+script, func(t *testing.T) {
+				config := StrategyChunkingConfig(models.ChunkingStrategy(strategy))
+				config.FixedSize, config.MinChunkSize, config.MaxChunkSize = 200, 50, 400
+				chunks, err := chunk(content, config)
+				if err != nil {
+					t.Fatalf("chunking failed: %v", err)
+				}
+				if len(chunks) < 2 {
+					t.Fatalf("got %d chunks, want several", len(chunks))
+				}
+				checkSpans(t, content, chunks)
+			})
+		}
+	}
+}
+
+func TestProcessedDocumentSpans(t *testing.T) {
+	sources := map[string]string{"text": "doc.txt", "markdown": "doc.md"}
+	strategies := []models.ChunkingStrategy{models.FixedSizeStrategy, models.SemanticStrategy,
+		models.StructuralStrategy, models.SentenceWindowStrategy, models.ParentDocumentStrategy}
+
+	for format, source := range sources {
+		for _, strategy := range strategies {
+			for script, content := range spanContents(format == "markdown") {
+				t.Run(format+"/"+string(strategy)+"/"+script, func(t *testing.T) {
+					config := StrategyChunkingConfig(strategy)
+					config.FixedSize, config.MinChunkSize, config.MaxChunkSize = 200, 50, 400
+					doc, err := ProcessDocumentContent(content, source, "", config)
+					if err != nil {
+						t.Fatalf("processing failed: %v", err)
+					}
+					if len(doc.Chunks) < 2 {
+						t.Fatalf("got %d chunks, want several", len(doc.Chunks))
+					}
+					checkSpans(t, doc.Content, doc.Chunks)
+				})
+			}
+		}
+	}
+}
+
+func TestVerifyChunkSpansMovesMisplacedChunks(t *testing.T) {
+	content := "前言 🚀 intro.\n\nCafé one.\n\nCafé two."
+	doc := &models.Document{Content: content, Source: "doc.txt", Metadata: map[string]interface{}{}}
+	doc.Chunks = []*models.EnhancedChunk{
+		{Text: "Café two.", ChunkType: "paragraph", StartPos: 0, EndPos: 3},
+		{Text: "not in the document", ChunkType: "paragraph", StartPos: 1, EndPos: 4},
+		{Text: "a generated summary", ChunkType: summaryChunkType, StartPos: 0, EndPos: 2},
+	}
+	verifyChunkSpans(doc)
+
+	checkSpans(t, content, doc.Chunks[:1])
+	if start := doc.Chunks[0].StartPos; start != len([]rune("前言 🚀 intro.\n\nCafé one.\n\n")) {
+		t.Errorf("moved chunk starts at %d, want the rune offset of its text", start)
+	}
+	if got := doc.Metadata["unverified_spans"]; got != 1 {
+		t.Errorf("unverified_spans = %v, want 1", got)
+	}
+}
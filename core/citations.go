@@ -0,0 +1,84 @@
+package core
+
+import (
+	"encoding/json"
+	"log"
+	"rag-go-app/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// citationMarkerPattern matches [1] as well as grouped markers such as [1, 3]
+var citationMarkerPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// buildCitations maps the [n] markers in answer to the chunks that were passed to the LLM as
+// "[Context n]". Markers outside the context range are ignored. Citations are ordered by first use.
+func (r *RAGService) buildCitations(answer string, chunks []*models.EnhancedChunk) []models.Citation {
+	var citations []models.Citation
+	byMarker := make(map[int]int) // marker -> index in citations
+
+	for _, loc := range citationMarkerPattern.FindAllStringSubmatchIndex(answer, -1) {
+		position := utf8.RuneCountInString(answer[:loc[0]])
+
+		for _, part := range strings.Split(answer[loc[2]:loc[3]], ",") {
+			marker, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || marker < 1 || marker > len(chunks) {
+				continue
+			}
+
+			if idx, ok := byMarker[marker]; ok {
+				citations[idx].AnswerPositions = append(citations[idx].AnswerPositions, position)
+				continue
+			}
+
+			chunk := chunks[marker-1]
+			byMarker[marker] = len(citations)
+			citations = append(citations, models.Citation{
+				Marker:          marker,
+				ChunkID:         chunk.ID,
+				DocumentID:      chunk.DocumentID,
+				Collection:      chunk.Collection,
+				Section:         chunk.Section,
+				StartPos:        chunk.StartPos,
+				EndPos:          chunk.EndPos,
+				AnswerPositions: []int{position},
+				StartTime:       metadataSeconds(chunk.Metadata, "start_time"),
+				EndTime:         metadataSeconds(chunk.Metadata, "end_time"),
+			})
+		}
+	}
+
+	if len(citations) == 0 {
+		return nil
+	}
+
+	documentIDs := make([]string, 0, len(citations))
+	for _, citation := range citations {
+		documentIDs = append(documentIDs, citation.DocumentID)
+	}
+	sources, err := r.vectorDB.GetDocumentSources(documentIDs)
+	if err != nil {
+		log.Printf("Failed to look up citation sources: %v", err)
+		return citations
+	}
+	for i := range citations {
+		citations[i].Source = sources[citations[i].DocumentID]
+	}
+
+	return citations
+}
+
+// metadataSeconds returns a timestamp stored in chunk metadata, or nil when the chunk has none
+func metadataSeconds(metadata map[string]interface{}, key string) *float64 {
+	switch value := metadata[key].(type) {
+	case float64:
+		return &value
+	case json.Number:
+		if seconds, err := value.Float64(); err == nil {
+			return &seconds
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"rag-go-app/models"
+)
+
+// collectionMetadata is the JSON stored in the collections metadata column
+type collectionMetadata struct {
+	Defaults     *models.CollectionDefaults `json:"defaults,omitempty"`
+	Quantization *models.QuantizationConfig `json:"quantization,omitempty"`
+}
+
+// ValidateCollectionDefaults rejects defaults that no request could legally carry
+func ValidateCollectionDefaults(defaults *models.CollectionDefaults) error {
+	if defaults == nil {
+		return nil
+	}
+	if defaults.Routing != nil {
+		if err := validateRouting(defaults.Routing); err != nil {
+			return err
+		}
+	}
+	if defaults.Query == nil {
+		return nil
+	}
+	if defaults.Query.TopK < 0 {
+		return fmt.Errorf("invalid defaults: top_k must not be negative")
+	}
+	if t := defaults.Query.SemanticThreshold; t != nil && (*t < 0 || *t > 1) {
+		return fmt.Errorf("invalid defaults: semantic_threshold must be between 0 and 1")
+	}
+	return nil
+}
+
+// encodeCollectionMetadata serializes collection metadata; a collection without defaults or
+// quantization stores no metadata
+func encodeCollectionMetadata(defaults *models.CollectionDefaults, quantization *models.QuantizationConfig) (interface{}, error) {
+	if defaults == nil && quantization == nil {
+		return nil, nil
+	}
+	metadataBytes, err := json.Marshal(collectionMetadata{Defaults: defaults, Quantization: quantization})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode collection metadata: %w", err)
+	}
+	return string(metadataBytes), nil
+}
+
+// readCollectionMetadata returns the metadata stored for a collection, which is empty when the
+// collection does not exist or was created without any
+func (db *VectorDB) readCollectionMetadata(q queryRower, collectionName string) (*collectionMetadata, error) {
+	var metadataJSON sql.NullString
+	err := q.QueryRow(`SELECT metadata FROM collections WHERE name = ? AND tenant_id = ?`,
+		collectionName, db.tenant).Scan(&metadataJSON)
+	if err == sql.ErrNoRows {
+		return &collectionMetadata{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collection metadata: %w", err)
+	}
+	if !metadataJSON.Valid || metadataJSON.String == "" {
+		return &collectionMetadata{}, nil
+	}
+
+	var metadata collectionMetadata
+	if err := json.Unmarshal([]byte(metadataJSON.String), &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode collection metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// GetCollectionDefaults returns the defaults stored for a collection, or nil when the
+// collection does not exist or was created without defaults
+func (db *VectorDB) GetCollectionDefaults(collectionName string) (*models.CollectionDefaults, error) {
+	metadata, err := db.readCollectionMetadata(db.conn, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.Defaults, nil
+}
+
+// ApplyQueryDefaults fills the query parameters the request did not set from the defaults of its
+// collection. explicit holds the JSON fields present in the request, so an explicit false or 0
+// is kept rather than overridden.
+func (r *RAGService) ApplyQueryDefaults(req *models.QueryRequest, explicit map[string]bool) error {
+	defaults, err := r.vectorDB.GetCollectionDefaults(req.CollectionName)
+	if err != nil || defaults == nil || defaults.Query == nil {
+		return err
+	}
+
+	query := defaults.Query
+	if !explicit["top_k"] && query.TopK > 0 {
+		req.TopK = query.TopK
+	}
+	if !explicit["reranker_enabled"] && query.RerankerEnabled != nil {
+		req.RerankerEnabled = *query.RerankerEnabled
+	}
+	if !explicit["semantic_threshold"] && query.SemanticThreshold != nil {
+		req.SemanticThreshold = *query.SemanticThreshold
+	}
+	return nil
+}
+
+// DefaultChunkingConfig returns the chunking config of a collection's defaults, or nil if it has none
+func (r *RAGService) DefaultChunkingConfig(collectionName string) (*models.ChunkingConfig, error) {
+	defaults, err := r.vectorDB.GetCollectionDefaults(collectionName)
+	if err != nil || defaults == nil || defaults.ChunkingConfig == nil {
+		return nil, err
+	}
+	config := *defaults.ChunkingConfig
+	return &config, nil
+}
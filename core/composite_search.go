@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-go-app/config"
+	"rag-go-app/core/retrieval"
+	"rag-go-app/models"
+)
+
+// newRetriever builds the named retriever over the service's backends. With lexical degradation
+// allowed, the vector retriever falls back to keyword search and calls onFallback when it does.
+func (r *RAGService) newRetriever(name models.RetrieverName, onFallback func(error)) (retrieval.Retriever, error) {
+	switch name {
+	case models.VectorRetriever:
+		vector := retrieval.NewVectorRetriever(r.embeddingClient, r.vectorDB)
+		if !config.AppConfig.Degradation.LexicalSearch {
+			return vector, nil
+		}
+		return &retrieval.Fallback{
+			Primary:    vector,
+			Secondary:  retrieval.NewKeywordRetriever(r.vectorDB),
+			OnFallback: onFallback,
+		}, nil
+	case models.KeywordRetriever:
+		return retrieval.NewKeywordRetriever(r.vectorDB), nil
+	case models.MetadataRetriever:
+		return retrieval.NewMetadataRetriever(r.vectorDB), nil
+	default:
+		return nil, fmt.Errorf("unknown retriever %q", name)
+	}
+}
+
+// SearchComposite runs the retrievers named in req concurrently and fuses their rankings with
+// req.Fusion. Chunks are ordered by fused score; each keeps the best score any retriever gave it.
+func (r *RAGService) SearchComposite(ctx context.Context, collectionName, query string, topK int, filters map[string]interface{}, req *models.QueryRequest) ([]*models.EnhancedChunk, []float64, []string, error) {
+	var degradations []string
+	onFallback := func(err error) {
+		log.Printf("Embedding backend unavailable, vector retriever falling back to lexical search: %v", err)
+		degradations = append(degradations, DegradedLexicalSearch)
+	}
+
+	composite := &retrieval.Composite{Method: req.Fusion, Weights: req.RetrieverWeights}
+	seen := make(map[models.RetrieverName]bool)
+	for _, name := range req.Retrievers {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		retriever, err := r.newRetriever(name, onFallback)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		composite.Retrievers = append(composite.Retrievers, retriever)
+	}
+
+	fused, err := composite.Retrieve(ctx, retrieval.Query{
+		Collection: collectionName,
+		Text:       query,
+		TopK:       topK,
+		Filters:    filters,
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	chunks, scores := fusedChunks(fused)
+	log.Printf("Fused %d retrievers into %d chunks", len(composite.Retrievers), len(chunks))
+	return chunks, scores, degradations, nil
+}
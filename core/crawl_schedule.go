@@ -0,0 +1,186 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"sync"
+	"time"
+)
+
+// CrawlSiteStatus describes a scheduled website crawl and the outcome of its last run
+type CrawlSiteStatus struct {
+	Collection      string         `json:"collection"`
+	Tenant          string         `json:"tenant,omitempty"`
+	URL             string         `json:"url"` // Sitemap or seed URL
+	IntervalSeconds int            `json:"interval_seconds"`
+	Running         bool           `json:"running"`
+	LastCrawlAt     *time.Time     `json:"last_crawl_at,omitempty"`
+	PagesFetched    int            `json:"pages_fetched"`
+	Truncated       bool           `json:"truncated"`
+	Summary         map[string]int `json:"summary,omitempty"` // Pages of the last crawl by status
+	LastError       string         `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time     `json:"last_error_at,omitempty"`
+}
+
+// CrawlScheduler crawls the configured websites into their collections when it starts and then
+// every site's interval
+type CrawlScheduler struct {
+	rag      *RAGService
+	sites    []config.CrawlSite
+	chunking *models.ChunkingConfig // Used for collections without a chunking config of their own
+
+	mu     sync.Mutex // Guards status
+	status []CrawlSiteStatus
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// crawlSiteRequest returns the crawl request of a scheduled site
+func crawlSiteRequest(site config.CrawlSite) *models.CrawlRequest {
+	return &models.CrawlRequest{
+		SitemapURL:     site.SitemapURL,
+		SeedURL:        site.SeedURL,
+		MaxDepth:       site.MaxDepth,
+		MaxPages:       site.MaxPages,
+		AllowedDomains: site.AllowedDomains,
+		PathPrefix:     site.PathPrefix,
+		DeleteMissing:  site.DeleteMissing,
+	}
+}
+
+// NewCrawlScheduler validates the configured sites and returns a scheduler that has not been started
+func NewCrawlScheduler(rag *RAGService, cfg config.CrawlerConfig, chunking *models.ChunkingConfig) (*CrawlScheduler, error) {
+	status := make([]CrawlSiteStatus, len(cfg.Sites))
+	for i, site := range cfg.Sites {
+		if site.Collection == "" {
+			return nil, fmt.Errorf("crawler site %d requires a collection", i)
+		}
+		if site.IntervalSeconds <= 0 {
+			return nil, fmt.Errorf("crawler site %d requires a positive interval_seconds", i)
+		}
+		if err := ValidateCrawlRequest(crawlSiteRequest(site)); err != nil {
+			return nil, fmt.Errorf("crawler site %d: %w", i, err)
+		}
+		status[i] = CrawlSiteStatus{
+			Collection:      site.Collection,
+			Tenant:          site.Tenant,
+			URL:             site.SitemapURL + site.SeedURL,
+			IntervalSeconds: site.IntervalSeconds,
+		}
+	}
+	return &CrawlScheduler{rag: rag, sites: cfg.Sites, chunking: chunking, status: status}, nil
+}
+
+// Start crawls every site now and then every site's interval until Stop is called
+func (s *CrawlScheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for i := range s.sites {
+		s.wg.Add(1)
+		go func(i int) {
+			defer s.wg.Done()
+			ticker := time.NewTicker(time.Duration(s.sites[i].IntervalSeconds) * time.Second)
+			defer ticker.Stop()
+
+			for {
+				s.crawl(ctx, i)
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(i)
+		log.Printf("Crawling %s into collection '%s' every %ds",
+			s.status[i].URL, s.sites[i].Collection, s.sites[i].IntervalSeconds)
+	}
+}
+
+// Stop cancels running crawls and ends the schedule
+func (s *CrawlScheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+	s.cancel = nil
+}
+
+// Status returns the schedule of every site and the outcome of its last crawl
+func (s *CrawlScheduler) Status() []CrawlSiteStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := make([]CrawlSiteStatus, len(s.status))
+	copy(status, s.status)
+	return status
+}
+
+// crawl runs one crawl of site i and records its outcome. While the server is read-only the crawl
+// is skipped until the next interval.
+func (s *CrawlScheduler) crawl(ctx context.Context, i int) {
+	site := s.sites[i]
+	if err := checkWritable(); err != nil {
+		log.Printf("Scheduled crawl of %s skipped: %v", s.status[i].URL, err)
+		return
+	}
+	s.mu.Lock()
+	s.status[i].Running = true
+	s.mu.Unlock()
+
+	rag := s.rag.ForTenant(site.Tenant)
+	req := crawlSiteRequest(site)
+	req.ChunkingConfig, _ = rag.DefaultChunkingConfig(site.Collection)
+	if req.ChunkingConfig == nil {
+		req.ChunkingConfig = s.chunking
+	}
+	report, err := rag.CrawlWebsite(ctx, site.Collection, req)
+	s.audit(site, report, err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	status := &s.status[i]
+	status.Running = false
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Scheduled crawl of %s failed: %v", status.URL, err)
+			status.LastError = err.Error()
+			status.LastErrorAt = &now
+		}
+		return
+	}
+	summary := make(map[string]int)
+	for _, result := range report.Results {
+		summary[result.Status]++
+	}
+	status.LastCrawlAt = &now
+	status.PagesFetched = report.PagesFetched
+	status.Truncated = report.Truncated
+	status.Summary = summary
+	status.LastError = ""
+	status.LastErrorAt = nil
+}
+
+// audit records a scheduled crawl in the audit log like a crawl requested through the API
+func (s *CrawlScheduler) audit(site config.CrawlSite, report *CrawlReport, crawlErr error) {
+	db := s.rag.vectorDB.ForTenant(site.Tenant)
+	entry := &AuditEntry{
+		Tenant: db.Tenant(), ActorKind: AuditActorSystem, Actor: "crawler",
+		Action: "collection.crawl", Collection: site.Collection,
+		Details: map[string]interface{}{"source": site.SitemapURL + site.SeedURL},
+	}
+	if crawlErr != nil {
+		entry.Details["error"] = crawlErr.Error()
+	} else {
+		entry.Details["pages_fetched"] = report.PagesFetched
+		entry.Details["truncated"] = report.Truncated
+	}
+	if err := db.RecordAudit(entry); err != nil {
+		log.Printf("Failed to audit scheduled crawl of %s: %v", entry.Details["source"], err)
+	}
+}
@@ -0,0 +1,620 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	defaultCrawlMaxDepth = 3
+	defaultCrawlMaxPages = 100
+
+	// maxSitemaps bounds the sitemaps read per crawl, sitemap indexes included
+	maxSitemaps = 50
+
+	// maxRobotsBytes is the part of a robots.txt file that is read, as RFC 9309 allows
+	maxRobotsBytes = 500 << 10
+)
+
+// ErrInvalidCrawl is returned for crawl requests without a usable start URL or with negative limits
+var ErrInvalidCrawl = errors.New("invalid crawl request")
+
+// crawlAssetExtensions are files that are never pages, so links to them are not followed
+var crawlAssetExtensions = map[string]bool{
+	".css": true, ".js": true, ".json": true, ".xml": true, ".rss": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".ico": true, ".webp": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".eot": true,
+	".pdf": true, ".zip": true, ".gz": true, ".tar": true, ".mp3": true, ".mp4": true, ".webm": true,
+}
+
+// CrawlReport is the outcome of crawling a website into a collection
+type CrawlReport struct {
+	Results      []SyncResult `json:"results"`
+	PagesFetched int          `json:"pages_fetched"`
+	Truncated    bool         `json:"truncated"` // max_pages was reached before every page in scope was fetched
+}
+
+// crawlScope is the part of the web a crawl may fetch pages from
+type crawlScope struct {
+	domains    []string
+	pathPrefix string
+}
+
+// contains reports whether a URL is on one of the domains, or a subdomain of one, under the path prefix
+func (s crawlScope) contains(u *url.URL) bool {
+	host := u.Hostname()
+	for _, domain := range s.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return strings.HasPrefix(u.Path, s.pathPrefix)
+		}
+	}
+	return false
+}
+
+// normalizeURL resolves ref against base, which may be nil for absolute references, and returns
+// the URL in the form pages are deduplicated and stored under: without fragment or credentials,
+// with a lowercase scheme and host and without the default port. Only http and https URLs are valid.
+func normalizeURL(base *url.URL, ref string) (*url.URL, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return nil, false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, false
+	}
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.User = nil
+	u.Fragment, u.RawFragment = "", ""
+	return u, true
+}
+
+// crawlStart returns the URL a crawl starts from and the scope of its pages
+func crawlStart(req *models.CrawlRequest) (*url.URL, crawlScope, error) {
+	if (req.SitemapURL == "") == (req.SeedURL == "") {
+		return nil, crawlScope{}, fmt.Errorf("%w: set exactly one of sitemap_url and seed_url", ErrInvalidCrawl)
+	}
+	if req.MaxDepth < 0 || req.MaxPages < 0 {
+		return nil, crawlScope{}, fmt.Errorf("%w: max_depth and max_pages cannot be negative", ErrInvalidCrawl)
+	}
+	raw := req.SitemapURL + req.SeedURL
+	start, ok := normalizeURL(nil, raw)
+	if !ok {
+		return nil, crawlScope{}, fmt.Errorf("%w: %q is not an http or https URL", ErrInvalidCrawl, raw)
+	}
+	if !config.AppConfig.Crawler.AllowPrivateNetworks {
+		if err := checkPublicHost(start.Hostname()); err != nil {
+			return nil, crawlScope{}, fmt.Errorf("%w: %v", ErrInvalidCrawl, err)
+		}
+	}
+
+	scope := crawlScope{pathPrefix: req.PathPrefix}
+	for _, domain := range req.AllowedDomains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			scope.domains = append(scope.domains, domain)
+		}
+	}
+	if len(scope.domains) == 0 {
+		scope.domains = []string{start.Hostname()}
+	}
+	return start, scope, nil
+}
+
+// ValidateCrawlRequest checks that a crawl request has exactly one usable start URL and valid limits
+func ValidateCrawlRequest(req *models.CrawlRequest) error {
+	_, _, err := crawlStart(req)
+	return err
+}
+
+// webCrawler fetches pages politely: it obeys the robots.txt of every host and spaces out its
+// requests to a host by the configured delay, or the host's Crawl-delay when that is longer
+type webCrawler struct {
+	client    *http.Client
+	userAgent string
+	delay     time.Duration
+	maxBytes  int64
+
+	robots    map[string]*robotsRules // By scheme and host
+	lastFetch map[string]time.Time    // By host
+}
+
+func newWebCrawler(cfg config.CrawlerConfig) *webCrawler {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = "rag-go-crawler/1.0"
+	}
+	maxBytes := cfg.MaxPageBytes
+	if maxBytes <= 0 {
+		maxBytes = 5 << 20
+	}
+	// Pages, redirects, sitemaps and robots.txt files alike only come from public addresses
+	client := &http.Client{Timeout: timeout}
+	if !cfg.AllowPrivateNetworks {
+		client.Transport = newPublicTransport()
+	}
+	return &webCrawler{
+		client:    client,
+		userAgent: userAgent,
+		delay:     time.Duration(cfg.RequestDelayMS) * time.Millisecond,
+		maxBytes:  maxBytes,
+		robots:    make(map[string]*robotsRules),
+		lastFetch: make(map[string]time.Time),
+	}
+}
+
+// request sends a GET request once the host's delay since the previous request has passed
+func (c *webCrawler) request(ctx context.Context, u *url.URL) (*http.Response, error) {
+	delay := c.delay
+	if rules, ok := c.robots[u.Scheme+"://"+u.Host]; ok && rules.crawlDelay > delay {
+		delay = rules.crawlDelay
+	}
+	if wait := time.Until(c.lastFetch[u.Host].Add(delay)); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	defer func() { c.lastFetch[u.Host] = time.Now() }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", u, err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+	return c.client.Do(req)
+}
+
+// crawlPage is a fetched page
+type crawlPage struct {
+	url         *url.URL // Where the page was found after redirects
+	contentType string
+	body        []byte
+}
+
+// fetch downloads a page, following redirects
+func (c *webCrawler) fetch(ctx context.Context, u *url.URL) (*crawlPage, error) {
+	resp, err := c.request(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s failed with status %s", u, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", u, err)
+	}
+	if int64(len(body)) > c.maxBytes {
+		return nil, fmt.Errorf("%s is larger than %d bytes", u, c.maxBytes)
+	}
+	return &crawlPage{url: resp.Request.URL, contentType: resp.Header.Get("Content-Type"), body: body}, nil
+}
+
+// robotsFor returns the robots.txt rules of a URL's host, reading them on first use. A missing
+// robots.txt allows everything; one that cannot be reached or fails with a server error
+// disallows everything, as RFC 9309 asks.
+func (c *webCrawler) robotsFor(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	key := u.Scheme + "://" + u.Host
+	if rules, ok := c.robots[key]; ok {
+		return rules, nil
+	}
+
+	rules := &robotsRules{}
+	resp, err := c.request(ctx, &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"})
+	switch {
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case err != nil:
+		log.Printf("Not crawling %s: failed to read robots.txt: %v", key, err)
+		rules.disallowed = true
+	default:
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			rules = parseRobots(io.LimitReader(resp.Body, maxRobotsBytes), c.userAgent)
+		case resp.StatusCode >= 500:
+			log.Printf("Not crawling %s: robots.txt failed with status %s", key, resp.Status)
+			rules.disallowed = true
+		}
+		resp.Body.Close()
+	}
+	c.robots[key] = rules
+	return rules, nil
+}
+
+// sitemap is a sitemap or sitemap index
+type sitemap struct {
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemapURLs returns the page URLs listed in a sitemap, reading the sitemaps listed by sitemap
+// indexes and gzipped sitemaps too. Only a failure to read the first sitemap is an error; nested
+// sitemaps that fail are logged and skipped.
+func (c *webCrawler) sitemapURLs(ctx context.Context, start *url.URL) ([]string, error) {
+	var pages []string
+	pending := []*url.URL{start}
+	read := make(map[string]bool)
+	for len(pending) > 0 && len(read) < maxSitemaps {
+		next := pending[0]
+		pending = pending[1:]
+		if read[next.String()] {
+			continue
+		}
+		read[next.String()] = true
+
+		entries, err := c.readSitemap(ctx, next)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if next == start {
+				return nil, err
+			}
+			log.Printf("Skipping sitemap: %v", err)
+			continue
+		}
+		for _, entry := range entries.URLs {
+			pages = append(pages, strings.TrimSpace(entry.Loc))
+		}
+		for _, entry := range entries.Sitemaps {
+			if u, ok := normalizeURL(next, entry.Loc); ok {
+				pending = append(pending, u)
+			}
+		}
+	}
+	return pages, nil
+}
+
+// readSitemap downloads and decodes one sitemap
+func (c *webCrawler) readSitemap(ctx context.Context, u *url.URL) (*sitemap, error) {
+	page, err := c.fetch(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sitemap: %w", err)
+	}
+	body := page.body
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sitemap %s: %w", u, err)
+		}
+		if body, err = io.ReadAll(io.LimitReader(reader, c.maxBytes)); err != nil {
+			return nil, fmt.Errorf("failed to read sitemap %s: %w", u, err)
+		}
+	}
+	var entries sitemap
+	if err := xml.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap %s: %w", u, err)
+	}
+	return &entries, nil
+}
+
+// pageMeta is what a page says about how it may be crawled
+type pageMeta struct {
+	links     []*url.URL // Normalized, without the links marked rel="nofollow"
+	canonical *url.URL
+	noindex   bool // The page asks not to be indexed
+	nofollow  bool // The page asks for its links not to be followed
+}
+
+// readPageMeta reads the links, canonical URL and robots meta tags of an HTML page
+func readPageMeta(body []byte, base *url.URL) pageMeta {
+	var meta pageMeta
+	baseSet := false
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return meta
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := tokenizer.TagName()
+		attrs := make(map[string]string)
+		for hasAttr {
+			var key, value []byte
+			key, value, hasAttr = tokenizer.TagAttr()
+			attrs[string(key)] = string(value)
+		}
+		rel := strings.Fields(strings.ToLower(attrs["rel"]))
+
+		switch string(name) {
+		case "base":
+			if u, ok := normalizeURL(base, attrs["href"]); ok && !baseSet {
+				base, baseSet = u, true
+			}
+		case "a":
+			if containsString(rel, "nofollow") {
+				continue
+			}
+			if u, ok := normalizeURL(base, attrs["href"]); ok {
+				meta.links = append(meta.links, u)
+			}
+		case "link":
+			if containsString(rel, "canonical") {
+				if u, ok := normalizeURL(base, attrs["href"]); ok {
+					meta.canonical = u
+				}
+			}
+		case "meta":
+			if strings.ToLower(attrs["name"]) != "robots" {
+				continue
+			}
+			for _, directive := range strings.Split(strings.ToLower(attrs["content"]), ",") {
+				switch strings.TrimSpace(directive) {
+				case "noindex":
+					meta.noindex = true
+				case "nofollow":
+					meta.nofollow = true
+				case "none":
+					meta.noindex, meta.nofollow = true, true
+				}
+			}
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// crawlTarget is a page waiting to be fetched, depth links away from the seed page
+type crawlTarget struct {
+	url   *url.URL
+	depth int
+}
+
+// CrawlWebsite crawls a website into a collection. Pages come from the sitemap, or from following
+// links breadth-first from the seed page up to max_depth; only pages in scope and allowed by
+// robots.txt are fetched, at most max_pages of them. Pages are deduplicated by URL, by their
+// canonical link and by content, and each HTML page is ingested through the HTML parser with its
+// URL as the source, so unchanged pages are skipped on later crawls. Pages marked noindex and
+// content that is not HTML are skipped. A failing page is reported in its result and does not stop
+// the others; a cancelled or timed out ctx stops the crawl.
+func (r *RAGService) CrawlWebsite(ctx context.Context, collectionName string, req *models.CrawlRequest) (*CrawlReport, error) {
+	startTime := time.Now()
+
+	start, scope, err := crawlStart(req)
+	if err != nil {
+		return nil, err
+	}
+	maxDepth := req.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = defaultCrawlMaxDepth
+	}
+	maxPages := req.MaxPages
+	if maxPages == 0 {
+		maxPages = defaultCrawlMaxPages
+	}
+
+	stored, err := r.vectorDB.ListDocumentHashes(collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	crawler := newWebCrawler(config.AppConfig.Crawler)
+	var queue []crawlTarget
+	queued := make(map[string]bool)
+	enqueue := func(u *url.URL, depth int) {
+		if key := u.String(); !queued[key] && scope.contains(u) {
+			queued[key] = true
+			queue = append(queue, crawlTarget{url: u, depth: depth})
+		}
+	}
+	if req.SitemapURL != "" {
+		pages, err := crawler.sitemapURLs(ctx, start)
+		if err != nil {
+			return nil, err
+		}
+		for _, page := range pages {
+			// Pages listed in a sitemap are ingested without following their links
+			if u, ok := normalizeURL(nil, page); ok {
+				enqueue(u, maxDepth)
+			}
+		}
+	} else {
+		enqueue(start, 0)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "rag-crawl-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	report := &CrawlReport{Results: []SyncResult{}}
+	visited := make(map[string]bool) // Sources already ingested or skipped in this crawl
+	kept := make(map[string]bool)    // Sources whose documents stay when delete_missing is set
+	contents := make(map[string]string)
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		target := queue[0]
+		queue = queue[1:]
+		source := target.url.String()
+		if visited[source] {
+			continue
+		}
+		if report.PagesFetched >= maxPages {
+			report.Truncated = true
+			break
+		}
+		visited[source] = true
+		skip := func(reason string, args ...interface{}) {
+			report.Results = append(report.Results, SyncResult{
+				Source:       source,
+				IngestResult: IngestResult{Status: SyncSkipped},
+				Error:        fmt.Sprintf(reason, args...),
+			})
+		}
+
+		rules, err := crawler.robotsFor(ctx, target.url)
+		if err != nil {
+			return nil, err
+		}
+		if !rules.Allowed(target.url.RequestURI()) {
+			skip("disallowed by robots.txt")
+			continue
+		}
+
+		report.PagesFetched++
+		page, err := crawler.fetch(ctx, target.url)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			kept[source] = true
+			report.Results = append(report.Results, SyncResult{Source: source, IngestResult: IngestResult{Status: SyncFailed}, Error: err.Error()})
+			continue
+		}
+
+		found, ok := normalizeURL(nil, page.url.String())
+		if !ok || !scope.contains(found) {
+			skip("redirected out of scope to %s", page.url)
+			continue
+		}
+		if found.String() != source {
+			if visited[found.String()] {
+				skip("redirected to %s, which was already crawled", found)
+				continue
+			}
+			source = found.String()
+			visited[source] = true
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(page.contentType)
+		if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+			skip("%s %s", errUnsupportedContentType, mediaType)
+			continue
+		}
+		body := page.body
+		if reader, err := charset.NewReader(bytes.NewReader(page.body), page.contentType); err == nil {
+			if decoded, err := io.ReadAll(reader); err == nil {
+				body = decoded
+			}
+		}
+
+		meta := readPageMeta(body, found)
+		if !meta.nofollow && target.depth < maxDepth {
+			for _, link := range meta.links {
+				if !crawlAssetExtensions[strings.ToLower(path.Ext(link.Path))] {
+					enqueue(link, target.depth+1)
+				}
+			}
+		}
+		if meta.noindex {
+			skip("the page asks not to be indexed")
+			continue
+		}
+		if meta.canonical != nil && meta.canonical.String() != source && scope.contains(meta.canonical) {
+			if visited[meta.canonical.String()] {
+				skip("duplicate of its canonical page %s", meta.canonical)
+				continue
+			}
+			source = meta.canonical.String()
+			visited[source] = true
+		}
+		hash := ContentHash(body)
+		if first, duplicate := contents[hash]; duplicate {
+			skip("same content as %s", first)
+			continue
+		}
+		contents[hash] = source
+
+		kept[source] = true
+		result := SyncResult{Source: source}
+		ingested, err := r.ingestPage(ctx, filepath.Join(tmpDir, fmt.Sprintf("page-%d.html", report.PagesFetched)), collectionName, source, body, req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			result.Status = SyncFailed
+			result.Error = err.Error()
+		} else {
+			result.IngestResult = *ingested
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	// Pages the crawl did not get to may still exist, so nothing is deleted after a truncated crawl
+	if req.DeleteMissing && !report.Truncated {
+		for _, doc := range stored {
+			u, err := url.Parse(doc.Source)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !scope.contains(u) || kept[doc.Source] {
+				continue
+			}
+			result := SyncResult{Source: doc.Source, IngestResult: IngestResult{Status: SyncDeleted, DocumentID: doc.ID}}
+			if err := r.vectorDB.DeleteDocument(doc.ID); err != nil {
+				result.Status = SyncFailed
+				result.Error = err.Error()
+			}
+			report.Results = append(report.Results, result)
+		}
+	}
+
+	log.Printf("Crawled %d pages of %s into collection '%s' in %v",
+		report.PagesFetched, start, collectionName, time.Since(startTime))
+
+	return report, nil
+}
+
+// ingestPage writes a page to path and ingests it under source
+func (r *RAGService) ingestPage(ctx context.Context, path, collectionName, source string, body []byte, req *models.CrawlRequest) (*IngestResult, error) {
+	if err := os.WriteFile(path, body, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(path)
+
+	return r.IngestDocument(ctx, collectionName, &models.AddDocumentRequest{
+		CollectionName: collectionName,
+		Source:         source,
+		FilePath:       path,
+		DocType:        req.DocType,
+		ChunkingConfig: req.ChunkingConfig,
+	})
+}
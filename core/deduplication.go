@@ -0,0 +1,102 @@
+package core
+
+import (
+	"log"
+	"rag-go-app/models"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultShingleDuplicateThreshold   = 0.8
+	defaultEmbeddingDuplicateThreshold = 0.95
+	duplicateShingleWords              = 3 // Words per shingle
+)
+
+// suppressDuplicates walks the chunks in ranked order and leaves out each one that nearly repeats
+// a chunk kept before it, as overlapping fixed-size and sentence-window chunks do. It returns the
+// indices of the kept chunks, in order, and the left-out ones with the chunk each repeats. With
+// the embedding method, chunks without a stored embedding are compared by shingles.
+func (r *RAGService) suppressDuplicates(req *models.QueryRequest, chunks []*models.EnhancedChunk, scores []float64) ([]int, []models.SuppressedDuplicate) {
+	threshold := req.DuplicateThreshold
+	var embeddings map[string][]float32
+	if req.DuplicateMethod == models.EmbeddingDuplicates {
+		if threshold <= 0 {
+			threshold = defaultEmbeddingDuplicateThreshold
+		}
+		ids := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			ids[i] = chunk.ID
+		}
+		var err error
+		embeddings, err = r.vectorDB.GetChunkEmbeddings(ids)
+		if err != nil {
+			log.Printf("Duplicate suppression falling back to shingles: %v", err)
+			embeddings = nil
+		}
+	}
+	if threshold <= 0 {
+		threshold = defaultShingleDuplicateThreshold
+	}
+
+	shingles := make([]map[string]bool, len(chunks))
+	similarity := func(a, b int) float64 {
+		ea, okA := embeddings[chunks[a].ID]
+		eb, okB := embeddings[chunks[b].ID]
+		if okA && okB {
+			return cosineSimilarity(ea, eb)
+		}
+		for _, i := range []int{a, b} {
+			if shingles[i] == nil {
+				shingles[i] = textShingles(chunks[i].Text)
+			}
+		}
+		return jaccardSimilarity(shingles[a], shingles[b])
+	}
+
+	kept := make([]int, 0, len(chunks))
+	var suppressed []models.SuppressedDuplicate
+	for i, chunk := range chunks {
+		original, best := -1, 0.0
+		for _, k := range kept {
+			if s := similarity(k, i); s >= threshold && s > best {
+				original, best = k, s
+			}
+		}
+		if original < 0 {
+			kept = append(kept, i)
+			continue
+		}
+		duplicate := models.SuppressedDuplicate{
+			ChunkID:     chunk.ID,
+			DocumentID:  chunk.DocumentID,
+			DuplicateOf: chunks[original].ID,
+			Similarity:  best,
+			Text:        chunk.Text,
+		}
+		if i < len(scores) {
+			duplicate.Score = scores[i]
+		}
+		suppressed = append(suppressed, duplicate)
+	}
+	return kept, suppressed
+}
+
+// textShingles returns the sequences of duplicateShingleWords consecutive words of a text, case
+// and punctuation ignored. A shorter text is a single shingle.
+func textShingles(text string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	shingles := make(map[string]bool)
+	if len(words) < duplicateShingleWords {
+		if len(words) > 0 {
+			shingles[strings.Join(words, " ")] = true
+		}
+		return shingles
+	}
+	for i := 0; i+duplicateShingleWords <= len(words); i++ {
+		shingles[strings.Join(words[i:i+duplicateShingleWords], " ")] = true
+	}
+	return shingles
+}
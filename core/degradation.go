@@ -0,0 +1,73 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-go-app/config"
+	"rag-go-app/models"
+)
+
+// Degradation flags reported in responses when a fallback was used
+const (
+	DegradedLexicalSearch    = "lexical_search"    // Embedding server down, keyword-only retrieval
+	DegradedRerankerSkipped  = "reranker_skipped"  // Reranker failed, original similarity order kept
+	DegradedExtractiveAnswer = "extractive_answer" // Chat model down, verbatim passages returned
+	DegradedStaticExpansion  = "static_expansion"  // Chat model down, synonym-map query expansion used instead of paraphrases
+
+	DegradedEmbeddingHighlights   = "embedding_highlights"   // Chat model down, highlights found by embedding similarity instead of quotes
+	DegradedHighlightsSkipped     = "highlights_skipped"     // Embedding server down, answer returned without highlights
+	DegradedSelfCheckSkipped      = "self_check_skipped"     // Chat model down, confidence estimated from retrieval and citations only
+	DegradedEmbeddingVerification = "embedding_verification" // Chat model down, answer sentences verified by embedding similarity
+	DegradedVerificationSkipped   = "verification_skipped"   // Embedding server down too, answer returned unverified
+
+	DegradedSuggestionsSkipped = "suggestions_skipped" // Chat model down, answer returned without suggested questions
+	DegradedSingleRetrieval    = "single_retrieval"    // Chat model down during agentic retrieval, the question retrieved for once
+	DegradedKeywordLabels      = "keyword_labels"      // Chat model down, topics named by their keywords
+)
+
+// SearchWithFallback embeds the query and runs a vector search. If the embedding
+// backend fails and the degradation policy allows it, a lexical search is used instead.
+func (r *RAGService) SearchWithFallback(ctx context.Context, collectionName, query string, topK int, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, []string, error) {
+	queryEmbedding, err := r.embeddingClient.GetEmbedding(ctx, query)
+	if err != nil {
+		if !config.AppConfig.Degradation.LexicalSearch || ctx.Err() != nil {
+			return nil, nil, nil, fmt.Errorf("failed to generate query embedding: %w", err)
+		}
+
+		log.Printf("Embedding backend unavailable, falling back to lexical search: %v", err)
+		chunks, scores, searchErr := r.vectorDB.KeywordSearchChunks(ctx, collectionName, query, topK, filters)
+		if searchErr != nil {
+			return nil, nil, nil, fmt.Errorf("failed to run lexical fallback search: %w", searchErr)
+		}
+		return chunks, scores, []string{DegradedLexicalSearch}, nil
+	}
+
+	chunks, scores, err := r.vectorDB.QuerySimilarChunks(ctx, collectionName, queryEmbedding, topK, filters)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to search similar chunks: %w", err)
+	}
+	return chunks, scores, nil, nil
+}
+
+// safeRerank runs the reranker and converts a failure into an error instead of aborting the query
+func (r *RAGService) safeRerank(query string, chunks []*models.EnhancedChunk, scores []float64) (rerankedChunks []*models.EnhancedChunk, rerankedScores []float64, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("reranker failed: %v", rec)
+		}
+	}()
+
+	rerankedChunks, rerankedScores = r.rerankChunks(query, chunks, scores)
+	return rerankedChunks, rerankedScores, nil
+}
+
+// buildExtractiveAnswer assembles an answer from verbatim sentences of the retrieved chunks,
+// preferring sentences that share the most terms with the query.
+func buildExtractiveAnswer(query string, chunks []*models.EnhancedChunk) string {
+	passages := selectPassages(query, chunks)
+	if len(passages) == 0 {
+		return "I couldn't find any relevant information for your query."
+	}
+	return "The answer could not be generated. The most relevant passages are:\n\n" + quotePassages(passages)
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// deterministicIDNamespace is the UUID namespace of derived document and chunk IDs. Changing it
+// changes every derived ID, so re-ingested documents would no longer match their stored copies.
+var deterministicIDNamespace = uuid.MustParse("3f9c1d52-7a4e-4b8f-9e21-6d0c5a8b7e34")
+
+// deterministicIDs reports whether a document is ingested under IDs derived from its content
+func deterministicIDs(req *models.AddDocumentRequest) bool {
+	return req.DeterministicIDs || config.AppConfig.DeterministicIDs
+}
+
+// deterministicDocumentID derives the ID of a document from the tenant and collection it is stored
+// in, its source and the hash of its content. Another collection or tenant gets another ID, since
+// document IDs are unique across the database.
+func deterministicDocumentID(tenant, collectionName, source, contentHash string) string {
+	name := strings.Join([]string{tenant, collectionName, source, contentHash}, "\x00")
+	return uuid.NewSHA1(deterministicIDNamespace, []byte(name)).String()
+}
+
+// assignDeterministicIDs gives a document the derived ID and each of its chunks an ID derived from
+// it and the chunk's index, type and span, numbered in document order where these repeat, as they
+// do for the questions of a chunk. References between the chunks are updated to the new IDs.
+func assignDeterministicIDs(doc *models.Document, documentID string) {
+	ids := make(map[string]string, len(doc.Chunks))
+	occurrences := make(map[string]int)
+	for _, chunk := range doc.Chunks {
+		key := fmt.Sprintf("%d/%s/%d-%d", chunk.ChunkIndex, chunk.ChunkType, chunk.StartPos, chunk.EndPos)
+		occurrences[key]++
+		if n := occurrences[key]; n > 1 {
+			key = fmt.Sprintf("%s#%d", key, n)
+		}
+		ids[chunk.ID] = uuid.NewSHA1(deterministicIDNamespace, []byte(documentID+"\x00"+key)).String()
+	}
+
+	remap := func(id *string) {
+		if id == nil {
+			return
+		}
+		if newID, ok := ids[*id]; ok {
+			*id = newID
+		}
+	}
+	doc.ID = documentID
+	for _, chunk := range doc.Chunks {
+		chunk.DocumentID = documentID
+		remap(&chunk.ID)
+		if chunk.ParentChunkID != nil {
+			parentID := *chunk.ParentChunkID
+			remap(&parentID)
+			chunk.ParentChunkID = &parentID
+		}
+		for i := range chunk.ChildChunkIDs {
+			remap(&chunk.ChildChunkIDs[i])
+		}
+		if id, ok := chunk.Metadata["question_for"].(string); ok {
+			remap(&id)
+			chunk.Metadata["question_for"] = id
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A document's embedding is the mean of the embeddings of its content chunks, stored with the
+// document when it is ingested. Changing a chunk's embedding clears it, and document search
+// computes missing ones again from the stored chunk embeddings.
+
+const defaultDocumentSearchTopK = 10
+
+// ErrInvalidDocumentSearch is returned for document searches without exactly one of a query and a
+// document
+var ErrInvalidDocumentSearch = errors.New("invalid document search")
+
+// documentCentroid returns the mean of the embeddings of a document's chunks. Parents, summaries
+// and generated questions restate other chunks, so they only count when no other chunk is
+// embedded. It returns nil when no chunk is.
+func documentCentroid(chunks []*models.EnhancedChunk) []float32 {
+	var content, all [][]float32
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) == 0 {
+			continue
+		}
+		all = append(all, chunk.Embedding)
+		switch chunk.ChunkType {
+		case parentChunkType, summaryChunkType, questionChunkType:
+		default:
+			content = append(content, chunk.Embedding)
+		}
+	}
+	if len(content) == 0 {
+		content = all
+	}
+	if len(content) == 0 {
+		return nil
+	}
+
+	sum := make([]float64, len(content[0]))
+	for _, embedding := range content {
+		if len(embedding) != len(sum) {
+			return nil
+		}
+		for i, value := range embedding {
+			sum[i] += float64(value)
+		}
+	}
+	centroid := make([]float32, len(sum))
+	for i, value := range sum {
+		centroid[i] = float32(value / float64(len(content)))
+	}
+	return centroid
+}
+
+// storeDocumentEmbedding stores the centroid of a document's chunk embeddings with the document
+func (db *VectorDB) storeDocumentEmbedding(tx *sql.Tx, doc *models.Document) error {
+	centroid := documentCentroid(doc.Chunks)
+	if centroid == nil {
+		return nil
+	}
+	blob, err := serializeEmbedding(centroid)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE documents SET embedding = ? WHERE id = ? AND tenant_id = ?`, blob, doc.ID, db.tenant); err != nil {
+		return fmt.Errorf("failed to store document embedding: %w", err)
+	}
+	return nil
+}
+
+// fillDocumentEmbeddings computes the embeddings of the documents of a collection that have none
+// from their stored chunk embeddings, returning the number of documents left without one because
+// none of their chunks is embedded
+func (db *VectorDB) fillDocumentEmbeddings(ctx context.Context, collectionName string) (int, error) {
+	ids, err := queryStrings(db.conn, `SELECT id FROM documents WHERE collection_name = ? AND tenant_id = ? AND embedding IS NULL`,
+		collectionName, db.tenant)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list documents without embeddings: %w", err)
+	}
+
+	unembedded := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		chunks, err := db.storedChunkEmbeddings(id)
+		if err != nil {
+			return 0, err
+		}
+		doc := &models.Document{ID: id, Chunks: chunks}
+		if documentCentroid(chunks) == nil {
+			unembedded++
+			continue
+		}
+		tx, err := db.conn.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		if err := db.storeDocumentEmbedding(tx, doc); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+	if len(ids) > unembedded {
+		log.Printf("Computed embeddings of %d documents of collection '%s'", len(ids)-unembedded, collectionName)
+	}
+	return unembedded, nil
+}
+
+// storedChunkEmbeddings returns the chunks of a document with their stored embeddings, only their
+// IDs and types read besides. Duplicates get the embedding of their original.
+func (db *VectorDB) storedChunkEmbeddings(documentID string) ([]*models.EnhancedChunk, error) {
+	rows, err := db.conn.Query(`SELECT id, chunk_type, COALESCE(duplicate_of, id) FROM enhanced_chunks WHERE document_id = ? AND tenant_id = ?`,
+		documentID, db.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks: %w", err)
+	}
+	var chunks []*models.EnhancedChunk
+	var ids []string
+	for rows.Next() {
+		chunk := &models.EnhancedChunk{}
+		var embeddedID string
+		if err := rows.Scan(&chunk.ID, &chunk.ChunkType, &embeddedID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		chunks = append(chunks, chunk)
+		ids = append(ids, embeddedID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list chunks: %w", err)
+	}
+
+	embeddings, err := db.GetChunkEmbeddings(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, chunk := range chunks {
+		chunk.Embedding = embeddings[ids[i]]
+	}
+	return chunks, nil
+}
+
+// clearDocumentEmbeddings clears the embeddings of the documents matching the where clause, so
+// they are computed again from their chunks
+func clearDocumentEmbeddings(tx *sql.Tx, where string, args ...interface{}) error {
+	if _, err := tx.Exec(`UPDATE documents SET embedding = NULL WHERE `+where, args...); err != nil {
+		return fmt.Errorf("failed to clear document embeddings: %w", err)
+	}
+	return nil
+}
+
+// SearchDocuments finds the documents of a collection whose embeddings are most similar to the
+// embedding of a query, or to that of one of its documents. Documents are compared one by one, as
+// a collection holds far fewer documents than chunks.
+func (r *RAGService) SearchDocuments(ctx context.Context, req *models.DocumentSearchRequest) (*models.DocumentSearchResponse, error) {
+	start := time.Now()
+	req.Query = strings.TrimSpace(req.Query)
+	if (req.Query == "") == (req.DocumentID == "") {
+		return nil, fmt.Errorf("%w: set exactly one of query and document_id", ErrInvalidDocumentSearch)
+	}
+	if req.TopK < 0 {
+		return nil, fmt.Errorf("%w: top_k must not be negative", ErrInvalidDocumentSearch)
+	}
+	topK := req.TopK
+	if topK == 0 {
+		topK = defaultDocumentSearchTopK
+	}
+
+	unembedded, err := r.vectorDB.fillDocumentEmbeddings(ctx, req.CollectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	var target []float32
+	if req.Query != "" {
+		if target, err = r.embeddingClient.GetEmbedding(ctx, req.Query); err != nil {
+			return nil, fmt.Errorf("failed to embed query: %w", err)
+		}
+	} else if target, err = r.vectorDB.documentEmbedding(req.CollectionName, req.DocumentID, req.Principal); err != nil {
+		return nil, err
+	}
+
+	matches, err := r.vectorDB.scoreDocuments(ctx, req, target)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > topK {
+		matches = matches[:topK]
+	}
+
+	return &models.DocumentSearchResponse{
+		CollectionName: req.CollectionName,
+		Query:          req.Query,
+		DocumentID:     req.DocumentID,
+		Documents:      matches,
+		Unembedded:     unembedded,
+		ProcessingTime: time.Since(start).Seconds(),
+	}, nil
+}
+
+// documentEmbedding returns the stored embedding of a document of a collection the principal may see
+func (db *VectorDB) documentEmbedding(collectionName, documentID string, principal *models.Principal) ([]float32, error) {
+	query := `SELECT d.embedding FROM documents d WHERE d.id = ? AND d.collection_name = ? AND d.tenant_id = ?`
+	args := []interface{}{documentID, collectionName, db.tenant}
+	if principal != nil {
+		condition, principalArgs := documentACLCondition(principal)
+		query += " AND " + condition
+		args = append(args, principalArgs...)
+	}
+
+	var blob []byte
+	err := db.conn.QueryRow(query, args...).Scan(&blob)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("document '%s' not found in collection '%s'", documentID, collectionName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document embedding: %w", err)
+	}
+	if blob == nil {
+		return nil, fmt.Errorf("%w: document '%s' has no embedded chunks", ErrInvalidDocumentSearch, documentID)
+	}
+	return deserializeFloat32(blob), nil
+}
+
+// scoreDocuments scores the embedded documents of the request's collection that its principal
+// may see against the target embedding, leaving out the request's document
+func (db *VectorDB) scoreDocuments(ctx context.Context, req *models.DocumentSearchRequest, target []float32) ([]models.DocumentMatch, error) {
+	conditions := []string{"d.collection_name = ?", "d.tenant_id = ?", "d.embedding IS NOT NULL", "d.id != ?"}
+	args := []interface{}{req.CollectionName, db.tenant, req.DocumentID}
+	if req.DocType != "" {
+		conditions = append(conditions, "d.doc_type = ?")
+		args = append(args, req.DocType)
+	}
+	if req.Principal != nil {
+		condition, principalArgs := documentACLCondition(req.Principal)
+		conditions = append(conditions, condition)
+		args = append(args, principalArgs...)
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT d.id, COALESCE(d.source, ''), COALESCE(d.doc_type, ''),
+		COALESCE(json_extract(d.metadata, '$.title'), ''), d.chunk_count, d.created_at, d.embedding
+		FROM documents d WHERE `+strings.Join(conditions, " AND "), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []models.DocumentMatch{}
+	for rows.Next() {
+		var match models.DocumentMatch
+		var blob []byte
+		if err := rows.Scan(&match.DocumentID, &match.Source, &match.DocType, &match.Title, &match.ChunkCount, &match.CreatedAt, &blob); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		embedding := deserializeFloat32(blob)
+		if len(embedding) != len(target) {
+			// Stored before the collection was re-embedded with another model
+			continue
+		}
+		match.Score = cosineSimilarity(target, embedding)
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read document embeddings: %w", err)
+	}
+	return matches, nil
+}
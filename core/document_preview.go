@@ -0,0 +1,90 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"rag-go-app/models"
+)
+
+// PreviewDocument runs a document through the parsing and chunking ingestion would apply, adaptive
+// strategy selection included, and reports the result without embedding or storing anything. The
+// LLM-backed ingestion steps (summaries, questions, table descriptions) are not run.
+func (r *RAGService) PreviewDocument(ctx context.Context, collectionName string, req *models.AddDocumentRequest) (*models.DocumentPreview, error) {
+	if req.Source == "" {
+		req.Source = req.FilePath
+	}
+
+	content, err := readDocumentContent(req)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &models.DocumentPreview{
+		CollectionName:  collectionName,
+		Source:          req.Source,
+		Status:          IngestAdded,
+		RequestedConfig: req.ChunkingConfig,
+	}
+	contentHash := ContentHash([]byte(content))
+	previous, documentID, err := r.findPreviousVersion(collectionName, req, contentHash)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		preview.ExistingDocumentID = previous.ID
+		preview.Status = IngestUpdated
+		if previous.ContentHash == contentHash {
+			preview.Status = IngestUnchanged
+		}
+	}
+
+	doc, _, err := parseDocument(ctx, req, content)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.weightKeywords(collectionName, doc); err != nil {
+		return nil, err
+	}
+
+	if documentID != "" {
+		assignDeterministicIDs(doc, documentID)
+	}
+
+	preview.Strategy = fmt.Sprint(doc.Metadata["chunking_strategy"])
+	preview.Analysis = doc.Metadata
+	preview.ContentLength = len([]rune(doc.Content))
+	preview.ChunkCount = len(doc.Chunks)
+	preview.Sections = previewSections(doc.Chunks)
+	preview.Chunks = doc.Chunks
+	return preview, nil
+}
+
+// previewSections lists the sections the chunks were assigned to, in the order they first appear,
+// each spanning from its first chunk's start to its last chunk's end
+func previewSections(chunks []*models.EnhancedChunk) []models.PreviewSection {
+	sections := []models.PreviewSection{}
+	index := make(map[[2]string]int)
+	for _, chunk := range chunks {
+		if chunk.Section == "" {
+			continue
+		}
+		key := [2]string{chunk.Section, chunk.Subsection}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(sections)
+			sections = append(sections, models.PreviewSection{
+				Section:    chunk.Section,
+				Subsection: chunk.Subsection,
+				StartPos:   chunk.StartPos,
+				EndPos:     chunk.EndPos,
+				Chunks:     1,
+			})
+			continue
+		}
+		section := &sections[i]
+		section.StartPos = min(section.StartPos, chunk.StartPos)
+		section.EndPos = max(section.EndPos, chunk.EndPos)
+		section.Chunks++
+	}
+	return sections
+}
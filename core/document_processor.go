@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"rag-go-app/core/parsers"
 	"rag-go-app/models"
 	"regexp"
 	"sort"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -64,12 +66,30 @@ func NewDocumentProcessor() *DocumentProcessor {
 	return &DocumentProcessor{}
 }
 
+// StrategyChunkingConfig returns the settings used when a chunking strategy is tried out on
+// its own, as when comparing or evaluating strategies
+func StrategyChunkingConfig(strategy models.ChunkingStrategy) *models.ChunkingConfig {
+	return &models.ChunkingConfig{
+		Strategy:           strategy,
+		FixedSize:          500,
+		Overlap:            50,
+		MinChunkSize:       100,
+		MaxChunkSize:       2000,
+		PreserveParagraphs: true,
+		ExtractKeywords:    true,
+	}
+}
+
 // ProcessDocumentContent intelligently processes documents with adaptive strategies
 func ProcessDocumentContent(content string, source string, docType string, config *models.ChunkingConfig) (*models.Document, error) {
 	if content == "" {
 		return nil, fmt.Errorf("content cannot be empty")
 	}
 
+	if isMarkdownDocument(source, docType) {
+		return processMarkdownDocument(content, source, docType, config)
+	}
+
 	// Analyze document characteristics
 	characteristics := analyzeDocument(content)
 
@@ -89,35 +109,46 @@ func ProcessDocumentContent(content string, source string, docType string, confi
 			"document_length":   characteristics.Length,
 			"document_category": string(characteristics.Category),
 			"structure_type":    string(characteristics.StructureType),
+			"language":          characteristics.Language,
 			"chunk_count":       0, // Will be updated after chunking
 		},
 	}
 
-	var chunks []*models.EnhancedChunk
-	var err error
-
 	// Apply the determined strategy
-	switch adaptiveConfig.Strategy {
-	case models.FixedSizeStrategy:
-		chunks, err = createFixedSizeChunks(content, doc.ID, adaptiveConfig)
-	case models.StructuralStrategy:
-		chunks, err = createIntelligentStructuralChunks(content, doc.ID, adaptiveConfig, characteristics)
-	case models.SemanticStrategy:
-		chunks, err = createSemanticChunks(content, doc.ID, adaptiveConfig)
-	case models.SentenceWindowStrategy:
-		chunks, err = createSentenceWindowChunks(content, doc.ID, adaptiveConfig)
-	case models.ParentDocumentStrategy:
-		chunks, err = createParentDocumentChunks(content, doc.ID, adaptiveConfig)
-	default:
-		chunks, err = createIntelligentStructuralChunks(content, doc.ID, adaptiveConfig, characteristics)
+	chunkText := func(text string) ([]*models.EnhancedChunk, error) {
+		switch adaptiveConfig.Strategy {
+		case models.FixedSizeStrategy:
+			return createFixedSizeChunks(text, doc.ID, adaptiveConfig)
+		case models.StructuralStrategy:
+			return createIntelligentStructuralChunks(text, doc.ID, adaptiveConfig, characteristics)
+		case models.SemanticStrategy:
+			return createSemanticChunks(text, doc.ID, adaptiveConfig)
+		case models.SentenceWindowStrategy:
+			return createSentenceWindowChunks(text, doc.ID, adaptiveConfig)
+		case models.ParentDocumentStrategy:
+			return createParentDocumentChunks(text, doc.ID, adaptiveConfig)
+		default:
+			return createIntelligentStructuralChunks(text, doc.ID, adaptiveConfig, characteristics)
+		}
 	}
 
+	// Tables are kept whole in chunks of their own; the strategy chunks the text around them
+	var chunks []*models.EnhancedChunk
+	var err error
+	if tables := findTables(content); len(tables) > 0 {
+		doc.Metadata["table_count"] = len(tables)
+		chunks, err = chunkAroundTables(content, tables, doc.ID, adaptiveConfig, chunkText)
+	} else {
+		chunks, err = chunkText(content)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create chunks: %w", err)
 	}
 
 	// Post-process chunks for quality
-	chunks = postProcessChunks(chunks, characteristics)
+	chunks = postProcessChunks(content, chunks, characteristics)
+	tagChunkLanguages(chunks, characteristics.Language, adaptiveConfig.ExtractKeywords)
+	tagChunkEntities(chunks)
 
 	doc.Chunks = chunks
 	doc.Metadata["chunk_count"] = len(chunks)
@@ -126,9 +157,103 @@ func ProcessDocumentContent(content string, source string, docType string, confi
 	return doc, nil
 }
 
+// ProcessParsedDocument chunks a document produced by the parsers package. When the document has
+// headings, every heading starts a section and chunks record the heading breadcrumb; otherwise the
+// plain text goes through the adaptive pipeline of ProcessDocumentContent.
+func ProcessParsedDocument(parsed *parsers.Document, source string, docType string, config *models.ChunkingConfig) (*models.Document, error) {
+	content := parsed.Text()
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("content cannot be empty")
+	}
+
+	if !parsed.HasHeadings() {
+		doc, err := ProcessDocumentContent(content, source, docType, config)
+		if err != nil {
+			return nil, err
+		}
+		doc.Metadata["source_format"] = parsed.Format
+		return doc, nil
+	}
+
+	sections := parsed.Sections()
+
+	characteristics := analyzeDocument(content)
+	characteristics.HasStructure = true
+	characteristics.StructureType = SectionedStructure
+	for _, section := range sections {
+		if section.Level > 1 {
+			characteristics.StructureType = HierarchicalStructure
+			break
+		}
+	}
+
+	// Sizes still adapt to the document, but the strategy follows the real outline
+	adaptiveConfig := adaptChunkingStrategy(characteristics, config)
+	adaptiveConfig.Strategy = models.StructuralStrategy
+
+	doc := &models.Document{
+		ID:      uuid.New().String(),
+		Content: content,
+		Source:  source,
+		DocType: docType,
+		Metadata: map[string]interface{}{
+			"chunking_strategy": string(adaptiveConfig.Strategy),
+			"document_length":   characteristics.Length,
+			"document_category": string(characteristics.Category),
+			"structure_type":    string(characteristics.StructureType),
+			"source_format":     parsed.Format,
+			"language":          characteristics.Language,
+			"section_count":     len(sections),
+			"chunk_count":       0, // Will be updated after chunking
+		},
+	}
+
+	chunks := createOutlineChunks(content, sections, doc.ID, adaptiveConfig)
+	chunks = postProcessChunks(content, chunks, characteristics)
+	tagChunkLanguages(chunks, characteristics.Language, adaptiveConfig.ExtractKeywords)
+	tagChunkEntities(chunks)
+
+	doc.Chunks = chunks
+	doc.Metadata["chunk_count"] = len(chunks)
+
+	log.Printf("Parsed %s document processed: %d sections, %d chunks", parsed.Format, len(sections), len(chunks))
+	return doc, nil
+}
+
+// createOutlineChunks chunks each heading section separately. Section holds the top-level heading,
+// Subsection the breadcrumb of nested headings, and positions are rune offsets into the full text.
+func createOutlineChunks(content string, sections []parsers.Section, docID string, config *models.ChunkingConfig) []*models.EnhancedChunk {
+	var chunks []*models.EnhancedChunk
+	chunkIndex := 0
+	counter := newRuneCounter(content)
+
+	for _, section := range sections {
+		title := "document"
+		if len(section.Path) > 0 {
+			title = section.Path[0]
+		}
+
+		sectionChunks := createSectionChunks(counter, DocumentSection{Title: title, Content: section.Content, Offset: section.StartPos}, docID, config, &chunkIndex)
+		for _, chunk := range sectionChunks {
+			if len(section.Path) > 1 {
+				chunk.Subsection = strings.Join(section.Path[1:], " > ")
+			}
+			if len(section.Path) > 0 {
+				chunk.Metadata = map[string]interface{}{
+					"heading_level": section.Level,
+					"heading_path":  section.Path,
+				}
+			}
+		}
+		chunks = append(chunks, sectionChunks...)
+	}
+
+	return chunks
+}
+
 // analyzeDocument determines document characteristics
 func analyzeDocument(content string) DocumentCharacteristics {
-	length := len(content)
+	length := utf8.RuneCountInString(content)
 
 	var category DocumentCategory
 	switch {
@@ -147,15 +272,20 @@ func analyzeDocument(content string) DocumentCharacteristics {
 	// Analyze structure
 	structureType, hasStructure := analyzeStructure(content)
 
+	language := detectLanguage(content)
+	if language == "" {
+		language = defaultLanguage
+	}
+
 	// Calculate complexity (sentence length, vocabulary diversity, etc.)
-	complexity := calculateComplexity(content)
+	complexity := calculateComplexity(content, language)
 
 	return DocumentCharacteristics{
 		Length:        length,
 		Category:      category,
 		HasStructure:  hasStructure,
 		StructureType: structureType,
-		Language:      "en", // Could be enhanced with language detection
+		Language:      language,
 		Complexity:    complexity,
 	}
 }
@@ -203,14 +333,14 @@ func analyzeStructure(content string) (DocumentStructureType, bool) {
 }
 
 // calculateComplexity estimates document complexity
-func calculateComplexity(content string) float64 {
+func calculateComplexity(content string, language string) float64 {
 	words := strings.Fields(content)
 	if len(words) == 0 {
 		return 0.0
 	}
 
-	sentences := strings.Split(content, ".")
-	avgWordsPerSentence := float64(len(words)) / float64(len(sentences))
+	sentences := max(len(sentenceSpans(content, language)), 1)
+	avgWordsPerSentence := float64(len(words)) / float64(sentences)
 
 	// Simple complexity score based on sentence length
 	complexity := math.Min(avgWordsPerSentence/15.0, 1.0)
@@ -363,8 +493,9 @@ func createIntelligentStructuralChunks(content string, docID string, config *mod
 	sections := detectSections(content)
 
 	chunkIndex := 0
+	counter := newRuneCounter(content)
 	for _, section := range sections {
-		sectionChunks := createSectionChunks(section, docID, config, &chunkIndex)
+		sectionChunks := createSectionChunks(counter, section, docID, config, &chunkIndex)
 		chunks = append(chunks, sectionChunks...)
 	}
 
@@ -378,19 +509,21 @@ func createIntelligentStructuralChunks(content string, docID string, config *mod
 
 // createMinimalChunks for very small documents
 func createMinimalChunks(content string, docID string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
+	counter := newRuneCounter(content)
+
 	// For very small content, create just 1-2 meaningful chunks
-	if len(content) <= config.MinChunkSize {
+	if utf8.RuneCountInString(content) <= config.MinChunkSize {
 		// Single chunk
+		start, end := trimSpan(content, 0, len(content))
 		chunk := &models.EnhancedChunk{
 			ID:         uuid.New().String(),
 			DocumentID: docID,
-			Text:       strings.TrimSpace(content),
+			Text:       content[start:end],
 			ChunkType:  "document",
 			Section:    "complete",
-			StartPos:   0,
-			EndPos:     len(content),
 			ChunkIndex: 0,
 		}
+		chunk.StartPos, chunk.EndPos = counter.span(start, end)
 
 		if config.ExtractKeywords {
 			chunk.Keywords = extractKeywords(chunk.Text)
@@ -400,7 +533,7 @@ func createMinimalChunks(content string, docID string, config *models.ChunkingCo
 	}
 
 	// Split into 2-3 meaningful parts based on paragraphs or sentences
-	paragraphs := strings.Split(content, "\n\n")
+	paragraphs := paragraphSpans(content)
 	if len(paragraphs) < 2 {
 		// Fall back to sentence splitting
 		return createSentenceWindowChunks(content, docID, config)
@@ -408,56 +541,49 @@ func createMinimalChunks(content string, docID string, config *models.ChunkingCo
 
 	// Group paragraphs into meaningful chunks
 	var chunks []*models.EnhancedChunk
-	currentChunk := ""
-	chunkIndex := 0
-	startPos := 0
-
-	for i, para := range paragraphs {
-		testChunk := currentChunk
-		if testChunk != "" {
-			testChunk += "\n\n"
+	groups := groupParagraphs(content, paragraphs, func(size int, last bool) bool {
+		return size >= config.MinChunkSize || last
+	})
+	for chunkIndex, group := range groups {
+		chunk := &models.EnhancedChunk{
+			ID:         uuid.New().String(),
+			DocumentID: docID,
+			Text:       content[group[0]:group[1]],
+			ChunkType:  "paragraph_group",
+			Section:    fmt.Sprintf("section_%d", chunkIndex+1),
+			ChunkIndex: chunkIndex,
 		}
-		testChunk += para
-
-		if len(testChunk) >= config.MinChunkSize || i == len(paragraphs)-1 {
-			chunk := &models.EnhancedChunk{
-				ID:         uuid.New().String(),
-				DocumentID: docID,
-				Text:       strings.TrimSpace(testChunk),
-				ChunkType:  "paragraph_group",
-				Section:    fmt.Sprintf("section_%d", chunkIndex+1),
-				StartPos:   startPos,
-				EndPos:     startPos + len(testChunk),
-				ChunkIndex: chunkIndex,
-			}
-
-			if config.ExtractKeywords {
-				chunk.Keywords = extractKeywords(chunk.Text)
-			}
+		chunk.StartPos, chunk.EndPos = counter.span(group[0], group[1])
 
-			chunks = append(chunks, chunk)
-			chunkIndex++
-			startPos += len(testChunk) + 2 // +2 for \n\n
-			currentChunk = ""
-		} else {
-			currentChunk = testChunk
+		if config.ExtractKeywords {
+			chunk.Keywords = extractKeywords(chunk.Text)
 		}
+
+		chunks = append(chunks, chunk)
 	}
 
 	return chunks, nil
 }
 
-// postProcessChunks ensures chunk quality and adds relationships
-func postProcessChunks(chunks []*models.EnhancedChunk, characteristics DocumentCharacteristics) []*models.EnhancedChunk {
+// postProcessChunks ensures chunk quality and adds relationships. Merged and parent chunks hold
+// the content they span, so their text stays the document text between their positions.
+func postProcessChunks(content string, chunks []*models.EnhancedChunk, characteristics DocumentCharacteristics) []*models.EnhancedChunk {
+	runes := []rune(content)
+
 	// Remove too-small chunks by merging with neighbors
 	filteredChunks := []*models.EnhancedChunk{}
 
 	for i, chunk := range chunks {
-		if len(chunk.Text) < minMeaningfulChunkSize/2 && i < len(chunks)-1 {
+		// Tables stay whole and on their own, however small, parents keep their children, and a
+		// chunk only merges into the chunk following it in the document under the same parent
+		mergeable := i < len(chunks)-1 && chunk.ChunkType != tableChunkType && chunks[i+1].ChunkType != tableChunkType &&
+			chunk.ChunkType != parentChunkType && chunk.StartPos <= chunks[i+1].StartPos && sameParent(chunk, chunks[i+1])
+		if utf8.RuneCountInString(chunk.Text) < minMeaningfulChunkSize/2 && mergeable {
 			// Merge with next chunk
 			nextChunk := chunks[i+1]
-			nextChunk.Text = chunk.Text + "\n\n" + nextChunk.Text
 			nextChunk.StartPos = chunk.StartPos
+			nextChunk.EndPos = max(nextChunk.EndPos, chunk.EndPos)
+			nextChunk.Text = string(runes[nextChunk.StartPos:nextChunk.EndPos])
 			if len(chunk.Keywords) > 0 {
 				nextChunk.Keywords = append(nextChunk.Keywords, chunk.Keywords...)
 			}
@@ -469,12 +595,20 @@ func postProcessChunks(chunks []*models.EnhancedChunk, characteristics DocumentC
 
 	// Add parent-child relationships for larger documents
 	if characteristics.Category == LargeDocument || characteristics.Category == VeryLargeDocument {
-		filteredChunks = addParentChildRelationships(filteredChunks)
+		filteredChunks = addParentChildRelationships(runes, filteredChunks)
 	}
 
 	return filteredChunks
 }
 
+// sameParent reports whether two chunks have the same parent, or both have none
+func sameParent(a, b *models.EnhancedChunk) bool {
+	if a.ParentChunkID == nil || b.ParentChunkID == nil {
+		return a.ParentChunkID == b.ParentChunkID
+	}
+	return *a.ParentChunkID == *b.ParentChunkID
+}
+
 // Enhanced detectSections function
 func detectSections(content string) []DocumentSection {
 	var sections []DocumentSection
@@ -489,6 +623,10 @@ func detectSections(content string) []DocumentSection {
 	}
 
 	lines := strings.Split(content, "\n")
+	lineOffsets := make([]int, len(lines)) // Byte offset of each line in content
+	for i := 1; i < len(lines); i++ {
+		lineOffsets[i] = lineOffsets[i-1] + len(lines[i-1]) + 1
+	}
 	currentSection := DocumentSection{Title: "document", StartLine: 0}
 
 	for i, line := range lines {
@@ -522,6 +660,7 @@ func detectSections(content string) []DocumentSection {
 			currentSection = DocumentSection{
 				Title:     sectionTitle,
 				StartLine: i,
+				Offset:    lineOffsets[i],
 			}
 		}
 	}
@@ -554,29 +693,32 @@ type DocumentSection struct {
 	Content   string
 	StartLine int
 	EndLine   int
+	Offset    int // Byte offset of Content in the document
 }
 
-// createSectionChunks creates chunks from a document section
-func createSectionChunks(section DocumentSection, docID string, config *models.ChunkingConfig, chunkIndex *int) []*models.EnhancedChunk {
+// createSectionChunks creates chunks from a document section. counter converts byte offsets of
+// the document holding the section, so positions are offsets into the whole document.
+func createSectionChunks(counter *runeCounter, section DocumentSection, docID string, config *models.ChunkingConfig, chunkIndex *int) []*models.EnhancedChunk {
 	var chunks []*models.EnhancedChunk
 
-	content := strings.TrimSpace(section.Content)
-	if content == "" {
+	document := counter.text
+	start, end := trimSpan(document, section.Offset, section.Offset+len(section.Content))
+	if start == end {
 		return chunks
 	}
+	content := document[start:end]
 
 	// If section is small enough, keep as single chunk
-	if len(content) <= config.MaxChunkSize {
+	if utf8.RuneCountInString(content) <= config.MaxChunkSize {
 		chunk := &models.EnhancedChunk{
 			ID:         uuid.New().String(),
 			DocumentID: docID,
 			Text:       content,
 			Section:    section.Title,
 			ChunkType:  "section",
-			StartPos:   0,
-			EndPos:     len(content),
 			ChunkIndex: *chunkIndex,
 		}
+		chunk.StartPos, chunk.EndPos = counter.span(start, end)
 
 		if config.ExtractKeywords {
 			chunk.Keywords = extractKeywords(content)
@@ -588,43 +730,27 @@ func createSectionChunks(section DocumentSection, docID string, config *models.C
 	}
 
 	// Split large sections into meaningful chunks
-	paragraphs := strings.Split(content, "\n\n")
-	currentChunk := ""
-	startPos := 0
-
-	for i, para := range paragraphs {
-		testChunk := currentChunk
-		if testChunk != "" {
-			testChunk += "\n\n"
+	paragraphs := paragraphSpans(content)
+	groups := groupParagraphs(content, paragraphs, func(size int, last bool) bool {
+		return size >= config.MinChunkSize && (size >= config.MaxChunkSize || last)
+	})
+	for _, group := range groups {
+		chunk := &models.EnhancedChunk{
+			ID:         uuid.New().String(),
+			DocumentID: docID,
+			Text:       content[group[0]:group[1]],
+			Section:    section.Title,
+			ChunkType:  "section_part",
+			ChunkIndex: *chunkIndex,
 		}
-		testChunk += para
-
-		shouldChunk := len(testChunk) >= config.MinChunkSize &&
-			(len(testChunk) >= config.MaxChunkSize || i == len(paragraphs)-1)
-
-		if shouldChunk {
-			chunk := &models.EnhancedChunk{
-				ID:         uuid.New().String(),
-				DocumentID: docID,
-				Text:       strings.TrimSpace(testChunk),
-				Section:    section.Title,
-				ChunkType:  "section_part",
-				StartPos:   startPos,
-				EndPos:     startPos + len(testChunk),
-				ChunkIndex: *chunkIndex,
-			}
-
-			if config.ExtractKeywords {
-				chunk.Keywords = extractKeywords(testChunk)
-			}
+		chunk.StartPos, chunk.EndPos = counter.span(start+group[0], start+group[1])
 
-			chunks = append(chunks, chunk)
-			*chunkIndex++
-			startPos += len(testChunk) + 2
-			currentChunk = ""
-		} else {
-			currentChunk = testChunk
+		if config.ExtractKeywords {
+			chunk.Keywords = extractKeywords(chunk.Text)
 		}
+
+		chunks = append(chunks, chunk)
+		*chunkIndex++
 	}
 
 	return chunks
@@ -633,8 +759,9 @@ func createSectionChunks(section DocumentSection, docID string, config *models.C
 // Keep all existing helper functions but enhance them...
 // (createFixedSizeChunks, createSemanticChunks, etc. - existing implementations)
 
-// addParentChildRelationships creates hierarchical chunk relationships
-func addParentChildRelationships(chunks []*models.EnhancedChunk) []*models.EnhancedChunk {
+// addParentChildRelationships creates hierarchical chunk relationships. A parent spans its
+// children, from the first one's start to the last one's end in runes of the document.
+func addParentChildRelationships(runes []rune, chunks []*models.EnhancedChunk) []*models.EnhancedChunk {
 	// Group chunks by section
 	sectionGroups := make(map[string][]*models.EnhancedChunk)
 
@@ -651,23 +778,23 @@ func addParentChildRelationships(chunks []*models.EnhancedChunk) []*models.Enhan
 	for section, sectionChunks := range sectionGroups {
 		if len(sectionChunks) > 2 {
 			// Create parent chunk for section
-			combinedText := ""
+			startPos, endPos := sectionChunks[0].StartPos, sectionChunks[0].EndPos
 			var childIDs []string
 
-			for i, chunk := range sectionChunks {
-				if i > 0 {
-					combinedText += "\n\n"
-				}
-				combinedText += chunk.Text
+			for _, chunk := range sectionChunks {
+				startPos = max(min(startPos, chunk.StartPos), 0)
+				endPos = min(max(endPos, chunk.EndPos), len(runes))
 				childIDs = append(childIDs, chunk.ID)
 			}
 
 			parentChunk := &models.EnhancedChunk{
 				ID:            uuid.New().String(),
 				DocumentID:    sectionChunks[0].DocumentID,
-				Text:          combinedText,
+				Text:          string(runes[startPos:endPos]),
 				Section:       section,
 				ChunkType:     "parent",
+				StartPos:      startPos,
+				EndPos:        endPos,
 				ChildChunkIDs: childIDs,
 				ChunkIndex:    sectionChunks[0].ChunkIndex,
 			}
@@ -687,37 +814,40 @@ func addParentChildRelationships(chunks []*models.EnhancedChunk) []*models.Enhan
 	return enhancedChunks
 }
 
-// Enhanced keyword extraction
+// stopWords are common words that carry no meaning on their own
+var stopWords = map[string]bool{
+	"the": true, "a": true, "an": true, "and": true, "or": true, "but": true,
+	"in": true, "on": true, "at": true, "to": true, "for": true, "of": true,
+	"with": true, "by": true, "is": true, "are": true, "was": true, "were": true,
+	"be": true, "been": true, "have": true, "has": true, "had": true, "do": true,
+	"does": true, "did": true, "will": true, "would": true, "could": true, "should": true,
+	"this": true, "that": true, "these": true, "those": true, "i": true, "you": true,
+	"he": true, "she": true, "it": true, "we": true, "they": true, "my": true,
+	"your": true, "his": true, "her": true, "its": true, "our": true, "their": true,
+}
+
+// Enhanced keyword extraction, with the stop words of the language the text is written in
 func extractKeywords(text string) []string {
-	if text == "" {
-		return []string{}
+	language := detectLanguage(text)
+	if language == "" {
+		language = defaultLanguage
 	}
+	return keywordsIn(text, language)
+}
 
-	// Clean text
-	text = strings.ToLower(text)
+// maxKeywords is the number of keywords kept per chunk
+const maxKeywords = 10
 
-	// Remove common stop words
-	stopWords := map[string]bool{
-		"the": true, "a": true, "an": true, "and": true, "or": true, "but": true,
-		"in": true, "on": true, "at": true, "to": true, "for": true, "of": true,
-		"with": true, "by": true, "is": true, "are": true, "was": true, "were": true,
-		"be": true, "been": true, "have": true, "has": true, "had": true, "do": true,
-		"does": true, "did": true, "will": true, "would": true, "could": true, "should": true,
-		"this": true, "that": true, "these": true, "those": true, "i": true, "you": true,
-		"he": true, "she": true, "it": true, "we": true, "they": true, "my": true,
-		"your": true, "his": true, "her": true, "its": true, "our": true, "their": true,
+// keywordsIn extracts the most frequent keywords of text written in language
+func keywordsIn(text, language string) []string {
+	if text == "" {
+		return []string{}
 	}
 
-	// Extract words
-	words := regexp.MustCompile(`\b[a-zA-Z]{3,}\b`).FindAllString(text, -1)
-
-	// Count frequency and filter
+	// Count frequency; stop words and short words are already filtered out
 	wordCount := make(map[string]int)
-	for _, word := range words {
-		word = strings.ToLower(word)
-		if !stopWords[word] && len(word) >= 3 {
-			wordCount[word]++
-		}
+	for _, word := range keywordCandidates(text, language) {
+		wordCount[word]++
 	}
 
 	// Sort by frequency
@@ -737,7 +867,6 @@ func extractKeywords(text string) []string {
 
 	// Return top keywords
 	var keywords []string
-	maxKeywords := 10
 	for i, wf := range frequencies {
 		if i >= maxKeywords {
 			break
@@ -755,16 +884,20 @@ func extractKeywords(text string) []string {
 func createFixedSizeChunks(content string, docID string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
 	var chunks []*models.EnhancedChunk
 
-	if len(content) <= config.FixedSize {
+	// Sizes and positions are in runes so multi-byte characters are never cut in half
+	runes := []rune(content)
+
+	if len(runes) <= config.FixedSize {
 		// Single chunk
+		start, end := trimRunes(runes, 0, len(runes))
 		chunk := &models.EnhancedChunk{
 			ID:         uuid.New().String(),
 			DocumentID: docID,
-			Text:       strings.TrimSpace(content),
+			Text:       string(runes[start:end]),
 			ChunkType:  "fixed_size",
 			Section:    "document",
-			StartPos:   0,
-			EndPos:     len(content),
+			StartPos:   start,
+			EndPos:     end,
 			ChunkIndex: 0,
 		}
 
@@ -779,33 +912,34 @@ func createFixedSizeChunks(content string, docID string, config *models.Chunking
 	start := 0
 	chunkIndex := 0
 
-	for start < len(content) {
+	for start < len(runes) {
 		end := start + config.FixedSize
-		if end > len(content) {
-			end = len(content)
+		if end > len(runes) {
+			end = len(runes)
 		}
 
 		// Try to end at word boundary
-		if end < len(content) && !unicode.IsSpace(rune(content[end])) {
+		if end < len(runes) && !unicode.IsSpace(runes[end]) {
 			// Find last space within reasonable distance
 			for i := end; i > start+config.FixedSize-50 && i > start; i-- {
-				if unicode.IsSpace(rune(content[i])) {
+				if unicode.IsSpace(runes[i]) {
 					end = i
 					break
 				}
 			}
 		}
 
-		chunkText := strings.TrimSpace(content[start:end])
-		if len(chunkText) > 0 {
+		textStart, textEnd := trimRunes(runes, start, end)
+		if textStart < textEnd {
+			chunkText := string(runes[textStart:textEnd])
 			chunk := &models.EnhancedChunk{
 				ID:         uuid.New().String(),
 				DocumentID: docID,
 				Text:       chunkText,
 				ChunkType:  "fixed_size",
 				Section:    "document",
-				StartPos:   start,
-				EndPos:     end,
+				StartPos:   textStart,
+				EndPos:     textEnd,
 				ChunkIndex: chunkIndex,
 			}
 
@@ -817,11 +951,17 @@ func createFixedSizeChunks(content string, docID string, config *models.Chunking
 			chunkIndex++
 		}
 
-		// Move start position with overlap
-		start = end - config.Overlap
-		if start >= end {
+		// Stop once the last window reached the end; overlapping would repeat it forever
+		if end >= len(runes) {
 			break
 		}
+
+		// Move start position with overlap, always making progress
+		next := end - config.Overlap
+		if next <= start {
+			next = end
+		}
+		start = next
 	}
 
 	return chunks, nil
@@ -830,61 +970,40 @@ func createFixedSizeChunks(content string, docID string, config *models.Chunking
 // createSemanticChunks creates chunks based on semantic boundaries
 func createSemanticChunks(content string, docID string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
 	// For now, fall back to paragraph-based chunking with semantic awareness
-	paragraphs := strings.Split(content, "\n\n")
 	var chunks []*models.EnhancedChunk
+	counter := newRuneCounter(content)
 
-	currentChunk := ""
-	chunkIndex := 0
-	startPos := 0
-
-	for i, para := range paragraphs {
-		para = strings.TrimSpace(para)
-		if para == "" {
-			continue
+	groups := groupParagraphs(content, paragraphSpans(content), func(size int, last bool) bool {
+		return size >= config.MinChunkSize && (size >= config.MaxChunkSize || last)
+	})
+	for chunkIndex, group := range groups {
+		chunk := &models.EnhancedChunk{
+			ID:         uuid.New().String(),
+			DocumentID: docID,
+			Text:       content[group[0]:group[1]],
+			ChunkType:  "semantic",
+			Section:    "content",
+			ChunkIndex: chunkIndex,
 		}
+		chunk.StartPos, chunk.EndPos = counter.span(group[0], group[1])
 
-		testChunk := currentChunk
-		if testChunk != "" {
-			testChunk += "\n\n"
+		if config.ExtractKeywords {
+			chunk.Keywords = extractKeywords(chunk.Text)
 		}
-		testChunk += para
-
-		shouldChunk := len(testChunk) >= config.MinChunkSize &&
-			(len(testChunk) >= config.MaxChunkSize || i == len(paragraphs)-1)
 
-		if shouldChunk {
-			chunk := &models.EnhancedChunk{
-				ID:         uuid.New().String(),
-				DocumentID: docID,
-				Text:       strings.TrimSpace(testChunk),
-				ChunkType:  "semantic",
-				Section:    "content",
-				StartPos:   startPos,
-				EndPos:     startPos + len(testChunk),
-				ChunkIndex: chunkIndex,
-			}
-
-			if config.ExtractKeywords {
-				chunk.Keywords = extractKeywords(testChunk)
-			}
-
-			chunks = append(chunks, chunk)
-			chunkIndex++
-			startPos += len(testChunk) + 2
-			currentChunk = ""
-		} else {
-			currentChunk = testChunk
-		}
+		chunks = append(chunks, chunk)
 	}
 
 	return chunks, nil
 }
 
-// createSentenceWindowChunks creates overlapping sentence windows
+// createSentenceWindowChunks creates overlapping sentence windows. Each window is the content from
+// the start of its first sentence to the end of its last.
 func createSentenceWindowChunks(content string, docID string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
 	// Split into sentences
-	sentences := regexp.MustCompile(`[.!?]+\s+`).Split(content, -1)
+	sentences := sentenceSpans(content, detectLanguage(content))
 	var chunks []*models.EnhancedChunk
+	counter := newRuneCounter(content)
 
 	windowSize := config.SentenceWindowSize
 	if windowSize == 0 {
@@ -893,39 +1012,36 @@ func createSentenceWindowChunks(content string, docID string, config *models.Chu
 
 	chunkIndex := 0
 
-	for i := 0; i < len(sentences); i += windowSize / 2 { // 50% overlap
+	for i := 0; i < len(sentences); i += max(windowSize/2, 1) { // 50% overlap
 		end := i + windowSize
 		if end > len(sentences) {
 			end = len(sentences)
 		}
 
-		windowText := strings.Join(sentences[i:end], ". ")
-		windowText = strings.TrimSpace(windowText)
+		windowStart, windowEnd := sentences[i][0], sentences[end-1][1]
+		windowText := content[windowStart:windowEnd]
 
-		if len(windowText) < config.MinChunkSize && i+windowSize < len(sentences) {
+		if utf8.RuneCountInString(windowText) < config.MinChunkSize && i+windowSize < len(sentences) {
 			continue // Skip if too small and not last
 		}
 
-		if len(windowText) > 0 {
-			chunk := &models.EnhancedChunk{
-				ID:         uuid.New().String(),
-				DocumentID: docID,
-				Text:       windowText,
-				ChunkType:  "sentence_window",
-				Section:    "content",
-				StartPos:   0, // Could calculate actual positions
-				EndPos:     len(windowText),
-				ChunkIndex: chunkIndex,
-			}
-
-			if config.ExtractKeywords {
-				chunk.Keywords = extractKeywords(windowText)
-			}
+		chunk := &models.EnhancedChunk{
+			ID:         uuid.New().String(),
+			DocumentID: docID,
+			Text:       windowText,
+			ChunkType:  "sentence_window",
+			Section:    "content",
+			ChunkIndex: chunkIndex,
+		}
+		chunk.StartPos, chunk.EndPos = counter.span(windowStart, windowEnd)
 
-			chunks = append(chunks, chunk)
-			chunkIndex++
+		if config.ExtractKeywords {
+			chunk.Keywords = extractKeywords(windowText)
 		}
 
+		chunks = append(chunks, chunk)
+		chunkIndex++
+
 		// Break if we've reached the end
 		if end >= len(sentences) {
 			break
@@ -942,36 +1058,40 @@ func createParentDocumentChunks(content string, docID string, config *models.Chu
 	var parentChunks []*models.EnhancedChunk
 	var allChunks []*models.EnhancedChunk
 
+	// Sizes and positions are in runes so multi-byte characters are never cut in half
+	runes := []rune(content)
+
 	// Create parent chunks
 	start := 0
 	parentIndex := 0
 
-	for start < len(content) {
+	for start < len(runes) {
 		end := start + parentSize
-		if end > len(content) {
-			end = len(content)
+		if end > len(runes) {
+			end = len(runes)
 		}
 
 		// Try to end at paragraph boundary
-		if end < len(content) {
+		if end < len(runes) {
 			for i := end; i > start+parentSize-200 && i > start; i-- {
-				if content[i:i+2] == "\n\n" {
+				if runes[i] == '\n' && i+1 < len(runes) && runes[i+1] == '\n' {
 					end = i
 					break
 				}
 			}
 		}
 
-		parentText := strings.TrimSpace(content[start:end])
-		if len(parentText) > 0 {
+		textStart, textEnd := trimRunes(runes, start, end)
+		if textStart < textEnd {
+			parentText := string(runes[textStart:textEnd])
 			parentChunk := &models.EnhancedChunk{
 				ID:         uuid.New().String(),
 				DocumentID: docID,
 				Text:       parentText,
 				ChunkType:  "parent",
 				Section:    fmt.Sprintf("section_%d", parentIndex+1),
-				StartPos:   start,
-				EndPos:     end,
+				StartPos:   textStart,
+				EndPos:     textEnd,
 				ChunkIndex: parentIndex,
 			}
 
@@ -993,9 +1113,11 @@ func createParentDocumentChunks(content string, docID string, config *models.Chu
 				return nil, err
 			}
 
-			// Link children to parent
+			// Link children to parent; child positions become offsets into the whole document
 			var childIDs []string
 			for _, child := range childChunks {
+				child.StartPos += textStart
+				child.EndPos += textStart
 				child.ParentChunkID = &parentChunk.ID
 				child.Section = parentChunk.Section
 				child.ChunkType = "child"
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxDocumentSummaryInput is the characters of a document the chat model reads to title and summarize it
+const maxDocumentSummaryInput = 12000
+
+// documentSummaryPrompt asks the chat model for the title and summary of a document
+const documentSummaryPrompt = `Write a title and a summary of the document "%s" below. The title is a short descriptive phrase, not a file name. The summary is one paragraph of a few sentences on what the document is about and its main points, keeping the names, numbers and key facts someone might search for. Don't add anything that isn't in the document.%s
+
+Respond with JSON only, in this form:
+{"title": "...", "summary": "..."}
+
+Document:
+%s`
+
+// documentSummary is the title and summary the chat model wrote for a document
+type documentSummary struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+// summarizeDocument asks the chat model for a title and summary of a document. They are stored in
+// the document's title and summary metadata, and added as a summary chunk at the overview level,
+// so questions about the document as a whole can match it. Only the first
+// maxDocumentSummaryInput characters are read.
+func (r *RAGService) summarizeDocument(ctx context.Context, doc *models.Document) (*documentSummary, error) {
+	content := strings.TrimSpace(doc.Content)
+	truncated := ""
+	if runes := []rune(content); len(runes) > maxDocumentSummaryInput {
+		content = string(runes[:maxDocumentSummaryInput])
+		truncated = " Only the beginning of the document is shown; summarize what it covers without guessing at the rest."
+	}
+
+	response, err := r.llmClient.GenerateResponse(ctx, fmt.Sprintf(documentSummaryPrompt, doc.Source, truncated, content))
+	if err != nil {
+		return nil, err
+	}
+	summary, err := parseDocumentSummary(response)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.Metadata == nil {
+		doc.Metadata = make(map[string]interface{})
+	}
+	doc.Metadata["title"] = summary.Title
+	doc.Metadata["summary"] = summary.Summary
+
+	language, _ := doc.Metadata["language"].(string)
+	if detected := detectLanguage(summary.Summary); detected != "" {
+		language = detected
+	}
+	if language == "" {
+		language = defaultLanguage
+	}
+	text := summary.Title + "\n\n" + summary.Summary
+	doc.Chunks = append(doc.Chunks, &models.EnhancedChunk{
+		ID:         uuid.New().String(),
+		DocumentID: doc.ID,
+		Text:       text,
+		ChunkType:  summaryChunkType,
+		StartPos:   0,
+		EndPos:     len([]rune(doc.Content)),
+		ChunkIndex: len(doc.Chunks),
+		Keywords:   keywordsIn(text, language),
+		Metadata: map[string]interface{}{
+			"summary_level": SummaryLevelOverview,
+			"language":      language,
+		},
+		Confidence: 1.0,
+	})
+
+	log.Printf("Summarized '%s' as %q", doc.Source, summary.Title)
+	return summary, nil
+}
+
+// parseDocumentSummary reads the JSON object in a model response, ignoring any text or code fence
+// around it
+func parseDocumentSummary(response string) (*documentSummary, error) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in model response")
+	}
+
+	var summary documentSummary
+	if err := json.Unmarshal([]byte(response[start:end+1]), &summary); err != nil {
+		return nil, fmt.Errorf("invalid summary JSON in model response: %w", err)
+	}
+	summary.Title = strings.Join(strings.Fields(summary.Title), " ")
+	summary.Summary = strings.TrimSpace(summary.Summary)
+	if summary.Title == "" || summary.Summary == "" {
+		return nil, fmt.Errorf("empty title or summary in model response")
+	}
+	return &summary, nil
+}
@@ -0,0 +1,389 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"strings"
+	"time"
+)
+
+// Outcomes of ingesting or syncing one document
+const (
+	IngestAdded     = "added"
+	IngestUpdated   = "updated"
+	IngestUnchanged = "unchanged"
+	IngestFailed    = "failed"
+
+	SyncNeedsContent = "needs_content" // The hash changed but the manifest entry carried no content
+	SyncDeleted      = "deleted"
+	SyncFailed       = IngestFailed
+)
+
+// IngestResult reports what ingesting one document changed
+type IngestResult struct {
+	Status                string `json:"status"`
+	DocumentID            string `json:"document_id,omitempty"`
+	ChunksEmbedded        int    `json:"chunks_embedded"`
+	ChunksReused          int    `json:"chunks_reused"`                     // Embeddings carried over from the previous version
+	ChunksDeduplicated    int    `json:"chunks_deduplicated"`               // Identical to a chunk already stored in the collection
+	ChunksSupplied        int    `json:"chunks_supplied,omitempty"`         // Stored with the embeddings the request supplied
+	ChunksSplit           int    `json:"chunks_split,omitempty"`            // Too large for the embedding model, so embedded in pieces and averaged
+	GraphEntities         int    `json:"graph_entities,omitempty"`          // Entity mentions extracted for the knowledge graph
+	GraphRelations        int    `json:"graph_relations,omitempty"`         // Relations extracted for the knowledge graph
+	GraphFailedChunks     int    `json:"graph_failed_chunks,omitempty"`     // Chunks graph extraction failed on
+	Summaries             int    `json:"summaries,omitempty"`               // Summary chunks in the document's summary tree
+	SummaryFailures       int    `json:"summary_failures,omitempty"`        // Groups of passages the chat model returned no summary for
+	TablesSummarized      int    `json:"tables_summarized,omitempty"`       // Tables described by the chat model for embedding
+	TableSummaryFailures  int    `json:"table_summary_failures,omitempty"`  // Tables the chat model returned no description for
+	Title                 string `json:"title,omitempty"`                   // Title generated for the document
+	Summary               string `json:"summary,omitempty"`                 // Summary generated for the document
+	DocumentSummaryFailed bool   `json:"document_summary_failed,omitempty"` // The chat model returned no title and summary
+	QuestionsGenerated    int    `json:"questions_generated,omitempty"`     // Questions embedded for the document's chunks
+	QuestionFailures      int    `json:"question_failures,omitempty"`       // Chunks the chat model returned no questions for
+	PagesRecognized       int    `json:"pages_recognized,omitempty"`        // Pages of a PDF or image read by OCR
+	LowConfidenceChunks   int    `json:"low_confidence_chunks,omitempty"`   // Chunks covering a page recognized below the minimum confidence
+
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // When the document will be deleted
+}
+
+// SyncResult reports the outcome of one manifest entry or deleted document
+type SyncResult struct {
+	Source string `json:"source"`
+	IngestResult
+	Error string `json:"error,omitempty"`
+}
+
+// StoredDocument identifies a stored document by its source and content hash
+type StoredDocument struct {
+	ID          string
+	Source      string
+	ContentHash string
+	ACL         *models.DocumentACL
+	ExpiresAt   *time.Time
+}
+
+// CanonicalChunk is a stored chunk that holds the embedding for its text
+type CanonicalChunk struct {
+	ID          string
+	DocumentID  string
+	ContentHash string
+	Embedding   []float32
+}
+
+// ContentHash returns the hex SHA-256 of data, as stored for documents and chunks
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// rowsQuerier is satisfied by both *sql.DB and *sql.Tx
+type rowsQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryStrings returns the first column of every row of a query
+func queryStrings(q rowsQuerier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// FindDocumentBySource returns the most recently stored document with the given source, or nil
+func (db *VectorDB) FindDocumentBySource(collectionName, source string) (*StoredDocument, error) {
+	doc := &StoredDocument{Source: source}
+	var aclJSON *string
+	err := db.conn.QueryRow(`SELECT id, COALESCE(content_hash, ''), acl, expires_at FROM documents
+		WHERE collection_name = ? AND source = ? AND tenant_id = ?
+		ORDER BY created_at DESC, rowid DESC LIMIT 1`, collectionName, source, db.tenant).Scan(&doc.ID, &doc.ContentHash, &aclJSON, &doc.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up document by source: %w", err)
+	}
+	doc.ACL = parseACL(aclJSON)
+	return doc, nil
+}
+
+// FindDocument returns the stored document with the given ID in a collection, or nil
+func (db *VectorDB) FindDocument(collectionName, documentID string) (*StoredDocument, error) {
+	doc := &StoredDocument{ID: documentID}
+	var aclJSON *string
+	err := db.conn.QueryRow(`SELECT COALESCE(source, ''), COALESCE(content_hash, ''), acl, expires_at FROM documents
+		WHERE collection_name = ? AND id = ? AND tenant_id = ?`, collectionName, documentID, db.tenant).Scan(&doc.Source, &doc.ContentHash, &aclJSON, &doc.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up document: %w", err)
+	}
+	doc.ACL = parseACL(aclJSON)
+	return doc, nil
+}
+
+// ListDocumentHashes returns the stored documents of a collection, oldest first
+func (db *VectorDB) ListDocumentHashes(collectionName string) ([]StoredDocument, error) {
+	if err := db.requireCollection(db.conn, collectionName); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(`SELECT id, COALESCE(source, ''), COALESCE(content_hash, '') FROM documents
+		WHERE collection_name = ? AND tenant_id = ?
+		ORDER BY created_at, rowid`, collectionName, db.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list document hashes: %w", err)
+	}
+	defer rows.Close()
+
+	var documents []StoredDocument
+	for rows.Next() {
+		var doc StoredDocument
+		if err := rows.Scan(&doc.ID, &doc.Source, &doc.ContentHash); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		documents = append(documents, doc)
+	}
+	return documents, rows.Err()
+}
+
+// FindChunksByHash returns the embedded, non-duplicate chunks of a collection whose text hash is one of hashes
+func (db *VectorDB) FindChunksByHash(collectionName string, hashes []string) ([]CanonicalChunk, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(hashes)), ",")
+	args := []interface{}{collectionName, db.tenant}
+	for _, hash := range hashes {
+		args = append(args, hash)
+	}
+
+	rows, err := db.conn.Query(`SELECT id, document_id, content_hash FROM enhanced_chunks
+		WHERE collection_name = ? AND tenant_id = ? AND duplicate_of IS NULL
+		  AND content_hash IN (`+placeholders+`)
+		ORDER BY created_at, chunk_index`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up chunks by hash: %w", err)
+	}
+
+	var chunks []CanonicalChunk
+	var ids []string
+	for rows.Next() {
+		var chunk CanonicalChunk
+		if err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.ContentHash); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		chunks = append(chunks, chunk)
+		ids = append(ids, chunk.ID)
+	}
+	rows.Close()
+
+	dimension, err := db.storedDimension(db.conn, collectionName)
+	if err != nil || dimension == 0 {
+		return nil, err
+	}
+	embeddings, err := db.GetChunkEmbeddings(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only chunks with an embedding can stand in for new ones
+	embedded := chunks[:0]
+	for _, chunk := range chunks {
+		if embedding, ok := embeddings[chunk.ID]; ok {
+			chunk.Embedding = embedding
+			embedded = append(embedded, chunk)
+		}
+	}
+	return embedded, nil
+}
+
+// promoteDuplicates runs before the given chunks are deleted or rewritten: for each one, the oldest
+// chunk duplicating it takes over its embedding and full-text entry, and the other duplicates are
+// re-pointed to that chunk. Duplicates inside excludeDocumentID are ignored as they are going away too.
+// It returns the chunks that took over an embedding.
+func (db *VectorDB) promoteDuplicates(tx *sql.Tx, chunkIDs []string, excludeDocumentID string) (heirs []string, err error) {
+	terms := make(termStatsDelta)
+	for _, chunkID := range chunkIDs {
+		duplicates, err := queryStrings(tx, `SELECT id FROM enhanced_chunks
+			WHERE duplicate_of = ? AND document_id != ? AND tenant_id = ?
+			ORDER BY created_at, chunk_index, id`, chunkID, excludeDocumentID, db.tenant)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up duplicate chunks: %w", err)
+		}
+		if len(duplicates) == 0 {
+			continue
+		}
+		heir := duplicates[0]
+		heirs = append(heirs, heir)
+
+		if err := db.copyEmbeddings(tx, chunkID, heir); err != nil {
+			return nil, fmt.Errorf("failed to move embedding to duplicate chunk: %w", err)
+		}
+		var collectionName, indexedText string
+		if err := tx.QueryRow(`SELECT collection_name, rag_index(text) FROM enhanced_chunks WHERE id = ?`, heir).Scan(&collectionName, &indexedText); err != nil {
+			return nil, fmt.Errorf("failed to read duplicate chunk: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO chunk_fts (chunk_id, collection_name, text) VALUES (?, ?, ?)`, heir, collectionName, indexedText); err != nil {
+			return nil, fmt.Errorf("failed to update full-text index: %w", err)
+		}
+		terms.add(collectionName, indexedText, 1)
+		if _, err := tx.Exec(`UPDATE enhanced_chunks SET duplicate_of = NULL WHERE id = ?`, heir); err != nil {
+			return nil, fmt.Errorf("failed to promote duplicate chunk: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE enhanced_chunks SET duplicate_of = ? WHERE duplicate_of = ? AND tenant_id = ?`,
+			heir, chunkID, db.tenant); err != nil {
+			return nil, fmt.Errorf("failed to re-point duplicate chunks: %w", err)
+		}
+	}
+	return heirs, db.applyTermStats(tx, terms)
+}
+
+// reuseStoredChunks avoids re-embedding text the collection already holds. Chunks matching a chunk of
+// the previous version of the document take over its embedding, unless they were supplied with one; chunks
+// matching another document, or an earlier chunk of the same document, are stored as duplicates without an
+// embedding of their own.
+func (r *RAGService) reuseStoredChunks(collectionName string, doc *models.Document, previousID string) (reused, deduplicated int, err error) {
+	hashes := make([]string, 0, len(doc.Chunks))
+	seenHash := make(map[string]bool)
+	for _, chunk := range doc.Chunks {
+		chunk.ContentHash = ContentHash([]byte(embeddingText(chunk)))
+		if !seenHash[chunk.ContentHash] {
+			seenHash[chunk.ContentHash] = true
+			hashes = append(hashes, chunk.ContentHash)
+		}
+	}
+
+	stored, err := r.vectorDB.FindChunksByHash(collectionName, hashes)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fromPrevious := make(map[string]CanonicalChunk)
+	fromOthers := make(map[string]CanonicalChunk)
+	for _, chunk := range stored {
+		if chunk.DocumentID == previousID {
+			if _, ok := fromPrevious[chunk.ContentHash]; !ok {
+				fromPrevious[chunk.ContentHash] = chunk
+			}
+		} else if _, ok := fromOthers[chunk.ContentHash]; !ok {
+			fromOthers[chunk.ContentHash] = chunk
+		}
+	}
+
+	firstInDocument := make(map[string]string)
+	for _, chunk := range doc.Chunks {
+		if other, ok := fromOthers[chunk.ContentHash]; ok {
+			id := other.ID
+			chunk.DuplicateOf, chunk.Embedding = &id, nil
+			deduplicated++
+			continue
+		}
+		if first, ok := firstInDocument[chunk.ContentHash]; ok {
+			id := first
+			chunk.DuplicateOf, chunk.Embedding = &id, nil
+			deduplicated++
+			continue
+		}
+		firstInDocument[chunk.ContentHash] = chunk.ID
+
+		if old, ok := fromPrevious[chunk.ContentHash]; ok && len(chunk.Embedding) == 0 {
+			chunk.Embedding = old.Embedding
+			reused++
+		}
+	}
+
+	return reused, deduplicated, nil
+}
+
+// SyncCollection reconciles a collection with a manifest: unchanged sources are skipped by hash,
+// changed ones are re-ingested incrementally, and with DeleteMissing sources absent from the
+// manifest are deleted. A failing entry is reported in its result and does not stop the others;
+// a cancelled or timed out ctx stops the sync.
+func (r *RAGService) SyncCollection(ctx context.Context, collectionName string, req *models.SyncRequest) ([]SyncResult, error) {
+	startTime := time.Now()
+
+	stored, err := r.vectorDB.ListDocumentHashes(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	bySource := make(map[string]StoredDocument, len(stored))
+	for _, doc := range stored {
+		bySource[doc.Source] = doc // Later documents win when a source was stored twice
+	}
+
+	results := make([]SyncResult, 0, len(req.Documents))
+	inManifest := make(map[string]bool, len(req.Documents))
+	for _, entry := range req.Documents {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		inManifest[entry.Source] = true
+		result := SyncResult{Source: entry.Source}
+
+		existing, found := bySource[entry.Source]
+		switch {
+		case found && entry.ContentHash != "" && strings.EqualFold(entry.ContentHash, existing.ContentHash):
+			result.Status = IngestUnchanged
+			result.DocumentID = existing.ID
+		case entry.Content == "" && entry.FilePath == "":
+			result.Status = SyncNeedsContent
+			if found {
+				result.DocumentID = existing.ID
+			}
+		default:
+			ingested, err := r.IngestDocument(ctx, collectionName, &models.AddDocumentRequest{
+				CollectionName: collectionName,
+				Source:         entry.Source,
+				Content:        entry.Content,
+				FilePath:       entry.FilePath,
+				DocType:        entry.DocType,
+				ChunkingConfig: entry.ChunkingConfig,
+			})
+			if err != nil {
+				result.Status = SyncFailed
+				result.Error = err.Error()
+			} else {
+				result.IngestResult = *ingested
+			}
+		}
+		results = append(results, result)
+	}
+
+	if req.DeleteMissing {
+		for _, doc := range stored {
+			if inManifest[doc.Source] {
+				continue
+			}
+			result := SyncResult{Source: doc.Source, IngestResult: IngestResult{Status: SyncDeleted, DocumentID: doc.ID}}
+			if err := r.vectorDB.DeleteDocument(doc.ID); err != nil {
+				result.Status = SyncFailed
+				result.Error = err.Error()
+			}
+			results = append(results, result)
+		}
+	}
+
+	log.Printf("Synced collection '%s' with %d manifest entries in %v",
+		collectionName, len(req.Documents), time.Since(startTime))
+
+	return results, nil
+}
@@ -0,0 +1,401 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Documents are duplicates when their raw sources have the same content hash, and near-duplicates
+// when their document embeddings are at least as similar as the report's threshold. Groups are the
+// connected sets of such pairs, so a chain of revisions ends up in one group.
+
+const (
+	defaultDuplicateThreshold = 0.95
+	exactDuplicateScan        = 2000 // Documents compared pair by pair; larger collections are searched with HNSW
+	duplicateNeighbours       = 10   // Nearest documents checked per document in an HNSW search
+)
+
+// Match kinds and suggested actions of duplicate groups
+const (
+	ExactDuplicate = "exact"
+	NearDuplicate  = "near"
+
+	DeleteDuplicates = "delete"
+	MergeDuplicates  = "merge"
+)
+
+// ErrInvalidResolution is returned for duplicate resolutions that keep a document they remove or
+// name one twice
+var ErrInvalidResolution = errors.New("invalid duplicate resolution")
+
+// duplicateCandidate is a document being compared
+type duplicateCandidate struct {
+	models.DuplicateDocument
+	embedding []float32 // Normalized; nil for documents without embedded chunks
+}
+
+// FindDuplicates reports the groups of documents of a collection with the same content or
+// embeddings at least as similar as the threshold, suggesting for each group the document to keep:
+// the one with the longest content, then the oldest. Document embeddings missing since chunks
+// changed are computed first.
+func (r *RAGService) FindDuplicates(ctx context.Context, collectionName string, req *models.DuplicatesRequest) (*models.DuplicatesReport, error) {
+	start := time.Now()
+	threshold := req.Threshold
+	if threshold <= 0 {
+		threshold = defaultDuplicateThreshold
+	}
+	if err := r.vectorDB.requireCollection(r.vectorDB.conn, collectionName); err != nil {
+		return nil, err
+	}
+	unembedded, err := r.vectorDB.fillDocumentEmbeddings(ctx, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := r.vectorDB.duplicateCandidates(ctx, collectionName, req.Principal)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := newDisjointSet(len(candidates))
+	byHash := make(map[string]int)
+	for i, candidate := range candidates {
+		if candidate.ContentHash == "" {
+			continue
+		}
+		if first, ok := byHash[candidate.ContentHash]; ok {
+			groups.union(first, i)
+		} else {
+			byHash[candidate.ContentHash] = i
+		}
+	}
+	if err := linkSimilarDocuments(ctx, candidates, threshold, groups); err != nil {
+		return nil, err
+	}
+
+	report := &models.DuplicatesReport{
+		CollectionName:   collectionName,
+		Threshold:        threshold,
+		Groups:           []models.DuplicateGroup{},
+		DocumentsScanned: len(candidates),
+		Unembedded:       unembedded,
+	}
+	for _, members := range groups.sets() {
+		if len(members) < 2 {
+			continue
+		}
+		group := duplicateGroup(candidates, members)
+		report.RedundantDocuments += len(group.Remove)
+		report.Groups = append(report.Groups, group)
+	}
+	sort.SliceStable(report.Groups, func(i, j int) bool {
+		if len(report.Groups[i].Documents) != len(report.Groups[j].Documents) {
+			return len(report.Groups[i].Documents) > len(report.Groups[j].Documents)
+		}
+		return report.Groups[i].Keep < report.Groups[j].Keep
+	})
+	for i := range report.Groups {
+		report.Groups[i].ID = i + 1
+	}
+	report.ProcessingTime = time.Since(start).Seconds()
+	return report, nil
+}
+
+// duplicateCandidates reads the documents of a collection the principal may see with their
+// normalized embeddings
+func (db *VectorDB) duplicateCandidates(ctx context.Context, collectionName string, principal *models.Principal) ([]*duplicateCandidate, error) {
+	query := `SELECT d.id, COALESCE(d.source, ''), COALESCE(d.doc_type, ''), COALESCE(json_extract(d.metadata, '$.title'), ''),
+		d.chunk_count, COALESCE(d.char_count, 0), d.created_at, COALESCE(d.content_hash, ''), d.embedding
+		FROM documents d WHERE d.collection_name = ? AND d.tenant_id = ?`
+	args := []interface{}{collectionName, db.tenant}
+	if principal != nil {
+		condition, principalArgs := documentACLCondition(principal)
+		query += " AND " + condition
+		args = append(args, principalArgs...)
+	}
+	rows, err := db.conn.QueryContext(ctx, query+" ORDER BY d.created_at, d.id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []*duplicateCandidate
+	dimension := 0
+	for rows.Next() {
+		candidate := &duplicateCandidate{}
+		var blob []byte
+		if err := rows.Scan(&candidate.DocumentID, &candidate.Source, &candidate.DocType, &candidate.Title,
+			&candidate.ChunkCount, &candidate.CharCount, &candidate.CreatedAt, &candidate.ContentHash, &blob); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		if blob != nil {
+			candidate.embedding = normalizedEmbedding(deserializeFloat32(blob))
+			if dimension == 0 {
+				dimension = len(candidate.embedding)
+			}
+			if len(candidate.embedding) != dimension {
+				// Stored before the collection was re-embedded with another model
+				candidate.embedding = nil
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	return candidates, nil
+}
+
+// linkSimilarDocuments joins the groups of documents whose embeddings are at least as similar as
+// the threshold. Small collections compare every pair; larger ones check the nearest neighbours of
+// each document in an HNSW graph, which can miss a pair but not report a false one.
+func linkSimilarDocuments(ctx context.Context, candidates []*duplicateCandidate, threshold float64, groups *disjointSet) error {
+	var embedded []int
+	for i, candidate := range candidates {
+		if candidate.embedding != nil {
+			embedded = append(embedded, i)
+		}
+	}
+
+	if len(embedded) <= exactDuplicateScan {
+		for a, i := range embedded {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			for _, j := range embedded[a+1:] {
+				if dot(candidates[i].embedding, candidates[j].embedding) >= threshold {
+					groups.union(i, j)
+				}
+			}
+		}
+		return nil
+	}
+
+	graph := newHNSWGraph(16, 100)
+	index := make(map[string]int, len(embedded))
+	for _, i := range embedded {
+		graph.add(candidates[i].DocumentID, candidates[i].embedding)
+		index[candidates[i].DocumentID] = i
+	}
+	for _, i := range embedded {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, neighbour := range graph.search(candidates[i].embedding, duplicateNeighbours+1, 4*duplicateNeighbours) {
+			j := index[graph.nodes[neighbour.node].id]
+			if j != i && dot(candidates[i].embedding, candidates[j].embedding) >= threshold {
+				groups.union(i, j)
+			}
+		}
+	}
+	return nil
+}
+
+// duplicateGroup describes a group of duplicate documents, suggesting to keep the one with the
+// longest content, then the oldest, and to remove the others
+func duplicateGroup(candidates []*duplicateCandidate, members []int) models.DuplicateGroup {
+	sort.SliceStable(members, func(a, b int) bool {
+		x, y := candidates[members[a]], candidates[members[b]]
+		if x.CharCount != y.CharCount {
+			return x.CharCount > y.CharCount
+		}
+		return x.CreatedAt.Before(y.CreatedAt)
+	})
+	kept := candidates[members[0]]
+
+	group := models.DuplicateGroup{Match: ExactDuplicate, MinSimilarity: 1, Keep: kept.DocumentID, Remove: []string{}, SuggestedAction: DeleteDuplicates}
+	for n, i := range members {
+		document := candidates[i].DuplicateDocument
+		document.Similarity = 1
+		if document.ContentHash == "" || document.ContentHash != kept.ContentHash {
+			group.Match, group.SuggestedAction = NearDuplicate, MergeDuplicates
+			document.Similarity = cosineSimilarity(candidates[i].embedding, kept.embedding)
+		}
+		group.MinSimilarity = min(group.MinSimilarity, document.Similarity)
+		group.Documents = append(group.Documents, document)
+		if n > 0 {
+			group.Remove = append(group.Remove, document.DocumentID)
+		}
+	}
+	return group
+}
+
+// disjointSet is a union-find structure over the indexes 0 to n-1
+type disjointSet struct {
+	parent []int
+}
+
+// newDisjointSet returns n sets of one index each
+func newDisjointSet(n int) *disjointSet {
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	return &disjointSet{parent: parent}
+}
+
+// find returns the representative of the set of i
+func (s *disjointSet) find(i int) int {
+	for s.parent[i] != i {
+		s.parent[i] = s.parent[s.parent[i]]
+		i = s.parent[i]
+	}
+	return i
+}
+
+// union joins the sets of i and j
+func (s *disjointSet) union(i, j int) {
+	if a, b := s.find(i), s.find(j); a != b {
+		s.parent[max(a, b)] = min(a, b)
+	}
+}
+
+// sets returns the members of every set, each in index order
+func (s *disjointSet) sets() [][]int {
+	members := make(map[int][]int)
+	var roots []int
+	for i := range s.parent {
+		root := s.find(i)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], i)
+	}
+	sets := make([][]int, len(roots))
+	for n, root := range roots {
+		sets[n] = members[root]
+	}
+	return sets
+}
+
+// ResolveDuplicates deletes the duplicates of a kept document. With merge_metadata, the metadata
+// fields the kept document lacks are first copied from the removed documents, in the order given,
+// and the sources of the removed documents are added to its duplicate_sources metadata. Access
+// lists are left as they are.
+func (r *RAGService) ResolveDuplicates(ctx context.Context, collectionName string, req *models.ResolveDuplicatesRequest) (*models.ResolveDuplicatesResponse, error) {
+	seen := map[string]bool{req.Keep: true}
+	for _, id := range req.Remove {
+		if seen[id] {
+			return nil, fmt.Errorf("%w: document '%s' is named more than once", ErrInvalidResolution, id)
+		}
+		seen[id] = true
+	}
+
+	ids := append([]string{req.Keep}, req.Remove...)
+	metadata, sources, err := r.vectorDB.collectionDocumentMetadata(collectionName, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.ResolveDuplicatesResponse{CollectionName: collectionName, Keep: req.Keep, Removed: []string{}}
+	if req.MergeMetadata {
+		merged := metadata[req.Keep]
+		for _, id := range req.Remove {
+			for _, key := range sortedKeys(metadata[id]) {
+				if _, ok := merged[key]; !ok && key != duplicateSourcesKey {
+					merged[key] = metadata[id][key]
+					resp.MergedFields = append(resp.MergedFields, key)
+				}
+			}
+			if sources[id] != "" && sources[id] != sources[req.Keep] && !contains(resp.MergedSources, sources[id]) {
+				resp.MergedSources = append(resp.MergedSources, sources[id])
+			}
+		}
+		if len(resp.MergedSources) > 0 {
+			recorded, _ := merged[duplicateSourcesKey].([]interface{})
+			for _, source := range resp.MergedSources {
+				recorded = append(recorded, source)
+			}
+			merged[duplicateSourcesKey] = recorded
+		}
+		if len(resp.MergedFields) > 0 || len(resp.MergedSources) > 0 {
+			if err := r.vectorDB.updateDocumentMetadata(req.Keep, merged); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, id := range req.Remove {
+		if err := ctx.Err(); err != nil {
+			return resp, err
+		}
+		if err := r.vectorDB.DeleteDocument(id); err != nil {
+			return resp, err
+		}
+		resp.Removed = append(resp.Removed, id)
+	}
+	log.Printf("Resolved duplicates of document '%s': removed %d, merged %d metadata fields", req.Keep, len(resp.Removed), len(resp.MergedFields))
+	return resp, nil
+}
+
+// duplicateSourcesKey is the document metadata field listing the sources of duplicates merged into it
+const duplicateSourcesKey = "duplicate_sources"
+
+// collectionDocumentMetadata returns the metadata and source of each given document, failing when
+// one isn't in the collection
+func (db *VectorDB) collectionDocumentMetadata(collectionName string, ids []string) (map[string]map[string]interface{}, map[string]string, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, 0, len(ids)+2)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, collectionName, db.tenant)
+
+	rows, err := db.conn.Query(`SELECT id, COALESCE(source, ''), COALESCE(metadata, '{}') FROM documents
+		WHERE id IN (`+placeholders+`) AND collection_name = ? AND tenant_id = ?`, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up documents: %w", err)
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]map[string]interface{}, len(ids))
+	sources := make(map[string]string, len(ids))
+	for rows.Next() {
+		var id, source, metadataJSON string
+		if err := rows.Scan(&id, &source, &metadataJSON); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(metadataJSON), &fields); err != nil || fields == nil {
+			fields = make(map[string]interface{})
+		}
+		metadata[id], sources[id] = fields, source
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to look up documents: %w", err)
+	}
+	for _, id := range ids {
+		if _, ok := metadata[id]; !ok {
+			return nil, nil, fmt.Errorf("document '%s' not found in collection '%s'", id, collectionName)
+		}
+	}
+	return metadata, sources, nil
+}
+
+// updateDocumentMetadata replaces the metadata of a document
+func (db *VectorDB) updateDocumentMetadata(documentID string, metadata map[string]interface{}) error {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	if _, err := db.conn.Exec(`UPDATE documents SET metadata = ? WHERE id = ? AND tenant_id = ?`, string(metadataJSON), documentID, db.tenant); err != nil {
+		return fmt.Errorf("failed to update document metadata: %w", err)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+// EmbeddingCache persists embeddings keyed by a hash of the model name and text
+type EmbeddingCache interface {
+	GetCachedEmbeddings(keys []string) (map[string][]float32, error)
+	PutCachedEmbeddings(model string, entries map[string][]float32) error
+}
+
+var embeddingCache EmbeddingCache
+
+// SetEmbeddingCache installs the cache consulted by GetEmbeddings. Passing nil disables caching.
+func SetEmbeddingCache(cache EmbeddingCache) {
+	embeddingCache = cache
+}
+
+// embeddingCacheKey returns sha256(text + model) as a hex string
+func embeddingCacheKey(text, modelName string) string {
+	sum := sha256.Sum256([]byte(text + "\x00" + modelName))
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheLookupBatchSize keeps IN (...) lists below SQLite's host parameter limit
+const cacheLookupBatchSize = 500
+
+// GetCachedEmbeddings returns the cached embeddings for the given keys; missing keys are omitted
+func (db *VectorDB) GetCachedEmbeddings(keys []string) (map[string][]float32, error) {
+	found := make(map[string][]float32, len(keys))
+
+	for start := 0; start < len(keys); start += cacheLookupBatchSize {
+		end := start + cacheLookupBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := keys[start:end]
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		args := make([]interface{}, len(batch))
+		for i, key := range batch {
+			args[i] = key
+		}
+
+		rows, err := db.conn.Query(`SELECT hash, embedding FROM embedding_cache WHERE hash IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedding cache: %w", err)
+		}
+
+		for rows.Next() {
+			var hash string
+			var blob []byte
+			if err := rows.Scan(&hash, &blob); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan cached embedding: %w", err)
+			}
+			found[hash] = deserializeFloat32(blob)
+		}
+		rows.Close()
+	}
+
+	return found, nil
+}
+
+// PutCachedEmbeddings stores embeddings produced by the given model
+func (db *VectorDB) PutCachedEmbeddings(model string, entries map[string][]float32) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO embedding_cache (hash, model, dimension, embedding) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare cache insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for hash, embedding := range entries {
+		blob, err := sqlite_vec.SerializeFloat32(embedding)
+		if err != nil {
+			return fmt.Errorf("failed to serialize embedding: %w", err)
+		}
+		if _, err := stmt.Exec(hash, model, len(embedding), blob); err != nil {
+			return fmt.Errorf("failed to write embedding cache: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deserializeFloat32 decodes a little-endian float32 blob as written by sqlite_vec.SerializeFloat32
+func deserializeFloat32(blob []byte) []float32 {
+	vector := make([]float32, len(blob)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[i*4:]))
+	}
+	return vector
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImportResult reports the outcome of importing one pre-embedded document
+type ImportResult struct {
+	DocumentID string `json:"document_id"`
+	Source     string `json:"source,omitempty"`
+	ChunkCount int    `json:"chunk_count"`
+
+	ChunksEmbedded int `json:"chunks_embedded,omitempty"` // Chunks embedded on import rather than imported with their embeddings
+}
+
+// ImportDocuments stores documents whose chunks already carry embeddings, bypassing the embedding backend.
+// All embeddings must share one dimension, and it must match the dimension of already stored vectors.
+func (r *RAGService) ImportDocuments(req *models.ImportEmbeddingsRequest) ([]ImportResult, error) {
+	startTime := time.Now()
+
+	if len(req.Documents) == 0 {
+		return nil, fmt.Errorf("invalid import: no documents provided")
+	}
+	if err := r.vectorDB.requireCollection(r.vectorDB.conn, req.CollectionName); err != nil {
+		return nil, err
+	}
+
+	dimension, err := r.vectorDB.storedDimension(r.vectorDB.conn, req.CollectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate every embedding before writing anything
+	for d, imported := range req.Documents {
+		if len(imported.Chunks) == 0 {
+			return nil, fmt.Errorf("invalid import: document %d has no chunks", d)
+		}
+		for c, chunk := range imported.Chunks {
+			if strings.TrimSpace(chunk.Text) == "" {
+				return nil, fmt.Errorf("invalid import: document %d chunk %d has empty text", d, c)
+			}
+			if len(chunk.Embedding) == 0 {
+				return nil, fmt.Errorf("invalid import: document %d chunk %d has no embedding", d, c)
+			}
+			if dimension == 0 {
+				dimension = len(chunk.Embedding)
+			}
+			if len(chunk.Embedding) != dimension {
+				return nil, fmt.Errorf("invalid import: document %d chunk %d has embedding dimension %d, collection expects %d",
+					d, c, len(chunk.Embedding), dimension)
+			}
+		}
+	}
+
+	results := make([]ImportResult, 0, len(req.Documents))
+	for _, imported := range req.Documents {
+		doc := buildImportedDocument(imported)
+
+		if err := r.vectorDB.AddDocument(req.CollectionName, doc); err != nil {
+			err = fmt.Errorf("failed to add document %s: %w", doc.ID, err)
+			r.publishIngestion(req.CollectionName, doc.Source, nil, err)
+			return results, err
+		}
+		if err := r.vectorDB.AddEmbeddings(req.CollectionName, doc.Chunks); err != nil {
+			err = fmt.Errorf("failed to add embeddings for document %s: %w", doc.ID, err)
+			r.publishIngestion(req.CollectionName, doc.Source, nil, err)
+			return results, err
+		}
+		r.publishIngestion(req.CollectionName, doc.Source, &IngestResult{Status: IngestAdded, DocumentID: doc.ID}, nil)
+
+		results = append(results, ImportResult{
+			DocumentID: doc.ID,
+			Source:     doc.Source,
+			ChunkCount: len(doc.Chunks),
+		})
+	}
+
+	log.Printf("Imported %d pre-embedded documents into '%s' in %v",
+		len(results), req.CollectionName, time.Since(startTime))
+
+	return results, nil
+}
+
+// buildImportedDocument converts an imported document into the internal document model
+func buildImportedDocument(imported models.ImportedDocument) *models.Document {
+	docID := imported.ID
+	if docID == "" {
+		docID = uuid.New().String()
+	}
+
+	metadata := map[string]interface{}{}
+	for key, value := range imported.Metadata {
+		metadata[key] = value
+	}
+	metadata["chunking_strategy"] = "imported"
+	metadata["chunk_count"] = len(imported.Chunks)
+
+	chunks := make([]*models.EnhancedChunk, len(imported.Chunks))
+	texts := make([]string, len(imported.Chunks))
+	for i, c := range imported.Chunks {
+		chunkType := c.ChunkType
+		if chunkType == "" {
+			chunkType = "imported"
+		}
+
+		chunks[i] = &models.EnhancedChunk{
+			ID:         uuid.New().String(),
+			DocumentID: docID,
+			Text:       c.Text,
+			Embedding:  c.Embedding,
+			Section:    c.Section,
+			Subsection: c.Subsection,
+			ChunkType:  chunkType,
+			StartPos:   c.StartPos,
+			EndPos:     c.EndPos,
+			ChunkIndex: i,
+			Keywords:   c.Keywords,
+			Metadata:   c.Metadata,
+		}
+		texts[i] = c.Text
+	}
+
+	content := imported.Content
+	if content == "" {
+		content = strings.Join(texts, "\n\n")
+	}
+
+	return &models.Document{
+		ID:        docID,
+		Content:   content,
+		Chunks:    chunks,
+		Source:    imported.Source,
+		Metadata:  metadata,
+		DocType:   imported.DocType,
+		CreatedAt: time.Now(),
+		ACL:       imported.ACL,
+	}
+}
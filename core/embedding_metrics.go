@@ -0,0 +1,63 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EmbeddingMetrics counts the work done by the shared embedding path since the server started
+type EmbeddingMetrics struct {
+	Texts            int64     `json:"texts"`             // Texts embedded, by ingestion, queries and /v1/embeddings
+	CacheHits        int64     `json:"cache_hits"`        // Texts served from the embedding cache
+	CacheHitRate     float64   `json:"cache_hit_rate"`    // CacheHits over Texts
+	BackendTexts     int64     `json:"backend_texts"`     // Texts sent to the model server
+	BackendBatches   int64     `json:"backend_batches"`   // Requests sent to the model server
+	BackendFailures  int64     `json:"backend_failures"`  // Requests that failed after retries and failover
+	AvgBatchMS       float64   `json:"avg_batch_ms"`      // Mean time per request to the model server
+	EndpointRequests int64     `json:"endpoint_requests"` // Requests to /v1/embeddings
+	EndpointInputs   int64     `json:"endpoint_inputs"`   // Inputs in those requests, before deduplication
+	EndpointErrors   int64     `json:"endpoint_errors"`   // Requests to /v1/embeddings that failed
+	Since            time.Time `json:"since"`             // When counting started
+}
+
+// embeddingCounters are updated concurrently by every caller of the embedding path
+var embeddingCounters struct {
+	texts, cacheHits, backendTexts                   atomic.Int64
+	backendBatches, backendFailures, backendNanos    atomic.Int64
+	endpointRequests, endpointInputs, endpointErrors atomic.Int64
+}
+
+var embeddingMetricsSince = time.Now()
+
+// recordEmbeddingBatch counts one request to the model server
+func recordEmbeddingBatch(texts int, elapsed time.Duration, err error) {
+	embeddingCounters.backendBatches.Add(1)
+	embeddingCounters.backendNanos.Add(int64(elapsed))
+	if err != nil {
+		embeddingCounters.backendFailures.Add(1)
+		return
+	}
+	embeddingCounters.backendTexts.Add(int64(texts))
+}
+
+// GetEmbeddingMetrics returns the embedding counters and the rates derived from them
+func GetEmbeddingMetrics() EmbeddingMetrics {
+	metrics := EmbeddingMetrics{
+		Texts:            embeddingCounters.texts.Load(),
+		CacheHits:        embeddingCounters.cacheHits.Load(),
+		BackendTexts:     embeddingCounters.backendTexts.Load(),
+		BackendBatches:   embeddingCounters.backendBatches.Load(),
+		BackendFailures:  embeddingCounters.backendFailures.Load(),
+		EndpointRequests: embeddingCounters.endpointRequests.Load(),
+		EndpointInputs:   embeddingCounters.endpointInputs.Load(),
+		EndpointErrors:   embeddingCounters.endpointErrors.Load(),
+		Since:            embeddingMetricsSince,
+	}
+	if metrics.Texts > 0 {
+		metrics.CacheHitRate = float64(metrics.CacheHits) / float64(metrics.Texts)
+	}
+	if metrics.BackendBatches > 0 {
+		metrics.AvgBatchMS = float64(embeddingCounters.backendNanos.Load()) / float64(metrics.BackendBatches) / float64(time.Millisecond)
+	}
+	return metrics
+}
@@ -2,7 +2,9 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,6 +12,7 @@ import (
 	"rag-go-app/config"
 	"rag-go-app/models"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,38 +26,158 @@ const (
 	minBatchSize              = 1    // Minimum batch size
 )
 
-// GetEmbeddings sends text(s) to the LlamaCPP server's embedding endpoint with adaptive batching.
-func GetEmbeddings(texts []string, modelName string) ([][]float32, error) {
+// GetEmbeddings returns embeddings for text(s), serving repeated texts from the embedding cache
+// and sending the rest to the configured provider with adaptive batching.
+func GetEmbeddings(ctx context.Context, texts []string, modelName string) ([][]float32, error) {
 	if modelName == "" {
 		modelName = config.AppConfig.EmbeddingModel
 	}
 
+	ctx, span := startSpan(ctx, "GetEmbeddings")
+	span.SetAttribute("gen_ai.request.model", modelName)
+	span.SetAttribute("rag.texts", len(texts))
+	embeddings, fresh, err := embedWithCache(ctx, texts, modelName)
+	if err != nil {
+		span.End(err)
+		return nil, err
+	}
+	fetched := len(texts)
+	if embeddingCache != nil {
+		fetched = len(fresh)
+	}
+	span.SetAttribute("rag.fetched_texts", fetched)
+	span.End(nil)
+	storeCachedEmbeddings(modelName, fresh)
+	return embeddings, nil
+}
+
+// embedWithCache serves texts from the embedding cache and fetches the rest, without writing the
+// cache. It returns the newly fetched embeddings keyed by cache key for the caller to store.
+func embedWithCache(ctx context.Context, texts []string, modelName string) ([][]float32, map[string][]float32, error) {
 	if len(texts) == 0 {
-		return [][]float32{}, nil
+		return [][]float32{}, nil, nil
+	}
+	embeddingCounters.texts.Add(int64(len(texts)))
+	ctx, splits := withEmbeddingSplits(ctx)
+
+	if embeddingCache == nil {
+		embeddings, err := fetchEmbeddings(ctx, texts, modelName)
+		return embeddings, nil, err
+	}
+
+	keys := make([]string, len(texts))
+	for i, text := range texts {
+		keys[i] = embeddingCacheKey(text, modelName)
+	}
+
+	cached, err := embeddingCache.GetCachedEmbeddings(keys)
+	if err != nil {
+		log.Printf("Embedding cache lookup failed, embedding all texts: %v", err)
+		cached = map[string][]float32{}
+	}
+
+	allEmbeddings := make([][]float32, len(texts))
+	var missingTexts []string
+	var missingIndices []int
+	for i, key := range keys {
+		if embedding, ok := cached[key]; ok {
+			allEmbeddings[i] = embedding
+		} else {
+			missingTexts = append(missingTexts, texts[i])
+			missingIndices = append(missingIndices, i)
+		}
+	}
+
+	embeddingCounters.cacheHits.Add(int64(len(texts) - len(missingTexts)))
+	if len(missingTexts) == 0 {
+		log.Printf("Served all %d embeddings from cache", len(texts))
+		return allEmbeddings, nil, nil
+	}
+	if len(cached) > 0 {
+		log.Printf("Served %d of %d embeddings from cache", len(texts)-len(missingTexts), len(texts))
+	}
+
+	fetched, err := fetchEmbeddings(ctx, missingTexts, modelName)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	fresh := make(map[string][]float32, len(fetched))
+	for i, embedding := range fetched {
+		allEmbeddings[missingIndices[i]] = embedding
+		// Texts embedded in pieces aren't cached, so they are reported as split every time
+		if splits.of(texts[missingIndices[i]]) == 0 {
+			fresh[keys[missingIndices[i]]] = embedding
+		}
+	}
+
+	return allEmbeddings, fresh, nil
+}
+
+// storeCachedEmbeddings writes fetched embeddings to the cache; failures only cost a future re-fetch
+func storeCachedEmbeddings(modelName string, entries map[string][]float32) {
+	if embeddingCache == nil || len(entries) == 0 {
+		return
+	}
+	if err := embeddingCache.PutCachedEmbeddings(modelName, entries); err != nil {
+		log.Printf("Failed to store embeddings in cache: %v", err)
+	}
+}
+
+// fetchEmbeddings sends texts to the embedding endpoint in adaptive batches,
+// running up to EmbeddingConcurrency batches in parallel while preserving result order
+func fetchEmbeddings(ctx context.Context, texts []string, modelName string) ([][]float32, error) {
 	allEmbeddings := make([][]float32, len(texts))
 
 	// Create adaptive batches
 	batches := createAdaptiveBatches(texts)
 
-	log.Printf("Processing %d texts in %d adaptive batches", len(texts), len(batches))
+	concurrency := config.AppConfig.EmbeddingConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > len(batches) {
+		concurrency = len(batches)
+	}
+
+	log.Printf("Processing %d texts in %d adaptive batches (concurrency %d)", len(texts), len(batches), concurrency)
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	semaphore := make(chan struct{}, concurrency)
 
 	for batchIndex, batch := range batches {
-		embeddings, err := processBatchWithRetry(batch, modelName, batchIndex)
-		if err != nil {
-			return nil, fmt.Errorf("failed to process batch %d: %w", batchIndex, err)
-		}
+		wg.Add(1)
+		go func(batchIndex int, batch EmbeddingBatch) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			embeddings, err := processBatchWithRetry(ctx, batch, modelName, batchIndex)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("failed to process batch %d: %w", batchIndex, err)
+				})
+				return
+			}
 
-		// Place embeddings in correct positions
-		for i, embedding := range embeddings {
-			globalIndex := batch.StartIndex + i
-			if globalIndex < len(allEmbeddings) {
-				allEmbeddings[globalIndex] = embedding
+			// Place embeddings in correct positions; batches never overlap
+			for i, embedding := range embeddings {
+				globalIndex := batch.StartIndex + i
+				if globalIndex < len(allEmbeddings) {
+					allEmbeddings[globalIndex] = embedding
+				}
 			}
-		}
 
-		log.Printf("Successfully processed batch %d (%d texts)", batchIndex, len(batch.Texts))
+			log.Printf("Successfully processed batch %d (%d texts)", batchIndex, len(batch.Texts))
+		}(batchIndex, batch)
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
 	}
 
 	// Final validation
@@ -63,6 +186,9 @@ func GetEmbeddings(texts []string, modelName string) ([][]float32, error) {
 			return nil, fmt.Errorf("embedding for text at index %d was not populated", idx)
 		}
 	}
+	if err := checkModelDimension(modelName, allEmbeddings); err != nil {
+		return nil, err
+	}
 
 	return allEmbeddings, nil
 }
@@ -123,114 +249,88 @@ func createAdaptiveBatches(texts []string) []EmbeddingBatch {
 	return batches
 }
 
-// Add a function to determine embedding dimension based on model
-func getEmbeddingDimension(modelName string) int {
-	// Map of known models to their dimensions
-	modelDimensions := map[string]int{
-		"mxbai-embed-large":       1024,
-		"mxbai-embed-large:large": 1024,
-		"nomic-embed-text-v1.5":   768,
-		"text-embedding-ada-002":  1536,
-		"text-embedding-3-small":  1536,
-		"text-embedding-3-large":  3072,
-		// Add more models as needed
+// processBatchWithRetry processes a batch, splitting it in half while the server finds it too
+// large. Transient server failures are already retried by sendEmbeddingRequest.
+func processBatchWithRetry(ctx context.Context, batch EmbeddingBatch, modelName string, batchIndex int) ([][]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
+	log.Printf("Batch %d: %d texts, %d chars (~%d tokens)",
+		batchIndex, len(batch.Texts), batch.TotalChars, batch.TotalChars/maxCharsPerToken)
 
-	if dim, exists := modelDimensions[modelName]; exists {
-		return dim
+	embeddings, err := sendEmbeddingRequest(ctx, batch.Texts, modelName)
+	if err == nil {
+		return embeddings, nil
 	}
 
-	// Default to 1024 for unknown models (mxbai-embed-large is common)
-	log.Printf("Unknown model %s, defaulting to 1024 dimensions", modelName)
-	return 1024
-}
-
-// processBatchWithRetry processes a batch with retry logic for oversized batches
-func processBatchWithRetry(batch EmbeddingBatch, modelName string, batchIndex int) ([][]float32, error) {
-	currentBatch := batch
-	maxRetries := 3
-
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		log.Printf("Batch %d attempt %d: %d texts, %d chars (~%d tokens)",
-			batchIndex, attempt+1, len(currentBatch.Texts), currentBatch.TotalChars, currentBatch.TotalChars/maxCharsPerToken)
+	// Check if error indicates batch is too large
+	if !isOversizedBatchError(err) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return nil, err
+	}
 
-		embeddings, err := sendEmbeddingRequest(currentBatch.Texts, modelName)
-		if err == nil {
-			return embeddings, nil
+	// A single text that's too large is embedded in pieces
+	if len(batch.Texts) <= minBatchSize {
+		log.Printf("Single text at batch %d is too large (%d chars), splitting it", batchIndex, batch.TotalChars)
+		embedding, err := embedOversizedText(ctx, batch.Texts[0], modelName)
+		if err != nil {
+			return nil, err
 		}
+		return [][]float32{embedding}, nil
+	}
 
-		// Check if error indicates batch is too large
-		if isOversizedBatchError(err) {
-			// If this is a single text that's too large, we need to handle it differently
-			if len(currentBatch.Texts) == 1 {
-				log.Printf("Single text at batch %d is too large (%d chars), skipping", batchIndex, currentBatch.TotalChars)
-				// Return a placeholder embedding for the oversized text
-				// Determine the correct dimension based on the model
-				dimension := getEmbeddingDimension(modelName)
-				placeholder := make([]float32, dimension)
-				return [][]float32{placeholder}, nil
-			}
-
-			if len(currentBatch.Texts) > minBatchSize {
-				log.Printf("Batch %d is too large, splitting in half (attempt %d)", batchIndex, attempt+1)
-
-				// Split batch in half
-				midpoint := len(currentBatch.Texts) / 2
-
-				// Calculate total chars for first half
-				firstHalfChars := 0
-				for _, text := range currentBatch.Texts[:midpoint] {
-					firstHalfChars += len(text)
-				}
-
-				// Calculate total chars for second half
-				secondHalfChars := 0
-				for _, text := range currentBatch.Texts[midpoint:] {
-					secondHalfChars += len(text)
-				}
+	log.Printf("Batch %d is too large, splitting in half", batchIndex)
 
-				firstHalf := EmbeddingBatch{
-					Texts:      currentBatch.Texts[:midpoint],
-					StartIndex: currentBatch.StartIndex,
-					TotalChars: firstHalfChars,
-				}
-				secondHalf := EmbeddingBatch{
-					Texts:      currentBatch.Texts[midpoint:],
-					StartIndex: currentBatch.StartIndex + midpoint,
-					TotalChars: secondHalfChars,
-				}
+	// Split batch in half
+	midpoint := len(batch.Texts) / 2
 
-				// Process each half
-				firstEmbeddings, err1 := processBatchWithRetry(firstHalf, modelName, batchIndex)
-				if err1 != nil {
-					return nil, fmt.Errorf("failed to process first half of split batch: %w", err1)
-				}
-
-				secondEmbeddings, err2 := processBatchWithRetry(secondHalf, modelName, batchIndex)
-				if err2 != nil {
-					return nil, fmt.Errorf("failed to process second half of split batch: %w", err2)
-				}
+	// Calculate total chars for first half
+	firstHalfChars := 0
+	for _, text := range batch.Texts[:midpoint] {
+		firstHalfChars += len(text)
+	}
 
-				// Combine results
-				combined := append(firstEmbeddings, secondEmbeddings...)
-				return combined, nil
-			}
-		}
+	firstHalf := EmbeddingBatch{
+		Texts:      batch.Texts[:midpoint],
+		StartIndex: batch.StartIndex,
+		TotalChars: firstHalfChars,
+	}
+	secondHalf := EmbeddingBatch{
+		Texts:      batch.Texts[midpoint:],
+		StartIndex: batch.StartIndex + midpoint,
+		TotalChars: batch.TotalChars - firstHalfChars,
+	}
 
-		// If not an oversized batch error, or we can't split further, return the error
-		if attempt == maxRetries-1 || len(currentBatch.Texts) <= minBatchSize {
-			return nil, fmt.Errorf("failed after %d attempts: %w", attempt+1, err)
-		}
+	// Process each half
+	firstEmbeddings, err := processBatchWithRetry(ctx, firstHalf, modelName, batchIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process first half of split batch: %w", err)
+	}
 
-		// Wait a bit before retry
-		time.Sleep(time.Second * time.Duration(attempt+1))
+	secondEmbeddings, err := processBatchWithRetry(ctx, secondHalf, modelName, batchIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process second half of split batch: %w", err)
 	}
 
-	return nil, fmt.Errorf("exceeded maximum retry attempts")
+	// Combine results
+	return append(firstEmbeddings, secondEmbeddings...), nil
+}
+
+// sendEmbeddingRequest embeds one batch with the configured provider, within the embedding timeout,
+// retrying and failing over as configured
+func sendEmbeddingRequest(ctx context.Context, texts []string, modelName string) ([][]float32, error) {
+	var embeddings [][]float32
+	start := time.Now()
+	err := callModelServer(ctx, config.AppConfig.Timeouts.EmbeddingSeconds, func(ctx context.Context, provider Provider) error {
+		var err error
+		embeddings, err = provider.Embed(ctx, texts, modelName)
+		return err
+	})
+	recordEmbeddingBatch(len(texts), time.Since(start), err)
+	return embeddings, err
 }
 
-// sendEmbeddingRequest sends a single embedding request
-func sendEmbeddingRequest(texts []string, modelName string) ([][]float32, error) {
+// Embed sends a batch to the OpenAI-compatible /embeddings endpoint in a single request
+func (p openAIProvider) Embed(ctx context.Context, texts []string, modelName string) ([][]float32, error) {
 	reqPayload := models.EmbeddingRequest{
 		Input: texts,
 		Model: modelName,
@@ -241,8 +341,8 @@ func sendEmbeddingRequest(texts []string, modelName string) ([][]float32, error)
 		return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
 	}
 
-	apiURL := fmt.Sprintf("%s/embeddings", config.AppConfig.LlamaCPPBaseURL)
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(payloadBytes))
+	apiURL := fmt.Sprintf("%s/embeddings", p.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create embedding request: %w", err)
 	}
@@ -259,7 +359,7 @@ func sendEmbeddingRequest(texts []string, modelName string) ([][]float32, error)
 		if resp.Body != nil {
 			errBodyBytes, _ = io.ReadAll(resp.Body)
 		}
-		return nil, fmt.Errorf("embedding API request failed with status %s: %s", resp.Status, string(errBodyBytes))
+		return nil, &backendStatusError{resp.StatusCode, fmt.Sprintf("embedding API request failed with status %s: %s", resp.Status, string(errBodyBytes))}
 	}
 
 	var embeddingResp models.EmbeddingAPIResponse
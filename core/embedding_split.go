@@ -0,0 +1,165 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"rag-go-app/models"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A text too large for the embedding model is split in half at the whitespace nearest its middle,
+// again while a half is still too large, and the embeddings of the pieces are averaged, weighted
+// by their length. The average stands for the whole text, so a chunk keeps one embedding.
+
+// embeddingPiecesKey is the chunk metadata key holding the number of pieces a chunk was embedded in
+const embeddingPiecesKey = "embedding_pieces"
+
+// embeddingSplitsKey is the context key of the embeddingSplits recording texts embedded in pieces
+type embeddingSplitsKey struct{}
+
+// embeddingSplits records the texts embedded in pieces and into how many
+type embeddingSplits struct {
+	mu     sync.Mutex
+	pieces map[string]int
+}
+
+// withEmbeddingSplits returns a context recording texts embedded in pieces, and the record. A
+// context already recording them is returned as it is.
+func withEmbeddingSplits(ctx context.Context) (context.Context, *embeddingSplits) {
+	if splits, ok := ctx.Value(embeddingSplitsKey{}).(*embeddingSplits); ok {
+		return ctx, splits
+	}
+	splits := &embeddingSplits{pieces: make(map[string]int)}
+	return context.WithValue(ctx, embeddingSplitsKey{}, splits), splits
+}
+
+// record notes that text was embedded in pieces
+func (s *embeddingSplits) record(text string, pieces int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pieces[text] = pieces
+}
+
+// of returns the number of pieces text was embedded in, or 0 if it was embedded whole
+func (s *embeddingSplits) of(text string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pieces[text]
+}
+
+// embedOversizedText embeds a text the model found too large by embedding its pieces and averaging
+// them, recording the split in the context's embeddingSplits
+func embedOversizedText(ctx context.Context, text, modelName string) ([]float32, error) {
+	embedding, pieces, err := embedInPieces(ctx, text, modelName)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Warning: text of %d chars was too large for the embedding model; embedded it in %d pieces", len(text), pieces)
+	if splits, ok := ctx.Value(embeddingSplitsKey{}).(*embeddingSplits); ok {
+		splits.record(text, pieces)
+	}
+	return embedding, nil
+}
+
+// embedInPieces embeds the halves of a text, splitting those still too large, and returns their
+// length-weighted mean scaled to the mean length of their vectors, with the number of pieces
+func embedInPieces(ctx context.Context, text, modelName string) ([]float32, int, error) {
+	halves := splitInHalf(text)
+	if len(halves) < 2 {
+		return nil, 0, fmt.Errorf("text of %d chars is too large for the embedding model and can't be split further", len(text))
+	}
+
+	var sum []float64
+	var norm, weights float64
+	pieces := 0
+	for _, half := range halves {
+		var embedding []float32
+		count := 1
+		embeddings, err := sendEmbeddingRequest(ctx, []string{half}, modelName)
+		switch {
+		case err == nil && len(embeddings) == 1:
+			embedding = embeddings[0]
+		case err == nil:
+			return nil, 0, fmt.Errorf("expected 1 embedding, got %d", len(embeddings))
+		case isOversizedBatchError(err) && ctx.Err() == nil:
+			if embedding, count, err = embedInPieces(ctx, half, modelName); err != nil {
+				return nil, 0, err
+			}
+		default:
+			return nil, 0, err
+		}
+
+		if sum == nil {
+			sum = make([]float64, len(embedding))
+		} else if len(embedding) != len(sum) {
+			return nil, 0, fmt.Errorf("pieces of a text were embedded with %d and %d dimensions", len(sum), len(embedding))
+		}
+		weight := float64(utf8.RuneCountInString(half))
+		var length float64
+		for i, value := range embedding {
+			sum[i] += weight * float64(value)
+			length += float64(value) * float64(value)
+		}
+		norm += weight * math.Sqrt(length)
+		weights += weight
+		pieces += count
+	}
+
+	// Averaging shortens the vector; scale it back so distances compare with whole embeddings
+	var length float64
+	for _, value := range sum {
+		length += value * value
+	}
+	scale := 0.0
+	if length > 0 {
+		scale = norm / weights / math.Sqrt(length)
+	}
+	mean := make([]float32, len(sum))
+	for i, value := range sum {
+		mean[i] = float32(value * scale)
+	}
+	return mean, pieces, nil
+}
+
+// splitInHalf splits a text at the whitespace nearest its middle, or at the rune nearest its
+// middle when it has no whitespace, trimming the halves. A text of one rune isn't split.
+func splitInHalf(text string) []string {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) < 2 {
+		return []string{text}
+	}
+	middle := len(text) / 2
+	for !utf8.RuneStart(text[middle]) {
+		middle--
+	}
+
+	split := middle
+	before := strings.LastIndexFunc(text[:middle], unicode.IsSpace)
+	after := strings.IndexFunc(text[middle:], unicode.IsSpace)
+	switch {
+	case before >= 0 && (after < 0 || middle-before <= after):
+		split = before
+	case after >= 0:
+		split = middle + after
+	}
+	if split == 0 {
+		_, split = utf8.DecodeRuneInString(text)
+	}
+	return []string{strings.TrimSpace(text[:split]), strings.TrimSpace(text[split:])}
+}
+
+// splitChunks counts the chunks embedded in pieces
+func splitChunks(chunks []*models.EnhancedChunk) int {
+	count := 0
+	for _, chunk := range chunks {
+		if _, ok := chunk.Metadata[embeddingPiecesKey]; ok {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,327 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Embeddings are stored in vec0 tables keyed by their dimension, so collections embedded by
+// models of different dimensions live side by side: chunk_embeddings_<dimension> holds float32
+// vectors, chunk_embeddings_int8_<dimension> and chunk_embeddings_bit_<dimension> quantized ones.
+// Each collection records the dimension of its embeddings in collections.embedding_dimension.
+// The tables are partitioned by tenant and collection, so a KNN query only visits the vectors of
+// the collection it searches.
+
+const (
+	// embeddingLayoutSetting records the layout of the embedding tables, so older databases are
+	// migrated once
+	embeddingLayoutSetting = "embedding_layout"
+	embeddingLayout        = "partitioned"
+
+	// legacyEmbeddingTable held the float32 embeddings of every collection before tables were
+	// keyed by dimension
+	legacyEmbeddingTable = "chunk_embeddings"
+)
+
+// embeddingTable is a vec0 table holding embeddings of one dimension
+type embeddingTable struct {
+	name         string
+	dimension    int
+	quantization models.QuantizationType // Empty for float32 vectors
+}
+
+var embeddingTablePattern = regexp.MustCompile(`^chunk_embeddings(?:_(int8|bit))?_(\d+)$`)
+
+// floatEmbeddingTable returns the table holding float32 embeddings of the given dimension
+func floatEmbeddingTable(dimension int) string {
+	return fmt.Sprintf("chunk_embeddings_%d", dimension)
+}
+
+// quantizedEmbeddingTable returns the table holding embeddings of the given dimension quantized one way
+func quantizedEmbeddingTable(quantizationType models.QuantizationType, dimension int) string {
+	return fmt.Sprintf("%s_%d", quantizedStores[quantizationType].table, dimension)
+}
+
+// embeddingPartitionColumns are the partition keys of every embedding table. vec0 can't update
+// them, which is fine as chunks never move between collections.
+const embeddingPartitionColumns = `
+			tenant_id TEXT partition key,
+			collection_name TEXT partition key,`
+
+// createFloatTable creates the table of float32 embeddings of the given dimension
+func createFloatTable(exec execer, dimension int) error {
+	_, err := exec.Exec(fmt.Sprintf(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS %s USING vec0(%s
+			chunk_id TEXT PRIMARY KEY,
+			embedding FLOAT[%d]
+		)`, floatEmbeddingTable(dimension), embeddingPartitionColumns, dimension))
+	if err != nil {
+		return fmt.Errorf("failed to create embedding table with dimension %d: %w", dimension, err)
+	}
+	return nil
+}
+
+// existingEmbeddingTables lists the embedding tables created so far: float32 tables first, then
+// the quantized ones, each by dimension
+func existingEmbeddingTables(q rowsQuerier) ([]embeddingTable, error) {
+	names, err := queryStrings(q, `SELECT name FROM sqlite_master WHERE type='table' AND name LIKE 'chunk\_embeddings\_%' ESCAPE '\'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embedding tables: %w", err)
+	}
+
+	var tables []embeddingTable
+	for _, name := range names {
+		matches := embeddingTablePattern.FindStringSubmatch(name)
+		if matches == nil {
+			continue // vec0 shadow tables and the re-embedding table
+		}
+		dimension, _ := strconv.Atoi(matches[2])
+		table := embeddingTable{name: name, dimension: dimension}
+		switch matches[1] {
+		case "int8":
+			table.quantization = models.QuantizationInt8
+		case "bit":
+			table.quantization = models.QuantizationBinary
+		}
+		tables = append(tables, table)
+	}
+
+	order := map[models.QuantizationType]int{"": 0}
+	for i, quantizationType := range quantizationTypes {
+		order[quantizationType] = i + 1
+	}
+	sort.Slice(tables, func(a, b int) bool {
+		if order[tables[a].quantization] != order[tables[b].quantization] {
+			return order[tables[a].quantization] < order[tables[b].quantization]
+		}
+		return tables[a].dimension < tables[b].dimension
+	})
+	return tables, nil
+}
+
+// collectionDimension returns the dimension recorded for a collection's embeddings, or 0 before
+// any were stored. A collection keeps its dimension when its embeddings are deleted; use
+// storedDimension to learn whether it still has some.
+func (db *VectorDB) collectionDimension(q queryRower, collectionName string) (int, error) {
+	var dimension sql.NullInt64
+	err := q.QueryRow(`SELECT embedding_dimension FROM collections WHERE name = ? AND tenant_id = ?`,
+		collectionName, db.tenant).Scan(&dimension)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read embedding dimension: %w", err)
+	}
+	return int(dimension.Int64), nil
+}
+
+// storedDimension returns the dimension of the embeddings a collection holds, or 0 when it holds none
+func (db *VectorDB) storedDimension(q querier, collectionName string) (int, error) {
+	dimension, err := db.collectionDimension(q, collectionName)
+	if err != nil || dimension == 0 {
+		return 0, err
+	}
+	tables, err := existingEmbeddingTables(q)
+	if err != nil {
+		return 0, err
+	}
+	for _, table := range tables {
+		if table.dimension != dimension {
+			continue
+		}
+		// CROSS JOIN keeps enhanced_chunks as the outer table, so vec0 answers primary key lookups
+		var exists bool
+		err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM enhanced_chunks c
+			CROSS JOIN `+table.name+` e ON e.chunk_id = c.id
+			WHERE c.collection_name = ? AND c.tenant_id = ?)`, collectionName, db.tenant).Scan(&exists)
+		if err != nil {
+			return 0, fmt.Errorf("failed to look up stored embeddings: %w", err)
+		}
+		if exists {
+			return dimension, nil
+		}
+	}
+	return 0, nil
+}
+
+// searchDimension returns the dimension of a collection's embeddings when a query embedding of
+// the given dimension can be compared with them, 0 when the collection has none, and an
+// EmbeddingDimensionError when they have another dimension
+func (db *VectorDB) searchDimension(collectionName string, queryDimension int) (int, error) {
+	dimension, err := db.collectionDimension(db.conn, collectionName)
+	if err != nil || dimension == 0 || dimension == queryDimension {
+		return dimension, err
+	}
+	stored, err := db.storedDimension(db.conn, collectionName)
+	if err != nil || stored == 0 {
+		return 0, err
+	}
+	return 0, &EmbeddingDimensionError{Collection: collectionName, Stored: stored, Got: queryDimension}
+}
+
+// ensureEmbeddingTables creates the tables a collection's embeddings of the given dimension are
+// written to and returns the collection's quantization for insertEmbeddings. A collection still
+// holding embeddings of another dimension fails with an EmbeddingDimensionError; an empty one
+// takes the new dimension.
+func (db *VectorDB) ensureEmbeddingTables(collectionName string, dimension int) (*models.QuantizationConfig, error) {
+	current, err := db.collectionDimension(db.conn, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	if current != dimension {
+		stored, err := db.storedDimension(db.conn, collectionName)
+		if err != nil {
+			return nil, err
+		}
+		if stored != 0 {
+			return nil, &EmbeddingDimensionError{Collection: collectionName, Stored: stored, Got: dimension}
+		}
+	}
+
+	quantization, err := db.collectionQuantization(db.conn, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	if err := createFloatTable(db.conn, dimension); err != nil {
+		return nil, err
+	}
+	if quantization != nil {
+		if err := createQuantizedTable(db.conn, quantization.Type, dimension); err != nil {
+			return nil, err
+		}
+	}
+
+	if current != dimension {
+		if _, err := db.conn.Exec(`UPDATE collections SET embedding_dimension = ? WHERE name = ? AND tenant_id = ?`,
+			dimension, collectionName, db.tenant); err != nil {
+			return nil, fmt.Errorf("failed to record embedding dimension: %w", err)
+		}
+		if current != 0 {
+			log.Printf("Collection '%s' holds no embeddings, storing %d dimensions instead of %d", collectionName, dimension, current)
+		}
+	}
+	return quantization, nil
+}
+
+// migrateEmbeddingTables moves the embeddings of older databases into the partitioned tables of
+// their dimension: those of the table all collections shared, or of the per-dimension tables
+// created before they were partitioned. Embeddings of chunks that no longer exist are dropped.
+// Collections of a database with a shared table take its dimension.
+func (db *VectorDB) migrateEmbeddingTables() error {
+	var layout string
+	err := db.conn.QueryRow(`SELECT value FROM settings WHERE name = ?`, embeddingLayoutSetting).Scan(&layout)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if layout == embeddingLayout {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	sources, err := unpartitionedEmbeddingTables(tx)
+	if err != nil {
+		return err
+	}
+	var sharedDimension int // Of the shared float32 table; collections never had embeddings without it
+	for _, source := range sources {
+		if source.name == legacyEmbeddingTable {
+			sharedDimension = source.dimension
+		}
+
+		// vec0 tables can't be renamed, so the vectors wait in a plain table while the table of
+		// their dimension is created with partitions
+		if _, err := tx.Exec(`CREATE TEMP TABLE embedding_migration AS SELECT chunk_id, embedding FROM ` + source.name); err != nil {
+			return fmt.Errorf("failed to read embeddings from %s: %w", source.name, err)
+		}
+		if _, err := tx.Exec(`DROP TABLE ` + source.name); err != nil {
+			return fmt.Errorf("failed to drop %s: %w", source.name, err)
+		}
+		target, value := floatEmbeddingTable(source.dimension), "m.embedding"
+		if source.quantization == "" {
+			err = createFloatTable(tx, source.dimension)
+		} else {
+			target, value = quantizedEmbeddingTable(source.quantization, source.dimension), quantizedStores[source.quantization].cast+"(m.embedding)"
+			err = createQuantizedTable(tx, source.quantization, source.dimension)
+		}
+		if err != nil {
+			return err
+		}
+		// Quantized vectors lose their type when selected, so they are marked with it again
+		_, err = tx.Exec(`INSERT INTO ` + target + ` (tenant_id, collection_name, chunk_id, embedding)
+			SELECT c.tenant_id, c.collection_name, m.chunk_id, ` + value + `
+			FROM embedding_migration m JOIN enhanced_chunks c ON c.id = m.chunk_id`)
+		if err != nil {
+			return fmt.Errorf("failed to move embeddings from %s: %w", source.name, err)
+		}
+		if _, err := tx.Exec(`DROP TABLE temp.embedding_migration`); err != nil {
+			return err
+		}
+		log.Printf("Moved the embeddings of %s to %s", source.name, target)
+	}
+
+	if layout == "" {
+		// The column defaulted to 1024 whatever was stored
+		recorded := sql.NullInt64{Int64: int64(sharedDimension), Valid: sharedDimension > 0}
+		if _, err := tx.Exec(`UPDATE collections SET embedding_dimension = ?`, recorded); err != nil {
+			return fmt.Errorf("failed to record embedding dimensions: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO settings (name, value) VALUES (?, ?)`, embeddingLayoutSetting, embeddingLayout); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// unpartitionedEmbeddingTables lists the embedding tables without partition keys: the tables all
+// collections shared, and per-dimension tables created before they were partitioned
+func unpartitionedEmbeddingTables(q querier) ([]embeddingTable, error) {
+	tables, err := existingEmbeddingTables(q)
+	if err != nil {
+		return nil, err
+	}
+	// The shared tables have no dimension in their name; it is read from their schema
+	tables = append(tables, embeddingTable{name: legacyEmbeddingTable})
+	for _, quantizationType := range quantizationTypes {
+		tables = append(tables, embeddingTable{name: quantizedStores[quantizationType].table, quantization: quantizationType})
+	}
+
+	var unpartitioned []embeddingTable
+	for _, table := range tables {
+		var tableSQL string
+		err := q.QueryRow(`SELECT sql FROM sqlite_master WHERE type='table' AND name=?`, table.name).Scan(&tableSQL)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s schema: %w", table.name, err)
+		}
+		if strings.Contains(strings.ToLower(tableSQL), "partition key") {
+			continue
+		}
+		if table.dimension == 0 {
+			pattern := embeddingDimensionPattern
+			if table.quantization != "" {
+				pattern = quantizedDimensionPattern
+			}
+			matches := pattern.FindStringSubmatch(tableSQL)
+			if len(matches) < 2 {
+				return nil, fmt.Errorf("could not determine embedding dimension of %s", table.name)
+			}
+			table.dimension, _ = strconv.Atoi(matches[1])
+		}
+		unpartitioned = append(unpartitioned, table)
+	}
+	return unpartitioned, nil
+}
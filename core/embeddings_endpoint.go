@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"rag-go-app/config"
+	"rag-go-app/models"
+)
+
+// maxEmbeddingInputs is the most inputs one /v1/embeddings request may carry, as with OpenAI
+const maxEmbeddingInputs = 2048
+
+// ErrEmbeddingInput is returned for /v1/embeddings requests whose input can't be embedded
+var ErrEmbeddingInput = errors.New("invalid embeddings request")
+
+// embeddingInputs returns the texts of an OpenAI embeddings input, which is a string or an array
+// of strings. Token arrays are not supported: the model server tokenizes text itself.
+func embeddingInputs(input interface{}) ([]string, error) {
+	var texts []string
+	switch value := input.(type) {
+	case string:
+		texts = []string{value}
+	case []interface{}:
+		for i, item := range value {
+			text, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: input %d is not a string; token arrays are not supported", ErrEmbeddingInput, i)
+			}
+			texts = append(texts, text)
+		}
+	default:
+		return nil, fmt.Errorf("%w: input must be a string or an array of strings", ErrEmbeddingInput)
+	}
+
+	if len(texts) == 0 || len(texts) > maxEmbeddingInputs {
+		return nil, fmt.Errorf("%w: input must hold 1 to %d strings", ErrEmbeddingInput, maxEmbeddingInputs)
+	}
+	for i, text := range texts {
+		if text == "" {
+			return nil, fmt.Errorf("%w: input %d is empty", ErrEmbeddingInput, i)
+		}
+	}
+	return texts, nil
+}
+
+// encodeEmbeddingBase64 encodes an embedding as OpenAI's base64 format: little-endian float32s
+func encodeEmbeddingBase64(embedding []float32) string {
+	buf := make([]byte, 4*len(embedding))
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(value))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// EmbedForEndpoint answers an OpenAI-compatible embeddings request through the shared embedding
+// path, so other services get the same cache, adaptive batching, retries and failover as
+// ingestion. Identical inputs are embedded once. Inputs too long for the model fail the request
+// rather than returning the average of their pieces ingestion stores for them.
+func EmbedForEndpoint(ctx context.Context, req *models.OpenAIEmbeddingsRequest) (*models.OpenAIEmbeddingsResponse, error) {
+	embeddingCounters.endpointRequests.Add(1)
+	resp, err := embedForEndpoint(ctx, req)
+	if err != nil {
+		embeddingCounters.endpointErrors.Add(1)
+	}
+	return resp, err
+}
+
+func embedForEndpoint(ctx context.Context, req *models.OpenAIEmbeddingsRequest) (*models.OpenAIEmbeddingsResponse, error) {
+	if req.EncodingFormat != "" && req.EncodingFormat != "float" && req.EncodingFormat != "base64" {
+		return nil, fmt.Errorf("%w: encoding_format must be \"float\" or \"base64\"", ErrEmbeddingInput)
+	}
+	texts, err := embeddingInputs(req.Input)
+	if err != nil {
+		return nil, err
+	}
+	embeddingCounters.endpointInputs.Add(int64(len(texts)))
+
+	model := req.Model
+	if model == "" {
+		model = config.AppConfig.EmbeddingModel
+	}
+
+	positions := make(map[string]int, len(texts)) // Text -> index in unique
+	var unique []string
+	chars := 0
+	for _, text := range texts {
+		if _, ok := positions[text]; !ok {
+			positions[text] = len(unique)
+			unique = append(unique, text)
+		}
+		chars += len(text)
+	}
+
+	ctx, splits := withEmbeddingSplits(ctx)
+	embeddings, err := GetEmbeddings(ctx, unique, model)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.OpenAIEmbeddingsResponse{
+		Object: "list",
+		Data:   make([]models.OpenAIEmbedding, len(texts)),
+		Model:  model,
+	}
+	for i, text := range texts {
+		embedding := embeddings[positions[text]]
+		if splits.of(text) > 0 {
+			return nil, fmt.Errorf("%w: input %d is too long for the embedding model", ErrEmbeddingInput, i)
+		}
+		var encoded interface{} = embedding
+		if req.EncodingFormat == "base64" {
+			encoded = encodeEmbeddingBase64(embedding)
+		}
+		resp.Data[i] = models.OpenAIEmbedding{Object: "embedding", Index: i, Embedding: encoded}
+	}
+	tokens := (chars + maxCharsPerToken - 1) / maxCharsPerToken
+	resp.Usage = models.EmbeddingsUsage{PromptTokens: tokens, TotalTokens: tokens}
+	return resp, nil
+}
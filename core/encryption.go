@@ -0,0 +1,597 @@
+package core
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"rag-go-app/config"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Encryption modes of config.EncryptionConfig
+const (
+	EncryptionColumns   = "columns"   // Document content and chunk text are sealed with AES-256-GCM
+	EncryptionSQLCipher = "sqlcipher" // The whole database file is encrypted by SQLCipher
+)
+
+const (
+	// sqliteDriver is the go-sqlite3 driver with the functions that open sealed text, and the
+	// SQLCipher key when the database is encrypted as a whole
+	sqliteDriver = "sqlite3_rag"
+
+	encryptionKeyBytes = 32 // AES-256
+	keyIDLength        = 8  // Hex characters of a key's SHA-256 identifying it in sealed text
+
+	// sealedPrefix starts sealed text, followed by the key ID, a colon and the base64 nonce and ciphertext
+	sealedPrefix = "enc1:"
+
+	reencryptBatchSize  = 500 // Rows re-encrypted per transaction
+	maxRotationFailures = 100 // Rows that couldn't be re-encrypted listed per table
+
+	// keywordIndexSetting records the ID of the key the keyword index hashes words with, "" for
+	// plain words
+	keywordIndexSetting = "keyword_index_key"
+)
+
+// ErrEncryptionKey is returned for text sealed with a key that isn't configured
+var ErrEncryptionKey = errors.New("text is encrypted with a key that isn't configured")
+
+// textKeys are the keys document content and chunk text are sealed with
+type textKeys struct {
+	mode     string
+	current  string                 // ID of the key new text is sealed with; "" stores it as it is
+	ciphers  map[string]cipher.AEAD // Every configured key by ID, so text sealed with an older key still opens
+	indexKey []byte                 // HMAC key of the words in the keyword index; nil indexes the words themselves
+	dbKey    []byte                 // SQLCipher key of the database
+	oldDBKey [][]byte               // Previous SQLCipher keys the database may still be encrypted with
+}
+
+// encryption holds the keys of config.AppConfig.Encryption, set up when the database is opened
+var encryption = &textKeys{ciphers: map[string]cipher.AEAD{}}
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{ConnectHook: connectHook})
+}
+
+// connectHook prepares every new database connection: it applies the SQLCipher key, then
+// registers rag_open, which returns the plaintext of a sealed column, and rag_index, which returns
+// the text the keyword index stores for it
+func connectHook(conn *sqlite3.SQLiteConn) error {
+	if encryption.mode == EncryptionSQLCipher {
+		if _, err := conn.Exec(sqlcipherKeyPragma("key", encryption.dbKey), nil); err != nil {
+			return fmt.Errorf("failed to apply database key: %w", err)
+		}
+		// Set here rather than in the DSN, whose pragmas run before the key is applied
+		if _, err := conn.Exec(`PRAGMA journal_mode = WAL`, nil); err != nil {
+			return fmt.Errorf("failed to open encrypted database: %w", err)
+		}
+	}
+	if err := conn.RegisterFunc("rag_open", openText, true); err != nil {
+		return err
+	}
+	return conn.RegisterFunc("rag_index", func(stored string) (string, error) {
+		text, err := openText(stored)
+		if err != nil {
+			return "", err
+		}
+		return keywordIndexText(text), nil
+	}, true)
+}
+
+// configureEncryption reads the keys of the encryption settings
+func configureEncryption(cfg config.EncryptionConfig) error {
+	keys := &textKeys{mode: cfg.Mode, ciphers: map[string]cipher.AEAD{}}
+	if cfg.Mode != "" && cfg.Mode != EncryptionColumns && cfg.Mode != EncryptionSQLCipher {
+		return fmt.Errorf("encryption.mode must be \"%s\", \"%s\" or empty", EncryptionColumns, EncryptionSQLCipher)
+	}
+
+	current := cfg.Key
+	if cfg.KeyFile != "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read encryption.key_file: %w", err)
+		}
+		current = strings.TrimSpace(string(data))
+	}
+	if cfg.Mode != "" && current == "" {
+		return fmt.Errorf("encryption.mode %q needs encryption.key or encryption.key_file", cfg.Mode)
+	}
+
+	for i, encoded := range append([]string{current}, cfg.PreviousKeys...) {
+		if encoded == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != encryptionKeyBytes {
+			return fmt.Errorf("encryption keys must be %d random bytes, base64-encoded", encryptionKeyBytes)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		id := keyID(key)
+		keys.ciphers[id] = gcm
+
+		switch {
+		case i > 0 && cfg.Mode == EncryptionSQLCipher:
+			keys.oldDBKey = append(keys.oldDBKey, key)
+		case i > 0 || cfg.Mode == "":
+			// Previous keys, and the key of disabled encryption, only open text
+		case cfg.Mode == EncryptionSQLCipher:
+			keys.dbKey = key
+		default:
+			keys.current = id
+			keys.indexKey = hmacSHA256(key, "keyword index")
+		}
+	}
+	encryption = keys
+	return nil
+}
+
+// keyID identifies a key in sealed text without revealing it
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])[:keyIDLength]
+}
+
+// sealText encrypts text with the current key when columns are encrypted, and returns it as it is
+// otherwise
+func sealText(text string) string {
+	if encryption.current == "" {
+		return text
+	}
+	gcm := encryption.ciphers[encryption.current]
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("failed to read random nonce: %v", err)) // The system's random source is broken
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(text), nil)
+	return sealedPrefix + encryption.current + ":" + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// openText returns the plaintext of a stored column value. Text stored before encryption was
+// enabled is returned as it is.
+func openText(stored string) (string, error) {
+	id, payload, ok := splitSealed(stored)
+	if !ok {
+		return stored, nil
+	}
+	gcm, ok := encryption.ciphers[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %s; add it to encryption.previous_keys", ErrEncryptionKey, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("corrupt encrypted text")
+	}
+	text, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt text with key %s: %w", id, err)
+	}
+	return string(text), nil
+}
+
+// splitSealed returns the key ID and payload of sealed text
+func splitSealed(stored string) (id, payload string, ok bool) {
+	rest, found := strings.CutPrefix(stored, sealedPrefix)
+	if !found || len(rest) <= keyIDLength || rest[keyIDLength] != ':' {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(rest[:keyIDLength]); err != nil {
+		return "", "", false
+	}
+	return rest[:keyIDLength], rest[keyIDLength+1:], true
+}
+
+// keywordIndexText returns what the keyword index stores for a chunk's text: the text itself, or
+// when columns are encrypted the keyed hashes of its words in their order, so terms and phrases
+// can still be matched without the index revealing the words
+func keywordIndexText(text string) string {
+	if encryption.indexKey == nil {
+		return text
+	}
+	words := splitSearchWords(text)
+	for i, word := range words {
+		words[i] = indexTerm(word)
+	}
+	return strings.Join(words, " ")
+}
+
+// indexTerm returns how a lowercase word appears in the keyword index
+func indexTerm(word string) string {
+	if encryption.indexKey == nil {
+		return word
+	}
+	return "h" + hex.EncodeToString(hmacSHA256(encryption.indexKey, word)[:8])
+}
+
+// hashedKeywordIndex reports whether the keyword index stores keyed hashes of words, which can't
+// match prefixes or similar spellings
+func hashedKeywordIndex() bool {
+	return encryption.indexKey != nil
+}
+
+// sqlcipherKeyPragma returns the PRAGMA setting a raw SQLCipher key
+func sqlcipherKeyPragma(pragma string, key []byte) string {
+	return fmt.Sprintf(`PRAGMA %s = "x'%s'"`, pragma, hex.EncodeToString(key))
+}
+
+// prepareSQLCipherDatabase makes the database at path readable with the current SQLCipher key
+// before it is opened. A database still encrypted with a previous key is re-keyed, and a
+// plaintext database is copied into an encrypted one that replaces it.
+func prepareSQLCipherDatabase(path string) error {
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		return nil // A new database is encrypted as it is created
+	}
+
+	opens := func(key []byte) (*sqlite3.SQLiteConn, bool) {
+		raw, err := (&sqlite3.SQLiteDriver{}).Open(path)
+		if err != nil {
+			return nil, false
+		}
+		conn := raw.(*sqlite3.SQLiteConn)
+		if key != nil {
+			if _, err := conn.Exec(sqlcipherKeyPragma("key", key), nil); err != nil {
+				conn.Close()
+				return nil, false
+			}
+		}
+		if _, err := conn.Exec(`SELECT count(*) FROM sqlite_master`, nil); err != nil {
+			conn.Close()
+			return nil, false
+		}
+		return conn, true
+	}
+
+	if conn, ok := opens(encryption.dbKey); ok {
+		return conn.Close()
+	}
+	for _, key := range encryption.oldDBKey {
+		if conn, ok := opens(key); ok {
+			defer conn.Close()
+			if _, err := conn.Exec(sqlcipherKeyPragma("rekey", encryption.dbKey), nil); err != nil {
+				return fmt.Errorf("failed to re-key database: %w", err)
+			}
+			log.Printf("Re-encrypted database %s with the current key", path)
+			return nil
+		}
+	}
+
+	conn, ok := opens(nil)
+	if !ok {
+		return fmt.Errorf("database %s can't be opened with the configured keys", path)
+	}
+	defer conn.Close()
+	encryptedPath := path + ".encrypting"
+	os.Remove(encryptedPath)
+	steps := []string{
+		`PRAGMA wal_checkpoint(TRUNCATE)`,
+		fmt.Sprintf(`ATTACH DATABASE '%s' AS encrypted KEY "x'%s'"`, strings.ReplaceAll(encryptedPath, "'", "''"), hex.EncodeToString(encryption.dbKey)),
+		`SELECT sqlcipher_export('encrypted')`,
+		`DETACH DATABASE encrypted`,
+	}
+	for _, step := range steps {
+		if _, err := conn.Exec(step, nil); err != nil {
+			os.Remove(encryptedPath)
+			return fmt.Errorf("failed to encrypt database: %w", err)
+		}
+	}
+	conn.Close()
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Remove(path + suffix)
+	}
+	if err := os.Rename(encryptedPath, path); err != nil {
+		return fmt.Errorf("failed to replace database with its encrypted copy: %w", err)
+	}
+	log.Printf("Encrypted database %s with SQLCipher", path)
+	return nil
+}
+
+// checkSQLCipher verifies the database is served by SQLCipher, since plain SQLite ignores the key
+// and would write the data unencrypted
+func (db *VectorDB) checkSQLCipher() error {
+	var version string
+	err := db.conn.QueryRow(`PRAGMA cipher_version`).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && version == "") {
+		return fmt.Errorf("encryption.mode \"sqlcipher\" needs the server built against SQLCipher (go build -tags libsqlite3 with SQLCipher as the system SQLite)")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open encrypted database: %w", err)
+	}
+	log.Printf("Using SQLCipher version: %s", version)
+	return nil
+}
+
+// syncKeywordIndex rebuilds the keyword index when it was built with another key than the
+// current one, or without one, so turning encryption on, off or rotating its key keeps keyword
+// search working
+func (db *VectorDB) syncKeywordIndex() error {
+	var indexedWith string
+	err := db.conn.QueryRow(`SELECT value FROM settings WHERE name = ?`, keywordIndexSetting).Scan(&indexedWith)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if indexedWith == encryption.current {
+		return nil
+	}
+
+	start := time.Now()
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM chunk_fts`); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`INSERT INTO chunk_fts (chunk_id, collection_name, text)
+		SELECT id, collection_name, rag_index(text) FROM enhanced_chunks`)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild keyword index: %w", err)
+	}
+	// Merge the index into one segment, so no segment of the previous index is left behind
+	if _, err := tx.Exec(`INSERT INTO chunk_fts (chunk_fts) VALUES ('optimize')`); err != nil {
+		return err
+	}
+	// Terms are counted as the index stores them, which has just changed
+	if err := rebuildTermStats(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO settings (name, value) VALUES (?, ?)`, keywordIndexSetting, encryption.current); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	indexed, _ := result.RowsAffected()
+	log.Printf("Rebuilt keyword index of %d chunks in %s", indexed, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// EncryptionStatus describes how the database is encrypted and with which keys its text is sealed
+type EncryptionStatus struct {
+	Mode       string            `json:"mode"` // "columns", "sqlcipher" or "" when disabled
+	CurrentKey string            `json:"current_key,omitempty"`
+	Documents  map[string]int    `json:"documents"` // Documents per key ID their content is sealed with; "plaintext" counts unsealed ones
+	Chunks     map[string]int    `json:"chunks"`    // Chunks per key ID their text is sealed with
+	Rotation   *RotationProgress `json:"rotation,omitempty"`
+}
+
+// RotationProgress describes the latest re-encryption of stored text. Rows whose text can't be
+// opened are left as they are and listed, so the rest are still re-encrypted; rotating again retries
+// them, as only text not sealed with the current key is re-encrypted.
+type RotationProgress struct {
+	Status          string            `json:"status"` // "running", "completed", "incomplete" when rows were left, or "failed"
+	Documents       int               `json:"documents"`
+	Chunks          int               `json:"chunks"`
+	Failed          int               `json:"failed"`                     // Documents and chunks left sealed as they were
+	FailedDocuments []RotationFailure `json:"failed_documents,omitempty"` // The first of them, up to maxRotationFailures each
+	FailedChunks    []RotationFailure `json:"failed_chunks,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	StartedAt       time.Time         `json:"started_at"`
+	CompletedAt     *time.Time        `json:"completed_at,omitempty"`
+}
+
+// RotationFailure is a document or chunk whose text couldn't be re-encrypted
+type RotationFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// rotation is the latest re-encryption; only one runs at a time
+var rotation struct {
+	sync.Mutex
+	progress *RotationProgress
+}
+
+// EncryptionStatus counts the documents and chunks sealed with each key. It covers the whole
+// database, not one tenant.
+func (db *VectorDB) EncryptionStatus() (*EncryptionStatus, error) {
+	status := &EncryptionStatus{Mode: encryption.mode, CurrentKey: encryption.current}
+	if encryption.mode == EncryptionSQLCipher {
+		status.CurrentKey = keyID(encryption.dbKey)
+	}
+	var err error
+	if status.Documents, err = db.countSealedKeys("documents", "content"); err != nil {
+		return nil, err
+	}
+	if status.Chunks, err = db.countSealedKeys("enhanced_chunks", "text"); err != nil {
+		return nil, err
+	}
+
+	rotation.Lock()
+	defer rotation.Unlock()
+	if rotation.progress != nil {
+		progress := *rotation.progress
+		status.Rotation = &progress
+	}
+	return status, nil
+}
+
+// countSealedKeys counts the rows of a table by the key their column is sealed with
+func (db *VectorDB) countSealedKeys(table, column string) (map[string]int, error) {
+	rows, err := db.conn.Query(fmt.Sprintf(`SELECT
+		CASE WHEN substr(%[1]s, 1, %[2]d) = '%[3]s' AND substr(%[1]s, %[4]d, 1) = ':' THEN substr(%[1]s, %[5]d, %[6]d) ELSE 'plaintext' END AS key_id,
+		COUNT(*) FROM %[7]s GROUP BY key_id`,
+		column, len(sealedPrefix), sealedPrefix, len(sealedPrefix)+keyIDLength+1, len(sealedPrefix)+1, keyIDLength, table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count encrypted %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, fmt.Errorf("failed to count encrypted %s: %w", table, err)
+		}
+		counts[id] = count
+	}
+	return counts, rows.Err()
+}
+
+// StartKeyRotation re-encrypts, in the background, every document and chunk whose text isn't
+// sealed with the current key: text sealed with a previous key, and text stored before encryption
+// was enabled. Without column encryption, it decrypts sealed text instead; SQLCipher databases are
+// re-keyed when the server starts. Once it completes, the previous keys can be removed from the
+// configuration.
+func (db *VectorDB) StartKeyRotation() (*RotationProgress, error) {
+	rotation.Lock()
+	defer rotation.Unlock()
+	if rotation.progress != nil && rotation.progress.Status == "running" {
+		return nil, fmt.Errorf("a key rotation is already running")
+	}
+	rotation.progress = &RotationProgress{Status: "running", StartedAt: time.Now().UTC()}
+	progress := *rotation.progress
+
+	go func() {
+		err := db.rotateKeys(context.Background())
+		rotation.Lock()
+		defer rotation.Unlock()
+		now := time.Now().UTC()
+		rotation.progress.CompletedAt = &now
+		rotation.progress.Status = "completed"
+		if err != nil {
+			rotation.progress.Status = "failed"
+			rotation.progress.Error = err.Error()
+			log.Printf("Key rotation failed: %v", err)
+			return
+		}
+		if rotation.progress.Failed > 0 {
+			rotation.progress.Status = "incomplete"
+			rotation.progress.Error = fmt.Sprintf("%d documents and chunks could not be re-encrypted", rotation.progress.Failed)
+		}
+		log.Printf("Key rotation re-encrypted %d documents and %d chunks, %d failed",
+			rotation.progress.Documents, rotation.progress.Chunks, rotation.progress.Failed)
+	}()
+	return &progress, nil
+}
+
+// rotateKeys re-encrypts the content of documents and then the text of chunks in batches, in
+// rowid order. Rows that fail are recorded in the progress and passed over.
+func (db *VectorDB) rotateKeys(ctx context.Context) error {
+	for _, target := range []struct {
+		table, column string
+		count         *int
+		failed        *[]RotationFailure
+	}{
+		{"documents", "content", &rotation.progress.Documents, &rotation.progress.FailedDocuments},
+		{"enhanced_chunks", "text", &rotation.progress.Chunks, &rotation.progress.FailedChunks},
+	} {
+		var after int64
+		for {
+			// Switching to read-only mode stops the rotation; rotating again resumes it
+			if err := checkWritable(); err != nil {
+				return err
+			}
+			done, last, failures, err := db.reencryptBatch(ctx, target.table, target.column, after)
+			if err != nil {
+				return err
+			}
+			if last == after {
+				break
+			}
+			after = last
+
+			rotation.Lock()
+			*target.count += done
+			rotation.progress.Failed += len(failures)
+			for _, failure := range failures {
+				if len(*target.failed) < maxRotationFailures {
+					*target.failed = append(*target.failed, failure)
+				}
+			}
+			rotation.Unlock()
+		}
+	}
+	// Freed pages are already zeroed; move the last pages with old text out of the write-ahead log
+	_, err := db.conn.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+// reencryptBatch seals up to reencryptBatchSize rows of a table after rowid after that aren't sealed
+// with the current key. It returns how many it sealed, the last rowid it read, which is after when
+// none are left, and the rows whose text couldn't be opened, which it leaves as they are.
+func (db *VectorDB) reencryptBatch(ctx context.Context, table, column string, after int64) (int, int64, []RotationFailure, error) {
+	current := ""
+	condition := fmt.Sprintf("substr(%s, 1, %d) = '%s'", column, len(sealedPrefix), sealedPrefix)
+	if encryption.current != "" {
+		current = sealedPrefix + encryption.current + ":"
+		condition = fmt.Sprintf("substr(%s, 1, %d) != '%s'", column, len(current), current)
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, after, nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT rowid, id, %s FROM %s WHERE rowid > ? AND %s ORDER BY rowid LIMIT %d`,
+		column, table, condition, reencryptBatchSize), after)
+	if err != nil {
+		return 0, after, nil, fmt.Errorf("failed to read %s to re-encrypt: %w", table, err)
+	}
+	type row struct {
+		rowid  int64
+		id     string
+		stored string
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.rowid, &r.id, &r.stored); err != nil {
+			rows.Close()
+			return 0, after, nil, err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, after, nil, err
+	}
+
+	sealed := 0
+	var failures []RotationFailure
+	for _, r := range batch {
+		text, err := openText(r.stored)
+		if err != nil {
+			log.Printf("Key rotation left %s %s as it was: %v", table, r.id, err)
+			failures = append(failures, RotationFailure{ID: r.id, Error: err.Error()})
+			continue
+		}
+		if encryption.current == "" {
+			if _, _, isSealed := splitSealed(r.stored); !isSealed {
+				continue // Looks like sealed text but isn't; leave it
+			}
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET %s = ? WHERE rowid = ?`, table, column), sealText(text), r.rowid); err != nil {
+			return 0, after, nil, fmt.Errorf("failed to re-encrypt %s: %w", table, err)
+		}
+		sealed++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, after, nil, err
+	}
+	if len(batch) > 0 {
+		after = batch[len(batch)-1].rowid
+	}
+	return sealed, after, failures, nil
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"testing"
+	"time"
+)
+
+// newTestKey returns a random base64-encoded encryption key
+func newTestKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, encryptionKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("read random key: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// rotateAndWait runs a key rotation and returns its progress once it has finished
+func rotateAndWait(t *testing.T, db *VectorDB) *RotationProgress {
+	t.Helper()
+	if _, err := db.StartKeyRotation(); err != nil {
+		t.Fatalf("StartKeyRotation: %v", err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		status, err := db.EncryptionStatus()
+		if err != nil {
+			t.Fatalf("EncryptionStatus: %v", err)
+		}
+		if status.Rotation.Status != "running" {
+			return status.Rotation
+		}
+	}
+	t.Fatal("key rotation did not finish")
+	return nil
+}
+
+func TestKeyRotationPassesOverUnreadableRows(t *testing.T) {
+	savedConfig, savedKeys := config.AppConfig.Encryption, encryption
+	t.Cleanup(func() { config.AppConfig.Encryption, encryption = savedConfig, savedKeys })
+
+	oldKey, newKey := newTestKey(t), newTestKey(t)
+	config.AppConfig.Encryption = config.EncryptionConfig{Mode: EncryptionColumns, Key: oldKey}
+	db := newTestDB(t)
+	if err := db.CreateCollection("sealed", "", nil, nil); err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	var docs []*models.Document
+	for _, id := range []string{"doc-a", "doc-b", "doc-c"} {
+		docs = append(docs, testDocument(id, []string{id + " first", id + " second"}, 4))
+	}
+	if err := db.addDocuments(context.Background(), "sealed", docs, 4); err != nil {
+		t.Fatalf("addDocuments: %v", err)
+	}
+	oldID := encryption.current
+
+	// Corrupt one document and one chunk, then make the new key current
+	corrupt := sealedPrefix + oldID + ":" + base64.StdEncoding.EncodeToString(make([]byte, 40))
+	if _, err := db.conn.Exec(`UPDATE documents SET content = ? WHERE id = 'doc-b'`, corrupt); err != nil {
+		t.Fatalf("corrupt document: %v", err)
+	}
+	if _, err := db.conn.Exec(`UPDATE enhanced_chunks SET text = ? WHERE id = 'doc-a-chunk-1'`, corrupt); err != nil {
+		t.Fatalf("corrupt chunk: %v", err)
+	}
+	if err := configureEncryption(config.EncryptionConfig{Mode: EncryptionColumns, Key: newKey, PreviousKeys: []string{oldKey}}); err != nil {
+		t.Fatalf("configureEncryption: %v", err)
+	}
+	newID := encryption.current
+
+	progress := rotateAndWait(t, db)
+	if progress.Status != "incomplete" || progress.Failed != 2 || progress.Documents != 2 || progress.Chunks != 5 {
+		t.Fatalf("rotation = %+v, want incomplete with 2 documents and 5 chunks re-encrypted and 2 failed", progress)
+	}
+	if len(progress.FailedDocuments) != 1 || progress.FailedDocuments[0].ID != "doc-b" {
+		t.Errorf("failed documents = %+v, want doc-b", progress.FailedDocuments)
+	}
+	if len(progress.FailedChunks) != 1 || progress.FailedChunks[0].ID != "doc-a-chunk-1" {
+		t.Errorf("failed chunks = %+v, want doc-a-chunk-1", progress.FailedChunks)
+	}
+	status, err := db.EncryptionStatus()
+	if err != nil {
+		t.Fatalf("EncryptionStatus: %v", err)
+	}
+	if status.Documents[newID] != 2 || status.Documents[oldID] != 1 || status.Chunks[newID] != 5 || status.Chunks[oldID] != 1 {
+		t.Errorf("documents by key %v and chunks by key %v, want only the failed rows under %s", status.Documents, status.Chunks, oldID)
+	}
+
+	// Once the rows are repaired, rotating again re-encrypts only them
+	if _, err := db.conn.Exec(`UPDATE documents SET content = 'repaired' WHERE id = 'doc-b'`); err != nil {
+		t.Fatalf("repair document: %v", err)
+	}
+	if _, err := db.conn.Exec(`UPDATE enhanced_chunks SET text = 'repaired' WHERE id = 'doc-a-chunk-1'`); err != nil {
+		t.Fatalf("repair chunk: %v", err)
+	}
+	progress = rotateAndWait(t, db)
+	if progress.Status != "completed" || progress.Failed != 0 || progress.Documents != 1 || progress.Chunks != 1 {
+		t.Fatalf("second rotation = %+v, want completed with 1 document and 1 chunk", progress)
+	}
+	chunk, err := db.GetChunk("doc-a-chunk-1")
+	if err != nil || chunk.Text != "repaired" {
+		t.Errorf("GetChunk after rotation = %v, %v; want the repaired text", chunk, err)
+	}
+}
@@ -0,0 +1,252 @@
+package core
+
+import (
+	"rag-go-app/models"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxEntitiesPerKind is the most entities of one kind, or dates, recorded per chunk
+const maxEntitiesPerKind = 20
+
+// Entity kinds, the keys of a chunk's entity metadata
+const (
+	entityPerson   = "person"
+	entityOrg      = "org"
+	entityLocation = "location"
+)
+
+const monthNames = `(Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:t(?:ember)?)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)`
+
+// Date formats, in the order they are tried; the text each one matches is not read again
+var (
+	isoDatePattern      = regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`)
+	monthDayYearPattern = regexp.MustCompile(`\b` + monthNames + `\.?\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})\b`)
+	dayMonthYearPattern = regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th)?(?:\s+of)?\s+` + monthNames + `\.?,?\s+(\d{4})\b`)
+	slashDatePattern    = regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})/(\d{4})\b`)
+	dottedDatePattern   = regexp.MustCompile(`\b(\d{1,2})\.(\d{1,2})\.(\d{4})\b`)
+	monthYearPattern    = regexp.MustCompile(`\b` + monthNames + `\.?,?\s+(\d{4})\b`)
+)
+
+// Organizations: capitalized names ending in a legal form, which is dropped from the name, or in a
+// word naming an institution, which is kept
+var (
+	legalFormPattern   = regexp.MustCompile(`\b((?:[A-Z][\w&'-]* +){0,4}[A-Z][\w&'-]*),? +(?:(?:Inc|Incorporated|Ltd|Limited|LLC|LLP|Corp|Corporation|Company|GmbH|AG|PLC|plc|Pty)\b\.?|Co\.|L\.L\.C\.?|S\.A\.?|N\.V\.?|B\.V\.?)`)
+	institutionPattern = regexp.MustCompile(`\b((?:[A-Z][\w&'-]* +){0,3}(?:University|Bank|Institute|Agency|Foundation|Association|Ministry|Department|Hospital|College|Council|Commission|Authority|Group|Partners|Holdings|Technologies|Systems|Laboratories|Labs)(?: +of(?: +the)?(?: +[A-Z][\w'-]*){1,3})?)\b`)
+)
+
+// People: names after an honorific, before or after a role, or after the verb of a signature line
+var (
+	honorificPattern    = regexp.MustCompile(`\b(?:Mr|Mrs|Ms|Miss|Dr|Prof|Sir|Dame)\.? +([A-Z][a-z'-]+(?: +[A-Z]\.)?(?: +[A-Z][a-z'-]+){0,2})`)
+	personRolePattern   = regexp.MustCompile(`\b([A-Z][a-z'-]+(?: +[A-Z]\.)? +[A-Z][a-z'-]+), +(?:the +|our +|its +)?(?:CEO|CFO|CTO|COO|President|Vice President|VP|Director|Manager|Chair(?:man|woman|person)?|Founder|Co-founder|Partner|Counsel|Secretary|Treasurer|Head)\b`)
+	rolePersonPattern   = regexp.MustCompile(`\b(?:CEO|CFO|CTO|COO|President|Director|Chair(?:man|woman|person)?|Founder|Professor) +([A-Z][a-z'-]+(?: +[A-Z]\.)? +[A-Z][a-z'-]+)`)
+	signedByPattern     = regexp.MustCompile(`\b(?:[Ss]igned|[Pp]repared|[Ww]ritten|[Aa]pproved|[Rr]eviewed|[Aa]uthored|[Ss]ubmitted) +by:? +([A-Z][a-z'-]+(?: +[A-Z]\.)? +[A-Z][a-z'-]+)`)
+	locatedPlacePattern = regexp.MustCompile(`\b(?:headquartered|based|located|incorporated|registered|offices?) +in +([A-Z][a-z'-]+(?: +[A-Z][a-z'-]+)?)`)
+)
+
+// knownLocations are the countries, states and cities recognized wherever they appear
+var knownLocations = []string{
+	// Countries
+	"Argentina", "Australia", "Austria", "Bangladesh", "Belgium", "Brazil", "Canada", "Chile", "China",
+	"Colombia", "Czech Republic", "Denmark", "Egypt", "Finland", "France", "Germany", "Greece", "Hungary",
+	"India", "Indonesia", "Ireland", "Israel", "Italy", "Japan", "Kenya", "Malaysia", "Mexico",
+	"Netherlands", "New Zealand", "Nigeria", "Norway", "Pakistan", "Peru", "Philippines", "Poland",
+	"Portugal", "Romania", "Russia", "Saudi Arabia", "Singapore", "South Africa", "South Korea", "Spain",
+	"Sweden", "Switzerland", "Taiwan", "Thailand", "Turkey", "Ukraine", "United Arab Emirates",
+	"United Kingdom", "United States", "Vietnam",
+	// US states
+	"Alabama", "Alaska", "Arizona", "Arkansas", "California", "Colorado", "Connecticut", "Delaware",
+	"Florida", "Hawaii", "Idaho", "Illinois", "Indiana", "Iowa", "Kansas", "Kentucky", "Louisiana",
+	"Maine", "Maryland", "Massachusetts", "Michigan", "Minnesota", "Mississippi", "Missouri", "Montana",
+	"Nebraska", "Nevada", "New Hampshire", "New Jersey", "New Mexico", "New York", "North Carolina",
+	"North Dakota", "Ohio", "Oklahoma", "Oregon", "Pennsylvania", "Rhode Island", "South Carolina",
+	"South Dakota", "Tennessee", "Texas", "Utah", "Vermont", "Virginia", "Washington", "West Virginia",
+	"Wisconsin", "Wyoming",
+	// Cities
+	"Amsterdam", "Athens", "Atlanta", "Austin", "Bangalore", "Bangkok", "Barcelona", "Beijing", "Berlin",
+	"Boston", "Brussels", "Buenos Aires", "Cairo", "Chicago", "Copenhagen", "Dallas", "Delhi", "Denver",
+	"Dubai", "Dublin", "Frankfurt", "Geneva", "Hamburg", "Helsinki", "Hong Kong", "Houston", "Istanbul",
+	"Jakarta", "Johannesburg", "Lagos", "Lisbon", "London", "Los Angeles", "Madrid", "Manchester",
+	"Melbourne", "Miami", "Milan", "Montreal", "Moscow", "Mumbai", "Munich", "Nairobi", "Oslo", "Paris",
+	"Philadelphia", "Prague", "Rome", "San Francisco", "Santiago", "Seattle", "Seoul", "Shanghai",
+	"Stockholm", "Sydney", "Tokyo", "Toronto", "Vancouver", "Vienna", "Warsaw", "Zurich",
+}
+
+// knownLocationPattern matches knownLocations as whole words, longest names first
+var knownLocationPattern = func() *regexp.Regexp {
+	names := append([]string(nil), knownLocations...)
+	sort.SliceStable(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for i, name := range names {
+		names[i] = regexp.QuoteMeta(name)
+	}
+	return regexp.MustCompile(`\b(` + strings.Join(names, "|") + `)\b`)
+}()
+
+// tagChunkEntities records the people, organizations and locations a chunk names under its entity
+// metadata, keyed by kind, and the dates it mentions under dates, so queries can filter on them:
+// {"entity.org": "Acme"} or {"dates": {"$contains": "2024-03-01"}}. Extraction is rule-based:
+// organizations end in a legal form or an institution word, people follow an honorific or stand
+// next to a role or a signature, and locations are well-known places. Dates are normalized to
+// YYYY-MM-DD, or YYYY-MM for a month; slashed dates are read month first unless that can't be.
+func tagChunkEntities(chunks []*models.EnhancedChunk) {
+	for _, chunk := range chunks {
+		entities := extractEntities(chunk.Text)
+		dates := extractDates(chunk.Text)
+		if len(entities) == 0 && len(dates) == 0 {
+			continue
+		}
+		if chunk.Metadata == nil {
+			chunk.Metadata = make(map[string]interface{})
+		}
+		if len(entities) > 0 {
+			chunk.Metadata["entity"] = entities
+		}
+		if len(dates) > 0 {
+			chunk.Metadata["dates"] = dates
+		}
+	}
+}
+
+// entityList collects distinct names of one kind in the order they are found
+type entityList struct {
+	names []string
+	seen  map[string]bool
+}
+
+func (l *entityList) add(name string) {
+	name = strings.Join(strings.Fields(strings.Trim(name, " ,.;:'-")), " ")
+	key := strings.ToLower(name)
+	if len(name) < 2 || l.seen[key] || len(l.names) == maxEntitiesPerKind {
+		return
+	}
+	if l.seen == nil {
+		l.seen = make(map[string]bool)
+	}
+	l.seen[key] = true
+	l.names = append(l.names, name)
+}
+
+// extractEntities returns the names text mentions, by kind; kinds without any are left out
+func extractEntities(text string) map[string][]string {
+	var orgs, people, locations entityList
+
+	// Names are masked once found, so a company's name isn't read again as a place or person
+	masked := text
+	masked = replaceMatches(legalFormPattern, masked, func(groups []string) {
+		orgs.add(trimLeadingStopWords(groups[1]))
+	})
+	masked = replaceMatches(institutionPattern, masked, func(groups []string) {
+		// A lone "Department" or "Group" is a common noun starting a sentence
+		if name := trimLeadingStopWords(groups[1]); strings.Contains(name, " ") {
+			orgs.add(name)
+		}
+	})
+	for _, pattern := range []*regexp.Regexp{honorificPattern, personRolePattern, rolePersonPattern, signedByPattern} {
+		masked = replaceMatches(pattern, masked, func(groups []string) {
+			people.add(groups[1])
+		})
+	}
+	for _, pattern := range []*regexp.Regexp{knownLocationPattern, locatedPlacePattern} {
+		masked = replaceMatches(pattern, masked, func(groups []string) {
+			locations.add(groups[1])
+		})
+	}
+
+	entities := make(map[string][]string)
+	for kind, list := range map[string]entityList{entityOrg: orgs, entityPerson: people, entityLocation: locations} {
+		if len(list.names) > 0 {
+			entities[kind] = list.names
+		}
+	}
+	return entities
+}
+
+// trimLeadingStopWords drops capitalized common words that start a sentence before a name, as in
+// "The Acme Corp" or "At Acme Corp". Nothing is left of "The Company".
+func trimLeadingStopWords(name string) string {
+	words := strings.Fields(name)
+	for len(words) > 0 && stopWords[strings.ToLower(words[0])] {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// replaceMatches calls found with the submatches of every match of pattern in text, and returns
+// text with the matches blanked out. Blanks keep the length, so later patterns see the same offsets.
+func replaceMatches(pattern *regexp.Regexp, text string, found func(groups []string)) string {
+	return pattern.ReplaceAllStringFunc(text, func(match string) string {
+		found(pattern.FindStringSubmatch(match))
+		return strings.Repeat(" ", len(match))
+	})
+}
+
+// extractDates returns the dates text mentions, normalized and in chronological order
+func extractDates(text string) []string {
+	var dates entityList
+	add := func(year, month, day string) {
+		if date, ok := normalizeDate(year, month, day); ok {
+			dates.add(date)
+		}
+	}
+
+	masked := replaceMatches(isoDatePattern, text, func(g []string) { add(g[1], g[2], g[3]) })
+	masked = replaceMatches(monthDayYearPattern, masked, func(g []string) { add(g[3], g[1], g[2]) })
+	masked = replaceMatches(dayMonthYearPattern, masked, func(g []string) { add(g[3], g[2], g[1]) })
+	masked = replaceMatches(slashDatePattern, masked, func(g []string) {
+		// Month first, as in the US, unless the first number can't be a month
+		if first, _ := strconv.Atoi(g[1]); first > 12 {
+			add(g[3], g[2], g[1])
+		} else {
+			add(g[3], g[1], g[2])
+		}
+	})
+	masked = replaceMatches(dottedDatePattern, masked, func(g []string) { add(g[3], g[2], g[1]) })
+	replaceMatches(monthYearPattern, masked, func(g []string) { add(g[2], g[1], "") })
+	sort.Strings(dates.names)
+	return dates.names
+}
+
+// normalizeDate formats a date as YYYY-MM-DD, or YYYY-MM without a day. The month is a number or
+// an English month name, possibly abbreviated. Dates that don't exist are rejected.
+func normalizeDate(year, month, day string) (string, bool) {
+	y, err := strconv.Atoi(year)
+	if err != nil || y < 1000 {
+		return "", false
+	}
+	m, err := strconv.Atoi(month)
+	if err != nil {
+		m = monthNumber(month)
+	}
+	if m < 1 || m > 12 {
+		return "", false
+	}
+	if day == "" {
+		return time.Date(y, time.Month(m), 1, 0, 0, 0, 0, time.UTC).Format("2006-01"), true
+	}
+	d, err := strconv.Atoi(day)
+	if err != nil {
+		return "", false
+	}
+	date := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	if date.Day() != d || date.Month() != time.Month(m) {
+		return "", false
+	}
+	return date.Format("2006-01-02"), true
+}
+
+// monthNumber returns the number of an English month name or its abbreviation, or 0
+func monthNumber(name string) int {
+	prefix := strings.ToLower(name)
+	if len(prefix) > 3 {
+		prefix = prefix[:3]
+	}
+	for m := time.January; m <= time.December; m++ {
+		if strings.ToLower(m.String()[:3]) == prefix {
+			return int(m)
+		}
+	}
+	return 0
+}
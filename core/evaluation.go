@@ -0,0 +1,414 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"rag-go-app/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxEvaluationCases = 500
+	maxEvaluationRuns  = 24 // Parameter combinations per request
+	defaultEvalTopK    = 5
+)
+
+// EvaluationMetrics are the scores of one parameter combination, averaged over the test set
+type EvaluationMetrics struct {
+	HitRate            float64  `json:"hit_rate"`               // Share of cases with a relevant document among the results
+	MRR                float64  `json:"mrr"`                    // Mean reciprocal rank of the first relevant document
+	NDCG               float64  `json:"ndcg"`                   // Mean nDCG of the retrieved document ranking
+	Faithfulness       *float64 `json:"faithfulness,omitempty"` // Mean share of answer terms found in the retrieved context
+	AnswerF1           *float64 `json:"answer_f1,omitempty"`    // Mean term overlap F1 of generated and expected answers
+	RetrievalCases     int      `json:"retrieval_cases"`        // Cases with relevant documents, over which retrieval metrics are averaged
+	AnswerCases        int      `json:"answer_cases"`           // Cases with a generated answer
+	FailedCases        int      `json:"failed_cases"`
+	AvgLatencySeconds  float64  `json:"avg_latency_seconds"` // Mean time per case, including generation
+	ChunksInCollection int      `json:"chunks_in_collection,omitempty"`
+}
+
+// EvaluationCaseResult is the outcome of one test case in one run
+type EvaluationCaseResult struct {
+	Question             string   `json:"question"`
+	RetrievedDocumentIDs []string `json:"retrieved_document_ids"` // Distinct documents in rank order
+	FirstRelevantRank    int      `json:"first_relevant_rank"`    // 1-based rank in RetrievedDocumentIDs; 0 if none was retrieved
+	NDCG                 *float64 `json:"ndcg,omitempty"`         // Only for cases with relevant documents
+	Answer               string   `json:"answer,omitempty"`       // Generated answer
+	Faithfulness         *float64 `json:"faithfulness,omitempty"` // Share of answer terms found in the retrieved context
+	AnswerF1             *float64 `json:"answer_f1,omitempty"`    // Only for cases with an expected answer
+	Error                string   `json:"error,omitempty"`
+}
+
+// EvaluationRun is the result of one combination of the parameter grid
+type EvaluationRun struct {
+	ChunkingStrategy string                 `json:"chunking_strategy,omitempty"` // Empty when the stored chunks were evaluated
+	TopK             int                    `json:"top_k"`
+	RerankerEnabled  bool                   `json:"reranker_enabled"`
+	Metrics          EvaluationMetrics      `json:"metrics"`
+	Cases            []EvaluationCaseResult `json:"cases"`
+}
+
+// ValidateEvaluateRequest fills grid defaults and rejects requests that are malformed or too
+// expensive to run in one call
+func ValidateEvaluateRequest(req *models.EvaluateRequest) error {
+	if len(req.TestSet) > maxEvaluationCases {
+		return fmt.Errorf("test set has %d cases, the limit is %d", len(req.TestSet), maxEvaluationCases)
+	}
+
+	grid := &req.Grid
+	if len(grid.TopK) == 0 {
+		grid.TopK = []int{defaultEvalTopK}
+	}
+	if len(grid.RerankerEnabled) == 0 {
+		grid.RerankerEnabled = []bool{false}
+	}
+	for _, topK := range grid.TopK {
+		if topK <= 0 {
+			return fmt.Errorf("top_k values must be positive")
+		}
+	}
+	for _, strategy := range grid.ChunkingStrategies {
+		switch strategy {
+		case models.FixedSizeStrategy, models.SemanticStrategy, models.StructuralStrategy,
+			models.SentenceWindowStrategy, models.ParentDocumentStrategy:
+		default:
+			return fmt.Errorf("unknown chunking strategy %q", strategy)
+		}
+	}
+
+	runs := max(len(grid.ChunkingStrategies), 1) * len(grid.TopK) * len(grid.RerankerEnabled)
+	if runs > maxEvaluationRuns {
+		return fmt.Errorf("grid has %d combinations, the limit is %d", runs, maxEvaluationRuns)
+	}
+	return nil
+}
+
+// Evaluate runs the test set against every combination of the parameter grid. Each chunking
+// strategy is evaluated on a temporary copy of the collection re-chunked with that strategy,
+// which is deleted afterwards; without strategies the stored chunks are evaluated as they are.
+func (r *RAGService) Evaluate(ctx context.Context, req *models.EvaluateRequest) ([]EvaluationRun, error) {
+	startTime := time.Now()
+
+	strategies := req.Grid.ChunkingStrategies
+	if len(strategies) == 0 {
+		strategies = []models.ChunkingStrategy{""}
+	}
+
+	var runs []EvaluationRun
+	for _, strategy := range strategies {
+		strategyRuns, err := r.evaluateStrategy(ctx, req, strategy)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, strategyRuns...)
+	}
+
+	log.Printf("Evaluated %d cases over %d runs on collection '%s' in %v",
+		len(req.TestSet), len(runs), req.CollectionName, time.Since(startTime))
+	return runs, nil
+}
+
+// evaluateStrategy runs the top_k and reranker combinations for one chunking strategy
+func (r *RAGService) evaluateStrategy(ctx context.Context, req *models.EvaluateRequest, strategy models.ChunkingStrategy) ([]EvaluationRun, error) {
+	collection := req.CollectionName
+	var documentIDs map[string]string // Scratch document ID -> original document ID
+
+	if strategy != "" {
+		scratch, mapping, err := r.rechunkCollection(ctx, req.CollectionName, strategy)
+		if scratch != "" {
+			defer func() {
+				if err := r.vectorDB.DeleteCollection(scratch); err != nil {
+					log.Printf("Failed to delete evaluation collection '%s': %v", scratch, err)
+				}
+			}()
+		}
+		if err != nil {
+			return nil, err
+		}
+		collection, documentIDs = scratch, mapping
+	}
+
+	chunkCount, err := r.vectorDB.countChunks(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []EvaluationRun
+	for _, topK := range req.Grid.TopK {
+		for _, reranker := range req.Grid.RerankerEnabled {
+			run := EvaluationRun{ChunkingStrategy: string(strategy), TopK: topK, RerankerEnabled: reranker}
+			runStart := time.Now()
+			for _, testCase := range req.TestSet {
+				// Per-case errors are reported in the case, but a cancelled request ends the evaluation
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				run.Cases = append(run.Cases, r.evaluateCase(ctx, collection, testCase, topK, reranker, req.GenerateAnswers, documentIDs))
+			}
+			run.Metrics = summarizeEvaluation(run.Cases, req.TestSet)
+			run.Metrics.AvgLatencySeconds = time.Since(runStart).Seconds() / float64(len(req.TestSet))
+			run.Metrics.ChunksInCollection = chunkCount
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+// rechunkCollection copies the documents of a collection into a new temporary collection,
+// chunking them with the given strategy. It returns the scratch collection, which the caller
+// deletes even on error, and the mapping from its document IDs to the original ones.
+func (r *RAGService) rechunkCollection(ctx context.Context, collectionName string, strategy models.ChunkingStrategy) (string, map[string]string, error) {
+	documents, err := r.vectorDB.listDocumentContents(collectionName)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(documents) == 0 {
+		return "", nil, fmt.Errorf("collection '%s' has no documents to re-chunk", collectionName)
+	}
+
+	// The scratch collection stores embeddings like the original, so quantization affects both alike
+	quantization, err := r.vectorDB.collectionQuantization(r.vectorDB.conn, collectionName)
+	if err != nil {
+		return "", nil, err
+	}
+	scratch := "__eval_" + uuid.New().String()
+	if err := r.vectorDB.CreateCollection(scratch, "Temporary collection for evaluating "+string(strategy)+" chunking", nil, quantization); err != nil {
+		return "", nil, err
+	}
+
+	log.Printf("Re-chunking %d documents of '%s' with the %s strategy", len(documents), collectionName, strategy)
+	mapping := make(map[string]string, len(documents))
+	for _, doc := range documents {
+		result, err := r.IngestDocument(ctx, scratch, &models.AddDocumentRequest{
+			CollectionName: scratch,
+			Content:        doc.Content,
+			Source:         doc.Source,
+			DocType:        doc.DocType,
+			ChunkingConfig: StrategyChunkingConfig(strategy),
+		})
+		if err != nil {
+			return scratch, nil, fmt.Errorf("failed to re-chunk document %s: %w", doc.ID, err)
+		}
+		mapping[result.DocumentID] = doc.ID
+	}
+	return scratch, mapping, nil
+}
+
+// evaluateCase retrieves for one question and scores the ranking and, if requested, the answer
+func (r *RAGService) evaluateCase(ctx context.Context, collection string, testCase models.EvaluationCase, topK int, reranker, generate bool, documentIDs map[string]string) EvaluationCaseResult {
+	result := EvaluationCaseResult{Question: testCase.Question, RetrievedDocumentIDs: []string{}}
+
+	retrieved, err := r.Retrieve(ctx, &models.QueryRequest{
+		CollectionName:  collection,
+		Query:           testCase.Question,
+		TopK:            topK,
+		RerankerEnabled: reranker,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	seen := make(map[string]bool)
+	for _, chunk := range retrieved.Chunks {
+		id := chunk.DocumentID
+		if original, ok := documentIDs[id]; ok {
+			id = original
+		}
+		if !seen[id] {
+			seen[id] = true
+			result.RetrievedDocumentIDs = append(result.RetrievedDocumentIDs, id)
+		}
+	}
+
+	if len(testCase.RelevantDocumentIDs) > 0 {
+		relevant := make(map[string]bool, len(testCase.RelevantDocumentIDs))
+		for _, id := range testCase.RelevantDocumentIDs {
+			relevant[id] = true
+		}
+		for rank, id := range result.RetrievedDocumentIDs {
+			if relevant[id] {
+				result.FirstRelevantRank = rank + 1
+				break
+			}
+		}
+		ndcg := rankingNDCG(result.RetrievedDocumentIDs, relevant, topK)
+		result.NDCG = &ndcg
+	}
+
+	if !generate || len(retrieved.Chunks) == 0 {
+		return result
+	}
+
+	answer, err := r.generateAnswer(ctx, testCase.Question, r.prepareContext(retrieved.Chunks), nil)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to generate answer: %v", err)
+		return result
+	}
+	result.Answer = answer
+
+	faithfulness := termSupport(answer, strings.Join(r.extractChunkTexts(retrieved.Chunks), "\n"))
+	result.Faithfulness = &faithfulness
+	if testCase.ExpectedAnswer != "" {
+		f1 := termF1(answer, testCase.ExpectedAnswer)
+		result.AnswerF1 = &f1
+	}
+	return result
+}
+
+// summarizeEvaluation averages case scores; each metric is averaged over the cases it applies to
+func summarizeEvaluation(cases []EvaluationCaseResult, testSet []models.EvaluationCase) EvaluationMetrics {
+	var metrics EvaluationMetrics
+	var faithfulness, answerF1 float64
+	var f1Cases int
+
+	for i, result := range cases {
+		if result.Error != "" {
+			metrics.FailedCases++
+		}
+		if result.NDCG != nil {
+			metrics.RetrievalCases++
+			metrics.NDCG += *result.NDCG
+			if result.FirstRelevantRank > 0 {
+				metrics.HitRate++
+				metrics.MRR += 1 / float64(result.FirstRelevantRank)
+			}
+		} else if len(testSet[i].RelevantDocumentIDs) > 0 && result.Error != "" {
+			// A case that failed before retrieval counts as a miss
+			metrics.RetrievalCases++
+		}
+		if result.Faithfulness != nil {
+			metrics.AnswerCases++
+			faithfulness += *result.Faithfulness
+		}
+		if result.AnswerF1 != nil {
+			f1Cases++
+			answerF1 += *result.AnswerF1
+		}
+	}
+
+	if metrics.RetrievalCases > 0 {
+		n := float64(metrics.RetrievalCases)
+		metrics.HitRate /= n
+		metrics.MRR /= n
+		metrics.NDCG /= n
+	}
+	if metrics.AnswerCases > 0 {
+		mean := faithfulness / float64(metrics.AnswerCases)
+		metrics.Faithfulness = &mean
+	}
+	if f1Cases > 0 {
+		mean := answerF1 / float64(f1Cases)
+		metrics.AnswerF1 = &mean
+	}
+	return metrics
+}
+
+// rankingNDCG scores a ranking with binary relevance against the ideal ranking of up to k
+// relevant documents
+func rankingNDCG(ranking []string, relevant map[string]bool, k int) float64 {
+	var dcg, ideal float64
+	for i, id := range ranking {
+		if relevant[id] {
+			dcg += 1 / math.Log2(float64(i+2))
+		}
+	}
+	for i := 0; i < min(len(relevant), k); i++ {
+		ideal += 1 / math.Log2(float64(i+2))
+	}
+	if ideal == 0 {
+		return 0
+	}
+	return dcg / ideal
+}
+
+// contentTerms returns the distinct lowercased words of text, without stop words, short words
+// and numbers such as citation markers
+func contentTerms(text string) map[string]bool {
+	terms := make(map[string]bool)
+	for _, term := range extractSearchTerms(text) {
+		if len(term) < 3 || stopWords[term] || strings.Trim(term, "0123456789") == "" {
+			continue
+		}
+		terms[term] = true
+	}
+	return terms
+}
+
+// termSupport is the share of the answer's content terms that occur in the context, a cheap
+// proxy for how much of the answer is grounded in what was retrieved
+func termSupport(answer, context string) float64 {
+	answerTerms := contentTerms(answer)
+	if len(answerTerms) == 0 {
+		return 1
+	}
+	contextTerms := contentTerms(context)
+	supported := 0
+	for term := range answerTerms {
+		if contextTerms[term] {
+			supported++
+		}
+	}
+	return float64(supported) / float64(len(answerTerms))
+}
+
+// termF1 is the F1 score of the content terms of an answer against the expected answer
+func termF1(answer, expected string) float64 {
+	answerTerms, expectedTerms := contentTerms(answer), contentTerms(expected)
+	if len(answerTerms) == 0 || len(expectedTerms) == 0 {
+		return 0
+	}
+	common := 0
+	for term := range answerTerms {
+		if expectedTerms[term] {
+			common++
+		}
+	}
+	if common == 0 {
+		return 0
+	}
+	precision := float64(common) / float64(len(answerTerms))
+	recall := float64(common) / float64(len(expectedTerms))
+	return 2 * precision * recall / (precision + recall)
+}
+
+// listDocumentContents returns the stored documents of a collection with their full content, oldest first
+func (db *VectorDB) listDocumentContents(collectionName string) ([]models.Document, error) {
+	if err := db.requireCollection(db.conn, collectionName); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(`SELECT id, rag_open(content), COALESCE(source, ''), COALESCE(doc_type, '') FROM documents
+		WHERE collection_name = ? AND tenant_id = ?
+		ORDER BY created_at, rowid`, collectionName, db.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+
+	var documents []models.Document
+	for rows.Next() {
+		var doc models.Document
+		if err := rows.Scan(&doc.ID, &doc.Content, &doc.Source, &doc.DocType); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		documents = append(documents, doc)
+	}
+	return documents, rows.Err()
+}
+
+// countChunks returns the number of chunks stored in a collection
+func (db *VectorDB) countChunks(collectionName string) (int, error) {
+	var count int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM enhanced_chunks WHERE collection_name = ? AND tenant_id = ?`,
+		collectionName, db.tenant).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count chunks: %w", err)
+	}
+	return count, nil
+}
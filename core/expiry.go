@@ -0,0 +1,191 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"sync"
+	"time"
+)
+
+// expiryLayout is how expiry times are stored, in UTC, so they compare as text like created_at
+const expiryLayout = "2006-01-02 15:04:05"
+
+// ValidateExpiry rejects an expiry IngestDocument could not apply
+func ValidateExpiry(req *models.AddDocumentRequest) error {
+	_, err := documentExpiry(req, time.Now())
+	return err
+}
+
+// documentExpiry returns when a document added at now expires: at expires_at, or ttl_seconds
+// later. It returns nil when the request sets neither.
+func documentExpiry(req *models.AddDocumentRequest, now time.Time) (*time.Time, error) {
+	if req.ExpiresAt != "" && req.TTLSeconds > 0 {
+		return nil, fmt.Errorf("expires_at and ttl_seconds cannot both be set")
+	}
+
+	var expiresAt time.Time
+	switch {
+	case req.TTLSeconds > 0:
+		expiresAt = now.Add(time.Duration(req.TTLSeconds) * time.Second)
+	case req.ExpiresAt != "":
+		t, err := parseListTime(req.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("expires_at must be RFC 3339 or YYYY-MM-DD")
+		}
+		if !t.After(now) {
+			return nil, fmt.Errorf("expires_at %s is in the past", req.ExpiresAt)
+		}
+		expiresAt = t
+	default:
+		return nil, nil
+	}
+
+	expiresAt = expiresAt.UTC().Truncate(time.Second)
+	return &expiresAt, nil
+}
+
+// expiryValue converts an expiry to its stored form, NULL for none
+func expiryValue(expiresAt *time.Time) interface{} {
+	if expiresAt == nil {
+		return nil
+	}
+	return expiresAt.UTC().Format(expiryLayout)
+}
+
+// SetDocumentExpiry replaces the expiry of a stored document; nil removes it
+func (db *VectorDB) SetDocumentExpiry(documentID string, expiresAt *time.Time) error {
+	result, err := db.conn.Exec(`UPDATE documents SET expires_at = ? WHERE id = ? AND tenant_id = ?`,
+		expiryValue(expiresAt), documentID, db.tenant)
+	if err != nil {
+		return fmt.Errorf("failed to update document expiry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("document '%s' not found", documentID)
+	}
+	return nil
+}
+
+// expiredDocument is a document of any tenant past its expiry
+type expiredDocument struct {
+	id, tenant, collection string
+}
+
+// expiredDocuments lists the documents of every tenant that expired by now
+func (db *VectorDB) expiredDocuments(now time.Time) ([]expiredDocument, error) {
+	rows, err := db.conn.Query(`SELECT id, tenant_id, collection_name FROM documents
+		WHERE expires_at IS NOT NULL AND expires_at <= ? ORDER BY expires_at`, now.UTC().Format(expiryLayout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired documents: %w", err)
+	}
+	defer rows.Close()
+
+	var documents []expiredDocument
+	for rows.Next() {
+		var doc expiredDocument
+		if err := rows.Scan(&doc.id, &doc.tenant, &doc.collection); err != nil {
+			return nil, fmt.Errorf("failed to scan expired document: %w", err)
+		}
+		documents = append(documents, doc)
+	}
+	return documents, rows.Err()
+}
+
+// ExpirySweeper periodically deletes expired documents with their chunks, embeddings and graph,
+// for every tenant. Deletions are announced to webhooks like any other.
+type ExpirySweeper struct {
+	db       *VectorDB
+	interval time.Duration
+
+	mu   sync.Mutex // Serializes sweeps
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewExpirySweeper returns a sweeper that has not been started, or nil when the sweep is disabled
+func NewExpirySweeper(db *VectorDB, cfg config.ExpiryConfig) *ExpirySweeper {
+	if cfg.SweepIntervalSeconds <= 0 {
+		return nil
+	}
+	return &ExpirySweeper{db: db, interval: time.Duration(cfg.SweepIntervalSeconds) * time.Second}
+}
+
+// Start sweeps once, then again every interval in the background until Stop is called
+func (s *ExpirySweeper) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.Sweep(); err != nil && !errors.Is(err, ErrReadOnly) {
+				log.Printf("Expiry sweep failed: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+
+	log.Printf("Expired documents are deleted every %v", s.interval)
+}
+
+// Stop ends the sweep loop
+func (s *ExpirySweeper) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
+
+// Sweep deletes the documents that have expired and returns how many it deleted. A document that
+// fails to delete is retried on the next sweep. While the server is read-only it deletes nothing
+// and returns ErrReadOnly; expired documents are deleted once it is writable again.
+func (s *ExpirySweeper) Sweep() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := checkWritable(); err != nil {
+		return 0, err
+	}
+
+	expired, err := s.db.expiredDocuments(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	var firstErr error
+	for _, doc := range expired {
+		if err := s.db.ForTenant(doc.tenant).DeleteDocument(doc.id); err != nil {
+			log.Printf("Failed to delete expired document '%s' of tenant %s: %v", doc.id, doc.tenant, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		deleted++
+		err := s.db.RecordAudit(&AuditEntry{
+			Tenant: doc.tenant, ActorKind: AuditActorSystem, Actor: "expiry",
+			Action: "document.expire", Collection: doc.collection, ResourceID: doc.id,
+		})
+		if err != nil {
+			log.Printf("Failed to audit deletion of expired document '%s': %v", doc.id, err)
+		}
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d expired documents", deleted)
+	}
+	if firstErr != nil {
+		return deleted, fmt.Errorf("%d of %d expired documents could not be deleted: %w", len(expired)-deleted, len(expired), firstErr)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"fmt"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxAnswerPassages is how many passages an extractive answer quotes
+const maxAnswerPassages = 3
+
+// selectPassages picks the sentences of the retrieved chunks sharing the most terms with the
+// query, best first and in chunk order among equals. When none shares a term, the first chunk is
+// quoted whole. Document offsets are left at -1 for locatePassages to fill in.
+func selectPassages(query string, chunks []*models.EnhancedChunk) []models.AnswerPassage {
+	queryTerms := extractSearchTerms(query)
+
+	var passages []models.AnswerPassage
+	quote := func(i, start, end int, score float64) models.AnswerPassage {
+		chunk := chunks[i]
+		chunkStart := utf8.RuneCountInString(chunk.Text[:start])
+		return models.AnswerPassage{
+			Text:       chunk.Text[start:end],
+			Marker:     i + 1, // Context number of the source chunk, so extractive answers carry citations too
+			ChunkID:    chunk.ID,
+			DocumentID: chunk.DocumentID,
+			Score:      score,
+			ChunkStart: chunkStart,
+			ChunkEnd:   chunkStart + utf8.RuneCountInString(chunk.Text[start:end]),
+			StartPos:   -1,
+			EndPos:     -1,
+		}
+	}
+
+	for i, chunk := range chunks {
+		for _, span := range sentenceSpans(chunk.Text, chunkLanguage(chunk)) {
+			sentenceLower := strings.ToLower(chunk.Text[span[0]:span[1]])
+			matched := 0
+			for _, term := range queryTerms {
+				if strings.Contains(sentenceLower, term) {
+					matched++
+				}
+			}
+			if matched > 0 {
+				passages = append(passages, quote(i, span[0], span[1], float64(matched)/float64(len(queryTerms))))
+			}
+		}
+	}
+
+	if len(passages) == 0 {
+		if len(chunks) == 0 {
+			return nil
+		}
+		text := chunks[0].Text
+		start := len(text) - len(strings.TrimLeftFunc(text, unicode.IsSpace))
+		end := len(strings.TrimRightFunc(text, unicode.IsSpace))
+		if start >= end {
+			return nil
+		}
+		passages = append(passages, quote(0, start, end, 0))
+	}
+
+	sort.SliceStable(passages, func(i, j int) bool {
+		return passages[i].Score > passages[j].Score
+	})
+	if len(passages) > maxAnswerPassages {
+		passages = passages[:maxAnswerPassages]
+	}
+	return passages
+}
+
+// quotePassages writes passages as an answer, one quoted line each, ending with the [n] marker of
+// its chunk
+func quotePassages(passages []models.AnswerPassage) string {
+	lines := make([]string, len(passages))
+	for i, p := range passages {
+		lines[i] = fmt.Sprintf("> %s [%d]", p.Text, p.Marker)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// locatePassages sets the offsets of passages in their documents, where the chunks can be located
+func (r *RAGService) locatePassages(passages []models.AnswerPassage, chunks []*models.EnhancedChunk) {
+	if len(passages) == 0 {
+		return
+	}
+	documentOffsets := r.locateChunks(chunks)
+	for i := range passages {
+		if offset := documentOffsets[passages[i].Marker-1]; offset >= 0 {
+			passages[i].StartPos = offset + passages[i].ChunkStart
+			passages[i].EndPos = offset + passages[i].ChunkEnd
+		}
+	}
+}
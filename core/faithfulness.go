@@ -0,0 +1,250 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// VerdictContradicted marks a sentence the chunks state otherwise
+const VerdictContradicted = "contradicted"
+
+// embeddingSupportThreshold is the similarity to a passage of the chunks that makes a sentence
+// supported with the embedding backend
+const embeddingSupportThreshold = 0.75
+
+// strippedAnswer replaces an answer none of whose sentences could be verified
+const strippedAnswer = "I couldn't verify any part of the answer against the retrieved documents."
+
+// verificationPrompt asks the chat model for an entailment verdict on every sentence of an answer
+const verificationPrompt = `Below are numbered contexts and the numbered sentences of an answer written from them. For each sentence, decide whether the contexts entail it: "supported" if the contexts state it or directly imply it, "contradicted" if they state otherwise, and "unsupported" if they don't say. A sentence saying the contexts don't contain some information is "supported" when that is true.
+
+Respond with only a JSON array with one object per sentence, listing the contexts that support or contradict it, e.g. [{"sentence": 1, "verdict": "supported", "contexts": [2]}, {"sentence": 2, "verdict": "unsupported", "contexts": []}].
+
+Contexts:
+%s
+
+Sentences:
+%s`
+
+// answerSentence is a sentence of an answer, as byte offsets into it
+type answerSentence struct {
+	start, end int
+	text       string // Without citation markers
+}
+
+// verifyFaithfulness checks every sentence of the answer against the chunks with the requested
+// backend and, with the strip action, removes the sentences they don't support. The llm backend
+// falls back to embedding similarity when the chat model fails; when the embedding server fails
+// too, the answer is returned unverified. Only an ended ctx is an error.
+func (r *RAGService) verifyFaithfulness(ctx context.Context, req *models.QueryRequest, answer string, chunks []*models.EnhancedChunk) (string, *models.FaithfulnessReport, []string, error) {
+	sentences := splitAnswer(answer)
+	if len(sentences) == 0 {
+		return answer, nil, nil, nil
+	}
+
+	var degradations []string
+	var verdicts []models.SentenceVerdict
+	var err error
+	backend := models.LLMVerification
+	if req.VerificationBackend == models.EmbeddingVerification {
+		backend = models.EmbeddingVerification
+	}
+	if backend == models.LLMVerification {
+		verdicts, err = r.verifyByEntailment(ctx, sentences, chunks)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("LLM verification failed, using embedding similarity: %v", err)
+			degradations = append(degradations, DegradedEmbeddingVerification)
+			backend = models.EmbeddingVerification
+		}
+	}
+	if backend == models.EmbeddingVerification && ctx.Err() == nil {
+		verdicts, err = r.verifyBySimilarity(ctx, sentences, chunks)
+	}
+	if ctx.Err() != nil {
+		return "", nil, nil, ctx.Err()
+	}
+	if err != nil {
+		log.Printf("Faithfulness verification failed, answering unverified: %v", err)
+		return answer, nil, append(degradations, DegradedVerificationSkipped), nil
+	}
+
+	report := &models.FaithfulnessReport{Backend: backend, Sentences: verdicts}
+	var unsupported []answerSentence
+	for i := range verdicts {
+		sentence := sentences[i]
+		verdicts[i].Text = strings.TrimSpace(answer[sentence.start:sentence.end])
+		verdicts[i].Start = utf8.RuneCountInString(answer[:sentence.start])
+		verdicts[i].End = verdicts[i].Start + utf8.RuneCountInString(answer[sentence.start:sentence.end])
+		switch verdicts[i].Verdict {
+		case VerdictSupported:
+			report.Supported++
+		case VerdictContradicted:
+			report.Contradicted++
+			fallthrough
+		default:
+			report.Unsupported++
+			unsupported = append(unsupported, sentence)
+		}
+	}
+	report.Score = roundScore(float64(report.Supported) / float64(len(verdicts)))
+
+	if req.UnsupportedAction == models.StripUnsupported && len(unsupported) > 0 {
+		report.OriginalAnswer = answer
+		report.Stripped = len(unsupported)
+		answer = stripSentences(answer, unsupported)
+	}
+
+	log.Printf("Faithfulness (%s): %d of %d sentences supported, %d contradicted, %d stripped",
+		backend, report.Supported, len(verdicts), report.Contradicted, report.Stripped)
+	return answer, report, degradations, nil
+}
+
+// applyFaithfulness records the faithfulness score of a verified response in its confidence
+// details. An answer that still holds unsupported sentences isn't grounded, and its confidence
+// shrinks by the share of them.
+func applyFaithfulness(response *models.QueryResponse) {
+	report := response.Faithfulness
+	if report == nil {
+		return
+	}
+	score := report.Score
+	response.ConfidenceDetails.Faithfulness = &score
+	if report.Unsupported > report.Stripped {
+		response.IsGrounded = false
+		response.Confidence = roundScore(response.Confidence * score)
+	}
+}
+
+// splitAnswer splits an answer into the sentences worth checking: those with words besides their
+// citation markers
+func splitAnswer(answer string) []answerSentence {
+	var sentences []answerSentence
+	for _, span := range passageSpans(answer, detectLanguage(answer)) {
+		text := strings.TrimSpace(citationMarkerPattern.ReplaceAllString(answer[span[0]:span[1]], ""))
+		if strings.IndexFunc(text, isWordRune) < 0 {
+			continue
+		}
+		sentences = append(sentences, answerSentence{start: span[0], end: span[1], text: text})
+	}
+	return sentences
+}
+
+// isWordRune reports whether r is a letter or digit
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// verifyByEntailment asks the chat model for a verdict on every sentence. Sentences it gives no
+// verdict for count as unsupported.
+func (r *RAGService) verifyByEntailment(ctx context.Context, sentences []answerSentence, chunks []*models.EnhancedChunk) ([]models.SentenceVerdict, error) {
+	var numbered strings.Builder
+	for i, sentence := range sentences {
+		fmt.Fprintf(&numbered, "%d. %s\n", i+1, sentence.text)
+	}
+	prompt := fmt.Sprintf(verificationPrompt, r.prepareContext(chunks), numbered.String())
+	response, err := r.llmClient.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	start := strings.Index(response, "[")
+	end := strings.LastIndex(response, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in model response")
+	}
+	var judged []struct {
+		Sentence int    `json:"sentence"`
+		Verdict  string `json:"verdict"`
+		Contexts []int  `json:"contexts"`
+	}
+	if err := json.Unmarshal([]byte(response[start:end+1]), &judged); err != nil {
+		return nil, fmt.Errorf("invalid verification JSON in model response: %w", err)
+	}
+
+	verdicts := make([]models.SentenceVerdict, len(sentences))
+	for i := range verdicts {
+		verdicts[i].Verdict = VerdictUnsupported
+	}
+	for _, judgement := range judged {
+		if judgement.Sentence < 1 || judgement.Sentence > len(sentences) {
+			continue
+		}
+		verdict := &verdicts[judgement.Sentence-1]
+		switch strings.ToLower(strings.TrimSpace(judgement.Verdict)) {
+		case VerdictSupported, "entailed", "entailment":
+			verdict.Verdict = VerdictSupported
+		case VerdictContradicted, "contradiction":
+			verdict.Verdict = VerdictContradicted
+		default:
+			verdict.Verdict = VerdictUnsupported
+		}
+		verdict.ChunkIDs = nil
+		for _, context := range judgement.Contexts {
+			if context >= 1 && context <= len(chunks) && !contains(verdict.ChunkIDs, chunks[context-1].ID) {
+				verdict.ChunkIDs = append(verdict.ChunkIDs, chunks[context-1].ID)
+			}
+		}
+	}
+	return verdicts, nil
+}
+
+// verifyBySimilarity embeds every sentence and every passage of the chunks. A sentence is supported
+// when its closest passage reaches embeddingSupportThreshold; that passage's chunk supports it.
+func (r *RAGService) verifyBySimilarity(ctx context.Context, sentences []answerSentence, chunks []*models.EnhancedChunk) ([]models.SentenceVerdict, error) {
+	texts := make([]string, 0, len(sentences))
+	for _, sentence := range sentences {
+		texts = append(texts, sentence.text)
+	}
+	var owners []int // Chunk index of each passage
+	for i, chunk := range chunks {
+		for _, span := range passageSpans(chunk.Text, chunkLanguage(chunk)) {
+			texts = append(texts, chunk.Text[span[0]:span[1]])
+			owners = append(owners, i)
+		}
+	}
+
+	embeddings, err := r.embeddingClient.GetEmbeddings(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed sentences: %w", err)
+	}
+
+	verdicts := make([]models.SentenceVerdict, len(sentences))
+	for i := range sentences {
+		best, owner := 0.0, -1
+		for j, chunkIndex := range owners {
+			if similarity := cosineSimilarity(embeddings[i], embeddings[len(sentences)+j]); similarity > best {
+				best, owner = similarity, chunkIndex
+			}
+		}
+		similarity := roundScore(best)
+		verdicts[i] = models.SentenceVerdict{Verdict: VerdictUnsupported, Similarity: &similarity}
+		if owner >= 0 && best >= embeddingSupportThreshold {
+			verdicts[i].Verdict = VerdictSupported
+			verdicts[i].ChunkIDs = []string{chunks[owner].ID}
+		}
+	}
+	return verdicts, nil
+}
+
+// stripSentences removes sentences from an answer together with the spaces after them; an answer
+// left without words becomes strippedAnswer
+func stripSentences(answer string, sentences []answerSentence) string {
+	for i := len(sentences) - 1; i >= 0; i-- {
+		end := sentences[i].end
+		for end < len(answer) && (answer[end] == ' ' || answer[end] == '\t') {
+			end++
+		}
+		answer = answer[:sentences[i].start] + answer[end:]
+	}
+	answer = strings.TrimSpace(answer)
+	if strings.IndexFunc(answer, isWordRune) < 0 {
+		return strippedAnswer
+	}
+	return answer
+}
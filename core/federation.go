@@ -0,0 +1,271 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-go-app/core/retrieval"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// allCollections in collection_names searches every collection of the tenant
+const allCollections = "*"
+
+// queryCollections returns the collections a federated query searches: those of collection_names
+// and collection_name, in order and without repeats, with "*" standing for all of the tenant's.
+// It returns nil for a query on collection_name alone.
+func (r *RAGService) queryCollections(req *models.QueryRequest) ([]string, error) {
+	if len(req.CollectionNames) == 0 {
+		return nil, nil
+	}
+
+	var collections []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			collections = append(collections, name)
+		}
+	}
+	add(req.CollectionName)
+	for _, name := range req.CollectionNames {
+		if name != allCollections {
+			add(name)
+			continue
+		}
+		names, err := r.vectorDB.collectionNames()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			add(name)
+		}
+	}
+	return collections, nil
+}
+
+// scoreSpace names the scale of the similarity scores a collection's vector search returns.
+// Scores of collections in different spaces can't be compared: quantized vectors only
+// approximate the similarity of float vectors, unless they are rescored with them.
+func scoreSpace(quantization *models.QuantizationConfig) string {
+	if storesFloatEmbeddings(quantization) {
+		return "float"
+	}
+	return string(quantization.Type)
+}
+
+// federatedSearch returns a searchFunc that runs search on every collection concurrently and
+// merges the rankings into topK chunks, each tagged with its collection. Rankings in the same
+// score space are merged by score; otherwise, or when some collections fell back to lexical
+// search and others didn't, they are fused with reciprocal rank fusion, which only uses positions,
+// and onRankFusion is called.
+func (r *RAGService) federatedSearch(collections []string, topK int, search func(ctx context.Context, collection, query string) ([]*models.EnhancedChunk, []float64, []string, error), onRankFusion func()) (searchFunc, error) {
+	spaces := make(map[string]bool)
+	for _, collection := range collections {
+		quantization, err := r.vectorDB.collectionQuantization(r.vectorDB.conn, collection)
+		if err != nil {
+			return nil, err
+		}
+		spaces[scoreSpace(quantization)] = true
+	}
+
+	return func(ctx context.Context, query string) ([]*models.EnhancedChunk, []float64, []string, error) {
+		type searched struct {
+			chunks       []*models.EnhancedChunk
+			scores       []float64
+			degradations []string
+			err          error
+		}
+		results := make([]searched, len(collections))
+		var wg sync.WaitGroup
+		for i, collection := range collections {
+			wg.Add(1)
+			go func(i int, collection string) {
+				defer wg.Done()
+				result := &results[i]
+				result.chunks, result.scores, result.degradations, result.err = search(ctx, collection, query)
+				for _, chunk := range result.chunks {
+					chunk.Collection = collection
+				}
+			}(i, collection)
+		}
+		wg.Wait()
+
+		var degradations []string
+		var rankings []retrieval.Ranking
+		degradedCollections := 0
+		for i, result := range results {
+			if result.err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to search collection '%s': %w", collections[i], result.err)
+			}
+			if contains(result.degradations, DegradedLexicalSearch) {
+				degradedCollections++
+			}
+			for _, degradation := range result.degradations {
+				if !contains(degradations, degradation) {
+					degradations = append(degradations, degradation)
+				}
+			}
+			rankings = append(rankings, retrieval.NewRanking(collections[i], result.chunks, result.scores))
+		}
+
+		var chunks []*models.EnhancedChunk
+		var scores []float64
+		if len(spaces) > 1 || (degradedCollections > 0 && degradedCollections < len(collections)) {
+			onRankFusion()
+			fused := retrieval.ReciprocalRankFusion(rankings)
+			if len(fused) > topK {
+				fused = fused[:topK]
+			}
+			chunks, scores = fusedChunks(fused)
+		} else {
+			chunkLists := make([][]*models.EnhancedChunk, len(results))
+			scoreLists := make([][]float64, len(results))
+			for i, result := range results {
+				chunkLists[i], scoreLists[i] = result.chunks, result.scores
+			}
+			chunks, scores = mergeByScore(chunkLists, scoreLists, topK)
+		}
+
+		log.Printf("Federated search over %d collections returned %d chunks", len(collections), len(chunks))
+		return chunks, scores, degradations, nil
+	}, nil
+}
+
+// mergeByScore merges the rankings of several searches, aligned chunk and score lists, into the
+// topK best scored chunks
+func mergeByScore(chunkLists [][]*models.EnhancedChunk, scoreLists [][]float64, topK int) ([]*models.EnhancedChunk, []float64) {
+	var chunks []*models.EnhancedChunk
+	var scores []float64
+	for i := range chunkLists {
+		chunks = append(chunks, chunkLists[i]...)
+		scores = append(scores, scoreLists[i]...)
+	}
+
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	if len(order) > topK {
+		order = order[:topK]
+	}
+	return pickChunks(chunks, order), pickScores(scores, order)
+}
+
+// expandFederatedGraph runs graph expansion within each collection, from the chunks retrieved
+// from it, since entities are extracted per collection. The expanded rankings are merged by score.
+func (r *RAGService) expandFederatedGraph(req *models.QueryRequest, chunks []*models.EnhancedChunk, scores []float64, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, []string, error) {
+	var collections []string
+	chunkLists := make(map[string][]*models.EnhancedChunk)
+	scoreLists := make(map[string][]float64)
+	for i, chunk := range chunks {
+		if _, ok := chunkLists[chunk.Collection]; !ok {
+			collections = append(collections, chunk.Collection)
+		}
+		chunkLists[chunk.Collection] = append(chunkLists[chunk.Collection], chunk)
+		scoreLists[chunk.Collection] = append(scoreLists[chunk.Collection], scores[i])
+	}
+
+	var entities []string
+	expandedChunks := make([][]*models.EnhancedChunk, 0, len(collections))
+	expandedScores := make([][]float64, 0, len(collections))
+	total := 0
+	for _, collection := range collections {
+		collectionReq := *req
+		collectionReq.CollectionName = collection
+		groupChunks, groupScores, groupEntities, err := r.expandAlongGraph(&collectionReq, chunkLists[collection], scoreLists[collection], filters)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, chunk := range groupChunks {
+			chunk.Collection = collection
+		}
+		for _, entity := range groupEntities {
+			if !contains(entities, entity) {
+				entities = append(entities, entity)
+			}
+		}
+		expandedChunks = append(expandedChunks, groupChunks)
+		expandedScores = append(expandedScores, groupScores)
+		total += len(groupChunks)
+	}
+
+	merged, mergedScores := mergeByScore(expandedChunks, expandedScores, total)
+	return merged, mergedScores, entities, nil
+}
+
+// tagCollections sets the collection of chunks added after the federated search, such as parents
+func (r *RAGService) tagCollections(chunks []*models.EnhancedChunk) error {
+	var untagged []string
+	for _, chunk := range chunks {
+		if chunk.Collection == "" {
+			untagged = append(untagged, chunk.ID)
+		}
+	}
+	if len(untagged) == 0 {
+		return nil
+	}
+
+	collections, err := r.vectorDB.chunkCollections(untagged)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if chunk.Collection == "" {
+			chunk.Collection = collections[chunk.ID]
+		}
+	}
+	return nil
+}
+
+// collectionNames returns the names of the tenant's collections, including those whose documents
+// were added without creating them, in alphabetical order
+func (db *VectorDB) collectionNames() ([]string, error) {
+	rows, err := db.conn.Query(`SELECT name FROM collections WHERE tenant_id = ?
+		UNION SELECT DISTINCT collection_name FROM enhanced_chunks WHERE tenant_id = ?
+		ORDER BY 1`, db.tenant, db.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan collection name: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// chunkCollections returns the collection of each chunk, by ID
+func (db *VectorDB) chunkCollections(chunkIDs []string) (map[string]string, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunkIDs)), ",")
+	args := make([]interface{}, 0, len(chunkIDs)+1)
+	for _, id := range chunkIDs {
+		args = append(args, id)
+	}
+	args = append(args, db.tenant)
+
+	rows, err := db.conn.Query(`SELECT id, collection_name FROM enhanced_chunks WHERE id IN (`+placeholders+`) AND tenant_id = ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up chunk collections: %w", err)
+	}
+	defer rows.Close()
+
+	collections := make(map[string]string, len(chunkIDs))
+	for rows.Next() {
+		var id, collection string
+		if err := rows.Scan(&id, &collection); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk collection: %w", err)
+		}
+		collections[id] = collection
+	}
+	return collections, rows.Err()
+}
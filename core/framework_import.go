@@ -0,0 +1,512 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Formats of the corpora exported by Python RAG frameworks that ImportFrameworkExport reads
+const (
+	ExportFormatLangChain  = "langchain"  // LangChain Documents, one JSON object per line or a JSON array
+	ExportFormatLlamaIndex = "llamaindex" // LlamaIndex nodes, a JSON array or a persisted docstore
+)
+
+// LlamaIndex relationship keys, the values of its NodeRelationship enum
+const (
+	llamaIndexSource = "1"
+	llamaIndexParent = "4"
+)
+
+// exportedChunk is a chunk read from a framework export, before it becomes an EnhancedChunk
+type exportedChunk struct {
+	id        string // The framework's ID, only used to resolve relationships
+	parentID  string
+	text      string
+	embedding []float32
+	metadata  map[string]interface{}
+	start     int // Offsets in the exported document, -1 when unknown
+	end       int
+}
+
+// exportedDocument groups the chunks of one source document of a framework export
+type exportedDocument struct {
+	key     string // Source or document ID the chunks share
+	source  string
+	content string // The document's text when the export has it
+	chunks  []*exportedChunk
+}
+
+// ImportFrameworkExport converts a corpus exported by LangChain or LlamaIndex into documents and
+// stores them, so it needn't be parsed and chunked again. Chunks sharing a source become one
+// document, and LlamaIndex parent relationships become parent chunks. Embeddings in the export
+// are stored as they are when every chunk has one of the stored dimension; when none has, or
+// ignoreEmbeddings is set, the chunks are embedded with the configured model.
+func (r *RAGService) ImportFrameworkExport(ctx context.Context, collectionName, format string, export []byte, ignoreEmbeddings bool) ([]ImportResult, error) {
+	startTime := time.Now()
+	if err := r.vectorDB.requireCollection(r.vectorDB.conn, collectionName); err != nil {
+		return nil, err
+	}
+
+	var exported []*exportedDocument
+	var err error
+	switch format {
+	case ExportFormatLangChain:
+		exported, err = parseLangChainExport(export)
+	case ExportFormatLlamaIndex:
+		exported, err = parseLlamaIndexExport(export)
+	default:
+		return nil, fmt.Errorf("invalid import: unknown format '%s'", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid import: %w", err)
+	}
+	if len(exported) == 0 {
+		return nil, fmt.Errorf("invalid import: the export has no documents")
+	}
+
+	// Embeddings of another model can't be stored beside those of the configured one, so an export
+	// is either embedded already or embedded here as a whole
+	embedded, total := 0, 0
+	dimension, err := r.vectorDB.storedDimension(r.vectorDB.conn, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	for d, document := range exported {
+		for c, chunk := range document.chunks {
+			total++
+			if ignoreEmbeddings {
+				chunk.embedding = nil
+			}
+			if len(chunk.embedding) == 0 {
+				continue
+			}
+			embedded++
+			if dimension == 0 {
+				dimension = len(chunk.embedding)
+			}
+			if len(chunk.embedding) != dimension {
+				return nil, fmt.Errorf("invalid import: document %d chunk %d has embedding dimension %d, collection expects %d",
+					d, c, len(chunk.embedding), dimension)
+			}
+		}
+	}
+	if embedded > 0 && embedded < total {
+		return nil, fmt.Errorf("invalid import: %d of %d chunks have embeddings; export all of them, or set ignore_embeddings to embed every chunk", embedded, total)
+	}
+
+	results := make([]ImportResult, 0, len(exported))
+	for _, document := range exported {
+		doc := buildExportedDocument(document, format)
+
+		var toEmbed []*models.EnhancedChunk
+		if embedded == 0 {
+			toEmbed = doc.Chunks
+		}
+		if err := r.storeDocument(ctx, collectionName, doc, toEmbed); err != nil {
+			err = fmt.Errorf("failed to store document %s: %w", doc.Source, err)
+			r.publishIngestion(collectionName, doc.Source, nil, err)
+			return results, err
+		}
+		r.publishIngestion(collectionName, doc.Source, &IngestResult{Status: IngestAdded, DocumentID: doc.ID}, nil)
+
+		results = append(results, ImportResult{
+			DocumentID:     doc.ID,
+			Source:         doc.Source,
+			ChunkCount:     len(doc.Chunks),
+			ChunksEmbedded: len(toEmbed),
+		})
+	}
+
+	log.Printf("Imported %d %s documents with %d chunks into '%s' in %v",
+		len(results), format, total, collectionName, time.Since(startTime))
+
+	return results, nil
+}
+
+// buildExportedDocument converts a document of a framework export into the internal document
+// model. Parents come before their children, which refer to them; a parent outside the document,
+// or in a cycle, is dropped. Without the document's text, its content is the chunk texts joined,
+// and the chunk offsets point into that.
+func buildExportedDocument(exported *exportedDocument, format string) *models.Document {
+	docID := uuid.New().String()
+
+	ids := make(map[string]string, len(exported.chunks))
+	for _, chunk := range exported.chunks {
+		if chunk.id != "" {
+			ids[chunk.id] = uuid.New().String()
+		}
+	}
+	ordered := parentsFirst(exported.chunks)
+
+	content := exported.content
+	knownOffsets := content != ""
+	contentLength := utf8.RuneCountInString(content)
+	for _, chunk := range ordered {
+		if chunk.start < 0 || chunk.end < chunk.start || chunk.end > contentLength {
+			knownOffsets = false
+		}
+	}
+	if !knownOffsets {
+		texts := make([]string, len(ordered))
+		for i, chunk := range ordered {
+			texts[i] = chunk.text
+		}
+		content = strings.Join(texts, "\n\n")
+	}
+
+	chunks := make([]*models.EnhancedChunk, len(ordered))
+	byID := make(map[string]*models.EnhancedChunk, len(ordered))
+	offset := 0
+	for i, exportedChunk := range ordered {
+		id := ids[exportedChunk.id]
+		if id == "" {
+			id = uuid.New().String()
+		}
+		start, end := exportedChunk.start, exportedChunk.end
+		if !knownOffsets {
+			start, end = offset, offset+utf8.RuneCountInString(exportedChunk.text)
+			offset = end + 2
+		}
+
+		chunk := &models.EnhancedChunk{
+			ID:         id,
+			DocumentID: docID,
+			Text:       exportedChunk.text,
+			Embedding:  exportedChunk.embedding,
+			ChunkType:  "imported",
+			StartPos:   start,
+			EndPos:     end,
+			ChunkIndex: i,
+			Metadata:   exportedChunk.metadata,
+		}
+		chunk.Section, chunk.Subsection = exportedSections(exportedChunk.metadata)
+		if parent := byID[ids[exportedChunk.parentID]]; parent != nil {
+			chunk.ParentChunkID = &parent.ID
+			parent.ChunkType = parentChunkType
+			parent.ChildChunkIDs = append(parent.ChildChunkIDs, id)
+		}
+		chunks[i] = chunk
+		byID[id] = chunk
+	}
+
+	metadata := map[string]interface{}{
+		"chunking_strategy": "imported",
+		"chunk_count":       len(chunks),
+		"imported_from":     format,
+	}
+	if exported.key != exported.source {
+		metadata["exported_document_id"] = exported.key
+	}
+
+	return &models.Document{
+		ID:        docID,
+		Content:   content,
+		Chunks:    chunks,
+		Source:    exported.source,
+		Metadata:  metadata,
+		CreatedAt: time.Now(),
+	}
+}
+
+// parentsFirst orders chunks by their offsets in the document when every chunk has them, and
+// otherwise keeps the export's order, then moves every parent before its first child
+func parentsFirst(chunks []*exportedChunk) []*exportedChunk {
+	ordered := append([]*exportedChunk(nil), chunks...)
+	withOffsets := true
+	for _, chunk := range ordered {
+		if chunk.start < 0 {
+			withOffsets = false
+		}
+	}
+	if withOffsets {
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].start < ordered[j].start })
+	}
+
+	byID := make(map[string]*exportedChunk, len(ordered))
+	for _, chunk := range ordered {
+		if chunk.id != "" {
+			byID[chunk.id] = chunk
+		}
+	}
+	result := make([]*exportedChunk, 0, len(ordered))
+	placed := make(map[*exportedChunk]bool, len(ordered))
+	var place func(chunk *exportedChunk, depth int)
+	place = func(chunk *exportedChunk, depth int) {
+		if placed[chunk] || depth > len(ordered) {
+			return
+		}
+		if parent := byID[chunk.parentID]; parent != nil && parent != chunk {
+			place(parent, depth+1)
+		}
+		if !placed[chunk] {
+			placed[chunk] = true
+			result = append(result, chunk)
+		}
+	}
+	for _, chunk := range ordered {
+		place(chunk, 0)
+	}
+	return result
+}
+
+// exportedSections reads the section and subsection of a chunk from the metadata the frameworks'
+// Markdown splitters record: LangChain's "Header 1", "Header 2" and so on, and LlamaIndex's
+// header_path such as "/Setup/Install/"
+func exportedSections(metadata map[string]interface{}) (string, string) {
+	var headers []string
+	for level := 1; level <= 6; level++ {
+		if header, ok := metadata[fmt.Sprintf("Header %d", level)].(string); ok && header != "" {
+			headers = append(headers, header)
+		}
+	}
+	if path, ok := metadata["header_path"].(string); ok && len(headers) == 0 {
+		for _, header := range strings.Split(path, "/") {
+			if header = strings.TrimSpace(header); header != "" {
+				headers = append(headers, header)
+			}
+		}
+	}
+	switch len(headers) {
+	case 0:
+		return "", ""
+	case 1:
+		return headers[0], ""
+	}
+	return headers[0], headers[1]
+}
+
+// langChainDocument is a LangChain Document as written by doc.dict() or model_dump(), or as the
+// kwargs of its dumpd() serialization. Embedding isn't a Document field; exports of a vector store
+// may add it beside the document.
+type langChainDocument struct {
+	PageContent string                 `json:"page_content"`
+	Metadata    map[string]interface{} `json:"metadata"`
+	ID          json.RawMessage        `json:"id"` // A string, or the class path in dumpd() output
+	Embedding   []float32              `json:"embedding"`
+	Kwargs      *langChainDocument     `json:"kwargs"` // Set in dumpd() output
+}
+
+// parseLangChainExport reads LangChain Documents, one JSON object per line or all in a JSON array,
+// grouping them into documents by their "source" metadata. Documents without a source are
+// documents of their own.
+func parseLangChainExport(export []byte) ([]*exportedDocument, error) {
+	var lines []langChainDocument
+	if trimmed := bytes.TrimSpace(export); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &lines); err != nil {
+			return nil, fmt.Errorf("malformed LangChain export: %w", err)
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(export))
+		for {
+			var line langChainDocument
+			err := decoder.Decode(&line)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("malformed LangChain export at document %d: %w", len(lines), err)
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	var documents []*exportedDocument
+	bySource := make(map[string]*exportedDocument)
+	for i, line := range lines {
+		if line.Kwargs != nil {
+			embedding := line.Embedding
+			line = *line.Kwargs
+			if len(line.Embedding) == 0 {
+				line.Embedding = embedding
+			}
+		}
+		if strings.TrimSpace(line.PageContent) == "" {
+			return nil, fmt.Errorf("LangChain document %d has no page_content", i)
+		}
+
+		var id string
+		_ = json.Unmarshal(line.ID, &id)
+		start := -1
+		if index, ok := line.Metadata["start_index"].(float64); ok && index >= 0 {
+			start = int(index)
+		}
+		chunk := &exportedChunk{id: id, text: line.PageContent, embedding: line.Embedding, metadata: line.Metadata, start: start, end: -1}
+		if start >= 0 {
+			chunk.end = start + utf8.RuneCountInString(line.PageContent)
+		}
+
+		source, _ := line.Metadata["source"].(string)
+		document := bySource[source]
+		if document == nil || source == "" {
+			document = &exportedDocument{key: source, source: source}
+			documents = append(documents, document)
+			if source != "" {
+				bySource[source] = document
+			}
+		}
+		document.chunks = append(document.chunks, chunk)
+	}
+	return documents, nil
+}
+
+// llamaIndexNode is a LlamaIndex node as written by node.dict(), model_dump() or a docstore.
+// Older releases name the ID doc_id and the metadata extra_info.
+type llamaIndexNode struct {
+	ID            string                     `json:"id_"`
+	DocID         string                     `json:"doc_id"`
+	ClassName     string                     `json:"class_name"`
+	Text          *string                    `json:"text"`
+	TextResource  *llamaIndexResource        `json:"text_resource"` // Holds the text in newer releases
+	Embedding     []float32                  `json:"embedding"`
+	Metadata      map[string]interface{}     `json:"metadata"`
+	ExtraInfo     map[string]interface{}     `json:"extra_info"`
+	Relationships map[string]json.RawMessage `json:"relationships"`
+	StartCharIdx  *int                       `json:"start_char_idx"`
+	EndCharIdx    *int                       `json:"end_char_idx"`
+}
+
+// llamaIndexResource is the text of a node in newer LlamaIndex releases
+type llamaIndexResource struct {
+	Text string `json:"text"`
+}
+
+// llamaIndexRelated is the node a relationship points at
+type llamaIndexRelated struct {
+	NodeID string `json:"node_id"`
+}
+
+// llamaIndexDocstoreEntry is a node of a persisted docstore, whose __data__ older releases stored
+// as a JSON string
+type llamaIndexDocstoreEntry struct {
+	Data json.RawMessage `json:"__data__"`
+	Type string          `json:"__type__"`
+}
+
+// parseLlamaIndexExport reads LlamaIndex nodes, a JSON array of them or a persisted docstore,
+// grouping them into documents by their source relationship. Document nodes aren't chunks; their
+// text becomes the content of the document their chunks share.
+func parseLlamaIndexExport(export []byte) ([]*exportedDocument, error) {
+	var nodes []llamaIndexNode
+	trimmed := bytes.TrimSpace(export)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &nodes); err != nil {
+			return nil, fmt.Errorf("malformed LlamaIndex export: %w", err)
+		}
+	} else {
+		var docstore map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &docstore); err != nil {
+			return nil, fmt.Errorf("malformed LlamaIndex export: %w", err)
+		}
+		data, ok := docstore["docstore/data"]
+		if !ok {
+			return nil, fmt.Errorf("LlamaIndex export is neither an array of nodes nor a docstore with docstore/data")
+		}
+		var entries map[string]llamaIndexDocstoreEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("malformed LlamaIndex docstore: %w", err)
+		}
+		keys := make([]string, 0, len(entries))
+		for key := range entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			entry := entries[key]
+			raw := entry.Data
+			var encoded string
+			if json.Unmarshal(raw, &encoded) == nil {
+				raw = json.RawMessage(encoded)
+			}
+			var node llamaIndexNode
+			if err := json.Unmarshal(raw, &node); err != nil {
+				return nil, fmt.Errorf("malformed LlamaIndex node %s: %w", key, err)
+			}
+			if node.ID == "" && node.DocID == "" {
+				node.ID = key
+			}
+			if entry.Type == "4" && node.ClassName == "" {
+				node.ClassName = "Document"
+			}
+			nodes = append(nodes, node)
+		}
+	}
+
+	var documents []*exportedDocument
+	byKey := make(map[string]*exportedDocument)
+	contents := make(map[string]string)
+	for i, node := range nodes {
+		id := node.ID
+		if id == "" {
+			id = node.DocID
+		}
+		text := ""
+		if node.Text != nil {
+			text = *node.Text
+		} else if node.TextResource != nil {
+			text = node.TextResource.Text
+		}
+		metadata := node.Metadata
+		if metadata == nil {
+			metadata = node.ExtraInfo
+		}
+
+		if node.ClassName == "Document" {
+			contents[id] = text
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			return nil, fmt.Errorf("LlamaIndex node %d has no text", i)
+		}
+
+		chunk := &exportedChunk{id: id, text: text, embedding: node.Embedding, metadata: metadata, start: -1, end: -1}
+		if node.StartCharIdx != nil && node.EndCharIdx != nil {
+			chunk.start, chunk.end = *node.StartCharIdx, *node.EndCharIdx
+		}
+		var related llamaIndexRelated
+		if json.Unmarshal(node.Relationships[llamaIndexParent], &related) == nil {
+			chunk.parentID = related.NodeID
+		}
+		key := ""
+		if json.Unmarshal(node.Relationships[llamaIndexSource], &related) == nil {
+			key = related.NodeID
+		}
+
+		document := byKey[key]
+		if document == nil || key == "" {
+			document = &exportedDocument{key: key, source: llamaIndexSourceName(metadata, key)}
+			documents = append(documents, document)
+			if key != "" {
+				byKey[key] = document
+			}
+		}
+		document.chunks = append(document.chunks, chunk)
+	}
+
+	for _, document := range documents {
+		document.content = contents[document.key]
+	}
+	return documents, nil
+}
+
+// llamaIndexSourceName names the source of a LlamaIndex document by the metadata its readers
+// record, falling back to the document's ID
+func llamaIndexSourceName(metadata map[string]interface{}, docID string) string {
+	for _, key := range []string{"file_path", "file_name", "source", "url"} {
+		if source, ok := metadata[key].(string); ok && source != "" {
+			return source
+		}
+	}
+	return docID
+}
@@ -0,0 +1,342 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Consistency checks, run in this order
+const (
+	FsckChunksWithoutDocument  = "chunks_without_document"   // Chunks whose document was deleted or never stored
+	FsckDanglingParents        = "dangling_parent_ids"       // Chunks whose parent chunk doesn't exist
+	FsckDanglingDuplicates     = "dangling_duplicates"       // Duplicate chunks whose original doesn't exist
+	FsckEmbeddingsWithoutChunk = "embeddings_without_chunk"  // Embeddings of chunks that don't exist
+	FsckFTSWithoutChunk        = "fts_entries_without_chunk" // Full-text entries of chunks that don't exist
+	FsckChunkCountMismatch     = "chunk_count_mismatch"      // Documents whose chunk_count differs from their stored chunks
+)
+
+// fsckSamples is how many of the IDs a check finds are listed in its report
+const fsckSamples = 10
+
+// FsckCheck reports one consistency check
+type FsckCheck struct {
+	Name     string   `json:"name"`
+	Found    int      `json:"found"`
+	Repaired int64    `json:"repaired,omitempty"`
+	Samples  []string `json:"samples,omitempty"` // IDs of the first chunks or documents found
+}
+
+// FsckReport reports a consistency check of the whole database
+type FsckReport struct {
+	Repair     bool        `json:"repair"`
+	Consistent bool        `json:"consistent"` // No check found anything
+	Checks     []FsckCheck `json:"checks"`
+	DurationMS int64       `json:"duration_ms"`
+}
+
+// fsckCheck finds the inconsistencies of one kind and repairs them
+type fsckCheck struct {
+	name   string
+	find   func(tx *sql.Tx) ([]string, error)
+	repair func(tx *sql.Tx, ids []string, fixes *fsckFixes) (int64, error)
+}
+
+// fsckFixes collects what a repair changed beyond its transaction: the chunks to drop from and
+// add to the ANN indexes once it commits, and whether the keyword index changed
+type fsckFixes struct {
+	removed    []orphanedChunk
+	promoted   map[string][]string // Chunk IDs by tenant
+	ftsChanged bool
+}
+
+// orphanedChunk is a chunk of any tenant whose document doesn't exist
+type orphanedChunk struct {
+	id, tenant, collection, document string
+}
+
+// Fsck verifies the referential integrity of the database, across tenants: chunks must belong to a
+// stored document, parent and duplicate chunk IDs must point at stored chunks, embeddings and
+// full-text entries must belong to stored chunks, and each document's chunk_count must match its
+// chunks. With repair, each check's findings are repaired before the next check runs, all in one
+// transaction; otherwise nothing is changed.
+func (db *VectorDB) Fsck(repair bool) (*FsckReport, error) {
+	start := time.Now()
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	report := &FsckReport{Repair: repair, Consistent: true, Checks: []FsckCheck{}}
+	fixes := &fsckFixes{promoted: make(map[string][]string)}
+	for _, check := range db.fsckChecks() {
+		ids, err := check.find(tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s: %w", check.name, err)
+		}
+		result := FsckCheck{Name: check.name, Found: len(ids), Samples: ids[:min(len(ids), fsckSamples)]}
+		if len(ids) > 0 {
+			report.Consistent = false
+			if repair {
+				if result.Repaired, err = check.repair(tx, ids, fixes); err != nil {
+					return nil, fmt.Errorf("failed to repair %s: %w", check.name, err)
+				}
+			}
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	if repair && !report.Consistent {
+		if fixes.ftsChanged {
+			if err := rebuildTermStats(tx); err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		for _, chunk := range fixes.removed {
+			db.ForTenant(chunk.tenant).unindexEmbeddings(chunk.collection, []string{chunk.id})
+		}
+		for tenant, ids := range fixes.promoted {
+			db.ForTenant(tenant).indexStoredEmbeddings(ids)
+		}
+		log.Printf("Repaired database inconsistencies: %+v", report.Checks)
+	}
+	report.DurationMS = time.Since(start).Milliseconds()
+	return report, nil
+}
+
+// fsckChecks lists the consistency checks in the order they run. Chunks without a document go
+// first, as deleting them can leave parent IDs dangling, and chunk counts last, once chunks are
+// settled.
+func (db *VectorDB) fsckChecks() []fsckCheck {
+	return []fsckCheck{
+		{
+			name: FsckChunksWithoutDocument,
+			find: func(tx *sql.Tx) ([]string, error) {
+				return queryStrings(tx, `SELECT c.id FROM enhanced_chunks c
+					WHERE NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = c.document_id AND d.tenant_id = c.tenant_id)
+					ORDER BY c.id`)
+			},
+			repair: db.deleteOrphanedChunks,
+		},
+		{
+			name: FsckDanglingParents,
+			find: func(tx *sql.Tx) ([]string, error) {
+				return queryStrings(tx, `SELECT id FROM enhanced_chunks
+					WHERE parent_chunk_id IS NOT NULL AND parent_chunk_id != ''
+					AND parent_chunk_id NOT IN (SELECT id FROM enhanced_chunks) ORDER BY id`)
+			},
+			repair: func(tx *sql.Tx, _ []string, _ *fsckFixes) (int64, error) {
+				result, err := tx.Exec(`UPDATE enhanced_chunks SET parent_chunk_id = NULL
+					WHERE parent_chunk_id IS NOT NULL AND parent_chunk_id != ''
+					AND parent_chunk_id NOT IN (SELECT id FROM enhanced_chunks)`)
+				if err != nil {
+					return 0, err
+				}
+				return result.RowsAffected()
+			},
+		},
+		{
+			name: FsckDanglingDuplicates,
+			find: func(tx *sql.Tx) ([]string, error) {
+				return queryStrings(tx, `SELECT id FROM enhanced_chunks
+					WHERE duplicate_of IS NOT NULL AND duplicate_of NOT IN (SELECT id FROM enhanced_chunks)
+					ORDER BY created_at, chunk_index, id`)
+			},
+			repair: db.repairDanglingDuplicates,
+		},
+		{
+			name: FsckEmbeddingsWithoutChunk,
+			find: func(tx *sql.Tx) ([]string, error) {
+				tables, err := existingEmbeddingTables(tx)
+				if err != nil {
+					return nil, err
+				}
+				seen := make(map[string]bool)
+				var ids []string
+				for _, table := range tables {
+					orphans, err := queryStrings(tx, `SELECT chunk_id FROM `+table.name+` WHERE chunk_id NOT IN (SELECT id FROM enhanced_chunks)`)
+					if err != nil {
+						return nil, err
+					}
+					for _, id := range orphans {
+						if !seen[id] {
+							seen[id] = true
+							ids = append(ids, id)
+						}
+					}
+				}
+				return ids, nil
+			},
+			repair: func(tx *sql.Tx, _ []string, _ *fsckFixes) (int64, error) {
+				return deleteOrphanedEmbeddings(tx)
+			},
+		},
+		{
+			name: FsckFTSWithoutChunk,
+			find: func(tx *sql.Tx) ([]string, error) {
+				return queryStrings(tx, `SELECT chunk_id FROM chunk_fts WHERE chunk_id NOT IN (SELECT id FROM enhanced_chunks)`)
+			},
+			repair: func(tx *sql.Tx, _ []string, fixes *fsckFixes) (int64, error) {
+				fixes.ftsChanged = true
+				return deleteOrphanedFTSEntries(tx)
+			},
+		},
+		{
+			name: FsckChunkCountMismatch,
+			find: func(tx *sql.Tx) ([]string, error) {
+				return queryStrings(tx, `SELECT d.id FROM documents d
+					WHERE COALESCE(d.chunk_count, 0) != (SELECT COUNT(*) FROM enhanced_chunks c WHERE c.document_id = d.id AND c.tenant_id = d.tenant_id)
+					ORDER BY d.id`)
+			},
+			repair: func(tx *sql.Tx, _ []string, _ *fsckFixes) (int64, error) {
+				result, err := tx.Exec(`UPDATE documents
+					SET chunk_count = (SELECT COUNT(*) FROM enhanced_chunks c WHERE c.document_id = documents.id AND c.tenant_id = documents.tenant_id)
+					WHERE COALESCE(chunk_count, 0) != (SELECT COUNT(*) FROM enhanced_chunks c WHERE c.document_id = documents.id AND c.tenant_id = documents.tenant_id)`)
+				if err != nil {
+					return 0, err
+				}
+				return result.RowsAffected()
+			},
+		},
+	}
+}
+
+// deleteOrphanedChunks deletes chunks whose document doesn't exist, with their embeddings,
+// full-text entries and knowledge graph, as DeleteDocument would have. Chunks of other documents
+// duplicating them take over their embeddings first.
+func (db *VectorDB) deleteOrphanedChunks(tx *sql.Tx, ids []string, fixes *fsckFixes) (int64, error) {
+	byDocument := make(map[[2]string][]orphanedChunk)
+	var order [][2]string
+	for _, id := range ids {
+		var chunk orphanedChunk
+		err := tx.QueryRow(`SELECT id, tenant_id, collection_name, document_id FROM enhanced_chunks WHERE id = ?`, id).
+			Scan(&chunk.id, &chunk.tenant, &chunk.collection, &chunk.document)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read chunk: %w", err)
+		}
+		key := [2]string{chunk.tenant, chunk.document}
+		if byDocument[key] == nil {
+			order = append(order, key)
+		}
+		byDocument[key] = append(byDocument[key], chunk)
+	}
+
+	var deleted int64
+	for _, key := range order {
+		tenantDB := db.ForTenant(key[0])
+		condition := `document_id = ? AND tenant_id = ?`
+		chunkIDs := make([]string, len(byDocument[key]))
+		for i, chunk := range byDocument[key] {
+			chunkIDs[i] = chunk.id
+		}
+
+		heirs, err := tenantDB.promoteDuplicates(tx, chunkIDs, key[1])
+		if err != nil {
+			return 0, err
+		}
+		fixes.promoted[key[0]] = append(fixes.promoted[key[0]], heirs...)
+
+		chunksOf := `chunk_id IN (SELECT id FROM enhanced_chunks WHERE ` + condition + `)`
+		if err := tenantDB.deleteEmbeddings(tx, chunksOf, key[1], key[0]); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`DELETE FROM chunk_fts WHERE `+chunksOf, key[1], key[0]); err != nil {
+			return 0, fmt.Errorf("failed to delete full-text entries: %w", err)
+		}
+		if err := tenantDB.deleteGraph(tx, chunksOf, key[1], key[0]); err != nil {
+			return 0, err
+		}
+		result, err := tx.Exec(`DELETE FROM enhanced_chunks WHERE `+condition, key[1], key[0])
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete chunks: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+		fixes.removed = append(fixes.removed, byDocument[key]...)
+	}
+	fixes.ftsChanged = true
+	return deleted, nil
+}
+
+// repairDanglingDuplicates re-points duplicate chunks whose original is gone at a stored chunk of
+// the collection with the same content. When there is none, the oldest duplicate becomes the
+// original, indexed for keyword search, and the others point at it; it has no embedding until
+// the collection is re-embedded.
+func (db *VectorDB) repairDanglingDuplicates(tx *sql.Tx, ids []string, fixes *fsckFixes) (int64, error) {
+	// Original chunks taken over, keyed by tenant, collection and former original ID
+	replacements := make(map[[3]string]string)
+	var repaired int64
+	for _, id := range ids {
+		var tenant, collectionName, contentHash, former string
+		err := tx.QueryRow(`SELECT tenant_id, collection_name, COALESCE(content_hash, ''), duplicate_of FROM enhanced_chunks WHERE id = ?`, id).
+			Scan(&tenant, &collectionName, &contentHash, &former)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read chunk: %w", err)
+		}
+		key := [3]string{tenant, collectionName, former}
+
+		original, ok := replacements[key]
+		if !ok && contentHash != "" {
+			err := tx.QueryRow(`SELECT id FROM enhanced_chunks
+				WHERE tenant_id = ? AND collection_name = ? AND content_hash = ? AND duplicate_of IS NULL
+				ORDER BY created_at, chunk_index, id LIMIT 1`, tenant, collectionName, contentHash).Scan(&original)
+			if err != nil && err != sql.ErrNoRows {
+				return 0, fmt.Errorf("failed to look up original chunk: %w", err)
+			}
+			ok = err == nil
+		}
+
+		if ok {
+			if _, err := tx.Exec(`UPDATE enhanced_chunks SET duplicate_of = ? WHERE id = ?`, original, id); err != nil {
+				return 0, fmt.Errorf("failed to re-point duplicate chunk: %w", err)
+			}
+		} else {
+			if _, err := tx.Exec(`UPDATE enhanced_chunks SET duplicate_of = NULL WHERE id = ?`, id); err != nil {
+				return 0, fmt.Errorf("failed to promote duplicate chunk: %w", err)
+			}
+			if _, err := tx.Exec(`INSERT INTO chunk_fts (chunk_id, collection_name, text)
+				SELECT id, collection_name, rag_index(text) FROM enhanced_chunks WHERE id = ?`, id); err != nil {
+				return 0, fmt.Errorf("failed to update full-text index: %w", err)
+			}
+			fixes.ftsChanged = true
+			log.Printf("Chunk %s of collection '%s' lost the embedding it shared and needs re-embedding", id, collectionName)
+			original = id
+		}
+		replacements[key] = original
+		repaired++
+	}
+	return repaired, nil
+}
+
+// deleteOrphanedEmbeddings deletes the embeddings, of every tenant, whose chunk doesn't exist
+func deleteOrphanedEmbeddings(tx *sql.Tx) (int64, error) {
+	tables, err := existingEmbeddingTables(tx)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, table := range tables {
+		result, err := tx.Exec(`DELETE FROM ` + table.name + ` WHERE chunk_id NOT IN (SELECT id FROM enhanced_chunks)`)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete orphaned embeddings from %s: %w", table.name, err)
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// deleteOrphanedFTSEntries deletes the full-text entries, of every tenant, whose chunk doesn't exist.
+// The term statistics must be recomputed afterwards.
+func deleteOrphanedFTSEntries(tx *sql.Tx) (int64, error) {
+	result, err := tx.Exec(`DELETE FROM chunk_fts WHERE chunk_id NOT IN (SELECT id FROM enhanced_chunks)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete orphaned full-text entries: %w", err)
+	}
+	return result.RowsAffected()
+}
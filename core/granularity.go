@@ -0,0 +1,74 @@
+package core
+
+import (
+	"log"
+	"rag-go-app/models"
+)
+
+const (
+	parentChunkType = "parent"
+
+	// smallToBigCandidateRatio widens the candidate pool, since children of one parent collapse into it
+	smallToBigCandidateRatio = 2
+)
+
+// granularityFilter is the filters key Retrieve puts the query's retrieval granularity under.
+// buildFilterConditions only honours models.SmallToBigGranularity there, by leaving parents out of matching.
+const granularityFilter = "granularity"
+
+// substituteParents replaces every matched child chunk by its parent, which takes the rank and
+// score of its best child and lists the children that matched in matched_child_ids. Chunks without
+// a parent are kept as they are; a parent that can no longer be loaded keeps its children.
+func (r *RAGService) substituteParents(chunks []*models.EnhancedChunk, scores []float64) ([]*models.EnhancedChunk, []float64, error) {
+	var parentIDs []string
+	requested := make(map[string]bool)
+	for _, chunk := range chunks {
+		if chunk.ParentChunkID != nil && !requested[*chunk.ParentChunkID] {
+			requested[*chunk.ParentChunkID] = true
+			parentIDs = append(parentIDs, *chunk.ParentChunkID)
+		}
+	}
+	if len(parentIDs) == 0 {
+		return chunks, scores, nil
+	}
+
+	loaded, err := r.vectorDB.getChunksByIDs(parentIDs, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	parents := make(map[string]*models.EnhancedChunk, len(loaded))
+	for _, parent := range loaded {
+		parents[parent.ID] = parent
+	}
+
+	var substituted []*models.EnhancedChunk
+	var substitutedScores []float64
+	seen := make(map[string]bool)
+	matched := make(map[string][]string) // Parent ID to the IDs of its matched children
+	for i, chunk := range chunks {
+		result := chunk
+		if chunk.ParentChunkID != nil && parents[*chunk.ParentChunkID] != nil {
+			result = parents[*chunk.ParentChunkID]
+			matched[result.ID] = append(matched[result.ID], chunk.ID)
+		} else if parents[chunk.ID] != nil {
+			result = parents[chunk.ID]
+		}
+		// A parent may also have been reached through the knowledge graph
+		if !seen[result.ID] {
+			seen[result.ID] = true
+			substituted = append(substituted, result)
+			substitutedScores = append(substitutedScores, scores[i])
+		}
+	}
+
+	for id, children := range matched {
+		parent := parents[id]
+		if parent.Metadata == nil {
+			parent.Metadata = make(map[string]interface{})
+		}
+		parent.Metadata["matched_child_ids"] = children
+	}
+
+	log.Printf("Small-to-big retrieval: %d matched chunks became %d results", len(chunks), len(substituted))
+	return substituted, substitutedScores, nil
+}
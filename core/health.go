@@ -0,0 +1,117 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Dependencies checked by readiness probes
+const (
+	CheckDatabase    = "database"
+	CheckModelServer = "model_server"
+)
+
+// readinessTimeout bounds each readiness check, so a hung dependency fails the probe instead of
+// stalling it past the orchestrator's own timeout
+const readinessTimeout = 3 * time.Second
+
+// DependencyCheck is the outcome of checking one dependency of the server
+type DependencyCheck struct {
+	Name      string `json:"name"`
+	OK        bool   `json:"ok"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Ping checks that the database is open and sqlite-vec is loaded
+func (db *VectorDB) Ping(ctx context.Context) error {
+	var version string
+	if err := db.conn.QueryRowContext(ctx, "SELECT vec_version()").Scan(&version); err != nil {
+		return fmt.Errorf("database unavailable: %w", err)
+	}
+	return nil
+}
+
+// pingServer sends a GET request to the model server. Any response below 500 counts as reachable,
+// since servers differ in which listing endpoints they implement.
+func pingServer(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("model server unreachable: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("model server returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Ping lists the models of the OpenAI-compatible server
+func (p openAIProvider) Ping(ctx context.Context) error {
+	return pingServer(ctx, fmt.Sprintf("%s/models", p.baseURL))
+}
+
+// Ping lists the models pulled into Ollama
+func (p ollamaProvider) Ping(ctx context.Context) error {
+	return pingServer(ctx, p.root()+"/api/tags")
+}
+
+// pingModelServers pings the model servers in failover order; the check passes as soon as one answers
+func pingModelServers(ctx context.Context) error {
+	var errs []error
+	for _, baseURL := range modelServers() {
+		provider, err := providerAt(baseURL)
+		if err != nil {
+			return err
+		}
+		err = provider.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+// CheckDependencies checks the database and the model server concurrently. The server is ready
+// when every check is OK.
+func CheckDependencies(ctx context.Context, db *VectorDB) []DependencyCheck {
+	checks := []struct {
+		name string
+		run  func(context.Context) error
+	}{
+		{CheckDatabase, db.Ping},
+		{CheckModelServer, pingModelServers},
+	}
+
+	results := make([]DependencyCheck, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, name string, run func(context.Context) error) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := run(ctx)
+			results[i] = DependencyCheck{Name: name, OK: err == nil, LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, check.name, check.run)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,294 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultMaxHighlights = 2
+
+	// highlightRelativeFloor drops passages scoring below this fraction of the best passage for
+	// the answer, so chunks that don't support it get no highlights
+	highlightRelativeFloor = 0.8
+)
+
+// highlightPrompt asks the chat model for verbatim quotes supporting an answer
+const highlightPrompt = `Below are a question, its answer and the numbered contexts the answer was written from. For each context, copy word for word the passages that support the answer, at most %d per context, each a sentence or less. Skip contexts that don't support the answer.
+
+Respond with only a JSON object mapping context numbers to arrays of quotes, e.g. {"1": ["first quote", "second quote"], "3": ["another quote"]}.
+
+Question: %s
+
+Answer: %s
+
+%s`
+
+// highlightAnswer finds the passages of each chunk that support the answer, with the requested
+// backend. The llm backend falls back to embedding similarity when the chat model fails; when the
+// embedding server fails too, the answer is returned without highlights. Only an ended ctx is an error.
+func (r *RAGService) highlightAnswer(ctx context.Context, req *models.QueryRequest, answer string, chunks []*models.EnhancedChunk) ([]models.ChunkHighlight, []string, error) {
+	maxPerChunk := req.MaxHighlights
+	if maxPerChunk <= 0 {
+		maxPerChunk = defaultMaxHighlights
+	}
+
+	var degradations []string
+	var spans [][]passageSpan
+	var err error
+	if req.HighlightBackend == models.LLMHighlights {
+		spans, err = r.highlightByQuotes(ctx, req.Query, answer, chunks, maxPerChunk)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("LLM highlighting failed, using embedding similarity: %v", err)
+			degradations = append(degradations, DegradedEmbeddingHighlights)
+		}
+	}
+	if spans == nil && ctx.Err() == nil {
+		spans, err = r.highlightBySimilarity(ctx, answer, chunks, maxPerChunk)
+	}
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+	if err != nil {
+		log.Printf("Highlighting failed, answering without highlights: %v", err)
+		return nil, append(degradations, DegradedHighlightsSkipped), nil
+	}
+
+	documentOffsets := r.locateChunks(chunks)
+	highlights := make([]models.ChunkHighlight, len(chunks))
+	for i, chunk := range chunks {
+		highlights[i] = models.ChunkHighlight{ChunkID: chunk.ID, DocumentID: chunk.DocumentID, Spans: []models.HighlightSpan{}}
+		for _, span := range spans[i] {
+			start := utf8.RuneCountInString(chunk.Text[:span.start])
+			end := start + utf8.RuneCountInString(chunk.Text[span.start:span.end])
+			highlight := models.HighlightSpan{
+				Text:       chunk.Text[span.start:span.end],
+				Score:      span.score,
+				ChunkStart: start,
+				ChunkEnd:   end,
+				StartPos:   -1,
+				EndPos:     -1,
+			}
+			if documentOffsets[i] >= 0 {
+				highlight.StartPos = documentOffsets[i] + start
+				highlight.EndPos = documentOffsets[i] + end
+			}
+			highlights[i].Spans = append(highlights[i].Spans, highlight)
+		}
+	}
+	return highlights, degradations, nil
+}
+
+// passageSpan is a scored passage of a chunk, as byte offsets into its text
+type passageSpan struct {
+	start, end int
+	score      float64
+}
+
+// highlightBySimilarity embeds the answer and every passage of the chunks, and keeps the
+// maxPerChunk passages of each chunk most similar to the answer that come close to the best one
+func (r *RAGService) highlightBySimilarity(ctx context.Context, answer string, chunks []*models.EnhancedChunk, maxPerChunk int) ([][]passageSpan, error) {
+	texts := []string{strings.TrimSpace(citationMarkerPattern.ReplaceAllString(answer, ""))}
+	passages := make([][]passageSpan, len(chunks))
+	for i, chunk := range chunks {
+		for _, span := range passageSpans(chunk.Text, chunkLanguage(chunk)) {
+			passages[i] = append(passages[i], passageSpan{start: span[0], end: span[1]})
+			texts = append(texts, chunk.Text[span[0]:span[1]])
+		}
+	}
+	if len(texts) == 1 {
+		return passages, nil
+	}
+
+	embeddings, err := r.embeddingClient.GetEmbeddings(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed passages: %w", err)
+	}
+
+	best, next := 0.0, 1
+	for i := range passages {
+		for j := range passages[i] {
+			passages[i][j].score = cosineSimilarity(embeddings[0], embeddings[next])
+			best = max(best, passages[i][j].score)
+			next++
+		}
+	}
+
+	for i, candidates := range passages {
+		sort.SliceStable(candidates, func(a, b int) bool { return candidates[a].score > candidates[b].score })
+		var kept []passageSpan
+		for _, candidate := range candidates {
+			if len(kept) == maxPerChunk || candidate.score < best*highlightRelativeFloor {
+				break
+			}
+			kept = append(kept, candidate)
+		}
+		sort.Slice(kept, func(a, b int) bool { return kept[a].start < kept[b].start })
+		passages[i] = kept
+	}
+	return passages, nil
+}
+
+// highlightByQuotes asks the chat model to quote the passages of each chunk that support the
+// answer and locates the quotes in the chunk texts. Quotes that can't be found are dropped.
+func (r *RAGService) highlightByQuotes(ctx context.Context, query, answer string, chunks []*models.EnhancedChunk, maxPerChunk int) ([][]passageSpan, error) {
+	prompt := fmt.Sprintf(highlightPrompt, maxPerChunk, query, answer, r.prepareContext(chunks))
+	response, err := r.llmClient.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in model response")
+	}
+	var quotes map[string][]string
+	if err := json.Unmarshal([]byte(response[start:end+1]), &quotes); err != nil {
+		return nil, fmt.Errorf("invalid highlight JSON in model response: %w", err)
+	}
+
+	spans := make([][]passageSpan, len(chunks))
+	for key, chunkQuotes := range quotes {
+		marker, err := strconv.Atoi(strings.TrimSpace(key))
+		if err != nil || marker < 1 || marker > len(chunks) {
+			continue
+		}
+		text := chunks[marker-1].Text
+		for _, quote := range chunkQuotes {
+			if len(spans[marker-1]) == maxPerChunk {
+				break
+			}
+			loc := findQuote(text, quote)
+			if loc == nil || overlapsSpan(spans[marker-1], loc[0], loc[1]) {
+				continue
+			}
+			spans[marker-1] = append(spans[marker-1], passageSpan{start: loc[0], end: loc[1], score: 1})
+		}
+		sort.Slice(spans[marker-1], func(a, b int) bool { return spans[marker-1][a].start < spans[marker-1][b].start })
+	}
+	return spans, nil
+}
+
+// findQuote returns the byte offsets of quote in text, ignoring case and differences in
+// whitespace, which models rarely copy exactly; nil when it doesn't occur
+func findQuote(text, quote string) []int {
+	words := strings.Fields(strings.Trim(strings.TrimSpace(quote), `"'…`))
+	if len(words) == 0 {
+		return nil
+	}
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	pattern, err := regexp.Compile(`(?i)` + strings.Join(words, `\s+`))
+	if err != nil {
+		return nil
+	}
+	return pattern.FindStringIndex(text)
+}
+
+// overlapsSpan reports whether [start, end) overlaps one of spans
+func overlapsSpan(spans []passageSpan, start, end int) bool {
+	for _, span := range spans {
+		if start < span.end && span.start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// passageSpans splits text into sentences, and sentences running over several lines into their
+// lines, since lists and headings often have no sentence punctuation
+func passageSpans(text, language string) [][2]int {
+	var spans [][2]int
+	for _, sentence := range sentenceSpans(text, language) {
+		start := sentence[0]
+		for _, line := range strings.SplitAfter(text[sentence[0]:sentence[1]], "\n") {
+			if trimmed := strings.TrimSpace(line); trimmed != "" {
+				offset := start + strings.Index(line, trimmed)
+				spans = append(spans, [2]int{offset, offset + len(trimmed)})
+			}
+			start += len(line)
+		}
+	}
+	return spans
+}
+
+// locateChunks returns the character offset of each chunk's text in its document, or -1 when the
+// document content doesn't contain it. The recorded start_pos is trusted when the text is there;
+// otherwise the first occurrence is used, as for chunks corrected or imported since ingestion.
+func (r *RAGService) locateChunks(chunks []*models.EnhancedChunk) []int {
+	documentIDs := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		documentIDs = append(documentIDs, chunk.DocumentID)
+	}
+	contents, err := r.vectorDB.GetDocumentContents(documentIDs)
+	if err != nil {
+		log.Printf("Failed to look up documents for highlighting: %v", err)
+	}
+
+	offsets := make([]int, len(chunks))
+	for i, chunk := range chunks {
+		offsets[i] = -1
+		content := contents[chunk.DocumentID]
+		if chunk.Text == "" {
+			continue
+		}
+		for from, runes := 0, 0; ; {
+			index := strings.Index(content[from:], chunk.Text)
+			if index < 0 {
+				break
+			}
+			runes += utf8.RuneCountInString(content[from : from+index])
+			if offsets[i] < 0 || runes == chunk.StartPos {
+				offsets[i] = runes
+			}
+			if runes >= chunk.StartPos {
+				break
+			}
+			from += index
+			_, size := utf8.DecodeRuneInString(content[from:])
+			from += size
+			runes++
+		}
+	}
+	return offsets
+}
+
+// GetDocumentContents returns the stored content of the given documents, keyed by ID
+func (db *VectorDB) GetDocumentContents(documentIDs []string) (map[string]string, error) {
+	contents := make(map[string]string, len(documentIDs))
+	if len(documentIDs) == 0 {
+		return contents, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(documentIDs)), ",")
+	args := make([]interface{}, 0, len(documentIDs)+1)
+	for _, id := range documentIDs {
+		args = append(args, id)
+	}
+	args = append(args, db.tenant)
+
+	rows, err := db.conn.Query(`SELECT id, rag_open(content) FROM documents WHERE id IN (`+placeholders+`) AND tenant_id = ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up document contents: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			return nil, fmt.Errorf("failed to scan document content: %w", err)
+		}
+		contents[id] = content
+	}
+	return contents, nil
+}
@@ -0,0 +1,305 @@
+package core
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// hnswGraph is a hierarchical navigable small world graph over float32 vectors, compared by L2
+// distance like the embedding tables. Nodes are never unlinked: a removed or replaced vector is marked
+// deleted, keeps routing searches and is left out of their results until the graph is rebuilt.
+// It is not safe for concurrent use.
+type hnswGraph struct {
+	m, m0          int // Links per node on the upper layers and on layer 0
+	efConstruction int
+	levelFactor    float64
+	rng            *rand.Rand
+
+	nodes     []hnswNode
+	ids       map[string]int32 // Live node of each chunk ID
+	entry     int32            // Node every search starts from, on the top layer; -1 while empty
+	maxLevel  int
+	dimension int
+	deleted   int
+}
+
+type hnswNode struct {
+	id      string
+	vector  []float32
+	links   [][]int32 // Neighbours on each layer the node is on, layer 0 first
+	deleted bool
+}
+
+// hnswCandidate is a node with its distance to the vector being searched for
+type hnswCandidate struct {
+	node     int32
+	distance float32
+}
+
+func newHNSWGraph(m, efConstruction int) *hnswGraph {
+	return &hnswGraph{
+		m:              m,
+		m0:             2 * m,
+		efConstruction: efConstruction,
+		levelFactor:    1 / math.Log(float64(m)),
+		rng:            rand.New(rand.NewSource(1)),
+		ids:            make(map[string]int32),
+		entry:          -1,
+	}
+}
+
+// len returns the number of live vectors
+func (g *hnswGraph) len() int {
+	return len(g.ids)
+}
+
+// vector returns the live vector of a chunk
+func (g *hnswGraph) vector(id string) ([]float32, bool) {
+	n, ok := g.ids[id]
+	if !ok {
+		return nil, false
+	}
+	return g.nodes[n].vector, true
+}
+
+// remove marks the vector of a chunk deleted
+func (g *hnswGraph) remove(id string) {
+	if n, ok := g.ids[id]; ok {
+		g.nodes[n].deleted = true
+		delete(g.ids, id)
+		g.deleted++
+	}
+}
+
+// add links the vector of a chunk into the graph, replacing the one it had. Vectors of another
+// dimension than the first one added are ignored.
+func (g *hnswGraph) add(id string, vector []float32) {
+	if g.dimension == 0 {
+		g.dimension = len(vector)
+	}
+	if len(vector) != g.dimension {
+		return
+	}
+	g.remove(id)
+
+	level := int(-math.Log(1-g.rng.Float64()) * g.levelFactor)
+	n := int32(len(g.nodes))
+	g.nodes = append(g.nodes, hnswNode{id: id, vector: vector, links: make([][]int32, level+1)})
+	g.ids[id] = n
+	if g.entry < 0 {
+		g.entry, g.maxLevel = n, level
+		return
+	}
+
+	ep := hnswCandidate{g.entry, l2Squared(vector, g.nodes[g.entry].vector)}
+	for layer := g.maxLevel; layer > level; layer-- {
+		ep = g.greedy(vector, ep, layer)
+	}
+	entries := []hnswCandidate{ep}
+	for layer := min(level, g.maxLevel); layer >= 0; layer-- {
+		found := g.searchLayer(vector, entries, g.efConstruction, layer)
+		neighbours := g.selectNeighbours(found, g.m)
+		links := make([]int32, len(neighbours))
+		for i, neighbour := range neighbours {
+			links[i] = neighbour.node
+		}
+		g.nodes[n].links[layer] = links
+		for _, neighbour := range neighbours {
+			g.link(neighbour.node, n, neighbour.distance, layer)
+		}
+		entries = found
+	}
+	if level > g.maxLevel {
+		g.entry, g.maxLevel = n, level
+	}
+}
+
+// search returns the k live nodes nearest to vector, nearest first, considering at least ef
+// candidates on the bottom layer
+func (g *hnswGraph) search(vector []float32, k, ef int) []hnswCandidate {
+	if g.entry < 0 || len(vector) != g.dimension || k <= 0 {
+		return nil
+	}
+	ef = max(ef, k)
+	if g.deleted > 0 {
+		// Deleted nodes take up candidate slots, so make room for their share
+		ef += ef * g.deleted / max(len(g.ids), 1)
+	}
+
+	ep := hnswCandidate{g.entry, l2Squared(vector, g.nodes[g.entry].vector)}
+	for layer := g.maxLevel; layer > 0; layer-- {
+		ep = g.greedy(vector, ep, layer)
+	}
+	found := g.searchLayer(vector, []hnswCandidate{ep}, ef, 0)
+
+	results := found[:0]
+	for _, candidate := range found {
+		if !g.nodes[candidate.node].deleted {
+			results = append(results, candidate)
+		}
+		if len(results) == k {
+			break
+		}
+	}
+	return results
+}
+
+// greedy walks a layer from ep to the node nearest vector, moving while a neighbour is nearer
+func (g *hnswGraph) greedy(vector []float32, ep hnswCandidate, layer int) hnswCandidate {
+	for changed := true; changed; {
+		changed = false
+		for _, neighbour := range g.nodes[ep.node].links[layer] {
+			if d := l2Squared(vector, g.nodes[neighbour].vector); d < ep.distance {
+				ep, changed = hnswCandidate{neighbour, d}, true
+			}
+		}
+	}
+	return ep
+}
+
+// searchLayer returns the ef nodes of a layer nearest to vector that a best-first walk from the
+// entries reaches, nearest first. Deleted nodes are included, since they still route the walk.
+func (g *hnswGraph) searchLayer(vector []float32, entries []hnswCandidate, ef, layer int) []hnswCandidate {
+	visited := make(map[int32]bool, ef*4)
+	candidates := &hnswHeap{}               // Nearest first
+	results := &hnswHeap{less: hnswFarther} // Farthest first, so it can be evicted
+	for _, entry := range entries {
+		visited[entry.node] = true
+		heap.Push(candidates, entry)
+		heap.Push(results, entry)
+	}
+	for results.Len() > ef {
+		heap.Pop(results)
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(hnswCandidate)
+		if current.distance > results.items[0].distance && results.Len() >= ef {
+			break
+		}
+		if layer >= len(g.nodes[current.node].links) {
+			continue
+		}
+		for _, neighbour := range g.nodes[current.node].links[layer] {
+			if visited[neighbour] {
+				continue
+			}
+			visited[neighbour] = true
+			d := l2Squared(vector, g.nodes[neighbour].vector)
+			if results.Len() < ef || d < results.items[0].distance {
+				heap.Push(candidates, hnswCandidate{neighbour, d})
+				heap.Push(results, hnswCandidate{neighbour, d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	found := results.items
+	sort.Slice(found, func(i, j int) bool { return found[i].distance < found[j].distance })
+	return found
+}
+
+// selectNeighbours picks up to m of the candidates, sorted nearest first, preferring ones that
+// are nearer to the base vector than to any neighbour already picked, so links spread out in
+// every direction instead of crowding one cluster. Candidates passed over fill any places left.
+func (g *hnswGraph) selectNeighbours(candidates []hnswCandidate, m int) []hnswCandidate {
+	if len(candidates) <= m {
+		return append([]hnswCandidate(nil), candidates...)
+	}
+	selected := make([]hnswCandidate, 0, m)
+	var skipped []hnswCandidate
+	for _, candidate := range candidates {
+		if len(selected) == m {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if l2Squared(g.nodes[candidate.node].vector, g.nodes[s.node].vector) < candidate.distance {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, candidate)
+		} else {
+			skipped = append(skipped, candidate)
+		}
+	}
+	for _, candidate := range skipped {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, candidate)
+	}
+	return selected
+}
+
+// link adds a link from node to target on a layer, pruning the node's links to the layer's limit
+func (g *hnswGraph) link(node, target int32, distance float32, layer int) {
+	links := append(g.nodes[node].links[layer], target)
+	limit := g.m
+	if layer == 0 {
+		limit = g.m0
+	}
+	if len(links) <= limit {
+		g.nodes[node].links[layer] = links
+		return
+	}
+
+	base := g.nodes[node].vector
+	candidates := make([]hnswCandidate, len(links))
+	for i, link := range links {
+		candidates[i] = hnswCandidate{link, l2Squared(base, g.nodes[link].vector)}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+	kept := g.selectNeighbours(candidates, limit)
+	links = links[:0]
+	for _, candidate := range kept {
+		links = append(links, candidate.node)
+	}
+	g.nodes[node].links[layer] = links
+}
+
+// l2Squared returns the squared Euclidean distance between two vectors of the same dimension
+func l2Squared(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
+
+// hnswFarther orders candidates farthest first
+func hnswFarther(a, b hnswCandidate) bool {
+	return a.distance > b.distance
+}
+
+// hnswHeap is a heap of candidates, nearest first unless less says otherwise
+type hnswHeap struct {
+	items []hnswCandidate
+	less  func(a, b hnswCandidate) bool
+}
+
+func (h *hnswHeap) Len() int { return len(h.items) }
+
+func (h *hnswHeap) Less(i, j int) bool {
+	if h.less != nil {
+		return h.less(h.items[i], h.items[j])
+	}
+	return h.items[i].distance < h.items[j].distance
+}
+
+func (h *hnswHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *hnswHeap) Push(x interface{}) { h.items = append(h.items, x.(hnswCandidate)) }
+
+func (h *hnswHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
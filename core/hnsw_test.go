@@ -0,0 +1,148 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// randomVectors returns n vectors of the given dimension, reproducibly
+func randomVectors(rng *rand.Rand, n, dimension int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dimension)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+// bruteForceNearest returns the IDs of the k live vectors nearest to query
+func bruteForceNearest(vectors map[string][]float32, query []float32, k int) []string {
+	ids := make([]string, 0, len(vectors))
+	for id := range vectors {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return l2Squared(query, vectors[ids[i]]) < l2Squared(query, vectors[ids[j]])
+	})
+	return ids[:min(k, len(ids))]
+}
+
+// hnswRecall returns the share of the exact k nearest neighbours the graph finds, averaged over the
+// queries, and fails the test if a result isn't live or results aren't nearest first
+func hnswRecall(t *testing.T, g *hnswGraph, vectors map[string][]float32, queries [][]float32, k, ef int) float64 {
+	t.Helper()
+	found, total := 0, 0
+	for _, query := range queries {
+		want := make(map[string]bool)
+		for _, id := range bruteForceNearest(vectors, query, k) {
+			want[id] = true
+		}
+		results := g.search(query, k, ef)
+		if len(results) != len(want) {
+			t.Fatalf("search returned %d results, want %d", len(results), len(want))
+		}
+		for i, result := range results {
+			id := g.nodes[result.node].id
+			if _, live := vectors[id]; !live || g.nodes[result.node].deleted {
+				t.Fatalf("search returned %s, which was removed or replaced", id)
+			}
+			if i > 0 && result.distance < results[i-1].distance {
+				t.Fatalf("results are not nearest first at %d", i)
+			}
+			if want[id] {
+				found++
+			}
+		}
+		total += len(want)
+	}
+	return float64(found) / float64(total)
+}
+
+func TestHNSWRecallMatchesBruteForce(t *testing.T) {
+	const (
+		count     = 2000
+		dimension = 32
+		k         = 10
+	)
+	rng := rand.New(rand.NewSource(7))
+	g := newHNSWGraph(16, 100)
+	vectors := make(map[string][]float32, count)
+	for i, vector := range randomVectors(rng, count, dimension) {
+		id := fmt.Sprintf("chunk-%d", i)
+		vectors[id] = vector
+		g.add(id, vector)
+	}
+	queries := randomVectors(rng, 50, dimension)
+
+	tests := []struct {
+		ef         int
+		wantRecall float64
+	}{
+		{k, 0.7},
+		{64, 0.95},
+		{400, 0.99},
+	}
+	for _, tt := range tests {
+		if recall := hnswRecall(t, g, vectors, queries, k, tt.ef); recall < tt.wantRecall {
+			t.Errorf("recall@%d with ef %d = %.3f, want at least %.2f", k, tt.ef, recall, tt.wantRecall)
+		}
+	}
+
+	// Removed and replaced vectors keep routing searches but never appear in their results
+	for i := 0; i < count; i += 4 {
+		id := fmt.Sprintf("chunk-%d", i)
+		g.remove(id)
+		delete(vectors, id)
+	}
+	for i, vector := range randomVectors(rng, count/10, dimension) {
+		id := fmt.Sprintf("chunk-%d", 10*i+1)
+		vectors[id] = vector
+		g.add(id, vector)
+	}
+	if g.len() != len(vectors) {
+		t.Fatalf("graph holds %d live vectors, want %d", g.len(), len(vectors))
+	}
+	if recall := hnswRecall(t, g, vectors, queries, k, 64); recall < 0.95 {
+		t.Errorf("recall@%d after removals and replacements = %.3f, want at least 0.95", k, recall)
+	}
+
+	// An exact copy of a stored vector is its own nearest neighbour
+	for _, id := range []string{"chunk-1", "chunk-2", "chunk-1999"} {
+		results := g.search(vectors[id], 1, 64)
+		if len(results) != 1 || g.nodes[results[0].node].id != id || results[0].distance != 0 {
+			t.Errorf("search for the vector of %s did not find it first", id)
+		}
+	}
+}
+
+func TestHNSWSearchEdgeCases(t *testing.T) {
+	g := newHNSWGraph(16, 100)
+	if results := g.search([]float32{1, 0}, 3, 10); results != nil {
+		t.Errorf("search of an empty graph = %v, want none", results)
+	}
+
+	g.add("a", []float32{0, 0})
+	g.add("b", []float32{1, 0})
+	g.add("wrong dimension", []float32{1, 0, 0})
+	if g.len() != 2 {
+		t.Errorf("len() = %d, want 2: a vector of another dimension was added", g.len())
+	}
+	if results := g.search([]float32{1, 0, 0}, 3, 10); results != nil {
+		t.Errorf("search with another dimension = %v, want none", results)
+	}
+	if results := g.search([]float32{1, 0}, 0, 10); results != nil {
+		t.Errorf("search for 0 results = %v, want none", results)
+	}
+	if results := g.search([]float32{1, 0}, 5, 1); len(results) != 2 || g.nodes[results[0].node].id != "b" {
+		t.Errorf("search for more results than vectors = %v, want b then a", results)
+	}
+
+	g.remove("b")
+	if results := g.search([]float32{1, 0}, 5, 10); len(results) != 1 || g.nodes[results[0].node].id != "a" {
+		t.Errorf("search after removing b = %v, want only a", results)
+	}
+}
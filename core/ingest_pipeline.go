@@ -0,0 +1,231 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"sync"
+)
+
+// embeddedBatch is one batch of chunks leaving the embedding stage of the ingest pipeline
+type embeddedBatch struct {
+	chunks []*models.EnhancedChunk
+	cache  map[string][]float32 // New embedding cache entries, stored after the write stage
+	err    error
+}
+
+// storeDocument writes a processed document while the chunks in toEmbed are being embedded.
+// Chunks are embedded in adaptive batches, up to EmbeddingConcurrency at a time, and each batch is
+// written as soon as it arrives while later ones are still in flight. The document, its chunks and
+// all embeddings share one transaction, so a failed batch leaves nothing behind.
+func (r *RAGService) storeDocument(ctx context.Context, collectionName string, doc *models.Document, toEmbed []*models.EnhancedChunk) error {
+	// Embeddings carried over from a previous version are written first. The embedding table must
+	// match the model's dimension before the transaction opens: a carried over embedding tells us,
+	// otherwise the first batch does.
+	var pending []embeddedBatch
+	dimension := 0
+	var reused []*models.EnhancedChunk
+	for _, chunk := range doc.Chunks {
+		if len(chunk.Embedding) > 0 {
+			reused = append(reused, chunk)
+			dimension = len(chunk.Embedding)
+		}
+	}
+	if len(reused) > 0 {
+		pending = append(pending, embeddedBatch{chunks: reused})
+	}
+
+	results, stop := r.embedChunksAsync(ctx, toEmbed)
+	defer stop()
+
+	cacheEntries := make(map[string][]float32)
+	defer func() { r.embeddingClient.CacheEmbeddings(cacheEntries) }()
+
+	if dimension == 0 && len(toEmbed) > 0 {
+		first := <-results
+		if first.err != nil {
+			return first.err
+		}
+		pending = append(pending, first)
+		dimension = len(first.chunks[0].Embedding)
+	}
+
+	next := func() ([]*models.EnhancedChunk, error) {
+		var batch embeddedBatch
+		if len(pending) > 0 {
+			batch, pending = pending[0], pending[1:]
+		} else {
+			var ok bool
+			if batch, ok = <-results; !ok {
+				return nil, nil
+			}
+		}
+		if batch.err != nil {
+			return nil, batch.err
+		}
+		for key, embedding := range batch.cache {
+			cacheEntries[key] = embedding
+		}
+		return batch.chunks, nil
+	}
+
+	return r.vectorDB.addDocumentPipelined(ctx, collectionName, doc, dimension, next)
+}
+
+// embedChunksAsync embeds chunks in adaptive batches on background goroutines and delivers each
+// batch on the returned channel as it completes, closing it after the last one. Calling stop, or
+// cancelling ctx, keeps batches that have not started yet from being sent and aborts those in flight.
+func (r *RAGService) embedChunksAsync(ctx context.Context, chunks []*models.EnhancedChunk) (<-chan embeddedBatch, func()) {
+	ctx, splits := withEmbeddingSplits(ctx)
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = embeddingText(chunk)
+	}
+	batches := createAdaptiveBatches(texts)
+
+	concurrency := config.AppConfig.EmbeddingConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	// Buffered for every batch so workers never block on a reader that gave up
+	results := make(chan embeddedBatch, len(batches))
+	ctx, stop := context.WithCancel(ctx)
+
+	if len(batches) > 0 {
+		log.Printf("Embedding %d chunks in %d batches (concurrency %d)", len(chunks), len(batches), min(concurrency, len(batches)))
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+	for batchIndex, batch := range batches {
+		wg.Add(1)
+		go func(batchIndex int, batch EmbeddingBatch) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			batchChunks := chunks[batch.StartIndex : batch.StartIndex+len(batch.Texts)]
+			embeddings, cache, err := r.embeddingClient.GetEmbeddingsDeferringCache(ctx, batch.Texts)
+			if err == nil && len(embeddings) != len(batchChunks) {
+				err = fmt.Errorf("expected %d embeddings, got %d", len(batchChunks), len(embeddings))
+			}
+			if err != nil {
+				results <- embeddedBatch{err: fmt.Errorf("failed to generate embeddings for batch %d: %w", batchIndex, err)}
+				return
+			}
+
+			for i, embedding := range embeddings {
+				batchChunks[i].Embedding = embedding
+				if pieces := splits.of(batch.Texts[i]); pieces > 0 {
+					if batchChunks[i].Metadata == nil {
+						batchChunks[i].Metadata = make(map[string]interface{})
+					}
+					batchChunks[i].Metadata[embeddingPiecesKey] = pieces
+				}
+			}
+			results <- embeddedBatch{chunks: batchChunks, cache: cache}
+		}(batchIndex, batch)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results, stop
+}
+
+// addDocumentPipelined stores a document, its chunks and their embeddings in one transaction.
+// Embedded chunks are pulled from next, which returns nil once there are no more, so they can be
+// written while later ones are still being computed. dimension is 0 when the document stores no
+// embeddings at all.
+func (db *VectorDB) addDocumentPipelined(ctx context.Context, collectionName string, doc *models.Document, dimension int, next func() ([]*models.EnhancedChunk, error)) error {
+	var quantization *models.QuantizationConfig
+	if dimension > 0 {
+		var err error
+		if quantization, err = db.ensureEmbeddingTables(collectionName, dimension); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := db.insertDocument(tx, collectionName, doc); err != nil {
+		return err
+	}
+
+	var stored []*models.EnhancedChunk
+	for {
+		chunks, err := next()
+		if err != nil {
+			return err
+		}
+		if chunks == nil {
+			break
+		}
+		if err := db.insertEmbeddings(tx, collectionName, quantization, chunks, dimension); err != nil {
+			return err
+		}
+		stored = append(stored, chunks...)
+	}
+	if err := db.storeDocumentEmbedding(tx, doc); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.indexEmbeddings(collectionName, quantization, stored)
+	return nil
+}
+
+// addDocuments stores documents, their chunks and their embeddings in one transaction. dimension
+// is 0 when none of them stores embeddings.
+func (db *VectorDB) addDocuments(ctx context.Context, collectionName string, docs []*models.Document, dimension int) error {
+	var quantization *models.QuantizationConfig
+	if dimension > 0 {
+		var err error
+		if quantization, err = db.ensureEmbeddingTables(collectionName, dimension); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, doc := range docs {
+		if err := db.insertDocument(tx, collectionName, doc); err != nil {
+			return err
+		}
+		if err := db.insertEmbeddings(tx, collectionName, quantization, doc.Chunks, dimension); err != nil {
+			return err
+		}
+		if err := db.storeDocumentEmbedding(tx, doc); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		db.indexEmbeddings(collectionName, quantization, doc.Chunks)
+	}
+	return nil
+}
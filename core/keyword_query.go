@@ -0,0 +1,294 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	fuzzyMinSimilarity = 0.3 // Trigram similarity a vocabulary term needs to stand in for a fuzzy term
+	maxFuzzyVariants   = 5   // Most vocabulary terms a fuzzy term is expanded to
+)
+
+// keywordClauseKind is how a clause of a keyword query matches chunk text
+type keywordClauseKind int
+
+const (
+	clauseTerm   keywordClauseKind = iota // A word of the text
+	clausePhrase                          // Words the text contains consecutively
+	clausePrefix                          // A word of the text starting with the clause
+	clauseFuzzy                           // A word of the text spelled like the clause
+)
+
+// keywordClause is one term, phrase, prefix or fuzzy term of a keyword query
+type keywordClause struct {
+	kind     keywordClauseKind
+	text     string             // Lowercase term or prefix, or the words of a phrase separated by spaces
+	variants map[string]float64 // Fuzzy clauses: indexed terms and their similarity to text
+}
+
+// splitSearchWords splits text into lowercase words of letters and digits, as they are indexed
+func splitSearchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// parseKeywordQuery reads the small query syntax of keyword search. Text in double quotes is an
+// exact phrase, a word ending in "*" matches the words starting with it and a word ending in "~"
+// also matches indexed words spelled similarly. Other words are plain terms. Words shorter than
+// two characters are ignored, and repeated clauses are kept once.
+func parseKeywordQuery(query string) []keywordClause {
+	var clauses []keywordClause
+	type clauseKey struct {
+		kind keywordClauseKind
+		text string
+	}
+	seen := make(map[clauseKey]bool)
+	add := func(clause keywordClause) {
+		key := clauseKey{clause.kind, clause.text}
+		if utf8.RuneCountInString(clause.text) < 2 || seen[key] {
+			return
+		}
+		seen[key] = true
+		clauses = append(clauses, clause)
+	}
+
+	for i, part := range strings.Split(query, `"`) {
+		// Odd parts were quoted; an unterminated quote runs to the end of the query
+		if i%2 == 1 {
+			words := splitSearchWords(part)
+			if len(words) == 1 {
+				add(keywordClause{kind: clauseTerm, text: words[0]})
+			} else if len(words) > 1 {
+				add(keywordClause{kind: clausePhrase, text: strings.Join(words, " ")})
+			}
+			continue
+		}
+
+		for _, field := range strings.Fields(part) {
+			kind := clauseTerm
+			switch {
+			case strings.HasSuffix(field, "*"):
+				kind = clausePrefix
+			case strings.HasSuffix(field, "~"):
+				kind = clauseFuzzy
+			}
+			// The operator applies to the last word of a field such as "e-mail*"
+			words := splitSearchWords(field)
+			for j, word := range words {
+				if j == len(words)-1 {
+					add(keywordClause{kind: kind, text: word})
+				} else {
+					add(keywordClause{kind: clauseTerm, text: word})
+				}
+			}
+		}
+	}
+	return clauses
+}
+
+// keywordMatchExpression returns the FTS MATCH expression finding the chunks that match any
+// clause, or "" when no clause can match. Words are written as the index stores them.
+func keywordMatchExpression(clauses []keywordClause) string {
+	var parts []string
+	for _, clause := range clauses {
+		switch clause.kind {
+		case clauseTerm:
+			parts = append(parts, "text:"+indexTerm(clause.text))
+		case clausePhrase:
+			// FTS4 can't restrict phrases to a column; text is the only indexed one anyway
+			words := strings.Fields(clause.text)
+			for i, word := range words {
+				words[i] = indexTerm(word)
+			}
+			parts = append(parts, `"`+strings.Join(words, " ")+`"`)
+		case clausePrefix:
+			parts = append(parts, "text:"+clause.text+"*")
+		case clauseFuzzy:
+			variants := make([]string, 0, len(clause.variants))
+			for variant := range clause.variants {
+				variants = append(variants, variant)
+			}
+			sort.Strings(variants)
+			for _, variant := range variants {
+				parts = append(parts, "text:"+variant)
+			}
+		}
+	}
+	return strings.Join(parts, " OR ")
+}
+
+// scoreKeywordClauses scores text by the share of the clauses' weight it matches, each clause
+// weighing the same when weights is nil. A fuzzy clause counts for the similarity of its best
+// variant in the text, so misspellings rank below exact matches.
+func scoreKeywordClauses(clauses []keywordClause, weights []float64, text string) float64 {
+	words := splitSearchWords(text)
+	joined := " " + strings.Join(words, " ") + " "
+
+	matched, total := 0.0, 0.0
+	for i, clause := range clauses {
+		weight := 1.0
+		if weights != nil {
+			weight = weights[i]
+		}
+		total += weight
+		switch clause.kind {
+		case clauseTerm, clausePhrase:
+			// Whole words only, as the index matches them
+			if strings.Contains(joined, " "+clause.text+" ") {
+				matched += weight
+			}
+		case clausePrefix:
+			if strings.Contains(joined, " "+clause.text) {
+				matched += weight
+			}
+		case clauseFuzzy:
+			best := 0.0
+			for _, word := range words {
+				if similarity, ok := clause.variants[word]; ok && similarity > best {
+					best = similarity
+				}
+			}
+			matched += weight * best
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return matched / total
+}
+
+// keywordClauseWeights weighs the clauses of a keyword query by the inverse document frequency of
+// their words in a collection, so a rare term counts for more than one found in most chunks. A
+// phrase weighs as much as its words together and a fuzzy clause as its closest variant. A prefix
+// matches words that can't be known in advance, so it gets the average weight of the other clauses.
+func (db *VectorDB) keywordClauseWeights(collectionName string, clauses []keywordClause) ([]float64, error) {
+	var words []string
+	for _, clause := range clauses {
+		switch clause.kind {
+		case clauseTerm:
+			words = append(words, clause.text)
+		case clausePhrase:
+			words = append(words, strings.Fields(clause.text)...)
+		case clauseFuzzy:
+			for variant := range clause.variants {
+				words = append(words, variant)
+			}
+		}
+	}
+	frequencies, err := db.TermFrequencies(collectionName, words)
+	if err != nil {
+		return nil, err
+	}
+
+	weights := make([]float64, len(clauses))
+	known, sum := 0, 0.0
+	for i, clause := range clauses {
+		switch clause.kind {
+		case clauseTerm:
+			weights[i] = frequencies.IDF(clause.text)
+		case clausePhrase:
+			for _, word := range strings.Fields(clause.text) {
+				weights[i] += frequencies.IDF(word)
+			}
+		case clauseFuzzy:
+			closest := -1.0
+			for variant, similarity := range clause.variants {
+				if similarity > closest || (similarity == closest && frequencies.IDF(variant) > weights[i]) {
+					closest, weights[i] = similarity, frequencies.IDF(variant)
+				}
+			}
+		default:
+			continue
+		}
+		known++
+		sum += weights[i]
+	}
+	for i, clause := range clauses {
+		if clause.kind == clausePrefix {
+			weights[i] = 1
+			if known > 0 {
+				weights[i] = sum / float64(known)
+			}
+		}
+	}
+	return weights, nil
+}
+
+// fuzzyVariants returns up to maxFuzzyVariants terms of the full-text index whose trigram
+// similarity to term is at least fuzzyMinSimilarity, with their similarity. The term itself is
+// included when it is indexed.
+func (db *VectorDB) fuzzyVariants(ctx context.Context, term string) (map[string]float64, error) {
+	// Words with more than a third of their length added or removed are not similar enough
+	length := len([]rune(term))
+	slack := length/3 + 1
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT term FROM chunk_fts_terms
+		WHERE col = '*' AND length(term) BETWEEN ? AND ?`, length-slack, length+slack)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexed terms: %w", err)
+	}
+	defer rows.Close()
+
+	type candidate struct {
+		term       string
+		similarity float64
+	}
+	var candidates []candidate
+	grams := trigrams(term)
+	for rows.Next() {
+		var indexed string
+		if err := rows.Scan(&indexed); err != nil {
+			return nil, fmt.Errorf("failed to read indexed terms: %w", err)
+		}
+		if similarity := trigramSimilarity(grams, trigrams(indexed)); similarity >= fuzzyMinSimilarity {
+			candidates = append(candidates, candidate{term: indexed, similarity: similarity})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read indexed terms: %w", err)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].similarity > candidates[j].similarity
+	})
+	if len(candidates) > maxFuzzyVariants {
+		candidates = candidates[:maxFuzzyVariants]
+	}
+	variants := make(map[string]float64, len(candidates))
+	for _, c := range candidates {
+		variants[c.term] = c.similarity
+	}
+	return variants, nil
+}
+
+// trigrams returns the set of three-character sequences of a word padded with two leading spaces
+// and one trailing space, so the start of a word weighs more than its end
+func trigrams(word string) map[string]bool {
+	runes := []rune("  " + word + " ")
+	grams := make(map[string]bool, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])] = true
+	}
+	return grams
+}
+
+// trigramSimilarity is the share of trigrams two words have in common, from 0 to 1
+func trigramSimilarity(a, b map[string]bool) float64 {
+	shared := 0
+	for gram := range a {
+		if b[gram] {
+			shared++
+		}
+	}
+	total := len(a) + len(b) - shared
+	if total == 0 {
+		return 0
+	}
+	return float64(shared) / float64(total)
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+// describeClauses writes clauses as "kind:text", separated by commas
+func describeClauses(clauses []keywordClause) string {
+	kinds := map[keywordClauseKind]string{clauseTerm: "term", clausePhrase: "phrase", clausePrefix: "prefix", clauseFuzzy: "fuzzy"}
+	parts := make([]string, len(clauses))
+	for i, clause := range clauses {
+		parts[i] = kinds[clause.kind] + ":" + clause.text
+	}
+	return strings.Join(parts, ", ")
+}
+
+func TestParseKeywordQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"   \t\n", ""},
+		{"Vacation Policy", "term:vacation, term:policy"},
+		{"vacation vacation VACATION", "term:vacation"},
+		{"vacation, policy; (2024)", "term:vacation, term:policy, term:2024"},
+		{"a I x", ""},
+		{"é 日 ab", "term:ab"},
+		{"Ünïcode naïve", "term:ünïcode, term:naïve"},
+		{`"parental leave"`, "phrase:parental leave"},
+		{`"Parental   LEAVE!"`, "phrase:parental leave"},
+		{`"leave"`, "term:leave"},
+		{`"" "  " "!?"`, ""},
+		{`"a"`, ""},
+		{`"a big dog"`, "phrase:a big dog"},
+		{`"parental leave" "parental leave" parental`, "phrase:parental leave, term:parental"},
+		{`sick "parental leave`, "term:sick, phrase:parental leave"},
+		{`"sick"leave"days off"`, "term:sick, term:leave, phrase:days off"},
+		{`"vacat*" "vacaton~"`, "term:vacat, term:vacaton"},
+		{"vacat*", "prefix:vacat"},
+		{"vacat* vacat", "prefix:vacat, term:vacat"},
+		{"v* * ** ~", ""},
+		{"vacat**", "prefix:vacat"},
+		{"vacaton~", "fuzzy:vacaton"},
+		{"vacaton~*", "prefix:vacaton"},
+		{"vaca*tion", "term:vaca, term:tion"},
+		{"e-mail*", "prefix:mail"},
+		{"follow-up~", "term:follow, fuzzy:up"},
+		{"re-org* re-org", "term:re, prefix:org, term:org"},
+	}
+	for _, tt := range tests {
+		if got := describeClauses(parseKeywordQuery(tt.query)); got != tt.want {
+			t.Errorf("parseKeywordQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestKeywordMatchExpression(t *testing.T) {
+	tests := []struct {
+		name    string
+		clauses []keywordClause
+		want    string
+	}{
+		{"no clauses", nil, ""},
+		{"fuzzy term without variants", []keywordClause{{kind: clauseFuzzy, text: "xyzzy"}}, ""},
+		{"every kind", []keywordClause{
+			{kind: clauseTerm, text: "leave"},
+			{kind: clausePhrase, text: "parental leave"},
+			{kind: clausePrefix, text: "vacat"},
+			{kind: clauseFuzzy, text: "polcy", variants: map[string]float64{"policy": 0.5, "police": 0.4}},
+		}, `text:leave OR "parental leave" OR text:vacat* OR text:police OR text:policy`},
+	}
+	for _, tt := range tests {
+		if got := keywordMatchExpression(tt.clauses); got != tt.want {
+			t.Errorf("%s: keywordMatchExpression() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScoreKeywordClauses(t *testing.T) {
+	const text = "Parental leave: twelve weeks of paid leave, per the vacation-policy."
+	tests := []struct {
+		query   string
+		weights []float64
+		want    float64
+	}{
+		{"", nil, 0},
+		{"leave", nil, 1},
+		{"LEAVE weeks", nil, 1},
+		{"leave sabbatical", nil, 0.5},
+		{"leave sabbatical", []float64{3, 1}, 0.75},
+		{"eave", nil, 0},
+		{`"parental leave"`, nil, 1},
+		{`"leave parental"`, nil, 0},
+		{`"paid leave per"`, nil, 1},
+		{`"vacation policy"`, nil, 1},
+		{"vacat*", nil, 1},
+		{"acation*", nil, 0},
+		{"policy* vacationpolicy", nil, 0.5},
+	}
+	for _, tt := range tests {
+		if got := scoreKeywordClauses(parseKeywordQuery(tt.query), tt.weights, text); got != tt.want {
+			t.Errorf("scoreKeywordClauses(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	fuzzy := []keywordClause{{kind: clauseFuzzy, text: "polcy", variants: map[string]float64{"policy": 0.5, "police": 0.4}}}
+	if got := scoreKeywordClauses(fuzzy, nil, text); got != 0.5 {
+		t.Errorf("fuzzy clause scored %v, want the similarity of its best variant in the text, 0.5", got)
+	}
+}
+
+func TestTrigramSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"policy", "policy", 1},
+		{"", "", 1},
+		{"ab", "xy", 0},
+		{"policy", "polcy", 4.0 / 9},
+	}
+	for _, tt := range tests {
+		if got := trigramSimilarity(trigrams(tt.a), trigrams(tt.b)); got != tt.want {
+			t.Errorf("trigramSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,556 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	defaultGraphHops       = 2
+	maxGraphHops           = 3
+	graphHopDecay          = 0.8 // Score kept per relation followed away from a retrieved chunk
+	graphExtractionWorkers = 4   // Chunks sent to the chat model at the same time
+	maxEntityNameWords     = 6   // Longest run of query words matched against entity names
+)
+
+// graphExtraction holds the entities and relations the chat model found in one chunk
+type graphExtraction struct {
+	Entities  []graphEntity   `json:"entities"`
+	Relations []graphRelation `json:"relations"`
+}
+
+type graphEntity struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type graphRelation struct {
+	Source   string `json:"source"`
+	Relation string `json:"relation"`
+	Target   string `json:"target"`
+}
+
+// GraphStats counts what knowledge graph extraction stored for a document
+type GraphStats struct {
+	Entities     int
+	Relations    int
+	FailedChunks int // Chunks the chat model returned no usable graph for
+}
+
+// graphHopCount clamps the requested number of relations to follow to 1-3
+func graphHopCount(req *models.QueryRequest) int {
+	if req.GraphHops <= 0 {
+		return defaultGraphHops
+	}
+	return min(req.GraphHops, maxGraphHops)
+}
+
+// normalizeEntityName reduces an entity name to the key entities are linked by: lowercase words
+// separated by single spaces, without punctuation
+func normalizeEntityName(name string) string {
+	return strings.Join(entityWords(name), " ")
+}
+
+func entityWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// extractDocumentGraph asks the chat model for the entities and relations in each chunk of a
+// stored document and saves them. Parent chunks repeat the text of their children and duplicates
+// repeat a chunk already in the collection, so only the remaining chunks are sent. A chunk the
+// model fails on is counted and skipped.
+func (r *RAGService) extractDocumentGraph(ctx context.Context, collectionName string, doc *models.Document) (*GraphStats, error) {
+	var chunks []*models.EnhancedChunk
+	for _, chunk := range doc.Chunks {
+		if len(chunk.ChildChunkIDs) == 0 && chunk.DuplicateOf == nil && chunk.ChunkType != questionChunkType {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	stats := &GraphStats{}
+	extractions := make(map[string]*graphExtraction, len(chunks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, graphExtractionWorkers)
+	for _, chunk := range chunks {
+		wg.Add(1)
+		go func(chunk *models.EnhancedChunk) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			if ctx.Err() != nil {
+				return
+			}
+
+			extraction, err := r.extractChunkGraph(ctx, chunk.Text)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("Graph extraction failed for chunk %s: %v", chunk.ID, err)
+				stats.FailedChunks++
+				return
+			}
+			extractions[chunk.ID] = extraction
+		}(chunk)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, extraction := range extractions {
+		stats.Entities += len(extraction.Entities)
+		stats.Relations += len(extraction.Relations)
+	}
+	if err := r.vectorDB.storeGraph(collectionName, extractions); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Extracted %d entities and %d relations from %d chunks of '%s' (%d failed)",
+		stats.Entities, stats.Relations, len(chunks), doc.Source, stats.FailedChunks)
+	return stats, nil
+}
+
+// extractChunkGraph asks the chat model for the entities and relations in one chunk of text
+func (r *RAGService) extractChunkGraph(ctx context.Context, text string) (*graphExtraction, error) {
+	prompt := fmt.Sprintf(`Extract the named entities and the relations between them from the text below. Entities are people, organizations, projects, products, places and other specific named things. A relation connects two of those entities with a short verb phrase such as "works at", "leads" or "worked with".
+
+Respond with JSON only, in this form:
+{"entities": [{"name": "...", "type": "..."}], "relations": [{"source": "...", "relation": "...", "target": "..."}]}
+
+Text:
+%s`, text)
+
+	response, err := r.llmClient.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return parseGraphExtraction(response)
+}
+
+// parseGraphExtraction reads the JSON object in a model response, ignoring any text or code fence
+// around it. Entities are deduplicated by normalized name, and the ends of every relation are
+// added as entities so the chunk is linked to both.
+func parseGraphExtraction(response string) (*graphExtraction, error) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in model response")
+	}
+
+	var raw graphExtraction
+	if err := json.Unmarshal([]byte(response[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("invalid graph JSON in model response: %w", err)
+	}
+
+	extraction := &graphExtraction{}
+	seen := make(map[string]bool)
+	addEntity := func(name, entityType string) bool {
+		name = strings.TrimSpace(name)
+		key := normalizeEntityName(name)
+		if key == "" {
+			return false
+		}
+		if !seen[key] {
+			seen[key] = true
+			extraction.Entities = append(extraction.Entities, graphEntity{Name: name, Type: strings.TrimSpace(entityType)})
+		}
+		return true
+	}
+
+	for _, entity := range raw.Entities {
+		addEntity(entity.Name, entity.Type)
+	}
+	for _, relation := range raw.Relations {
+		relation.Relation = strings.TrimSpace(relation.Relation)
+		if relation.Relation == "" || normalizeEntityName(relation.Source) == normalizeEntityName(relation.Target) {
+			continue
+		}
+		if addEntity(relation.Source, "") && addEntity(relation.Target, "") {
+			extraction.Relations = append(extraction.Relations, graphRelation{
+				Source:   strings.TrimSpace(relation.Source),
+				Relation: relation.Relation,
+				Target:   strings.TrimSpace(relation.Target),
+			})
+		}
+	}
+	return extraction, nil
+}
+
+// expandAlongGraph follows the knowledge graph from the best retrieved chunks. Entities mentioned
+// in the top chunks or named in the query are the starting points, and relations are followed for
+// up to hops steps in either direction. A chunk mentioning a reached entity scores like the chunk
+// the walk started from, decayed per hop: candidates already retrieved are raised to that score,
+// and up to topK others are added, before everything is re-sorted. It also returns the entities
+// reached.
+func (r *RAGService) expandAlongGraph(req *models.QueryRequest, chunks []*models.EnhancedChunk, scores []float64, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, []string, error) {
+	collection := req.CollectionName
+	seeds := min(req.TopK, len(chunks))
+
+	seedIDs := make([]string, seeds)
+	for i := range seedIDs {
+		seedIDs[i] = chunks[i].ID
+	}
+	mentions, err := r.vectorDB.entityMentions(collection, "chunk_id", seedIDs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Each starting entity scores like the best chunk mentioning it; entities named in the query
+	// score like the best chunk overall
+	entityScores := make(map[string]float64)
+	raise := func(name string, score float64) bool {
+		if existing, ok := entityScores[name]; ok && existing >= score {
+			return false
+		}
+		entityScores[name] = score
+		return true
+	}
+	for i := 0; i < seeds; i++ {
+		for _, name := range mentions[chunks[i].ID] {
+			raise(name, scores[i])
+		}
+	}
+	queryEntities, err := r.vectorDB.matchEntityNames(collection, queryNameCandidates(req.Query))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, name := range queryEntities {
+		raise(name, scores[0])
+	}
+
+	// Breadth-first walk along relations
+	reached := make(map[string]bool)
+	frontier := make([]string, 0, len(entityScores))
+	for name := range entityScores {
+		frontier = append(frontier, name)
+	}
+	for hop := 0; hop < graphHopCount(req) && len(frontier) > 0; hop++ {
+		edges, err := r.vectorDB.relatedEntities(collection, frontier)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		inFrontier := make(map[string]bool, len(frontier))
+		for _, name := range frontier {
+			inFrontier[name] = true
+		}
+		var next []string
+		for _, edge := range edges {
+			for _, pair := range [][2]string{{edge[0], edge[1]}, {edge[1], edge[0]}} {
+				from, to := pair[0], pair[1]
+				if !inFrontier[from] || !raise(to, decayGraphScore(entityScores[from])) {
+					continue
+				}
+				if !reached[to] {
+					reached[to] = true
+					next = append(next, to)
+				}
+			}
+		}
+		frontier = next
+	}
+	if len(reached) == 0 {
+		return chunks, scores, nil, nil
+	}
+
+	reachedNames := make([]string, 0, len(reached))
+	for name := range reached {
+		reachedNames = append(reachedNames, name)
+	}
+	sort.Slice(reachedNames, func(i, j int) bool {
+		if entityScores[reachedNames[i]] != entityScores[reachedNames[j]] {
+			return entityScores[reachedNames[i]] > entityScores[reachedNames[j]]
+		}
+		return reachedNames[i] < reachedNames[j]
+	})
+
+	// Chunks mentioning reached entities
+	linked, err := r.vectorDB.entityMentions(collection, "normalized_name", reachedNames)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	linkedScores := make(map[string]float64, len(linked))
+	for chunkID, names := range linked {
+		best := entityScores[names[0]]
+		for _, name := range names[1:] {
+			best = max(best, entityScores[name])
+		}
+		linkedScores[chunkID] = best
+	}
+
+	type scoredChunk struct {
+		chunk *models.EnhancedChunk
+		score float64
+	}
+	merged := make([]scoredChunk, 0, len(chunks)+req.TopK)
+	present := make(map[string]bool, len(chunks))
+	for i, chunk := range chunks {
+		present[chunk.ID] = true
+		score := scores[i]
+		if linkedScore, ok := linkedScores[chunk.ID]; ok {
+			score = max(score, linkedScore)
+		}
+		merged = append(merged, scoredChunk{chunk, score})
+	}
+
+	var newIDs []string
+	for chunkID := range linkedScores {
+		if !present[chunkID] {
+			newIDs = append(newIDs, chunkID)
+		}
+	}
+	sort.Slice(newIDs, func(i, j int) bool {
+		if linkedScores[newIDs[i]] != linkedScores[newIDs[j]] {
+			return linkedScores[newIDs[i]] > linkedScores[newIDs[j]]
+		}
+		return newIDs[i] < newIDs[j]
+	})
+	if len(newIDs) > req.TopK {
+		newIDs = newIDs[:req.TopK]
+	}
+	added, err := r.vectorDB.getChunksByIDs(newIDs, filters)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, chunk := range added {
+		merged = append(merged, scoredChunk{chunk, linkedScores[chunk.ID]})
+	}
+	log.Printf("Graph expansion reached %d entities and added %d chunks", len(reached), len(added))
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].score > merged[j].score })
+	chunks = make([]*models.EnhancedChunk, len(merged))
+	scores = make([]float64, len(merged))
+	for i, m := range merged {
+		chunks[i], scores[i] = m.chunk, m.score
+	}
+	return chunks, scores, reachedNames, nil
+}
+
+// decayGraphScore lowers a score for one hop along the graph. Distance-based similarities can be
+// negative, so the decay is taken off the magnitude rather than multiplied in.
+func decayGraphScore(score float64) float64 {
+	return score - math.Abs(score)*(1-graphHopDecay)
+}
+
+// queryNameCandidates returns every run of up to maxEntityNameWords consecutive query words,
+// normalized like entity names, skipping runs made only of stop words
+func queryNameCandidates(query string) []string {
+	words := entityWords(query)
+	seen := make(map[string]bool)
+	var candidates []string
+	for i := range words {
+		for n := 1; n <= maxEntityNameWords && i+n <= len(words); n++ {
+			run := words[i : i+n]
+			meaningful := false
+			for _, word := range run {
+				if !stopWords[word] {
+					meaningful = true
+					break
+				}
+			}
+			candidate := strings.Join(run, " ")
+			if meaningful && !seen[candidate] {
+				seen[candidate] = true
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+	return candidates
+}
+
+// storeGraph replaces the entities and relations of the given chunks
+func (db *VectorDB) storeGraph(collectionName string, extractions map[string]*graphExtraction) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for chunkID, extraction := range extractions {
+		if err := db.deleteGraph(tx, `chunk_id = ? AND tenant_id = ?`, chunkID, db.tenant); err != nil {
+			return err
+		}
+
+		for _, entity := range extraction.Entities {
+			_, err := tx.Exec(`INSERT INTO entities (chunk_id, collection_name, tenant_id, name, normalized_name, entity_type)
+				VALUES (?, ?, ?, ?, ?, ?)`,
+				chunkID, collectionName, db.tenant, entity.Name, normalizeEntityName(entity.Name), entity.Type)
+			if err != nil {
+				return fmt.Errorf("failed to insert entity: %w", err)
+			}
+		}
+		for _, relation := range extraction.Relations {
+			_, err := tx.Exec(`INSERT INTO relations (chunk_id, collection_name, tenant_id, source_name, relation, target_name)
+				VALUES (?, ?, ?, ?, ?, ?)`,
+				chunkID, collectionName, db.tenant, normalizeEntityName(relation.Source), relation.Relation, normalizeEntityName(relation.Target))
+			if err != nil {
+				return fmt.Errorf("failed to insert relation: %w", err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deleteGraph deletes the entities and relations whose rows match the where clause
+func (db *VectorDB) deleteGraph(tx *sql.Tx, where string, args ...interface{}) error {
+	if _, err := tx.Exec(`DELETE FROM entities WHERE `+where, args...); err != nil {
+		return fmt.Errorf("failed to delete entities: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM relations WHERE `+where, args...); err != nil {
+		return fmt.Errorf("failed to delete relations: %w", err)
+	}
+	return nil
+}
+
+// entityMentions returns the normalized entity names mentioned in chunks, keyed by chunk ID, for
+// the entity rows whose column (chunk_id or normalized_name) is one of values
+func (db *VectorDB) entityMentions(collectionName, column string, values []string) (map[string][]string, error) {
+	mentions := make(map[string][]string)
+	if len(values) == 0 {
+		return mentions, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")
+	args := []interface{}{collectionName, db.tenant}
+	for _, value := range values {
+		args = append(args, value)
+	}
+
+	rows, err := db.conn.Query(`SELECT DISTINCT chunk_id, normalized_name FROM entities
+		WHERE collection_name = ? AND tenant_id = ? AND `+column+` IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up entity mentions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chunkID, name string
+		if err := rows.Scan(&chunkID, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan entity mention: %w", err)
+		}
+		mentions[chunkID] = append(mentions[chunkID], name)
+	}
+	return mentions, rows.Err()
+}
+
+// matchEntityNames returns the candidates that are the normalized name of an entity in the collection
+func (db *VectorDB) matchEntityNames(collectionName string, candidates []string) ([]string, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(candidates)), ",")
+	args := []interface{}{collectionName, db.tenant}
+	for _, candidate := range candidates {
+		args = append(args, candidate)
+	}
+
+	names, err := queryStrings(db.conn, `SELECT DISTINCT normalized_name FROM entities
+		WHERE collection_name = ? AND tenant_id = ? AND normalized_name IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match entity names: %w", err)
+	}
+	return names, nil
+}
+
+// relatedEntities returns the distinct (source, target) pairs of relations touching any of names
+func (db *VectorDB) relatedEntities(collectionName string, names []string) ([][2]string, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(names)), ",")
+	args := []interface{}{collectionName, db.tenant}
+	for _, name := range names {
+		args = append(args, name)
+	}
+	for _, name := range names {
+		args = append(args, name)
+	}
+
+	rows, err := db.conn.Query(`SELECT DISTINCT source_name, target_name FROM relations
+		WHERE collection_name = ? AND tenant_id = ?
+		  AND (source_name IN (`+placeholders+`) OR target_name IN (`+placeholders+`))`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up relations: %w", err)
+	}
+	defer rows.Close()
+
+	var edges [][2]string
+	for rows.Next() {
+		var edge [2]string
+		if err := rows.Scan(&edge[0], &edge[1]); err != nil {
+			return nil, fmt.Errorf("failed to scan relation: %w", err)
+		}
+		edges = append(edges, edge)
+	}
+	return edges, rows.Err()
+}
+
+// getChunksByIDs returns the chunks with the given IDs that match the metadata filters
+func (db *VectorDB) getChunksByIDs(chunkIDs []string, filters map[string]interface{}) ([]*models.EnhancedChunk, error) {
+	if len(chunkIDs) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunkIDs)), ",")
+	args := make([]interface{}, 0, len(chunkIDs)+1)
+	for _, id := range chunkIDs {
+		args = append(args, id)
+	}
+	args = append(args, db.tenant)
+
+	query := `
+		SELECT c.id, c.document_id, rag_open(c.text), c.parent_chunk_id, c.child_chunk_ids,
+		       c.section, c.subsection, c.chunk_type, c.start_pos, c.end_pos,
+		       c.chunk_index, c.keywords, c.metadata, c.confidence
+		FROM enhanced_chunks c
+		WHERE c.id IN (` + placeholders + `) AND c.tenant_id = ?`
+	if conditions, filterArgs := buildFilterConditions(filters); len(conditions) > 0 {
+		query += " AND " + strings.Join(conditions, " AND ")
+		args = append(args, filterArgs...)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []*models.EnhancedChunk
+	for rows.Next() {
+		chunk := &models.EnhancedChunk{}
+		var childIDsJSON, keywordsJSON, metadataJSON string
+
+		err := rows.Scan(
+			&chunk.ID, &chunk.DocumentID, &chunk.Text, &chunk.ParentChunkID, &childIDsJSON,
+			&chunk.Section, &chunk.Subsection, &chunk.ChunkType,
+			&chunk.StartPos, &chunk.EndPos, &chunk.ChunkIndex,
+			&keywordsJSON, &metadataJSON, &chunk.Confidence)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+
+		// Deserialize JSON fields
+		if childIDsJSON != "[]" {
+			json.Unmarshal([]byte(childIDsJSON), &chunk.ChildChunkIDs)
+		}
+		if keywordsJSON != "[]" {
+			json.Unmarshal([]byte(keywordsJSON), &chunk.Keywords)
+		}
+		if metadataJSON != "{}" {
+			json.Unmarshal([]byte(metadataJSON), &chunk.Metadata)
+		}
+
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
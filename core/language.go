@@ -0,0 +1,238 @@
+package core
+
+import (
+	"rag-go-app/models"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultLanguage = "en" // Assumed when a text is too short to tell
+
+	minLanguageEvidence = 2 // Stop words a Latin-script text needs before its language is trusted
+)
+
+// scriptLanguages maps scripts used by a single language, or mostly one, to its ISO 639-1 code
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Hangul, "ko"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+}
+
+// stopWordsByLanguage holds the stop words of every language with its own list; English uses stopWords
+var stopWordsByLanguage = map[string]map[string]bool{
+	"en": stopWords,
+	"es": wordSet("de la que el en y a los se del las un por con no una su para es al lo como más pero sus le ya o este sí porque esta entre cuando muy sin sobre también me hasta hay donde quien desde todo nos durante todos uno les ni contra otros ese eso ante ellos esto antes algunos qué unos yo otro otras otra él tanto esa estos mucho nada muchos cual poco ella estar estas algo"),
+	"fr": wordSet("le la les de des du un une et est en que qui dans pour pas sur au aux ce cette ces il elle ils elles nous vous je tu ne se sa son ses leur leurs avec par plus mais ou où donc car été être avoir ont sont comme tout très aussi"),
+	"de": wordSet("der die das und ist nicht ein eine einer eines zu den dem des mit von auf für im in sich auch es an als wie er sie wir ich du ihr aber oder wenn noch bei nach aus um nur war sind wird werden hat haben über"),
+	"it": wordSet("il lo la i gli le di da del della dei delle in con su per tra fra un una uno e è che non si sono come ma anche più al alla nel nella questo questa quello ha hanno essere"),
+	"pt": wordSet("o a os as de do da dos das em no na nos nas um uma e é que não se para com por mais mas como ao aos à seu sua seus suas ele ela eles elas foi são está também já"),
+	"nl": wordSet("de het een en van in is dat die niet op te met voor zijn er aan als ook maar om bij door naar dan wat nog wordt worden heeft hebben werd ze hij zij wij ik je"),
+	"ru": wordSet("и в во не что он на я с со как а то все она так его но да ты к у же вы за бы по только ее мне было вот от меня еще нет о из ему когда даже ли если уже или ни быть был него до вас там потом себя ей может они тут где есть надо ней для мы тебя их чем была сам без чего тоже себе под будет тогда кто этот того потому этого какой здесь этом один мой тем чтобы при об другой после над больше тот через эти нас про всего них много"),
+}
+
+// latinStopWordLanguages lists the Latin-script languages in the order ties are broken
+var latinStopWordLanguages = []string{"en", "es", "fr", "de", "it", "pt", "nl"}
+
+// unspacedLanguages don't separate words with spaces, so keywords are character bigrams
+var unspacedLanguages = map[string]bool{"zh": true, "ja": true, "th": true}
+
+// Sentence marks: terminal punctuation, with any closing quotes and brackets, followed by
+// whitespace, plus the marks of scripts that have their own. sentenceEnds decides which of them end
+// a sentence.
+var (
+	sentenceBoundaryPattern = regexp.MustCompile(`[.!?]+["'”’»)\]]*\s+`)
+	sentenceBoundaries      = map[string]*regexp.Regexp{
+		"zh": regexp.MustCompile(`[。！？]+[」』”’）]*\s*|[.!?]+["'”’)\]]*\s+`),
+		"ja": regexp.MustCompile(`[。！？]+[」』”’）]*\s*|[.!?]+["'”’)\]]*\s+`),
+		"ar": regexp.MustCompile(`[.!?؟]+["'”’)\]]*\s+`),
+		"hi": regexp.MustCompile(`[।.!?]+["'”’)\]]*\s+`),
+		"el": regexp.MustCompile(`[.!;]+["'”’»)\]]*\s+`), // Greek asks questions with ';'
+	}
+)
+
+// wordSet turns a space-separated word list into a set
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// detectLanguage returns the ISO 639-1 code of the language text is written in, or "" when it
+// cannot tell. Scripts used by one language decide on their own; Latin-script text is attributed
+// to the language whose stop words it uses most.
+func detectLanguage(text string) string {
+	letters := 0
+	scriptCounts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, entry := range scriptLanguages {
+			if unicode.Is(entry.script, r) {
+				scriptCounts[entry.language]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+
+	// Japanese mixes kana with Han characters
+	if scriptCounts["ja"] > 0 {
+		scriptCounts["ja"] += scriptCounts["zh"]
+		delete(scriptCounts, "zh")
+	}
+	for language, count := range scriptCounts {
+		if count*2 >= letters {
+			return language
+		}
+	}
+
+	hits := make(map[string]int)
+	for _, word := range splitWords(text) {
+		for _, language := range latinStopWordLanguages {
+			if stopWordsByLanguage[language][word] {
+				hits[language]++
+			}
+		}
+	}
+
+	best, bestHits, tied := "", 0, false
+	for _, language := range latinStopWordLanguages {
+		switch count := hits[language]; {
+		case count > bestHits:
+			best, bestHits, tied = language, count, false
+		case count == bestHits:
+			tied = true
+		}
+	}
+	if bestHits < minLanguageEvidence || tied {
+		return ""
+	}
+	return best
+}
+
+// stopWordsFor returns the stop words of language, falling back to English
+func stopWordsFor(language string) map[string]bool {
+	if words, ok := stopWordsByLanguage[language]; ok {
+		return words
+	}
+	return stopWords
+}
+
+// splitWords lowercases text and splits it into runs of letters
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+// keywordCandidates returns the words of text that can be keywords in language: words of three or
+// more letters (two in Korean) that are not stop words, or character bigrams where words aren't spaced
+func keywordCandidates(text, language string) []string {
+	var candidates []string
+	if unspacedLanguages[language] {
+		for _, run := range splitWords(text) {
+			runes := []rune(run)
+			for i := 0; i+1 < len(runes); i++ {
+				candidates = append(candidates, string(runes[i:i+2]))
+			}
+		}
+		return candidates
+	}
+
+	// Hangul packs a syllable into each letter, so two already make a word
+	minLength := 3
+	if language == "ko" {
+		minLength = 2
+	}
+
+	stop := stopWordsFor(language)
+	for _, word := range splitWords(text) {
+		if len([]rune(word)) >= minLength && !stop[word] {
+			candidates = append(candidates, word)
+		}
+	}
+	return candidates
+}
+
+// splitSentences splits text into trimmed, non-empty sentences, keeping their punctuation.
+// language picks the sentence marks and abbreviations; an unknown one uses '.', '!' and '?' and
+// the English abbreviations.
+func splitSentences(text, language string) []string {
+	var sentences []string
+	for _, span := range sentenceSpans(text, language) {
+		sentences = append(sentences, text[span[0]:span[1]])
+	}
+	return sentences
+}
+
+// sentenceSpans returns the byte offsets of the sentences splitSentences would return, so callers
+// can locate them in text
+func sentenceSpans(text, language string) [][2]int {
+	boundary, ok := sentenceBoundaries[language]
+	if !ok {
+		boundary = sentenceBoundaryPattern
+	}
+
+	var spans [][2]int
+	add := func(start, end int) {
+		start = end - len(strings.TrimLeftFunc(text[start:end], unicode.IsSpace))
+		end = start + len(strings.TrimRightFunc(text[start:end], unicode.IsSpace))
+		if start < end {
+			spans = append(spans, [2]int{start, end})
+		}
+	}
+
+	start := 0
+	for _, loc := range boundary.FindAllStringIndex(text, -1) {
+		if !sentenceEnds(text, loc[0], loc[1], language) {
+			continue
+		}
+		add(start, loc[1])
+		start = loc[1]
+	}
+	add(start, len(text))
+	return spans
+}
+
+// chunkLanguage returns the language recorded in a chunk's metadata, or "" if there is none
+func chunkLanguage(chunk *models.EnhancedChunk) string {
+	language, _ := chunk.Metadata["language"].(string)
+	return language
+}
+
+// tagChunkLanguages records the language of every chunk in its metadata. Chunks too short to tell
+// take the document's language, and their keywords are extracted again with its stop words.
+func tagChunkLanguages(chunks []*models.EnhancedChunk, documentLanguage string, withKeywords bool) {
+	for _, chunk := range chunks {
+		language := detectLanguage(chunk.Text)
+		if language == "" {
+			language = documentLanguage
+			if withKeywords && language != defaultLanguage {
+				chunk.Keywords = keywordsIn(chunk.Text, language)
+			}
+		}
+
+		if chunk.Metadata == nil {
+			chunk.Metadata = make(map[string]interface{})
+		}
+		chunk.Metadata["language"] = language
+	}
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"fmt"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sort keys accepted by the list endpoints and the columns they order by
+var (
+	collectionSortColumns = map[string]string{
+		"created_at":  "c.created_at",
+		"name":        "c.name",
+		"doc_count":   "doc_count",
+		"chunk_count": "chunk_count",
+	}
+	documentSortColumns = map[string]string{
+		"created_at":  "d.created_at",
+		"source":      "d.source",
+		"doc_type":    "d.doc_type",
+		"chunk_count": "chunk_count",
+	}
+)
+
+// listQuery holds the SQL fragments a list request translates to
+type listQuery struct {
+	conditions []string
+	args       []interface{}
+	orderBy    string
+	limit      string
+}
+
+// where joins the conditions of the query into a WHERE clause
+func (q *listQuery) where() string {
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// buildListQuery validates the paging options and translates them into SQL. base holds the
+// conditions every row must meet, createdColumn is filtered by the creation time range, and
+// tieBreaker keeps pages stable when the sort column has duplicates.
+func buildListQuery(opts models.ListOptions, base []string, args []interface{}, createdColumn, tieBreaker string, sortColumns map[string]string) (*listQuery, error) {
+	q := &listQuery{conditions: base, args: args}
+
+	for _, bound := range []struct {
+		value, param, operator string
+	}{
+		{opts.CreatedAfter, "created_after", ">="},
+		{opts.CreatedBefore, "created_before", "<"},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parseListTime(bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid list options: %s must be RFC 3339 or YYYY-MM-DD", bound.param)
+		}
+		// created_at holds SQLite's CURRENT_TIMESTAMP, which is UTC and sorts as text
+		q.conditions = append(q.conditions, createdColumn+" "+bound.operator+" ?")
+		q.args = append(q.args, t.UTC().Format("2006-01-02 15:04:05"))
+	}
+
+	sortBy := opts.SortBy
+	if sortBy == "" {
+		sortBy = "created_at"
+	}
+	column, ok := sortColumns[sortBy]
+	if !ok {
+		keys := make([]string, 0, len(sortColumns))
+		for key := range sortColumns {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("invalid list options: sort_by must be one of %s", strings.Join(keys, ", "))
+	}
+	order := strings.ToUpper(opts.Order)
+	if order == "" {
+		order = "ASC"
+		if sortBy == "created_at" || strings.HasSuffix(sortBy, "_count") {
+			order = "DESC"
+		}
+	}
+	q.orderBy = fmt.Sprintf(" ORDER BY %s %s, %s", column, order, tieBreaker)
+
+	if opts.Limit > 0 {
+		q.limit = fmt.Sprintf(" LIMIT %d OFFSET %d", opts.Limit, opts.Offset)
+	} else if opts.Offset > 0 {
+		q.limit = fmt.Sprintf(" LIMIT -1 OFFSET %d", opts.Offset)
+	}
+	return q, nil
+}
+
+// parseListTime accepts a full RFC 3339 timestamp or a plain date
+func parseListTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// likeSubstring returns a LIKE pattern matching value anywhere, with its wildcards escaped by '\'
+func likeSubstring(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+	return "%" + escaped + "%"
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,24 +12,51 @@ import (
 	"rag-go-app/models"
 )
 
-// GenerateChatCompletion sends a prompt to the LlamaCPP server.
-func GenerateChatCompletion(messages []models.ChatCompletionMessage, modelName string) (string, error) {
-	if modelName == "" {
-		modelName = config.AppConfig.ChatModel
+// GenerateChatCompletion sends a prompt to the configured model server, within the chat timeout,
+// retrying and failing over as configured. gen chooses the model, defaulting to chat_model, and
+// the sampling parameters; its system prompt is sent as a leading system message.
+func GenerateChatCompletion(ctx context.Context, messages []models.ChatCompletionMessage, gen models.GenerationOptions) (string, error) {
+	if gen.Model == "" {
+		gen.Model = config.AppConfig.ChatModel
 	}
+	if gen.SystemPrompt != "" {
+		messages = append([]models.ChatCompletionMessage{{Role: "system", Content: gen.SystemPrompt}}, messages...)
+	}
+
+	ctx, span := StartSpan(ctx, "GenerateChatCompletion", SpanKindClient)
+	span.SetAttribute("gen_ai.request.model", gen.Model)
+	if gen.MaxTokens > 0 {
+		span.SetAttribute("gen_ai.request.max_tokens", gen.MaxTokens)
+	}
+	span.SetAttribute("rag.messages", len(messages))
+
+	var content string
+	err := callModelServer(ctx, config.AppConfig.Timeouts.ChatSeconds, func(ctx context.Context, provider Provider) error {
+		var err error
+		content, err = provider.ChatCompletion(ctx, messages, gen)
+		return err
+	})
+	span.End(err)
+	return content, err
+}
 
+// ChatCompletion calls the OpenAI-compatible /chat/completions endpoint
+func (p openAIProvider) ChatCompletion(ctx context.Context, messages []models.ChatCompletionMessage, gen models.GenerationOptions) (string, error) {
 	reqPayload := models.ChatCompletionRequest{
-		Model:    modelName,
-		Messages: messages,
-		Stream:   false, // Set to true if you want to handle streaming
+		Model:       gen.Model,
+		Messages:    messages,
+		Stream:      false, // Set to true if you want to handle streaming
+		Temperature: gen.Temperature,
+		TopP:        gen.TopP,
+		MaxTokens:   gen.MaxTokens,
 	}
 	payloadBytes, err := json.Marshal(reqPayload)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal chat completion request: %w", err)
 	}
 
-	apiURL := fmt.Sprintf("%s/chat/completions", config.AppConfig.LlamaCPPBaseURL)
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(payloadBytes))
+	apiURL := fmt.Sprintf("%s/chat/completions", p.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		return "", fmt.Errorf("failed to create chat completion request: %w", err)
 	}
@@ -52,7 +80,7 @@ func GenerateChatCompletion(messages []models.ChatCompletionMessage, modelName s
 			errBodyBytes, _ = io.ReadAll(resp.Body)
 		}
 		log.Printf("Chat completion API error response body: %s", string(errBodyBytes))
-		return "", fmt.Errorf("chat completion API request failed with status %s: %s", resp.Status, string(errBodyBytes))
+		return "", &backendStatusError{resp.StatusCode, fmt.Sprintf("chat completion API request failed with status %s: %s", resp.Status, string(errBodyBytes))}
 	}
 
 	var completionResp models.ChatCompletionResponse
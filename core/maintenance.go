@@ -0,0 +1,293 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"rag-go-app/config"
+	"sync"
+	"time"
+)
+
+// Maintenance steps, run in this order
+const (
+	MaintenancePruneOrphans = "prune_orphans" // Delete embeddings and full-text entries of deleted chunks
+	MaintenanceRebuildFTS   = "rebuild_fts"   // Rebuild the full-text index and merge its segments
+	MaintenanceVacuum       = "vacuum"        // Return the pages freed by deletions to the file system
+	MaintenanceAnalyze      = "analyze"       // Refresh the statistics the query planner picks indexes by
+	MaintenanceRebuildANN   = "rebuild_ann"   // Rebuild the in-memory ANN indexes, dropping deleted vectors
+)
+
+// maintenanceSteps fixes the order steps run in: pruning first so the rebuilt indexes and the
+// vacuumed file leave out what it deletes
+var maintenanceSteps = []string{
+	MaintenancePruneOrphans, MaintenanceRebuildFTS, MaintenanceVacuum, MaintenanceAnalyze, MaintenanceRebuildANN,
+}
+
+// Triggers of a maintenance run
+const (
+	MaintenanceScheduled = "schedule"
+	MaintenanceManual    = "manual"
+)
+
+// ErrMaintenanceRunning is returned when maintenance is asked for while a run is in progress
+var ErrMaintenanceRunning = errors.New("maintenance is already running")
+
+// MaintenanceStep reports one step of a maintenance run
+type MaintenanceStep struct {
+	Name       string `json:"name"`
+	Rows       int64  `json:"rows,omitempty"` // Orphans pruned, or ANN indexes rebuilt
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// MaintenanceReport reports a maintenance run
+type MaintenanceReport struct {
+	Trigger         string            `json:"trigger"` // "schedule" or "manual"
+	StartedAt       time.Time         `json:"started_at"`
+	DurationMS      int64             `json:"duration_ms"`
+	SizeBytesBefore int64             `json:"size_bytes_before"`
+	SizeBytesAfter  int64             `json:"size_bytes_after"`
+	ReclaimedBytes  int64             `json:"reclaimed_bytes"`
+	Steps           []MaintenanceStep `json:"steps"`
+	Error           string            `json:"error,omitempty"` // Set when a step failed
+}
+
+// MaintenanceStatus describes the maintenance schedule and the last run
+type MaintenanceStatus struct {
+	IntervalSeconds int                `json:"interval_seconds"` // 0 when maintenance only runs on request
+	Running         bool               `json:"running"`
+	NextRunAt       *time.Time         `json:"next_run_at,omitempty"`
+	LastRun         *MaintenanceReport `json:"last_run,omitempty"`
+}
+
+// MaintenanceScheduler keeps the database compact and its indexes healthy. SQLite doesn't give the
+// pages of deleted rows back to the file system, and deletions leave the full-text index
+// fragmented and the ANN graphs full of tombstones, so it periodically prunes orphaned rows,
+// rebuilds the indexes, refreshes the planner's statistics and vacuums the database.
+type MaintenanceScheduler struct {
+	db       *VectorDB
+	interval time.Duration
+
+	run sync.Mutex // Held for the duration of a run
+
+	mu        sync.Mutex // Guards the fields below
+	running   bool
+	nextRunAt *time.Time
+	lastRun   *MaintenanceReport
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewMaintenanceScheduler validates the maintenance settings and returns a scheduler whose
+// schedule has not been started
+func NewMaintenanceScheduler(db *VectorDB, cfg config.MaintenanceConfig) (*MaintenanceScheduler, error) {
+	if cfg.IntervalSeconds < 0 {
+		return nil, fmt.Errorf("maintenance interval_seconds cannot be negative")
+	}
+	return &MaintenanceScheduler{db: db, interval: time.Duration(cfg.IntervalSeconds) * time.Second}, nil
+}
+
+// Start runs maintenance every configured interval until Stop is called; without an interval it
+// does nothing
+func (m *MaintenanceScheduler) Start() {
+	if m.interval <= 0 {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	m.scheduleNext()
+
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := m.Run(MaintenanceScheduled, nil); err != nil {
+					log.Printf("Scheduled maintenance skipped: %v", err)
+				}
+				m.scheduleNext()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+
+	log.Printf("Running database maintenance every %v", m.interval)
+}
+
+// Stop ends the maintenance schedule, waiting for a scheduled run in progress
+func (m *MaintenanceScheduler) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+	m.stop = nil
+}
+
+// scheduleNext records when the next scheduled run is due
+func (m *MaintenanceScheduler) scheduleNext() {
+	next := time.Now().UTC().Add(m.interval)
+	m.mu.Lock()
+	m.nextRunAt = &next
+	m.mu.Unlock()
+}
+
+// Status returns the schedule, whether a run is in progress and the report of the last run
+func (m *MaintenanceScheduler) Status() MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := MaintenanceStatus{IntervalSeconds: int(m.interval / time.Second), Running: m.running}
+	if m.interval > 0 && m.nextRunAt != nil {
+		next := *m.nextRunAt
+		status.NextRunAt = &next
+	}
+	if m.lastRun != nil {
+		last := *m.lastRun
+		status.LastRun = &last
+	}
+	return status
+}
+
+// Run runs the given maintenance steps now, every step when none are given, in their fixed
+// order. A failing step is reported and the others still run. It returns ErrMaintenanceRunning
+// without waiting when a run is already in progress, and ErrReadOnly while the server is
+// read-only, as pruning, rebuilding the indexes and vacuuming all rewrite the database.
+func (m *MaintenanceScheduler) Run(trigger string, steps []string) (*MaintenanceReport, error) {
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	if !m.run.TryLock() {
+		return nil, ErrMaintenanceRunning
+	}
+	defer m.run.Unlock()
+	m.setRunning(true)
+	defer m.setRunning(false)
+
+	report := &MaintenanceReport{Trigger: trigger, StartedAt: time.Now().UTC(), Steps: []MaintenanceStep{}}
+	start := time.Now()
+	report.SizeBytesBefore, _ = m.db.databaseSize()
+
+	failed := 0
+	for _, name := range maintenanceSteps {
+		if len(steps) > 0 && !contains(steps, name) {
+			continue
+		}
+		step := MaintenanceStep{Name: name}
+		stepStart := time.Now()
+		rows, err := m.runStep(name)
+		step.Rows, step.DurationMS = rows, time.Since(stepStart).Milliseconds()
+		if err != nil {
+			log.Printf("Maintenance step %s failed: %v", name, err)
+			step.Error = err.Error()
+			failed++
+		}
+		report.Steps = append(report.Steps, step)
+	}
+
+	report.SizeBytesAfter, _ = m.db.databaseSize()
+	report.ReclaimedBytes = max(report.SizeBytesBefore-report.SizeBytesAfter, 0)
+	report.DurationMS = time.Since(start).Milliseconds()
+	if failed > 0 {
+		report.Error = fmt.Sprintf("%d of %d maintenance steps failed", failed, len(report.Steps))
+	}
+	log.Printf("Database maintenance finished in %v, reclaiming %d bytes",
+		time.Since(start).Round(time.Millisecond), report.ReclaimedBytes)
+
+	m.mu.Lock()
+	m.lastRun = report
+	m.mu.Unlock()
+	return report, nil
+}
+
+// setRunning records whether a run is in progress
+func (m *MaintenanceScheduler) setRunning(running bool) {
+	m.mu.Lock()
+	m.running = running
+	m.mu.Unlock()
+}
+
+// runStep runs one maintenance step, returning the rows it affected
+func (m *MaintenanceScheduler) runStep(name string) (int64, error) {
+	switch name {
+	case MaintenancePruneOrphans:
+		return m.db.pruneOrphans()
+	case MaintenanceRebuildFTS:
+		return 0, m.db.rebuildFTSIndex()
+	case MaintenanceVacuum:
+		if _, err := m.db.conn.Exec(`VACUUM`); err != nil {
+			return 0, fmt.Errorf("failed to vacuum database: %w", err)
+		}
+		return 0, nil
+	case MaintenanceAnalyze:
+		if _, err := m.db.conn.Exec(`ANALYZE`); err != nil {
+			return 0, fmt.Errorf("failed to analyze database: %w", err)
+		}
+		return 0, nil
+	case MaintenanceRebuildANN:
+		if annIndexes == nil {
+			return 0, nil
+		}
+		annIndexes.rebuildAll("", "", false)
+		return int64(len(annIndexes.indexes)), nil
+	}
+	return 0, fmt.Errorf("unknown maintenance step %q", name)
+}
+
+// databaseSize returns the size of the database in bytes
+func (db *VectorDB) databaseSize() (int64, error) {
+	var size int64
+	err := db.conn.QueryRow(`SELECT (SELECT page_count FROM pragma_page_count()) * (SELECT page_size FROM pragma_page_size())`).Scan(&size)
+	return size, err
+}
+
+// pruneOrphans deletes the embeddings and full-text entries, of every tenant, whose chunk no longer
+// exists, and recomputes the term statistics when full-text entries were deleted. It returns how
+// many rows it deleted.
+func (db *VectorDB) pruneOrphans() (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	pruned, err := deleteOrphanedEmbeddings(tx)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := deleteOrphanedFTSEntries(tx)
+	if err != nil {
+		return 0, err
+	}
+	if entries > 0 {
+		pruned += entries
+		if err := rebuildTermStats(tx); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d orphaned embeddings and full-text entries", pruned)
+	}
+	return pruned, nil
+}
+
+// rebuildFTSIndex rebuilds the full-text index from the text it stores and merges its b-tree
+// segments into one, which deletions and updates leave fragmented
+func (db *VectorDB) rebuildFTSIndex() error {
+	if _, err := db.conn.Exec(`INSERT INTO chunk_fts(chunk_fts) VALUES('rebuild')`); err != nil {
+		return fmt.Errorf("failed to rebuild full-text index: %w", err)
+	}
+	if _, err := db.conn.Exec(`INSERT INTO chunk_fts(chunk_fts) VALUES('optimize')`); err != nil {
+		return fmt.Errorf("failed to optimize full-text index: %w", err)
+	}
+	return nil
+}
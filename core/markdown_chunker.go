@@ -0,0 +1,480 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"rag-go-app/models"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var (
+	markdownHeadingPattern   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	markdownFencePattern     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	markdownSetextPattern    = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	markdownTableDelimiter   = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-+:?[ \t]*(\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	markdownExtensionPattern = regexp.MustCompile(`(?i)\.(md|markdown|mdown|mkd)$`)
+)
+
+// markdownBlockKind classifies a run of Markdown source
+type markdownBlockKind string
+
+const (
+	markdownHeading markdownBlockKind = "heading"
+	markdownText    markdownBlockKind = "text"
+	markdownCode    markdownBlockKind = "code"  // Fenced code, never split
+	markdownTable   markdownBlockKind = "table" // Pipe or HTML table, never split
+)
+
+// markdownBlock is a heading, paragraph, code fence or table with its byte range in the source
+type markdownBlock struct {
+	Kind  markdownBlockKind
+	Level int    // Heading level 1-6
+	Title string // Heading text
+	Start int
+	End   int
+}
+
+// markdownSection is one node of the heading tree: a heading and the blocks up to the next heading
+type markdownSection struct {
+	Path   []string // Heading breadcrumb, outermost first
+	Level  int      // 0 for text before the first heading
+	Blocks []markdownBlock
+}
+
+// isMarkdownDocument reports whether a document should go through the Markdown chunker,
+// based on its declared type or the extension of its source
+func isMarkdownDocument(source string, docType string) bool {
+	switch strings.ToLower(docType) {
+	case "markdown", "md":
+		return true
+	}
+	return markdownExtensionPattern.MatchString(source)
+}
+
+// processMarkdownDocument chunks Markdown along its heading tree. Parent-document strategy turns
+// every heading section into parents with child chunks; all other strategies pack each section
+// into structural chunks. Code fences and tables always stay inside a single chunk.
+func processMarkdownDocument(content string, source string, docType string, config *models.ChunkingConfig) (*models.Document, error) {
+	characteristics := analyzeDocument(content)
+	adaptiveConfig := adaptChunkingStrategy(characteristics, config)
+
+	blocks := parseMarkdownBlocks(content)
+	sections := buildMarkdownSections(content, blocks)
+
+	// An explicit parent-document request is honored; heading sections make natural parents
+	if config != nil && config.Strategy == models.ParentDocumentStrategy {
+		adaptiveConfig.Strategy = models.ParentDocumentStrategy
+	}
+
+	if adaptiveConfig.Strategy != models.ParentDocumentStrategy {
+		if adaptiveConfig.Strategy == models.FixedSizeStrategy && characteristics.Category == VerySmallDocument {
+			// Tiny documents stay whole, as with the generic pipeline
+			adaptiveConfig.MaxChunkSize = characteristics.Length
+		}
+		adaptiveConfig.Strategy = models.StructuralStrategy
+	}
+
+	log.Printf("Markdown analysis: %d chars, %d heading sections, strategy: %s",
+		characteristics.Length, len(sections), adaptiveConfig.Strategy)
+
+	doc := &models.Document{
+		ID:      uuid.New().String(),
+		Content: content,
+		Source:  source,
+		DocType: docType,
+		Metadata: map[string]interface{}{
+			"chunking_strategy": string(adaptiveConfig.Strategy),
+			"document_length":   characteristics.Length,
+			"document_category": string(characteristics.Category),
+			"structure_type":    string(characteristics.StructureType),
+			"source_format":     "markdown",
+			"language":          characteristics.Language,
+			"section_count":     len(sections),
+			"chunk_count":       0, // Will be updated after chunking
+		},
+	}
+	tables := 0
+	for _, block := range blocks {
+		if block.Kind == markdownTable {
+			tables++
+		}
+	}
+	if tables > 0 {
+		doc.Metadata["table_count"] = tables
+	}
+
+	var chunks []*models.EnhancedChunk
+	if adaptiveConfig.Strategy == models.ParentDocumentStrategy {
+		chunks = createMarkdownParentChunks(content, sections, doc.ID, adaptiveConfig)
+	} else {
+		// Small sections are not merged into their neighbours, which would mislabel the breadcrumb
+		chunks = createMarkdownSectionChunks(content, sections, doc.ID, adaptiveConfig)
+	}
+
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("failed to create chunks: markdown document has no content")
+	}
+	tagChunkLanguages(chunks, characteristics.Language, adaptiveConfig.ExtractKeywords)
+	tagChunkEntities(chunks)
+
+	doc.Chunks = chunks
+	doc.Metadata["chunk_count"] = len(chunks)
+
+	log.Printf("Markdown document processed: %d chunks created using %s strategy", len(chunks), adaptiveConfig.Strategy)
+	return doc, nil
+}
+
+// parseMarkdownBlocks splits Markdown into blocks. Paragraphs and lists end at blank lines;
+// fenced code runs to its closing fence, pipe tables run while lines contain pipes and HTML tables
+// run to their closing tag.
+func parseMarkdownBlocks(content string) []markdownBlock {
+	var blocks []markdownBlock
+
+	// Line start offsets; each line excludes its newline
+	var lines []string
+	var starts []int
+	for offset := 0; offset < len(content); {
+		end := strings.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			end = len(content) - offset
+		}
+		lines = append(lines, strings.TrimSuffix(content[offset:offset+end], "\r"))
+		starts = append(starts, offset)
+		offset += end + 1
+	}
+	lineEnd := func(i int) int { return starts[i] + len(lines[i]) }
+
+	textStart := -1 // First line of the open paragraph
+	closeText := func(last int) {
+		if textStart >= 0 {
+			blocks = append(blocks, markdownBlock{Kind: markdownText, Start: starts[textStart], End: lineEnd(last)})
+			textStart = -1
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if strings.TrimSpace(line) == "" {
+			closeText(i - 1)
+			continue
+		}
+
+		if fence := markdownFencePattern.FindStringSubmatch(line); fence != nil {
+			closeText(i - 1)
+			marker := fence[1]
+			end := len(lines) - 1 // An unterminated fence runs to the end of the document
+			for j := i + 1; j < len(lines); j++ {
+				trimmed := strings.TrimSpace(lines[j])
+				if strings.HasPrefix(trimmed, marker[:3]) && strings.Trim(trimmed, marker[:1]) == "" && len(trimmed) >= len(marker) {
+					end = j
+					break
+				}
+			}
+			blocks = append(blocks, markdownBlock{Kind: markdownCode, Start: starts[i], End: lineEnd(end)})
+			i = end
+			continue
+		}
+
+		if heading := markdownHeadingPattern.FindStringSubmatch(line); heading != nil {
+			closeText(i - 1)
+			blocks = append(blocks, markdownBlock{
+				Kind:  markdownHeading,
+				Level: len(heading[1]),
+				Title: strings.TrimSpace(heading[2]),
+				Start: starts[i],
+				End:   lineEnd(i),
+			})
+			continue
+		}
+
+		// A single paragraph line underlined with === or --- is a setext heading
+		if textStart == i-1 && textStart >= 0 {
+			if underline := markdownSetextPattern.FindStringSubmatch(line); underline != nil {
+				level := 1
+				if underline[1][0] == '-' {
+					level = 2
+				}
+				blocks = append(blocks, markdownBlock{
+					Kind:  markdownHeading,
+					Level: level,
+					Title: strings.TrimSpace(lines[textStart]),
+					Start: starts[textStart],
+					End:   lineEnd(i),
+				})
+				textStart = -1
+				continue
+			}
+		}
+
+		if table := strings.Contains(line, "|") && i+1 < len(lines) && markdownTableDelimiter.MatchString(lines[i+1]); table || htmlTableOpen.MatchString(line) {
+			closeText(i - 1)
+			end := htmlTableEnd(lines, i)
+			if table {
+				end = pipeTableEnd(lines, i)
+			}
+			blocks = append(blocks, markdownBlock{Kind: markdownTable, Start: starts[i], End: lineEnd(end)})
+			i = end
+			continue
+		}
+
+		if textStart < 0 {
+			textStart = i
+		}
+	}
+	closeText(len(lines) - 1)
+
+	return blocks
+}
+
+// buildMarkdownSections walks the blocks with a heading stack, starting a section at every
+// heading. Blocks before the first heading form a section with an empty path.
+func buildMarkdownSections(content string, blocks []markdownBlock) []markdownSection {
+	var sections []markdownSection
+	var path []string
+	var levels []int
+
+	for _, block := range blocks {
+		if block.Kind == markdownHeading {
+			// Pop headings at the same or a deeper level
+			for len(levels) > 0 && levels[len(levels)-1] >= block.Level {
+				levels = levels[:len(levels)-1]
+				path = path[:len(path)-1]
+			}
+			levels = append(levels, block.Level)
+			path = append(path, block.Title)
+
+			sections = append(sections, markdownSection{
+				Path:   append([]string(nil), path...),
+				Level:  block.Level,
+				Blocks: []markdownBlock{block},
+			})
+			continue
+		}
+
+		if len(sections) == 0 {
+			sections = append(sections, markdownSection{})
+		}
+		current := &sections[len(sections)-1]
+		current.Blocks = append(current.Blocks, block)
+	}
+
+	return sections
+}
+
+// splitMarkdownText breaks a paragraph longer than limit at line boundaries so it can be packed;
+// code fences and tables are returned unchanged
+func splitMarkdownText(content string, block markdownBlock, limit int) []markdownBlock {
+	if block.Kind != markdownText || limit <= 0 || block.End-block.Start <= limit {
+		return []markdownBlock{block}
+	}
+
+	var parts []markdownBlock
+	start := block.Start
+	for start < block.End {
+		end := start + limit
+		if end >= block.End {
+			end = block.End
+		} else if newline := strings.LastIndexByte(content[start:end], '\n'); newline > 0 {
+			end = start + newline
+		} else {
+			// No line break; back off to a rune boundary
+			for end > start+1 && !utf8.RuneStart(content[end]) {
+				end--
+			}
+		}
+		parts = append(parts, markdownBlock{Kind: markdownText, Start: start, End: end})
+		start = end
+		for start < block.End && content[start] == '\n' {
+			start++
+		}
+	}
+	return parts
+}
+
+// packMarkdownBlocks groups consecutive blocks into runs of at most limit bytes. Only oversized
+// paragraphs are split, and a heading always stays with the block that follows it. With
+// isolateTables, every table gets a group of its own, along with its caption line and a heading
+// directly above it.
+func packMarkdownBlocks(content string, blocks []markdownBlock, limit int, isolateTables bool) [][]markdownBlock {
+	var groups [][]markdownBlock
+	var current []markdownBlock
+
+	var split []markdownBlock
+	for _, block := range blocks {
+		split = append(split, splitMarkdownText(content, block, limit)...)
+	}
+
+	for _, block := range split {
+		if isolateTables && block.Kind == markdownTable {
+			var table []markdownBlock
+			if last := len(current) - 1; last >= 0 && current[last].Kind == markdownText && isTableCaption(content[current[last].Start:current[last].End]) {
+				table = append(table, current[last])
+				current = current[:last]
+			}
+			if len(current) == 1 && current[0].Kind == markdownHeading {
+				table = append(current, table...)
+				current = nil
+			}
+			if len(current) > 0 {
+				groups = append(groups, current)
+				current = nil
+			}
+			groups = append(groups, append(table, block))
+			continue
+		}
+
+		if len(current) > 0 {
+			onlyHeading := len(current) == 1 && current[0].Kind == markdownHeading
+			if block.End-current[0].Start > limit && !onlyHeading {
+				groups = append(groups, current)
+				current = nil
+			}
+		}
+		current = append(current, block)
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+
+	return groups
+}
+
+// newMarkdownChunk creates a chunk spanning a group of blocks, labelled with the section breadcrumb
+func newMarkdownChunk(content string, section markdownSection, group []markdownBlock, docID string, chunkType string, config *models.ChunkingConfig) *models.EnhancedChunk {
+	start, end := trimSpan(content, group[0].Start, group[len(group)-1].End)
+	text := content[start:end]
+
+	chunk := &models.EnhancedChunk{
+		ID:         uuid.New().String(),
+		DocumentID: docID,
+		Text:       text,
+		Section:    "document",
+		ChunkType:  chunkType,
+		StartPos:   utf8.RuneCountInString(content[:start]),
+		EndPos:     utf8.RuneCountInString(content[:end]),
+	}
+
+	if len(section.Path) > 0 {
+		chunk.Section = section.Path[0]
+		if len(section.Path) > 1 {
+			chunk.Subsection = strings.Join(section.Path[1:], " > ")
+		}
+		chunk.Metadata = map[string]interface{}{
+			"heading_level": section.Level,
+			"heading_path":  section.Path,
+		}
+	}
+
+	for _, block := range group {
+		if block.Kind == markdownCode || block.Kind == markdownTable {
+			if chunk.Metadata == nil {
+				chunk.Metadata = make(map[string]interface{})
+			}
+			chunk.Metadata["contains_"+string(block.Kind)] = true
+		}
+	}
+
+	// A group holding a table holds nothing but the table and what introduces it
+	if chunkType != "parent" && chunk.Metadata["contains_table"] == true {
+		chunk.ChunkType = tableChunkType
+		table := group[len(group)-1]
+		description := parseTable(content[table.Start:table.End])
+		if description.Caption == "" && len(group) > 1 && group[len(group)-2].Kind == markdownText {
+			caption := group[len(group)-2]
+			description.Caption = cleanCaption(content[caption.Start:caption.End])
+		}
+		for key, value := range description.metadata() {
+			chunk.Metadata[key] = value
+		}
+		delete(chunk.Metadata, "contains_table")
+	}
+
+	if config.ExtractKeywords {
+		chunk.Keywords = extractKeywords(text)
+	}
+
+	return chunk
+}
+
+// createMarkdownSectionChunks keeps each heading section as one chunk when it fits and otherwise
+// packs its blocks into section parts
+func createMarkdownSectionChunks(content string, sections []markdownSection, docID string, config *models.ChunkingConfig) []*models.EnhancedChunk {
+	var chunks []*models.EnhancedChunk
+
+	for _, section := range sections {
+		groups := packMarkdownBlocks(content, section.Blocks, config.MaxChunkSize, true)
+		chunkType := "section"
+		if len(groups) > 1 {
+			chunkType = "section_part"
+		}
+
+		for _, group := range groups {
+			chunk := newMarkdownChunk(content, section, group, docID, chunkType, config)
+			if chunk.Text == "" {
+				continue
+			}
+			chunk.ChunkIndex = len(chunks)
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	return chunks
+}
+
+// createMarkdownParentChunks makes every heading section a parent (split only when it exceeds the
+// parent size) and packs the parent's blocks into smaller child chunks
+func createMarkdownParentChunks(content string, sections []markdownSection, docID string, config *models.ChunkingConfig) []*models.EnhancedChunk {
+	parentSize := config.MaxChunkSize * 2 // Parents are larger
+	childSize := config.MinChunkSize
+	if childSize <= 0 {
+		childSize = config.MaxChunkSize
+	}
+
+	var parentChunks []*models.EnhancedChunk
+	var childChunks []*models.EnhancedChunk
+
+	for _, section := range sections {
+		for _, parentGroup := range packMarkdownBlocks(content, section.Blocks, parentSize, false) {
+			parent := newMarkdownChunk(content, section, parentGroup, docID, "parent", config)
+			if parent.Text == "" {
+				continue
+			}
+			parent.ChunkIndex = len(parentChunks)
+
+			var childIDs []string
+			for _, childGroup := range packMarkdownBlocks(content, parentGroup, childSize, true) {
+				child := newMarkdownChunk(content, section, childGroup, docID, "child", config)
+				if child.Text == "" {
+					continue
+				}
+				child.ParentChunkID = &parent.ID
+				childIDs = append(childIDs, child.ID)
+				childChunks = append(childChunks, child)
+			}
+
+			parent.ChildChunkIDs = childIDs
+			parentChunks = append(parentChunks, parent)
+		}
+	}
+
+	for i, child := range childChunks {
+		child.ChunkIndex = len(parentChunks) + i
+	}
+
+	// Add parents at the beginning
+	return append(parentChunks, childChunks...)
+}
+
+// markdownDocType returns "markdown" for Markdown file paths when no type was given
+func markdownDocType(filePath string, docType string) string {
+	if docType == "" && markdownExtensionPattern.MatchString(filepath.Base(filePath)) {
+		return "markdown"
+	}
+	return docType
+}
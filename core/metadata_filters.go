@@ -0,0 +1,206 @@
+package core
+
+import (
+	"fmt"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+)
+
+// metadataValueExpr looks up a metadata path, given twice as arguments, in a chunk's metadata and
+// then in its document's, so filters cover both imported chunk metadata and document statistics
+const metadataValueExpr = "COALESCE(json_extract(c.metadata, ?), (SELECT json_extract(d.metadata, ?) FROM documents d WHERE d.id = c.document_id))"
+
+// metadataTypeExpr gives the JSON type of the value metadataValueExpr looks up, taking the same
+// two path arguments
+const metadataTypeExpr = "COALESCE(json_type(c.metadata, ?), (SELECT json_type(d.metadata, ?) FROM documents d WHERE d.id = c.document_id))"
+
+// filterField is a value metadata filters compare: a SQL expression on the enhanced_chunks alias
+// "c", an expression of its JSON type, and the arguments each of them takes
+type filterField struct {
+	value, kind string
+	args        []interface{}
+}
+
+// filterColumns are the filter keys stored in columns rather than in the metadata JSON
+var filterColumns = map[string]filterField{
+	"section":    {value: "c.section", kind: "'text'"},
+	"subsection": {value: "c.subsection", kind: "'text'"},
+	"chunk_type": {value: "c.chunk_type", kind: "'text'"},
+	"doc_type":   {value: "(SELECT doc_type FROM documents WHERE id = c.document_id)", kind: "'text'"},
+}
+
+// reservedFilterKeys are the filters keys Retrieve sets itself; metadata_filters under them are ignored
+var reservedFilterKeys = map[string]bool{
+	principalFilter:      true,
+	abstractionFilter:    true,
+	granularityFilter:    true,
+	createdRangeFilter:   true,
+	metadataRangesFilter: true,
+}
+
+// metadataField returns the field a filter key refers to: a column, or else a metadata path looked
+// up in the chunk's metadata and then in its document's
+func metadataField(key string) (filterField, error) {
+	if field, ok := filterColumns[key]; ok {
+		return field, nil
+	}
+	if !metadataKeyPattern.MatchString(key) {
+		return filterField{}, fmt.Errorf("key %q must be an identifier, optionally nested with dots", key)
+	}
+	path := "$." + key
+	return filterField{value: metadataValueExpr, kind: metadataTypeExpr, args: []interface{}{path, path}}, nil
+}
+
+// expand replaces {value} and {kind} in template with the field's expressions and returns the
+// arguments of the result in order; each ? of the template itself takes the next of operands
+func (f filterField) expand(template string, operands ...interface{}) (string, []interface{}) {
+	var sql strings.Builder
+	var args []interface{}
+	for len(template) > 0 {
+		switch {
+		case strings.HasPrefix(template, "{value}"):
+			sql.WriteString(f.value)
+			args = append(args, f.args...)
+			template = template[len("{value}"):]
+		case strings.HasPrefix(template, "{kind}"):
+			sql.WriteString(f.kind)
+			args = append(args, f.args...)
+			template = template[len("{kind}"):]
+		default:
+			if template[0] == '?' {
+				args = append(args, operands[0])
+				operands = operands[1:]
+			}
+			sql.WriteByte(template[0])
+			template = template[1:]
+		}
+	}
+	return sql.String(), args
+}
+
+// metadataFilter is a metadata_filters entry translated into SQL conditions on the enhanced_chunks
+// alias "c". buildFilterConditions applies it under any key.
+type metadataFilter struct {
+	conditions []string
+	args       []interface{}
+}
+
+// addMetadataFilters translates the metadata_filters of a query and adds them to filters. A value
+// is either compared for equality or an object of operators, all of which must hold:
+//
+//	{"section": "skills", "year": {"$gte": 2020}, "tags": {"$contains": "go"}, "team": {"$in": ["a", "b"]}}
+func addMetadataFilters(filters map[string]interface{}, req *models.QueryRequest) error {
+	for key, value := range req.MetadataFilters {
+		if reservedFilterKeys[key] {
+			continue
+		}
+		filter, err := parseMetadataFilter(key, value)
+		if err != nil {
+			return fmt.Errorf("invalid filters: metadata_filters %w", err)
+		}
+		filters[key] = filter
+	}
+	return nil
+}
+
+// parseMetadataFilter translates the metadata_filters value of one key
+func parseMetadataFilter(key string, value interface{}) (metadataFilter, error) {
+	field, err := metadataField(key)
+	if err != nil {
+		return metadataFilter{}, err
+	}
+
+	operators, ok := value.(map[string]interface{})
+	if !ok {
+		operators = map[string]interface{}{"$eq": value}
+	}
+	if len(operators) == 0 {
+		return metadataFilter{}, fmt.Errorf("key %q has no operators", key)
+	}
+	names := make([]string, 0, len(operators))
+	for name := range operators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var filter metadataFilter
+	for _, name := range names {
+		condition, args, err := field.operatorCondition(name, operators[name])
+		if err != nil {
+			return metadataFilter{}, fmt.Errorf("key %q: %w", key, err)
+		}
+		filter.conditions = append(filter.conditions, condition)
+		filter.args = append(filter.args, args...)
+	}
+	return filter, nil
+}
+
+// operatorCondition translates one operator applied to the field. Comparisons only match values of
+// the operand's type, so a number never matches a string that happens to sort near it.
+func (f filterField) operatorCondition(operator string, operand interface{}) (string, []interface{}, error) {
+	switch operator {
+	case "$eq":
+		return f.equalCondition(operand)
+	case "$ne":
+		condition, args, err := f.equalCondition(operand)
+		return "NOT COALESCE(" + condition + ", 0)", args, err
+	case "$in":
+		values, ok := operand.([]interface{})
+		if !ok || len(values) == 0 {
+			return "", nil, fmt.Errorf("$in needs a non-empty array")
+		}
+		var conditions []string
+		var args []interface{}
+		for _, value := range values {
+			condition, valueArgs, err := f.equalCondition(value)
+			if err != nil {
+				return "", nil, fmt.Errorf("$in: %w", err)
+			}
+			conditions = append(conditions, condition)
+			args = append(args, valueArgs...)
+		}
+		return "(" + strings.Join(conditions, " OR ") + ")", args, nil
+	case "$gt", "$gte", "$lt", "$lte":
+		comparison := map[string]string{"$gt": ">", "$gte": ">=", "$lt": "<", "$lte": "<="}[operator]
+		switch operand.(type) {
+		case float64:
+			condition, args := f.expand("({kind} IN ('integer', 'real') AND {value} "+comparison+" ?)", operand)
+			return condition, args, nil
+		case string:
+			condition, args := f.expand("({kind} = 'text' AND {value} "+comparison+" ?)", operand)
+			return condition, args, nil
+		}
+		return "", nil, fmt.Errorf("%s needs a number or a string", operator)
+	case "$contains":
+		// Arrays match an equal element, strings a substring
+		switch operand.(type) {
+		case float64:
+			condition, args := f.expand("(CASE {kind} WHEN 'array' THEN EXISTS (SELECT 1 FROM json_each({value}) WHERE json_each.value = ?) ELSE 0 END)", operand)
+			return condition, args, nil
+		case string:
+			condition, args := f.expand("(CASE {kind} WHEN 'array' THEN EXISTS (SELECT 1 FROM json_each({value}) WHERE json_each.value = ?) WHEN 'text' THEN instr({value}, ?) > 0 ELSE 0 END)", operand, operand)
+			return condition, args, nil
+		}
+		return "", nil, fmt.Errorf("$contains needs a number or a string")
+	}
+	return "", nil, fmt.Errorf("unknown operator %q; use $eq, $ne, $in, $gt, $gte, $lt, $lte or $contains", operator)
+}
+
+// equalCondition matches the field against a string, number or boolean. Arrays of strings or
+// numbers, such as extracted entities, match when they hold an equal element.
+func (f filterField) equalCondition(operand interface{}) (string, []interface{}, error) {
+	var condition string
+	var args []interface{}
+	switch operand := operand.(type) {
+	case string:
+		condition, args = f.expand("(CASE {kind} WHEN 'text' THEN {value} = ? WHEN 'array' THEN EXISTS (SELECT 1 FROM json_each({value}) WHERE json_each.type = 'text' AND json_each.value = ?) ELSE 0 END)", operand, operand)
+	case float64:
+		condition, args = f.expand("(CASE {kind} WHEN 'integer' THEN {value} = ? WHEN 'real' THEN {value} = ? WHEN 'array' THEN EXISTS (SELECT 1 FROM json_each({value}) WHERE json_each.type IN ('integer', 'real') AND json_each.value = ?) ELSE 0 END)", operand, operand, operand)
+	case bool:
+		condition, args = f.expand(fmt.Sprintf("{kind} = '%t'", operand))
+	default:
+		return "", nil, fmt.Errorf("values must be strings, numbers or booleans")
+	}
+	return condition, args, nil
+}
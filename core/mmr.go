@@ -0,0 +1,171 @@
+package core
+
+import (
+	"log"
+	"math"
+	"rag-go-app/models"
+)
+
+const (
+	defaultMMRLambda         = 0.5
+	defaultMMRCandidateRatio = 4 // Candidate pool size as a multiple of TopK
+)
+
+// mmrCandidatePool returns how many chunks to retrieve before MMR selects TopK of them
+func mmrCandidatePool(req *models.QueryRequest) int {
+	if req.MMRCandidates > req.TopK {
+		return req.MMRCandidates
+	}
+	return req.TopK * defaultMMRCandidateRatio
+}
+
+// selectMMR picks up to topK chunks by maximal marginal relevance: each step takes the candidate
+// maximizing lambda*relevance - (1-lambda)*max similarity to the chunks already selected.
+// Similarity uses stored embeddings and falls back to term overlap for chunks without one.
+// The returned indices point into chunks, in selection order.
+func (r *RAGService) selectMMR(chunks []*models.EnhancedChunk, relevance []float64, topK int, lambda float64) []int {
+	if lambda <= 0 || lambda > 1 {
+		lambda = defaultMMRLambda
+	}
+	if topK > len(chunks) {
+		topK = len(chunks)
+	}
+
+	ids := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		ids[i] = chunk.ID
+	}
+	embeddings, err := r.vectorDB.GetChunkEmbeddings(ids)
+	if err != nil {
+		log.Printf("MMR falling back to term overlap: %v", err)
+		embeddings = nil
+	}
+
+	terms := make([]map[string]bool, len(chunks))
+	similarity := func(a, b int) float64 {
+		ea, okA := embeddings[chunks[a].ID]
+		eb, okB := embeddings[chunks[b].ID]
+		if okA && okB {
+			return cosineSimilarity(ea, eb)
+		}
+		for _, i := range []int{a, b} {
+			if terms[i] == nil {
+				terms[i] = make(map[string]bool)
+				for _, term := range extractSearchTerms(chunks[i].Text) {
+					terms[i][term] = true
+				}
+			}
+		}
+		return jaccardSimilarity(terms[a], terms[b])
+	}
+
+	normalized := normalizeScores(relevance)
+	for len(normalized) < len(chunks) {
+		normalized = append(normalized, 0) // Chunks without a score rank last on relevance
+	}
+
+	selected := make([]int, 0, topK)
+	used := make([]bool, len(chunks))
+	maxSimilarity := make([]float64, len(chunks)) // Highest similarity to any selected chunk
+
+	for len(selected) < topK {
+		best := -1
+		bestScore := math.Inf(-1)
+		for i := range chunks {
+			if used[i] {
+				continue
+			}
+			score := lambda*normalized[i] - (1-lambda)*maxSimilarity[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		used[best] = true
+		selected = append(selected, best)
+
+		for i := range chunks {
+			if !used[i] {
+				maxSimilarity[i] = math.Max(maxSimilarity[i], similarity(best, i))
+			}
+		}
+	}
+
+	return selected
+}
+
+// pickChunks returns the chunks at the given indices, in that order
+func pickChunks(chunks []*models.EnhancedChunk, indices []int) []*models.EnhancedChunk {
+	picked := make([]*models.EnhancedChunk, len(indices))
+	for i, index := range indices {
+		picked[i] = chunks[index]
+	}
+	return picked
+}
+
+// pickScores returns the scores at the given indices, skipping indices past the end
+func pickScores(scores []float64, indices []int) []float64 {
+	picked := make([]float64, 0, len(indices))
+	for _, index := range indices {
+		if index < len(scores) {
+			picked = append(picked, scores[index])
+		}
+	}
+	return picked
+}
+
+// normalizeScores rescales scores to [0, 1] so relevance and similarity are comparable
+func normalizeScores(scores []float64) []float64 {
+	normalized := make([]float64, len(scores))
+	if len(scores) == 0 {
+		return normalized
+	}
+
+	minScore, maxScore := scores[0], scores[0]
+	for _, score := range scores {
+		minScore = math.Min(minScore, score)
+		maxScore = math.Max(maxScore, score)
+	}
+
+	for i, score := range scores {
+		if maxScore == minScore {
+			normalized[i] = 1
+		} else {
+			normalized[i] = (score - minScore) / (maxScore - minScore)
+		}
+	}
+	return normalized
+}
+
+// cosineSimilarity of two vectors; 0 when the dimensions differ or either vector is zero
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// jaccardSimilarity of two term sets
+func jaccardSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for term := range a {
+		if b[term] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
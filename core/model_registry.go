@@ -0,0 +1,170 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// dimensionProbeText is embedded to find the dimension of a model's embeddings
+const dimensionProbeText = "dimension probe"
+
+// dimensionProbeTimeout bounds the test call finding the dimension of a model's embeddings
+const dimensionProbeTimeout = 15 * time.Second
+
+// ModelRegistry persists the dimension of each embedding model's embeddings, so it is probed once
+// per model rather than once per start
+type ModelRegistry interface {
+	GetModelDimension(model string) (*ModelDimension, error)
+	PutModelDimension(model string, dimension ModelDimension) error
+}
+
+// ModelDimension is the dimension of a model's embeddings and when it was found
+type ModelDimension struct {
+	Dimension int
+	ProbedAt  time.Time
+}
+
+// ModelDimensionError reports embeddings whose dimension differs from the one recorded for their
+// model: the model server serves another model under the same name
+type ModelDimensionError struct {
+	Model    string
+	Recorded int
+	Got      int
+}
+
+func (e *ModelDimensionError) Error() string {
+	return fmt.Sprintf("embedding model %s returned %d dimensions, but %d were recorded for it; "+
+		"the model server serves another model under this name, so its embeddings can't be compared with earlier ones",
+		e.Model, e.Got, e.Recorded)
+}
+
+var modelRegistry ModelRegistry
+
+// SetModelRegistry installs the registry consulted for model dimensions. Passing nil keeps them in
+// memory only.
+func SetModelRegistry(registry ModelRegistry) {
+	modelRegistry = registry
+	modelDimensions.Lock()
+	modelDimensions.known = make(map[string]ModelDimension)
+	modelDimensions.Unlock()
+}
+
+// modelDimensions caches the dimensions known in this process. Its lock is held while a dimension
+// is probed, so concurrent callers wait for one probe.
+var modelDimensions = struct {
+	sync.Mutex
+	known map[string]ModelDimension
+}{known: make(map[string]ModelDimension)}
+
+// EmbeddingDimension returns the dimension of a model's embeddings, from memory, from the model
+// registry, or by embedding a test text. The probe bypasses the embedding cache; a failed probe is
+// tried again on the next call.
+func EmbeddingDimension(ctx context.Context, model string) (ModelDimension, error) {
+	modelDimensions.Lock()
+	defer modelDimensions.Unlock()
+	if known, ok := lookupModelDimension(model); ok {
+		return known, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dimensionProbeTimeout)
+	defer cancel()
+	embeddings, err := sendEmbeddingRequest(ctx, []string{dimensionProbeText}, model)
+	if err != nil {
+		return ModelDimension{}, fmt.Errorf("failed to probe the dimension of embedding model %s: %w", model, err)
+	}
+	if len(embeddings) == 0 || len(embeddings[0]) == 0 {
+		return ModelDimension{}, fmt.Errorf("failed to probe the dimension of embedding model %s: model server returned no embedding", model)
+	}
+	probed := ModelDimension{Dimension: len(embeddings[0]), ProbedAt: time.Now().UTC()}
+	recordModelDimension(model, probed)
+	return probed, nil
+}
+
+// checkModelDimension fails when embeddings differ in dimension from each other or from the
+// dimension recorded for their model. A model without a recorded dimension gets that of the
+// embeddings.
+func checkModelDimension(model string, embeddings [][]float32) error {
+	if len(embeddings) == 0 {
+		return nil
+	}
+	got := len(embeddings[0])
+	for _, embedding := range embeddings[1:] {
+		if len(embedding) != got {
+			return fmt.Errorf("embedding model %s returned embeddings of %d and %d dimensions in one response", model, got, len(embedding))
+		}
+	}
+
+	modelDimensions.Lock()
+	defer modelDimensions.Unlock()
+	known, ok := lookupModelDimension(model)
+	if !ok {
+		recordModelDimension(model, ModelDimension{Dimension: got, ProbedAt: time.Now().UTC()})
+		return nil
+	}
+	if known.Dimension != got {
+		err := &ModelDimensionError{Model: model, Recorded: known.Dimension, Got: got}
+		log.Printf("Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// lookupModelDimension returns the dimension known for a model, reading the registry on a miss.
+// The caller holds the lock of modelDimensions.
+func lookupModelDimension(model string) (ModelDimension, bool) {
+	if known, ok := modelDimensions.known[model]; ok {
+		return known, true
+	}
+	if modelRegistry == nil {
+		return ModelDimension{}, false
+	}
+	stored, err := modelRegistry.GetModelDimension(model)
+	if err != nil {
+		log.Printf("Warning: failed to read the dimension of embedding model %s: %v", model, err)
+		return ModelDimension{}, false
+	}
+	if stored == nil {
+		return ModelDimension{}, false
+	}
+	modelDimensions.known[model] = *stored
+	return *stored, true
+}
+
+// recordModelDimension keeps a model's dimension in memory and in the registry. The caller holds
+// the lock of modelDimensions.
+func recordModelDimension(model string, dimension ModelDimension) {
+	modelDimensions.known[model] = dimension
+	log.Printf("Embedding model %s has %d dimensions", model, dimension.Dimension)
+	if modelRegistry == nil {
+		return
+	}
+	if err := modelRegistry.PutModelDimension(model, dimension); err != nil {
+		log.Printf("Warning: failed to record the dimension of embedding model %s: %v", model, err)
+	}
+}
+
+// GetModelDimension returns the recorded dimension of a model, or nil if none is recorded
+func (db *VectorDB) GetModelDimension(model string) (*ModelDimension, error) {
+	var dimension ModelDimension
+	err := db.conn.QueryRow(`SELECT dimension, probed_at FROM embedding_models WHERE model = ?`, model).
+		Scan(&dimension.Dimension, &dimension.ProbedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dimension, nil
+}
+
+// PutModelDimension records the dimension of a model
+func (db *VectorDB) PutModelDimension(model string, dimension ModelDimension) error {
+	_, err := db.conn.Exec(`INSERT OR REPLACE INTO embedding_models (model, dimension, probed_at) VALUES (?, ?, ?)`,
+		model, dimension.Dimension, dimension.ProbedAt)
+	return err
+}
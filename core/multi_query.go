@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-go-app/core/retrieval"
+	"rag-go-app/models"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultExpansionQueries = 3
+	minExpansionQueries     = 2
+	maxExpansionQueries     = 4
+)
+
+// listMarkerPattern strips numbering and bullets an LLM puts in front of list items
+var listMarkerPattern = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*•])\s*`)
+
+// expansionQueryCount clamps the requested number of paraphrases to 2-4
+func expansionQueryCount(req *models.QueryRequest) int {
+	if req.ExpansionQueries <= 0 {
+		return defaultExpansionQueries
+	}
+	return min(max(req.ExpansionQueries, minExpansionQueries), maxExpansionQueries)
+}
+
+// generateQueryVariants asks the chat model for n paraphrases of query
+func (r *RAGService) generateQueryVariants(ctx context.Context, query string, n int) ([]string, error) {
+	prompt := fmt.Sprintf(`Rewrite the following search query in %d different ways to help retrieve relevant documents. Vary the wording and use synonyms or related terms, but keep the meaning.
+
+Output only the rewritten queries, one per line, without numbering or explanations.
+
+Query: %s`, n, query)
+
+	response, err := r.llmClient.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	variants := parseQueryVariants(response, query, n)
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("no paraphrases in model response")
+	}
+	return variants, nil
+}
+
+// parseQueryVariants extracts up to n distinct queries from a model response, one per line,
+// dropping list markers, surrounding quotes and repeats of the original query
+func parseQueryVariants(response, query string, n int) []string {
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(query)): true}
+	var variants []string
+
+	for _, line := range strings.Split(response, "\n") {
+		line = listMarkerPattern.ReplaceAllString(line, "")
+		line = strings.Trim(strings.TrimSpace(line), `"'`+"`")
+		key := strings.ToLower(line)
+		if line == "" || seen[key] || strings.HasSuffix(line, ":") {
+			continue
+		}
+		seen[key] = true
+		variants = append(variants, line)
+		if len(variants) == n {
+			break
+		}
+	}
+	return variants
+}
+
+// searchFunc runs one search for a query and returns chunks, aligned scores and degradations
+type searchFunc func(ctx context.Context, query string) ([]*models.EnhancedChunk, []float64, []string, error)
+
+// SearchMultiQuery retrieves topK chunks for each query and fuses the rankings with reciprocal
+// rank fusion. Chunks are ordered by fused rank; each keeps its best similarity score across
+// the queries so thresholds and re-ranking see comparable values.
+func (r *RAGService) SearchMultiQuery(ctx context.Context, collectionName string, queries []string, topK int, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, []string, error) {
+	return fuseQueries(ctx, queries, topK, func(ctx context.Context, query string) ([]*models.EnhancedChunk, []float64, []string, error) {
+		return r.SearchWithFallback(ctx, collectionName, query, topK, filters)
+	})
+}
+
+// fuseQueries runs search for each query and fuses the rankings as SearchMultiQuery describes
+func fuseQueries(ctx context.Context, queries []string, topK int, search searchFunc) ([]*models.EnhancedChunk, []float64, []string, error) {
+	var rankings []retrieval.Ranking
+	var degradations []string
+
+	for _, query := range queries {
+		chunks, scores, queryDegradations, err := search(ctx, query)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, degradation := range queryDegradations {
+			if !contains(degradations, degradation) {
+				degradations = append(degradations, degradation)
+			}
+		}
+		rankings = append(rankings, retrieval.NewRanking(query, chunks, scores))
+	}
+
+	fused := retrieval.ReciprocalRankFusion(rankings)
+	if len(fused) > topK {
+		fused = fused[:topK]
+	}
+	chunks, scores := fusedChunks(fused)
+
+	log.Printf("Fused %d queries into %d chunks", len(queries), len(chunks))
+	return chunks, scores, degradations, nil
+}
+
+// fusedChunks splits a fused ranking into chunks and their best scores
+func fusedChunks(fused []retrieval.Fused) ([]*models.EnhancedChunk, []float64) {
+	chunks := make([]*models.EnhancedChunk, len(fused))
+	scores := make([]float64, len(fused))
+	for i, entry := range fused {
+		chunks[i] = entry.Chunk
+		scores[i] = entry.BestScore
+	}
+	return chunks, scores
+}
@@ -0,0 +1,421 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// OCR engines selectable in the config
+const (
+	OCRTesseract = "tesseract"
+	OCRAPI       = "api"
+)
+
+// minTextLayerLength is the shortest text layer trusted for a PDF page; pages with less are scanned
+const minTextLayerLength = 20
+
+// ocrImageTypes maps the image extensions read by OCR to their MIME types
+var ocrImageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+}
+
+// ocrPage is the text of one page of a PDF or image
+type ocrPage struct {
+	Number     int // Starting at 1
+	Text       string
+	Recognized bool    // Read by OCR rather than from a PDF text layer
+	Confidence float64 // Mean word confidence of a recognized page, 0-100
+}
+
+// ocrStats reports what reading a scanned file did
+type ocrStats struct {
+	PagesRecognized     int
+	LowConfidenceChunks int
+}
+
+// recognizer returns the text of an image and its confidence, 0-100
+type recognizer func(ctx context.Context, imagePath string) (string, float64, error)
+
+// needsOCR reports whether a file is read page by page instead of as text
+func needsOCR(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".pdf" || ocrImageTypes[ext] != ""
+}
+
+// readScannedFile returns the pages of a PDF or image. PDF pages keep their text layer when they
+// have one; images and the other pages are recognized by the configured engine.
+func readScannedFile(ctx context.Context, path string) ([]ocrPage, error) {
+	settings := config.AppConfig.OCR
+	if !settings.Enabled {
+		return nil, fmt.Errorf("OCR is disabled; enable it in the config to add PDFs and images")
+	}
+	recognize, err := newRecognizer(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.ToLower(filepath.Ext(path)) == ".pdf" {
+		return readPDF(ctx, path, settings, recognize)
+	}
+
+	text, confidence, err := recognizeWithTimeout(ctx, settings, recognize, path)
+	if err != nil {
+		return nil, fmt.Errorf("OCR failed: %w", err)
+	}
+	return []ocrPage{{Number: 1, Text: text, Recognized: true, Confidence: confidence}}, nil
+}
+
+// newRecognizer returns the engine selected in the config
+func newRecognizer(settings config.OCRConfig) (recognizer, error) {
+	switch strings.ToLower(settings.Engine) {
+	case "", OCRTesseract:
+		return func(ctx context.Context, imagePath string) (string, float64, error) {
+			return recognizeWithTesseract(ctx, settings, imagePath)
+		}, nil
+	case OCRAPI:
+		if settings.APIURL == "" {
+			return nil, fmt.Errorf("OCR engine %q needs api_url", OCRAPI)
+		}
+		return func(ctx context.Context, imagePath string) (string, float64, error) {
+			return recognizeWithAPI(ctx, settings, imagePath)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown OCR engine %q (expected %q or %q)", settings.Engine, OCRTesseract, OCRAPI)
+}
+
+// recognizeWithTimeout recognizes one page within the configured time
+func recognizeWithTimeout(ctx context.Context, settings config.OCRConfig, recognize recognizer, imagePath string) (string, float64, error) {
+	ctx, cancel := withStageTimeout(ctx, settings.TimeoutSeconds)
+	defer cancel()
+	return recognize(ctx, imagePath)
+}
+
+// readPDF reads the text layer of every page and recognizes the pages that have none
+func readPDF(ctx context.Context, path string, settings config.OCRConfig, recognize recognizer) ([]ocrPage, error) {
+	textCtx, cancel := withStageTimeout(ctx, settings.TimeoutSeconds)
+	output, err := runOCRTool(textCtx, orDefault(settings.PDFToTextPath, "pdftotext"), "-enc", "UTF-8", path, "-")
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF text: %w", err)
+	}
+
+	if len(output) == 0 {
+		return nil, fmt.Errorf("PDF has no pages")
+	}
+	// pdftotext ends every page with a form feed
+	layers := strings.Split(strings.TrimSuffix(string(output), "\f"), "\f")
+
+	var workDir string
+	defer func() {
+		if workDir != "" {
+			os.RemoveAll(workDir)
+		}
+	}()
+
+	pages := make([]ocrPage, len(layers))
+	for i, layer := range layers {
+		pages[i] = ocrPage{Number: i + 1, Text: strings.TrimSpace(layer)}
+		if utf8.RuneCountInString(pages[i].Text) >= minTextLayerLength {
+			continue
+		}
+
+		if workDir == "" {
+			if workDir, err = os.MkdirTemp("", "rag-ocr-"); err != nil {
+				return nil, fmt.Errorf("failed to create OCR work directory: %w", err)
+			}
+		}
+		image, err := renderPDFPage(ctx, path, pages[i].Number, workDir, settings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render page %d: %w", pages[i].Number, err)
+		}
+		text, confidence, err := recognizeWithTimeout(ctx, settings, recognize, image)
+		if err != nil {
+			return nil, fmt.Errorf("OCR failed on page %d: %w", pages[i].Number, err)
+		}
+		os.Remove(image)
+		pages[i].Text, pages[i].Recognized, pages[i].Confidence = text, true, confidence
+	}
+	return pages, nil
+}
+
+// renderPDFPage renders one page to a PNG in dir and returns its path
+func renderPDFPage(ctx context.Context, path string, page int, dir string, settings config.OCRConfig) (string, error) {
+	dpi := settings.DPI
+	if dpi <= 0 {
+		dpi = 300
+	}
+	ctx, cancel := withStageTimeout(ctx, settings.TimeoutSeconds)
+	defer cancel()
+
+	prefix := filepath.Join(dir, fmt.Sprintf("page-%d", page))
+	number := strconv.Itoa(page)
+	_, err := runOCRTool(ctx, orDefault(settings.PDFToPPMPath, "pdftoppm"),
+		"-png", "-singlefile", "-r", strconv.Itoa(dpi), "-f", number, "-l", number, path, prefix)
+	if err != nil {
+		return "", err
+	}
+	return prefix + ".png", nil
+}
+
+// recognizeWithTesseract runs the Tesseract binary and reads its word boxes
+func recognizeWithTesseract(ctx context.Context, settings config.OCRConfig, imagePath string) (string, float64, error) {
+	output, err := runOCRTool(ctx, orDefault(settings.TesseractPath, "tesseract"),
+		imagePath, "stdout", "-l", orDefault(settings.Languages, "eng"), "tsv")
+	if err != nil {
+		return "", 0, err
+	}
+	text, confidence := parseTesseractTSV(string(output))
+	return text, confidence, nil
+}
+
+// parseTesseractTSV rebuilds the text from Tesseract's word boxes, a line per line and a blank line
+// between paragraphs, and averages the word confidences weighted by word length
+func parseTesseractTSV(tsv string) (string, float64) {
+	var text strings.Builder
+	var weighted, weight float64
+	lastParagraph, lastLine := "", ""
+
+	for _, row := range strings.Split(tsv, "\n") {
+		// level page_num block_num par_num line_num word_num left top width height conf text
+		fields := strings.Split(strings.TrimRight(row, "\r"), "\t")
+		if len(fields) < 12 || fields[0] != "5" {
+			continue
+		}
+		word := strings.TrimSpace(fields[11])
+		confidence, err := strconv.ParseFloat(fields[10], 64)
+		if word == "" || err != nil || confidence < 0 {
+			continue
+		}
+
+		paragraph := strings.Join(fields[1:4], ".")
+		line := paragraph + "." + fields[4]
+		switch {
+		case text.Len() == 0:
+		case paragraph != lastParagraph:
+			text.WriteString("\n\n")
+		case line != lastLine:
+			text.WriteString("\n")
+		default:
+			text.WriteString(" ")
+		}
+		text.WriteString(word)
+		lastParagraph, lastLine = paragraph, line
+
+		length := float64(utf8.RuneCountInString(word))
+		weighted += confidence * length
+		weight += length
+	}
+
+	if weight == 0 {
+		return "", 0
+	}
+	return text.String(), weighted / weight
+}
+
+// recognizeWithAPI posts the image to the OCR service, which answers with
+// {"text": "...", "confidence": 0-100}
+func recognizeWithAPI(ctx context.Context, settings config.OCRConfig, imagePath string) (string, float64, error) {
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, settings.APIURL, bytes.NewReader(image))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", ocrImageTypes[strings.ToLower(filepath.Ext(imagePath))])
+	if settings.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+settings.APIKey)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("OCR API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", 0, fmt.Errorf("OCR API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Text       string  `json:"text"`
+		Confidence float64 `json:"confidence"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", 0, fmt.Errorf("failed to decode OCR API response: %w", err)
+	}
+	return strings.TrimSpace(result.Text), result.Confidence, nil
+}
+
+// runOCRTool runs an external program and returns its standard output
+func runOCRTool(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("%s: %w", name, ctxErr)
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s: %w: %s", name, err, message)
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// processScannedDocument chunks the pages of a PDF or image as one text and records on every chunk
+// the pages it covers. Chunks covering a recognized page carry its confidence and are flagged when
+// it is below the configured minimum.
+func processScannedDocument(pages []ocrPage, source string, format string, docType string, chunkingConfig *models.ChunkingConfig) (*models.Document, ocrStats, error) {
+	var stats ocrStats
+	minConfidence := config.AppConfig.OCR.MinConfidence
+
+	// Byte range of each page in the joined text
+	var content strings.Builder
+	spans := make([][2]int, len(pages))
+	var confidenceSum float64
+	var lowPages []int
+	for i, page := range pages {
+		if page.Recognized {
+			stats.PagesRecognized++
+			confidenceSum += page.Confidence
+			if page.Confidence < minConfidence {
+				lowPages = append(lowPages, page.Number)
+			}
+		}
+		if page.Text == "" {
+			spans[i] = [2]int{-1, -1}
+			continue
+		}
+		if content.Len() > 0 {
+			content.WriteString("\n\n")
+		}
+		spans[i][0] = content.Len()
+		content.WriteString(page.Text)
+		spans[i][1] = content.Len()
+	}
+	if strings.TrimSpace(content.String()) == "" {
+		return nil, stats, fmt.Errorf("no text found on any of %d pages", len(pages))
+	}
+
+	doc, err := ProcessDocumentContent(content.String(), source, docType, chunkingConfig)
+	if err != nil {
+		return nil, stats, err
+	}
+	doc.Metadata["source_format"] = format
+	doc.Metadata["page_count"] = len(pages)
+	if stats.PagesRecognized > 0 {
+		doc.Metadata["ocr_engine"] = orDefault(strings.ToLower(config.AppConfig.OCR.Engine), OCRTesseract)
+		doc.Metadata["ocr_pages"] = stats.PagesRecognized
+		doc.Metadata["ocr_confidence"] = roundConfidence(confidenceSum / float64(stats.PagesRecognized))
+		if len(lowPages) > 0 {
+			doc.Metadata["ocr_low_confidence_pages"] = lowPages
+		}
+	}
+
+	text := content.String()
+	from := 0
+	for _, chunk := range doc.Chunks {
+		start, end := locateChunk(text, chunk, from)
+		from = start
+
+		var covered []int
+		confidences := make(map[string]float64)
+		lowest := math.Inf(1)
+		for i, page := range pages {
+			if spans[i][0] < 0 || spans[i][1] <= start || spans[i][0] >= end {
+				continue
+			}
+			covered = append(covered, page.Number)
+			if page.Recognized {
+				confidences[strconv.Itoa(page.Number)] = roundConfidence(page.Confidence)
+				lowest = math.Min(lowest, page.Confidence)
+			}
+		}
+		if len(covered) == 0 {
+			continue
+		}
+
+		if chunk.Metadata == nil {
+			chunk.Metadata = make(map[string]interface{})
+		}
+		chunk.Metadata["pages"] = covered
+		if len(confidences) > 0 {
+			chunk.Metadata["ocr_page_confidence"] = confidences
+			chunk.Metadata["ocr_confidence"] = roundConfidence(lowest)
+			chunk.Metadata["ocr_low_confidence"] = lowest < minConfidence
+			if lowest < minConfidence {
+				stats.LowConfidenceChunks++
+			}
+		}
+	}
+
+	if stats.PagesRecognized > 0 {
+		log.Printf("OCR read %d of %d pages of '%s' (mean confidence %.1f), %d chunks flagged as low confidence",
+			stats.PagesRecognized, len(pages), source, doc.Metadata["ocr_confidence"], stats.LowConfidenceChunks)
+	}
+	return doc, stats, nil
+}
+
+// locateChunk finds the byte range of a chunk in the text it was cut from, searching from the
+// previous chunk's start first. Chunks whose text was rewritten fall back to their rune positions.
+func locateChunk(text string, chunk *models.EnhancedChunk, from int) (int, int) {
+	prefix := strings.TrimSpace(chunk.Text)
+	if runes := []rune(prefix); len(runes) > 40 {
+		prefix = string(runes[:40])
+	}
+	if prefix != "" {
+		if index := strings.Index(text[from:], prefix); index >= 0 {
+			start := from + index
+			return start, min(start+len(chunk.Text), len(text))
+		}
+		if index := strings.Index(text, prefix); index >= 0 {
+			return index, min(index+len(chunk.Text), len(text))
+		}
+	}
+	return runeToByteOffset(text, chunk.StartPos), runeToByteOffset(text, chunk.EndPos)
+}
+
+// runeToByteOffset converts a rune offset into text to a byte offset
+func runeToByteOffset(text string, runes int) int {
+	for offset := range text {
+		if runes <= 0 {
+			return offset
+		}
+		runes--
+	}
+	return len(text)
+}
+
+// roundConfidence keeps one decimal of a confidence
+func roundConfidence(confidence float64) float64 {
+	return math.Round(confidence*10) / 10
+}
+
+// orDefault returns value, or fallback when it is empty
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"rag-go-app/models"
+	"strings"
+)
+
+// ollamaProvider talks to Ollama's native API. Its /api/embeddings endpoint takes a single prompt,
+// so a batch is sent one text at a time; batches still run in parallel up to EmbeddingConcurrency.
+type ollamaProvider struct {
+	baseURL string
+}
+
+// root returns the server root; a trailing /v1 left over from an OpenAI-compatible setup is
+// dropped since the native API lives under /api
+func (p ollamaProvider) root() string {
+	return strings.TrimSuffix(strings.TrimRight(p.baseURL, "/"), "/v1")
+}
+
+// Embed calls /api/embeddings once per text
+func (p ollamaProvider) Embed(ctx context.Context, texts []string, modelName string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		var resp models.OllamaEmbeddingResponse
+		if err := p.post(ctx, "/api/embeddings", models.OllamaEmbeddingRequest{Model: modelName, Prompt: text}, &resp); err != nil {
+			return nil, fmt.Errorf("embedding API request failed for text %d: %w", i, err)
+		}
+		if len(resp.Embedding) == 0 {
+			return nil, fmt.Errorf("embedding API returned no embedding for text %d", i)
+		}
+		embeddings[i] = resp.Embedding
+	}
+	return embeddings, nil
+}
+
+// ChatCompletion calls /api/chat without streaming
+func (p ollamaProvider) ChatCompletion(ctx context.Context, messages []models.ChatCompletionMessage, gen models.GenerationOptions) (string, error) {
+	req := models.OllamaChatRequest{Model: gen.Model, Messages: messages, Stream: false}
+	if gen.Temperature != nil || gen.TopP != nil || gen.MaxTokens > 0 {
+		req.Options = &models.OllamaOptions{Temperature: gen.Temperature, TopP: gen.TopP, NumPredict: gen.MaxTokens}
+	}
+	var resp models.OllamaChatResponse
+	err := p.post(ctx, "/api/chat", req, &resp)
+	if err != nil {
+		return "", fmt.Errorf("chat completion API request failed: %w", err)
+	}
+	if resp.Message.Content == "" {
+		return "", fmt.Errorf("no message returned from chat completion API")
+	}
+	return resp.Message.Content, nil
+}
+
+// post sends a JSON request to the Ollama server and decodes the response into out
+func (p ollamaProvider) post(ctx context.Context, path string, payload interface{}, out interface{}) error {
+	resp, err := p.open(ctx, path, payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Ollama response: %w", err)
+	}
+	return nil
+}
+
+// open sends a JSON request to the Ollama server and returns the response for the caller to read
+// and close. Ollama reports failures as {"error": "..."}, which is surfaced as the error message.
+func (p ollamaProvider) open(ctx context.Context, path string, payload interface{}) (*http.Response, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.root()+path, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Ollama: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return nil, &backendStatusError{resp.StatusCode, fmt.Sprintf("status %s: %s", resp.Status, apiErr.Error)}
+		}
+		return nil, &backendStatusError{resp.StatusCode, fmt.Sprintf("status %s: %s", resp.Status, string(body))}
+	}
+	return resp, nil
+}
@@ -0,0 +1,158 @@
+package parsers
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// headingStylePattern matches built-in heading style names such as "heading 1" or "Heading2"
+var headingStylePattern = regexp.MustCompile(`(?i)^heading\s*(\d)$`)
+
+// parseDOCX reads word/document.xml, using word/styles.xml to recognize heading styles
+func parseDOCX(archive *zip.Reader) (*Document, error) {
+	headingStyles := readDOCXHeadingStyles(archive)
+
+	entry, err := openZipEntry(archive, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer entry.Close()
+
+	decoder := xml.NewDecoder(entry)
+	var blocks []Block
+
+	var text strings.Builder
+	inParagraph := false
+	inText := false
+	level := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				inParagraph = true
+				text.Reset()
+				level = 0
+			case "pStyle":
+				if l, ok := headingStyles[attr(t, "val")]; ok {
+					level = l
+				} else if l, ok := headingLevelFromStyle(attr(t, "val")); ok {
+					level = l
+				}
+			case "outlineLvl":
+				// Direct outline levels are zero-based; 9 means body text
+				if l, err := strconv.Atoi(attr(t, "val")); err == nil && l < 9 && level == 0 {
+					level = l + 1
+				}
+			case "t":
+				inText = true
+			case "tab":
+				if inParagraph {
+					text.WriteString("\t")
+				}
+			case "br", "cr":
+				if inParagraph {
+					text.WriteString("\n")
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if level > 0 {
+					blocks = appendBlock(blocks, HeadingBlock, level, text.String())
+				} else {
+					blocks = appendBlock(blocks, ParagraphBlock, 0, text.String())
+				}
+				inParagraph = false
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+
+	return &Document{Format: "docx", Blocks: blocks}, nil
+}
+
+// readDOCXHeadingStyles maps style IDs to heading levels using their names and outline levels.
+// A missing or unreadable styles part is not an error; built-in style IDs are still recognized.
+func readDOCXHeadingStyles(archive *zip.Reader) map[string]int {
+	styles := make(map[string]int)
+
+	entry, err := openZipEntry(archive, "word/styles.xml")
+	if err != nil {
+		return styles
+	}
+	defer entry.Close()
+
+	decoder := xml.NewDecoder(entry)
+	styleID := ""
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return styles
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "style":
+				styleID = attr(t, "styleId")
+			case "name":
+				if l, ok := headingLevelFromStyle(attr(t, "val")); ok && styleID != "" {
+					styles[styleID] = l
+				}
+			case "outlineLvl":
+				if l, err := strconv.Atoi(attr(t, "val")); err == nil && l < 9 && styleID != "" {
+					if _, named := styles[styleID]; !named {
+						styles[styleID] = l + 1
+					}
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "style" {
+				styleID = ""
+			}
+		}
+	}
+}
+
+// headingLevelFromStyle recognizes "Title" and "Heading N" style names or IDs
+func headingLevelFromStyle(style string) (int, bool) {
+	if strings.EqualFold(style, "title") {
+		return 1, true
+	}
+	if matches := headingStylePattern.FindStringSubmatch(style); matches != nil {
+		l, _ := strconv.Atoi(matches[1])
+		if l > 0 {
+			return l, true
+		}
+	}
+	return 0, false
+}
+
+// attr returns the value of the attribute with the given local name
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
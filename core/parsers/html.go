@@ -0,0 +1,179 @@
+package parsers
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// htmlSkippedElements hold no body text: scripts and styles, embedded media, forms and the
+// navigation repeated on every page of a site
+var htmlSkippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "title": true,
+	"svg": true, "canvas": true, "iframe": true, "object": true,
+	"nav": true, "footer": true, "form": true, "button": true, "select": true,
+}
+
+// htmlBlockElements end the paragraph before them; their content starts a new one
+var htmlBlockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "aside": true, "header": true, "body": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"blockquote": true, "figure": true, "figcaption": true, "details": true, "summary": true,
+	"hr": true, "br": true,
+}
+
+// htmlHeadingLevel returns the level of an h1-h6 element, or 0 for other elements
+func htmlHeadingLevel(name string) int {
+	if len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6' {
+		return int(name[1] - '0')
+	}
+	return 0
+}
+
+// parseHTML reads the text of an HTML page. Headings are h1-h6 elements; tables are kept in one
+// block, a line per row with cells separated by " | ". When the page marks its content with
+// main or article elements, only their text is kept, leaving out the chrome around it. A page
+// header outside them is left out too.
+func parseHTML(r io.Reader) (*Document, error) {
+	tokenizer := html.NewTokenizer(r)
+	var blocks, mainBlocks []Block
+
+	var text strings.Builder
+	level := 0     // Level of the open heading; 0 in body text
+	pre := 0       // Nesting of pre elements, whose whitespace is kept
+	table := 0     // Nesting of tables
+	cells := 0     // Cells seen in the current table row
+	main := 0      // Nesting of main and article elements
+	skipTag := ""  // Element whose content is being skipped
+	skipDepth := 0 // Nesting of skipTag
+	flush := func() {
+		content := text.String()
+		text.Reset()
+		switch {
+		case pre > 0:
+		case table > 0:
+			var rows []string
+			for _, row := range strings.Split(content, "\n") {
+				if row = strings.Join(strings.Fields(row), " "); row != "" {
+					rows = append(rows, row)
+				}
+			}
+			content = strings.Join(rows, "\n")
+		default:
+			content = strings.Join(strings.Fields(content), " ")
+		}
+
+		kind := ParagraphBlock
+		if level > 0 {
+			kind = HeadingBlock
+		}
+		blocks = appendBlock(blocks, kind, level, content)
+		if main > 0 {
+			mainBlocks = appendBlock(mainBlocks, kind, level, content)
+		}
+	}
+
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return nil, err
+			}
+			flush()
+			if len(mainBlocks) > 0 {
+				blocks = mainBlocks
+			}
+			return &Document{Format: "html", Blocks: blocks}, nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			nameBytes, _ := tokenizer.TagName()
+			name := string(nameBytes)
+			opens := tokenType == html.StartTagToken
+			if skipTag != "" {
+				if name == skipTag && opens {
+					skipDepth++
+				}
+				continue
+			}
+			if htmlSkippedElements[name] || (name == "header" && main == 0) {
+				if opens {
+					skipTag, skipDepth = name, 1
+				}
+				continue
+			}
+
+			switch {
+			case !opens:
+				if htmlBlockElements[name] && table == 0 {
+					flush()
+				}
+			case htmlHeadingLevel(name) > 0 && table == 0:
+				flush()
+				level = htmlHeadingLevel(name)
+			case name == "table":
+				if table == 0 {
+					flush()
+				}
+				table++
+			case name == "tr":
+				cells = 0
+			case name == "td" || name == "th":
+				if cells > 0 {
+					text.WriteString(" | ")
+				}
+				cells++
+			case name == "pre":
+				flush()
+				pre++
+			case name == "main" || name == "article":
+				flush()
+				main++
+			case htmlBlockElements[name] && table == 0:
+				flush()
+			}
+
+		case html.EndTagToken:
+			nameBytes, _ := tokenizer.TagName()
+			name := string(nameBytes)
+			if skipTag != "" {
+				if name == skipTag {
+					if skipDepth--; skipDepth == 0 {
+						skipTag = ""
+					}
+				}
+				continue
+			}
+
+			switch {
+			case htmlHeadingLevel(name) > 0 && level > 0:
+				flush()
+				level = 0
+			case name == "table" && table > 0:
+				if table == 1 {
+					flush()
+				}
+				table--
+			case name == "tr" && table > 0:
+				text.WriteString("\n")
+			case name == "pre" && pre > 0:
+				flush()
+				pre--
+			case (name == "main" || name == "article") && main > 0:
+				flush()
+				main--
+			case htmlBlockElements[name] && table == 0:
+				flush()
+			}
+
+		case html.TextToken:
+			if skipTag == "" {
+				text.Write(tokenizer.Text())
+				if table > 0 {
+					text.WriteString(" ")
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package parsers
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseODT reads content.xml of an OpenDocument text file. Headings are text:h elements
+// whose text:outline-level gives the level.
+func parseODT(archive *zip.Reader) (*Document, error) {
+	entry, err := openZipEntry(archive, "content.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer entry.Close()
+
+	decoder := xml.NewDecoder(entry)
+	var blocks []Block
+
+	var text strings.Builder
+	depth := 0 // Nesting of text:p/text:h; paragraphs can contain notes with their own paragraphs
+	level := 0
+	skip := 0 // Nesting inside elements whose text is not part of the body
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skip > 0 {
+				skip++
+				continue
+			}
+			switch t.Name.Local {
+			case "annotation", "note", "tracked-changes":
+				skip = 1
+			case "h":
+				if depth == 0 {
+					text.Reset()
+					level = 1
+					if l, err := strconv.Atoi(attr(t, "outline-level")); err == nil && l > 0 {
+						level = l
+					}
+				}
+				depth++
+			case "p":
+				if depth == 0 {
+					text.Reset()
+					level = 0
+				}
+				depth++
+			case "s":
+				// text:s encodes runs of spaces
+				count := 1
+				if c, err := strconv.Atoi(attr(t, "c")); err == nil && c > 0 {
+					count = c
+				}
+				text.WriteString(strings.Repeat(" ", count))
+			case "tab":
+				text.WriteString("\t")
+			case "line-break":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			switch t.Name.Local {
+			case "h", "p":
+				depth--
+				if depth == 0 {
+					if level > 0 {
+						blocks = appendBlock(blocks, HeadingBlock, level, text.String())
+					} else {
+						blocks = appendBlock(blocks, ParagraphBlock, 0, text.String())
+					}
+				}
+			}
+		case xml.CharData:
+			if skip == 0 && depth > 0 {
+				text.Write(t)
+			}
+		}
+	}
+
+	return &Document{Format: "odt", Blocks: blocks}, nil
+}
@@ -0,0 +1,180 @@
+// Package parsers extracts text and heading structure from document formats such as Word, ODF and HTML
+// so chunking can follow the document's real outline instead of regex heuristics.
+package parsers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsupportedFormat is returned for file extensions without a parser
+var ErrUnsupportedFormat = errors.New("unsupported document format")
+
+// BlockKind distinguishes headings from body text
+type BlockKind string
+
+const (
+	HeadingBlock   BlockKind = "heading"
+	ParagraphBlock BlockKind = "paragraph"
+)
+
+// Block is one heading or paragraph in reading order
+type Block struct {
+	Kind  BlockKind
+	Level int // Heading level starting at 1; 0 for paragraphs
+	Text  string
+}
+
+// Document is the parsed content of a file
+type Document struct {
+	Format string // e.g. "docx", "odt", "html"
+	Blocks []Block
+}
+
+// blockSeparator separates blocks in Text; offsets reported by Sections assume it
+const blockSeparator = "\n\n"
+
+// Text returns the plain text of the document with blocks separated by blank lines
+func (d *Document) Text() string {
+	parts := make([]string, len(d.Blocks))
+	for i, block := range d.Blocks {
+		parts[i] = block.Text
+	}
+	return strings.Join(parts, blockSeparator)
+}
+
+// HasHeadings reports whether the document contains at least one heading
+func (d *Document) HasHeadings() bool {
+	for _, block := range d.Blocks {
+		if block.Kind == HeadingBlock {
+			return true
+		}
+	}
+	return false
+}
+
+// Section is a heading together with the body text that follows it up to the next heading
+type Section struct {
+	Path     []string // Titles of the enclosing headings, outermost first, ending with this heading
+	Level    int      // Level of the heading; 0 for text before the first heading
+	Content  string   // Heading line followed by its body, as it appears in Text
+	StartPos int      // Byte offset of Content in Text
+}
+
+// Sections splits the document at every heading. Text before the first heading becomes a
+// section with an empty path.
+func (d *Document) Sections() []Section {
+	var sections []Section
+	var path []string
+	var levels []int
+
+	current := -1
+	offset := 0
+	for i, block := range d.Blocks {
+		if i > 0 {
+			offset += len(blockSeparator)
+		}
+
+		if block.Kind == HeadingBlock {
+			// Pop headings at the same or a deeper level
+			for len(levels) > 0 && levels[len(levels)-1] >= block.Level {
+				levels = levels[:len(levels)-1]
+				path = path[:len(path)-1]
+			}
+			levels = append(levels, block.Level)
+			path = append(path, block.Text)
+
+			sections = append(sections, Section{
+				Path:     append([]string(nil), path...),
+				Level:    block.Level,
+				Content:  block.Text,
+				StartPos: offset,
+			})
+			current = len(sections) - 1
+		} else if current < 0 {
+			sections = append(sections, Section{Content: block.Text, StartPos: offset})
+			current = 0
+		} else {
+			sections[current].Content += blockSeparator + block.Text
+		}
+
+		offset += len(block.Text)
+	}
+
+	return sections
+}
+
+// Supports reports whether a parser exists for the file's extension
+func Supports(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".docx", ".odt", ".html", ".htm":
+		return true
+	}
+	return false
+}
+
+// ParseFile parses a document, choosing the parser by file extension
+func ParseFile(path string) (*Document, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if !Supports(path) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, ext)
+	}
+
+	if ext == ".html" || ext == ".htm" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer file.Close()
+		doc, err := parseHTML(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return doc, nil
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s as a zip archive: %w", path, err)
+	}
+	defer archive.Close()
+
+	var doc *Document
+	switch ext {
+	case ".docx":
+		doc, err = parseDOCX(&archive.Reader)
+	case ".odt":
+		doc, err = parseODT(&archive.Reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// openZipEntry opens a named entry in the archive
+func openZipEntry(archive *zip.Reader, name string) (io.ReadCloser, error) {
+	for _, file := range archive.File {
+		if file.Name == name {
+			return file.Open()
+		}
+	}
+	return nil, fmt.Errorf("archive entry %s not found", name)
+}
+
+// appendBlock adds a block, dropping empty paragraphs and collapsing whitespace-only text
+func appendBlock(blocks []Block, kind BlockKind, level int, text string) []Block {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return blocks
+	}
+	if kind == HeadingBlock && level < 1 {
+		level = 1
+	}
+	return append(blocks, Block{Kind: kind, Level: level, Text: text})
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+	"time"
+)
+
+// Supported values of the provider config setting
+const (
+	ProviderOpenAI = "openai" // OpenAI-compatible API, as served by llama.cpp, vLLM or OpenAI itself
+	ProviderOllama = "ollama" // Ollama's native API
+)
+
+// Provider is a model server that computes embeddings and chat completions
+type Provider interface {
+	// Embed returns one embedding per text, in order
+	Embed(ctx context.Context, texts []string, modelName string) ([][]float32, error)
+	// ChatCompletion returns the assistant's reply to messages, generated by gen.Model with the
+	// sampling parameters gen sets
+	ChatCompletion(ctx context.Context, messages []models.ChatCompletionMessage, gen models.GenerationOptions) (string, error)
+	// StreamChatCompletion generates the reply like ChatCompletion, passing each piece of it to
+	// onToken as it is generated
+	StreamChatCompletion(ctx context.Context, messages []models.ChatCompletionMessage, gen models.GenerationOptions, onToken func(string)) error
+	// Ping checks that the server answers, without running a model
+	Ping(ctx context.Context) error
+}
+
+// openAIProvider talks to an OpenAI-compatible server
+type openAIProvider struct {
+	baseURL string
+}
+
+// CurrentProvider returns the provider selected in the config for the server at llamacpp_base_url;
+// an empty setting means OpenAI-compatible
+func CurrentProvider() (Provider, error) {
+	return providerAt(config.AppConfig.LlamaCPPBaseURL)
+}
+
+// providerAt returns the provider selected in the config for the server at baseURL
+func providerAt(baseURL string) (Provider, error) {
+	switch strings.ToLower(config.AppConfig.Provider) {
+	case "", ProviderOpenAI:
+		return openAIProvider{baseURL: baseURL}, nil
+	case ProviderOllama:
+		return ollamaProvider{baseURL: baseURL}, nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q (expected %q or %q)", config.AppConfig.Provider, ProviderOpenAI, ProviderOllama)
+	}
+}
+
+// withStageTimeout bounds one call to a backend by the configured number of seconds, if positive
+func withStageTimeout(ctx context.Context, seconds int) (context.Context, context.CancelFunc) {
+	if seconds <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+}
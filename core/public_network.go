@@ -0,0 +1,77 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned when a request whose destination a client chose would reach the
+// server's own network: a loopback, private, link-local or otherwise non-public address
+var ErrPrivateAddress = errors.New("destination is not a public address")
+
+// nonPublicPrefixes are the ranges IsGlobalUnicast and IsPrivate leave in that are not public
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This network", which reaches the local host
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT, where some clouds serve instance metadata
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which embeds any IPv4 address
+}
+
+// publicAddress reports whether an address is on the public internet
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPublicHost refuses a host that names a non-public address outright: an IP literal or
+// localhost. Other names are checked when they are dialed, against the addresses they resolve to.
+func checkPublicHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil && !publicAddress(addr) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// newPublicTransport returns a transport that only connects to public addresses, for requests
+// whose URL a client chose. The check runs on the address each connection is made to, after name
+// resolution, so names resolving to private addresses and redirects to them are refused as well.
+// It uses no proxy, as the address connected to would then be the proxy's.
+func newPublicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, address)
+			}
+			if !publicAddress(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"testing"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":              true,
+		"2606:4700::1111":      true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"fe80::1":              false,
+		"fd00::1":              false,
+		"0.0.0.0":              false,
+		"::":                   false,
+		"100.100.100.200":      false,
+		"224.0.0.1":            false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:169.254.169.1": false,
+		"64:ff9b::a00:1":       false,
+	}
+	for address, want := range tests {
+		if got := publicAddress(netip.MustParseAddr(address)); got != want {
+			t.Errorf("publicAddress(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestPublicTransportRefusesPrivateAddresses(t *testing.T) {
+	private := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal secrets"))
+	}))
+	defer private.Close()
+
+	client := &http.Client{Transport: newPublicTransport()}
+	if _, err := client.Get(private.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("GET %s: got %v, want ErrPrivateAddress", private.URL, err)
+	}
+
+	// A name resolving to a loopback address is refused when dialed
+	u, _ := url.Parse(private.URL)
+	if _, err := client.Get("http://localhost:" + u.Port()); !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("GET via localhost: got %v, want ErrPrivateAddress", err)
+	}
+}
+
+func TestCrawlerRefusesPrivateAddresses(t *testing.T) {
+	saved := config.AppConfig.Crawler
+	t.Cleanup(func() { config.AppConfig.Crawler = saved })
+	config.AppConfig.Crawler = config.CrawlerConfig{}
+
+	for _, start := range []string{"http://127.0.0.1/", "http://169.254.169.254/latest/meta-data/",
+		"http://[::1]:8080/", "http://localhost/", "http://10.0.0.5/sitemap.xml"} {
+		if err := ValidateCrawlRequest(&models.CrawlRequest{SeedURL: start}); !errors.Is(err, ErrInvalidCrawl) {
+			t.Errorf("ValidateCrawlRequest(%s) = %v, want ErrInvalidCrawl", start, err)
+		}
+	}
+
+	// Pages, and the robots.txt read before them, are fetched through the guarded client
+	var requests int
+	private := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer private.Close()
+	crawler := newWebCrawler(config.AppConfig.Crawler)
+	u, _ := url.Parse(private.URL)
+	if _, err := crawler.fetch(context.Background(), u); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("fetch: got %v, want ErrPrivateAddress", err)
+	}
+	rules, err := crawler.robotsFor(context.Background(), u)
+	if err != nil || !rules.disallowed {
+		t.Errorf("robotsFor: got %+v, %v; want everything disallowed", rules, err)
+	}
+	if requests != 0 {
+		t.Errorf("the private server received %d requests", requests)
+	}
+
+	// Operators can open crawls to their own networks
+	config.AppConfig.Crawler.AllowPrivateNetworks = true
+	if err := ValidateCrawlRequest(&models.CrawlRequest{SeedURL: private.URL}); err != nil {
+		t.Errorf("ValidateCrawlRequest with private networks allowed: %v", err)
+	}
+	if _, err := newWebCrawler(config.AppConfig.Crawler).fetch(context.Background(), u); err != nil {
+		t.Errorf("fetch with private networks allowed: %v", err)
+	}
+}
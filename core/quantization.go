@@ -0,0 +1,280 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"rag-go-app/models"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultRescoreOversample is the number of quantized candidates rescored per requested result
+const defaultRescoreOversample = 4
+
+// quantizedStore describes the vec0 tables holding the embeddings of collections quantized one way,
+// one per dimension
+type quantizedStore struct {
+	table    string // Prefix of the table names, followed by _<dimension>
+	column   string // vec0 element type
+	quantize string // SQL turning the float32 vector %s into the stored type
+	cast     string // SQL function marking a blob read back from the table as the stored type
+}
+
+var quantizedStores = map[models.QuantizationType]quantizedStore{
+	// 'unit' maps [-1, 1] onto the int8 range and wraps outside it, so vectors are normalized first
+	models.QuantizationInt8:   {"chunk_embeddings_int8", "INT8", "vec_quantize_int8(vec_normalize(%s), 'unit')", "vec_int8"},
+	models.QuantizationBinary: {"chunk_embeddings_bit", "BIT", "vec_quantize_binary(%s)", "vec_bit"},
+}
+
+// quantizationTypes fixes the order quantized tables are visited in
+var quantizationTypes = []models.QuantizationType{models.QuantizationInt8, models.QuantizationBinary}
+
+// quantizedDimensionPattern reads the dimension of a quantized table from its schema
+var quantizedDimensionPattern = regexp.MustCompile(`(?i)(?:INT8|BIT)\[(\d+)\]`)
+
+// storesFloatEmbeddings reports whether a collection keeps float32 vectors: unquantized ones
+// search them, quantized ones only keep them to rescore
+func storesFloatEmbeddings(quantization *models.QuantizationConfig) bool {
+	return quantization == nil || quantization.Rescore
+}
+
+// rescoreOversample returns how many quantized candidates are rescored per requested result
+func rescoreOversample(quantization *models.QuantizationConfig) int {
+	if quantization.Oversample > 0 {
+		return quantization.Oversample
+	}
+	return defaultRescoreOversample
+}
+
+// collectionQuantization returns the quantization a collection was created with, or nil when it
+// stores float32 vectors only
+func (db *VectorDB) collectionQuantization(q queryRower, collectionName string) (*models.QuantizationConfig, error) {
+	metadata, err := db.readCollectionMetadata(q, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.Quantization, nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// createQuantizedTable creates the table of a quantization type for embeddings of the given dimension
+func createQuantizedTable(exec execer, quantizationType models.QuantizationType, dimension int) error {
+	if quantizationType == models.QuantizationBinary && dimension%8 != 0 {
+		return fmt.Errorf("binary quantization needs an embedding dimension divisible by 8, got %d", dimension)
+	}
+	store := quantizedStores[quantizationType]
+	_, err := exec.Exec(fmt.Sprintf(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS %s USING vec0(%s
+			chunk_id TEXT PRIMARY KEY,
+			embedding %s[%d]
+		)`, quantizedEmbeddingTable(quantizationType, dimension), embeddingPartitionColumns, store.column, dimension))
+	if err != nil {
+		return fmt.Errorf("failed to create %s embedding table with dimension %d: %w", quantizationType, dimension, err)
+	}
+	return nil
+}
+
+// embeddingInserts returns the statements writing one embedding of the given dimension, given as
+// tenant, collection, chunk ID and float32 blob, to the tables of a collection with the given quantization
+func embeddingInserts(quantization *models.QuantizationConfig, dimension int) []string {
+	const columns = ` (tenant_id, collection_name, chunk_id, embedding) VALUES (?, ?, ?, `
+	var inserts []string
+	if storesFloatEmbeddings(quantization) {
+		inserts = append(inserts, `INSERT OR REPLACE INTO `+floatEmbeddingTable(dimension)+columns+`?)`)
+	}
+	if quantization != nil {
+		store := quantizedStores[quantization.Type]
+		inserts = append(inserts, `INSERT OR REPLACE INTO `+quantizedEmbeddingTable(quantization.Type, dimension)+columns+fmt.Sprintf(store.quantize, "?")+`)`)
+	}
+	return inserts
+}
+
+// embeddedChunksSQL selects the IDs of all chunks with an embedding in any of the given tables
+func embeddedChunksSQL(tables []embeddingTable) string {
+	selects := make([]string, len(tables))
+	for i, table := range tables {
+		selects[i] = "SELECT chunk_id FROM " + table.name
+	}
+	return strings.Join(selects, " UNION ")
+}
+
+// deleteEmbeddings deletes the embeddings whose chunk_id matches the where clause from every
+// embedding table, quantized or not
+func (db *VectorDB) deleteEmbeddings(tx *sql.Tx, where string, args ...interface{}) error {
+	tables, err := existingEmbeddingTables(tx)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if _, err := tx.Exec(`DELETE FROM `+table.name+` WHERE `+where, args...); err != nil {
+			return fmt.Errorf("failed to delete chunk embeddings: %w", err)
+		}
+	}
+	return nil
+}
+
+// copyEmbeddings copies the embeddings of chunk from to chunk to in every embedding table, in the
+// partition of to's collection. Quantized vectors lose their type when selected, so they are read
+// back and marked with it again.
+func (db *VectorDB) copyEmbeddings(tx *sql.Tx, from, to string) error {
+	tables, err := existingEmbeddingTables(tx)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		value := "?"
+		if table.quantization != "" {
+			value = quantizedStores[table.quantization].cast + "(?)"
+		}
+
+		var blob []byte
+		err := tx.QueryRow(`SELECT embedding FROM `+table.name+` WHERE chunk_id = ?`, from).Scan(&blob)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read embedding: %w", err)
+		}
+		_, err = tx.Exec(`INSERT INTO `+table.name+` (tenant_id, collection_name, chunk_id, embedding)
+			SELECT tenant_id, collection_name, id, `+value+` FROM enhanced_chunks WHERE id = ?`, blob, to)
+		if err != nil {
+			return fmt.Errorf("failed to copy embedding: %w", err)
+		}
+	}
+	return nil
+}
+
+// quantizedSimilarity converts a distance in a quantized table into the similarity scale of
+// unquantized search, 1 - L2 distance between normalized vectors. int8 scales the normalized
+// vector by 127.5; the Hamming distance between sign bits estimates the angle between vectors.
+func quantizedSimilarity(quantizationType models.QuantizationType, distance float64, dimension int) float64 {
+	if quantizationType == models.QuantizationBinary {
+		if dimension == 0 {
+			return 0
+		}
+		cosine := math.Cos(math.Pi * distance / float64(dimension))
+		return 1 - math.Sqrt(math.Max(0, 2-2*cosine))
+	}
+	return 1 - distance/127.5
+}
+
+// dequantize approximates the normalized vector a quantized embedding was made from
+func dequantize(quantizationType models.QuantizationType, blob []byte, dimension int) []float32 {
+	if quantizationType == models.QuantizationBinary {
+		embedding := make([]float32, dimension)
+		magnitude := float32(1 / math.Sqrt(float64(dimension)))
+		for i := range embedding {
+			if i/8 < len(blob) && blob[i/8]&(1<<(i%8)) != 0 {
+				embedding[i] = magnitude
+			} else {
+				embedding[i] = -magnitude
+			}
+		}
+		return embedding
+	}
+
+	embedding := make([]float32, len(blob))
+	for i, b := range blob {
+		embedding[i] = float32((float64(int8(b))+128)*2/255 - 1)
+	}
+	return embedding
+}
+
+// quantizedEmbeddings returns approximations of the embeddings of the given chunks that are only
+// stored quantized, keyed by chunk ID
+func (db *VectorDB) quantizedEmbeddings(chunkIDs []string) (map[string][]float32, error) {
+	embeddings := make(map[string][]float32)
+	if len(chunkIDs) == 0 {
+		return embeddings, nil
+	}
+	tables, err := existingEmbeddingTables(db.conn)
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunkIDs)), ",")
+	args := make([]interface{}, len(chunkIDs))
+	for i, id := range chunkIDs {
+		args[i] = id
+	}
+	args = append(args, db.tenant)
+
+	for _, table := range tables {
+		if table.quantization == "" {
+			continue
+		}
+
+		rows, err := db.conn.Query(`SELECT c.id, e.embedding
+			FROM enhanced_chunks c
+			CROSS JOIN `+table.name+` e ON e.chunk_id = c.id
+			WHERE c.id IN (`+placeholders+`) AND c.tenant_id = ?`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up quantized chunk embeddings: %w", err)
+		}
+		for rows.Next() {
+			var id string
+			var blob []byte
+			if err := rows.Scan(&id, &blob); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan quantized chunk embedding: %w", err)
+			}
+			embeddings[id] = dequantize(table.quantization, blob, table.dimension)
+		}
+		rows.Close()
+	}
+	return embeddings, nil
+}
+
+// rescoreChunks ranks the candidates of a quantized search again by the exact distance between
+// their float32 vectors, of the given dimension, and the query, and keeps the topK best. Candidates
+// without a float32 vector keep their approximate score.
+func (db *VectorDB) rescoreChunks(chunks []*models.EnhancedChunk, scores []float64, queryBlob []byte, dimension, topK int) ([]*models.EnhancedChunk, []float64, error) {
+	if len(chunks) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunks)), ",")
+		args := []interface{}{queryBlob}
+		for _, chunk := range chunks {
+			args = append(args, chunk.ID)
+		}
+
+		rows, err := db.conn.Query(`SELECT c.id, vec_distance_l2(e.embedding, ?)
+			FROM enhanced_chunks c
+			CROSS JOIN `+floatEmbeddingTable(dimension)+` e ON e.chunk_id = c.id
+			WHERE c.id IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to rescore chunks: %w", err)
+		}
+		exact := make(map[string]float64, len(chunks))
+		for rows.Next() {
+			var id string
+			var distance float64
+			if err := rows.Scan(&id, &distance); err != nil {
+				rows.Close()
+				return nil, nil, fmt.Errorf("failed to scan rescored chunk: %w", err)
+			}
+			exact[id] = 1 - distance
+		}
+		rows.Close()
+
+		for i, chunk := range chunks {
+			if score, ok := exact[chunk.ID]; ok {
+				scores[i] = score
+			}
+		}
+	}
+
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	if len(order) > topK {
+		order = order[:topK]
+	}
+	return pickChunks(chunks, order), pickScores(scores, order), nil
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"rag-go-app/models"
+	"testing"
+)
+
+// normalized returns v scaled to unit length
+func normalized(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(float64(x) / math.Sqrt(sum))
+	}
+	return out
+}
+
+// quantizedPair is a vector and its neighbour, quantized as the embedding tables store them
+type quantizedPair struct {
+	a, b       []float32 // Normalized
+	int8A      []byte
+	int8B      []byte
+	int8L2     float64 // Distance between int8A and int8B in their table
+	bitA, bitB []byte
+	hamming    float64
+}
+
+// quantizePairs quantizes count pairs of vectors of the given dimension with the SQL functions
+// embeddings are stored with. Half the pairs are unrelated vectors, half near duplicates.
+func quantizePairs(t *testing.T, db *VectorDB, rng *rand.Rand, count, dimension int) []quantizedPair {
+	t.Helper()
+	quantize := func(v []float32) ([]byte, []byte) {
+		blob, err := serializeEmbedding(v)
+		if err != nil {
+			t.Fatalf("serializeEmbedding: %v", err)
+		}
+		var int8Blob, bitBlob []byte
+		if err := db.conn.QueryRow(`SELECT `+quantizeSQL(models.QuantizationInt8)+`, `+quantizeSQL(models.QuantizationBinary),
+			blob, blob).Scan(&int8Blob, &bitBlob); err != nil {
+			t.Fatalf("quantize: %v", err)
+		}
+		return int8Blob, bitBlob
+	}
+
+	pairs := make([]quantizedPair, count)
+	vectors := randomVectors(rng, 2*count, dimension)
+	for i := range pairs {
+		a, b := vectors[2*i], vectors[2*i+1]
+		if i%2 == 1 {
+			for j := range b {
+				b[j] = a[j] + 0.2*b[j]
+			}
+		}
+		p := &pairs[i]
+		// The stored vectors are not normalized; int8 quantization normalizes them itself
+		p.int8A, p.bitA = quantize(a)
+		p.int8B, p.bitB = quantize(b)
+		p.a, p.b = normalized(a), normalized(b)
+		if err := db.conn.QueryRow(`SELECT vec_distance_l2(vec_int8(?), vec_int8(?)), vec_distance_hamming(vec_bit(?), vec_bit(?))`,
+			p.int8A, p.int8B, p.bitA, p.bitB).Scan(&p.int8L2, &p.hamming); err != nil {
+			t.Fatalf("distance: %v", err)
+		}
+	}
+	return pairs
+}
+
+// quantizeSQL returns the SQL quantizing the float32 vector bound to the next placeholder
+func quantizeSQL(quantizationType models.QuantizationType) string {
+	return fmt.Sprintf(quantizedStores[quantizationType].quantize, "?")
+}
+
+func TestQuantizationErrorBounds(t *testing.T) {
+	db := newTestDB(t)
+	rng := rand.New(rand.NewSource(3))
+	// One int8 step: 'unit' quantization maps [-1, 1] onto 255 steps
+	const step = 2.0 / 255
+
+	for _, dimension := range []int{64, 256, 768} {
+		pairs := quantizePairs(t, db, rng, 100, dimension)
+		var binaryError float64
+		for _, p := range pairs {
+			exact := 1 - math.Sqrt(float64(l2Squared(p.a, p.b)))
+
+			// Each int8 component is within a step of the normalized vector's
+			a, b := dequantize(models.QuantizationInt8, p.int8A, dimension), dequantize(models.QuantizationInt8, p.int8B, dimension)
+			for i := range a {
+				if err := math.Abs(float64(a[i] - p.a[i])); err > step+1e-6 {
+					t.Fatalf("dimension %d: int8 component %d is off by %.5f, more than a step", dimension, i, err)
+				}
+			}
+			// The similarity of int8 distances is that of the dequantized vectors, so it is off by at
+			// most the length of the difference of their errors
+			similarity := quantizedSimilarity(models.QuantizationInt8, p.int8L2, dimension)
+			if dequantized := 1 - math.Sqrt(float64(l2Squared(a, b))); math.Abs(similarity-dequantized) > 1e-4 {
+				t.Errorf("dimension %d: int8 similarity %.5f, but the dequantized vectors are %.5f apart", dimension, similarity, dequantized)
+			}
+			if bound := math.Sqrt(float64(dimension)) * step; math.Abs(similarity-exact) > bound {
+				t.Errorf("dimension %d: int8 similarity %.4f, exact %.4f, off by more than %.4f", dimension, similarity, exact, bound)
+			}
+
+			// Sign bits keep each component's sign, at the magnitude of a unit vector
+			bits := dequantize(models.QuantizationBinary, p.bitA, dimension)
+			var length float64
+			for i, x := range bits {
+				if (x > 0) != (p.a[i] > 0) {
+					t.Fatalf("dimension %d: binary component %d has the wrong sign", dimension, i)
+				}
+				length += float64(x) * float64(x)
+			}
+			if math.Abs(length-1) > 1e-4 {
+				t.Errorf("dimension %d: dequantized binary vector has length %.5f, want 1", dimension, math.Sqrt(length))
+			}
+			binaryError += math.Abs(quantizedSimilarity(models.QuantizationBinary, p.hamming, dimension) - exact)
+		}
+		// The Hamming distance estimates the angle with an error shrinking with the square root of the
+		// dimension
+		if mean, bound := binaryError/float64(len(pairs)), 1.5/math.Sqrt(float64(dimension)); mean > bound {
+			t.Errorf("dimension %d: binary similarity off by %.4f on average, more than %.4f", dimension, mean, bound)
+		}
+	}
+}
+
+func TestQuantizedSimilarityExtremes(t *testing.T) {
+	tests := []struct {
+		name             string
+		quantizationType models.QuantizationType
+		distance         float64
+		dimension        int
+		want             float64
+	}{
+		{"int8 identical", models.QuantizationInt8, 0, 64, 1},
+		{"int8 opposite", models.QuantizationInt8, 2 * 127.5, 64, -1},
+		{"binary identical", models.QuantizationBinary, 0, 64, 1},
+		{"binary opposite", models.QuantizationBinary, 64, 64, -1},
+		{"binary orthogonal", models.QuantizationBinary, 32, 64, 1 - math.Sqrt2},
+		{"binary without dimension", models.QuantizationBinary, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := quantizedSimilarity(tt.quantizationType, tt.distance, tt.dimension); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: quantizedSimilarity() = %.6f, want %.6f", tt.name, got, tt.want)
+		}
+	}
+}
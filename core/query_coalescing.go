@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"rag-go-app/models"
+	"sync"
+)
+
+// inFlightQueries coalesces identical queries of every tenant that run at the same time
+var inFlightQueries = &queryCoalescer{calls: make(map[string]*queryCall)}
+
+// queryOutcome is what a query execution produces: the response and what the query log records
+type queryOutcome struct {
+	response *models.QueryResponse
+	chunks   []*models.EnhancedChunk
+	answer   string
+	timing   QueryTiming
+}
+
+// queryCall is one execution of a query, shared by the identical requests waiting for it
+type queryCall struct {
+	done    chan struct{}
+	outcome *queryOutcome
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// queryCoalescer runs concurrent identical queries once. The execution is not tied to the request
+// that started it: it keeps running while any request waits for it, and is cancelled once all of
+// them have gone.
+type queryCoalescer struct {
+	mu    sync.Mutex
+	calls map[string]*queryCall
+}
+
+// Query answers a query with retrieved context. Identical queries of the same tenant that arrive
+// while one is running wait for its answer instead of embedding, searching and generating again;
+// their responses are marked coalesced. Each is still logged as a query of its own.
+func (r *RAGService) Query(ctx context.Context, req *models.QueryRequest) (*models.QueryResponse, error) {
+	ctx, span := startSpan(ctx, "RAGService.Query")
+	span.SetAttribute("rag.tenant", r.vectorDB.tenant)
+	span.SetAttribute("rag.collection", req.CollectionName)
+	span.SetAttribute("rag.top_k", req.TopK)
+
+	key, err := queryKey(r.vectorDB.tenant, req)
+	if err != nil {
+		span.End(err)
+		return nil, err
+	}
+	outcome, shared, err := inFlightQueries.do(ctx, key, func(ctx context.Context) (*queryOutcome, error) {
+		return r.runQuery(ctx, req)
+	})
+	// A coalesced query's stages are recorded in the trace of the request that ran it
+	span.SetAttribute("rag.coalesced", shared)
+	span.End(err)
+	if err != nil {
+		return nil, err
+	}
+
+	r.LogQuery(QueryLogQuery, req, outcome.chunks, outcome.answer, outcome.timing)
+	response := *outcome.response
+	response.Coalesced = shared
+	return &response, nil
+}
+
+// queryKey identifies a query by its tenant and every parameter, principal included, so only
+// requests that would get the same answer share one
+func queryKey(tenant string, req *models.QueryRequest) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode query: %w", err)
+	}
+	sum := sha256.Sum256(append([]byte(tenant+"\x00"), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// do runs fn for key, or waits for the run already in flight for it, and reports whether the
+// outcome came from a run started by another request
+func (g *queryCoalescer) do(ctx context.Context, key string, fn func(context.Context) (*queryOutcome, error)) (*queryOutcome, bool, error) {
+	g.mu.Lock()
+	call, shared := g.calls[key]
+	if !shared {
+		runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &queryCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+		go g.run(runCtx, key, call, fn)
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.outcome, shared, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// Nobody wants the answer anymore; later requests start afresh
+			call.cancel()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, shared, ctx.Err()
+	}
+}
+
+// run executes a call. A panic fails the call instead of the server, as it would have failed only
+// its own request had the query not been shared.
+func (g *queryCoalescer) run(ctx context.Context, key string, call *queryCall, fn func(context.Context) (*queryOutcome, error)) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			call.outcome, call.err = nil, fmt.Errorf("query failed: %v", rec)
+		}
+		g.mu.Lock()
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		call.cancel()
+		close(call.done)
+	}()
+	call.outcome, call.err = fn(ctx)
+}
@@ -0,0 +1,315 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Endpoints recorded in the query log
+const (
+	QueryLogQuery  = "query"  // /query, with a generated answer
+	QueryLogSearch = "search" // /search, retrieval only
+	QueryLogChat   = "chat"   // /v1/chat/completions, generated by the model server
+)
+
+const (
+	defaultAnalyticsLimit = 10        // Entries per ranking when a request sets no limit
+	queryLogPruneInterval = time.Hour // Minimum time between deletions of entries past the retention
+)
+
+// notFoundPhrases mark an answer saying the context didn't cover the question. The first two are
+// the answers Query gives itself when nothing is retrieved.
+var notFoundPhrases = []string{
+	"couldn't find any relevant information",
+	"no chunks met the semantic similarity threshold",
+	"context doesn't contain", "context does not contain",
+	"context doesn't provide", "context does not provide",
+	"context doesn't mention", "context does not mention",
+	"not enough information", "no information about", "no relevant information",
+	"couldn't find", "could not find", "unable to find",
+	"i don't know", "i do not know",
+}
+
+// lastQueryLogPrune is when entries past the retention were last deleted, in Unix seconds
+var lastQueryLogPrune atomic.Int64
+
+// QueryTiming is the latency breakdown of a logged query
+type QueryTiming struct {
+	Retrieval  time.Duration
+	Generation time.Duration // Zero for endpoints that generate no answer here
+	Total      time.Duration
+}
+
+// QueryAnalytics aggregates the logged queries of a tenant
+type QueryAnalytics struct {
+	CollectionName         string               `json:"collection_name,omitempty"`
+	User                   string               `json:"user,omitempty"`
+	TotalQueries           int                  `json:"total_queries"`
+	ZeroResultCount        int                  `json:"zero_result_count"` // Queries that returned no chunks
+	NotFoundCount          int                  `json:"not_found_count"`   // Queries with no chunks or an answer saying nothing was found
+	QueriesByEndpoint      map[string]int       `json:"queries_by_endpoint"`
+	AverageLatency         QueryLatency         `json:"average_latency_ms"`
+	TopQueries             []QueryCount         `json:"top_queries"`
+	ZeroResultQueries      []QueryCount         `json:"zero_result_queries"`
+	NotFoundQueries        []QueryCount         `json:"not_found_queries"`
+	MostRetrievedDocuments []DocumentRetrievals `json:"most_retrieved_documents"`
+}
+
+// QueryLatency holds average latencies in milliseconds. Generation only averages /query, the one
+// endpoint that generates answers itself.
+type QueryLatency struct {
+	Retrieval  float64 `json:"retrieval"`
+	Generation float64 `json:"generation"`
+	Total      float64 `json:"total"`
+}
+
+// QueryCount is a query asked repeatedly; queries differing only in case and whitespace count as one
+type QueryCount struct {
+	Query        string    `json:"query"` // Text of the latest asking
+	Count        int       `json:"count"`
+	ZeroResults  int       `json:"zero_results"`
+	NotFound     int       `json:"not_found"`
+	AverageTotal float64   `json:"average_total_ms"`
+	LastAskedAt  time.Time `json:"last_asked_at"`
+}
+
+// DocumentRetrievals counts the logged queries that returned chunks of a document
+type DocumentRetrievals struct {
+	DocumentID     string `json:"document_id"`
+	Source         string `json:"source,omitempty"` // Empty once the document is deleted
+	CollectionName string `json:"collection_name,omitempty"`
+	Queries        int    `json:"queries"`
+}
+
+// LogQuery records a query, the chunks it returned and whether it found an answer. answer is empty
+// for endpoints that generate none. A failure is only logged, so a query never fails because of
+// its log entry. A read-only server records nothing and prunes nothing.
+func (r *RAGService) LogQuery(endpoint string, req *models.QueryRequest, chunks []*models.EnhancedChunk, answer string, timing QueryTiming) {
+	settings := config.AppConfig.QueryLog
+	if !settings.Enabled || checkWritable() != nil {
+		return
+	}
+
+	chunkIDs := make([]string, 0, len(chunks))
+	documentIDs := make([]string, 0, len(chunks))
+	seen := make(map[string]bool)
+	for _, chunk := range chunks {
+		chunkIDs = append(chunkIDs, chunk.ID)
+		if !seen[chunk.DocumentID] {
+			seen[chunk.DocumentID] = true
+			documentIDs = append(documentIDs, chunk.DocumentID)
+		}
+	}
+	chunkJSON, _ := json.Marshal(chunkIDs)
+	documentJSON, _ := json.Marshal(documentIDs)
+	var user interface{}
+	if req.Principal != nil && req.Principal.User != "" {
+		user = req.Principal.User
+	}
+
+	_, err := r.vectorDB.conn.Exec(`INSERT INTO query_log (tenant_id, collection_name, endpoint, user_id, query, normalized_query,
+		chunk_ids, document_ids, result_count, not_found, retrieval_ms, generation_ms, total_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.vectorDB.tenant, req.CollectionName, endpoint, user, req.Query, normalizeQuery(req.Query),
+		string(chunkJSON), string(documentJSON), len(chunks), len(chunks) == 0 || answerNotFound(answer),
+		milliseconds(timing.Retrieval), milliseconds(timing.Generation), milliseconds(timing.Total))
+	if err != nil {
+		log.Printf("Failed to log query on collection %s: %v", req.CollectionName, err)
+	}
+
+	if settings.RetentionDays > 0 {
+		r.vectorDB.pruneQueryLog(settings.RetentionDays)
+	}
+}
+
+// normalizeQuery lowercases a query and collapses its whitespace, so repeats group together
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// answerNotFound reports whether an answer says the context didn't cover the question
+func answerNotFound(answer string) bool {
+	answer = strings.ToLower(strings.ReplaceAll(answer, "’", "'"))
+	for _, phrase := range notFoundPhrases {
+		if strings.Contains(answer, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneQueryLog deletes the entries of every tenant older than the retention, at most once per
+// queryLogPruneInterval
+func (db *VectorDB) pruneQueryLog(retentionDays int) {
+	now := time.Now()
+	last := lastQueryLogPrune.Load()
+	if now.Sub(time.Unix(last, 0)) < queryLogPruneInterval || !lastQueryLogPrune.CompareAndSwap(last, now.Unix()) {
+		return
+	}
+
+	cutoff := now.UTC().AddDate(0, 0, -retentionDays).Format("2006-01-02 15:04:05")
+	result, err := db.conn.Exec(`DELETE FROM query_log WHERE created_at < ?`, cutoff)
+	if err != nil {
+		log.Printf("Failed to prune query log: %v", err)
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted > 0 {
+		log.Printf("Pruned %d query log entries older than %d days", deleted, retentionDays)
+	}
+}
+
+// QueryAnalytics aggregates the tenant's logged queries, optionally of one collection, one user
+// and a creation time range
+func (db *VectorDB) QueryAnalytics(req *models.QueryAnalyticsRequest) (*QueryAnalytics, error) {
+	conditions := []string{"q.tenant_id = ?"}
+	args := []interface{}{db.tenant}
+	if req.CollectionName != "" {
+		conditions = append(conditions, "q.collection_name = ?")
+		args = append(args, req.CollectionName)
+	}
+	if req.User != "" {
+		conditions = append(conditions, "q.user_id = ?")
+		args = append(args, req.User)
+	}
+	for _, bound := range []struct {
+		value, param, operator string
+	}{
+		{req.CreatedAfter, "created_after", ">="},
+		{req.CreatedBefore, "created_before", "<"},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parseListTime(bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid analytics options: %s must be RFC 3339 or YYYY-MM-DD", bound.param)
+		}
+		conditions = append(conditions, "q.created_at "+bound.operator+" ?")
+		args = append(args, t.UTC().Format("2006-01-02 15:04:05"))
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultAnalyticsLimit
+	}
+
+	analytics := &QueryAnalytics{CollectionName: req.CollectionName, User: req.User, QueriesByEndpoint: make(map[string]int)}
+	var retrieval, generation, total *float64
+	err := db.conn.QueryRow(`SELECT COUNT(*), COALESCE(SUM(q.result_count = 0), 0), COALESCE(SUM(q.not_found), 0),
+		AVG(q.retrieval_ms), AVG(CASE WHEN q.endpoint = '`+QueryLogQuery+`' THEN q.generation_ms END), AVG(q.total_ms)
+		FROM query_log q`+where, args...).Scan(
+		&analytics.TotalQueries, &analytics.ZeroResultCount, &analytics.NotFoundCount, &retrieval, &generation, &total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate query log: %w", err)
+	}
+	for _, average := range []struct {
+		value  *float64
+		target *float64
+	}{
+		{retrieval, &analytics.AverageLatency.Retrieval},
+		{generation, &analytics.AverageLatency.Generation},
+		{total, &analytics.AverageLatency.Total},
+	} {
+		if average.value != nil {
+			*average.target = *average.value
+		}
+	}
+
+	rows, err := db.conn.Query(`SELECT q.endpoint, COUNT(*) FROM query_log q`+where+` GROUP BY q.endpoint`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count queries by endpoint: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var endpoint string
+		var count int
+		if err := rows.Scan(&endpoint, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan endpoint count: %w", err)
+		}
+		analytics.QueriesByEndpoint[endpoint] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, ranking := range []struct {
+		condition string
+		target    *[]QueryCount
+	}{
+		{"", &analytics.TopQueries},
+		{" AND q.result_count = 0", &analytics.ZeroResultQueries},
+		{" AND q.not_found", &analytics.NotFoundQueries},
+	} {
+		if *ranking.target, err = db.queryCounts(where+ranking.condition, args, limit); err != nil {
+			return nil, err
+		}
+	}
+
+	if analytics.MostRetrievedDocuments, err = db.mostRetrievedDocuments(where, args, limit); err != nil {
+		return nil, err
+	}
+	return analytics, nil
+}
+
+// queryCounts ranks the normalized queries of the log entries matching where by how often they
+// were asked
+func (db *VectorDB) queryCounts(where string, args []interface{}, limit int) ([]QueryCount, error) {
+	// With MAX(), SQLite takes the bare query column from the latest entry of each group
+	rows, err := db.conn.Query(`SELECT q.query, MAX(q.created_at), COUNT(*), SUM(q.result_count = 0), SUM(q.not_found), AVG(q.total_ms)
+		FROM query_log q`+where+`
+		GROUP BY q.normalized_query ORDER BY COUNT(*) DESC, MAX(q.created_at) DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank queries: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []QueryCount{}
+	for rows.Next() {
+		var count QueryCount
+		var lastAsked string
+		if err := rows.Scan(&count.Query, &lastAsked, &count.Count, &count.ZeroResults, &count.NotFound, &count.AverageTotal); err != nil {
+			return nil, fmt.Errorf("failed to scan query count: %w", err)
+		}
+		count.LastAskedAt, _ = time.Parse("2006-01-02 15:04:05", lastAsked)
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// mostRetrievedDocuments ranks documents by the number of log entries matching where that returned
+// any of their chunks
+func (db *VectorDB) mostRetrievedDocuments(where string, args []interface{}, limit int) ([]DocumentRetrievals, error) {
+	rows, err := db.conn.Query(`SELECT j.value, d.source, MAX(q.collection_name), COUNT(*)
+		FROM query_log q JOIN json_each(q.document_ids) j
+		LEFT JOIN documents d ON d.id = j.value AND d.tenant_id = q.tenant_id`+where+`
+		GROUP BY j.value ORDER BY COUNT(*) DESC, j.value LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank retrieved documents: %w", err)
+	}
+	defer rows.Close()
+
+	documents := []DocumentRetrievals{}
+	for rows.Next() {
+		var document DocumentRetrievals
+		var source *string
+		if err := rows.Scan(&document.DocumentID, &source, &document.CollectionName, &document.Queries); err != nil {
+			return nil, fmt.Errorf("failed to scan document retrievals: %w", err)
+		}
+		if source != nil {
+			document.Source = *source
+		}
+		documents = append(documents, document)
+	}
+	return documents, rows.Err()
+}
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"fmt"
+	"rag-go-app/models"
+	"strings"
+	"unicode"
+)
+
+// builtinRoutes are the retrieval settings of each intent before a collection's routes replace
+// them. Factual lookups need few chunks; summaries and comparisons need many, spread by MMR over
+// the documents rather than repeating the best passage.
+var builtinRoutes = map[models.QueryIntent]models.RouteSettings{
+	models.FactualIntent:       {TopK: 3},
+	models.SummarizationIntent: {TopK: 10, MMREnabled: boolPtr(true)},
+	models.ComparisonIntent:    {TopK: 8, MMREnabled: boolPtr(true)},
+	models.ChitchatIntent:      {SkipRetrieval: boolPtr(true)},
+}
+
+// boolPtr returns a pointer to b, for optional settings
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// chitchatPhrases are greetings, thanks and small talk, each with the reply it gets by default
+var chitchatPhrases = map[string]string{
+	"hi": greetingReply, "hello": greetingReply, "hey": greetingReply, "hiya": greetingReply,
+	"howdy": greetingReply, "greetings": greetingReply, "good morning": greetingReply,
+	"good afternoon": greetingReply, "good evening": greetingReply,
+	"how are you": greetingReply, "how are you doing": greetingReply, "hows it going": greetingReply,
+	"whats up": greetingReply,
+
+	"thanks": thanksReply, "thank you": thanksReply, "thx": thanksReply, "cheers": thanksReply,
+	"great": thanksReply, "perfect": thanksReply, "awesome": thanksReply, "ok": thanksReply,
+	"okay": thanksReply, "cool": thanksReply, "got it": thanksReply,
+
+	"bye": farewellReply, "goodbye": farewellReply, "good night": farewellReply, "see you": farewellReply,
+
+	"who are you": scopeReply, "what are you": scopeReply, "what can you do": scopeReply,
+	"are you a bot": scopeReply, "are you human": scopeReply, "tell me a joke": scopeReply,
+}
+
+const (
+	greetingReply = "Hello! Ask me a question about the documents and I'll answer from them."
+	thanksReply   = "You're welcome! Ask me anything else about the documents."
+	farewellReply = "Goodbye!"
+	scopeReply    = "I answer questions about the documents in this collection. What would you like to know?"
+)
+
+// chitchatFillers may surround chitchat phrases without making the query a question
+var chitchatFillers = map[string]bool{
+	"there": true, "so": true, "much": true, "very": true, "again": true, "a": true, "lot": true,
+	"you": true, "all": true, "everyone": true, "bot": true, "assistant": true, "and": true,
+	"please": true, "for": true, "the": true, "help": true, "today": true,
+}
+
+// comparisonCues and summarizationCues are words and phrases that mark an intent anywhere in a query
+var comparisonCues = []string{
+	"compare", "compared", "comparing", "comparison", "versus", "vs", "difference between",
+	"differences between", "different from", "differ", "differs", "better than", "worse than",
+	"similarities", "contrast", "pros and cons",
+}
+
+var summarizationCues = []string{
+	"summarize", "summarise", "summary", "summarization", "overview", "tldr", "tl dr",
+	"main points", "key points", "key takeaways", "takeaways", "outline", "recap", "gist",
+	"in a nutshell", "what is this about", "what is this document about", "what are these documents about",
+}
+
+// classifyQuery recognizes the intent of a query by its words, returning the words it was
+// recognized by. A query made only of chitchat phrases is chitchat; otherwise comparison cues
+// win over summarization cues, and a query with neither is a factual lookup.
+func classifyQuery(query string) (models.QueryIntent, string) {
+	words := routingWords(query)
+	if cue, ok := chitchatCue(words); ok {
+		return models.ChitchatIntent, cue
+	}
+	text := " " + strings.Join(words, " ") + " "
+	for _, cues := range []struct {
+		intent models.QueryIntent
+		cues   []string
+	}{{models.ComparisonIntent, comparisonCues}, {models.SummarizationIntent, summarizationCues}} {
+		for _, cue := range cues.cues {
+			if strings.Contains(text, " "+cue+" ") {
+				return cues.intent, cue
+			}
+		}
+	}
+	return models.FactualIntent, ""
+}
+
+// routingWords lowercases a query and splits it into words, dropping apostrophes so "what's"
+// matches "whats"
+func routingWords(query string) []string {
+	query = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(query))
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// chitchatCue reports whether words consist only of chitchat phrases and fillers, returning the
+// first phrase. Longer phrases are matched first, so "thank you" isn't read as filler "you".
+func chitchatCue(words []string) (string, bool) {
+	cue := ""
+	for i := 0; i < len(words); {
+		matched := 0
+		for n := min(4, len(words)-i); n > 0 && matched == 0; n-- {
+			phrase := strings.Join(words[i:i+n], " ")
+			if _, ok := chitchatPhrases[phrase]; ok {
+				matched = n
+				if cue == "" {
+					cue = phrase
+				}
+			}
+		}
+		if matched == 0 {
+			if !chitchatFillers[words[i]] {
+				return "", false
+			}
+			matched = 1
+		}
+		i += matched
+	}
+	return cue, cue != ""
+}
+
+// routeSettings returns the settings of an intent: the built-in ones, with those a collection's
+// route sets replaced
+func routeSettings(routing *models.RoutingConfig, intent models.QueryIntent) models.RouteSettings {
+	settings := builtinRoutes[intent]
+	custom, ok := routing.Routes[intent]
+	if !ok {
+		return settings
+	}
+	if custom.TopK > 0 {
+		settings.TopK = custom.TopK
+	}
+	if custom.RerankerEnabled != nil {
+		settings.RerankerEnabled = custom.RerankerEnabled
+	}
+	if custom.MMREnabled != nil {
+		settings.MMREnabled = custom.MMREnabled
+	}
+	if custom.QueryExpansion != nil {
+		settings.QueryExpansion = custom.QueryExpansion
+	}
+	if custom.SkipRetrieval != nil {
+		settings.SkipRetrieval = custom.SkipRetrieval
+	}
+	if custom.Reply != "" {
+		settings.Reply = custom.Reply
+	}
+	return settings
+}
+
+// validateRouting rejects routes for unknown intents and settings no query could carry
+func validateRouting(routing *models.RoutingConfig) error {
+	for intent, settings := range routing.Routes {
+		if _, ok := builtinRoutes[intent]; !ok {
+			return fmt.Errorf("invalid defaults: unknown routing intent '%s'", intent)
+		}
+		if settings.TopK < 0 {
+			return fmt.Errorf("invalid defaults: top_k of the %s route must not be negative", intent)
+		}
+	}
+	return nil
+}
+
+// RouteQuery classifies a query by intent when its collection routes queries, and applies the
+// intent's settings to the parameters the request did not set. explicit holds the JSON fields
+// present in the request, as for ApplyQueryDefaults, which runs first: a route's settings win
+// over the collection's defaults but not over the request's own. Federated queries aren't routed.
+func (r *RAGService) RouteQuery(req *models.QueryRequest, explicit map[string]bool) error {
+	if len(req.CollectionNames) > 0 {
+		return nil
+	}
+	defaults, err := r.vectorDB.GetCollectionDefaults(req.CollectionName)
+	if err != nil || defaults == nil || defaults.Routing == nil || !defaults.Routing.Enabled {
+		return err
+	}
+
+	route := &models.QueryRoute{Intent: req.Intent, Applied: make(map[string]interface{})}
+	if route.Intent == "" {
+		route.Intent, route.Cue = classifyQuery(req.Query)
+	}
+	settings := routeSettings(defaults.Routing, route.Intent)
+
+	if settings.SkipRetrieval != nil && *settings.SkipRetrieval {
+		route.RetrievalSkipped = true
+		route.Reply = settings.Reply
+		if route.Reply == "" {
+			route.Reply = scopeReply
+			if reply, ok := chitchatPhrases[route.Cue]; ok {
+				route.Reply = reply
+			}
+		}
+	}
+	if settings.TopK > 0 && !explicit["top_k"] {
+		req.TopK = settings.TopK
+		route.Applied["top_k"] = settings.TopK
+	}
+	for _, setting := range []struct {
+		field string
+		value *bool
+		param *bool
+	}{
+		{"reranker_enabled", settings.RerankerEnabled, &req.RerankerEnabled},
+		{"mmr_enabled", settings.MMREnabled, &req.MMREnabled},
+		{"query_expansion", settings.QueryExpansion, &req.QueryExpansion},
+	} {
+		if setting.value != nil && !explicit[setting.field] {
+			*setting.param = *setting.value
+			route.Applied[setting.field] = *setting.value
+		}
+	}
+	req.Route = route
+	return nil
+}
+
+// skippedRetrievalResponse answers a query routed past retrieval with its route's reply
+func skippedRetrievalResponse(req *models.QueryRequest, processingTime float64) *models.QueryResponse {
+	return &models.QueryResponse{
+		Answer:         req.Route.Reply,
+		ProcessingTime: processingTime,
+		Route:          req.Route,
+	}
+}
@@ -0,0 +1,210 @@
+package core
+
+import (
+	"fmt"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Scopes of quotas
+const (
+	QuotaScopeCollection = "collection"
+	QuotaScopeTenant     = "tenant"
+)
+
+// QuotaUsage is what a collection or tenant stores
+type QuotaUsage struct {
+	Documents  int64 `json:"documents"`
+	Characters int64 `json:"characters"`
+	Chunks     int64 `json:"chunks"`
+}
+
+// QuotaStatus is the usage of a collection or tenant with the limits that apply to it
+type QuotaStatus struct {
+	Usage  QuotaUsage         `json:"usage"`
+	Limits config.QuotaLimits `json:"limits"` // Zero limits are unlimited
+}
+
+// CollectionUsage is the quota status of one collection
+type CollectionUsage struct {
+	CollectionName string `json:"collection_name"`
+	QuotaStatus
+}
+
+// UsageReport is the quota status of a tenant and its collections
+type UsageReport struct {
+	Tenant      string             `json:"tenant"`
+	Usage       QuotaUsage         `json:"usage"`
+	Limits      config.QuotaLimits `json:"limits"`
+	Collections []CollectionUsage  `json:"collections"`
+}
+
+// QuotaExceededError reports a document refused because storing it would take a collection or
+// tenant past one of its quotas
+type QuotaExceededError struct {
+	Scope  string // QuotaScopeCollection or QuotaScopeTenant
+	Name   string // Collection name or tenant ID
+	Limit  string // "documents", "characters" or "chunks"
+	Max    int64
+	Used   int64 // Stored already, not counting the version the document replaces
+	Adding int64 // Added by the document
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s '%s' may store %d %s and has %d; this document adds %d",
+		e.Scope, e.Name, e.Max, e.Limit, e.Used, e.Adding)
+}
+
+// CollectionQuota returns the limits of a collection
+func CollectionQuota(collectionName string) config.QuotaLimits {
+	quotas := config.AppConfig.Quotas
+	return overrideQuota(quotas.Collection, quotas.Collections[collectionName])
+}
+
+// TenantQuota returns the limits of a tenant across its collections
+func TenantQuota(tenant string) config.QuotaLimits {
+	quotas := config.AppConfig.Quotas
+	return overrideQuota(quotas.Tenant, quotas.Tenants[tenant])
+}
+
+// overrideQuota replaces the limits of base that override sets
+func overrideQuota(base, override config.QuotaLimits) config.QuotaLimits {
+	if override.MaxDocuments > 0 {
+		base.MaxDocuments = override.MaxDocuments
+	}
+	if override.MaxCharacters > 0 {
+		base.MaxCharacters = override.MaxCharacters
+	}
+	if override.MaxChunks > 0 {
+		base.MaxChunks = override.MaxChunks
+	}
+	return base
+}
+
+// checkQuota refuses a document that would take its collection or tenant past a quota. It runs in
+// the transaction storing the document, so concurrent ingestion can't overshoot.
+func (db *VectorDB) checkQuota(q queryRower, collectionName string, doc *models.Document) error {
+	adding := QuotaUsage{
+		Documents:  1,
+		Characters: int64(utf8.RuneCountInString(doc.Content)),
+		Chunks:     int64(len(doc.Chunks)),
+	}
+	for _, scope := range []struct {
+		scope, name, collection string
+		limits                  config.QuotaLimits
+	}{
+		{QuotaScopeCollection, collectionName, collectionName, CollectionQuota(collectionName)},
+		{QuotaScopeTenant, db.tenant, "", TenantQuota(db.tenant)},
+	} {
+		if scope.limits == (config.QuotaLimits{}) {
+			continue
+		}
+		used, err := db.quotaUsage(q, scope.collection, collectionName, doc)
+		if err != nil {
+			return err
+		}
+		for _, limit := range []struct {
+			name             string
+			max, used, added int64
+		}{
+			{"documents", scope.limits.MaxDocuments, used.Documents, adding.Documents},
+			{"characters", scope.limits.MaxCharacters, used.Characters, adding.Characters},
+			{"chunks", scope.limits.MaxChunks, used.Chunks, adding.Chunks},
+		} {
+			if limit.max > 0 && limit.used+limit.added > limit.max {
+				return &QuotaExceededError{Scope: scope.scope, Name: scope.name, Limit: limit.name,
+					Max: limit.max, Used: limit.used, Adding: limit.added}
+			}
+		}
+	}
+	return nil
+}
+
+// quotaUsage sums what the tenant stores, in one collection or in all of them when scope is empty.
+// The document being stored is left out, as is the version of it that it replaces in its collection.
+func (db *VectorDB) quotaUsage(q queryRower, scope, collectionName string, doc *models.Document) (QuotaUsage, error) {
+	conditions := []string{"tenant_id = ?", "id != ?"}
+	args := []interface{}{db.tenant, doc.ID}
+	if scope != "" {
+		conditions = append(conditions, "collection_name = ?")
+		args = append(args, scope)
+	}
+	if doc.Source != "" {
+		conditions = append(conditions, "NOT (collection_name = ? AND source = ?)")
+		args = append(args, collectionName, doc.Source)
+	}
+
+	var usage QuotaUsage
+	err := q.QueryRow(`SELECT COUNT(*), `+usageColumns+` FROM documents WHERE `+strings.Join(conditions, " AND "), args...).
+		Scan(&usage.Documents, &usage.Characters, &usage.Chunks)
+	if err != nil {
+		return usage, fmt.Errorf("failed to read quota usage: %w", err)
+	}
+	return usage, nil
+}
+
+// usageColumns sums characters and chunks. Documents stored before characters were counted fall
+// back to the length of their stored content, which for encrypted content is its ciphertext.
+const usageColumns = `COALESCE(SUM(COALESCE(char_count, LENGTH(content))), 0), COALESCE(SUM(chunk_count), 0)`
+
+// Usage reports what the tenant stores and the quotas that apply, overall and per collection. With
+// a collection name, only that collection is listed.
+func (db *VectorDB) Usage(collectionName string) (*UsageReport, error) {
+	report := &UsageReport{Tenant: db.tenant, Limits: TenantQuota(db.tenant), Collections: []CollectionUsage{}}
+	err := db.conn.QueryRow(`SELECT COUNT(*), `+usageColumns+` FROM documents WHERE tenant_id = ?`, db.tenant).
+		Scan(&report.Usage.Documents, &report.Usage.Characters, &report.Usage.Chunks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage: %w", err)
+	}
+
+	// Collections without documents are listed too, and documents may precede their collection
+	usage := make(map[string]QuotaUsage)
+	rows, err := db.conn.Query(`SELECT name FROM collections WHERE tenant_id = ?`, db.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan collection: %w", err)
+		}
+		usage[name] = QuotaUsage{}
+	}
+	rows.Close()
+
+	rows, err = db.conn.Query(`SELECT collection_name, COUNT(*), `+usageColumns+` FROM documents
+		WHERE tenant_id = ? GROUP BY collection_name`, db.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var u QuotaUsage
+		if err := rows.Scan(&name, &u.Documents, &u.Characters, &u.Chunks); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		usage[name] = u
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if collectionName != "" {
+		usage = map[string]QuotaUsage{collectionName: usage[collectionName]}
+	}
+	for name, u := range usage {
+		report.Collections = append(report.Collections, CollectionUsage{
+			CollectionName: name,
+			QuotaStatus:    QuotaStatus{Usage: u, Limits: CollectionQuota(name)},
+		})
+	}
+	sort.Slice(report.Collections, func(i, j int) bool {
+		return report.Collections[i].CollectionName < report.Collections[j].CollectionName
+	})
+	return report, nil
+}
@@ -1,10 +1,14 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math"
 	"os"
+	"path/filepath"
+	"rag-go-app/config"
+	"rag-go-app/core/parsers"
 	"rag-go-app/models"
 	"sort"
 	"strings"
@@ -18,8 +22,8 @@ func NewEmbeddingService() *EmbeddingService {
 	return &EmbeddingService{}
 }
 
-func (e *EmbeddingService) GetEmbedding(text string) ([]float32, error) {
-	embeddings, err := GetEmbeddings([]string{text}, "")
+func (e *EmbeddingService) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := GetEmbeddings(ctx, []string{text}, "")
 	if err != nil {
 		return nil, err
 	}
@@ -29,8 +33,20 @@ func (e *EmbeddingService) GetEmbedding(text string) ([]float32, error) {
 	return embeddings[0], nil
 }
 
-func (e *EmbeddingService) GetEmbeddings(texts []string) ([][]float32, error) {
-	return GetEmbeddings(texts, "")
+func (e *EmbeddingService) GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	return GetEmbeddings(ctx, texts, "")
+}
+
+// GetEmbeddingsDeferringCache embeds texts like GetEmbeddings but leaves writing the embedding
+// cache to the caller, returning the new entries. Used while a write transaction is open, so the
+// cache write doesn't contend with it.
+func (e *EmbeddingService) GetEmbeddingsDeferringCache(ctx context.Context, texts []string) ([][]float32, map[string][]float32, error) {
+	return embedWithCache(ctx, texts, config.AppConfig.EmbeddingModel)
+}
+
+// CacheEmbeddings stores entries returned by GetEmbeddingsDeferringCache
+func (e *EmbeddingService) CacheEmbeddings(entries map[string][]float32) {
+	storeCachedEmbeddings(config.AppConfig.EmbeddingModel, entries)
 }
 
 // LLMService wraps the LLM functionality
@@ -40,11 +56,16 @@ func NewLLMService() *LLMService {
 	return &LLMService{}
 }
 
-func (l *LLMService) GenerateResponse(prompt string) (string, error) {
+func (l *LLMService) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	return l.GenerateWithOptions(ctx, prompt, models.GenerationOptions{})
+}
+
+// GenerateWithOptions answers a prompt with the model and sampling parameters of gen
+func (l *LLMService) GenerateWithOptions(ctx context.Context, prompt string, gen models.GenerationOptions) (string, error) {
 	messages := []models.ChatCompletionMessage{
 		{Role: "user", Content: prompt},
 	}
-	return GenerateChatCompletion(messages, "")
+	return GenerateChatCompletion(ctx, messages, gen)
 }
 
 type RAGService struct {
@@ -61,6 +82,16 @@ func NewRAGService(vectorDB *VectorDB, embeddingClient *EmbeddingService, llmCli
 	}
 }
 
+// ForTenant returns a service whose database access is scoped to the given tenant.
+// The embedding and LLM clients are shared.
+func (r *RAGService) ForTenant(tenant string) *RAGService {
+	return &RAGService{
+		vectorDB:        r.vectorDB.ForTenant(tenant),
+		embeddingClient: r.embeddingClient,
+		llmClient:       r.llmClient,
+	}
+}
+
 // ReadFileContent reads a file and returns its content as string
 func ReadFileContent(filePath string) (string, error) {
 	content, err := os.ReadFile(filePath)
@@ -70,159 +101,478 @@ func ReadFileContent(filePath string) (string, error) {
 	return string(content), nil
 }
 
-func (r *RAGService) AddDocument(collectionName string, req *models.AddDocumentRequest) error {
+// AddDocument processes, embeds and stores a document
+func (r *RAGService) AddDocument(ctx context.Context, collectionName string, req *models.AddDocumentRequest) error {
+	_, err := r.IngestDocument(ctx, collectionName, req)
+	return err
+}
+
+// IngestDocument processes and stores a document, replacing the previous version with the same source.
+// Re-ingesting unchanged content is a no-op, and only chunks whose text is new to the collection are embedded.
+func (r *RAGService) IngestDocument(ctx context.Context, collectionName string, req *models.AddDocumentRequest) (*IngestResult, error) {
+	result, err := r.ingestDocument(ctx, collectionName, req)
+	r.publishIngestion(collectionName, req.Source, result, err)
+	return result, err
+}
+
+func (r *RAGService) ingestDocument(ctx context.Context, collectionName string, req *models.AddDocumentRequest) (*IngestResult, error) {
 	startTime := time.Now()
 
-	// Read content
-	var content string
-	var err error
+	prepared, err := r.prepareDocument(ctx, collectionName, req)
+	if err != nil {
+		return nil, err
+	}
+	if prepared.doc == nil {
+		return prepared.result, nil
+	}
+	doc, result := prepared.doc, prepared.result
 
-	if req.FilePath != "" {
-		content, err = ReadFileContent(req.FilePath)
-		if err != nil {
-			return fmt.Errorf("failed to read file: %w", err)
+	// Embed only chunks whose text is new to the collection, writing batches as they complete
+	if len(prepared.toEmbed) > 0 {
+		log.Printf("Generating embeddings for %d of %d chunks...", len(prepared.toEmbed), len(doc.Chunks))
+	}
+	if err := r.storeDocument(ctx, collectionName, doc, prepared.toEmbed); err != nil {
+		// With derived IDs, a concurrent ingestion of the same content may have stored it first
+		if deterministicIDs(req) {
+			if stored, findErr := r.vectorDB.FindDocument(collectionName, doc.ID); findErr == nil && stored != nil && stored.ContentHash == doc.ContentHash {
+				log.Printf("Document '%s' was stored by a concurrent ingestion", doc.Source)
+				return &IngestResult{Status: IngestUnchanged, DocumentID: stored.ID, ExpiresAt: stored.ExpiresAt}, nil
+			}
 		}
-	} else if req.Content != "" {
-		content = req.Content
-	} else {
-		return fmt.Errorf("either file_path or content must be provided")
+		return nil, fmt.Errorf("failed to store document: %w", err)
 	}
+	result.ChunksEmbedded = len(prepared.toEmbed)
+	result.ChunksSplit = splitChunks(prepared.toEmbed)
 
-	if len(content) == 0 {
-		return fmt.Errorf("document content is empty")
+	if err := r.finishDocument(ctx, collectionName, prepared); err != nil {
+		return nil, err
 	}
 
-	// Process document with enhanced chunking
-	doc, err := ProcessDocumentContent(content, req.Source, req.DocType, req.ChunkingConfig)
+	log.Printf("Document '%s' %s in %v with %d chunks (%d embedded, %d reused, %d deduplicated)",
+		doc.Source, result.Status, time.Since(startTime), len(doc.Chunks),
+		result.ChunksEmbedded, result.ChunksReused, result.ChunksDeduplicated)
+
+	return result, nil
+}
+
+// preparedDocument is a document read, chunked and matched against the collection, ready to be
+// embedded and stored. An unchanged document has no doc, only its result.
+type preparedDocument struct {
+	req      *models.AddDocumentRequest
+	doc      *models.Document
+	previous *StoredDocument
+	toEmbed  []*models.EnhancedChunk // Chunks whose text is new to the collection
+	result   *IngestResult
+}
+
+// prepareDocument reads and chunks a document and works out which of its chunks need embedding.
+// An unchanged document only has its ACL and expiry updated.
+func (r *RAGService) prepareDocument(ctx context.Context, collectionName string, req *models.AddDocumentRequest) (*preparedDocument, error) {
+	if err := r.vectorDB.requireCollection(r.vectorDB.conn, collectionName); err != nil {
+		return nil, err
+	}
+	if req.Source == "" {
+		req.Source = req.FilePath
+	}
+	if len(req.Chunks) > 0 {
+		if err := r.vectorDB.checkSuppliedChunks(collectionName, req.Chunks); err != nil {
+			return nil, err
+		}
+	}
+
+	// Read content; binary formats are hashed as raw bytes too
+	content, err := readDocumentContent(req)
 	if err != nil {
-		return fmt.Errorf("failed to process document: %w", err)
+		return nil, err
+	}
+
+	contentHash := ContentHash([]byte(content))
+	if len(req.Chunks) > 0 {
+		if contentHash, err = suppliedContentHash(content, req.Chunks); err != nil {
+			return nil, err
+		}
+	}
+	expiresAt, err := documentExpiry(req, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	previous, documentID, err := r.findPreviousVersion(collectionName, req, contentHash)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && previous.ContentHash == contentHash {
+		if req.ACL != nil {
+			if err := r.vectorDB.SetDocumentACL(previous.ID, req.ACL); err != nil {
+				return nil, err
+			}
+		}
+		if expiresAt != nil {
+			if err := r.vectorDB.SetDocumentExpiry(previous.ID, expiresAt); err != nil {
+				return nil, err
+			}
+		} else {
+			expiresAt = previous.ExpiresAt
+		}
+		log.Printf("Document '%s' is unchanged, skipping", req.Source)
+		return &preparedDocument{req: req, result: &IngestResult{Status: IngestUnchanged, DocumentID: previous.ID, ExpiresAt: expiresAt}}, nil
+	}
+
+	doc, scanStats, err := parseDocument(ctx, req, content)
+	if err != nil {
+		return nil, err
+	}
+	supplied := make(map[*models.EnhancedChunk]bool, len(req.Chunks))
+	if len(req.Chunks) > 0 {
+		for _, chunk := range doc.Chunks {
+			supplied[chunk] = true
+		}
+	}
+	if err := r.weightKeywords(collectionName, doc); err != nil {
+		return nil, err
+	}
+	doc.ContentHash = contentHash
+
+	// A new version keeps the ACL and expiry of the one it replaces unless the request sets its own
+	doc.ACL = req.ACL
+	if doc.ACL == nil && previous != nil {
+		doc.ACL = previous.ACL
+	}
+	doc.ExpiresAt = expiresAt
+	if doc.ExpiresAt == nil && previous != nil {
+		doc.ExpiresAt = previous.ExpiresAt
 	}
 
 	log.Printf("Document processed: %d chunks created using %s strategy",
 		len(doc.Chunks), doc.Metadata["chunking_strategy"])
 
-	// Generate embeddings for all chunks
-	log.Printf("Generating embeddings for %d chunks...", len(doc.Chunks))
-	if err := r.generateEmbeddings(doc.Chunks); err != nil {
-		return fmt.Errorf("failed to generate embeddings: %w", err)
+	previousID := ""
+	if previous != nil {
+		previousID = previous.ID
 	}
+	prepared := &preparedDocument{req: req, doc: doc, previous: previous, result: &IngestResult{Status: IngestAdded, DocumentID: doc.ID, ExpiresAt: doc.ExpiresAt}}
+	prepared.result.PagesRecognized, prepared.result.LowConfidenceChunks = scanStats.PagesRecognized, scanStats.LowConfidenceChunks
 
-	// Store document and chunks in vector database
-	if err := r.vectorDB.AddDocument(collectionName, doc); err != nil {
-		return fmt.Errorf("failed to add document to database: %w", err)
+	// Summaries are added as chunks before matching, so unchanged ones keep their embeddings
+	if req.SummaryTree {
+		stats, err := r.buildSummaryTree(ctx, doc, previousID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build summary tree: %w", err)
+		}
+		prepared.result.Summaries, prepared.result.SummaryFailures = stats.Summaries, stats.Failed
 	}
 
-	// Store embeddings
-	if err := r.vectorDB.AddEmbeddings(doc.Chunks); err != nil {
-		return fmt.Errorf("failed to add embeddings: %w", err)
+	// A failed title and summary leaves the document without them rather than failing its ingestion
+	if req.DocumentSummary {
+		summary, err := r.summarizeDocument(ctx, doc)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			log.Printf("Summarizing '%s' failed: %v", doc.Source, err)
+			prepared.result.DocumentSummaryFailed = true
+		} else {
+			prepared.result.Title, prepared.result.Summary = summary.Title, summary.Summary
+		}
 	}
 
-	log.Printf("Document '%s' added successfully in %v with %d chunks",
-		doc.Source, time.Since(startTime), len(doc.Chunks))
+	// Questions are embedded as chunks of their own, after the summaries they skip
+	if req.GenerateQuestions {
+		stats, err := r.generateChunkQuestions(ctx, doc, previousID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate questions: %w", err)
+		}
+		prepared.result.QuestionsGenerated, prepared.result.QuestionFailures = stats.Questions, stats.Failed
+	}
 
-	return nil
-}
+	// Table descriptions are embedded with their tables, so they are needed before matching too
+	if req.SummarizeTables {
+		stats, err := r.summarizeTables(ctx, doc, previousID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize tables: %w", err)
+		}
+		prepared.result.TablesSummarized, prepared.result.TableSummaryFailures = stats.Summarized, stats.Failed
+	}
 
-func (r *RAGService) Query(req *models.QueryRequest) (*models.QueryResponse, error) {
-	startTime := time.Now()
+	// Derived IDs are assigned last, so the chunks added above get them too
+	if documentID != "" {
+		assignDeterministicIDs(doc, documentID)
+		prepared.result.DocumentID = doc.ID
+	}
 
-	// Set defaults
-	if req.TopK <= 0 {
-		req.TopK = 5
+	prepared.result.ChunksReused, prepared.result.ChunksDeduplicated, err = r.reuseStoredChunks(collectionName, doc, previousID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Query expansion
-	query := req.Query
-	if req.QueryExpansion {
-		expandedQuery := r.expandQuery(req.Query)
-		if expandedQuery != req.Query {
-			query = expandedQuery
-			log.Printf("Query expanded: '%s' -> '%s'", req.Query, query)
+	for _, chunk := range doc.Chunks {
+		if chunk.DuplicateOf != nil {
+			continue
+		}
+		if len(chunk.Embedding) == 0 {
+			prepared.toEmbed = append(prepared.toEmbed, chunk)
+		} else if supplied[chunk] {
+			prepared.result.ChunksSupplied++
 		}
 	}
+	return prepared, nil
+}
 
-	// Generate query embedding
-	queryEmbedding, err := r.embeddingClient.GetEmbedding(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+// findPreviousVersion returns the stored document an ingestion would replace or leave unchanged:
+// the latest with the request's source or, with deterministic IDs, the one stored under the ID
+// derived for the content, which is returned too.
+func (r *RAGService) findPreviousVersion(collectionName string, req *models.AddDocumentRequest, contentHash string) (*StoredDocument, string, error) {
+	documentID := ""
+	if deterministicIDs(req) {
+		documentID = deterministicDocumentID(r.vectorDB.tenant, collectionName, req.Source, contentHash)
+		previous, err := r.vectorDB.FindDocument(collectionName, documentID)
+		if err != nil || previous != nil {
+			return previous, documentID, err
+		}
 	}
+	if req.Source == "" {
+		return nil, documentID, nil
+	}
+	previous, err := r.vectorDB.FindDocumentBySource(collectionName, req.Source)
+	return previous, documentID, err
+}
 
-	// Build metadata filters
-	filters := make(map[string]interface{})
-	for key, value := range req.MetadataFilters {
-		filters[key] = value
+// readDocumentContent returns the content of a document request, read from its file if it has one
+func readDocumentContent(req *models.AddDocumentRequest) (string, error) {
+	var content string
+	var err error
+	if req.FilePath != "" {
+		content, err = ReadFileContent(req.FilePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+	} else if req.Content != "" {
+		content = req.Content
+	} else if len(req.Chunks) > 0 {
+		content = suppliedContent(req.Chunks)
+	} else {
+		return "", fmt.Errorf("either file_path, content or chunks must be provided")
 	}
 
-	// Search for similar chunks
-	chunks, scores, err := r.vectorDB.QuerySimilarChunks(
-		req.CollectionName,
-		queryEmbedding,
-		req.TopK*2, // Get more for re-ranking
-		filters,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search similar chunks: %w", err)
+	if len(content) == 0 {
+		return "", fmt.Errorf("document content is empty")
 	}
+	return content, nil
+}
 
-	if len(chunks) == 0 {
-		return &models.QueryResponse{
-			Answer:         "I couldn't find any relevant information for your query.",
-			ProcessingTime: time.Since(startTime).Seconds(),
-			MetadataUsed:   len(req.MetadataFilters) > 0,
-		}, nil
-	}
-
-	// Apply semantic threshold filtering
-	if req.SemanticThreshold > 0 {
-		filteredChunks := make([]*models.EnhancedChunk, 0)
-		filteredScores := make([]float64, 0)
-
-		for i, score := range scores {
-			if score >= req.SemanticThreshold {
-				filteredChunks = append(filteredChunks, chunks[i])
-				filteredScores = append(filteredScores, score)
-			}
+// parseDocument parses and chunks a document's content the way its file type or doc type calls for
+func parseDocument(ctx context.Context, req *models.AddDocumentRequest, content string) (*models.Document, ocrStats, error) {
+	var doc *models.Document
+	var scanStats ocrStats
+	var err error
+	if len(req.Chunks) > 0 {
+		// Chunks embedded by the client are stored as they are
+		doc = buildImportedDocument(models.ImportedDocument{Content: content, Source: req.Source, DocType: req.DocType, Chunks: req.Chunks})
+	} else if req.FilePath != "" && needsOCR(req.FilePath) {
+		// PDFs and images are read page by page, by OCR where a page has no text layer
+		pages, readErr := readScannedFile(ctx, req.FilePath)
+		if readErr != nil {
+			return nil, scanStats, fmt.Errorf("failed to read file: %w", readErr)
+		}
+		format := strings.TrimPrefix(strings.ToLower(filepath.Ext(req.FilePath)), ".")
+		doc, scanStats, err = processScannedDocument(pages, req.Source, format, req.DocType, req.ChunkingConfig)
+	} else if req.FilePath != "" && isAudioFile(req.FilePath) {
+		// Recordings are transcribed, then chunked like a transcript
+		cues, transcribeErr := transcribeAudio(ctx, req.FilePath)
+		if transcribeErr != nil {
+			return nil, scanStats, fmt.Errorf("failed to transcribe file: %w", transcribeErr)
+		}
+		doc, err = processTranscript(cues, req.Source, "audio", req.DocType, req.ChunkingConfig)
+		if err == nil {
+			doc.Metadata["transcription_model"] = orDefault(config.AppConfig.Transcription.Model, "whisper-1")
+		}
+	} else if format := transcriptFormat(req.FilePath, req.DocType, content); format != "" {
+		// SRT, VTT and WhisperX transcripts are chunked along their cues, keeping their timestamps
+		cues, parseErr := parseTranscript(format, content)
+		if parseErr != nil {
+			return nil, scanStats, fmt.Errorf("failed to parse transcript: %w", parseErr)
 		}
+		doc, err = processTranscript(cues, req.Source, format, req.DocType, req.ChunkingConfig)
+	} else if req.FilePath != "" && parsers.Supports(req.FilePath) {
+		// Word and OpenDocument files are chunked along their heading outline
+		parsed, parseErr := parsers.ParseFile(req.FilePath)
+		if parseErr != nil {
+			return nil, scanStats, fmt.Errorf("failed to parse file: %w", parseErr)
+		}
+		doc, err = ProcessParsedDocument(parsed, req.Source, req.DocType, req.ChunkingConfig)
+	} else {
+		// Process document with enhanced chunking; Markdown files get the heading-aware chunker
+		docType := markdownDocType(req.FilePath, req.DocType)
+		doc, err = ProcessDocumentContent(content, req.Source, docType, req.ChunkingConfig)
+	}
+	if err != nil {
+		return nil, scanStats, fmt.Errorf("failed to process document: %w", err)
+	}
+	verifyChunkSpans(doc)
+	return doc, scanStats, nil
+}
 
-		chunks = filteredChunks
-		scores = filteredScores
+// finishDocument runs the steps that follow storing a document: removing the version it replaces
+// and extracting its knowledge graph
+func (r *RAGService) finishDocument(ctx context.Context, collectionName string, prepared *preparedDocument) error {
+	// The new version is stored before the old one goes, so the source never disappears from search
+	if prepared.previous != nil {
+		if err := r.vectorDB.DeleteDocument(prepared.previous.ID); err != nil {
+			return fmt.Errorf("failed to remove previous version: %w", err)
+		}
+		prepared.result.Status = IngestUpdated
+	}
 
-		if len(chunks) == 0 {
-			return &models.QueryResponse{
-				Answer:         "No chunks met the semantic similarity threshold.",
-				ProcessingTime: time.Since(startTime).Seconds(),
-				MetadataUsed:   len(req.MetadataFilters) > 0,
-			}, nil
+	if prepared.req.ExtractGraph {
+		stats, err := r.extractDocumentGraph(ctx, collectionName, prepared.doc)
+		if err != nil {
+			return fmt.Errorf("failed to extract knowledge graph: %w", err)
 		}
+		result := prepared.result
+		result.GraphEntities, result.GraphRelations, result.GraphFailedChunks = stats.Entities, stats.Relations, stats.FailedChunks
 	}
+	return nil
+}
 
-	// Include parent chunks if requested
-	if req.IncludeParents {
-		chunks, scores = r.includeParentChunks(chunks, scores)
+// UpdateChunkText replaces the text of a single chunk and re-embeds only that chunk, unless the
+// caller supplies the embedding of the new text
+func (r *RAGService) UpdateChunkText(ctx context.Context, chunkID, text string, embedding []float32) (*models.EnhancedChunk, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("chunk text cannot be empty")
 	}
 
-	// Re-ranking
-	var rerankedScores []float64
-	if req.RerankerEnabled && len(chunks) > 1 {
-		chunks, rerankedScores = r.rerankChunks(query, chunks, scores)
+	existing, err := r.vectorDB.GetChunk(chunkID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Limit to requested TopK after re-ranking
-	if len(chunks) > req.TopK {
-		chunks = chunks[:req.TopK]
-		scores = scores[:req.TopK]
-		if len(rerankedScores) > req.TopK {
-			rerankedScores = rerankedScores[:req.TopK]
+	if len(embedding) > 0 {
+		collectionName, err := r.vectorDB.chunkCollection(chunkID)
+		if err != nil {
+			return nil, err
 		}
+		if err := r.vectorDB.checkSuppliedEmbedding(collectionName, embedding); err != nil {
+			return nil, err
+		}
+	} else {
+		// A corrected table keeps its description
+		embedding, err = r.embeddingClient.GetEmbedding(ctx, embeddingText(&models.EnhancedChunk{Text: text, Metadata: existing.Metadata}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate embedding: %w", err)
+		}
+	}
+
+	// Only refresh keywords for chunks that were created with keyword extraction
+	var keywords []string
+	if len(existing.Keywords) > 0 {
+		language := detectLanguage(text)
+		if language == "" {
+			language = chunkLanguage(existing)
+		}
+		if language == "" {
+			language = defaultLanguage
+		}
+		keywords = keywordsIn(text, language)
 	}
 
-	// Prepare context for LLM
-	context := r.prepareContext(chunks)
+	if err := r.vectorDB.UpdateChunkText(chunkID, text, keywords, embedding); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Chunk '%s' updated to revision %d", chunkID, existing.Revision+1)
+
+	return r.vectorDB.GetChunk(chunkID)
+}
+
+// runQuery retrieves chunks for a query and generates its answer
+func (r *RAGService) runQuery(ctx context.Context, req *models.QueryRequest) (*queryOutcome, error) {
+	startTime := time.Now()
+
+	// Chitchat routed past retrieval gets its reply without touching the index or the chat model
+	if req.Route != nil && req.Route.RetrievalSkipped {
+		response := skippedRetrievalResponse(req, time.Since(startTime).Seconds())
+		return &queryOutcome{response: response, answer: response.Answer, timing: QueryTiming{Total: time.Since(startTime)}}, nil
+	}
 
-	// Generate answer using LLM
-	answer, err := r.generateAnswer(req.Query, context)
+	var retrieved *RetrievalResult
+	var trace []models.AgentStep
+	var err error
+	if req.Agentic {
+		retrieved, trace, err = r.retrieveAgentically(ctx, req)
+	} else {
+		retrieved, err = r.Retrieve(ctx, req)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate answer: %w", err)
+		return nil, err
+	}
+	chunks := retrieved.Chunks
+	degradations := retrieved.Degradations
+	timing := QueryTiming{Retrieval: time.Since(startTime)}
+
+	if len(chunks) == 0 {
+		answer := "I couldn't find any relevant information for your query."
+		if retrieved.BelowThreshold {
+			answer = "No chunks met the semantic similarity threshold."
+		}
+		timing.Total = time.Since(startTime)
+		response := &models.QueryResponse{
+			Answer:            answer,
+			ProcessingTime:    time.Since(startTime).Seconds(),
+			MetadataUsed:      len(req.MetadataFilters) > 0,
+			Degradations:      degradations,
+			ConfidenceDetails: &models.AnswerConfidence{NotFound: true},
+			Collections:       retrieved.Collections,
+			Route:             req.Route,
+			AgentTrace:        trace,
+		}
+		return &queryOutcome{response: response, chunks: chunks, answer: answer, timing: timing}, nil
+	}
+
+	// Quote the passages supporting the answer if requested; an extractive answer is only those
+	var passages []models.AnswerPassage
+	if req.AnswerMode == models.ExtractiveAnswer || req.AnswerMode == models.BothAnswers {
+		passages = selectPassages(req.Query, chunks)
+		r.locatePassages(passages, chunks)
+	}
+
+	var answer string
+	if req.AnswerMode == models.ExtractiveAnswer {
+		answer = quotePassages(passages)
+		if answer == "" {
+			answer = "I couldn't find any relevant information for your query."
+		}
+	} else {
+		// Prepare context for LLM
+		promptContext := r.prepareContext(chunks)
+
+		// Generate answer using LLM
+		generationStart := time.Now()
+		answer, err = r.generateAnswer(ctx, req.Query, promptContext, req.Generation)
+		timing.Generation = time.Since(generationStart)
+		if err != nil {
+			// A cancelled request gets no answer at all; a chat model that failed or timed out may degrade
+			if !config.AppConfig.Degradation.ExtractiveAnswers || ctx.Err() != nil {
+				return nil, fmt.Errorf("failed to generate answer: %w", err)
+			}
+			log.Printf("Chat model unavailable, returning extractive answer: %v", err)
+			answer = buildExtractiveAnswer(req.Query, chunks)
+			degradations = append(degradations, DegradedExtractiveAnswer)
+		}
+	}
+	requestedExtractive := req.AnswerMode == models.ExtractiveAnswer
+	extractive := requestedExtractive || contains(degradations, DegradedExtractiveAnswer)
+
+	// Check every sentence of a generated answer against the chunks, and strip the unsupported
+	// ones if requested. Extractive answers quote the chunks, so there is nothing to check.
+	var faithfulness *models.FaithfulnessReport
+	if req.VerifyFaithfulness && !extractive {
+		var verifyDegradations []string
+		answer, faithfulness, verifyDegradations, err = r.verifyFaithfulness(ctx, req, answer, chunks)
+		if err != nil {
+			return nil, err
+		}
+		degradations = append(degradations, verifyDegradations...)
 	}
 
 	// Prepare response
@@ -230,34 +580,88 @@ func (r *RAGService) Query(req *models.QueryRequest) (*models.QueryResponse, err
 		Answer:           answer,
 		RetrievedContext: r.extractChunkTexts(chunks),
 		EnhancedChunks:   chunks,
-		SimilarityScores: scores,
+		SimilarityScores: retrieved.Scores,
 		ProcessingTime:   time.Since(startTime).Seconds(),
 		MetadataUsed:     len(req.MetadataFilters) > 0,
+		Degradations:     degradations,
+		ExpandedQueries:  retrieved.ExpandedQueries,
+		GraphEntities:    retrieved.GraphEntities,
+		Faithfulness:     faithfulness,
+		Collections:      retrieved.Collections,
+		Documents:        retrieved.Groups,
+
+		SuppressedDuplicates: retrieved.SuppressedDuplicates,
+
+		Passages:   passages,
+		Route:      req.Route,
+		AgentTrace: trace,
+	}
+	if req.AnswerMode == models.BothAnswers {
+		response.ExtractiveAnswer = quotePassages(passages)
+	}
+	if !extractive {
+		response.Model = config.AppConfig.ChatModel
+		if req.Generation != nil && req.Generation.Model != "" {
+			response.Model = req.Generation.Model
+		}
 	}
 
-	if len(rerankedScores) > 0 {
-		response.RerankedScores = rerankedScores
+	if len(retrieved.RerankedScores) > 0 {
+		response.RerankedScores = retrieved.RerankedScores
 	}
 
-	return response, nil
-}
+	// Map [n] markers in the answer back to the chunks given to the LLM as [Context n]
+	response.Citations = r.buildCitations(answer, chunks)
 
-func (r *RAGService) generateEmbeddings(chunks []*models.EnhancedChunk) error {
-	texts := make([]string, len(chunks))
-	for i, chunk := range chunks {
-		texts[i] = chunk.Text
+	// Estimate how far the answer can be trusted, and have the chat model check it if requested
+	response.Confidence, response.IsGrounded, response.ConfidenceDetails = estimateConfidence(answer, retrieved.Scores, response.Citations, extractive)
+	// A requested extractive answer is never sent to the chat model, so there is nothing to check
+	if req.SelfCheck && !requestedExtractive {
+		checkErr := fmt.Errorf("no generated answer to check")
+		if !extractive {
+			checkErr = r.selfCheck(ctx, req.Query, chunks, response)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if checkErr != nil {
+			log.Printf("Self-check failed, confidence from retrieval only: %v", checkErr)
+			response.Degradations = append(response.Degradations, DegradedSelfCheckSkipped)
+		}
 	}
+	applyFaithfulness(response)
 
-	embeddings, err := r.embeddingClient.GetEmbeddings(texts)
-	if err != nil {
-		return err
+	// Locate the passages of each chunk that support the answer
+	if req.Highlights {
+		highlightReq := req
+		if requestedExtractive && req.HighlightBackend == models.LLMHighlights {
+			embeddingReq := *req
+			embeddingReq.HighlightBackend = models.EmbeddingHighlights
+			highlightReq = &embeddingReq
+		}
+		highlights, highlightDegradations, err := r.highlightAnswer(ctx, highlightReq, answer, chunks)
+		if err != nil {
+			return nil, err
+		}
+		response.Highlights = highlights
+		response.Degradations = append(response.Degradations, highlightDegradations...)
 	}
 
-	for i, embedding := range embeddings {
-		chunks[i].Embedding = embedding
+	// Suggest follow-up questions the chunks answer
+	if req.SuggestQuestions {
+		questions, err := r.suggestQuestions(ctx, req.Query, answer, chunks)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			log.Printf("Suggesting follow-up questions failed, answering without them: %v", err)
+			response.Degradations = append(response.Degradations, DegradedSuggestionsSkipped)
+		}
+		response.SuggestedQuestions = questions
 	}
 
-	return nil
+	timing.Total = time.Since(startTime)
+	return &queryOutcome{response: response, chunks: chunks, answer: answer, timing: timing}, nil
 }
 
 func (r *RAGService) expandQuery(query string) string {
@@ -524,17 +928,30 @@ func (r *RAGService) prepareContext(chunks []*models.EnhancedChunk) string {
 	return strings.Join(contextParts, "\n\n")
 }
 
-func (r *RAGService) generateAnswer(query, context string) (string, error) {
-	prompt := fmt.Sprintf(`You are a helpful AI assistant. Based on the provided context, answer the user's question accurately and comprehensively. If the context doesn't contain enough information to answer the question, say so clearly.
+// generateAnswer asks the chat model to answer query from the context, with the model and sampling
+// parameters of gen when it is set. A system prompt in gen replaces the default assistant persona.
+func (r *RAGService) generateAnswer(ctx context.Context, query, promptContext string, gen *models.GenerationOptions) (string, error) {
+	persona := "You are a helpful AI assistant. "
+	var options models.GenerationOptions
+	if gen != nil {
+		options = *gen
+		if gen.SystemPrompt != "" {
+			persona = ""
+		}
+	}
+
+	prompt := fmt.Sprintf(`%sBased on the provided context, answer the user's question accurately and comprehensively. If the context doesn't contain enough information to answer the question, say so clearly.
+
+Cite your sources: after each statement, add the number of the context it came from in square brackets, e.g. [1] or [2, 3]. Only cite context numbers that appear below.
 
 Context:
 %s
 
 Question: %s
 
-Answer:`, context, query)
+Answer:`, persona, promptContext, query)
 
-	return r.llmClient.GenerateResponse(prompt)
+	return r.llmClient.GenerateWithOptions(ctx, prompt, options)
 }
 
 func (r *RAGService) extractChunkTexts(chunks []*models.EnhancedChunk) []string {
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrReadOnly is returned for changes asked for while the server is read-only
+var ErrReadOnly = errors.New("the server is in read-only mode")
+
+// ReadOnlyStatus reports whether the server refuses changes
+type ReadOnlyStatus struct {
+	ReadOnly  bool       `json:"read_only"`
+	Reason    string     `json:"reason,omitempty"`     // Given when it was last switched at runtime
+	ChangedAt *time.Time `json:"changed_at,omitempty"` // When it was last switched at runtime
+}
+
+// readOnly holds whether the server refuses changes. It starts from the configuration and can be
+// switched at runtime. The API refuses changing requests while it is set, and the work that writes
+// to the database on its own (the expiry sweep, scheduled crawls, maintenance, key rotation,
+// re-embedding, the query log and the warm-up's keyword indexing) checks it before writing. Only
+// the audit log is still written, so refused requests are on record.
+var readOnly struct {
+	sync.RWMutex
+	status ReadOnlyStatus
+}
+
+// ConfigureReadOnly starts read-only mode as configured, forgetting runtime switches
+func ConfigureReadOnly(enabled bool) {
+	readOnly.Lock()
+	defer readOnly.Unlock()
+	readOnly.status = ReadOnlyStatus{ReadOnly: enabled}
+}
+
+// SetReadOnly switches read-only mode at runtime
+func SetReadOnly(enabled bool, reason string) ReadOnlyStatus {
+	readOnly.Lock()
+	defer readOnly.Unlock()
+	now := time.Now().UTC()
+	readOnly.status = ReadOnlyStatus{ReadOnly: enabled, Reason: reason, ChangedAt: &now}
+	return readOnly.status
+}
+
+// GetReadOnlyStatus returns the current read-only status
+func GetReadOnlyStatus() ReadOnlyStatus {
+	readOnly.RLock()
+	defer readOnly.RUnlock()
+	return readOnly.status
+}
+
+// checkWritable returns ErrReadOnly while the server is read-only
+func checkWritable() error {
+	if GetReadOnlyStatus().ReadOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"testing"
+	"time"
+)
+
+func TestReadOnlyPausesBackgroundWrites(t *testing.T) {
+	t.Cleanup(func() { ConfigureReadOnly(false) })
+	savedQueryLog := config.AppConfig.QueryLog
+	t.Cleanup(func() { config.AppConfig.QueryLog = savedQueryLog })
+	config.AppConfig.QueryLog = config.QueryLogConfig{Enabled: true}
+
+	db := newTestDB(t)
+	if err := db.CreateCollection("replica", "", nil, nil); err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	if err := db.addDocuments(context.Background(), "replica", []*models.Document{testDocument("stale", []string{"old news"}, 4)}, 4); err != nil {
+		t.Fatalf("addDocuments: %v", err)
+	}
+	expired := time.Now().Add(-time.Hour)
+	if err := db.SetDocumentExpiry("stale", &expired); err != nil {
+		t.Fatalf("SetDocumentExpiry: %v", err)
+	}
+
+	SetReadOnly(true, "disaster recovery replica")
+	sweeper := &ExpirySweeper{db: db, interval: time.Hour}
+	if _, err := sweeper.Sweep(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Sweep while read-only: got %v, want ErrReadOnly", err)
+	}
+	maintainer, _ := NewMaintenanceScheduler(db, config.MaintenanceConfig{})
+	if _, err := maintainer.Run(MaintenanceManual, []string{MaintenancePruneOrphans}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("maintenance while read-only: got %v, want ErrReadOnly", err)
+	}
+	NewRAGService(db, nil, nil).LogQuery("search", &models.QueryRequest{CollectionName: "replica", Query: "news"}, nil, "", QueryTiming{})
+	if n := countRows(t, db, "query_log", "1"); n != 0 {
+		t.Errorf("query_log has %d entries written while read-only", n)
+	}
+	if n := countRows(t, db, "documents", "id = 'stale'"); n != 1 {
+		t.Fatal("the expired document was deleted while read-only")
+	}
+
+	// Once writable, the sweep catches up
+	SetReadOnly(false, "")
+	if deleted, err := sweeper.Sweep(); err != nil || deleted != 1 {
+		t.Errorf("Sweep once writable = %d, %v; want 1 deleted", deleted, err)
+	}
+}
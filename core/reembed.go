@@ -0,0 +1,450 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReembedBatchSize = 64
+	maxReembedPasses        = 3 // Passes over chunks stored while a run was going, before giving up on catching up
+
+	// reembedTable receives the new embeddings until they replace those of the chunks in scope
+	reembedTable = "chunk_embeddings_next"
+)
+
+// States of a re-embedding run
+const (
+	ReembedRunning   = "running"
+	ReembedCompleted = "completed"
+	ReembedFailed    = "failed"
+)
+
+// ReembedStatus reports the progress of re-embedding a collection
+type ReembedStatus struct {
+	CollectionName string     `json:"collection_name,omitempty"` // Empty when every collection is re-embedded
+	Model          string     `json:"model"`
+	State          string     `json:"state"`
+	TotalChunks    int        `json:"total_chunks"`
+	EmbeddedChunks int        `json:"embedded_chunks"`
+	Dimension      int        `json:"dimension,omitempty"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// reembedRuns tracks re-embedding runs of this process. Only one runs at a time, as every run
+// writes to the same shadow table.
+var reembedRuns = struct {
+	sync.Mutex
+	active bool
+	latest map[string]ReembedStatus // Latest run by tenant and collection
+}{latest: make(map[string]ReembedStatus)}
+
+// claimReembed reserves the right to run a re-embedding until releaseReembed is called
+func claimReembed() error {
+	reembedRuns.Lock()
+	defer reembedRuns.Unlock()
+	if reembedRuns.active {
+		return fmt.Errorf("a re-embedding is already running")
+	}
+	reembedRuns.active = true
+	return nil
+}
+
+func releaseReembed() {
+	reembedRuns.Lock()
+	reembedRuns.active = false
+	reembedRuns.Unlock()
+}
+
+func reembedKey(tenant, collectionName string) string {
+	return tenant + "/" + collectionName
+}
+
+// StartReembed re-embeds a collection in the background and returns its initial status; later
+// progress is reported by ReembedStatus
+func (r *RAGService) StartReembed(collectionName string, req *models.ReembedRequest) (ReembedStatus, error) {
+	var exists bool
+	err := r.vectorDB.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM collections WHERE name = ? AND tenant_id = ?)`,
+		collectionName, r.vectorDB.tenant).Scan(&exists)
+	if err != nil {
+		return ReembedStatus{}, fmt.Errorf("failed to check collection existence: %w", err)
+	}
+	if !exists {
+		return ReembedStatus{}, fmt.Errorf("collection '%s' not found", collectionName)
+	}
+
+	if err := claimReembed(); err != nil {
+		return ReembedStatus{}, err
+	}
+
+	key := reembedKey(r.vectorDB.tenant, collectionName)
+	record := func(status ReembedStatus) {
+		reembedRuns.Lock()
+		reembedRuns.latest[key] = status
+		reembedRuns.Unlock()
+	}
+
+	status := newReembedStatus(collectionName, req)
+	record(status)
+
+	go func() {
+		defer releaseReembed()
+		if _, err := r.reembed(context.Background(), status, req, record); err != nil {
+			log.Printf("Re-embedding collection %s failed: %v", collectionName, err)
+		}
+	}()
+	return status, nil
+}
+
+// ReembedStatus returns the status of the latest re-embedding of a collection, if there was one
+func (r *RAGService) ReembedStatus(collectionName string) (ReembedStatus, bool) {
+	reembedRuns.Lock()
+	defer reembedRuns.Unlock()
+	status, ok := reembedRuns.latest[reembedKey(r.vectorDB.tenant, collectionName)]
+	return status, ok
+}
+
+// Reembed re-embeds a collection and returns when done, calling progress after every batch. An
+// empty collection name re-embeds every collection of every tenant.
+func (r *RAGService) Reembed(ctx context.Context, collectionName string, req *models.ReembedRequest, progress func(ReembedStatus)) (ReembedStatus, error) {
+	if err := claimReembed(); err != nil {
+		return ReembedStatus{}, err
+	}
+	defer releaseReembed()
+
+	return r.reembed(ctx, newReembedStatus(collectionName, req), req, progress)
+}
+
+func newReembedStatus(collectionName string, req *models.ReembedRequest) ReembedStatus {
+	model := req.Model
+	if model == "" {
+		model = config.AppConfig.EmbeddingModel
+	}
+	return ReembedStatus{
+		CollectionName: collectionName,
+		Model:          model,
+		State:          ReembedRunning,
+		StartedAt:      time.Now(),
+	}
+}
+
+// reembed streams the chunks that have embeddings through the model in batches and writes the
+// results to a shadow table. Once every chunk is done, including chunks stored in the meantime,
+// the shadow replaces the old embeddings in a single transaction, so searches see either the old
+// embeddings or the new ones, never a mix.
+func (r *RAGService) reembed(ctx context.Context, status ReembedStatus, req *models.ReembedRequest, progress func(ReembedStatus)) (ReembedStatus, error) {
+	batchSize := req.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultReembedBatchSize
+	}
+
+	finish := func(err error) (ReembedStatus, error) {
+		now := time.Now()
+		status.FinishedAt = &now
+		status.State = ReembedCompleted
+		if err != nil {
+			status.State = ReembedFailed
+			status.Error = err.Error()
+			r.vectorDB.dropReembedTable()
+		}
+		progress(status)
+		return status, err
+	}
+
+	ids, err := r.vectorDB.embeddedChunkIDs(status.CollectionName)
+	if err != nil {
+		return finish(err)
+	}
+	status.TotalChunks = len(ids)
+	progress(status)
+	log.Printf("Re-embedding %d chunks with model %s", len(ids), status.Model)
+
+	if err := r.vectorDB.dropReembedTable(); err != nil {
+		return finish(err)
+	}
+
+	done := make(map[string]bool)
+	for pass := 0; len(ids) > 0; pass++ {
+		if pass == maxReembedPasses {
+			return finish(fmt.Errorf("chunks kept being added faster than they were re-embedded"))
+		}
+
+		for start := 0; start < len(ids); start += batchSize {
+			if err := ctx.Err(); err != nil {
+				return finish(err)
+			}
+			if err := checkWritable(); err != nil {
+				return finish(err)
+			}
+
+			chunks, err := r.vectorDB.chunkTexts(ids[start:min(start+batchSize, len(ids))])
+			if err != nil {
+				return finish(err)
+			}
+			if err := r.reembedBatch(ctx, &status, chunks); err != nil {
+				return finish(err)
+			}
+			for _, chunk := range chunks {
+				done[chunk.ID] = true
+			}
+			status.EmbeddedChunks += len(chunks)
+			progress(status)
+		}
+
+		// Chunks stored while the run was going still carry the old model's embeddings
+		current, err := r.vectorDB.embeddedChunkIDs(status.CollectionName)
+		if err != nil {
+			return finish(err)
+		}
+		ids = ids[:0]
+		for _, id := range current {
+			if !done[id] {
+				ids = append(ids, id)
+			}
+		}
+		status.TotalChunks += len(ids)
+	}
+
+	if status.Dimension > 0 {
+		if err := r.vectorDB.swapReembedTable(status.CollectionName, status.Dimension); err != nil {
+			return finish(err)
+		}
+	}
+
+	if status.Model != config.AppConfig.EmbeddingModel {
+		log.Printf("Warning: re-embedded with model %s, but queries are embedded with %s until embedding_model is changed",
+			status.Model, config.AppConfig.EmbeddingModel)
+	}
+	log.Printf("Re-embedding finished: %d chunks, %d dimensions", status.EmbeddedChunks, status.Dimension)
+	publishEvent(r.vectorDB.tenant, EventReembedCompleted, status.CollectionName, map[string]interface{}{
+		"model":           status.Model,
+		"dimension":       status.Dimension,
+		"embedded_chunks": status.EmbeddedChunks,
+	})
+	return finish(nil)
+}
+
+// reembedBatch embeds chunks with the run's model and writes them to the shadow table, creating it
+// with the dimension of the first batch
+func (r *RAGService) reembedBatch(ctx context.Context, status *ReembedStatus, chunks []*models.EnhancedChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = embeddingText(chunk)
+	}
+	embeddings, err := GetEmbeddings(ctx, texts, status.Model)
+	if err != nil {
+		return fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+	if len(embeddings) != len(chunks) {
+		return fmt.Errorf("expected %d embeddings, got %d", len(chunks), len(embeddings))
+	}
+	for i, chunk := range chunks {
+		chunk.Embedding = embeddings[i]
+	}
+
+	if status.Dimension == 0 {
+		status.Dimension = len(embeddings[0])
+		if err := r.vectorDB.createReembedTable(status.Dimension); err != nil {
+			return err
+		}
+	}
+
+	tx, err := r.vectorDB.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO ` + reembedTable + ` (chunk_id, embedding) VALUES (?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare embedding insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) != status.Dimension {
+			return fmt.Errorf("chunk %s has embedding dimension %d, expected %d", chunk.ID, len(chunk.Embedding), status.Dimension)
+		}
+		embedding, err := serializeEmbedding(chunk.Embedding)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(chunk.ID, embedding); err != nil {
+			return fmt.Errorf("failed to write embedding for chunk %s: %w", chunk.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// reembedScope returns the condition on enhanced_chunks selecting the chunks of a re-embedding run;
+// an empty collection name selects every chunk of every tenant
+func (db *VectorDB) reembedScope(collectionName string) (string, []interface{}) {
+	if collectionName == "" {
+		return "1 = 1", nil
+	}
+	return "collection_name = ? AND tenant_id = ?", []interface{}{collectionName, db.tenant}
+}
+
+// embeddedChunkIDs lists the chunks in scope that have an embedding. Duplicates share the
+// embedding of their original and are not listed.
+func (db *VectorDB) embeddedChunkIDs(collectionName string) ([]string, error) {
+	tables, err := existingEmbeddingTables(db.conn)
+	if err != nil || len(tables) == 0 {
+		return nil, err
+	}
+
+	scope, args := db.reembedScope(collectionName)
+	ids, err := queryStrings(db.conn, `
+		SELECT id FROM enhanced_chunks
+		WHERE `+scope+` AND id IN (`+embeddedChunksSQL(tables)+`)
+		ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embedded chunks: %w", err)
+	}
+	return ids, nil
+}
+
+// chunkTexts loads the text and table description of the given chunks; chunks deleted in the
+// meantime are left out
+func (db *VectorDB) chunkTexts(ids []string) ([]*models.EnhancedChunk, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := db.conn.Query(`SELECT id, rag_open(text), json_extract(metadata, '$.table_summary') FROM enhanced_chunks
+		WHERE id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chunk texts: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []*models.EnhancedChunk
+	for rows.Next() {
+		chunk := &models.EnhancedChunk{}
+		var tableSummary *string
+		if err := rows.Scan(&chunk.ID, &chunk.Text, &tableSummary); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		if tableSummary != nil {
+			chunk.Metadata = map[string]interface{}{"table_summary": *tableSummary}
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	queryRower
+	rowsQuerier
+}
+
+// createReembedTable creates the shadow table for embeddings of the given dimension
+func (db *VectorDB) createReembedTable(dimension int) error {
+	_, err := db.conn.Exec(fmt.Sprintf(`
+		CREATE VIRTUAL TABLE `+reembedTable+` USING vec0(
+			chunk_id TEXT PRIMARY KEY,
+			embedding FLOAT[%d]
+		)`, dimension))
+	if err != nil {
+		return fmt.Errorf("failed to create re-embedding table: %w", err)
+	}
+	return nil
+}
+
+// dropReembedTable removes the shadow table, including one left behind by an interrupted run
+func (db *VectorDB) dropReembedTable() error {
+	if _, err := db.conn.Exec(`DROP TABLE IF EXISTS ` + reembedTable); err != nil {
+		return fmt.Errorf("failed to drop re-embedding table: %w", err)
+	}
+	return nil
+}
+
+// swapReembedTable replaces the embeddings in scope with those of the shadow table and drops it,
+// in one transaction. Chunks of quantized collections get the new vectors quantized, and float
+// ones only when they are rescored. The new vectors go to the tables of their dimension, which
+// becomes that of every collection in scope; other collections keep theirs.
+func (db *VectorDB) swapReembedTable(collectionName string, dimension int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := db.deleteEmbeddings(tx, `chunk_id IN (SELECT chunk_id FROM `+reembedTable+`)`); err != nil {
+		return fmt.Errorf("failed to replace embeddings: %w", err)
+	}
+	if err := createFloatTable(tx, dimension); err != nil {
+		return err
+	}
+
+	// The new vectors of each chunk go to the tables its collection's quantization writes to
+	source := `
+		FROM ` + reembedTable + ` n
+		JOIN enhanced_chunks c ON c.id = n.chunk_id
+		LEFT JOIN collections col ON col.name = c.collection_name AND col.tenant_id = c.tenant_id
+		WHERE `
+	quantizationType := `COALESCE(json_extract(col.metadata, '$.quantization.type'), '')`
+	_, err = tx.Exec(`
+		INSERT INTO ` + floatEmbeddingTable(dimension) + ` (tenant_id, collection_name, chunk_id, embedding)
+		SELECT c.tenant_id, c.collection_name, n.chunk_id, n.embedding` + source + quantizationType + ` = '' OR json_extract(col.metadata, '$.quantization.rescore') = 1`)
+	if err != nil {
+		return fmt.Errorf("failed to copy re-embedded vectors: %w", err)
+	}
+	for _, t := range quantizationTypes {
+		var quantized bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1`+source+quantizationType+` = ?)`, t).Scan(&quantized); err != nil {
+			return fmt.Errorf("failed to check for quantized collections: %w", err)
+		}
+		if !quantized {
+			continue
+		}
+		if err := createQuantizedTable(tx, t, dimension); err != nil {
+			return err
+		}
+		store := quantizedStores[t]
+		_, err = tx.Exec(`
+			INSERT INTO `+quantizedEmbeddingTable(t, dimension)+` (tenant_id, collection_name, chunk_id, embedding)
+			SELECT c.tenant_id, c.collection_name, n.chunk_id, `+fmt.Sprintf(store.quantize, "n.embedding")+source+quantizationType+` = ?`, t)
+		if err != nil {
+			return fmt.Errorf("failed to copy re-embedded vectors: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`DROP TABLE ` + reembedTable); err != nil {
+		return fmt.Errorf("failed to drop re-embedding table: %w", err)
+	}
+
+	collections, args := `1 = 1`, []interface{}{dimension}
+	if collectionName != "" {
+		collections = `name = ? AND tenant_id = ?`
+		args = append(args, collectionName, db.tenant)
+	}
+	if _, err := tx.Exec(`UPDATE collections SET embedding_dimension = ? WHERE `+collections, args...); err != nil {
+		return fmt.Errorf("failed to record embedding dimension: %w", err)
+	}
+	scope, args := db.reembedScope(collectionName)
+	if err := clearDocumentEmbeddings(tx, scope, args...); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit re-embedding: %w", err)
+	}
+	log.Printf("Swapped in re-embedded vectors with %d dimensions", dimension)
+	rebuildANNIndexes("", "")
+	return nil
+}
@@ -0,0 +1,541 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"rag-go-app/config"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	ReplicationModeFile     = "file"
+	ReplicationModeFollower = "follower"
+	ReplicationModeS3       = "s3"
+
+	defaultReplicationInterval = 30 * time.Second
+
+	// ReplicationChecksumHeader carries the sha256 of a snapshot posted to a follower
+	ReplicationChecksumHeader = "X-Snapshot-Checksum"
+)
+
+// ErrSnapshotTooLarge is returned when a follower is sent a snapshot larger than it accepts
+var ErrSnapshotTooLarge = errors.New("snapshot is too large")
+
+// replicationSegmentBytes is the size of the segments snapshots are split into in s3 mode
+var replicationSegmentBytes int64 = 4 << 20
+
+// replicationManifest lists, in order, the segments of the snapshot last shipped to S3. It is
+// uploaded after its segments, so a reader never sees a manifest whose segments are missing.
+type replicationManifest struct {
+	Checksum     string    `json:"checksum"`
+	Size         int64     `json:"size"`
+	SegmentBytes int64     `json:"segment_bytes"`
+	Segments     []string  `json:"segments"` // sha256 of each segment, which is also its key
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ReplicationStatus describes the state of warm standby replication
+type ReplicationStatus struct {
+	Enabled           bool       `json:"enabled"`
+	Mode              string     `json:"mode,omitempty"`
+	Target            string     `json:"target,omitempty"`
+	IntervalSeconds   int        `json:"interval_seconds,omitempty"`
+	LastSnapshotAt    *time.Time `json:"last_snapshot_at,omitempty"`
+	LastShippedAt     *time.Time `json:"last_shipped_at,omitempty"`
+	LastChecksum      string     `json:"last_checksum,omitempty"`
+	LastSnapshotBytes int64      `json:"last_snapshot_bytes,omitempty"`
+	LastShippedBytes  int64      `json:"last_shipped_bytes,omitempty"` // Less than the snapshot in s3 mode when segments were unchanged
+	SnapshotsShipped  int        `json:"snapshots_shipped"`
+	LastError         string     `json:"last_error,omitempty"`
+	LastErrorAt       *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Replicator periodically takes a consistent snapshot of the database and ships it
+// to a standby, so the standby can lose up to one interval of writes. Unchanged snapshots are
+// detected by checksum and not shipped again. In file and follower mode each snapshot is shipped
+// whole; in s3 mode only the segments that changed since the last snapshot are uploaded.
+type Replicator struct {
+	db       *VectorDB
+	cfg      config.ReplicationConfig
+	interval time.Duration
+	s3       *s3Client
+
+	mu     sync.Mutex // Serializes sync runs and guards status and the segment sets
+	status ReplicationStatus
+
+	// In s3 mode, the segments stored in the bucket, and those of the last two manifests, which
+	// are kept so a standby reading the previous manifest can still finish
+	storedSegments   map[string]bool
+	currentSegments  []string
+	previousSegments []string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewReplicator validates the replication settings and returns a replicator that has not been started
+func NewReplicator(db *VectorDB, cfg config.ReplicationConfig) (*Replicator, error) {
+	if cfg.Mode == "" {
+		cfg.Mode = ReplicationModeFile
+	}
+
+	var target string
+	switch cfg.Mode {
+	case ReplicationModeFile:
+		if cfg.TargetPath == "" {
+			return nil, fmt.Errorf("replication mode %q requires target_path", cfg.Mode)
+		}
+		target = cfg.TargetPath
+	case ReplicationModeFollower:
+		if cfg.FollowerURL == "" {
+			return nil, fmt.Errorf("replication mode %q requires follower_url", cfg.Mode)
+		}
+		target = strings.TrimRight(cfg.FollowerURL, "/")
+	case ReplicationModeS3:
+		if cfg.S3.Bucket == "" {
+			return nil, fmt.Errorf("replication mode %q requires s3.bucket", cfg.Mode)
+		}
+		target = "s3://" + cfg.S3.Bucket + "/" + cfg.S3.Prefix
+	default:
+		return nil, fmt.Errorf("unknown replication mode %q", cfg.Mode)
+	}
+
+	interval := time.Duration(cfg.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultReplicationInterval
+	}
+
+	var s3 *s3Client
+	if cfg.Mode == ReplicationModeS3 {
+		var err error
+		if s3, err = newS3Client(cfg.S3); err != nil {
+			return nil, fmt.Errorf("invalid replication s3 settings: %w", err)
+		}
+	}
+
+	return &Replicator{
+		db:       db,
+		cfg:      cfg,
+		interval: interval,
+		s3:       s3,
+		status: ReplicationStatus{
+			Enabled:         true,
+			Mode:            cfg.Mode,
+			Target:          target,
+			IntervalSeconds: int(interval / time.Second),
+		},
+	}, nil
+}
+
+// Start runs the replication loop in the background until Stop is called
+func (r *Replicator) Start() {
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Sync(); err != nil {
+					log.Printf("Replication sync failed: %v", err)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+
+	log.Printf("Replication enabled: %s -> %s every %v", r.cfg.Mode, r.status.Target, r.interval)
+}
+
+// Stop ends the replication loop and ships a final snapshot so the standby has the latest writes
+func (r *Replicator) Stop() {
+	if r.stop == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+	r.stop = nil
+
+	if err := r.Sync(); err != nil {
+		log.Printf("Final replication sync failed: %v", err)
+	}
+}
+
+// Status returns a copy of the current replication status
+func (r *Replicator) Status() ReplicationStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Sync takes a snapshot and ships it if it differs from the last shipped snapshot
+func (r *Replicator) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.syncLocked()
+	if err != nil {
+		now := time.Now()
+		r.status.LastError = err.Error()
+		r.status.LastErrorAt = &now
+	}
+	return err
+}
+
+func (r *Replicator) syncLocked() error {
+	takeSnapshot := r.db.Snapshot
+	if r.cfg.Mode == ReplicationModeS3 {
+		// VACUUM INTO rewrites every page, so a small change would move most segments
+		takeSnapshot = r.db.pageSnapshot
+	}
+	snapshotPath, err := takeSnapshot()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(snapshotPath)
+
+	snapshot, err := os.Open(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	defer snapshot.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if _, err := snapshot.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	now := time.Now()
+	r.status.LastSnapshotAt = &now
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if checksum == r.status.LastChecksum {
+		return nil
+	}
+
+	shipped := size
+	switch r.cfg.Mode {
+	case ReplicationModeFile:
+		_, err = writeFileAtomic(r.cfg.TargetPath, snapshot, nil)
+	case ReplicationModeFollower:
+		err = r.postSnapshot(snapshot, size, checksum)
+	case ReplicationModeS3:
+		shipped, err = r.uploadSegments(snapshot, size, checksum)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ship snapshot: %w", err)
+	}
+
+	shippedAt := time.Now()
+	r.status.LastShippedAt = &shippedAt
+	r.status.LastChecksum = checksum
+	r.status.LastSnapshotBytes = size
+	r.status.LastShippedBytes = shipped
+	r.status.SnapshotsShipped++
+	r.status.LastError = ""
+	r.status.LastErrorAt = nil
+
+	log.Printf("Replicated snapshot %s (%d bytes, %d shipped) to %s", checksum[:12], size, shipped, r.status.Target)
+	return nil
+}
+
+// pageSnapshot copies the database page by page with SQLite's online backup API to a new temporary
+// file and returns its path. Unlike Snapshot the copy keeps the page layout of the database, so a
+// write only changes the segments holding the pages it touched. The caller removes the file.
+func (db *VectorDB) pageSnapshot() (string, error) {
+	tmp, err := os.CreateTemp("", "rag-snapshot-*.db")
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	path := tmp.Name()
+	tmp.Close()
+
+	if err := db.backupTo(path); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	return path, nil
+}
+
+func (db *VectorDB) backupTo(path string) error {
+	raw, err := (&sqlite3.SQLiteDriver{}).Open(path)
+	if err != nil {
+		return err
+	}
+	dest := raw.(*sqlite3.SQLiteConn)
+	defer dest.Close()
+	if encryption.dbKey != nil {
+		if _, err := dest.Exec(sqlcipherKeyPragma("key", encryption.dbKey), nil); err != nil {
+			return err
+		}
+	}
+
+	conn, err := db.conn.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		backup, err := dest.Backup("main", driverConn.(*sqlite3.SQLiteConn), "main")
+		if err != nil {
+			return err
+		}
+		// A single step copies every page under one read transaction, so the copy is consistent
+		if _, err := backup.Step(-1); err != nil {
+			backup.Finish()
+			return err
+		}
+		return backup.Finish()
+	})
+}
+
+// uploadSegments uploads the segments of the snapshot the bucket doesn't hold yet, then the manifest
+// listing all of them, and returns the number of bytes uploaded. Segments no longer listed by the
+// current or previous manifest are deleted afterwards.
+func (r *Replicator) uploadSegments(snapshot io.Reader, size int64, checksum string) (int64, error) {
+	ctx := context.Background()
+	if r.storedSegments == nil {
+		objects, err := r.s3.List(ctx, r.s3.prefixed("segments/"))
+		if err != nil {
+			return 0, err
+		}
+		r.storedSegments = make(map[string]bool, len(objects))
+		for _, object := range objects {
+			r.storedSegments[strings.TrimPrefix(object.Key, r.s3.prefixed("segments/"))] = true
+		}
+	}
+
+	manifest := replicationManifest{Checksum: checksum, Size: size, SegmentBytes: replicationSegmentBytes, CreatedAt: time.Now().UTC()}
+	var uploaded int64
+	buf := make([]byte, replicationSegmentBytes)
+	for {
+		n, err := io.ReadFull(snapshot, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			hash := hex.EncodeToString(sum[:])
+			if !r.storedSegments[hash] {
+				if err := r.s3.Put(r.s3.prefixed("segments/"+hash), bytes.NewReader(buf[:n]), int64(n), hash); err != nil {
+					return uploaded, err
+				}
+				r.storedSegments[hash] = true
+				uploaded += int64(n)
+			}
+			manifest.Segments = append(manifest.Segments, hash)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return uploaded, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+	}
+
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return uploaded, err
+	}
+	sum := sha256.Sum256(body)
+	if err := r.s3.Put(r.s3.prefixed("manifest.json"), bytes.NewReader(body), int64(len(body)), hex.EncodeToString(sum[:])); err != nil {
+		return uploaded, err
+	}
+	uploaded += int64(len(body))
+	r.previousSegments, r.currentSegments = r.currentSegments, manifest.Segments
+
+	keep := make(map[string]bool, len(r.currentSegments)+len(r.previousSegments))
+	for _, hash := range append(r.currentSegments, r.previousSegments...) {
+		keep[hash] = true
+	}
+	for hash := range r.storedSegments {
+		if keep[hash] {
+			continue
+		}
+		if err := r.s3.Delete(ctx, r.s3.prefixed("segments/"+hash)); err != nil {
+			log.Printf("Failed to delete replicated segment %s: %v", hash[:12], err)
+			continue
+		}
+		delete(r.storedSegments, hash)
+	}
+	return uploaded, nil
+}
+
+// PullReplica downloads the latest snapshot shipped to the bucket in s3 mode and stores it at
+// standbyPath after verifying its checksum. The file can be used as vector_db_path to replace a
+// failed primary.
+func PullReplica(ctx context.Context, cfg config.S3Config, standbyPath string) (int64, error) {
+	if standbyPath == "" {
+		return 0, fmt.Errorf("replication standby_path is not configured")
+	}
+	s3, err := newS3Client(cfg)
+	if err != nil {
+		return 0, err
+	}
+	if s3 == nil {
+		return 0, fmt.Errorf("replication s3.bucket is not configured")
+	}
+
+	var body bytes.Buffer
+	if _, err := s3.Get(ctx, s3.prefixed("manifest.json"), &body); err != nil {
+		return 0, err
+	}
+	var manifest replicationManifest
+	if err := json.Unmarshal(body.Bytes(), &manifest); err != nil {
+		return 0, fmt.Errorf("invalid replication manifest: %w", err)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		for _, hash := range manifest.Segments {
+			if _, err := s3.Get(ctx, s3.prefixed("segments/"+hash), writer); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		writer.Close()
+	}()
+	defer reader.Close()
+
+	hash := sha256.New()
+	size, err := writeFileAtomic(standbyPath, io.TeeReader(reader, hash), func(size int64) error {
+		if size != manifest.Size || hex.EncodeToString(hash.Sum(nil)) != manifest.Checksum {
+			return fmt.Errorf("invalid snapshot: checksum mismatch")
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("Pulled replicated snapshot %s (%d bytes) to %s", manifest.Checksum[:12], size, standbyPath)
+	return size, nil
+}
+
+// postSnapshot streams the snapshot to the follower's receive endpoint
+func (r *Replicator) postSnapshot(snapshot io.Reader, size int64, checksum string) error {
+	apiURL := r.status.Target + "/api/v1/admin/replication/snapshot"
+	req, err := http.NewRequest("POST", apiURL, snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(ReplicationChecksumHeader, checksum)
+	if r.cfg.FollowerAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.cfg.FollowerAPIKey)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach follower: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("follower rejected snapshot with status %s: %s", resp.Status, string(body))
+	}
+	return nil
+}
+
+// ReceiveSnapshot stores a snapshot shipped by a primary at standbyPath after verifying its checksum.
+// The body is streamed to disk, and one larger than maxBytes is refused with ErrSnapshotTooLarge;
+// a maxBytes of 0 accepts any size. The standby file can be used as vector_db_path to replace a
+// failed primary.
+func ReceiveSnapshot(standbyPath string, body io.Reader, checksum string, maxBytes int64) (int64, error) {
+	if standbyPath == "" {
+		return 0, fmt.Errorf("replication standby_path is not configured")
+	}
+
+	if maxBytes > 0 {
+		// One byte past the limit tells a body of exactly maxBytes from a longer one
+		body = io.LimitReader(body, maxBytes+1)
+	}
+	hash := sha256.New()
+	size, err := writeFileAtomic(standbyPath, io.TeeReader(body, hash), func(size int64) error {
+		if maxBytes > 0 && size > maxBytes {
+			return fmt.Errorf("%w: the limit is %d bytes", ErrSnapshotTooLarge, maxBytes)
+		}
+		if size == 0 {
+			return fmt.Errorf("invalid snapshot: empty body")
+		}
+		if checksum != "" && hex.EncodeToString(hash.Sum(nil)) != checksum {
+			return fmt.Errorf("invalid snapshot: checksum mismatch")
+		}
+		return nil
+	})
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return 0, fmt.Errorf("%w: the limit is %d bytes", ErrSnapshotTooLarge, tooLarge.Limit)
+		}
+		return 0, err
+	}
+
+	log.Printf("Stored replicated snapshot (%d bytes) at %s", size, standbyPath)
+	return size, nil
+}
+
+// writeFileAtomic copies r to a temporary file next to path and renames it into place, so readers
+// never observe a partially written database. When check is set it is given the number of bytes
+// written, and an error from it leaves path untouched.
+func writeFileAtomic(path string, r io.Reader, check func(size int64) error) (int64, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if check != nil {
+		if err := check(size); err != nil {
+			tmp.Close()
+			return 0, err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to sync %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close %s: %w", tmpPath, err)
+	}
+	if err := os.Chmod(tmpPath, 0o644); err != nil {
+		return 0, fmt.Errorf("failed to set permissions on %s: %w", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, fmt.Errorf("failed to move snapshot into place: %w", err)
+	}
+	return size, nil
+}
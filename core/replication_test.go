@@ -0,0 +1,255 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// checksumOf returns the sha256 of a file, as shipped in the checksum header
+func checksumOf(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestReplicatorShipsToFile(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateCollection("replicated", "", nil, nil); err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	target := filepath.Join(t.TempDir(), "standby", "rag.db")
+	replicator, err := NewReplicator(db, config.ReplicationConfig{Mode: ReplicationModeFile, TargetPath: target})
+	if err != nil {
+		t.Fatalf("NewReplicator: %v", err)
+	}
+
+	if err := replicator.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	status := replicator.Status()
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("stat target: %v", err)
+	}
+	if status.LastSnapshotBytes != info.Size() || status.LastChecksum != checksumOf(t, target) {
+		t.Errorf("status reports %d bytes with checksum %s; target has %d bytes with checksum %s",
+			status.LastSnapshotBytes, status.LastChecksum, info.Size(), checksumOf(t, target))
+	}
+
+	// An unchanged database is not shipped again
+	if err := replicator.Sync(); err != nil {
+		t.Fatalf("second Sync: %v", err)
+	}
+	if shipped := replicator.Status().SnapshotsShipped; shipped != 1 {
+		t.Errorf("snapshots shipped = %d, want 1", shipped)
+	}
+}
+
+func TestReplicatorShipsToFollower(t *testing.T) {
+	db := newTestDB(t)
+	standby := filepath.Join(t.TempDir(), "standby.db")
+	var contentLength int64
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		if _, err := ReceiveSnapshot(standby, r.Body, r.Header.Get(ReplicationChecksumHeader), 1<<30); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer follower.Close()
+
+	replicator, err := NewReplicator(db, config.ReplicationConfig{Mode: ReplicationModeFollower, FollowerURL: follower.URL})
+	if err != nil {
+		t.Fatalf("NewReplicator: %v", err)
+	}
+	if err := replicator.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	status := replicator.Status()
+	if contentLength != status.LastSnapshotBytes {
+		t.Errorf("snapshot posted with Content-Length %d, want %d", contentLength, status.LastSnapshotBytes)
+	}
+	if got := checksumOf(t, standby); got != status.LastChecksum {
+		t.Errorf("standby checksum %s, want %s", got, status.LastChecksum)
+	}
+}
+
+// newTestBucket serves an in-memory S3 bucket named "replicas" and returns its objects by key
+func newTestBucket(t *testing.T) (config.S3Config, map[string][]byte, *sync.Mutex) {
+	t.Helper()
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/replicas"), "/")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+			fmt.Fprint(w, "<ListBucketResult>")
+			for name, data := range objects {
+				if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+					fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", name, len(data))
+				}
+			}
+			fmt.Fprint(w, "</ListBucketResult>")
+		case r.Method == http.MethodPut:
+			objects[key], _ = io.ReadAll(r.Body)
+		case r.Method == http.MethodGet:
+			data, ok := objects[key]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		case r.Method == http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(store.Close)
+	return config.S3Config{Bucket: "replicas", Prefix: "rag/", Endpoint: store.URL, AccessKeyID: "key", SecretAccessKey: "secret"}, objects, &mu
+}
+
+func TestReplicatorShipsChangedSegmentsToS3(t *testing.T) {
+	saved := replicationSegmentBytes
+	replicationSegmentBytes = 16 << 10
+	t.Cleanup(func() { replicationSegmentBytes = saved })
+
+	db := newTestDB(t)
+	if err := db.CreateCollection("replicated", "", nil, nil); err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	var docs []*models.Document
+	for i := 0; i < 200; i++ {
+		docs = append(docs, testDocument(fmt.Sprintf("doc-%d", i), []string{strings.Repeat(fmt.Sprintf("text of document %d ", i), 20)}, 4))
+	}
+	if err := db.addDocuments(context.Background(), "replicated", docs, 4); err != nil {
+		t.Fatalf("addDocuments: %v", err)
+	}
+	bucket, objects, mu := newTestBucket(t)
+	replicator, err := NewReplicator(db, config.ReplicationConfig{Mode: ReplicationModeS3, S3: bucket})
+	if err != nil {
+		t.Fatalf("NewReplicator: %v", err)
+	}
+
+	if err := replicator.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	first := replicator.Status()
+	if first.LastShippedBytes < first.LastSnapshotBytes/2 {
+		t.Fatalf("first sync shipped %d bytes of a %d byte snapshot, want every distinct segment", first.LastShippedBytes, first.LastSnapshotBytes)
+	}
+
+	// A small write only ships the segments holding the pages it changed
+	if err := db.addDocuments(context.Background(), "replicated", []*models.Document{testDocument("late", []string{"a late addition"}, 4)}, 4); err != nil {
+		t.Fatalf("addDocuments: %v", err)
+	}
+	if err := replicator.Sync(); err != nil {
+		t.Fatalf("second Sync: %v", err)
+	}
+	second := replicator.Status()
+	if second.SnapshotsShipped != 2 || second.LastShippedBytes >= second.LastSnapshotBytes/2 {
+		t.Errorf("second sync shipped %d bytes of a %d byte snapshot (%d snapshots), want only the changed segments",
+			second.LastShippedBytes, second.LastSnapshotBytes, second.SnapshotsShipped)
+	}
+
+	// The pulled replica is the latest snapshot
+	standby := filepath.Join(t.TempDir(), "standby.db")
+	size, err := PullReplica(context.Background(), bucket, standby)
+	if err != nil {
+		t.Fatalf("PullReplica: %v", err)
+	}
+	if size != second.LastSnapshotBytes || checksumOf(t, standby) != second.LastChecksum {
+		t.Errorf("pulled %d bytes with checksum %s, want %d with %s", size, checksumOf(t, standby), second.LastSnapshotBytes, second.LastChecksum)
+	}
+	replica, err := NewVectorDB(standby)
+	if err != nil {
+		t.Fatalf("open the pulled replica: %v", err)
+	}
+	defer replica.Close()
+	if n := countRows(t, replica, "documents", "id = ?", "late"); n != 1 {
+		t.Errorf("the pulled replica has %d rows for the late document, want 1", n)
+	}
+
+	// Segments of neither of the last two manifests are deleted, and a damaged one is refused
+	mu.Lock()
+	var segments int
+	for key := range objects {
+		if strings.HasPrefix(key, "rag/segments/") {
+			segments++
+			objects[key] = []byte("damaged")
+		}
+	}
+	mu.Unlock()
+	if limit := int(2 * (second.LastSnapshotBytes/replicationSegmentBytes + 1)); segments > limit {
+		t.Errorf("%d segments stored, want at most %d", segments, limit)
+	}
+	if _, err := PullReplica(context.Background(), bucket, standby); err == nil {
+		t.Error("a replica with damaged segments was pulled")
+	}
+}
+
+func TestReceiveSnapshot(t *testing.T) {
+	standby := filepath.Join(t.TempDir(), "standby.db")
+	snapshot := []byte("a replicated database")
+	sum := sha256.Sum256(snapshot)
+	checksum := hex.EncodeToString(sum[:])
+
+	size, err := ReceiveSnapshot(standby, bytes.NewReader(snapshot), checksum, int64(len(snapshot)))
+	if err != nil {
+		t.Fatalf("ReceiveSnapshot: %v", err)
+	}
+	if size != int64(len(snapshot)) || checksumOf(t, standby) != checksum {
+		t.Fatalf("stored %d bytes with checksum %s, want %d with %s", size, checksumOf(t, standby), len(snapshot), checksum)
+	}
+
+	// Refused snapshots leave the stored one in place
+	refused := []struct {
+		name     string
+		body     string
+		checksum string
+		maxBytes int64
+		tooLarge bool
+	}{
+		{"checksum mismatch", "a tampered database!!", checksum, 0, false},
+		{"empty", "", "", 0, false},
+		{"over the limit", strings.Repeat("x", 100), "", 99, true},
+	}
+	for _, tt := range refused {
+		_, err := ReceiveSnapshot(standby, strings.NewReader(tt.body), tt.checksum, tt.maxBytes)
+		if err == nil {
+			t.Errorf("%s: snapshot was accepted", tt.name)
+		} else if errors.Is(err, ErrSnapshotTooLarge) != tt.tooLarge {
+			t.Errorf("%s: got %v, ErrSnapshotTooLarge is %v", tt.name, err, tt.tooLarge)
+		}
+		if checksumOf(t, standby) != checksum {
+			t.Fatalf("%s: the stored snapshot was replaced", tt.name)
+		}
+	}
+
+	// Bodies cut off by the server's size limit are reported the same way
+	body := http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(strings.NewReader(strings.Repeat("x", 100))), 10)
+	if _, err := ReceiveSnapshot(standby, body, "", 0); !errors.Is(err, ErrSnapshotTooLarge) {
+		t.Errorf("body over the request limit: got %v, want ErrSnapshotTooLarge", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(standby)); len(entries) != 1 {
+		t.Errorf("%d files next to the standby, want only the standby", len(entries))
+	}
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"math"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultSnippetsPerDocument = 2
+	groupCandidateRatio        = 3   // Grouped queries consider this many more chunks, so documents keep their siblings
+	maxSnippetChars            = 200 // Sibling snippets are cut at a word boundary before this many characters
+	siblingScoreDecay          = 0.5 // Each further chunk of a document adds this share less to its score
+)
+
+// snippetsPerDocument returns the sibling snippets requested per document
+func snippetsPerDocument(req *models.QueryRequest) int {
+	if req.SnippetsPerDocument > 0 {
+		return req.SnippetsPerDocument
+	}
+	return defaultSnippetsPerDocument
+}
+
+// groupByDocument collapses ranked chunks into at most limit documents. Each document is
+// represented by its best chunk, in the rank order of chunks, and the snippets of up to snippets
+// further chunks. Its score is the ranking score of its best chunk plus those of the others, each
+// decayed by siblingScoreDecay more than the one before, so several matches outrank a single one
+// of similar score; negative scores add nothing. Documents are ordered by that score; the
+// returned chunks and scores are their best chunks', aligned with the groups.
+func groupByDocument(chunks []*models.EnhancedChunk, scores, rerankedScores []float64, limit, snippets int) ([]*models.EnhancedChunk, []float64, []float64, []models.DocumentGroup) {
+	ranking := scores
+	if len(rerankedScores) == len(chunks) {
+		ranking = rerankedScores
+	}
+
+	type documentHits struct {
+		indices []int // Chunk positions, in rank order
+		score   float64
+	}
+	var order []string
+	hits := make(map[string]*documentHits)
+	for i, chunk := range chunks {
+		doc, ok := hits[chunk.DocumentID]
+		if !ok {
+			doc = &documentHits{}
+			hits[chunk.DocumentID] = doc
+			order = append(order, chunk.DocumentID)
+		}
+		doc.indices = append(doc.indices, i)
+	}
+
+	for _, doc := range hits {
+		docScores := make([]float64, len(doc.indices))
+		for j, i := range doc.indices {
+			docScores[j] = ranking[i]
+		}
+		sort.Sort(sort.Reverse(sort.Float64Slice(docScores)))
+		doc.score = docScores[0]
+		weight := siblingScoreDecay
+		for _, score := range docScores[1:] {
+			doc.score += weight * math.Max(score, 0)
+			weight *= siblingScoreDecay
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return hits[order[a]].score > hits[order[b]].score
+	})
+	if len(order) > limit {
+		order = order[:limit]
+	}
+
+	bestChunks := make([]*models.EnhancedChunk, len(order))
+	bestScores := make([]float64, len(order))
+	var bestReranked []float64
+	if len(rerankedScores) == len(chunks) {
+		bestReranked = make([]float64, len(order))
+	}
+	groups := make([]models.DocumentGroup, len(order))
+	for g, documentID := range order {
+		doc := hits[documentID]
+		best := doc.indices[0]
+		bestChunks[g] = chunks[best]
+		bestScores[g] = scores[best]
+		if bestReranked != nil {
+			bestReranked[g] = rerankedScores[best]
+		}
+
+		groups[g] = models.DocumentGroup{
+			DocumentID:    documentID,
+			ChunkID:       chunks[best].ID,
+			Score:         doc.score,
+			MatchedChunks: len(doc.indices),
+		}
+		for _, i := range doc.indices[1:] {
+			if len(groups[g].Snippets) == snippets {
+				break
+			}
+			groups[g].Snippets = append(groups[g].Snippets, models.ChunkSnippet{
+				ChunkID:    chunks[i].ID,
+				ChunkIndex: chunks[i].ChunkIndex,
+				Section:    chunks[i].Section,
+				Text:       snippetText(chunks[i].Text),
+				Score:      ranking[i],
+			})
+		}
+	}
+	return bestChunks, bestScores, bestReranked, groups
+}
+
+// snippetText shortens text to at most maxSnippetChars characters, cutting at a word boundary
+func snippetText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= maxSnippetChars {
+		return text
+	}
+	cut := maxSnippetChars
+	for cut > maxSnippetChars/2 && !unicode.IsSpace(runes[cut]) {
+		cut--
+	}
+	return strings.TrimSpace(string(runes[:cut])) + "…"
+}
@@ -0,0 +1,303 @@
+package core
+
+import (
+	"context"
+	"log"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+)
+
+// RetrievalResult is the outcome of the retrieval stage shared by /query and /search
+type RetrievalResult struct {
+	Chunks          []*models.EnhancedChunk
+	Scores          []float64 // Similarity scores, aligned with Chunks
+	RerankedScores  []float64 // Aligned with Chunks when re-ranking was applied
+	ExpandedQuery   string    // The query that was searched, after static expansion
+	ExpandedQueries []string  // Queries fused by LLM expansion, original first
+	GraphEntities   []string  // Entities reached by knowledge graph expansion
+	Collections     []string  // Collections searched by a federated query
+	RankFused       bool      // The collections' rankings were fused by rank, their scores not being comparable
+	Degradations    []string
+	BelowThreshold  bool                   // Chunks were found but none met the semantic threshold
+	Groups          []models.DocumentGroup // Aligned with Chunks when grouped by document
+
+	SuppressedDuplicates []models.SuppressedDuplicate // Near-duplicate chunks left out, when deduplicate_chunks was set
+}
+
+// Retrieve runs everything in a query except answer generation: query expansion, search with
+// fallback or fusion of several retrievers, semantic threshold filtering, graph expansion, parent
+// inclusion or substitution, re-ranking, MMR and TopK selection.
+func (r *RAGService) Retrieve(ctx context.Context, req *models.QueryRequest) (*RetrievalResult, error) {
+	ctx, span := startSpan(ctx, "RAGService.Retrieve")
+	result, err := r.retrieve(ctx, req)
+	if result != nil {
+		span.SetAttribute("rag.chunks", len(result.Chunks))
+		span.SetAttribute("rag.degradations", strings.Join(result.Degradations, ","))
+	}
+	span.End(err)
+	return result, err
+}
+
+// retrieve is Retrieve without its span
+func (r *RAGService) retrieve(ctx context.Context, req *models.QueryRequest) (*RetrievalResult, error) {
+	// Set defaults
+	if req.TopK <= 0 {
+		req.TopK = 5
+	}
+
+	result := &RetrievalResult{ExpandedQuery: req.Query}
+
+	// Query expansion: LLM paraphrases are retrieved for separately and fused,
+	// the static synonym map appends terms to a single query
+	query := req.Query
+	if req.QueryExpansion && req.ExpansionBackend == models.LLMExpansion {
+		variants, err := r.generateQueryVariants(ctx, req.Query, expansionQueryCount(req))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			log.Printf("LLM query expansion failed, using static expansion: %v", err)
+			result.Degradations = append(result.Degradations, DegradedStaticExpansion)
+		} else {
+			result.ExpandedQueries = append([]string{req.Query}, variants...)
+			log.Printf("Query expanded into %d paraphrases: %q", len(variants), variants)
+		}
+	}
+	if req.QueryExpansion && result.ExpandedQueries == nil {
+		expandedQuery := r.expandQuery(req.Query)
+		if expandedQuery != req.Query {
+			query = expandedQuery
+			result.ExpandedQuery = expandedQuery
+			log.Printf("Query expanded: '%s' -> '%s'", req.Query, query)
+		}
+	}
+
+	// Build metadata filters
+	filters := make(map[string]interface{})
+	if err := addMetadataFilters(filters, req); err != nil {
+		return nil, err
+	}
+	if req.Principal != nil {
+		filters[principalFilter] = req.Principal
+	}
+	if req.Abstraction == models.DetailLevel || req.Abstraction == models.SummaryLevels {
+		filters[abstractionFilter] = req.Abstraction
+	}
+	if err := addRangeFilters(filters, req); err != nil {
+		return nil, err
+	}
+	smallToBig := req.RetrievalGranularity == models.SmallToBigGranularity
+	if smallToBig {
+		filters[granularityFilter] = req.RetrievalGranularity
+	}
+
+	// Get more candidates for re-ranking, or the full MMR pool when diversifying
+	candidates := req.TopK * 2
+	if req.MMREnabled {
+		candidates = mmrCandidatePool(req)
+	}
+	if smallToBig {
+		candidates *= smallToBigCandidateRatio
+	}
+	// Grouping keeps top_k documents, so more chunks are selected before collapsing them
+	selected := req.TopK
+	if req.GroupByDocument {
+		candidates *= groupCandidateRatio
+		selected *= groupCandidateRatio
+	}
+
+	// Search for similar chunks (falls back to lexical search if embeddings are unavailable),
+	// or run the requested retrievers and fuse their rankings
+	var chunks []*models.EnhancedChunk
+	var scores []float64
+	var searchDegradations []string
+	searchCollection := func(ctx context.Context, collection, query string) ([]*models.EnhancedChunk, []float64, []string, error) {
+		return r.SearchWithFallback(ctx, collection, query, candidates, filters)
+	}
+	if len(req.Retrievers) > 0 {
+		searchCollection = func(ctx context.Context, collection, query string) ([]*models.EnhancedChunk, []float64, []string, error) {
+			return r.SearchComposite(ctx, collection, query, candidates, filters, req)
+		}
+	}
+	search := func(ctx context.Context, query string) ([]*models.EnhancedChunk, []float64, []string, error) {
+		return searchCollection(ctx, req.CollectionName, query)
+	}
+
+	// A federated query searches each of its collections concurrently
+	var err error
+	result.Collections, err = r.queryCollections(req)
+	if err != nil {
+		return nil, err
+	}
+	federated := result.Collections != nil
+	if federated {
+		search, err = r.federatedSearch(result.Collections, candidates, searchCollection, func() { result.RankFused = true })
+		if err != nil {
+			return nil, err
+		}
+	}
+	if result.ExpandedQueries != nil {
+		chunks, scores, searchDegradations, err = fuseQueries(ctx, result.ExpandedQueries, candidates, search)
+	} else {
+		chunks, scores, searchDegradations, err = search(ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Degradations = append(result.Degradations, searchDegradations...)
+
+	// Generated questions stand in for their chunks
+	chunks, scores, err = r.resolveQuestions(chunks, scores)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chunks) == 0 {
+		return result, nil
+	}
+
+	// Apply semantic threshold filtering
+	if req.SemanticThreshold > 0 {
+		filteredChunks := make([]*models.EnhancedChunk, 0)
+		filteredScores := make([]float64, 0)
+
+		for i, score := range scores {
+			if score >= req.SemanticThreshold {
+				filteredChunks = append(filteredChunks, chunks[i])
+				filteredScores = append(filteredScores, score)
+			}
+		}
+
+		chunks = filteredChunks
+		scores = filteredScores
+
+		if len(chunks) == 0 {
+			result.BelowThreshold = true
+			return result, nil
+		}
+	}
+
+	// Add chunks linked through the knowledge graph
+	if req.GraphRAG {
+		expand := r.expandAlongGraph
+		if federated {
+			expand = r.expandFederatedGraph
+		}
+		chunks, scores, result.GraphEntities, err = expand(req, chunks, scores, filters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Answer from the parents of the matched children, or include parents next to them if requested
+	if smallToBig {
+		chunks, scores, err = r.substituteParents(chunks, scores)
+		if err != nil {
+			return nil, err
+		}
+	} else if req.IncludeParents {
+		chunks, scores = r.includeParentChunks(chunks, scores)
+	}
+
+	// Let fresher documents rank higher, once all candidates are known
+	var recency map[string]float64
+	if req.RecencyHalfLifeDays > 0 {
+		recency, err = r.recencyFactors(chunks, req)
+		if err != nil {
+			return nil, err
+		}
+		chunks, scores, _ = boostRecency(chunks, recency, scores)
+	}
+
+	// Re-ranking
+	var rerankedScores []float64
+	if req.RerankerEnabled && len(chunks) > 1 {
+		rerankedChunks, newScores, rerankErr := r.safeRerank(query, chunks, scores)
+		if rerankErr != nil {
+			if !config.AppConfig.Degradation.SkipReranker {
+				return nil, rerankErr
+			}
+			log.Printf("Skipping re-ranking: %v", rerankErr)
+			result.Degradations = append(result.Degradations, DegradedRerankerSkipped)
+		} else {
+			scores = reorderScores(chunks, scores, rerankedChunks)
+			chunks, rerankedScores = rerankedChunks, newScores
+			if recency != nil {
+				var aligned [][]float64
+				chunks, rerankedScores, aligned = boostRecency(chunks, recency, rerankedScores, scores)
+				scores = aligned[0]
+			}
+		}
+	}
+
+	// Leave out chunks repeating higher-ranked ones, so they don't take the places of other information
+	if req.DeduplicateChunks && len(chunks) > 1 {
+		kept, suppressed := r.suppressDuplicates(req, chunks, scores)
+		chunks = pickChunks(chunks, kept)
+		scores = pickScores(scores, kept)
+		if len(rerankedScores) > 0 {
+			rerankedScores = pickScores(rerankedScores, kept)
+		}
+		result.SuppressedDuplicates = suppressed
+		if len(suppressed) > 0 {
+			log.Printf("Suppressed %d near-duplicate chunks", len(suppressed))
+		}
+	}
+
+	// Re-select TopK for diversity so near-duplicate chunks don't crowd out other information
+	if req.MMREnabled && len(chunks) > selected {
+		relevance := scores
+		if len(rerankedScores) == len(chunks) {
+			relevance = rerankedScores
+		}
+
+		picked := r.selectMMR(chunks, relevance, selected, req.MMRLambda)
+		chunks = pickChunks(chunks, picked)
+		scores = pickScores(scores, picked)
+		if len(rerankedScores) > 0 {
+			rerankedScores = pickScores(rerankedScores, picked)
+		}
+		log.Printf("MMR selected %d of %d candidate chunks", len(chunks), len(relevance))
+	}
+
+	// Limit to requested TopK after re-ranking, counting documents when grouping
+	if req.GroupByDocument {
+		chunks, scores, rerankedScores, result.Groups = groupByDocument(chunks, scores, rerankedScores, req.TopK, snippetsPerDocument(req))
+	} else if len(chunks) > req.TopK {
+		chunks = chunks[:req.TopK]
+		scores = scores[:req.TopK]
+		if len(rerankedScores) > req.TopK {
+			rerankedScores = rerankedScores[:req.TopK]
+		}
+	}
+
+	// Parents and other chunks added since the search carry no collection yet
+	if federated {
+		if err := r.tagCollections(chunks); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Chunks = chunks
+	result.Scores = scores
+	result.RerankedScores = rerankedScores
+	return result, nil
+}
+
+// reorderScores returns the similarity scores of chunks in the order of reordered, so they stay
+// aligned after re-ranking
+func reorderScores(chunks []*models.EnhancedChunk, scores []float64, reordered []*models.EnhancedChunk) []float64 {
+	byID := make(map[string]float64, len(chunks))
+	for i, chunk := range chunks {
+		if i < len(scores) {
+			byID[chunk.ID] = scores[i]
+		}
+	}
+
+	aligned := make([]float64, len(reordered))
+	for i, chunk := range reordered {
+		aligned[i] = byID[chunk.ID]
+	}
+	return aligned
+}
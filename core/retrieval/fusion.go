@@ -0,0 +1,107 @@
+package retrieval
+
+import (
+	"fmt"
+	"math"
+	"rag-go-app/models"
+	"sort"
+)
+
+// RRFConstant damps the weight of top ranks in reciprocal rank fusion
+const RRFConstant = 60
+
+// Fused is one chunk of a fused ranking
+type Fused struct {
+	Chunk     *models.EnhancedChunk
+	Score     float64 // Fused score, which orders the ranking
+	BestScore float64 // Best score the chunk got from any single ranking
+}
+
+// Fuse merges rankings with the given method; an empty method means reciprocal rank fusion
+func Fuse(method models.FusionMethod, rankings []Ranking) ([]Fused, error) {
+	switch method {
+	case "", models.RRFFusion:
+		return ReciprocalRankFusion(rankings), nil
+	case models.WeightedFusion:
+		return WeightedSum(rankings), nil
+	default:
+		return nil, fmt.Errorf("unknown fusion method %q (expected %q or %q)", method, models.RRFFusion, models.WeightedFusion)
+	}
+}
+
+// ReciprocalRankFusion scores each chunk by the sum of weight/(k+rank) over the rankings that
+// contain it. Only positions count, so rankings whose scores are on different scales combine well.
+func ReciprocalRankFusion(rankings []Ranking) []Fused {
+	return fuse(rankings, func(ranking Ranking) []float64 {
+		contributions := make([]float64, len(ranking.Hits))
+		for rank := range ranking.Hits {
+			contributions[rank] = ranking.Weight / float64(RRFConstant+rank+1)
+		}
+		return contributions
+	})
+}
+
+// WeightedSum scores each chunk by the weighted sum of its scores, each ranking min-max normalized
+// to [0, 1] first. A chunk missing from a ranking gets nothing from it.
+func WeightedSum(rankings []Ranking) []Fused {
+	return fuse(rankings, func(ranking Ranking) []float64 {
+		low, high := math.Inf(1), math.Inf(-1)
+		for _, hit := range ranking.Hits {
+			low = math.Min(low, hit.Score)
+			high = math.Max(high, hit.Score)
+		}
+
+		contributions := make([]float64, len(ranking.Hits))
+		for i, hit := range ranking.Hits {
+			normalized := 1.0
+			if high > low {
+				normalized = (hit.Score - low) / (high - low)
+			}
+			contributions[i] = ranking.Weight * normalized
+		}
+		return contributions
+	})
+}
+
+// fuse sums the contribution of every hit to its chunk and orders the chunks by the sum, breaking
+// ties by best score and then by first appearance. Each chunk's contributions are added largest
+// first, so chunks with the same contributions from different rankings tie exactly instead of
+// differing in the last bit with the order they were added in.
+func fuse(rankings []Ranking, contribute func(Ranking) []float64) []Fused {
+	var fused []*Fused
+	byID := make(map[string]*Fused)
+	contributions := make(map[*Fused][]float64)
+
+	for _, ranking := range rankings {
+		scores := contribute(ranking)
+		for i, hit := range ranking.Hits {
+			entry, ok := byID[hit.Chunk.ID]
+			if !ok {
+				entry = &Fused{Chunk: hit.Chunk, BestScore: hit.Score}
+				byID[hit.Chunk.ID] = entry
+				fused = append(fused, entry)
+			}
+			contributions[entry] = append(contributions[entry], scores[i])
+			entry.BestScore = math.Max(entry.BestScore, hit.Score)
+		}
+	}
+	for entry, scores := range contributions {
+		sort.Sort(sort.Reverse(sort.Float64Slice(scores)))
+		for _, score := range scores {
+			entry.Score += score
+		}
+	}
+
+	sort.SliceStable(fused, func(i, j int) bool {
+		if fused[i].Score != fused[j].Score {
+			return fused[i].Score > fused[j].Score
+		}
+		return fused[i].BestScore > fused[j].BestScore
+	})
+
+	result := make([]Fused, len(fused))
+	for i, entry := range fused {
+		result[i] = *entry
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package retrieval
+
+import (
+	"rag-go-app/models"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ranking builds a ranking of weight 1 from "id:score" hits, best first
+func ranking(name string, hits ...string) Ranking {
+	r := Ranking{Retriever: name, Weight: 1}
+	for _, hit := range hits {
+		id, score, _ := strings.Cut(hit, ":")
+		value, _ := strconv.ParseFloat(score, 64)
+		r.Hits = append(r.Hits, Hit{Chunk: &models.EnhancedChunk{ID: id}, Score: value})
+	}
+	return r
+}
+
+// weighted sets the weight of a ranking
+func weighted(r Ranking, weight float64) Ranking {
+	r.Weight = weight
+	return r
+}
+
+func TestFuseOrdersTies(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   models.FusionMethod
+		rankings []Ranking
+		want     string // Chunk IDs in fused order
+	}{
+		{"empty", models.RRFFusion, nil, ""},
+		{"one ranking keeps its order", models.RRFFusion, []Ranking{ranking("vector", "a:1", "b:1", "c:1")}, "a b c"},
+		{"found by both ranks first", models.RRFFusion, []Ranking{ranking("vector", "a:9", "b:8"), ranking("keyword", "c:9", "b:1")}, "b a c"},
+		{"swapped ranks tie, best score breaks it", models.RRFFusion,
+			[]Ranking{ranking("vector", "a:5", "b:4"), ranking("keyword", "b:9", "a:1")}, "b a"},
+		{"swapped ranks and best scores tie, first appearance breaks it", models.RRFFusion,
+			[]Ranking{ranking("vector", "a:5", "b:4"), ranking("keyword", "b:5", "a:1")}, "a b"},
+		// 1/61 + 1/62 + 1/68 differs in the last bit from 1/62 + 1/68 + 1/61
+		{"ranks tie regardless of the order they are added in", models.RRFFusion,
+			[]Ranking{
+				ranking("vector", "a:5", "b:4"),
+				ranking("keyword", "x:9", "a:8", "y:7", "z:6", "u:5", "v:4", "w:3", "b:2"),
+				ranking("metadata", "b:9", "x:8", "y:7", "z:6", "u:5", "v:4", "w:3", "a:2"),
+			}, "b a x y z u v w"},
+		{"equal scores normalize alike", models.WeightedFusion, []Ranking{ranking("vector", "a:3", "b:3", "c:3")}, "a b c"},
+		{"normalized scores tie, best score breaks it", models.WeightedFusion,
+			[]Ranking{ranking("vector", "a:4", "b:2"), ranking("keyword", "b:8", "a:6")}, "b a"},
+		{"weights decide", models.WeightedFusion,
+			[]Ranking{weighted(ranking("vector", "a:4", "b:2"), 2), ranking("keyword", "b:8", "a:6")}, "a b"},
+		{"default method is RRF", "", []Ranking{ranking("vector", "a:5", "b:4"), ranking("keyword", "b:9", "a:1")}, "b a"},
+	}
+	for _, tt := range tests {
+		fused, err := Fuse(tt.method, tt.rankings)
+		if err != nil {
+			t.Errorf("%s: Fuse() error: %v", tt.name, err)
+			continue
+		}
+		ids := make([]string, len(fused))
+		for i, f := range fused {
+			ids[i] = f.Chunk.ID
+		}
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("%s: fused order %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFuseScores(t *testing.T) {
+	fused := ReciprocalRankFusion([]Ranking{weighted(ranking("vector", "a:7", "b:3"), 2), ranking("keyword", "b:5")})
+	want := map[string][2]float64{
+		"a": {2.0 / (RRFConstant + 1), 7},
+		"b": {2.0/(RRFConstant+2) + 1.0/(RRFConstant+1), 5},
+	}
+	for _, f := range fused {
+		if w := want[f.Chunk.ID]; f.Score != w[0] || f.BestScore != w[1] {
+			t.Errorf("%s: score %v and best score %v, want %v and %v", f.Chunk.ID, f.Score, f.BestScore, w[0], w[1])
+		}
+	}
+
+	if _, err := Fuse("borda", nil); err == nil {
+		t.Error("Fuse() accepted an unknown method")
+	}
+}
@@ -0,0 +1,104 @@
+// Package retrieval composes retrievers that each rank the chunks of a collection for a query,
+// and fuses their rankings into one.
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"rag-go-app/models"
+	"sync"
+)
+
+// Query is what every retriever is asked for
+type Query struct {
+	Collection string
+	Text       string
+	TopK       int
+	Filters    map[string]interface{}
+}
+
+// Hit is one chunk found by a retriever
+type Hit struct {
+	Chunk *models.EnhancedChunk
+	Score float64 // The retriever's own score; scales differ between retrievers
+}
+
+// Retriever ranks the chunks of a collection for a query
+type Retriever interface {
+	// Name identifies the retriever in rankings, weights and errors
+	Name() string
+	// Retrieve returns up to q.TopK hits, best first
+	Retrieve(ctx context.Context, q Query) ([]Hit, error)
+}
+
+// Ranking is the output of one retriever
+type Ranking struct {
+	Retriever string
+	Hits      []Hit
+	Weight    float64 // Scales the ranking in weighted fusion
+}
+
+// NewRanking pairs chunks with their aligned scores into a ranking of weight 1
+func NewRanking(retriever string, chunks []*models.EnhancedChunk, scores []float64) Ranking {
+	return Ranking{Retriever: retriever, Hits: toHits(chunks, scores), Weight: 1}
+}
+
+// RunConcurrently runs every retriever on q at the same time. Rankings are returned in the order
+// of retrievers, leaving out the ones that failed; their errors are keyed by retriever name.
+func RunConcurrently(ctx context.Context, retrievers []Retriever, q Query) ([]Ranking, map[string]error) {
+	hits := make([][]Hit, len(retrievers))
+	errs := make([]error, len(retrievers))
+
+	var wg sync.WaitGroup
+	for i, retriever := range retrievers {
+		wg.Add(1)
+		go func(i int, retriever Retriever) {
+			defer wg.Done()
+			hits[i], errs[i] = retriever.Retrieve(ctx, q)
+		}(i, retriever)
+	}
+	wg.Wait()
+
+	var rankings []Ranking
+	failed := make(map[string]error)
+	for i, retriever := range retrievers {
+		if errs[i] != nil {
+			failed[retriever.Name()] = errs[i]
+			continue
+		}
+		rankings = append(rankings, Ranking{Retriever: retriever.Name(), Hits: hits[i], Weight: 1})
+	}
+	return rankings, failed
+}
+
+// Composite runs several retrievers concurrently and fuses their rankings
+type Composite struct {
+	Retrievers []Retriever
+	Method     models.FusionMethod
+	Weights    map[string]float64 // Weight per retriever name for weighted fusion; missing ones weigh 1
+}
+
+// Retrieve returns the fused ranking of all retrievers, cut to q.TopK. It fails if any retriever does.
+func (c *Composite) Retrieve(ctx context.Context, q Query) ([]Fused, error) {
+	rankings, failed := RunConcurrently(ctx, c.Retrievers, q)
+	for _, retriever := range c.Retrievers {
+		if err, ok := failed[retriever.Name()]; ok {
+			return nil, fmt.Errorf("%s retriever failed: %w", retriever.Name(), err)
+		}
+	}
+
+	for i := range rankings {
+		if weight, ok := c.Weights[rankings[i].Retriever]; ok {
+			rankings[i].Weight = weight
+		}
+	}
+
+	fused, err := Fuse(c.Method, rankings)
+	if err != nil {
+		return nil, err
+	}
+	if q.TopK > 0 && len(fused) > q.TopK {
+		fused = fused[:q.TopK]
+	}
+	return fused, nil
+}
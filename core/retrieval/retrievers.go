@@ -0,0 +1,133 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"rag-go-app/models"
+)
+
+// Names of the built-in retrievers
+const (
+	VectorName   = string(models.VectorRetriever)
+	KeywordName  = string(models.KeywordRetriever)
+	MetadataName = string(models.MetadataRetriever)
+)
+
+// Embedder turns a query into an embedding
+type Embedder interface {
+	GetEmbedding(ctx context.Context, text string) ([]float32, error)
+}
+
+// VectorSearcher finds the chunks nearest to an embedding
+type VectorSearcher interface {
+	QuerySimilarChunks(ctx context.Context, collectionName string, queryEmbedding []float32, topK int, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, error)
+}
+
+// KeywordSearcher finds the chunks whose text matches the terms of a query
+type KeywordSearcher interface {
+	KeywordSearchChunks(ctx context.Context, collectionName string, query string, topK int, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, error)
+}
+
+// MetadataSearcher finds the chunks whose section, type, keywords or metadata match the terms of a query
+type MetadataSearcher interface {
+	MetadataSearchChunks(ctx context.Context, collectionName string, query string, topK int, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, error)
+}
+
+// vectorRetriever ranks chunks by embedding similarity to the query
+type vectorRetriever struct {
+	embedder Embedder
+	searcher VectorSearcher
+}
+
+// NewVectorRetriever returns a retriever that embeds the query and runs a similarity search
+func NewVectorRetriever(embedder Embedder, searcher VectorSearcher) Retriever {
+	return &vectorRetriever{embedder: embedder, searcher: searcher}
+}
+
+func (v *vectorRetriever) Name() string { return VectorName }
+
+func (v *vectorRetriever) Retrieve(ctx context.Context, q Query) ([]Hit, error) {
+	embedding, err := v.embedder.GetEmbedding(ctx, q.Text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+	chunks, scores, err := v.searcher.QuerySimilarChunks(ctx, q.Collection, embedding, q.TopK, q.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search similar chunks: %w", err)
+	}
+	return toHits(chunks, scores), nil
+}
+
+// keywordRetriever ranks chunks by the query terms their text contains
+type keywordRetriever struct {
+	searcher KeywordSearcher
+}
+
+// NewKeywordRetriever returns a retriever backed by the full-text index
+func NewKeywordRetriever(searcher KeywordSearcher) Retriever {
+	return &keywordRetriever{searcher: searcher}
+}
+
+func (k *keywordRetriever) Name() string { return KeywordName }
+
+func (k *keywordRetriever) Retrieve(ctx context.Context, q Query) ([]Hit, error) {
+	chunks, scores, err := k.searcher.KeywordSearchChunks(ctx, q.Collection, q.Text, q.TopK, q.Filters)
+	if err != nil {
+		return nil, err
+	}
+	return toHits(chunks, scores), nil
+}
+
+// metadataRetriever ranks chunks by the query terms their structure and metadata contain
+type metadataRetriever struct {
+	searcher MetadataSearcher
+}
+
+// NewMetadataRetriever returns a retriever that matches the query against chunk metadata
+func NewMetadataRetriever(searcher MetadataSearcher) Retriever {
+	return &metadataRetriever{searcher: searcher}
+}
+
+func (m *metadataRetriever) Name() string { return MetadataName }
+
+func (m *metadataRetriever) Retrieve(ctx context.Context, q Query) ([]Hit, error) {
+	chunks, scores, err := m.searcher.MetadataSearchChunks(ctx, q.Collection, q.Text, q.TopK, q.Filters)
+	if err != nil {
+		return nil, err
+	}
+	return toHits(chunks, scores), nil
+}
+
+// Fallback is a retriever that answers with a second retriever when the first one fails
+type Fallback struct {
+	Primary   Retriever
+	Secondary Retriever
+	// OnFallback, if set, is called with the primary's error before the secondary runs
+	OnFallback func(err error)
+}
+
+// Name is the primary's name, so weights keep applying while the secondary stands in
+func (f *Fallback) Name() string { return f.Primary.Name() }
+
+func (f *Fallback) Retrieve(ctx context.Context, q Query) ([]Hit, error) {
+	hits, err := f.Primary.Retrieve(ctx, q)
+	if err == nil || ctx.Err() != nil {
+		return hits, err
+	}
+	if f.OnFallback != nil {
+		f.OnFallback(err)
+	}
+	return f.Secondary.Retrieve(ctx, q)
+}
+
+// toHits pairs chunks with their aligned scores
+func toHits(chunks []*models.EnhancedChunk, scores []float64) []Hit {
+	hits := make([]Hit, len(chunks))
+	for i, chunk := range chunks {
+		hits[i].Chunk = chunk
+		if i < len(scores) {
+			hits[i].Score = scores[i]
+		}
+	}
+	return hits
+}
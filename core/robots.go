@@ -0,0 +1,150 @@
+package core
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRule allows or disallows the paths matching a robots.txt pattern
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// robotsRules are the robots.txt rules that apply to the crawler on one host
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	disallowed bool // robots.txt could not be read because of a server error, so nothing may be fetched
+}
+
+// robotsGroup is a group of rules for the user agents listed before them
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// parseRobots reads the rules of the robots.txt group that best matches userAgent, following
+// RFC 9309: the group naming the longest product token contained in the user agent applies, else
+// the "*" group, else none and everything is allowed. Groups naming the same agent are merged.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	var groups []*robotsGroup
+	var current *robotsGroup
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			if !inAgents {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+				inAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			// An empty Disallow allows everything, the same as no rule
+			if current != nil && value != "" {
+				current.rules = append(current.rules, robotsRule{pattern: value, allow: field == "allow"})
+			}
+		case "crawl-delay":
+			inAgents = false
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 && current != nil {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	agent := strings.ToLower(userAgent)
+	if product, _, found := strings.Cut(agent, "/"); found {
+		agent = product
+	}
+	best := -1
+	rules := &robotsRules{}
+	for _, group := range groups {
+		for _, name := range group.agents {
+			length := -1
+			switch {
+			case name == "*":
+				length = 0
+			case name != "" && strings.Contains(agent, name):
+				length = len(name)
+			}
+			if length < 0 || length < best {
+				continue
+			}
+			if length > best {
+				best = length
+				rules = &robotsRules{}
+			}
+			rules.rules = append(rules.rules, group.rules...)
+			if group.crawlDelay > rules.crawlDelay {
+				rules.crawlDelay = group.crawlDelay
+			}
+			break
+		}
+	}
+	return rules
+}
+
+// Allowed reports whether the path, with its query, may be fetched. The rule with the longest
+// matching pattern decides; on a tie between Allow and Disallow, Allow wins.
+func (r *robotsRules) Allowed(path string) bool {
+	if r.disallowed {
+		return false
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// robotsMatch reports whether a robots.txt pattern matches the start of path. "*" matches any
+// characters and a trailing "$" anchors the pattern to the end of the path.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(rest, part)
+		}
+		index := strings.Index(rest, part)
+		if index < 0 {
+			return false
+		}
+		rest = rest[index+len(part):]
+	}
+	return !anchored || rest == ""
+}
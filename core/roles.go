@@ -0,0 +1,123 @@
+package core
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Roles of API callers, each allowed everything the previous one is: readers query and search,
+// writers also ingest and change documents, and admins also delete collections and use the
+// /admin routes
+const (
+	RoleReader = "reader"
+	RoleWriter = "writer"
+	RoleAdmin  = "admin"
+)
+
+// Kinds of identities roles are assigned to
+const (
+	RoleSubjectAPIKey = "api_key" // An API key, stored as its SHA-256 hash
+	RoleSubjectUser   = "user"    // The user claim of a JWT, sub by default
+	RoleSubjectClaim  = "claim"   // A value of the JWT role or groups claim
+)
+
+// RoleRank orders roles by what they allow; unknown roles rank 0 and allow nothing
+func RoleRank(role string) int {
+	switch role {
+	case RoleReader:
+		return 1
+	case RoleWriter:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// ValidRoleSubjectKind reports whether roles can be assigned to identities of the kind
+func ValidRoleSubjectKind(kind string) bool {
+	return kind == RoleSubjectAPIKey || kind == RoleSubjectUser || kind == RoleSubjectClaim
+}
+
+// APIKeySubject is how an API key is stored in role assignments, so the database does not hold
+// usable keys
+func APIKeySubject(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// RoleAssignment grants a role to an API key, a JWT user or a JWT claim value
+type RoleAssignment struct {
+	Kind      string    `json:"kind"`    // "api_key", "user" or "claim"
+	Subject   string    `json:"subject"` // API keys are listed as "sha256:<hash>"
+	Role      string    `json:"role"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AssignRole grants a role to an identity, replacing the role it had
+func (db *VectorDB) AssignRole(kind, subject, role string) error {
+	if !ValidRoleSubjectKind(kind) {
+		return fmt.Errorf("unknown identity kind '%s'", kind)
+	}
+	if RoleRank(role) == 0 {
+		return fmt.Errorf("unknown role '%s' (use reader, writer or admin)", role)
+	}
+	_, err := db.conn.Exec(`INSERT INTO role_assignments (kind, subject, role, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (kind, subject) DO UPDATE SET role = excluded.role, updated_at = excluded.updated_at`, kind, subject, role)
+	if err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+	return nil
+}
+
+// RevokeRole removes the role assigned to an identity, reporting whether it had one
+func (db *VectorDB) RevokeRole(kind, subject string) (bool, error) {
+	result, err := db.conn.Exec(`DELETE FROM role_assignments WHERE kind = ? AND subject = ?`, kind, subject)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke role: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// AssignedRole returns the highest role assigned to any of the subjects of a kind, or "" when
+// none has one
+func (db *VectorDB) AssignedRole(kind string, subjects ...string) (string, error) {
+	best := ""
+	for _, subject := range subjects {
+		var role string
+		err := db.conn.QueryRow(`SELECT role FROM role_assignments WHERE kind = ? AND subject = ?`, kind, subject).Scan(&role)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read role assignment: %w", err)
+		}
+		if RoleRank(role) > RoleRank(best) {
+			best = role
+		}
+	}
+	return best, nil
+}
+
+// RoleAssignments lists every stored role assignment
+func (db *VectorDB) RoleAssignments() ([]RoleAssignment, error) {
+	rows, err := db.conn.Query(`SELECT kind, subject, role, updated_at FROM role_assignments ORDER BY kind, subject`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role assignments: %w", err)
+	}
+	defer rows.Close()
+
+	assignments := []RoleAssignment{}
+	for rows.Next() {
+		var assignment RoleAssignment
+		if err := rows.Scan(&assignment.Kind, &assignment.Subject, &assignment.Role, &assignment.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan role assignment: %w", err)
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, rows.Err()
+}
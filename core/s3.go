@@ -0,0 +1,302 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"rag-go-app/config"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash is the sha256 of an empty body, signed for requests without one
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3HTTPClient has no overall timeout: transferring a large database or document can take longer
+// than any fixed bound, and the caller's context ends stalled transfers instead
+var s3HTTPClient = &http.Client{}
+
+// S3Error reports a request that an S3-compatible store rejected, or that failed to reach it or
+// to read its answer
+type S3Error struct {
+	Action string // "upload", "download" or "listing"
+	Name   string // The object or prefix
+	Status string // The status the store answered with; empty when there was no usable answer
+	Err    error
+}
+
+func (e *S3Error) Error() string {
+	if e.Status != "" {
+		return fmt.Sprintf("s3 %s of %s failed with status %s: %v", e.Action, e.Name, e.Status, e.Err)
+	}
+	return fmt.Sprintf("s3 %s of %s failed: %v", e.Action, e.Name, e.Err)
+}
+
+func (e *S3Error) Unwrap() error {
+	return e.Err
+}
+
+// s3Client stores objects in one bucket of S3 or an S3-compatible store, signing each request
+// with AWS Signature Version 4. Objects are addressed path-style, which every compatible store supports.
+type s3Client struct {
+	cfg      config.S3Config
+	endpoint string
+	http     *http.Client
+}
+
+// newS3Client returns a client for the configured bucket, or nil when no bucket is set
+func newS3Client(cfg config.S3Config) (*s3Client, error) {
+	if cfg.Bucket == "" {
+		return nil, nil
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3 bucket %q requires access_key_id and secret_access_key", cfg.Bucket)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	endpoint := strings.TrimRight(cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	return &s3Client{cfg: cfg, endpoint: endpoint, http: s3HTTPClient}, nil
+}
+
+// objectURL returns the URL of an object
+func (s *s3Client) objectURL(key string) string {
+	return s.endpoint + "/" + s3PathEscape(s.cfg.Bucket+"/"+key)
+}
+
+// prefixed returns the key of a file stored under the configured prefix
+func (s *s3Client) prefixed(name string) string {
+	return s.cfg.Prefix + name
+}
+
+// Put uploads size bytes from body, whose sha256 is payloadHash, as the object key
+func (s *s3Client) Put(key string, body io.Reader, size int64, payloadHash string) error {
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key), body)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	s.sign(req, payloadHash, time.Now())
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return &S3Error{Action: "upload", Name: key, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("upload", key, resp)
+	}
+	return nil
+}
+
+// Get downloads the object key into w and returns its content type. A missing object reports "not found".
+func (s *s3Client) Get(ctx context.Context, key string, w io.Writer) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create download request: %w", err)
+	}
+	s.sign(req, emptyPayloadHash, time.Now())
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return "", &S3Error{Action: "download", Name: key, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("object '%s' not found in s3 bucket %s", key, s.cfg.Bucket)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", s3Error("download", key, resp)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return "", &S3Error{Action: "download", Name: key, Err: err}
+	}
+	return resp.Header.Get("Content-Type"), nil
+}
+
+// Delete removes the object key. Deleting an object that does not exist succeeds.
+func (s *s3Client) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
+	s.sign(req, emptyPayloadHash, time.Now())
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return &S3Error{Action: "delete", Name: key, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return s3Error("delete", key, resp)
+	}
+	return nil
+}
+
+// s3Object is an object listed in a bucket
+type s3Object struct {
+	Key  string `xml:"Key"`
+	ETag string `xml:"ETag"`
+	Size int64  `xml:"Size"`
+}
+
+// listBucketResult is the response to a ListObjectsV2 request
+type listBucketResult struct {
+	Contents              []s3Object `xml:"Contents"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+}
+
+// List returns every object whose key starts with prefix, following continuation tokens.
+// ETags are returned without their quotes.
+func (s *s3Client) List(ctx context.Context, prefix string) ([]s3Object, error) {
+	var objects []s3Object
+	name := "s3://" + s.cfg.Bucket + "/" + prefix
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		// The query is encoded as it is signed, so S3 sees the same canonical form
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+"/"+s3PathEscape(s.cfg.Bucket)+"?"+canonicalQuery(query), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create list request: %w", err)
+		}
+		s.sign(req, emptyPayloadHash, time.Now())
+
+		resp, err := s.http.Do(req)
+		if err != nil {
+			return nil, &S3Error{Action: "listing", Name: name, Err: err}
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error("listing", name, resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, &S3Error{Action: "listing", Name: name, Err: fmt.Errorf("unreadable response: %w", err)}
+		}
+
+		for _, object := range page.Contents {
+			object.ETag = strings.Trim(object.ETag, `"`)
+			objects = append(objects, object)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// s3Error describes a rejected request with the start of the error document S3 returned
+func s3Error(action, name string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &S3Error{Action: action, Name: name, Status: resp.Status, Err: errors.New(strings.TrimSpace(string(body)))}
+}
+
+// sign adds the AWS Signature Version 4 headers to req. Every header already set on req is
+// signed along with the host.
+func (s *s3Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), date)
+	for _, part := range []string{s.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery sorts and encodes query parameters as Signature Version 4 expects
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3PathEscape encodes an object path, keeping its slashes
+func s3PathEscape(path string) string {
+	return s3Escape(path, true)
+}
+
+// s3Escape percent-encodes everything but the unreserved characters of RFC 3986, and slashes
+// when keepSlash is set
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,328 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"rag-go-app/config"
+	"rag-go-app/core/parsers"
+	"rag-go-app/models"
+	"strings"
+	"time"
+)
+
+// SyncSkipped is the status of an object whose content type can't be ingested
+const SyncSkipped = "skipped"
+
+// errUnsupportedContentType is returned for objects that are neither text nor a format with a reader
+var errUnsupportedContentType = errors.New("unsupported content type")
+
+// ErrInvalidS3Source is returned for sync requests whose endpoint can't be used
+var ErrInvalidS3Source = errors.New("invalid s3 source")
+
+// publicS3HTTPClient is s3HTTPClient for endpoints that writers chose, connecting only to public addresses
+var publicS3HTTPClient = &http.Client{Transport: newPublicTransport()}
+
+// contentTypeExtensions maps the content types of formats read by more than a text decoder to
+// the file extension that selects their reader
+var contentTypeExtensions = map[string]string{
+	"application/pdf": ".pdf",
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": ".docx",
+	"application/vnd.oasis.opendocument.text":                                 ".odt",
+	"text/html":            ".html",
+	"text/markdown":        ".md",
+	"text/x-markdown":      ".md",
+	"text/vtt":             ".vtt",
+	"application/x-subrip": ".srt",
+	"audio/mpeg":           ".mp3",
+	"audio/mp4":            ".m4a",
+	"audio/wav":            ".wav",
+	"audio/x-wav":          ".wav",
+	"audio/ogg":            ".ogg",
+	"audio/flac":           ".flac",
+	"audio/webm":           ".webm",
+	"application/json":     ".json",
+}
+
+// hasReader reports whether files with the extension are read by more than a text decoder
+func hasReader(ext string) bool {
+	path := "object" + ext
+	return needsOCR(path) || isAudioFile(path) || parsers.Supports(path) ||
+		markdownExtensionPattern.MatchString(path) || ext == ".srt" || ext == ".vtt"
+}
+
+// objectExtension picks the extension a downloaded object is saved under, which decides how it
+// is read: the key's own extension when it has a reader, else the one of the content type S3
+// reports, else the one of the type sniffed from the first bytes. Other text is read as text;
+// other binary content is not supported.
+func objectExtension(key, contentType string, head []byte) (string, error) {
+	ext := strings.ToLower(filepath.Ext(key))
+	if hasReader(ext) {
+		return ext, nil
+	}
+
+	reported, _, _ := mime.ParseMediaType(contentType)
+	if mapped, ok := contentTypeExtensions[reported]; ok {
+		return mapped, nil
+	}
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if mapped, ok := contentTypeExtensions[sniffed]; ok {
+		return mapped, nil
+	}
+
+	if strings.HasPrefix(reported, "text/") || strings.HasPrefix(sniffed, "text/") {
+		if ext == "" {
+			ext = ".txt"
+		}
+		return ext, nil
+	}
+	if reported == "" || reported == "application/octet-stream" || reported == "binary/octet-stream" {
+		reported = sniffed
+	}
+	return "", fmt.Errorf("%w %s", errUnsupportedContentType, reported)
+}
+
+// s3ObjectVersion is the ETag of an object when the document was ingested from it
+type s3ObjectVersion struct {
+	etag       string
+	documentID string
+}
+
+// s3ObjectVersions returns the recorded version of every object ingested into a collection, by source
+func (db *VectorDB) s3ObjectVersions(collectionName string) (map[string]s3ObjectVersion, error) {
+	rows, err := db.conn.Query(`SELECT source, etag, document_id FROM s3_objects
+		WHERE collection_name = ? AND tenant_id = ?`, collectionName, db.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3 object versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[string]s3ObjectVersion)
+	for rows.Next() {
+		var source string
+		var version s3ObjectVersion
+		if err := rows.Scan(&source, &version.etag, &version.documentID); err != nil {
+			return nil, fmt.Errorf("failed to scan s3 object version: %w", err)
+		}
+		versions[source] = version
+	}
+	return versions, rows.Err()
+}
+
+// setS3ObjectVersion records the ETag of the object a document was ingested from
+func (db *VectorDB) setS3ObjectVersion(collectionName, source, etag, documentID string) error {
+	_, err := db.conn.Exec(`INSERT OR REPLACE INTO s3_objects (tenant_id, collection_name, source, etag, document_id)
+		VALUES (?, ?, ?, ?, ?)`, db.tenant, collectionName, source, etag, documentID)
+	if err != nil {
+		return fmt.Errorf("failed to record s3 object version: %w", err)
+	}
+	return nil
+}
+
+// deleteS3ObjectVersion forgets an object that is no longer in the bucket
+func (db *VectorDB) deleteS3ObjectVersion(collectionName, source string) error {
+	_, err := db.conn.Exec(`DELETE FROM s3_objects WHERE tenant_id = ? AND collection_name = ? AND source = ?`,
+		db.tenant, collectionName, source)
+	if err != nil {
+		return fmt.Errorf("failed to delete s3 object version: %w", err)
+	}
+	return nil
+}
+
+// SyncS3Source reconciles a collection with the objects under a bucket prefix. Documents are
+// keyed by their s3://bucket/key source. An object whose ETag matches the one recorded when its
+// document was ingested is skipped without downloading; the others are downloaded and ingested
+// like files. A failing object is reported in its result and does not stop the others; a
+// cancelled or timed out ctx stops the sync.
+func (r *RAGService) SyncS3Source(ctx context.Context, collectionName string, req *models.S3SourceRequest) ([]SyncResult, error) {
+	startTime := time.Now()
+
+	client, err := s3SourceClient(req)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := r.vectorDB.ListDocumentHashes(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]string, len(stored))
+	for _, doc := range stored {
+		latest[doc.Source] = doc.ID // Later documents win when a source was stored twice
+	}
+	versions, err := r.vectorDB.s3ObjectVersions(collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := client.List(ctx, req.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "rag-s3-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sourcePrefix := "s3://" + req.Bucket + "/"
+	results := make([]SyncResult, 0, len(objects))
+	inBucket := make(map[string]bool, len(objects))
+	for i, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// Keys ending in a slash are folder placeholders
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		source := sourcePrefix + object.Key
+		inBucket[source] = true
+		result := SyncResult{Source: source}
+
+		version, recorded := versions[source]
+		if recorded && version.etag == object.ETag && latest[source] == version.documentID {
+			result.Status = IngestUnchanged
+			result.DocumentID = version.documentID
+			results = append(results, result)
+			continue
+		}
+
+		ingested, err := r.ingestS3Object(ctx, client, filepath.Join(tmpDir, fmt.Sprintf("object-%d", i)), collectionName, source, object.Key, req)
+		switch {
+		case errors.Is(err, errUnsupportedContentType):
+			result.Status = SyncSkipped
+			result.Error = err.Error()
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			result.Status = SyncFailed
+			result.Error = err.Error()
+		default:
+			result.IngestResult = *ingested
+			if err := r.vectorDB.setS3ObjectVersion(collectionName, source, object.ETag, ingested.DocumentID); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, result)
+	}
+
+	if req.DeleteMissing {
+		for _, doc := range stored {
+			if !strings.HasPrefix(doc.Source, sourcePrefix+req.Prefix) || inBucket[doc.Source] {
+				continue
+			}
+			result := SyncResult{Source: doc.Source, IngestResult: IngestResult{Status: SyncDeleted, DocumentID: doc.ID}}
+			if err := r.vectorDB.DeleteDocument(doc.ID); err != nil {
+				result.Status = SyncFailed
+				result.Error = err.Error()
+			} else if err := r.vectorDB.deleteS3ObjectVersion(collectionName, doc.Source); err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+	}
+
+	log.Printf("Synced collection '%s' with %d objects of %s%s in %v",
+		collectionName, len(objects), sourcePrefix, req.Prefix, time.Since(startTime))
+
+	return results, nil
+}
+
+// s3SourceClient returns a client for the bucket of a sync request. Its endpoint is the writer's
+// choice, so like a crawl it may only reach public addresses, unless the operator listed it in
+// s3_sources.private_endpoints.
+func s3SourceClient(req *models.S3SourceRequest) (*s3Client, error) {
+	client, err := newS3Client(config.S3Config{
+		Bucket:          req.Bucket,
+		Region:          req.Region,
+		Endpoint:        req.Endpoint,
+		AccessKeyID:     req.AccessKeyID,
+		SecretAccessKey: req.SecretAccessKey,
+		SessionToken:    req.SessionToken,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidS3Source, err)
+	}
+	for _, private := range config.AppConfig.S3Sources.PrivateEndpoints {
+		if strings.EqualFold(strings.TrimRight(private, "/"), client.endpoint) {
+			return client, nil
+		}
+	}
+
+	endpoint, err := url.Parse(client.endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("%w: endpoint %q is not an http or https URL", ErrInvalidS3Source, req.Endpoint)
+	}
+	if err := checkPublicHost(endpoint.Hostname()); err != nil {
+		return nil, fmt.Errorf("%w: %v; endpoints on private networks must be listed in s3_sources.private_endpoints",
+			ErrInvalidS3Source, err)
+	}
+	client.http = publicS3HTTPClient
+	return client, nil
+}
+
+// ingestS3Object downloads an object next to path, under the extension matching its content, and
+// ingests the file under source
+func (r *RAGService) ingestS3Object(ctx context.Context, client *s3Client, path, collectionName, source, key string, req *models.S3SourceRequest) (*IngestResult, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(path)
+	contentType, err := client.Get(ctx, key, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := readHead(path, 512)
+	if err != nil {
+		return nil, err
+	}
+	ext, err := objectExtension(key, contentType, head)
+	if err != nil {
+		return nil, err
+	}
+	filePath := path + ext
+	if err := os.Rename(path, filePath); err != nil {
+		return nil, fmt.Errorf("failed to name downloaded object: %w", err)
+	}
+	defer os.Remove(filePath)
+
+	return r.IngestDocument(ctx, collectionName, &models.AddDocumentRequest{
+		CollectionName: collectionName,
+		Source:         source,
+		FilePath:       filePath,
+		DocType:        req.DocType,
+		ChunkingConfig: req.ChunkingConfig,
+	})
+}
+
+// readHead returns up to n bytes from the start of a file, for content type detection
+func readHead(path string, n int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer file.Close()
+	head := make([]byte, n)
+	read, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return head[:read], nil
+}
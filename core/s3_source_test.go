@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"testing"
+)
+
+func TestS3SourceEndpoints(t *testing.T) {
+	saved := config.AppConfig.S3Sources
+	t.Cleanup(func() { config.AppConfig.S3Sources = saved })
+
+	var requests int
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("<Error><Code>InvalidAccessKeyId</Code></Error>"))
+	}))
+	defer store.Close()
+	request := func(endpoint string) *models.S3SourceRequest {
+		return &models.S3SourceRequest{Bucket: "corpus", Endpoint: endpoint, AccessKeyID: "key", SecretAccessKey: "secret"}
+	}
+
+	config.AppConfig.S3Sources = config.S3SourcesConfig{}
+	for _, endpoint := range []string{store.URL, "http://169.254.169.254", "http://localhost:9000", "ftp://files.example.com"} {
+		if _, err := s3SourceClient(request(endpoint)); !errors.Is(err, ErrInvalidS3Source) {
+			t.Errorf("s3SourceClient(%s) = %v, want ErrInvalidS3Source", endpoint, err)
+		}
+	}
+
+	// A name that resolves to a private address passes the first check but can't be connected to
+	client, err := s3SourceClient(request("http://s3.example.com"))
+	if err != nil {
+		t.Fatalf("s3SourceClient with a public name: %v", err)
+	}
+	storeURL, _ := url.Parse(store.URL)
+	client.endpoint = "http://localhost:" + storeURL.Port()
+	if _, err := client.List(context.Background(), ""); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("List through a private address: got %v, want ErrPrivateAddress", err)
+	}
+	if requests != 0 {
+		t.Fatalf("the private store received %d requests", requests)
+	}
+
+	// Listed endpoints may be private, and their rejections are S3Errors
+	config.AppConfig.S3Sources.PrivateEndpoints = []string{store.URL + "/"}
+	client, err = s3SourceClient(request(store.URL))
+	if err != nil {
+		t.Fatalf("s3SourceClient with a listed endpoint: %v", err)
+	}
+	_, err = client.List(context.Background(), "handbook/")
+	var s3Err *S3Error
+	if !errors.As(err, &s3Err) || s3Err.Status != "403 Forbidden" {
+		t.Fatalf("List with bad credentials: got %v, want an S3Error with status 403", err)
+	}
+}
+
+func TestS3ErrorUnwraps(t *testing.T) {
+	// Cancellation shows through, so it isn't reported as the store failing
+	err := &S3Error{Action: "listing", Name: "s3://corpus/", Err: context.Canceled}
+	if !errors.Is(err, context.Canceled) {
+		t.Error("S3Error hides the context error it wraps")
+	}
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A sentence mark followed by whitespace ends a sentence unless the text around it shows it
+// doesn't: decimal numbers and URLs never match, as their periods aren't followed by whitespace,
+// and the rules below reject periods after abbreviations, initials and list numbers, and periods
+// followed by a lowercase word.
+
+// sentenceAbbreviations are abbreviations, lowercased and without their period, that don't end a
+// sentence in each language: titles before names, and "versus" and "compare"
+var sentenceAbbreviations = map[string]map[string]bool{
+	"en": wordSet("mr mrs ms mx dr prof sr jr st mt rev gen col lt sgt capt cmdr hon pres gov sen vs cf"),
+	"es": wordSet("sr sra srta dr dra lic ing prof ud uds"),
+	"fr": wordSet("m mm mme mmes mlle dr pr me st ste cf"),
+	"de": wordSet("hr fr dr prof vgl bzw"),
+	"it": wordSet("sig sigg dott prof ing avv"),
+	"pt": wordSet("sr sra srta dr dra prof"),
+	"nl": wordSet("dhr mevr mw dr prof ir drs"),
+}
+
+// numberAbbreviations are abbreviations that don't end a sentence before a number, as in
+// "Fig. 3" or "Jan. 5". Other abbreviations, like "etc.", often do end one and are left to the
+// lowercase rule.
+var numberAbbreviations = map[string]map[string]bool{
+	"en": wordSet("no nos fig figs eq eqs vol vols ch sec pp p para art approx ca est jan feb mar apr jun jul aug sep sept oct nov dec"),
+	"es": wordSet("núm pág págs art cap fig vol aprox ene feb mar abr jun jul ago sept oct nov dic"),
+	"fr": wordSet("n p pp fig vol chap art env janv févr avr juil sept oct nov déc"),
+	"de": wordSet("nr abb bd kap art ca s jan feb märz apr jun jul aug sept okt nov dez"),
+	"it": wordSet("n pag pagg fig vol cap art ca gen feb mar apr giu lug ago sett ott nov dic"),
+	"pt": wordSet("n núm pág págs art cap fig vol aprox jan fev mar abr jun jul ago set out nov dez"),
+	"nl": wordSet("nr blz fig art ca jan feb mrt apr jun jul aug sept okt nov dec"),
+}
+
+// sentenceEnds reports whether the sentence mark matched at text[start:end], with the whitespace
+// after it, ends a sentence
+func sentenceEnds(text string, start, end int, language string) bool {
+	mark := strings.TrimRightFunc(text[start:end], unicode.IsSpace)
+	if !strings.HasPrefix(mark, ".") {
+		return true
+	}
+
+	// A period followed by a lowercase word continues the sentence, as after "etc." or "..."
+	next, _ := utf8.DecodeRuneInString(text[end:])
+	if unicode.IsLower(next) {
+		return false
+	}
+	if strings.Count(mark, ".") > 1 {
+		return true
+	}
+
+	word, lineStart := wordBefore(text, start)
+	switch {
+	case word == "":
+		return true
+	case lineStart && isListNumber(word):
+		// "1." or "iv." numbering a list item or heading
+		return false
+	case utf8.RuneCountInString(word) == 1 && unicode.IsUpper([]rune(word)[0]):
+		// An initial, as in "J. R. R. Tolkien"
+		return false
+	case strings.Contains(word, "."):
+		// Dotted abbreviations such as "e.g.", "i.e." and "U.S." when their parts are short
+		for _, part := range strings.Split(word, ".") {
+			if utf8.RuneCountInString(part) > 3 {
+				return true
+			}
+		}
+		return false
+	}
+	if _, ok := sentenceAbbreviations[language]; !ok {
+		language = "en"
+	}
+	word = strings.ToLower(word)
+	if sentenceAbbreviations[language][word] {
+		return false
+	}
+	return !(unicode.IsDigit(next) && numberAbbreviations[language][word])
+}
+
+// wordBefore returns the word ending at offset in text, without the brackets and quotes opening it,
+// and whether it starts its line
+func wordBefore(text string, offset int) (string, bool) {
+	start := strings.LastIndexFunc(text[:offset], unicode.IsSpace) + 1
+	word := strings.TrimLeft(text[start:offset], `([{"'“‘«`)
+	lineStart := strings.TrimLeft(text[strings.LastIndex(text[:start], "\n")+1:start], " \t") == ""
+	return word, lineStart
+}
+
+// isListNumber reports whether word is a list number: up to three digits, or an uppercase roman
+// numeral
+func isListNumber(word string) bool {
+	if len(word) <= 3 && strings.Trim(word, "0123456789") == "" {
+		return true
+	}
+	return len(word) <= 5 && strings.Trim(word, "IVXLC") == ""
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"rag-go-app/models"
+)
+
+const defaultSimilarChunks = 5
+
+// SimilarChunks finds the chunks of a chunk's collection whose embeddings are closest to the
+// chunk's stored embedding, for "more like this" passages. A duplicate is compared by the
+// embedding it shares with its original, and no chunk sharing that embedding is returned.
+// Parents, summaries and generated questions restate other chunks, so only passages are returned.
+func (r *RAGService) SimilarChunks(ctx context.Context, chunkID string, req *models.SimilarChunksRequest) (*models.SimilarChunksResponse, error) {
+	source, err := r.vectorDB.similaritySource(chunkID, req.Principal)
+	if err != nil {
+		return nil, err
+	}
+	embeddings, err := r.vectorDB.GetChunkEmbeddings([]string{source.embeddedID})
+	if err != nil {
+		return nil, err
+	}
+	embedding, ok := embeddings[source.embeddedID]
+	if !ok {
+		return nil, fmt.Errorf("embedding of chunk with ID '%s' not found", chunkID)
+	}
+
+	topK := req.TopK
+	if topK <= 0 {
+		topK = defaultSimilarChunks
+	}
+	excluded := metadataFilter{
+		conditions: []string{"COALESCE(c.duplicate_of, c.id) != ?", "c.chunk_type NOT IN (?, ?, ?)"},
+		args:       []interface{}{source.embeddedID, parentChunkType, summaryChunkType, questionChunkType},
+	}
+	if req.ExcludeSameDocument {
+		excluded.conditions = append(excluded.conditions, "c.document_id != ?")
+		excluded.args = append(excluded.args, source.documentID)
+	}
+	filters := map[string]interface{}{"similar_to": excluded}
+	if req.Principal != nil {
+		filters[principalFilter] = req.Principal
+	}
+
+	chunks, scores, err := r.vectorDB.QuerySimilarChunks(ctx, source.collection, embedding, topK, filters)
+	if err != nil {
+		return nil, err
+	}
+	if chunks == nil {
+		chunks, scores = []*models.EnhancedChunk{}, []float64{}
+	}
+	return &models.SimilarChunksResponse{
+		ChunkID:        chunkID,
+		DocumentID:     source.documentID,
+		CollectionName: source.collection,
+		Chunks:         chunks,
+		Scores:         scores,
+	}, nil
+}
+
+// similarChunkSource is the chunk similar chunks are searched for
+type similarChunkSource struct {
+	documentID string
+	collection string
+	embeddedID string // The chunk holding its embedding: itself, or the original of a duplicate
+}
+
+// similaritySource looks up a chunk of a document the principal may see
+func (db *VectorDB) similaritySource(chunkID string, principal *models.Principal) (*similarChunkSource, error) {
+	query := `SELECT c.document_id, c.collection_name, COALESCE(c.duplicate_of, c.id) FROM enhanced_chunks c
+		WHERE c.id = ? AND c.tenant_id = ?`
+	args := []interface{}{chunkID, db.tenant}
+	if principal != nil {
+		condition, principalArgs := aclCondition(principal)
+		query += " AND " + condition
+		args = append(args, principalArgs...)
+	}
+
+	var source similarChunkSource
+	err := db.conn.QueryRow(query, args...).Scan(&source.documentID, &source.collection, &source.embeddedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("chunk with ID '%s' not found", chunkID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunk: %w", err)
+	}
+	return &source, nil
+}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"rag-go-app/models"
+)
+
+// suggestedQuestionCount is how many follow-up questions a query response suggests
+const suggestedQuestionCount = 3
+
+// suggestionPrompt asks the chat model for follow-up questions the contexts of an answer can answer
+const suggestionPrompt = `Below are a question, its answer and the numbered contexts the answer was written from. Write %d follow-up questions the user might ask next that these contexts answer. Each should ask about something the answer didn't cover, be understandable on its own and not repeat the question.
+
+Output only the questions, one per line, without numbering or explanations.
+
+Question: %s
+
+Answer: %s
+
+%s`
+
+// suggestQuestions asks the chat model for follow-up questions to a query that the retrieved
+// chunks answer, so a chat UI can offer them without another round-trip
+func (r *RAGService) suggestQuestions(ctx context.Context, query, answer string, chunks []*models.EnhancedChunk) ([]string, error) {
+	prompt := fmt.Sprintf(suggestionPrompt, suggestedQuestionCount, query, answer, r.prepareContext(chunks))
+	response, err := r.llmClient.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	questions := parseQueryVariants(response, query, suggestedQuestionCount)
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("no questions in model response")
+	}
+	return questions, nil
+}
@@ -0,0 +1,245 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-go-app/models"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	summaryChunkType = "summary"
+	summaryWorkers   = 4    // Summaries requested from the chat model at the same time
+	maxSummaryInput  = 4000 // Characters of text summarized together, unless a group would have fewer than two nodes
+)
+
+// abstractionFilter is the filters key Retrieve puts the query's abstraction level under.
+// buildFilterConditions only honours a models.AbstractionLevel there.
+const abstractionFilter = "abstraction"
+
+// Levels recorded in the summary_level metadata of summary chunks
+const (
+	SummaryLevelCluster  = "cluster"  // Summary of consecutive chunks of one section
+	SummaryLevelSection  = "section"  // Summary of the clusters of one section
+	SummaryLevelGroup    = "group"    // Summary of summaries spanning several sections, or of a document without sections
+	SummaryLevelDocument = "document" // Root of the tree, summarizing the whole document
+	SummaryLevelOverview = "overview" // Title and summary of the whole document, added by document_summary
+)
+
+// summaryPrompt asks the chat model to summarize passages of a document
+const summaryPrompt = `Summarize the following passages from the document "%s" in a few sentences. Keep the names, numbers and key facts someone might search for, and don't add anything that isn't in the passages.
+
+Output only the summary.
+
+%s`
+
+// SummaryStats counts the summaries built for a document
+type SummaryStats struct {
+	Summaries int
+	Failed    int // Groups the chat model returned no summary for; their passages are summarized one level up
+}
+
+// buildSummaryTree adds a tree of summaries to a document's chunks: consecutive chunks of a
+// section are summarized into clusters, clusters into section summaries, and those on up to a
+// single document summary. The summaries are stored as chunks of type "summary" and embedded like
+// any other, so broad questions can match them. A summary of the same passages as one of the
+// previous version is reused instead of asking the chat model again.
+func (r *RAGService) buildSummaryTree(ctx context.Context, doc *models.Document, previousID string) (*SummaryStats, error) {
+	var nodes []*models.EnhancedChunk
+	for _, chunk := range doc.Chunks {
+		if len(chunk.ChildChunkIDs) == 0 && chunk.ChunkType != summaryChunkType {
+			nodes = append(nodes, chunk)
+		}
+	}
+	stats := &SummaryStats{}
+	if len(nodes) < 2 {
+		return stats, nil
+	}
+
+	previous := make(map[string]string)
+	if previousID != "" {
+		var err error
+		if previous, err = r.vectorDB.summaryTexts(previousID); err != nil {
+			return nil, err
+		}
+	}
+
+	language, _ := doc.Metadata["language"].(string)
+	var summaries []*models.EnhancedChunk
+	for depth := 1; len(nodes) > 1; depth++ {
+		groups := groupSummaryNodes(nodes, depth <= 2)
+		next := make([]*models.EnhancedChunk, len(groups))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		semaphore := make(chan struct{}, summaryWorkers)
+		for i, group := range groups {
+			if len(group) == 1 {
+				next[i] = group[0]
+				continue
+			}
+			wg.Add(1)
+			go func(i int, group []*models.EnhancedChunk) {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+				if ctx.Err() != nil {
+					return
+				}
+
+				summary, err := r.summarizeGroup(ctx, doc, group, previous, depth, language)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					log.Printf("Summarizing %d passages of '%s' failed: %v", len(group), doc.Source, err)
+					stats.Failed++
+					return
+				}
+				next[i] = summary
+			}(i, group)
+		}
+		wg.Wait()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// A failed group's passages carry on to the next level, merged with their neighbours
+		nodes = nodes[:0:0]
+		merged := 0
+		for i, node := range next {
+			if node == nil {
+				nodes = append(nodes, groups[i]...)
+				continue
+			}
+			if len(groups[i]) > 1 {
+				summaries = append(summaries, node)
+				merged++
+			}
+			nodes = append(nodes, node)
+		}
+		if merged == 0 && depth > 2 {
+			break // Every group failed, and the next level would send the same ones
+		}
+	}
+
+	if len(nodes) == 1 && nodes[0].ChunkType == summaryChunkType {
+		nodes[0].Metadata["summary_level"] = SummaryLevelDocument
+	}
+	for i, summary := range summaries {
+		summary.ChunkIndex = len(doc.Chunks) + i
+	}
+	doc.Chunks = append(doc.Chunks, summaries...)
+	stats.Summaries = len(summaries)
+
+	log.Printf("Built %d summaries over %d chunks of '%s' (%d failed)",
+		stats.Summaries, len(doc.Chunks)-stats.Summaries, doc.Source, stats.Failed)
+	return stats, nil
+}
+
+// groupSummaryNodes splits nodes into runs of consecutive nodes of at most maxSummaryInput
+// characters, or two nodes when those are longer. bySection also breaks runs where the section
+// changes, so the lower levels of the tree follow the document's structure.
+func groupSummaryNodes(nodes []*models.EnhancedChunk, bySection bool) [][]*models.EnhancedChunk {
+	var groups [][]*models.EnhancedChunk
+	var group []*models.EnhancedChunk
+	size := 0
+	for _, node := range nodes {
+		sectionChange := bySection && len(group) > 0 && node.Section != group[0].Section
+		if sectionChange || (len(group) >= 2 && size+len(node.Text) > maxSummaryInput) {
+			groups = append(groups, group)
+			group, size = nil, 0
+		}
+		group = append(group, node)
+		size += len(node.Text)
+	}
+	return append(groups, group)
+}
+
+// summarizeGroup creates the summary chunk of a group of nodes at the given depth of the tree
+func (r *RAGService) summarizeGroup(ctx context.Context, doc *models.Document, group []*models.EnhancedChunk, previous map[string]string, depth int, language string) (*models.EnhancedChunk, error) {
+	texts := make([]string, len(group))
+	childIDs := make([]string, len(group))
+	for i, node := range group {
+		texts[i] = node.Text
+		childIDs[i] = node.ID
+	}
+	hash := ContentHash([]byte(strings.Join(texts, "\x00")))
+
+	text, ok := previous[hash]
+	if !ok {
+		response, err := r.llmClient.GenerateResponse(ctx, fmt.Sprintf(summaryPrompt, doc.Source, strings.Join(texts, "\n\n---\n\n")))
+		if err != nil {
+			return nil, err
+		}
+		if text = strings.TrimSpace(response); text == "" {
+			return nil, fmt.Errorf("empty summary in model response")
+		}
+	}
+
+	section := group[0].Section
+	for _, node := range group {
+		if node.Section != section {
+			section = ""
+		}
+	}
+	level := SummaryLevelGroup
+	if depth == 1 {
+		level = SummaryLevelCluster
+	} else if depth == 2 && section != "" {
+		level = SummaryLevelSection
+	}
+
+	summaryLanguage := detectLanguage(text)
+	if summaryLanguage == "" {
+		summaryLanguage = language
+	}
+	if summaryLanguage == "" {
+		summaryLanguage = defaultLanguage
+	}
+
+	return &models.EnhancedChunk{
+		ID:            uuid.New().String(),
+		DocumentID:    doc.ID,
+		Text:          text,
+		ChildChunkIDs: childIDs,
+		Section:       section,
+		ChunkType:     summaryChunkType,
+		StartPos:      group[0].StartPos,
+		EndPos:        group[len(group)-1].EndPos,
+		Keywords:      keywordsIn(text, summaryLanguage),
+		Metadata: map[string]interface{}{
+			"summary_level":   level,
+			"summary_depth":   depth,
+			"summarized_hash": hash,
+			"language":        summaryLanguage,
+		},
+		Confidence: 1.0,
+	}, nil
+}
+
+// summaryTexts returns the summaries stored for a document, keyed by the hash of the passages
+// they summarize
+func (db *VectorDB) summaryTexts(documentID string) (map[string]string, error) {
+	rows, err := db.conn.Query(`SELECT json_extract(metadata, '$.summarized_hash'), rag_open(text) FROM enhanced_chunks
+		WHERE document_id = ? AND tenant_id = ? AND chunk_type = ?`, documentID, db.tenant, summaryChunkType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read previous summaries: %w", err)
+	}
+	defer rows.Close()
+
+	texts := make(map[string]string)
+	for rows.Next() {
+		var hash *string
+		var text string
+		if err := rows.Scan(&hash, &text); err != nil {
+			return nil, fmt.Errorf("failed to scan previous summary: %w", err)
+		}
+		if hash != nil {
+			texts[*hash] = text
+		}
+	}
+	return texts, rows.Err()
+}
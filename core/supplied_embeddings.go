@@ -0,0 +1,99 @@
+package core
+
+import (
+	"fmt"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+)
+
+// SuppliedEmbeddingError reports embeddings supplied with a request that can't be stored: a chunk
+// without one, or one whose dimension differs from the collection's embeddings
+type SuppliedEmbeddingError struct {
+	Reason string
+}
+
+func (e *SuppliedEmbeddingError) Error() string {
+	return "invalid embeddings: " + e.Reason
+}
+
+// suppliedEmbeddingDimension returns the dimension embeddings supplied by clients for a collection
+// must have: that of its embeddings or, before it has any, the recorded dimension of the
+// configured embedding model, which queries are embedded with. It returns 0 when neither is known yet.
+func (db *VectorDB) suppliedEmbeddingDimension(collectionName string) (int, error) {
+	stored, err := db.storedDimension(db.conn, collectionName)
+	if err != nil || stored > 0 {
+		return stored, err
+	}
+	modelDimensions.Lock()
+	defer modelDimensions.Unlock()
+	if known, ok := lookupModelDimension(config.AppConfig.EmbeddingModel); ok {
+		return known.Dimension, nil
+	}
+	return 0, nil
+}
+
+// checkSuppliedChunks fails with a SuppliedEmbeddingError unless every chunk has text and an
+// embedding, all of one dimension that matches suppliedEmbeddingDimension
+func (db *VectorDB) checkSuppliedChunks(collectionName string, chunks []models.ImportedChunk) error {
+	dimension, err := db.suppliedEmbeddingDimension(collectionName)
+	if err != nil {
+		return err
+	}
+	for i, chunk := range chunks {
+		if strings.TrimSpace(chunk.Text) == "" {
+			return &SuppliedEmbeddingError{Reason: fmt.Sprintf("chunk %d has empty text", i)}
+		}
+		if len(chunk.Embedding) == 0 {
+			return &SuppliedEmbeddingError{Reason: fmt.Sprintf("chunk %d has no embedding", i)}
+		}
+		if dimension == 0 {
+			dimension = len(chunk.Embedding)
+		}
+		if len(chunk.Embedding) != dimension {
+			return &SuppliedEmbeddingError{Reason: fmt.Sprintf("chunk %d has %d dimensions where %d are expected",
+				i, len(chunk.Embedding), dimension)}
+		}
+	}
+	return nil
+}
+
+// checkSuppliedEmbedding fails with a SuppliedEmbeddingError unless the embedding of a single
+// chunk of the collection matches suppliedEmbeddingDimension
+func (db *VectorDB) checkSuppliedEmbedding(collectionName string, embedding []float32) error {
+	dimension, err := db.suppliedEmbeddingDimension(collectionName)
+	if err != nil {
+		return err
+	}
+	if dimension > 0 && len(embedding) != dimension {
+		return &SuppliedEmbeddingError{Reason: fmt.Sprintf("embedding has %d dimensions where %d are expected", len(embedding), dimension)}
+	}
+	return nil
+}
+
+// suppliedContent returns the content of a document given only as chunks: their texts, joined
+func suppliedContent(chunks []models.ImportedChunk) string {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// suppliedContentHash returns the content hash of a document given with its chunks. It covers the
+// chunks and their embeddings too, so the document counts as changed when the client chunks or
+// embeds the same content differently.
+func suppliedContentHash(content string, chunks []models.ImportedChunk) (string, error) {
+	data := []byte(content)
+	for _, chunk := range chunks {
+		blob, err := serializeEmbedding(chunk.Embedding)
+		if err != nil {
+			return "", err
+		}
+		data = append(data, 0)
+		data = append(data, chunk.Text...)
+		data = append(data, 0)
+		data = append(data, blob...)
+	}
+	return ContentHash(data), nil
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"rag-go-app/config"
+	"strings"
+	"time"
+)
+
+// SystemInfo describes the models the server uses and the database it stores into, so clients can
+// check their setup against them
+type SystemInfo struct {
+	Provider       string             `json:"provider"` // "openai" or "ollama"
+	EmbeddingModel EmbeddingModelInfo `json:"embedding_model"`
+	ChatModel      string             `json:"chat_model"`
+	Checks         []DependencyCheck  `json:"checks"`        // Reachability of the database and model server
+	ModelServers   []BackendStatus    `json:"model_servers"` // Circuit state of each model server, in failover order
+	Database       DatabaseInfo       `json:"database"`
+	Counts         SystemCounts       `json:"counts"` // What the tenant stores
+}
+
+// EmbeddingModelInfo is the configured embedding model and the dimension of its embeddings
+type EmbeddingModelInfo struct {
+	Name              string     `json:"name"`
+	Dimension         int        `json:"dimension,omitempty"`          // Found by embedding a test text; recorded once known
+	ProbedAt          *time.Time `json:"probed_at,omitempty"`          // When the dimension was found
+	ProbeError        string     `json:"probe_error,omitempty"`        // Why the dimension is unknown
+	StoredDimension   int        `json:"stored_dimension"`             // Of most of the tenant's stored embeddings; 0 before any are stored
+	DimensionMismatch bool       `json:"dimension_mismatch,omitempty"` // Some collections hold embeddings the model's can't be stored beside
+
+	MismatchedCollections []string `json:"mismatched_collections,omitempty"` // Collections to re-embed with the model
+}
+
+// DatabaseInfo describes the SQLite database
+type DatabaseInfo struct {
+	SQLiteVersion    string `json:"sqlite_version"`
+	SQLiteVecVersion string `json:"sqlite_vec_version"`
+	SizeBytes        int64  `json:"size_bytes"` // Of the whole database, every tenant's data included
+}
+
+// SystemCounts counts the collections, documents and chunks a tenant stores
+type SystemCounts struct {
+	Collections int64 `json:"collections"`
+	Documents   int64 `json:"documents"`
+	Chunks      int64 `json:"chunks"` // Parents, summaries and questions included
+}
+
+// SystemInfo reports the configured models, the embedding dimension, the reachability of the
+// database and model servers, the database versions and size, and what the tenant stores. The
+// dependency checks and the dimension probe run concurrently.
+func (r *RAGService) SystemInfo(ctx context.Context) (*SystemInfo, error) {
+	info := &SystemInfo{
+		Provider:       strings.ToLower(config.AppConfig.Provider),
+		EmbeddingModel: EmbeddingModelInfo{Name: config.AppConfig.EmbeddingModel},
+		ChatModel:      config.AppConfig.ChatModel,
+	}
+	if info.Provider == "" {
+		info.Provider = ProviderOpenAI
+	}
+
+	probed := make(chan struct{})
+	go func() {
+		defer close(probed)
+		dimension, err := EmbeddingDimension(ctx, info.EmbeddingModel.Name)
+		if err != nil {
+			info.EmbeddingModel.ProbeError = err.Error()
+			return
+		}
+		info.EmbeddingModel.Dimension = dimension.Dimension
+		info.EmbeddingModel.ProbedAt = &dimension.ProbedAt
+	}()
+	info.Checks = CheckDependencies(ctx, r.vectorDB)
+	info.ModelServers = BackendStatuses()
+
+	database, counts, err := r.vectorDB.systemStats()
+	<-probed
+	if err != nil {
+		return nil, err
+	}
+	info.Database, info.Counts = *database, *counts
+
+	names, err := r.vectorDB.collectionNames()
+	if err != nil {
+		return nil, err
+	}
+	collections := make(map[int]int) // Collections by dimension
+	for _, name := range names {
+		stored, err := r.vectorDB.storedDimension(r.vectorDB.conn, name)
+		if err != nil {
+			return nil, err
+		}
+		if stored == 0 {
+			continue
+		}
+		collections[stored]++
+		if collections[stored] > collections[info.EmbeddingModel.StoredDimension] {
+			info.EmbeddingModel.StoredDimension = stored
+		}
+		if info.EmbeddingModel.Dimension > 0 && stored != info.EmbeddingModel.Dimension {
+			info.EmbeddingModel.MismatchedCollections = append(info.EmbeddingModel.MismatchedCollections, name)
+		}
+	}
+	info.EmbeddingModel.DimensionMismatch = len(info.EmbeddingModel.MismatchedCollections) > 0
+	return info, nil
+}
+
+// systemStats reads the database versions and size and counts what the tenant stores
+func (db *VectorDB) systemStats() (*DatabaseInfo, *SystemCounts, error) {
+	var database DatabaseInfo
+	err := db.conn.QueryRow(`SELECT sqlite_version(), vec_version(),
+		(SELECT page_count FROM pragma_page_count()) * (SELECT page_size FROM pragma_page_size())`).
+		Scan(&database.SQLiteVersion, &database.SQLiteVecVersion, &database.SizeBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read database information: %w", err)
+	}
+
+	var counts SystemCounts
+	err = db.conn.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM collections WHERE tenant_id = ?),
+		(SELECT COUNT(*) FROM documents WHERE tenant_id = ?),
+		(SELECT COUNT(*) FROM enhanced_chunks WHERE tenant_id = ?)`, db.tenant, db.tenant, db.tenant).
+		Scan(&counts.Collections, &counts.Documents, &counts.Chunks)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count stored data: %w", err)
+	}
+	return &database, &counts, nil
+}
@@ -0,0 +1,385 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"rag-go-app/models"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	tableChunkType   = "table"
+	maxCaptionLength = 200 // Longer lines before a table are text, not its caption
+)
+
+// tableSummaryPrompt asks the chat model to describe a table, so it can be found by questions
+// phrased in prose
+const tableSummaryPrompt = `Describe the following table from the document "%s" in a few sentences of plain text: what it lists, what its columns mean and the notable values someone might search for. Don't add anything that isn't in the table.
+
+Output only the description.
+
+%s`
+
+var (
+	htmlTableOpen       = regexp.MustCompile(`(?i)<table\b`)
+	htmlTableClose      = regexp.MustCompile(`(?i)</table\s*>`)
+	htmlCaptionPattern  = regexp.MustCompile(`(?is)<caption\b[^>]*>(.*?)</caption\s*>`)
+	htmlRowPattern      = regexp.MustCompile(`(?is)<tr\b[^>]*>(.*?)</tr\s*>`)
+	htmlCellPattern     = regexp.MustCompile(`(?is)<t([hd])\b[^>]*>(.*?)</t[hd]\s*>`)
+	htmlTagPattern      = regexp.MustCompile(`<[^>]*>`)
+	tableCaptionPattern = regexp.MustCompile(`(?i)^(table|tbl\.?)\s*[0-9ivx.\-]*\s*[:.\-–—]`)
+)
+
+// documentTable is a Markdown pipe table or HTML table found in a document
+type documentTable struct {
+	Start   int // Byte range in the content, caption included
+	End     int
+	Caption string
+	Columns []string // Cells of the header row
+	Rows    int      // Rows below the header
+	Format  string   // "markdown" or "html"
+}
+
+// metadata describes the table on its chunk
+func (t documentTable) metadata() map[string]interface{} {
+	metadata := map[string]interface{}{
+		"table_format": t.Format,
+		"table_rows":   t.Rows,
+	}
+	if t.Caption != "" {
+		metadata["table_caption"] = t.Caption
+	}
+	if len(t.Columns) > 0 {
+		metadata["table_columns"] = t.Columns
+	}
+	return metadata
+}
+
+// findTables locates the tables of a plain text document: pipe tables with a delimiter row under
+// their header, and HTML tables from <table> to the matching </table>. A caption line just above a
+// table belongs to it.
+func findTables(content string) []documentTable {
+	var lines []string
+	var starts []int
+	for offset := 0; offset < len(content); {
+		end := strings.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			end = len(content) - offset
+		}
+		lines = append(lines, strings.TrimSuffix(content[offset:offset+end], "\r"))
+		starts = append(starts, offset)
+		offset += end + 1
+	}
+	lineEnd := func(i int) int { return starts[i] + len(lines[i]) }
+
+	var tables []documentTable
+	free := 0 // First line not taken by a previous table
+	for i := 0; i < len(lines); i++ {
+		end := -1
+		if htmlTableOpen.MatchString(lines[i]) {
+			end = htmlTableEnd(lines, i)
+		} else if strings.Contains(lines[i], "|") && i+1 < len(lines) && markdownTableDelimiter.MatchString(lines[i+1]) {
+			end = pipeTableEnd(lines, i)
+		}
+		if end < 0 {
+			continue
+		}
+
+		table := parseTable(content[starts[i]:lineEnd(end)])
+		table.Start, table.End = starts[i], lineEnd(end)
+		if caption := captionLine(lines, i, free); caption >= 0 {
+			if table.Caption == "" {
+				table.Caption = cleanCaption(lines[caption])
+			}
+			table.Start = starts[caption]
+		}
+		tables = append(tables, table)
+		i, free = end, end+1
+	}
+	return tables
+}
+
+// pipeTableEnd returns the last line of the pipe table whose header is on line start
+func pipeTableEnd(lines []string, start int) int {
+	end := start + 1
+	for end+1 < len(lines) && strings.TrimSpace(lines[end+1]) != "" && strings.Contains(lines[end+1], "|") {
+		end++
+	}
+	return end
+}
+
+// htmlTableEnd returns the line closing the HTML table opened on line start, counting nested
+// tables; an unclosed table runs to the end of the document
+func htmlTableEnd(lines []string, start int) int {
+	depth := 0
+	for i := start; i < len(lines); i++ {
+		depth += len(htmlTableOpen.FindAllStringIndex(lines[i], -1)) - len(htmlTableClose.FindAllStringIndex(lines[i], -1))
+		if depth <= 0 {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
+
+// captionLine returns the line of the caption above the table starting on line start, at most
+// one blank line away and not before line free, or -1 when there is none
+func captionLine(lines []string, start, free int) int {
+	for i := start - 1; i >= free && i >= start-2; i-- {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		if isTableCaption(lines[i]) {
+			return i
+		}
+		return -1
+	}
+	return -1
+}
+
+// isTableCaption reports whether a line introduces the table below it, like "Table 2: Revenue"
+// or "Quarterly results:"
+func isTableCaption(line string) bool {
+	caption := cleanCaption(line)
+	if caption == "" || len(caption) > maxCaptionLength || strings.ContainsAny(caption, "|\n") {
+		return false
+	}
+	return tableCaptionPattern.MatchString(caption) || strings.HasSuffix(caption, ":")
+}
+
+// cleanCaption strips the emphasis markers and whitespace around a caption line
+func cleanCaption(line string) string {
+	return strings.TrimSpace(strings.Trim(strings.TrimSpace(line), "*_"))
+}
+
+// parseTable reads the caption, header and row count of the source of a table
+func parseTable(source string) documentTable {
+	if htmlTableOpen.MatchString(source) {
+		return parseHTMLTable(source)
+	}
+
+	var rows []string
+	for _, line := range strings.Split(source, "\n") {
+		if strings.Contains(line, "|") {
+			rows = append(rows, line)
+		}
+	}
+	table := documentTable{Format: "markdown"}
+	if len(rows) >= 2 {
+		table.Columns = pipeCells(rows[0])
+		table.Rows = len(rows) - 2
+	}
+	return table
+}
+
+// pipeCells splits a pipe table row into its trimmed cells; escaped pipes stay in their cell
+func pipeCells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimSuffix(strings.TrimPrefix(row, "|"), "|")
+	row = strings.ReplaceAll(row, `\|`, "\x00")
+
+	cells := strings.Split(row, "|")
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(strings.ReplaceAll(cell, "\x00", "|"))
+	}
+	return cells
+}
+
+// parseHTMLTable reads an HTML table; its first row is the header when it has <th> cells
+func parseHTMLTable(source string) documentTable {
+	table := documentTable{Format: "html"}
+	if caption := htmlCaptionPattern.FindStringSubmatch(source); caption != nil {
+		table.Caption = htmlText(caption[1])
+	}
+
+	rows := htmlRowPattern.FindAllStringSubmatch(source, -1)
+	table.Rows = len(rows)
+	if len(rows) > 0 {
+		cells := htmlCellPattern.FindAllStringSubmatch(rows[0][1], -1)
+		header := len(cells) > 0
+		for _, cell := range cells {
+			header = header && strings.EqualFold(cell[1], "h")
+		}
+		if header {
+			for _, cell := range cells {
+				table.Columns = append(table.Columns, htmlText(cell[2]))
+			}
+			table.Rows--
+		}
+	}
+	return table
+}
+
+// htmlText returns the text of an HTML fragment with tags removed and whitespace collapsed
+func htmlText(fragment string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(htmlTagPattern.ReplaceAllString(fragment, " "))), " ")
+}
+
+// newTableChunk creates the chunk holding a table and its caption
+func newTableChunk(content string, table documentTable, docID string, section string, config *models.ChunkingConfig) *models.EnhancedChunk {
+	start, end := trimSpan(content, table.Start, table.End)
+	text := content[start:end]
+	chunk := &models.EnhancedChunk{
+		ID:         uuid.New().String(),
+		DocumentID: docID,
+		Text:       text,
+		Section:    section,
+		ChunkType:  tableChunkType,
+		StartPos:   utf8.RuneCountInString(content[:start]),
+		EndPos:     utf8.RuneCountInString(content[:end]),
+		Metadata:   table.metadata(),
+	}
+	if config.ExtractKeywords {
+		chunk.Keywords = extractKeywords(text)
+	}
+	return chunk
+}
+
+// chunkAroundTables keeps every table of content in a chunk of its own and chunks the text
+// between tables with chunkText. Positions of the text chunks are shifted to the full content,
+// and text after a table stays in the section it continues.
+func chunkAroundTables(content string, tables []documentTable, docID string, config *models.ChunkingConfig, chunkText func(string) ([]*models.EnhancedChunk, error)) ([]*models.EnhancedChunk, error) {
+	var chunks []*models.EnhancedChunk
+	section := "document"
+	offset := 0
+	for i := 0; i <= len(tables); i++ {
+		end := len(content)
+		if i < len(tables) {
+			end = tables[i].Start
+		}
+
+		if segment := content[offset:end]; strings.TrimSpace(segment) != "" {
+			segmentChunks, err := chunkText(segment)
+			if err != nil {
+				return nil, err
+			}
+			shift := utf8.RuneCountInString(content[:offset])
+			for _, chunk := range segmentChunks {
+				chunk.StartPos += shift
+				chunk.EndPos += shift
+				if chunk.Section == "document" {
+					chunk.Section = section
+				}
+				section = chunk.Section
+			}
+			chunks = append(chunks, segmentChunks...)
+		}
+
+		if i < len(tables) {
+			chunks = append(chunks, newTableChunk(content, tables[i], docID, section, config))
+			offset = tables[i].End
+		}
+	}
+
+	for i, chunk := range chunks {
+		chunk.ChunkIndex = i
+	}
+	return chunks, nil
+}
+
+// TableSummaryStats counts the tables of a document described by the chat model
+type TableSummaryStats struct {
+	Summarized int
+	Failed     int
+}
+
+// summarizeTables asks the chat model to describe each table chunk of a document. The description
+// is kept in the chunk's table_summary metadata and embedded along with the table, whose text is
+// left as is. A table of the previous version keeps its description.
+func (r *RAGService) summarizeTables(ctx context.Context, doc *models.Document, previousID string) (*TableSummaryStats, error) {
+	previous := make(map[string]string)
+	if previousID != "" {
+		var err error
+		if previous, err = r.vectorDB.tableSummaries(previousID); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := &TableSummaryStats{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, summaryWorkers)
+	for _, chunk := range doc.Chunks {
+		if chunk.ChunkType != tableChunkType {
+			continue
+		}
+		if summary, ok := previous[ContentHash([]byte(chunk.Text))]; ok {
+			chunk.Metadata["table_summary"] = summary
+			stats.Summarized++
+			continue
+		}
+
+		wg.Add(1)
+		go func(chunk *models.EnhancedChunk) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			if ctx.Err() != nil {
+				return
+			}
+
+			response, err := r.llmClient.GenerateResponse(ctx, fmt.Sprintf(tableSummaryPrompt, doc.Source, chunk.Text))
+			summary := strings.TrimSpace(response)
+			if err == nil && summary == "" {
+				err = fmt.Errorf("empty description in model response")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("Describing a table of '%s' failed: %v", doc.Source, err)
+				stats.Failed++
+				return
+			}
+			chunk.Metadata["table_summary"] = summary
+			stats.Summarized++
+		}(chunk)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if stats.Summarized+stats.Failed > 0 {
+		log.Printf("Described %d tables of '%s' (%d failed)", stats.Summarized, doc.Source, stats.Failed)
+	}
+	return stats, nil
+}
+
+// embeddingText is the text a chunk is embedded from: its own, preceded by the description of a
+// summarized table
+func embeddingText(chunk *models.EnhancedChunk) string {
+	if summary, _ := chunk.Metadata["table_summary"].(string); summary != "" {
+		return summary + "\n\n" + chunk.Text
+	}
+	return chunk.Text
+}
+
+// tableSummaries returns the table descriptions stored for a document, keyed by the hash of the
+// table's text
+func (db *VectorDB) tableSummaries(documentID string) (map[string]string, error) {
+	rows, err := db.conn.Query(`SELECT rag_open(text), json_extract(metadata, '$.table_summary') FROM enhanced_chunks
+		WHERE document_id = ? AND tenant_id = ? AND chunk_type = ?`, documentID, db.tenant, tableChunkType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read previous table summaries: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := make(map[string]string)
+	for rows.Next() {
+		var text string
+		var summary *string
+		if err := rows.Scan(&text, &summary); err != nil {
+			return nil, fmt.Errorf("failed to scan previous table summary: %w", err)
+		}
+		if summary != nil && *summary != "" {
+			summaries[ContentHash([]byte(text))] = *summary
+		}
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"rag-go-app/models"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Filters keys Retrieve puts range filters under. buildFilterConditions only honours the types
+// below there, so metadata_filters cannot set them.
+const (
+	createdRangeFilter   = "created_range"
+	metadataRangesFilter = "metadata_ranges"
+)
+
+// defaultRecencyWeight is the share of the score given to recency when a query sets a half-life
+// but no weight
+const defaultRecencyWeight = 0.3
+
+// metadataKeyPattern matches the metadata keys range filters accept: identifiers, optionally
+// nested with dots
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// createdRange bounds the creation time of the documents chunks belong to, in SQLite's
+// CURRENT_TIMESTAMP format; an empty bound is open
+type createdRange struct {
+	after, before string
+}
+
+// addRangeFilters adds the creation time and metadata range filters of a query to filters
+func addRangeFilters(filters map[string]interface{}, req *models.QueryRequest) error {
+	var created createdRange
+	for _, bound := range []struct {
+		value, param string
+		target       *string
+	}{
+		{req.CreatedAfter, "created_after", &created.after},
+		{req.CreatedBefore, "created_before", &created.before},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parseListTime(bound.value)
+		if err != nil {
+			return fmt.Errorf("invalid filters: %s must be RFC 3339 or YYYY-MM-DD", bound.param)
+		}
+		*bound.target = t.UTC().Format("2006-01-02 15:04:05")
+	}
+	if created.after != "" || created.before != "" {
+		filters[createdRangeFilter] = created
+	}
+
+	for key, bounds := range req.MetadataRanges {
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid filters: metadata_ranges key %q must be an identifier, optionally nested with dots", key)
+		}
+		if bounds.Gt == nil && bounds.Gte == nil && bounds.Lt == nil && bounds.Lte == nil {
+			return fmt.Errorf("invalid filters: metadata_ranges key %q needs at least one of gt, gte, lt or lte", key)
+		}
+	}
+	if len(req.MetadataRanges) > 0 {
+		filters[metadataRangesFilter] = req.MetadataRanges
+	}
+	return nil
+}
+
+// ValidateQueryFilters rejects metadata and range filters Retrieve could not apply
+func ValidateQueryFilters(req *models.QueryRequest) error {
+	filters := make(map[string]interface{})
+	if err := addMetadataFilters(filters, req); err != nil {
+		return err
+	}
+	return addRangeFilters(filters, req)
+}
+
+// rangeConditions translates a range filter into SQL conditions on the enhanced_chunks alias "c"
+func rangeConditions(value interface{}) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	switch value := value.(type) {
+	case createdRange:
+		var bounds []string
+		if value.after != "" {
+			bounds = append(bounds, "created_at >= ?")
+			args = append(args, value.after)
+		}
+		if value.before != "" {
+			bounds = append(bounds, "created_at < ?")
+			args = append(args, value.before)
+		}
+		conditions = append(conditions, "c.document_id IN (SELECT id FROM documents WHERE "+strings.Join(bounds, " AND ")+")")
+	case map[string]models.MetadataRange:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			field, _ := metadataField(key)
+			for _, bound := range []struct {
+				operator string
+				limit    *float64
+			}{
+				{"$gt", value[key].Gt}, {"$gte", value[key].Gte}, {"$lt", value[key].Lt}, {"$lte", value[key].Lte},
+			} {
+				if bound.limit != nil {
+					condition, boundArgs, _ := field.operatorCondition(bound.operator, *bound.limit)
+					conditions = append(conditions, condition)
+					args = append(args, boundArgs...)
+				}
+			}
+		}
+	}
+	return conditions, args
+}
+
+// recencyFactors returns the multiplier recency applies to the score of each chunk, keyed by chunk
+// ID: 1 - weight + weight × 0.5^(age / half-life), where age is the time since the chunk's
+// document was added
+func (r *RAGService) recencyFactors(chunks []*models.EnhancedChunk, req *models.QueryRequest) (map[string]float64, error) {
+	weight := req.RecencyWeight
+	if weight <= 0 {
+		weight = defaultRecencyWeight
+	}
+
+	documentIDs := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		documentIDs = append(documentIDs, chunk.DocumentID)
+	}
+	created, err := r.vectorDB.documentCreationTimes(documentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	factors := make(map[string]float64, len(chunks))
+	for _, chunk := range chunks {
+		factor := 1.0
+		if t, ok := created[chunk.DocumentID]; ok {
+			ageDays := math.Max(now.Sub(t).Hours()/24, 0)
+			factor = 1 - weight + weight*math.Pow(0.5, ageDays/req.RecencyHalfLifeDays)
+		}
+		factors[chunk.ID] = factor
+	}
+	return factors, nil
+}
+
+// boostRecency scales ranking by each chunk's recency factor and reorders the chunks, the boosted
+// ranking and every aligned score slice by it. Negative scores, which some rerankers return, are
+// lowered by the same share, so an older chunk never gains.
+func boostRecency(chunks []*models.EnhancedChunk, factors map[string]float64, ranking []float64, aligned ...[]float64) ([]*models.EnhancedChunk, []float64, [][]float64) {
+	boosted := make([]float64, len(ranking))
+	order := make([]int, len(ranking))
+	for i, score := range ranking {
+		boosted[i] = score - math.Abs(score)*(1-factors[chunks[i].ID])
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return boosted[order[a]] > boosted[order[b]] })
+
+	for i, scores := range aligned {
+		aligned[i] = pickScores(scores, order)
+	}
+	return pickChunks(chunks, order), pickScores(boosted, order), aligned
+}
+
+// documentCreationTimes returns when each of the given documents was added, keyed by ID
+func (db *VectorDB) documentCreationTimes(documentIDs []string) (map[string]time.Time, error) {
+	created := make(map[string]time.Time, len(documentIDs))
+	if len(documentIDs) == 0 {
+		return created, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(documentIDs)), ",")
+	args := make([]interface{}, 0, len(documentIDs)+1)
+	for _, id := range documentIDs {
+		args = append(args, id)
+	}
+	args = append(args, db.tenant)
+
+	rows, err := db.conn.Query(`SELECT id, CAST(strftime('%s', created_at) AS INTEGER) FROM documents
+		WHERE id IN (`+placeholders+`) AND tenant_id = ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up document creation times: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var unix int64
+		if err := rows.Scan(&id, &unix); err != nil {
+			return nil, fmt.Errorf("failed to scan document creation time: %w", err)
+		}
+		created[id] = time.Unix(unix, 0)
+	}
+	return created, rows.Err()
+}
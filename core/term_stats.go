@@ -0,0 +1,327 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+)
+
+// Term statistics count, per collection, the chunks in the keyword index and how many of them
+// contain each term, as the index stores it. They weigh query terms and keywords by how rare they
+// are in the collection, so words found everywhere in it count for little.
+
+// termStatsDelta collects changes to the term statistics of collections, keyed by collection name
+type termStatsDelta map[string]*termCounts
+
+// termCounts is the change in a collection's indexed chunks and in the chunks containing each term
+type termCounts struct {
+	chunks int
+	terms  map[string]int
+}
+
+// add counts an indexed chunk text in (sign 1) or out (sign -1) of a collection's statistics
+func (d termStatsDelta) add(collectionName, indexedText string, sign int) {
+	counts := d[collectionName]
+	if counts == nil {
+		counts = &termCounts{terms: make(map[string]int)}
+		d[collectionName] = counts
+	}
+	counts.chunks += sign
+	for term := range indexedTerms(indexedText) {
+		counts.terms[term] += sign
+	}
+}
+
+// indexedTerms returns the distinct terms of a text as stored in the keyword index. Words shorter
+// than two characters are left out, as keyword queries ignore them.
+func indexedTerms(indexedText string) map[string]bool {
+	terms := make(map[string]bool)
+	for _, word := range splitSearchWords(indexedText) {
+		if len(word) >= 2 {
+			terms[word] = true
+		}
+	}
+	return terms
+}
+
+// ensureTermStatsTables creates the term statistics tables, computing the statistics of the
+// chunks already indexed the first time
+func (db *VectorDB) ensureTermStatsTables() error {
+	var exists bool
+	err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type='table' AND name='collection_terms')`).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	statements := []string{`
+	CREATE TABLE collection_term_totals (
+		tenant_id TEXT NOT NULL,
+		collection_name TEXT NOT NULL,
+		chunk_count INTEGER NOT NULL, -- Chunks in the keyword index
+		PRIMARY KEY (tenant_id, collection_name)
+	)`, `
+	CREATE TABLE collection_terms (
+		tenant_id TEXT NOT NULL,
+		collection_name TEXT NOT NULL,
+		term TEXT NOT NULL, -- As stored in the keyword index: a word, or its keyed hash when encrypted
+		chunk_count INTEGER NOT NULL, -- Indexed chunks containing the term
+		PRIMARY KEY (tenant_id, collection_name, term)
+	) WITHOUT ROWID`}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	if err := rebuildTermStats(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rebuildTermStats recomputes the term statistics of every collection of every tenant from the
+// keyword index
+func rebuildTermStats(tx *sql.Tx) error {
+	if _, err := tx.Exec(`DELETE FROM collection_term_totals`); err != nil {
+		return fmt.Errorf("failed to clear term statistics: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM collection_terms`); err != nil {
+		return fmt.Errorf("failed to clear term statistics: %w", err)
+	}
+
+	rows, err := tx.Query(`SELECT c.tenant_id, f.collection_name, f.text
+		FROM chunk_fts f JOIN enhanced_chunks c ON c.id = f.chunk_id`)
+	if err != nil {
+		return fmt.Errorf("failed to read keyword index: %w", err)
+	}
+	defer rows.Close()
+	deltas := make(map[string]termStatsDelta)
+	chunks := 0
+	for rows.Next() {
+		var tenant, collectionName, text string
+		if err := rows.Scan(&tenant, &collectionName, &text); err != nil {
+			return fmt.Errorf("failed to read keyword index: %w", err)
+		}
+		if deltas[tenant] == nil {
+			deltas[tenant] = make(termStatsDelta)
+		}
+		deltas[tenant].add(collectionName, text, 1)
+		chunks++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read keyword index: %w", err)
+	}
+	rows.Close()
+
+	for tenant, delta := range deltas {
+		if err := (&VectorDB{tenant: tenant}).applyTermStats(tx, delta); err != nil {
+			return err
+		}
+	}
+	if chunks > 0 {
+		log.Printf("Computed term statistics of %d indexed chunks", chunks)
+	}
+	return nil
+}
+
+// applyTermStats adds a delta to the tenant's term statistics, dropping the terms no chunk
+// contains any more
+func (db *VectorDB) applyTermStats(tx *sql.Tx, delta termStatsDelta) error {
+	if len(delta) == 0 {
+		return nil
+	}
+	upsertTerm, err := tx.Prepare(`INSERT INTO collection_terms (tenant_id, collection_name, term, chunk_count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (tenant_id, collection_name, term) DO UPDATE SET chunk_count = chunk_count + excluded.chunk_count`)
+	if err != nil {
+		return fmt.Errorf("failed to update term statistics: %w", err)
+	}
+	defer upsertTerm.Close()
+
+	for collectionName, counts := range delta {
+		if _, err := tx.Exec(`INSERT INTO collection_term_totals (tenant_id, collection_name, chunk_count) VALUES (?, ?, ?)
+			ON CONFLICT (tenant_id, collection_name) DO UPDATE SET chunk_count = MAX(chunk_count + excluded.chunk_count, 0)`,
+			db.tenant, collectionName, counts.chunks); err != nil {
+			return fmt.Errorf("failed to update term statistics: %w", err)
+		}
+		removed := false
+		for term, change := range counts.terms {
+			if change == 0 {
+				continue
+			}
+			if _, err := upsertTerm.Exec(db.tenant, collectionName, term, change); err != nil {
+				return fmt.Errorf("failed to update term statistics: %w", err)
+			}
+			removed = removed || change < 0
+		}
+		if removed {
+			if _, err := tx.Exec(`DELETE FROM collection_terms WHERE tenant_id = ? AND collection_name = ? AND chunk_count <= 0`,
+				db.tenant, collectionName); err != nil {
+				return fmt.Errorf("failed to update term statistics: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// countIndexedChunks adds the keyword index entries of the chunks matching a condition on
+// enhanced_chunks to a delta, with the given sign. Entries leaving the index are counted out
+// before they are deleted.
+func (db *VectorDB) countIndexedChunks(tx *sql.Tx, delta termStatsDelta, sign int, condition string, args ...interface{}) error {
+	rows, err := tx.Query(`SELECT collection_name, text FROM chunk_fts
+		WHERE chunk_id IN (SELECT id FROM enhanced_chunks WHERE `+condition+`)`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to read keyword index: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var collectionName, text string
+		if err := rows.Scan(&collectionName, &text); err != nil {
+			return fmt.Errorf("failed to read keyword index: %w", err)
+		}
+		delta.add(collectionName, text, sign)
+	}
+	return rows.Err()
+}
+
+// dropTermStats deletes the term statistics of a collection whose chunks are all deleted
+func (db *VectorDB) dropTermStats(tx *sql.Tx, collectionName string) error {
+	for _, table := range []string{"collection_term_totals", "collection_terms"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE tenant_id = ? AND collection_name = ?`, db.tenant, collectionName); err != nil {
+			return fmt.Errorf("failed to delete term statistics: %w", err)
+		}
+	}
+	return nil
+}
+
+// TermFrequencies is how many of a collection's indexed chunks contain each of some terms
+type TermFrequencies struct {
+	Chunks int            // Chunks in the keyword index
+	Terms  map[string]int // Chunks containing each term, keyed by the word looked up
+}
+
+// IDF returns the inverse document frequency of a word in the form BM25 uses, kept positive: near
+// 0 for a word in every chunk, ln 2 for one in half of them. Words not looked up count as absent.
+func (f *TermFrequencies) IDF(word string) float64 {
+	n := float64(f.Chunks)
+	df := float64(f.Terms[word])
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// TermFrequencies looks up how many of a collection's indexed chunks contain each word
+func (db *VectorDB) TermFrequencies(collectionName string, words []string) (*TermFrequencies, error) {
+	frequencies := &TermFrequencies{Terms: make(map[string]int, len(words))}
+	err := db.conn.QueryRow(`SELECT chunk_count FROM collection_term_totals WHERE tenant_id = ? AND collection_name = ?`,
+		db.tenant, collectionName).Scan(&frequencies.Chunks)
+	if err == sql.ErrNoRows || len(words) == 0 {
+		return frequencies, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read term statistics: %w", err)
+	}
+
+	// Terms are stored as the keyword index stores them
+	byTerm := make(map[string][]string, len(words))
+	args := []interface{}{db.tenant, collectionName}
+	for _, word := range words {
+		term := indexTerm(word)
+		if _, ok := byTerm[term]; !ok {
+			args = append(args, term)
+		}
+		byTerm[term] = append(byTerm[term], word)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)-2), ",")
+	rows, err := db.conn.Query(`SELECT term, chunk_count FROM collection_terms
+		WHERE tenant_id = ? AND collection_name = ? AND term IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read term statistics: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var term string
+		var count int
+		if err := rows.Scan(&term, &count); err != nil {
+			return nil, fmt.Errorf("failed to read term statistics: %w", err)
+		}
+		for _, word := range byTerm[term] {
+			frequencies.Terms[word] = count
+		}
+	}
+	return frequencies, rows.Err()
+}
+
+// weightKeywords re-picks the keywords of a document's chunks by TF-IDF: how often a word occurs
+// in the chunk, weighed by how rare it is among the collection's indexed chunks and the
+// document's own. Chunks chunked without keyword extraction are left without keywords.
+func (r *RAGService) weightKeywords(collectionName string, doc *models.Document) error {
+	type chunkWords struct {
+		chunk  *models.EnhancedChunk
+		counts map[string]int
+	}
+	var chunks []chunkWords
+	inDocument := make(map[string]int)
+	for _, chunk := range doc.Chunks {
+		if len(chunk.Keywords) == 0 {
+			continue
+		}
+		language, _ := chunk.Metadata["language"].(string)
+		if language == "" {
+			language = defaultLanguage
+		}
+		counts := make(map[string]int)
+		for _, word := range keywordCandidates(chunk.Text, language) {
+			counts[word]++
+		}
+		for word := range counts {
+			inDocument[word]++
+		}
+		chunks = append(chunks, chunkWords{chunk: chunk, counts: counts})
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	words := make([]string, 0, len(inDocument))
+	for word := range inDocument {
+		words = append(words, word)
+	}
+	frequencies, err := r.vectorDB.TermFrequencies(collectionName, words)
+	if err != nil {
+		return err
+	}
+	frequencies.Chunks += len(chunks)
+	for word, count := range inDocument {
+		frequencies.Terms[word] += count
+	}
+
+	for _, c := range chunks {
+		type weighted struct {
+			word   string
+			weight float64
+		}
+		ranked := make([]weighted, 0, len(c.counts))
+		for word, count := range c.counts {
+			ranked = append(ranked, weighted{word, float64(count) * frequencies.IDF(word)})
+		}
+		sort.Slice(ranked, func(i, j int) bool {
+			if ranked[i].weight != ranked[j].weight {
+				return ranked[i].weight > ranked[j].weight
+			}
+			return ranked[i].word < ranked[j].word
+		})
+		keywords := make([]string, 0, maxKeywords)
+		for _, w := range ranked[:min(len(ranked), maxKeywords)] {
+			keywords = append(keywords, w.word)
+		}
+		c.chunk.Keywords = keywords
+	}
+	return nil
+}
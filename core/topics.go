@@ -0,0 +1,511 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"rag-go-app/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Topics are found by spherical k-means over the embeddings of a collection's passages: chunks are
+// assigned to the center they are most similar to by cosine, and each center is the normalized
+// mean of its chunks. Clusters are named by the chat model from the chunks nearest their center.
+
+const (
+	defaultTopicChunks    = 5000
+	defaultTopicExemplars = 3
+	maxTopicsByDefault    = 20
+	topicIterations       = 50 // Assignment rounds before k-means stops without converging
+	topicKeywordCount     = 5
+	topicSeed             = 1 // Seeds k-means++, so the same collection gives the same topics
+)
+
+// topicLabelPrompt asks the chat model to name the topic of a cluster of passages
+const topicLabelPrompt = `The passages below were grouped together as similar from a document collection. Name the topic they share in a short phrase of 2 to 5 words, specific enough to tell it apart from the other topics of the collection.
+
+Output only the topic name, without quotes or explanations.
+
+%s`
+
+// topicChunk is a passage being clustered
+type topicChunk struct {
+	id         string
+	documentID string
+	keywords   []string
+	embedding  []float32 // Normalized
+}
+
+// DiscoverTopics clusters the passages of a collection by their stored embeddings and describes
+// each cluster by its keywords, the chunks nearest its center and the documents with most chunks
+// in it. Collections larger than max_chunks are sampled evenly. The chat model labels the topics;
+// when it fails, topics are labeled by their keywords.
+func (r *RAGService) DiscoverTopics(ctx context.Context, collectionName string, req *models.TopicsRequest) (*models.TopicsResponse, error) {
+	start := time.Now()
+	maxChunks, exemplars := req.MaxChunks, req.Exemplars
+	if maxChunks <= 0 {
+		maxChunks = defaultTopicChunks
+	}
+	if exemplars <= 0 {
+		exemplars = defaultTopicExemplars
+	}
+
+	chunks, total, err := r.vectorDB.topicChunks(ctx, collectionName, maxChunks, req.Principal)
+	if err != nil {
+		return nil, err
+	}
+	resp := &models.TopicsResponse{CollectionName: collectionName, Topics: []models.Topic{}, ChunksClustered: len(chunks), ChunksTotal: total}
+	if len(chunks) == 0 {
+		resp.ProcessingTime = time.Since(start).Seconds()
+		return resp, nil
+	}
+
+	k := req.NumTopics
+	if k <= 0 {
+		k = max(2, min(maxTopicsByDefault, int(math.Round(math.Sqrt(float64(len(chunks))/2)))))
+	}
+	k = min(k, len(chunks))
+	centers, assignments, err := sphericalKMeans(ctx, chunks, k)
+	if err != nil {
+		return nil, err
+	}
+
+	topics, err := r.vectorDB.describeTopics(chunks, centers, assignments, exemplars)
+	if err != nil {
+		return nil, err
+	}
+	if req.SkipLabels {
+		for i := range topics {
+			topics[i].Label = keywordLabel(topics[i].Keywords)
+		}
+	} else if failed := r.labelTopics(ctx, topics); failed > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		resp.Degradations = append(resp.Degradations, DegradedKeywordLabels)
+	}
+
+	resp.Topics = topics
+	resp.ProcessingTime = time.Since(start).Seconds()
+	log.Printf("Found %d topics in %d chunks of collection '%s'", len(topics), len(chunks), collectionName)
+	return resp, nil
+}
+
+// topicChunks reads the passages of a collection the principal may see, up to limit of them
+// spread evenly over the collection, with their keywords and normalized embeddings. Parents,
+// summaries and generated questions restate other chunks, and duplicates share their original's
+// embedding, so they are left out. It also returns the number of passages before sampling.
+func (db *VectorDB) topicChunks(ctx context.Context, collectionName string, limit int, principal *models.Principal) ([]*topicChunk, int, error) {
+	if err := db.requireCollection(db.conn, collectionName); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT c.id, c.document_id, COALESCE(c.keywords, '[]') FROM enhanced_chunks c
+		WHERE c.collection_name = ? AND c.tenant_id = ? AND c.duplicate_of IS NULL AND c.chunk_type NOT IN (?, ?, ?)`
+	args := []interface{}{collectionName, db.tenant, parentChunkType, summaryChunkType, questionChunkType}
+	if principal != nil {
+		condition, principalArgs := aclCondition(principal)
+		query += " AND " + condition
+		args = append(args, principalArgs...)
+	}
+	rows, err := db.conn.QueryContext(ctx, query+" ORDER BY c.document_id, c.chunk_index", args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list chunks: %w", err)
+	}
+	var all []*topicChunk
+	for rows.Next() {
+		chunk := &topicChunk{}
+		var keywords string
+		if err := rows.Scan(&chunk.id, &chunk.documentID, &keywords); err != nil {
+			rows.Close()
+			return nil, 0, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		chunk.keywords = parseKeywords(keywords)
+		all = append(all, chunk)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list chunks: %w", err)
+	}
+
+	sample := all
+	if len(all) > limit {
+		sample = make([]*topicChunk, limit)
+		for i := range sample {
+			sample[i] = all[i*len(all)/limit]
+		}
+	}
+
+	var embedded []*topicChunk
+	for start := 0; start < len(sample); start += cacheLookupBatchSize {
+		batch := sample[start:min(start+cacheLookupBatchSize, len(sample))]
+		ids := make([]string, len(batch))
+		for i, chunk := range batch {
+			ids[i] = chunk.id
+		}
+		embeddings, err := db.GetChunkEmbeddings(ids)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, chunk := range batch {
+			if chunk.embedding = normalizedEmbedding(embeddings[chunk.id]); chunk.embedding != nil {
+				embedded = append(embedded, chunk)
+			}
+		}
+	}
+
+	// Embeddings of another dimension were stored before the collection was re-embedded
+	if len(embedded) > 0 {
+		dimension := len(embedded[len(embedded)-1].embedding)
+		kept := embedded[:0]
+		for _, chunk := range embedded {
+			if len(chunk.embedding) == dimension {
+				kept = append(kept, chunk)
+			}
+		}
+		embedded = kept
+	}
+	return embedded, len(all), nil
+}
+
+// parseKeywords reads a chunk's JSON array of keywords
+func parseKeywords(keywords string) []string {
+	var parsed []string
+	if keywords != "[]" {
+		json.Unmarshal([]byte(keywords), &parsed)
+	}
+	return parsed
+}
+
+// normalizedEmbedding returns a copy of an embedding scaled to unit length, or nil for an empty or
+// zero embedding
+func normalizedEmbedding(embedding []float32) []float32 {
+	var norm float64
+	for _, value := range embedding {
+		norm += float64(value) * float64(value)
+	}
+	if norm == 0 {
+		return nil
+	}
+	norm = math.Sqrt(norm)
+	normalized := make([]float32, len(embedding))
+	for i, value := range embedding {
+		normalized[i] = float32(float64(value) / norm)
+	}
+	return normalized
+}
+
+// dot returns the dot product of two vectors of the same dimension
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// sphericalKMeans clusters normalized embeddings into k clusters, returning the normalized center
+// of each cluster and the cluster of each chunk. Centers start from k-means++ seeding; a cluster
+// left empty restarts from the chunk least similar to its center.
+func sphericalKMeans(ctx context.Context, chunks []*topicChunk, k int) ([][]float32, []int, error) {
+	rng := rand.New(rand.NewSource(topicSeed))
+	centers := [][]float32{chunks[rng.Intn(len(chunks))].embedding}
+	distances := make([]float64, len(chunks))
+	for i := range distances {
+		distances[i] = math.Inf(1)
+	}
+	for len(centers) < k {
+		var sum float64
+		for i, chunk := range chunks {
+			distances[i] = math.Min(distances[i], 1-dot(chunk.embedding, centers[len(centers)-1]))
+			sum += distances[i] * distances[i]
+		}
+		next := len(chunks) - 1
+		if sum > 0 {
+			target := rng.Float64() * sum
+			for i, distance := range distances {
+				if target -= distance * distance; target <= 0 {
+					next = i
+					break
+				}
+			}
+		} else {
+			next = len(centers)
+		}
+		centers = append(centers, chunks[next].embedding)
+	}
+
+	assignments := make([]int, len(chunks))
+	for i := range assignments {
+		assignments[i] = -1
+	}
+	for iteration := 0; iteration < topicIterations; iteration++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		changed := false
+		similarities := make([]float64, len(chunks))
+		for i, chunk := range chunks {
+			best := 0
+			similarities[i] = dot(chunk.embedding, centers[0])
+			for c := 1; c < k; c++ {
+				if similarity := dot(chunk.embedding, centers[c]); similarity > similarities[i] {
+					best, similarities[i] = c, similarity
+				}
+			}
+			if assignments[i] != best {
+				assignments[i], changed = best, true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		sums := make([][]float64, k)
+		for c := range sums {
+			sums[c] = make([]float64, len(centers[c]))
+		}
+		counts := make([]int, k)
+		for i, chunk := range chunks {
+			counts[assignments[i]]++
+			for d, value := range chunk.embedding {
+				sums[assignments[i]][d] += float64(value)
+			}
+		}
+		for c := range centers {
+			if counts[c] == 0 {
+				farthest := 0
+				for i := range chunks {
+					if similarities[i] < similarities[farthest] {
+						farthest = i
+					}
+				}
+				centers[c] = chunks[farthest].embedding
+				similarities[farthest] = math.Inf(1)
+				continue
+			}
+			center := make([]float32, len(sums[c]))
+			for d, value := range sums[c] {
+				center[d] = float32(value)
+			}
+			if normalized := normalizedEmbedding(center); normalized != nil {
+				centers[c] = normalized
+			}
+		}
+	}
+	return centers, assignments, nil
+}
+
+// describeTopics builds the topics of the clusters, largest first, without labels: their
+// keywords, their documents with most chunks in them and their chunks nearest the center
+func (db *VectorDB) describeTopics(chunks []*topicChunk, centers [][]float32, assignments []int, exemplars int) ([]models.Topic, error) {
+	members := make([][]int, len(centers))
+	clusters := 0
+	for i, cluster := range assignments {
+		if len(members[cluster]) == 0 {
+			clusters++
+		}
+		members[cluster] = append(members[cluster], i)
+	}
+	keywordCounts, clusterFrequency := clusterKeywords(chunks, members)
+
+	var topics []models.Topic
+	var chunkIDs, documentIDs []string
+	for c, indexes := range members {
+		if len(indexes) == 0 {
+			continue
+		}
+		topic := models.Topic{ChunkCount: len(indexes), Share: float64(len(indexes)) / float64(len(chunks))}
+		topic.Keywords = distinctiveKeywords(keywordCounts[c], clusterFrequency, clusters)
+
+		// Nearest the center first, so documents with as many chunks in the topic are ordered by
+		// their nearest chunk
+		similarity := make(map[int]float64, len(indexes))
+		for _, i := range indexes {
+			similarity[i] = dot(chunks[i].embedding, centers[c])
+		}
+		sort.SliceStable(indexes, func(a, b int) bool { return similarity[indexes[a]] > similarity[indexes[b]] })
+
+		documentCounts := make(map[string]int)
+		var documents []string
+		for _, i := range indexes {
+			if documentCounts[chunks[i].documentID] == 0 {
+				documents = append(documents, chunks[i].documentID)
+			}
+			documentCounts[chunks[i].documentID]++
+		}
+		sort.SliceStable(documents, func(a, b int) bool { return documentCounts[documents[a]] > documentCounts[documents[b]] })
+		topic.DocumentCount = len(documents)
+		for _, id := range documents[:min(exemplars, len(documents))] {
+			topic.ExemplarDocuments = append(topic.ExemplarDocuments, models.TopicDocument{DocumentID: id, ChunkCount: documentCounts[id]})
+			documentIDs = append(documentIDs, id)
+		}
+
+		for _, i := range indexes[:min(exemplars, len(indexes))] {
+			topic.RepresentativeChunks = append(topic.RepresentativeChunks, models.TopicChunk{
+				ChunkID:    chunks[i].id,
+				DocumentID: chunks[i].documentID,
+				Similarity: similarity[i],
+			})
+			chunkIDs = append(chunkIDs, chunks[i].id)
+		}
+		topics = append(topics, topic)
+	}
+	sort.SliceStable(topics, func(i, j int) bool { return topics[i].ChunkCount > topics[j].ChunkCount })
+	for i := range topics {
+		topics[i].ID = i + 1
+	}
+
+	texts, err := db.chunkTexts(chunkIDs)
+	if err != nil {
+		return nil, err
+	}
+	textByID := make(map[string]string, len(texts))
+	for _, chunk := range texts {
+		textByID[chunk.ID] = chunk.Text
+	}
+	documents, err := db.topicDocuments(documentIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range topics {
+		for j := range topics[i].RepresentativeChunks {
+			topics[i].RepresentativeChunks[j].Text = textByID[topics[i].RepresentativeChunks[j].ChunkID]
+		}
+		for j := range topics[i].ExemplarDocuments {
+			document := documents[topics[i].ExemplarDocuments[j].DocumentID]
+			topics[i].ExemplarDocuments[j].Source, topics[i].ExemplarDocuments[j].Title = document.Source, document.Title
+		}
+	}
+	return topics, nil
+}
+
+// clusterKeywords counts the chunks of each cluster that have each keyword, and the clusters in
+// which each keyword occurs
+func clusterKeywords(chunks []*topicChunk, members [][]int) ([]map[string]int, map[string]int) {
+	counts := make([]map[string]int, len(members))
+	frequency := make(map[string]int)
+	for c, indexes := range members {
+		counts[c] = make(map[string]int)
+		for _, i := range indexes {
+			for _, keyword := range chunks[i].keywords {
+				counts[c][strings.ToLower(keyword)]++
+			}
+		}
+		for keyword := range counts[c] {
+			frequency[keyword]++
+		}
+	}
+	return counts, frequency
+}
+
+// distinctiveKeywords returns the keywords that best tell a cluster apart: frequent in it and in
+// few other clusters, weighted like TF-IDF with clusters as documents
+func distinctiveKeywords(counts, clusterFrequency map[string]int, clusters int) []string {
+	weights := make(map[string]float64, len(counts))
+	keywords := make([]string, 0, len(counts))
+	for keyword, count := range counts {
+		weights[keyword] = float64(count) * math.Log(1+float64(clusters)/float64(clusterFrequency[keyword]))
+		keywords = append(keywords, keyword)
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		if weights[keywords[i]] != weights[keywords[j]] {
+			return weights[keywords[i]] > weights[keywords[j]]
+		}
+		return keywords[i] < keywords[j]
+	})
+	return keywords[:min(topicKeywordCount, len(keywords))]
+}
+
+// topicDocuments returns the source and generated title of each given document, keyed by ID
+func (db *VectorDB) topicDocuments(documentIDs []string) (map[string]models.TopicDocument, error) {
+	documents := make(map[string]models.TopicDocument, len(documentIDs))
+	if len(documentIDs) == 0 {
+		return documents, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(documentIDs)), ",")
+	args := make([]interface{}, 0, len(documentIDs)+1)
+	for _, id := range documentIDs {
+		args = append(args, id)
+	}
+	args = append(args, db.tenant)
+
+	rows, err := db.conn.Query(`SELECT id, COALESCE(source, ''), COALESCE(json_extract(metadata, '$.title'), '')
+		FROM documents WHERE id IN (`+placeholders+`) AND tenant_id = ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up documents: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var document models.TopicDocument
+		if err := rows.Scan(&document.DocumentID, &document.Source, &document.Title); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		documents[document.DocumentID] = document
+	}
+	return documents, rows.Err()
+}
+
+// labelTopics asks the chat model to name each topic from its representative chunks, a few topics
+// at a time. Topics it fails to name are labeled by their keywords; it returns how many were.
+func (r *RAGService) labelTopics(ctx context.Context, topics []models.Topic) int {
+	failed := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, summaryWorkers)
+	for i := range topics {
+		wg.Add(1)
+		go func(topic *models.Topic) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			label, err := r.topicLabel(ctx, topic)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Labeling topic %d failed: %v", topic.ID, err)
+				}
+				label = keywordLabel(topic.Keywords)
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+			topic.Label = label
+		}(&topics[i])
+	}
+	wg.Wait()
+	return failed
+}
+
+// topicLabel asks the chat model for the name of a topic
+func (r *RAGService) topicLabel(ctx context.Context, topic *models.Topic) (string, error) {
+	chunks := make([]*models.EnhancedChunk, len(topic.RepresentativeChunks))
+	for i, chunk := range topic.RepresentativeChunks {
+		chunks[i] = &models.EnhancedChunk{Text: chunk.Text}
+	}
+	response, err := r.llmClient.GenerateResponse(ctx, fmt.Sprintf(topicLabelPrompt, r.prepareContext(chunks)))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(response, "\n") {
+		if label := strings.Trim(strings.TrimSpace(line), `"'*.`); label != "" {
+			return label, nil
+		}
+	}
+	return "", errors.New("no topic name in model response")
+}
+
+// keywordLabel names a topic by its most frequent keywords
+func keywordLabel(keywords []string) string {
+	if len(keywords) == 0 {
+		return "Untitled"
+	}
+	return strings.Join(keywords[:min(3, len(keywords))], ", ")
+}
@@ -0,0 +1,463 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"rag-go-app/config"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of spans, numbered as in OTLP
+const (
+	SpanKindInternal = 1
+	SpanKindServer   = 2 // Handles a request of a caller
+	SpanKindClient   = 3 // Waits on a request to another service, such as the model server
+)
+
+// Status codes of spans, numbered as in OTLP
+const (
+	spanStatusUnset = 0
+	spanStatusError = 2
+)
+
+const (
+	defaultTraceServiceName = "rag-go-app"
+	traceQueueSize          = 4096 // Ended spans waiting for export before new ones are dropped
+	traceBatchSize          = 512
+	traceExportInterval     = 5 * time.Second
+	traceExportTimeout      = 10 * time.Second
+	traceDrainTimeout       = 5 * time.Second // Time queued spans get to be exported on shutdown
+)
+
+// spanContext identifies a span within its trace, and carries whether the trace is exported
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+type spanContextKey struct{}
+
+// activeSpan is what a context carries: the span operations started with it nest under, and the
+// span itself when it is recorded here rather than by a remote caller
+type activeSpan struct {
+	sc   spanContext
+	span *Span
+}
+
+// Span is one timed operation of a trace. StartSpan returns a nil span when tracing is off or the
+// trace is not sampled; a nil span ignores every call, so callers need not check.
+type Span struct {
+	tracer *Tracer
+	sc     spanContext
+	parent [8]byte // Zero for the root span of a trace
+	name   string
+	kind   int
+	start  time.Time
+
+	mu         sync.Mutex
+	attributes map[string]interface{}
+	ended      bool
+}
+
+// Tracer exports ended spans to an OTLP/HTTP collector in batches, in the background. Spans are
+// dropped rather than blocking requests when the collector falls behind.
+type Tracer struct {
+	url         string
+	headers     map[string]string
+	serviceName string
+	threshold   uint64 // Root spans whose trace ID falls below it are sampled
+	client      *http.Client
+
+	mu     sync.RWMutex // Guards closed against sending into the closed queue
+	closed bool
+	queue  chan otlpSpan
+
+	exported atomic.Int64
+	dropped  atomic.Int64
+	wg       sync.WaitGroup
+}
+
+var tracer *Tracer
+
+// SetTracer installs the tracer spans are recorded with. Passing nil turns tracing off.
+func SetTracer(t *Tracer) {
+	tracer = t
+}
+
+// NewTracer validates the tracing settings and returns a tracer that has not been started, or nil
+// when tracing is disabled
+func NewTracer(cfg config.TracingConfig) (*Tracer, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	parsed, err := url.Parse(cfg.Endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("tracing.endpoint must be an http or https URL")
+	}
+	ratio := cfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultTraceServiceName
+	}
+
+	threshold := ^uint64(0)
+	if ratio < 1 {
+		threshold = uint64(math.Ldexp(ratio, 64))
+	}
+	return &Tracer{
+		url:         strings.TrimSuffix(cfg.Endpoint, "/") + "/v1/traces",
+		headers:     cfg.Headers,
+		serviceName: serviceName,
+		threshold:   threshold,
+		client:      &http.Client{Timeout: traceExportTimeout},
+		queue:       make(chan otlpSpan, traceQueueSize),
+	}, nil
+}
+
+// Start exports spans in the background until Stop is called
+func (t *Tracer) Start() {
+	t.wg.Add(1)
+	go t.run()
+	log.Printf("Exporting traces to %s", t.url)
+}
+
+// Stop exports the spans still queued, for a few seconds at most, and stops the exporter. Spans
+// ended afterwards are dropped.
+func (t *Tracer) Stop() {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	close(t.queue)
+	t.mu.Unlock()
+	t.wg.Wait()
+	if dropped := t.dropped.Load(); dropped > 0 {
+		log.Printf("Tracing stopped: %d spans exported, %d dropped", t.exported.Load(), dropped)
+	}
+}
+
+// run batches the queued spans and exports a batch once it is full or has waited long enough
+func (t *Tracer) run() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(traceExportInterval)
+	defer ticker.Stop()
+
+	var batch []otlpSpan
+	var drainDeadline time.Time
+	for {
+		select {
+		case span, ok := <-t.queue:
+			if !ok {
+				drainDeadline = time.Now().Add(traceDrainTimeout)
+				t.export(batch, drainDeadline)
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= traceBatchSize {
+				t.export(batch, drainDeadline)
+				batch = nil
+			}
+		case <-ticker.C:
+			t.export(batch, drainDeadline)
+			batch = nil
+		}
+	}
+}
+
+// export posts a batch of spans to the collector. A failed export is logged and the batch dropped,
+// since retrying would hold back the newer spans behind it.
+func (t *Tracer) export(batch []otlpSpan, deadline time.Time) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{otlpAttributeOf("service.name", t.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: defaultTraceServiceName},
+			Spans: batch,
+		}},
+	}}})
+	if err != nil {
+		log.Printf("Failed to encode spans: %v", err)
+		t.dropped.Add(int64(len(batch)))
+		return
+	}
+
+	if deadline.IsZero() {
+		deadline = time.Now().Add(traceExportTimeout)
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to export spans: %v", err)
+		t.dropped.Add(int64(len(batch)))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		log.Printf("Failed to export %d spans: %v", len(batch), err)
+		t.dropped.Add(int64(len(batch)))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		log.Printf("Failed to export %d spans: collector returned %d: %s", len(batch), resp.StatusCode, strings.TrimSpace(string(message)))
+		t.dropped.Add(int64(len(batch)))
+		return
+	}
+	t.exported.Add(int64(len(batch)))
+}
+
+// enqueue queues an ended span for export, or drops it when the queue is full or closed
+func (t *Tracer) enqueue(span otlpSpan) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		t.dropped.Add(1)
+		return
+	}
+	select {
+	case t.queue <- span:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// sampled decides whether a new trace is exported, from its ID, so every span of it agrees
+func (t *Tracer) sampled(traceID [16]byte) bool {
+	return t.threshold == ^uint64(0) || binary.BigEndian.Uint64(traceID[8:]) < t.threshold
+}
+
+// StartSpan starts a span nested under the span of ctx, or the root span of a new trace, and
+// returns a context carrying it. The span must be ended with End.
+func StartSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	t := tracer
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent, hasParent := ctx.Value(spanContextKey{}).(activeSpan)
+	sc := spanContext{spanID: newSpanID()}
+	if hasParent {
+		sc.traceID, sc.sampled = parent.sc.traceID, parent.sc.sampled
+	} else {
+		rand.Read(sc.traceID[:])
+		sc.sampled = t.sampled(sc.traceID)
+	}
+	if !sc.sampled {
+		// Spans started further down see the trace is not sampled and skip it too
+		return context.WithValue(ctx, spanContextKey{}, activeSpan{sc: sc}), nil
+	}
+
+	span := &Span{tracer: t, sc: sc, name: name, kind: kind, start: time.Now()}
+	if hasParent {
+		span.parent = parent.sc.spanID
+	}
+	return context.WithValue(ctx, spanContextKey{}, activeSpan{sc: sc, span: span}), span
+}
+
+// startSpan starts a span of an operation inside this server
+func startSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return StartSpan(ctx, name, SpanKindInternal)
+}
+
+// spanFromContext returns the span recorded by the operation running with ctx, or nil
+func spanFromContext(ctx context.Context) *Span {
+	active, _ := ctx.Value(spanContextKey{}).(activeSpan)
+	return active.span
+}
+
+// ContextWithTraceParent continues the trace of a W3C traceparent header, so spans started with
+// the returned context nest under the caller's span and follow its sampling decision. An empty or
+// malformed header leaves ctx as it is.
+func ContextWithTraceParent(ctx context.Context, traceparent string) context.Context {
+	if tracer == nil || traceparent == "" {
+		return ctx
+	}
+	// version-traceid-parentid-flags, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ctx
+	}
+	var sc spanContext
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil || sc.traceID == [16]byte{} {
+		return ctx
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil || sc.spanID == [8]byte{} {
+		return ctx
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return ctx
+	}
+	sc.sampled = flags&1 == 1
+	return context.WithValue(ctx, spanContextKey{}, activeSpan{sc: sc})
+}
+
+// newSpanID returns a random span ID
+func newSpanID() [8]byte {
+	var id [8]byte
+	rand.Read(id[:])
+	return id
+}
+
+// TraceID returns the hex ID of the span's trace, to look the trace up in the collector
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.sc.traceID[:])
+}
+
+// SetAttribute records a value describing the operation, such as a collection name or a count
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]interface{})
+	}
+	s.attributes[key] = value
+}
+
+// End ends the span and queues it for export. A non-nil err marks the operation as failed.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.sc.traceID[:]),
+		SpanID:            hex.EncodeToString(s.sc.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Status:            otlpStatus{Code: spanStatusUnset},
+	}
+	if s.parent != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for key, value := range s.attributes {
+		span.Attributes = append(span.Attributes, otlpAttributeOf(key, value))
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		span.Status = otlpStatus{Code: spanStatusError, Message: err.Error()}
+	}
+	s.tracer.enqueue(span)
+}
+
+// The OTLP/HTTP JSON encoding of spans; IDs are hex and 64-bit integers are strings
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// otlpAttributeOf encodes an attribute by the type of its value; other types are formatted as text
+func otlpAttributeOf(key string, value interface{}) otlpAttribute {
+	var v otlpValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
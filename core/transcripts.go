@@ -0,0 +1,448 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Transcript formats, also accepted as doc_type for content sent inline
+const (
+	TranscriptSRT      = "srt"
+	TranscriptVTT      = "vtt"
+	TranscriptWhisperX = "whisperx"
+
+	transcriptChunkType = "transcript"
+)
+
+// audioExtensions are the files sent to the transcription endpoint
+var audioExtensions = map[string]bool{
+	".mp3": true, ".mp4": true, ".mpeg": true, ".mpga": true, ".m4a": true,
+	".wav": true, ".webm": true, ".ogg": true, ".flac": true,
+}
+
+var (
+	cueTimingPattern = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})`)
+	vttVoicePattern  = regexp.MustCompile(`^<v(?:\.[^\s>]*)?\s+([^>]+)>`)
+	cueTagPattern    = regexp.MustCompile(`</?[a-zA-Z][^>]*>|\{\\[^}]*\}`)
+)
+
+// transcriptionClient has no timeout of its own; long recordings are bounded by the configured one
+var transcriptionClient = &http.Client{}
+
+// transcriptCue is one timed line of a transcript
+type transcriptCue struct {
+	Start   float64 `json:"start"` // Seconds from the beginning of the recording
+	End     float64 `json:"end"`
+	Text    string  `json:"text"`
+	Speaker string  `json:"speaker,omitempty"`
+}
+
+// isAudioFile reports whether a file is transcribed instead of read as text
+func isAudioFile(path string) bool {
+	return audioExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// transcriptFormat returns the transcript format of a document, or "" when it is not a transcript.
+// An explicit doc_type wins, then the file extension; JSON files and content are transcripts when
+// they hold WhisperX segments, and content starting with WEBVTT is VTT.
+func transcriptFormat(path, docType, content string) string {
+	switch strings.ToLower(docType) {
+	case TranscriptSRT, TranscriptVTT, TranscriptWhisperX:
+		return strings.ToLower(docType)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".srt":
+		return TranscriptSRT
+	case ".vtt":
+		return TranscriptVTT
+	}
+
+	trimmed := strings.TrimLeft(content, "\ufeff \t\r\n")
+	if strings.HasPrefix(trimmed, "WEBVTT") {
+		return TranscriptVTT
+	}
+	if strings.HasPrefix(trimmed, "{") {
+		if cues, err := parseWhisperX(trimmed); err == nil && len(cues) > 0 {
+			return TranscriptWhisperX
+		}
+	}
+	return ""
+}
+
+// parseTranscript reads the cues of an SRT, VTT or WhisperX JSON transcript
+func parseTranscript(format, content string) ([]transcriptCue, error) {
+	var cues []transcriptCue
+	var err error
+	switch format {
+	case TranscriptWhisperX:
+		cues, err = parseWhisperX(content)
+	case TranscriptSRT, TranscriptVTT:
+		cues, err = parseSubtitles(content)
+	default:
+		return nil, fmt.Errorf("unknown transcript format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s transcript: %w", format, err)
+	}
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("invalid %s transcript: no timed text found", format)
+	}
+	return cues, nil
+}
+
+// parseSubtitles reads SRT and VTT cues: an optional identifier line, a "start --> end" timing
+// line and the cue text up to the next blank line. VTT header, NOTE, STYLE and REGION blocks have
+// no timing line and are skipped; a VTT voice tag sets the cue's speaker.
+func parseSubtitles(content string) ([]transcriptCue, error) {
+	var cues []transcriptCue
+	var current *transcriptCue
+	var lines []string
+
+	flush := func() {
+		if current != nil {
+			current.Text = strings.TrimSpace(strings.Join(lines, " "))
+			if current.Text != "" {
+				cues = append(cues, *current)
+			}
+		}
+		current, lines = nil, nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			flush()
+			continue
+		}
+		if match := cueTimingPattern.FindStringSubmatch(line); match != nil {
+			flush()
+			start, err := parseCueTime(match[1])
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseCueTime(match[2])
+			if err != nil {
+				return nil, err
+			}
+			current = &transcriptCue{Start: start, End: end}
+			continue
+		}
+		if current == nil {
+			continue // Cue identifier, header or a block without timing
+		}
+		if voice := vttVoicePattern.FindStringSubmatch(line); voice != nil && current.Speaker == "" {
+			current.Speaker = strings.TrimSpace(voice[1])
+		}
+		if text := strings.TrimSpace(cueTagPattern.ReplaceAllString(line, "")); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return cues, nil
+}
+
+// parseCueTime parses "hh:mm:ss,mmm", "hh:mm:ss.mmm" or "mm:ss.mmm" into seconds
+func parseCueTime(value string) (float64, error) {
+	parts := strings.Split(strings.Replace(value, ",", ".", 1), ":")
+	var seconds float64
+	for _, part := range parts {
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		seconds = seconds*60 + number
+	}
+	return seconds, nil
+}
+
+// parseWhisperX reads the segments of WhisperX output, which is also the shape of the OpenAI
+// verbose_json transcription response
+func parseWhisperX(content string) ([]transcriptCue, error) {
+	var transcript struct {
+		Segments []transcriptCue `json:"segments"`
+	}
+	if err := json.Unmarshal([]byte(content), &transcript); err != nil {
+		return nil, err
+	}
+
+	cues := make([]transcriptCue, 0, len(transcript.Segments))
+	for _, segment := range transcript.Segments {
+		segment.Text = strings.TrimSpace(segment.Text)
+		if segment.Text == "" {
+			continue
+		}
+		if segment.End < segment.Start {
+			return nil, fmt.Errorf("segment ends at %.3fs before it starts at %.3fs", segment.End, segment.Start)
+		}
+		cues = append(cues, segment)
+	}
+	return cues, nil
+}
+
+// transcribeAudio sends an audio file to the Whisper-compatible endpoint and returns its segments
+func transcribeAudio(ctx context.Context, path string) ([]transcriptCue, error) {
+	settings := config.AppConfig.Transcription
+	if !settings.Enabled {
+		return nil, fmt.Errorf("transcription is disabled; enable it in the config to add audio files")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, err
+	}
+	form.WriteField("model", orDefault(settings.Model, "whisper-1"))
+	form.WriteField("response_format", "verbose_json")
+	form.WriteField("timestamp_granularities[]", "segment")
+	if settings.Language != "" {
+		form.WriteField("language", settings.Language)
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withStageTimeout(ctx, settings.TimeoutSeconds)
+	defer cancel()
+
+	baseURL := strings.TrimRight(orDefault(settings.BaseURL, config.AppConfig.LlamaCPPBaseURL), "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/audio/transcriptions", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if settings.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+settings.APIKey)
+	}
+
+	startTime := time.Now()
+	resp, err := transcriptionClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	response, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcription response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("transcription endpoint returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(response)))
+	}
+
+	cues, err := parseWhisperX(string(response))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode transcription response: %w", err)
+	}
+	if len(cues) == 0 {
+		// Servers without segment timestamps return the text and the recording's duration
+		var plain struct {
+			Text     string  `json:"text"`
+			Duration float64 `json:"duration"`
+		}
+		json.Unmarshal(response, &plain)
+		if text := strings.TrimSpace(plain.Text); text != "" {
+			cues = append(cues, transcriptCue{End: plain.Duration, Text: text})
+		}
+	}
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("transcription of %s returned no text", filepath.Base(path))
+	}
+
+	log.Printf("Transcribed %s into %d segments in %v", filepath.Base(path), len(cues), time.Since(startTime))
+	return cues, nil
+}
+
+// processTranscript packs consecutive cues into chunks of up to the configured size. Each chunk
+// records the time range it covers, so results can link into the recording, and starts every
+// speaker turn with the speaker's name.
+func processTranscript(cues []transcriptCue, source, format, docType string, chunkingConfig *models.ChunkingConfig) (*models.Document, error) {
+	limit, overlap, withKeywords := preferredChunkSize, 0, false
+	if chunkingConfig != nil {
+		if chunkingConfig.MaxChunkSize > 0 {
+			limit = chunkingConfig.MaxChunkSize
+		} else if chunkingConfig.FixedSize > 0 {
+			limit = chunkingConfig.FixedSize
+		}
+		overlap = min(chunkingConfig.Overlap, limit/2)
+		withKeywords = chunkingConfig.ExtractKeywords
+	}
+
+	// The document text is every cue in order, a line per speaker turn
+	var content strings.Builder
+	offsets := make([][2]int, len(cues)) // Rune range of each cue in content
+	runes := 0
+	for i, cue := range cues {
+		separator := " "
+		if i == 0 {
+			separator = ""
+		} else if cue.Speaker != cues[i-1].Speaker {
+			separator = "\n"
+		}
+		text := cue.Text
+		if cue.Speaker != "" && (i == 0 || cue.Speaker != cues[i-1].Speaker) {
+			text = cue.Speaker + ": " + text
+		}
+		content.WriteString(separator)
+		runes += utf8.RuneCountInString(separator)
+		offsets[i][0] = runes
+		content.WriteString(text)
+		runes += utf8.RuneCountInString(text)
+		offsets[i][1] = runes
+	}
+
+	characteristics := analyzeDocument(content.String())
+	doc := &models.Document{
+		ID:      uuid.New().String(),
+		Content: content.String(),
+		Source:  source,
+		DocType: docType,
+		Metadata: map[string]interface{}{
+			"chunking_strategy": transcriptChunkType,
+			"document_length":   characteristics.Length,
+			"document_category": string(characteristics.Category),
+			"source_format":     format,
+			"language":          characteristics.Language,
+			"duration":          roundSeconds(cues[len(cues)-1].End),
+			"chunk_count":       0, // Will be updated after chunking
+		},
+	}
+	if speakers := cueSpeakers(cues); len(speakers) > 0 {
+		doc.Metadata["speakers"] = speakers
+	}
+
+	var chunks []*models.EnhancedChunk
+	for first := 0; first < len(cues); {
+		// Take cues until the next one would overflow the chunk; a single long cue stays whole
+		last, size := first, 0
+		for last < len(cues) {
+			length := utf8.RuneCountInString(cues[last].Text) + len(cues[last].Speaker) + 3
+			if last > first && size+length > limit {
+				break
+			}
+			size += length
+			last++
+		}
+		chunks = append(chunks, newTranscriptChunk(cues[first:last], offsets[first][0], offsets[last-1][1], doc.ID, len(chunks), withKeywords))
+		if last == len(cues) {
+			break
+		}
+
+		// Repeat trailing cues up to the overlap, always moving forward
+		next := last
+		for carried := 0; next-1 > first; next-- {
+			carried += utf8.RuneCountInString(cues[next-1].Text)
+			if carried > overlap {
+				break
+			}
+		}
+		first = next
+	}
+
+	tagChunkLanguages(chunks, characteristics.Language, withKeywords)
+	tagChunkEntities(chunks)
+	doc.Chunks = chunks
+	doc.Metadata["chunk_count"] = len(chunks)
+
+	log.Printf("Transcript processed: %d cues, %d chunks, %s long", len(cues), len(chunks), formatTimestamp(cues[len(cues)-1].End))
+	return doc, nil
+}
+
+// newTranscriptChunk builds the chunk of a run of cues
+func newTranscriptChunk(cues []transcriptCue, startPos, endPos int, docID string, index int, withKeywords bool) *models.EnhancedChunk {
+	var text strings.Builder
+	for i, cue := range cues {
+		newTurn := cue.Speaker != "" && (i == 0 || cue.Speaker != cues[i-1].Speaker)
+		switch {
+		case i == 0:
+		case cue.Speaker != cues[i-1].Speaker:
+			text.WriteString("\n")
+		default:
+			text.WriteString(" ")
+		}
+		if newTurn {
+			text.WriteString(cue.Speaker + ": ")
+		}
+		text.WriteString(cue.Text)
+	}
+
+	start, end := cues[0].Start, cues[len(cues)-1].End
+	chunk := &models.EnhancedChunk{
+		ID:         uuid.New().String(),
+		DocumentID: docID,
+		Text:       text.String(),
+		ChunkType:  transcriptChunkType,
+		Section:    formatTimestamp(start) + " - " + formatTimestamp(end),
+		StartPos:   startPos,
+		EndPos:     endPos,
+		ChunkIndex: index,
+		Metadata: map[string]interface{}{
+			"start_time": roundSeconds(start),
+			"end_time":   roundSeconds(end),
+		},
+	}
+	if speakers := cueSpeakers(cues); len(speakers) > 0 {
+		chunk.Metadata["speakers"] = speakers
+	}
+	if withKeywords {
+		chunk.Keywords = extractKeywords(chunk.Text)
+	}
+	return chunk
+}
+
+// cueSpeakers lists the speakers of the cues in order of first appearance
+func cueSpeakers(cues []transcriptCue) []string {
+	var speakers []string
+	seen := make(map[string]bool)
+	for _, cue := range cues {
+		if cue.Speaker != "" && !seen[cue.Speaker] {
+			seen[cue.Speaker] = true
+			speakers = append(speakers, cue.Speaker)
+		}
+	}
+	return speakers
+}
+
+// formatTimestamp formats seconds as hh:mm:ss
+func formatTimestamp(seconds float64) string {
+	total := int(seconds)
+	return fmt.Sprintf("%02d:%02d:%02d", total/3600, total/60%60, total%60)
+}
+
+// roundSeconds keeps millisecond precision
+func roundSeconds(seconds float64) float64 {
+	return math.Round(seconds*1000) / 1000
+}
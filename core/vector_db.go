@@ -1,32 +1,59 @@
 package core
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"rag-go-app/config"
 	"rag-go-app/models"
-	"strconv"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// DefaultTenant owns all data when multi-tenancy is disabled, including rows created before tenants existed
+const DefaultTenant = "default"
+
+// VectorDB is a handle on the database scoped to one tenant. Every query only sees that tenant's
+// collections, documents and chunks; use ForTenant to obtain a handle for another tenant.
 type VectorDB struct {
-	conn *sql.DB
+	conn   *sql.DB
+	tenant string
 }
 
 func NewVectorDB(dbPath string) (*VectorDB, error) {
 	// Load the sqlite-vec extension
 	sqlite_vec.Auto()
 
-	conn, err := sql.Open("sqlite3", dbPath)
+	if err := configureEncryption(config.AppConfig.Encryption); err != nil {
+		return nil, err
+	}
+	if encryption.mode == EncryptionSQLCipher {
+		path, _, _ := strings.Cut(strings.TrimPrefix(dbPath, "file:"), "?")
+		if err := prepareSQLCipherDatabase(path); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := sql.Open(sqliteDriver, sqliteDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	db := &VectorDB{conn: conn}
+	db := &VectorDB{conn: conn, tenant: DefaultTenant}
+	if encryption.mode == EncryptionSQLCipher {
+		if err := db.checkSQLCipher(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Verify sqlite-vec is loaded
 	var version string
@@ -43,17 +70,53 @@ func NewVectorDB(dbPath string) (*VectorDB, error) {
 	return db, nil
 }
 
+// sqliteDSN enables write-ahead logging, so searches and embedding cache lookups keep working
+// while ingestion holds its write transaction open, and makes other writers wait for it. With
+// column encryption, deleted content is overwritten rather than left in free pages. Foreign keys
+// are enforced, so deleting a collection or document cascades to its documents and chunks.
+func sqliteDSN(dbPath string) string {
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	params := "_busy_timeout=60000&_foreign_keys=on"
+	switch encryption.mode {
+	case EncryptionColumns:
+		params += "&_journal_mode=WAL&_secure_delete=true"
+	case EncryptionSQLCipher:
+		// connectHook enables write-ahead logging once the key is applied
+	default:
+		params += "&_journal_mode=WAL"
+	}
+	return dbPath + separator + params
+}
+
+// ForTenant returns a handle sharing this connection but scoped to the given tenant
+func (db *VectorDB) ForTenant(tenant string) *VectorDB {
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	return &VectorDB{conn: db.conn, tenant: tenant}
+}
+
+// Tenant returns the tenant this handle is scoped to
+func (db *VectorDB) Tenant() string {
+	return db.tenant
+}
+
 func (db *VectorDB) createTables() error {
-	// Enhanced collections table with metadata support
+	// Enhanced collections table with metadata support. Each tenant names its collections on its own.
 	collectionsSQL := `
 	CREATE TABLE IF NOT EXISTS collections (
-		name TEXT PRIMARY KEY,
+		tenant_id TEXT NOT NULL DEFAULT '` + DefaultTenant + `',
+		name TEXT NOT NULL,
 		description TEXT,
 		embedding_model TEXT DEFAULT 'nomic-embed-text-v1.5',
 		embedding_dimension INTEGER DEFAULT 1024,
 		metadata TEXT, -- JSON metadata
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (tenant_id, name)
 	);`
 
 	// Enhanced documents table with document-level metadata
@@ -61,6 +124,7 @@ func (db *VectorDB) createTables() error {
 	CREATE TABLE IF NOT EXISTS documents (
 		id TEXT PRIMARY KEY,
 		collection_name TEXT NOT NULL,
+		tenant_id TEXT NOT NULL DEFAULT '` + DefaultTenant + `',
 		content TEXT NOT NULL,
 		source TEXT,
 		doc_type TEXT,
@@ -68,7 +132,7 @@ func (db *VectorDB) createTables() error {
 		chunk_count INTEGER DEFAULT 0,
 		chunking_strategy TEXT,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (collection_name) REFERENCES collections(name) ON DELETE CASCADE
+		FOREIGN KEY (tenant_id, collection_name) REFERENCES collections(tenant_id, name) ON DELETE CASCADE
 	);`
 
 	// Enhanced chunks table with hierarchical and metadata support
@@ -77,6 +141,7 @@ func (db *VectorDB) createTables() error {
 		id TEXT PRIMARY KEY,
 		document_id TEXT NOT NULL,
 		collection_name TEXT NOT NULL,
+		tenant_id TEXT NOT NULL DEFAULT '` + DefaultTenant + `',
 		text TEXT NOT NULL,
 		
 		-- Hierarchical information
@@ -101,12 +166,124 @@ func (db *VectorDB) createTables() error {
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		
 		FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE,
-		FOREIGN KEY (collection_name) REFERENCES collections(name) ON DELETE CASCADE,
+		FOREIGN KEY (tenant_id, collection_name) REFERENCES collections(tenant_id, name) ON DELETE CASCADE,
 		FOREIGN KEY (parent_chunk_id) REFERENCES enhanced_chunks(id) ON DELETE SET NULL
 	);`
 
-	// NOTE: We'll create the embeddings table dynamically when we know the actual dimension
-	// This is more flexible than hardcoding 768 or 1024
+	// Embedding cache keyed by sha256(text + model)
+	embeddingCacheSQL := `
+	CREATE TABLE IF NOT EXISTS embedding_cache (
+		hash TEXT PRIMARY KEY,
+		model TEXT NOT NULL,
+		dimension INTEGER NOT NULL,
+		embedding BLOB NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Dimension of each embedding model's embeddings, found by embedding a test text
+	embeddingModelsSQL := `
+	CREATE TABLE IF NOT EXISTS embedding_models (
+		model TEXT PRIMARY KEY,
+		dimension INTEGER NOT NULL,
+		probed_at DATETIME NOT NULL
+	);`
+
+	// Knowledge graph extracted from chunks by the chat model. Entities are linked across chunks
+	// by normalized name, so each row of entities is one mention of an entity in a chunk.
+	entitiesSQL := `
+	CREATE TABLE IF NOT EXISTS entities (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chunk_id TEXT NOT NULL,
+		collection_name TEXT NOT NULL,
+		tenant_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		normalized_name TEXT NOT NULL,
+		entity_type TEXT
+	);`
+	relationsSQL := `
+	CREATE TABLE IF NOT EXISTS relations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chunk_id TEXT NOT NULL, -- Chunk the relation was stated in
+		collection_name TEXT NOT NULL,
+		tenant_id TEXT NOT NULL,
+		source_name TEXT NOT NULL, -- Normalized entity names
+		relation TEXT NOT NULL,
+		target_name TEXT NOT NULL
+	);`
+
+	// One row per query, search and proxied chat, for the query analytics endpoint
+	queryLogSQL := `
+	CREATE TABLE IF NOT EXISTS query_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id TEXT NOT NULL,
+		collection_name TEXT NOT NULL,
+		endpoint TEXT NOT NULL, -- query, search or chat
+		query TEXT NOT NULL,
+		normalized_query TEXT NOT NULL, -- Lowercased with whitespace collapsed, so repeats group together
+		chunk_ids TEXT NOT NULL, -- JSON array of the chunks returned, best first
+		document_ids TEXT NOT NULL, -- JSON array of the distinct documents of those chunks
+		result_count INTEGER NOT NULL,
+		not_found BOOLEAN NOT NULL, -- Nothing was found, or the answer said the context didn't cover the question
+		retrieval_ms REAL NOT NULL,
+		generation_ms REAL NOT NULL,
+		total_ms REAL NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// ETag of each object ingested from an S3 bucket, so unchanged objects are not downloaded again
+	s3ObjectsSQL := `
+	CREATE TABLE IF NOT EXISTS s3_objects (
+		tenant_id TEXT NOT NULL,
+		collection_name TEXT NOT NULL,
+		source TEXT NOT NULL, -- s3://bucket/key
+		etag TEXT NOT NULL,
+		document_id TEXT NOT NULL, -- Document ingested from this version of the object
+		PRIMARY KEY (tenant_id, collection_name, source)
+	);`
+
+	// Server-wide settings kept with the data, such as the key the keyword index is built with
+	settingsSQL := `
+	CREATE TABLE IF NOT EXISTS settings (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`
+
+	// Roles granted to API keys and JWT identities, across tenants
+	roleAssignmentsSQL := `
+	CREATE TABLE IF NOT EXISTS role_assignments (
+		kind TEXT NOT NULL, -- api_key, user or claim
+		subject TEXT NOT NULL, -- SHA-256 of an API key, a JWT subject or a JWT claim value
+		role TEXT NOT NULL, -- reader, writer or admin
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (kind, subject)
+	);`
+
+	// Append-only record of every create, update and delete, for compliance evidence; the triggers
+	// refuse changes to entries once written
+	auditLogSQL := []string{`
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		tenant_id TEXT NOT NULL,
+		actor_kind TEXT NOT NULL, -- api_key, user, anonymous or system
+		actor TEXT NOT NULL, -- SHA-256 of an API key, a JWT user or the system component
+		client_ip TEXT NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL, -- Route pattern
+		action TEXT NOT NULL, -- e.g. collection.create or document.delete
+		collection_name TEXT NOT NULL,
+		resource_id TEXT NOT NULL,
+		status INTEGER NOT NULL, -- HTTP status, 0 for system actions
+		details TEXT -- JSON object
+	);`,
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;`,
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;`,
+	}
+
+	// Embedding tables are created per dimension once embeddings of that dimension are stored;
+	// see embedding_tables.go
 
 	// Indexes for better performance
 	indexesSQL := []string{
@@ -117,15 +294,57 @@ func (db *VectorDB) createTables() error {
 		`CREATE INDEX IF NOT EXISTS idx_chunks_parent ON enhanced_chunks(parent_chunk_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_documents_collection ON documents(collection_name);`,
 		`CREATE INDEX IF NOT EXISTS idx_documents_type ON documents(doc_type);`,
+		`CREATE INDEX IF NOT EXISTS idx_collections_tenant ON collections(tenant_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_tenant ON documents(tenant_id, collection_name);`,
+		`CREATE INDEX IF NOT EXISTS idx_chunks_tenant ON enhanced_chunks(tenant_id, collection_name);`,
+		`CREATE INDEX IF NOT EXISTS idx_chunks_hash ON enhanced_chunks(collection_name, content_hash);`,
+		`CREATE INDEX IF NOT EXISTS idx_chunks_duplicate ON enhanced_chunks(duplicate_of);`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_source ON documents(collection_name, source);`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_expires ON documents(expires_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_entities_name ON entities(tenant_id, collection_name, normalized_name);`,
+		`CREATE INDEX IF NOT EXISTS idx_entities_chunk ON entities(chunk_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_relations_source ON relations(tenant_id, collection_name, source_name);`,
+		`CREATE INDEX IF NOT EXISTS idx_relations_target ON relations(tenant_id, collection_name, target_name);`,
+		`CREATE INDEX IF NOT EXISTS idx_relations_chunk ON relations(chunk_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_query_log_tenant ON query_log(tenant_id, collection_name, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_query_log_created ON query_log(created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_tenant ON audit_log(tenant_id, action);`,
 	}
 
 	// Execute table creation (excluding embeddings table for now)
-	for _, sql := range []string{collectionsSQL, documentsSQL, chunksSQL} {
+	tablesSQL := []string{collectionsSQL, documentsSQL, chunksSQL, embeddingCacheSQL, embeddingModelsSQL, entitiesSQL, relationsSQL, queryLogSQL, s3ObjectsSQL, settingsSQL, roleAssignmentsSQL}
+	for _, sql := range append(tablesSQL, auditLogSQL...) {
 		if _, err := db.conn.Exec(sql); err != nil {
 			return fmt.Errorf("failed to create table: %w", err)
 		}
 	}
 
+	// Add columns introduced after the initial schema
+	columnMigrations := []struct{ table, column, definition string }{
+		{"enhanced_chunks", "revision", "INTEGER DEFAULT 0"},
+		{"enhanced_chunks", "updated_at", "DATETIME"},
+		{"collections", "tenant_id", "TEXT NOT NULL DEFAULT '" + DefaultTenant + "'"},
+		{"documents", "tenant_id", "TEXT NOT NULL DEFAULT '" + DefaultTenant + "'"},
+		{"enhanced_chunks", "tenant_id", "TEXT NOT NULL DEFAULT '" + DefaultTenant + "'"},
+		{"documents", "content_hash", "TEXT"},
+		{"enhanced_chunks", "content_hash", "TEXT"},
+		{"enhanced_chunks", "duplicate_of", "TEXT"},
+		{"documents", "acl", "TEXT"},            // JSON DocumentACL, NULL when everyone may see the document
+		{"documents", "expires_at", "DATETIME"}, // NULL when the document never expires
+		{"query_log", "user_id", "TEXT"},        // User of the query's principal, NULL without one
+		{"documents", "char_count", "INTEGER"},  // Characters of the content, for quotas; NULL for older documents
+		{"documents", "embedding", "BLOB"},      // Mean of the chunk embeddings, NULL until computed
+	}
+	for _, m := range columnMigrations {
+		if err := db.addColumnIfMissing(m.table, m.column, m.definition); err != nil {
+			return fmt.Errorf("failed to migrate %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	if err := db.migrateCollectionKey(); err != nil {
+		return fmt.Errorf("failed to key collections by tenant: %w", err)
+	}
+
 	// Execute index creation
 	for _, sql := range indexesSQL {
 		if _, err := db.conn.Exec(sql); err != nil {
@@ -133,76 +352,264 @@ func (db *VectorDB) createTables() error {
 		}
 	}
 
+	if err := db.ensureFTSTableExists(); err != nil {
+		return fmt.Errorf("failed to create full-text index: %w", err)
+	}
+	if err := db.ensureTermStatsTables(); err != nil {
+		return fmt.Errorf("failed to create term statistics: %w", err)
+	}
+	if err := db.syncKeywordIndex(); err != nil {
+		return fmt.Errorf("failed to update full-text index: %w", err)
+	}
+	if err := db.migrateEmbeddingTables(); err != nil {
+		return fmt.Errorf("failed to migrate embedding tables: %w", err)
+	}
+
 	return nil
 }
 
-// ensureEmbeddingTableExists creates or recreates the embedding table with the correct dimension
-func (db *VectorDB) ensureEmbeddingTableExists(dimension int) error {
-	// Check if the table exists and has the right dimension
-	var existingDim int
-	var tableExists bool
+// addColumnIfMissing adds a column to an existing table when upgrading older databases
+func (db *VectorDB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.conn.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-	// Try to get the current dimension from an existing table
-	err := db.conn.QueryRow(`
-		SELECT 1 FROM sqlite_master 
-		WHERE type='table' AND name='chunk_embeddings'
-	`).Scan(&existingDim)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	rows.Close()
 
-	if err == nil {
-		tableExists = true
-		// Try to determine the current dimension by checking the schema
-		// This is a bit tricky with sqlite-vec, so we'll use a different approach
-
-		// Test with a dummy embedding to see if it works
-		testEmbedding := make([]string, dimension)
-		for i := range testEmbedding {
-			testEmbedding[i] = "0.0"
-		}
-		testEmbeddingStr := "[" + strings.Join(testEmbedding, ",") + "]"
-
-		// Try to insert a test embedding
-		_, testErr := db.conn.Exec(`INSERT OR REPLACE INTO chunk_embeddings (chunk_id, embedding) VALUES (?, ?)`,
-			"test_dimension_check", testEmbeddingStr)
-
-		if testErr != nil && strings.Contains(testErr.Error(), "Dimension mismatch") {
-			log.Printf("Detected dimension mismatch, recreating embedding table for %d dimensions", dimension)
-			// Drop the existing table
-			if _, err := db.conn.Exec(`DROP TABLE IF EXISTS chunk_embeddings`); err != nil {
-				return fmt.Errorf("failed to drop existing embedding table: %w", err)
+	_, err = db.conn.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
+// collectionKeyTables are rebuilt, in this order, when collections are keyed by tenant and name
+var collectionKeyTables = []string{"collections", "documents", "enhanced_chunks"}
+
+// migrateCollectionKey rebuilds the tables of databases whose collection names were unique across
+// tenants, so collections are keyed by tenant and name, and documents and chunks refer to them by
+// both. SQLite can't change a primary key in place: each table is copied into one created from its
+// schema with the new keys, with foreign keys off on a dedicated connection meanwhile.
+func (db *VectorDB) migrateCollectionKey() error {
+	var keyColumns int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('collections') WHERE pk > 0`).Scan(&keyColumns); err != nil {
+		return err
+	}
+	if keyColumns != 1 {
+		return nil
+	}
+
+	ctx := context.Background()
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The schema each table was created with, changed columns included, gets the new keys
+	foreignKey := [2]string{"FOREIGN KEY (collection_name) REFERENCES collections(name)", "FOREIGN KEY (tenant_id, collection_name) REFERENCES collections(tenant_id, name)"}
+	rekey := map[string][2]string{
+		"collections":     {"name TEXT PRIMARY KEY", "name TEXT NOT NULL"},
+		"documents":       foreignKey,
+		"enhanced_chunks": foreignKey,
+	}
+	for _, table := range collectionKeyTables {
+		var tableSQL string
+		if err := tx.QueryRow(`SELECT sql FROM sqlite_master WHERE type='table' AND name=?`, table).Scan(&tableSQL); err != nil {
+			return fmt.Errorf("failed to read %s schema: %w", table, err)
+		}
+		change := rekey[table]
+		if !strings.Contains(tableSQL, change[0]) {
+			return fmt.Errorf("unexpected %s schema: %s", table, tableSQL)
+		}
+		tableSQL = strings.Replace(tableSQL, change[0], change[1], 1)
+		if table == "collections" {
+			end := strings.LastIndex(tableSQL, ")")
+			tableSQL = tableSQL[:end] + ", PRIMARY KEY (tenant_id, name))"
+		}
+		tableSQL = "CREATE TABLE " + table + "_rekeyed " + tableSQL[strings.Index(tableSQL, "("):]
+
+		statements := []string{tableSQL, `INSERT INTO ` + table + `_rekeyed SELECT * FROM ` + table}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("failed to copy %s: %w", table, err)
 			}
-			tableExists = false
-		} else if testErr == nil {
-			// Clean up test record
-			db.conn.Exec(`DELETE FROM chunk_embeddings WHERE chunk_id = 'test_dimension_check'`)
-			log.Printf("Embedding table already exists with correct dimension (%d)", dimension)
-			return nil
+		}
+	}
+	for _, table := range collectionKeyTables {
+		if _, err := tx.Exec(`DROP TABLE ` + table); err != nil {
+			return fmt.Errorf("failed to drop %s: %w", table, err)
+		}
+		if _, err := tx.Exec(`ALTER TABLE ` + table + `_rekeyed RENAME TO ` + table); err != nil {
+			return fmt.Errorf("failed to rename %s: %w", table, err)
 		}
 	}
 
-	if !tableExists {
-		// Create the embedding table with the correct dimension
-		embeddingsSQL := fmt.Sprintf(`
-		CREATE VIRTUAL TABLE IF NOT EXISTS chunk_embeddings USING vec0(
-			chunk_id TEXT PRIMARY KEY,
-			embedding FLOAT[%d]
-		)`, dimension)
+	var violations int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_foreign_key_check`).Scan(&violations); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Keyed collections by tenant and name")
+	if violations > 0 {
+		log.Printf("Warning: %d rows refer to missing collections, documents or chunks", violations)
+	}
+	return nil
+}
 
-		if _, err := db.conn.Exec(embeddingsSQL); err != nil {
-			return fmt.Errorf("failed to create embedding table with dimension %d: %w", dimension, err)
+// ensureFTSTableExists creates the full-text index used for lexical search, and the view of its
+// vocabulary that fuzzy keyword matching looks up. Existing chunks are indexed the first time the
+// index is created.
+func (db *VectorDB) ensureFTSTableExists() error {
+	var exists bool
+	err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type='table' AND name='chunk_fts')`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := db.createFTSTable(); err != nil {
+			return err
 		}
+	}
+
+	_, err = db.conn.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS chunk_fts_terms USING fts4aux(chunk_fts)`)
+	return err
+}
+
+// createFTSTable creates the full-text index and indexes the chunks already stored
+func (db *VectorDB) createFTSTable() error {
 
-		log.Printf("Created embedding table with %d dimensions", dimension)
+	ftsSQL := `
+	CREATE VIRTUAL TABLE chunk_fts USING fts4(
+		chunk_id, collection_name, text,
+		notindexed=chunk_id, notindexed=collection_name
+	)`
+	if _, err := db.conn.Exec(ftsSQL); err != nil {
+		return err
+	}
+
+	result, err := db.conn.Exec(`INSERT INTO chunk_fts (chunk_id, collection_name, text)
+		SELECT id, collection_name, rag_index(text) FROM enhanced_chunks`)
+	if err != nil {
+		return fmt.Errorf("failed to index existing chunks: %w", err)
+	}
+	if indexed, _ := result.RowsAffected(); indexed > 0 {
+		log.Printf("Indexed %d existing chunks for full-text search", indexed)
 	}
 
 	return nil
 }
 
-func (db *VectorDB) CreateCollection(name, description string) error {
-	sql := `INSERT OR IGNORE INTO collections (name, description) VALUES (?, ?)`
-	_, err := db.conn.Exec(sql, name, description)
+// EmbeddingDimensionError reports embeddings whose dimension differs from that of the embeddings a
+// collection holds, typically after embedding_model was switched. The collection must be
+// re-embedded with the new model before embeddings of the new dimension can be added to it.
+type EmbeddingDimensionError struct {
+	Collection string
+	Stored     int // Dimension of the collection's embeddings
+	Got        int // Dimension of the new embeddings
+}
+
+func (e *EmbeddingDimensionError) Error() string {
+	return fmt.Sprintf("embedding dimension mismatch: the embeddings of collection '%s' have %d dimensions, but the embedding model returned %d; "+
+		"re-embed the collection with the new model first (POST /api/v1/collections/:name/reembed, or run with -reembed-all)",
+		e.Collection, e.Stored, e.Got)
+}
+
+// embeddingDimensionPattern reads the dimension of a float32 embedding table from its schema
+var embeddingDimensionPattern = regexp.MustCompile(`(?i)FLOAT\[(\d+)\]`)
+
+// CreateCollection creates a collection with optional defaults and quantization; an existing
+// collection is left unchanged
+func (db *VectorDB) CreateCollection(name, description string, defaults *models.CollectionDefaults, quantization *models.QuantizationConfig) error {
+	metadata, err := encodeCollectionMetadata(defaults, quantization)
+	if err != nil {
+		return err
+	}
+
+	// The embedding dimension is recorded once embeddings are stored
+	sql := `INSERT OR IGNORE INTO collections (name, description, tenant_id, metadata, embedding_dimension) VALUES (?, ?, ?, ?, NULL)`
+	result, err := db.conn.Exec(sql, name, description, db.tenant, metadata)
 	if err != nil {
 		return fmt.Errorf("failed to create collection: %w", err)
 	}
+
+	if created, _ := result.RowsAffected(); created > 0 {
+		publishEvent(db.tenant, EventCollectionCreated, name, map[string]interface{}{"description": description})
+	}
+	return nil
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// CollectionNotFoundError reports a collection the tenant doesn't have. Documents can only be
+// stored in a collection that exists, as foreign keys tie them to it.
+type CollectionNotFoundError struct {
+	Name string
+}
+
+func (e *CollectionNotFoundError) Error() string {
+	return fmt.Sprintf("collection '%s' not found", e.Name)
+}
+
+// requireCollection fails with a CollectionNotFoundError when the tenant has no collection of the
+// given name, including when another tenant has one
+func (db *VectorDB) requireCollection(q queryRower, name string) error {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM collections WHERE name = ? AND tenant_id = ?)`, name, db.tenant).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check collection existence: %w", err)
+	}
+	if !exists {
+		return &CollectionNotFoundError{Name: name}
+	}
+	return nil
+}
+
+// RequireCollection fails with a CollectionNotFoundError when the tenant has no collection of the
+// given name, so a request can be refused before its documents are processed
+func (db *VectorDB) RequireCollection(name string) error {
+	return db.requireCollection(db.conn, name)
+}
+
+// checkRowOwnership fails when a row with the given ID exists in table under another tenant,
+// so an upsert can never take over another tenant's document or chunk
+func (db *VectorDB) checkRowOwnership(q queryRower, table, id string) error {
+	var owner string
+	err := q.QueryRow(`SELECT tenant_id FROM `+table+` WHERE id = ?`, id).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check ownership: %w", err)
+	}
+	if owner != db.tenant {
+		return fmt.Errorf("id '%s' is already in use", id)
+	}
 	return nil
 }
 
@@ -213,6 +620,25 @@ func (db *VectorDB) AddDocument(collectionName string, doc *models.Document) err
 	}
 	defer tx.Rollback()
 
+	if err := db.insertDocument(tx, collectionName, doc); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertDocument writes a document and its chunks inside tx
+func (db *VectorDB) insertDocument(tx *sql.Tx, collectionName string, doc *models.Document) error {
+	if err := db.requireCollection(tx, collectionName); err != nil {
+		return err
+	}
+	if err := db.checkRowOwnership(tx, "documents", doc.ID); err != nil {
+		return err
+	}
+	if err := db.checkQuota(tx, collectionName, doc); err != nil {
+		return err
+	}
+
 	// Serialize document metadata
 	metadataJSON := "{}"
 	if doc.Metadata != nil {
@@ -221,10 +647,25 @@ func (db *VectorDB) AddDocument(collectionName string, doc *models.Document) err
 		}
 	}
 
-	// Insert document
-	docSQL := `INSERT OR REPLACE INTO documents 
-		(id, collection_name, content, source, doc_type, metadata, chunk_count, chunking_strategy) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	if doc.ContentHash == "" {
+		doc.ContentHash = ContentHash([]byte(doc.Content))
+	}
+	aclJSON, err := marshalACL(doc.ACL)
+	if err != nil {
+		return err
+	}
+
+	// Insert the document, or overwrite the one with its ID. An upsert rather than INSERT OR
+	// REPLACE, whose delete would cascade to the document's chunks.
+	docSQL := `INSERT INTO documents 
+		(id, collection_name, content, source, doc_type, metadata, chunk_count, chunking_strategy, tenant_id, content_hash, acl, expires_at, char_count) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			collection_name = excluded.collection_name, content = excluded.content, source = excluded.source,
+			doc_type = excluded.doc_type, metadata = excluded.metadata, chunk_count = excluded.chunk_count,
+			chunking_strategy = excluded.chunking_strategy, tenant_id = excluded.tenant_id,
+			content_hash = excluded.content_hash, acl = excluded.acl, expires_at = excluded.expires_at,
+			char_count = excluded.char_count, created_at = CURRENT_TIMESTAMP, embedding = NULL`
 
 	chunkCount := len(doc.Chunks)
 	chunkingStrategy := ""
@@ -234,23 +675,34 @@ func (db *VectorDB) AddDocument(collectionName string, doc *models.Document) err
 		}
 	}
 
-	_, err = tx.Exec(docSQL, doc.ID, collectionName, doc.Content, doc.Source,
-		doc.DocType, metadataJSON, chunkCount, chunkingStrategy)
+	_, err = tx.Exec(docSQL, doc.ID, collectionName, sealText(doc.Content), doc.Source,
+		doc.DocType, metadataJSON, chunkCount, chunkingStrategy, db.tenant, doc.ContentHash, aclJSON, expiryValue(doc.ExpiresAt), utf8.RuneCountInString(doc.Content))
 	if err != nil {
 		return fmt.Errorf("failed to insert document: %w", err)
 	}
 
 	// Insert enhanced chunks
+	terms := make(termStatsDelta)
 	for _, chunk := range doc.Chunks {
-		if err := db.insertEnhancedChunk(tx, collectionName, chunk); err != nil {
+		if err := db.insertEnhancedChunk(tx, collectionName, chunk, terms); err != nil {
 			return fmt.Errorf("failed to insert chunk: %w", err)
 		}
 	}
 
-	return tx.Commit()
+	return db.applyTermStats(tx, terms)
 }
 
-func (db *VectorDB) insertEnhancedChunk(tx *sql.Tx, collectionName string, chunk *models.EnhancedChunk) error {
+// insertEnhancedChunk stores a chunk, replacing one with the same ID, and indexes its text for
+// keyword search, counting the change to the index in terms
+func (db *VectorDB) insertEnhancedChunk(tx *sql.Tx, collectionName string, chunk *models.EnhancedChunk, terms termStatsDelta) error {
+	if err := db.checkRowOwnership(tx, "enhanced_chunks", chunk.ID); err != nil {
+		return err
+	}
+	var replaced bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM enhanced_chunks WHERE id = ?)`, chunk.ID).Scan(&replaced); err != nil {
+		return fmt.Errorf("failed to check chunk: %w", err)
+	}
+
 	// Serialize arrays and metadata
 	childIDsJSON := "[]"
 	if len(chunk.ChildChunkIDs) > 0 {
@@ -273,24 +725,61 @@ func (db *VectorDB) insertEnhancedChunk(tx *sql.Tx, collectionName string, chunk
 		}
 	}
 
-	// Insert chunk
-	chunkSQL := `INSERT OR REPLACE INTO enhanced_chunks 
+	if chunk.ContentHash == "" {
+		chunk.ContentHash = ContentHash([]byte(chunk.Text))
+	}
+
+	// Insert the chunk, or overwrite the one with its ID without deleting it, which would clear
+	// the parent IDs of its children
+	chunkSQL := `INSERT INTO enhanced_chunks 
 		(id, document_id, collection_name, text, parent_chunk_id, child_chunk_ids,
 		 section, subsection, chunk_type, start_pos, end_pos, chunk_index,
-		 keywords, metadata, confidence) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		 keywords, metadata, confidence, tenant_id, content_hash, duplicate_of) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			document_id = excluded.document_id, collection_name = excluded.collection_name, text = excluded.text,
+			parent_chunk_id = excluded.parent_chunk_id, child_chunk_ids = excluded.child_chunk_ids,
+			section = excluded.section, subsection = excluded.subsection, chunk_type = excluded.chunk_type,
+			start_pos = excluded.start_pos, end_pos = excluded.end_pos, chunk_index = excluded.chunk_index,
+			keywords = excluded.keywords, metadata = excluded.metadata, confidence = excluded.confidence,
+			tenant_id = excluded.tenant_id, content_hash = excluded.content_hash, duplicate_of = excluded.duplicate_of,
+			created_at = CURRENT_TIMESTAMP, revision = 0, updated_at = NULL`
 
 	_, err := tx.Exec(chunkSQL,
-		chunk.ID, chunk.DocumentID, collectionName, chunk.Text,
+		chunk.ID, chunk.DocumentID, collectionName, sealText(chunk.Text),
 		chunk.ParentChunkID, childIDsJSON,
 		chunk.Section, chunk.Subsection, chunk.ChunkType,
 		chunk.StartPos, chunk.EndPos, chunk.ChunkIndex,
-		keywordsJSON, metadataJSON, chunk.Confidence)
+		keywordsJSON, metadataJSON, chunk.Confidence, db.tenant,
+		chunk.ContentHash, chunk.DuplicateOf)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Keep the full-text index in sync; duplicates are found through the chunk they duplicate
+	if replaced {
+		if err := db.countIndexedChunks(tx, terms, -1, `id = ?`, chunk.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM chunk_fts WHERE chunk_id = ?`, chunk.ID); err != nil {
+		return fmt.Errorf("failed to update full-text index: %w", err)
+	}
+	if chunk.DuplicateOf != nil {
+		return nil
+	}
+	indexedText := keywordIndexText(chunk.Text)
+	_, err = tx.Exec(`INSERT INTO chunk_fts (chunk_id, collection_name, text) VALUES (?, ?, ?)`,
+		chunk.ID, collectionName, indexedText)
+	if err != nil {
+		return fmt.Errorf("failed to update full-text index: %w", err)
+	}
+	terms.add(collectionName, indexedText, 1)
+
+	return nil
 }
 
-func (db *VectorDB) AddEmbeddings(chunks []*models.EnhancedChunk) error {
+func (db *VectorDB) AddEmbeddings(collectionName string, chunks []*models.EnhancedChunk) error {
 	if len(chunks) == 0 {
 		return nil
 	}
@@ -304,12 +793,790 @@ func (db *VectorDB) AddEmbeddings(chunks []*models.EnhancedChunk) error {
 		}
 	}
 
-	if embeddingDim == 0 {
-		return fmt.Errorf("no valid embeddings found in chunks")
+	if embeddingDim == 0 {
+		return fmt.Errorf("no valid embeddings found in chunks")
+	}
+
+	// Ensure the embedding tables exist with the correct dimension
+	quantization, err := db.ensureEmbeddingTables(collectionName, embeddingDim)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := db.insertEmbeddings(tx, collectionName, quantization, chunks, embeddingDim); err != nil {
+		return err
+	}
+	documentIDs := make(map[string]bool)
+	for _, chunk := range chunks {
+		if !documentIDs[chunk.DocumentID] {
+			documentIDs[chunk.DocumentID] = true
+			if err := clearDocumentEmbeddings(tx, `id = ? AND tenant_id = ?`, chunk.DocumentID, db.tenant); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.indexEmbeddings(collectionName, quantization, chunks)
+	return nil
+}
+
+// insertEmbeddings writes the embeddings of chunks inside tx to the tables of a collection with
+// the given quantization; chunks without one are skipped. The tables must already exist with the
+// given dimension.
+func (db *VectorDB) insertEmbeddings(tx *sql.Tx, collectionName string, quantization *models.QuantizationConfig, chunks []*models.EnhancedChunk, embeddingDim int) error {
+	var stmts []*sql.Stmt
+	for _, insert := range embeddingInserts(quantization, embeddingDim) {
+		stmt, err := tx.Prepare(insert)
+		if err != nil {
+			return fmt.Errorf("failed to prepare embedding insert: %w", err)
+		}
+		defer stmt.Close()
+		stmts = append(stmts, stmt)
+	}
+
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) == 0 {
+			continue
+		}
+
+		if len(chunk.Embedding) != embeddingDim {
+			return fmt.Errorf("chunk %s has embedding dimension %d, expected %d",
+				chunk.ID, len(chunk.Embedding), embeddingDim)
+		}
+
+		if err := db.checkRowOwnership(tx, "enhanced_chunks", chunk.ID); err != nil {
+			return err
+		}
+
+		embedding, err := serializeEmbedding(chunk.Embedding)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range stmts {
+			if _, err := stmt.Exec(db.tenant, collectionName, chunk.ID, embedding); err != nil {
+				return fmt.Errorf("failed to insert embedding for chunk %s: %w", chunk.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// QuerySimilarChunks returns the topK chunks closest to queryEmbedding with their similarity scores.
+// Quantized collections are searched in their quantized table, and with rescoring enabled the
+// oversampled candidates are ranked again by exact distance. The search is bounded by the
+// configured search timeout.
+func (db *VectorDB) QuerySimilarChunks(ctx context.Context, collectionName string, queryEmbedding []float32, topK int, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, error) {
+	ctx, span := startSpan(ctx, "VectorDB.QuerySimilarChunks")
+	span.SetAttribute("rag.collection", collectionName)
+	span.SetAttribute("rag.top_k", topK)
+	span.SetAttribute("rag.filtered", len(filters) > 0)
+	chunks, scores, err := db.querySimilarChunks(ctx, collectionName, queryEmbedding, topK, filters)
+	span.SetAttribute("rag.chunks", len(chunks))
+	span.End(err)
+	return chunks, scores, err
+}
+
+// querySimilarChunks is QuerySimilarChunks without its span
+func (db *VectorDB) querySimilarChunks(ctx context.Context, collectionName string, queryEmbedding []float32, topK int, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, error) {
+	ctx, cancel := withStageTimeout(ctx, config.AppConfig.Timeouts.SearchSeconds)
+	defer cancel()
+
+	// A query embedded by a model of another dimension can't be compared with the stored embeddings
+	dimension, err := db.searchDimension(collectionName, len(queryEmbedding))
+	if err != nil || dimension == 0 {
+		return nil, nil, err
+	}
+
+	quantization, err := db.collectionQuantization(db.conn, collectionName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Collections with an ANN index are searched in it first; sqlite-vec answers when it can't
+	if index := lookupANNIndex(db.tenant, collectionName); index != nil && storesFloatEmbeddings(quantization) {
+		chunks, scores, ok, err := db.searchANNIndex(ctx, index, collectionName, queryEmbedding, topK, filters)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			spanFromContext(ctx).SetAttribute("rag.ann_index", true)
+			return chunks, scores, nil
+		}
+	}
+
+	table, match, k := floatEmbeddingTable(dimension), "?", topK
+	if quantization != nil {
+		store := quantizedStores[quantization.Type]
+		table, match = quantizedEmbeddingTable(quantization.Type, dimension), fmt.Sprintf(store.quantize, "?")
+		if quantization.Rescore {
+			k = topK * rescoreOversample(quantization)
+		}
+	}
+
+	queryBlob, err := serializeEmbedding(queryEmbedding)
+	if err != nil {
+		return nil, nil, err
+	}
+	whereConditions, filterArgs := buildFilterConditions(filters)
+
+	// Filters are applied to the nearest neighbours, so more of them are needed for the k wanted
+	// to survive. While too few do, the search looks further, until the collection has no more
+	// vectors or sqlite-vec's limit is reached.
+	want := k
+	if len(filters) > 0 {
+		k *= filteredSearchOversample
+	}
+	k = min(k, maxKNNNeighbours)
+	var chunks []*models.EnhancedChunk
+	var distances []float64
+	for {
+		chunks, distances, err = db.nearestChunks(ctx, table, match, collectionName, queryBlob, k, whereConditions, filterArgs)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(chunks) >= want || len(whereConditions) == 0 || k == maxKNNNeighbours {
+			break
+		}
+		neighbours, err := db.countNeighbours(ctx, table, match, collectionName, queryBlob, k)
+		if err != nil {
+			return nil, nil, err
+		}
+		if neighbours < k {
+			break
+		}
+		k = min(k*filteredSearchOversample, maxKNNNeighbours)
+	}
+	spanFromContext(ctx).SetAttribute("rag.knn_k", k)
+
+	scores := make([]float64, len(distances))
+	for i, distance := range distances {
+		if quantization != nil {
+			scores[i] = quantizedSimilarity(quantization.Type, distance, len(queryEmbedding))
+			continue
+		}
+		// Convert distance to similarity score (1 - distance for cosine similarity)
+		scores[i] = 1.0 - distance
+	}
+
+	if quantization != nil && quantization.Rescore {
+		return db.rescoreChunks(chunks, scores, queryBlob, dimension, topK)
+	}
+	if len(chunks) > topK {
+		chunks, scores = chunks[:topK], scores[:topK]
+	}
+	return chunks, scores, nil
+}
+
+const (
+	// filteredSearchOversample multiplies the neighbours fetched from the vector index when
+	// filters apply to them, and again each time the filters leave too few
+	filteredSearchOversample = 4
+
+	// maxKNNNeighbours is the most neighbours sqlite-vec returns for one query
+	maxKNNNeighbours = 4096
+)
+
+// nearestChunks returns the chunks among the k nearest neighbours of queryBlob in the collection's
+// partition of table that pass the filter conditions, with their distances, nearest first
+func (db *VectorDB) nearestChunks(ctx context.Context, table, match, collectionName string, queryBlob []byte, k int, whereConditions []string, filterArgs []interface{}) ([]*models.EnhancedChunk, []float64, error) {
+	baseQuery := `
+		SELECT c.id, c.document_id, rag_open(c.text), c.parent_chunk_id, c.child_chunk_ids,
+		       c.section, c.subsection, c.chunk_type, c.start_pos, c.end_pos, 
+		       c.chunk_index, c.keywords, c.metadata, c.confidence,
+		       vt.distance
+		FROM enhanced_chunks c
+		JOIN ` + table + ` vt ON c.id = vt.chunk_id
+		WHERE vt.tenant_id = ? AND vt.collection_name = ? AND c.collection_name = ? AND c.tenant_id = ?
+		  AND vt.embedding MATCH ` + match + ` AND k = ?`
+
+	// The partition keys restrict the nearest neighbours to the collection's own vectors
+	args := []interface{}{db.tenant, collectionName, collectionName, db.tenant, queryBlob, k}
+	args = append(args, filterArgs...)
+	if len(whereConditions) > 0 {
+		baseQuery += " AND " + strings.Join(whereConditions, " AND ")
+	}
+	baseQuery += " ORDER BY vt.distance"
+
+	rows, err := db.conn.QueryContext(ctx, baseQuery, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query similar chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []*models.EnhancedChunk
+	var distances []float64
+	for rows.Next() {
+		chunk := &models.EnhancedChunk{}
+		var childIDsJSON, keywordsJSON, metadataJSON string
+		var distance float64
+
+		err := rows.Scan(
+			&chunk.ID, &chunk.DocumentID, &chunk.Text, &chunk.ParentChunkID, &childIDsJSON,
+			&chunk.Section, &chunk.Subsection, &chunk.ChunkType,
+			&chunk.StartPos, &chunk.EndPos, &chunk.ChunkIndex,
+			&keywordsJSON, &metadataJSON, &chunk.Confidence, &distance)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+
+		// Deserialize JSON fields
+		if childIDsJSON != "[]" {
+			json.Unmarshal([]byte(childIDsJSON), &chunk.ChildChunkIDs)
+		}
+		if keywordsJSON != "[]" {
+			json.Unmarshal([]byte(keywordsJSON), &chunk.Keywords)
+		}
+		if metadataJSON != "{}" {
+			json.Unmarshal([]byte(metadataJSON), &chunk.Metadata)
+		}
+
+		chunks = append(chunks, chunk)
+		distances = append(distances, distance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to query similar chunks: %w", err)
+	}
+	return chunks, distances, nil
+}
+
+// countNeighbours returns how many of the k nearest neighbours of queryBlob the collection's
+// partition of table holds: k, or all its vectors when it holds fewer
+func (db *VectorDB) countNeighbours(ctx context.Context, table, match, collectionName string, queryBlob []byte, k int) (int, error) {
+	var count int
+	err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+`
+		WHERE tenant_id = ? AND collection_name = ? AND embedding MATCH `+match+` AND k = ?`,
+		db.tenant, collectionName, queryBlob, k).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count nearest neighbours: %w", err)
+	}
+	return count, nil
+}
+
+// buildFilterConditions translates metadata filters into SQL conditions on the enhanced_chunks alias "c"
+func buildFilterConditions(filters map[string]interface{}) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	for key, value := range filters {
+		if filter, ok := value.(metadataFilter); ok {
+			conditions = append(conditions, filter.conditions...)
+			args = append(args, filter.args...)
+			continue
+		}
+		switch key {
+		case createdRangeFilter, metadataRangesFilter:
+			rangeConds, rangeArgs := rangeConditions(value)
+			conditions = append(conditions, rangeConds...)
+			args = append(args, rangeArgs...)
+		case abstractionFilter:
+			switch value {
+			case models.DetailLevel:
+				conditions = append(conditions, "c.chunk_type != ?")
+				args = append(args, summaryChunkType)
+			case models.SummaryLevels:
+				conditions = append(conditions, "c.chunk_type = ?")
+				args = append(args, summaryChunkType)
+			}
+		case granularityFilter:
+			if value == models.SmallToBigGranularity {
+				conditions = append(conditions, "c.chunk_type != ?")
+				args = append(args, parentChunkType)
+			}
+		case principalFilter:
+			if principal, ok := value.(*models.Principal); ok {
+				condition, principalArgs := aclCondition(principal)
+				conditions = append(conditions, condition)
+				args = append(args, principalArgs...)
+			}
+		}
+	}
+	return conditions, args
+}
+
+// KeywordSearchChunks performs a lexical search over the full-text index. The query may quote
+// exact phrases and mark prefix (term*) and fuzzy (term~) terms, as parsed by parseKeywordQuery.
+// Scores are the fraction of query clauses matched.
+func (db *VectorDB) KeywordSearchChunks(ctx context.Context, collectionName string, query string, topK int, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, error) {
+	clauses := parseKeywordQuery(query)
+	if len(clauses) == 0 {
+		return nil, nil, nil
+	}
+
+	ctx, cancel := withStageTimeout(ctx, config.AppConfig.Timeouts.SearchSeconds)
+	defer cancel()
+
+	for i := range clauses {
+		// An index of hashed words can't match prefixes or similar spellings, only whole words
+		if hashedKeywordIndex() && (clauses[i].kind == clausePrefix || clauses[i].kind == clauseFuzzy) {
+			clauses[i].kind = clauseTerm
+		}
+		if clauses[i].kind != clauseFuzzy {
+			continue
+		}
+		variants, err := db.fuzzyVariants(ctx, clauses[i].text)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to expand fuzzy term %q: %w", clauses[i].text, err)
+		}
+		clauses[i].variants = variants
+	}
+	match := keywordMatchExpression(clauses)
+	if match == "" {
+		return nil, nil, nil
+	}
+	weights, err := db.keywordClauseWeights(collectionName, clauses)
+	if err != nil {
+		log.Printf("Weighing keyword clauses equally: %v", err)
+		weights = nil
+	}
+
+	baseQuery := `
+		SELECT c.id, c.document_id, rag_open(c.text), c.parent_chunk_id, c.child_chunk_ids,
+		       c.section, c.subsection, c.chunk_type, c.start_pos, c.end_pos,
+		       c.chunk_index, c.keywords, c.metadata, c.confidence
+		FROM chunk_fts f
+		JOIN enhanced_chunks c ON c.id = f.chunk_id
+		WHERE f.collection_name = ? AND c.tenant_id = ? AND chunk_fts MATCH ?`
+
+	var args []interface{}
+	args = append(args, collectionName, db.tenant, match)
+
+	whereConditions, filterArgs := buildFilterConditions(filters)
+	args = append(args, filterArgs...)
+
+	if len(whereConditions) > 0 {
+		baseQuery += " AND " + strings.Join(whereConditions, " AND ")
+	}
+
+	rows, err := db.conn.QueryContext(ctx, baseQuery, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to run keyword search: %w", err)
+	}
+	defer rows.Close()
+
+	type scoredChunk struct {
+		chunk *models.EnhancedChunk
+		score float64
+	}
+	var results []scoredChunk
+
+	for rows.Next() {
+		chunk := &models.EnhancedChunk{}
+		var childIDsJSON, keywordsJSON, metadataJSON string
+
+		err := rows.Scan(
+			&chunk.ID, &chunk.DocumentID, &chunk.Text, &chunk.ParentChunkID, &childIDsJSON,
+			&chunk.Section, &chunk.Subsection, &chunk.ChunkType,
+			&chunk.StartPos, &chunk.EndPos, &chunk.ChunkIndex,
+			&keywordsJSON, &metadataJSON, &chunk.Confidence)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+
+		// Deserialize JSON fields
+		if childIDsJSON != "[]" {
+			json.Unmarshal([]byte(childIDsJSON), &chunk.ChildChunkIDs)
+		}
+		if keywordsJSON != "[]" {
+			json.Unmarshal([]byte(keywordsJSON), &chunk.Keywords)
+		}
+		if metadataJSON != "{}" {
+			json.Unmarshal([]byte(metadataJSON), &chunk.Metadata)
+		}
+
+		results = append(results, scoredChunk{chunk: chunk, score: scoreKeywordClauses(clauses, weights, chunk.Text)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to run keyword search: %w", err)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+
+	if len(results) > topK {
+		results = results[:topK]
+	}
+
+	chunks := make([]*models.EnhancedChunk, len(results))
+	scores := make([]float64, len(results))
+	for i, r := range results {
+		chunks[i] = r.chunk
+		scores[i] = r.score
+	}
+
+	return chunks, scores, nil
+}
+
+// MetadataSearchChunks matches the query terms against the structure of each chunk rather than its
+// text: section, subsection, chunk type, keywords and metadata. Scores are the fraction of query
+// terms matched.
+func (db *VectorDB) MetadataSearchChunks(ctx context.Context, collectionName string, query string, topK int, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, error) {
+	terms := extractSearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil, nil
+	}
+
+	const fields = "LOWER(c.section || ' ' || c.subsection || ' ' || c.chunk_type || ' ' || c.keywords || ' ' || c.metadata)"
+	baseQuery := `
+		SELECT c.id, c.document_id, rag_open(c.text), c.parent_chunk_id, c.child_chunk_ids,
+		       c.section, c.subsection, c.chunk_type, c.start_pos, c.end_pos,
+		       c.chunk_index, c.keywords, c.metadata, c.confidence
+		FROM enhanced_chunks c
+		WHERE c.collection_name = ? AND c.tenant_id = ?`
+
+	var args []interface{}
+	args = append(args, collectionName, db.tenant)
+
+	// Search terms are letters and digits only, so they need no LIKE escaping
+	termConditions := make([]string, len(terms))
+	for i, term := range terms {
+		termConditions[i] = fields + " LIKE ?"
+		args = append(args, "%"+term+"%")
+	}
+	baseQuery += " AND (" + strings.Join(termConditions, " OR ") + ")"
+
+	whereConditions, filterArgs := buildFilterConditions(filters)
+	args = append(args, filterArgs...)
+
+	if len(whereConditions) > 0 {
+		baseQuery += " AND " + strings.Join(whereConditions, " AND ")
+	}
+
+	ctx, cancel := withStageTimeout(ctx, config.AppConfig.Timeouts.SearchSeconds)
+	defer cancel()
+
+	rows, err := db.conn.QueryContext(ctx, baseQuery, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to run metadata search: %w", err)
+	}
+	defer rows.Close()
+
+	type scoredChunk struct {
+		chunk *models.EnhancedChunk
+		score float64
+	}
+	var results []scoredChunk
+
+	for rows.Next() {
+		chunk := &models.EnhancedChunk{}
+		var childIDsJSON, keywordsJSON, metadataJSON string
+
+		err := rows.Scan(
+			&chunk.ID, &chunk.DocumentID, &chunk.Text, &chunk.ParentChunkID, &childIDsJSON,
+			&chunk.Section, &chunk.Subsection, &chunk.ChunkType,
+			&chunk.StartPos, &chunk.EndPos, &chunk.ChunkIndex,
+			&keywordsJSON, &metadataJSON, &chunk.Confidence)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+
+		// Deserialize JSON fields
+		if childIDsJSON != "[]" {
+			json.Unmarshal([]byte(childIDsJSON), &chunk.ChildChunkIDs)
+		}
+		if keywordsJSON != "[]" {
+			json.Unmarshal([]byte(keywordsJSON), &chunk.Keywords)
+		}
+		if metadataJSON != "{}" {
+			json.Unmarshal([]byte(metadataJSON), &chunk.Metadata)
+		}
+
+		// Score by the fraction of distinct query terms present in the searched fields
+		fieldsLower := strings.ToLower(strings.Join([]string{chunk.Section, chunk.Subsection, chunk.ChunkType, keywordsJSON, metadataJSON}, " "))
+		matched := 0
+		for _, term := range terms {
+			if strings.Contains(fieldsLower, term) {
+				matched++
+			}
+		}
+		results = append(results, scoredChunk{chunk: chunk, score: float64(matched) / float64(len(terms))})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to run metadata search: %w", err)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+
+	if len(results) > topK {
+		results = results[:topK]
+	}
+
+	chunks := make([]*models.EnhancedChunk, len(results))
+	scores := make([]float64, len(results))
+	for i, r := range results {
+		chunks[i] = r.chunk
+		scores[i] = r.score
+	}
+
+	return chunks, scores, nil
+}
+
+// extractSearchTerms normalizes a query into distinct lowercase terms safe for an FTS MATCH expression
+func extractSearchTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range splitSearchWords(query) {
+		if len(word) < 2 || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+func (db *VectorDB) GetChunkWithParents(chunkID string) ([]*models.EnhancedChunk, error) {
+	// Get the chunk and its parent hierarchy
+	query := `
+		WITH RECURSIVE chunk_hierarchy AS (
+			-- Base case: get the requested chunk
+			SELECT id, document_id, rag_open(text) AS text, parent_chunk_id, child_chunk_ids,
+			       section, subsection, chunk_type, start_pos, end_pos,
+			       chunk_index, keywords, metadata, confidence, 0 as level
+			FROM enhanced_chunks 
+			WHERE id = ? AND tenant_id = ?
+			
+			UNION ALL
+			
+			-- Recursive case: get parent chunks
+			SELECT c.id, c.document_id, rag_open(c.text), c.parent_chunk_id, c.child_chunk_ids,
+			       c.section, c.subsection, c.chunk_type, c.start_pos, c.end_pos,
+			       c.chunk_index, c.keywords, c.metadata, c.confidence, ch.level + 1
+			FROM enhanced_chunks c
+			JOIN chunk_hierarchy ch ON c.id = ch.parent_chunk_id
+			WHERE c.tenant_id = ?
+		)
+		SELECT * FROM chunk_hierarchy ORDER BY level DESC`
+
+	rows, err := db.conn.Query(query, chunkID, db.tenant, db.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunk hierarchy: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []*models.EnhancedChunk
+	for rows.Next() {
+		chunk := &models.EnhancedChunk{}
+		var childIDsJSON, keywordsJSON, metadataJSON string
+		var level int
+
+		err := rows.Scan(
+			&chunk.ID, &chunk.DocumentID, &chunk.Text, &chunk.ParentChunkID, &childIDsJSON,
+			&chunk.Section, &chunk.Subsection, &chunk.ChunkType,
+			&chunk.StartPos, &chunk.EndPos, &chunk.ChunkIndex,
+			&keywordsJSON, &metadataJSON, &chunk.Confidence, &level)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+
+		// Deserialize JSON fields
+		if childIDsJSON != "[]" {
+			json.Unmarshal([]byte(childIDsJSON), &chunk.ChildChunkIDs)
+		}
+		if keywordsJSON != "[]" {
+			json.Unmarshal([]byte(keywordsJSON), &chunk.Keywords)
+		}
+		if metadataJSON != "{}" {
+			json.Unmarshal([]byte(metadataJSON), &chunk.Metadata)
+		}
+
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// GetChunk returns a single chunk by ID including its revision counter
+func (db *VectorDB) GetChunk(chunkID string) (*models.EnhancedChunk, error) {
+	query := `
+		SELECT id, document_id, rag_open(text), parent_chunk_id, child_chunk_ids,
+		       section, subsection, chunk_type, start_pos, end_pos,
+		       chunk_index, keywords, metadata, confidence, COALESCE(revision, 0)
+		FROM enhanced_chunks
+		WHERE id = ? AND tenant_id = ?`
+
+	chunk := &models.EnhancedChunk{}
+	var childIDsJSON, keywordsJSON, metadataJSON string
+
+	err := db.conn.QueryRow(query, chunkID, db.tenant).Scan(
+		&chunk.ID, &chunk.DocumentID, &chunk.Text, &chunk.ParentChunkID, &childIDsJSON,
+		&chunk.Section, &chunk.Subsection, &chunk.ChunkType,
+		&chunk.StartPos, &chunk.EndPos, &chunk.ChunkIndex,
+		&keywordsJSON, &metadataJSON, &chunk.Confidence, &chunk.Revision)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("chunk with ID '%s' not found", chunkID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunk: %w", err)
+	}
+
+	// Deserialize JSON fields
+	if childIDsJSON != "[]" {
+		json.Unmarshal([]byte(childIDsJSON), &chunk.ChildChunkIDs)
+	}
+	if keywordsJSON != "[]" {
+		json.Unmarshal([]byte(keywordsJSON), &chunk.Keywords)
+	}
+	if metadataJSON != "{}" {
+		json.Unmarshal([]byte(metadataJSON), &chunk.Metadata)
+	}
+
+	return chunk, nil
+}
+
+// GetDocumentChunks returns the chunks of a document in document order. With a principal, a
+// document whose ACL doesn't let them see it is reported as not found.
+func (db *VectorDB) GetDocumentChunks(documentID string, principal *models.Principal) ([]*models.EnhancedChunk, error) {
+	condition, args := "d.id = ? AND d.tenant_id = ?", []interface{}{documentID, db.tenant}
+	if principal != nil {
+		aclCondition, aclArgs := documentACLCondition(principal)
+		condition += " AND " + aclCondition
+		args = append(args, aclArgs...)
+	}
+	var exists int
+	err := db.conn.QueryRow(`SELECT 1 FROM documents d WHERE `+condition, args...).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("document with ID '%s' not found", documentID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	query := `
+		SELECT id, document_id, rag_open(text), parent_chunk_id, child_chunk_ids,
+		       section, subsection, chunk_type, start_pos, end_pos,
+		       chunk_index, keywords, metadata, confidence, COALESCE(revision, 0)
+		FROM enhanced_chunks
+		WHERE document_id = ? AND tenant_id = ?
+		ORDER BY chunk_index, start_pos`
+
+	rows, err := db.conn.Query(query, documentID, db.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document chunks: %w", err)
+	}
+	defer rows.Close()
+
+	chunks := []*models.EnhancedChunk{}
+	for rows.Next() {
+		chunk := &models.EnhancedChunk{}
+		var childIDsJSON, keywordsJSON, metadataJSON string
+
+		err := rows.Scan(
+			&chunk.ID, &chunk.DocumentID, &chunk.Text, &chunk.ParentChunkID, &childIDsJSON,
+			&chunk.Section, &chunk.Subsection, &chunk.ChunkType,
+			&chunk.StartPos, &chunk.EndPos, &chunk.ChunkIndex,
+			&keywordsJSON, &metadataJSON, &chunk.Confidence, &chunk.Revision)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+
+		// Deserialize JSON fields
+		if childIDsJSON != "[]" {
+			json.Unmarshal([]byte(childIDsJSON), &chunk.ChildChunkIDs)
+		}
+		if keywordsJSON != "[]" {
+			json.Unmarshal([]byte(keywordsJSON), &chunk.Keywords)
+		}
+		if metadataJSON != "{}" {
+			json.Unmarshal([]byte(metadataJSON), &chunk.Metadata)
+		}
+
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, rows.Err()
+}
+
+// GetDocument returns a stored document with its content, metadata and an outline of its chunks
+// in document order, and with includeChunks the chunks themselves. With a principal, a document
+// whose ACL doesn't let them see it is reported as not found.
+func (db *VectorDB) GetDocument(documentID string, includeChunks bool, principal *models.Principal) (*models.DocumentDetails, error) {
+	condition, args := "d.id = ? AND d.tenant_id = ?", []interface{}{documentID, db.tenant}
+	if principal != nil {
+		aclCondition, aclArgs := documentACLCondition(principal)
+		condition += " AND " + aclCondition
+		args = append(args, aclArgs...)
+	}
+
+	doc := &models.DocumentDetails{}
+	var source, docType, metadataJSON, strategy, contentHash, aclJSON *string
+	err := db.conn.QueryRow(`
+		SELECT d.id, d.collection_name, rag_open(d.content), d.source, d.doc_type, d.metadata, d.chunking_strategy,
+		       d.created_at, d.content_hash, d.acl, d.expires_at
+		FROM documents d
+		WHERE `+condition, args...).Scan(
+		&doc.ID, &doc.CollectionName, &doc.Content, &source, &docType, &metadataJSON, &strategy,
+		&doc.CreatedAt, &contentHash, &aclJSON, &doc.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("document with ID '%s' not found", documentID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+	if source != nil {
+		doc.Source = *source
+	}
+	if docType != nil {
+		doc.DocType = *docType
+	}
+	if metadataJSON != nil && *metadataJSON != "" {
+		json.Unmarshal([]byte(*metadataJSON), &doc.Metadata)
+	}
+	if strategy != nil {
+		doc.ChunkingStrategy = *strategy
+	}
+	if contentHash != nil {
+		doc.ContentHash = *contentHash
+	}
+	doc.ACL = parseACL(aclJSON)
+
+	chunks, err := db.GetDocumentChunks(documentID, principal)
+	if err != nil {
+		return nil, err
 	}
+	doc.ChunkCount = len(chunks)
+	doc.ChunkSummaries = make([]models.ChunkSummary, len(chunks))
+	for i, chunk := range chunks {
+		doc.ChunkSummaries[i] = models.ChunkSummary{
+			ID:            chunk.ID,
+			ChunkIndex:    chunk.ChunkIndex,
+			ChunkType:     chunk.ChunkType,
+			Section:       chunk.Section,
+			Subsection:    chunk.Subsection,
+			StartPos:      chunk.StartPos,
+			EndPos:        chunk.EndPos,
+			ParentChunkID: chunk.ParentChunkID,
+			Characters:    len([]rune(chunk.Text)),
+			Preview:       snippetText(chunk.Text),
+		}
+	}
+	if includeChunks {
+		doc.Chunks = chunks
+	}
+	return doc, nil
+}
 
-	// Ensure the embedding table exists with the correct dimension
-	if err := db.ensureEmbeddingTableExists(embeddingDim); err != nil {
+// UpdateChunkText replaces a chunk's text, keywords and embedding, keeping the full-text index
+// in sync and incrementing the chunk's revision counter.
+func (db *VectorDB) UpdateChunkText(chunkID, text string, keywords []string, embedding []float32) error {
+	collectionName, err := db.chunkCollection(chunkID)
+	if err != nil {
+		return err
+	}
+	// Fails while the collection holds embeddings of another dimension, this chunk's included
+	quantization, err := db.ensureEmbeddingTables(collectionName, len(embedding))
+	if err != nil {
 		return err
 	}
 
@@ -319,172 +1586,183 @@ func (db *VectorDB) AddEmbeddings(chunks []*models.EnhancedChunk) error {
 	}
 	defer tx.Rollback()
 
-	for _, chunk := range chunks {
-		if len(chunk.Embedding) == 0 {
-			continue
-		}
-
-		if len(chunk.Embedding) != embeddingDim {
-			return fmt.Errorf("chunk %s has embedding dimension %d, expected %d",
-				chunk.ID, len(chunk.Embedding), embeddingDim)
+	keywordsJSON := "[]"
+	if len(keywords) > 0 {
+		if keywordBytes, err := json.Marshal(keywords); err == nil {
+			keywordsJSON = string(keywordBytes)
 		}
+	}
 
-		// Convert embedding to string format for sqlite-vec
-		embeddingStr := "[" + strings.Join(float32SliceToStringSlice(chunk.Embedding), ",") + "]"
+	// Chunks duplicating this one keep the old text, so one of them takes over its embedding
+	heirs, err := db.promoteDuplicates(tx, []string{chunkID}, "")
+	if err != nil {
+		return err
+	}
 
-		sql := `INSERT OR REPLACE INTO chunk_embeddings (chunk_id, embedding) VALUES (?, ?)`
-		_, err := tx.Exec(sql, chunk.ID, embeddingStr)
-		if err != nil {
-			return fmt.Errorf("failed to insert embedding for chunk %s: %w", chunk.ID, err)
-		}
+	result, err := tx.Exec(`UPDATE enhanced_chunks
+		SET text = ?, keywords = ?, end_pos = start_pos + ?, content_hash = ?, duplicate_of = NULL,
+		    revision = COALESCE(revision, 0) + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND tenant_id = ?`, sealText(text), keywordsJSON, utf8.RuneCountInString(text), ContentHash([]byte(text)), chunkID, db.tenant)
+	if err != nil {
+		return fmt.Errorf("failed to update chunk: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("chunk with ID '%s' not found", chunkID)
 	}
 
-	return tx.Commit()
-}
+	// Entities and relations extracted from the old text no longer hold
+	if err := db.deleteGraph(tx, `chunk_id = ?`, chunkID); err != nil {
+		return err
+	}
 
-func (db *VectorDB) QuerySimilarChunks(collectionName string, queryEmbedding []float32, topK int, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, error) {
-	// Build the query with optional filters
-	baseQuery := `
-		SELECT c.id, c.document_id, c.text, c.parent_chunk_id, c.child_chunk_ids,
-		       c.section, c.subsection, c.chunk_type, c.start_pos, c.end_pos, 
-		       c.chunk_index, c.keywords, c.metadata, c.confidence,
-		       vt.distance
-		FROM enhanced_chunks c
-		JOIN chunk_embeddings vt ON c.id = vt.chunk_id
-		WHERE c.collection_name = ? AND vt.embedding MATCH ? AND k = ?`
+	// An edited duplicate becomes a chunk of its own, so it may not have a full-text entry yet
+	terms := make(termStatsDelta)
+	if err := db.countIndexedChunks(tx, terms, -1, `id = ?`, chunkID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM chunk_fts WHERE chunk_id = ?`, chunkID); err != nil {
+		return fmt.Errorf("failed to update full-text index: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO chunk_fts (chunk_id, collection_name, text)
+		SELECT id, collection_name, rag_index(text) FROM enhanced_chunks WHERE id = ?`, chunkID); err != nil {
+		return fmt.Errorf("failed to update full-text index: %w", err)
+	}
+	terms.add(collectionName, keywordIndexText(text), 1)
+	if err := db.applyTermStats(tx, terms); err != nil {
+		return err
+	}
 
-	// Add metadata filters
-	var args []interface{}
-	args = append(args, collectionName)
+	if err := db.deleteEmbeddings(tx, `chunk_id = ?`, chunkID); err != nil {
+		return err
+	}
+	chunk := &models.EnhancedChunk{ID: chunkID, Embedding: embedding}
+	if err := db.insertEmbeddings(tx, collectionName, quantization, []*models.EnhancedChunk{chunk}, len(embedding)); err != nil {
+		return err
+	}
+	if err := clearDocumentEmbeddings(tx, `id = (SELECT document_id FROM enhanced_chunks WHERE id = ?)`, chunkID); err != nil {
+		return err
+	}
 
-	// Convert query embedding to string
-	queryEmbeddingStr := "[" + strings.Join(float32SliceToStringSlice(queryEmbedding), ",") + "]"
-	args = append(args, queryEmbeddingStr)
-	args = append(args, topK)
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.indexStoredEmbeddings(heirs)
+	db.indexEmbeddings(collectionName, quantization, []*models.EnhancedChunk{chunk})
+	return nil
+}
 
-	// Apply metadata filters
-	whereConditions := []string{}
-	for key, value := range filters {
-		switch key {
-		case "chunk_type":
-			whereConditions = append(whereConditions, "c.chunk_type = ?")
-			args = append(args, value)
-		case "section":
-			whereConditions = append(whereConditions, "c.section = ?")
-			args = append(args, value)
-		case "doc_type":
-			whereConditions = append(whereConditions, "c.document_id IN (SELECT id FROM documents WHERE doc_type = ?)")
-			args = append(args, value)
-		}
+// GetDocumentSources returns the source of each given document, keyed by document ID
+func (db *VectorDB) GetDocumentSources(documentIDs []string) (map[string]string, error) {
+	sources := make(map[string]string, len(documentIDs))
+	if len(documentIDs) == 0 {
+		return sources, nil
 	}
 
-	if len(whereConditions) > 0 {
-		baseQuery += " AND " + strings.Join(whereConditions, " AND ")
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(documentIDs)), ",")
+	args := make([]interface{}, len(documentIDs))
+	for i, id := range documentIDs {
+		args[i] = id
 	}
 
-	baseQuery += " ORDER BY vt.distance"
+	args = append(args, db.tenant)
 
-	rows, err := db.conn.Query(baseQuery, args...)
+	rows, err := db.conn.Query(`SELECT id, COALESCE(source, '') FROM documents WHERE id IN (`+placeholders+`) AND tenant_id = ?`, args...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to query similar chunks: %w", err)
+		return nil, fmt.Errorf("failed to look up document sources: %w", err)
 	}
 	defer rows.Close()
 
-	var chunks []*models.EnhancedChunk
-	var scores []float64
-
 	for rows.Next() {
-		chunk := &models.EnhancedChunk{}
-		var childIDsJSON, keywordsJSON, metadataJSON string
-		var distance float64
-
-		err := rows.Scan(
-			&chunk.ID, &chunk.DocumentID, &chunk.Text, &chunk.ParentChunkID, &childIDsJSON,
-			&chunk.Section, &chunk.Subsection, &chunk.ChunkType,
-			&chunk.StartPos, &chunk.EndPos, &chunk.ChunkIndex,
-			&keywordsJSON, &metadataJSON, &chunk.Confidence, &distance)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to scan chunk: %w", err)
+		var id, source string
+		if err := rows.Scan(&id, &source); err != nil {
+			return nil, fmt.Errorf("failed to scan document source: %w", err)
 		}
+		sources[id] = source
+	}
 
-		// Deserialize JSON fields
-		if childIDsJSON != "[]" {
-			json.Unmarshal([]byte(childIDsJSON), &chunk.ChildChunkIDs)
-		}
-		if keywordsJSON != "[]" {
-			json.Unmarshal([]byte(keywordsJSON), &chunk.Keywords)
-		}
-		if metadataJSON != "{}" {
-			json.Unmarshal([]byte(metadataJSON), &chunk.Metadata)
-		}
+	return sources, nil
+}
 
-		chunks = append(chunks, chunk)
-		// Convert distance to similarity score (1 - distance for cosine similarity)
-		similarity := 1.0 - distance
-		scores = append(scores, similarity)
+// chunkCollection returns the name of the collection a chunk of the tenant belongs to
+func (db *VectorDB) chunkCollection(chunkID string) (string, error) {
+	var collectionName string
+	err := db.conn.QueryRow(`SELECT collection_name FROM enhanced_chunks WHERE id = ? AND tenant_id = ?`,
+		chunkID, db.tenant).Scan(&collectionName)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("chunk with ID '%s' not found", chunkID)
 	}
-
-	return chunks, scores, nil
+	if err != nil {
+		return "", fmt.Errorf("failed to look up chunk: %w", err)
+	}
+	return collectionName, nil
 }
 
-func (db *VectorDB) GetChunkWithParents(chunkID string) ([]*models.EnhancedChunk, error) {
-	// Get the chunk and its parent hierarchy
-	query := `
-		WITH RECURSIVE chunk_hierarchy AS (
-			-- Base case: get the requested chunk
-			SELECT id, document_id, text, parent_chunk_id, child_chunk_ids,
-			       section, subsection, chunk_type, start_pos, end_pos,
-			       chunk_index, keywords, metadata, confidence, 0 as level
-			FROM enhanced_chunks 
-			WHERE id = ?
-			
-			UNION ALL
-			
-			-- Recursive case: get parent chunks
-			SELECT c.id, c.document_id, c.text, c.parent_chunk_id, c.child_chunk_ids,
-			       c.section, c.subsection, c.chunk_type, c.start_pos, c.end_pos,
-			       c.chunk_index, c.keywords, c.metadata, c.confidence, ch.level + 1
-			FROM enhanced_chunks c
-			JOIN chunk_hierarchy ch ON c.id = ch.parent_chunk_id
-		)
-		SELECT * FROM chunk_hierarchy ORDER BY level DESC`
+// GetChunkEmbeddings returns the stored embedding of each given chunk, keyed by chunk ID.
+// Chunks only stored quantized get an approximation of their normalized embedding, and chunks
+// without an embedding are absent from the map.
+func (db *VectorDB) GetChunkEmbeddings(chunkIDs []string) (map[string][]float32, error) {
+	embeddings := make(map[string][]float32, len(chunkIDs))
+	if len(chunkIDs) == 0 {
+		return embeddings, nil
+	}
 
-	rows, err := db.conn.Query(query, chunkID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query chunk hierarchy: %w", err)
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunkIDs)), ",")
+	args := make([]interface{}, len(chunkIDs))
+	for i, id := range chunkIDs {
+		args[i] = id
 	}
-	defer rows.Close()
 
-	var chunks []*models.EnhancedChunk
-	for rows.Next() {
-		chunk := &models.EnhancedChunk{}
-		var childIDsJSON, keywordsJSON, metadataJSON string
-		var level int
+	args = append(args, db.tenant)
 
-		err := rows.Scan(
-			&chunk.ID, &chunk.DocumentID, &chunk.Text, &chunk.ParentChunkID, &childIDsJSON,
-			&chunk.Section, &chunk.Subsection, &chunk.ChunkType,
-			&chunk.StartPos, &chunk.EndPos, &chunk.ChunkIndex,
-			&keywordsJSON, &metadataJSON, &chunk.Confidence, &level)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+	// The chunks may belong to collections of different dimensions
+	tables, err := existingEmbeddingTables(db.conn)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		if table.quantization != "" {
+			continue
 		}
-
-		// Deserialize JSON fields
-		if childIDsJSON != "[]" {
-			json.Unmarshal([]byte(childIDsJSON), &chunk.ChildChunkIDs)
+		// CROSS JOIN keeps enhanced_chunks as the outer table, so vec0 answers one primary key lookup
+		// per chunk instead of being scanned for the IN list
+		rows, err := db.conn.Query(`SELECT c.id, e.embedding
+			FROM enhanced_chunks c
+			CROSS JOIN `+table.name+` e ON e.chunk_id = c.id
+			WHERE c.id IN (`+placeholders+`) AND c.tenant_id = ?`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up chunk embeddings: %w", err)
 		}
-		if keywordsJSON != "[]" {
-			json.Unmarshal([]byte(keywordsJSON), &chunk.Keywords)
+		for rows.Next() {
+			var id string
+			var blob []byte
+			if err := rows.Scan(&id, &blob); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan chunk embedding: %w", err)
+			}
+			embeddings[id] = deserializeFloat32(blob)
 		}
-		if metadataJSON != "{}" {
-			json.Unmarshal([]byte(metadataJSON), &chunk.Metadata)
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up chunk embeddings: %w", err)
 		}
+	}
 
-		chunks = append(chunks, chunk)
+	var missing []string
+	for _, id := range chunkIDs {
+		if _, ok := embeddings[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	quantized, err := db.quantizedEmbeddings(missing)
+	if err != nil {
+		return nil, err
+	}
+	for id, embedding := range quantized {
+		embeddings[id] = embedding
 	}
 
-	return chunks, nil
+	return embeddings, nil
 }
 
 // Legacy support for backwards compatibility
@@ -504,7 +1782,11 @@ func (db *VectorDB) AddChunk(collectionName string, chunk *models.DocumentChunk)
 	}
 	defer tx.Rollback()
 
-	if err := db.insertEnhancedChunk(tx, collectionName, enhancedChunk); err != nil {
+	terms := make(termStatsDelta)
+	if err := db.insertEnhancedChunk(tx, collectionName, enhancedChunk, terms); err != nil {
+		return err
+	}
+	if err := db.applyTermStats(tx, terms); err != nil {
 		return err
 	}
 
@@ -513,7 +1795,7 @@ func (db *VectorDB) AddChunk(collectionName string, chunk *models.DocumentChunk)
 
 // Legacy support for simple queries
 func (db *VectorDB) QuerySimilar(collectionName string, queryEmbedding []float32, topK int) ([]*models.DocumentChunk, error) {
-	enhancedChunks, _, err := db.QuerySimilarChunks(collectionName, queryEmbedding, topK, nil)
+	enhancedChunks, _, err := db.QuerySimilarChunks(context.Background(), collectionName, queryEmbedding, topK, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -537,37 +1819,66 @@ func (db *VectorDB) Close() error {
 	return db.conn.Close()
 }
 
+// Snapshot writes a transactionally consistent copy of the database to a new temporary file
+// and returns its path. The caller is responsible for removing the file.
+func (db *VectorDB) Snapshot() (string, error) {
+	tmp, err := os.CreateTemp("", "rag-snapshot-*.db")
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	path := tmp.Name()
+	tmp.Close()
+
+	// VACUUM INTO refuses to overwrite an existing file
+	os.Remove(path)
+
+	if _, err := db.conn.Exec(`VACUUM INTO ?`, path); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	return path, nil
+}
+
 // Collection management methods
-func (db *VectorDB) ListCollections() ([]map[string]interface{}, error) {
-	sql := `SELECT name, description, created_at FROM collections ORDER BY created_at DESC`
-	rows, err := db.conn.Query(sql)
+
+// ListCollections returns the page of collections matching req, with document and chunk counts,
+// and the number of collections matching in total
+func (db *VectorDB) ListCollections(req *models.ListCollectionsRequest) ([]map[string]interface{}, int, error) {
+	conditions := []string{"c.tenant_id = ?"}
+	args := []interface{}{db.tenant}
+	if req.Name != "" {
+		conditions = append(conditions, `c.name LIKE ? ESCAPE '\'`)
+		args = append(args, likeSubstring(req.Name))
+	}
+	q, err := buildListQuery(req.ListOptions, conditions, args, "c.created_at", "c.name", collectionSortColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM collections c`+q.where(), q.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count collections: %w", err)
+	}
+
+	sql := `SELECT c.name, c.description, c.created_at,
+		       (SELECT COUNT(DISTINCT e.document_id) FROM enhanced_chunks e
+		        WHERE e.collection_name = c.name AND e.tenant_id = c.tenant_id) AS doc_count,
+		       (SELECT COUNT(*) FROM enhanced_chunks e
+		        WHERE e.collection_name = c.name AND e.tenant_id = c.tenant_id) AS chunk_count
+		FROM collections c` + q.where() + q.orderBy + q.limit
+	rows, err := db.conn.Query(sql, q.args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list collections: %w", err)
+		return nil, 0, fmt.Errorf("failed to list collections: %w", err)
 	}
 	defer rows.Close()
 
-	var collections []map[string]interface{}
+	collections := []map[string]interface{}{}
 	for rows.Next() {
 		var name, description, createdAt string
-		err := rows.Scan(&name, &description, &createdAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan collection: %w", err)
-		}
-
-		// Count documents in collection
-		countSQL := `SELECT COUNT(DISTINCT document_id) FROM enhanced_chunks WHERE collection_name = ?`
-		var docCount int
-		err = db.conn.QueryRow(countSQL, name).Scan(&docCount)
-		if err != nil {
-			docCount = 0 // Continue if count fails
-		}
-
-		// Count total chunks
-		chunkCountSQL := `SELECT COUNT(*) FROM enhanced_chunks WHERE collection_name = ?`
-		var chunkCount int
-		err = db.conn.QueryRow(chunkCountSQL, name).Scan(&chunkCount)
+		var docCount, chunkCount int
+		err := rows.Scan(&name, &description, &createdAt, &docCount, &chunkCount)
 		if err != nil {
-			chunkCount = 0
+			return nil, 0, fmt.Errorf("failed to scan collection: %w", err)
 		}
 
 		collections = append(collections, map[string]interface{}{
@@ -578,8 +1889,11 @@ func (db *VectorDB) ListCollections() ([]map[string]interface{}, error) {
 			"chunk_count": chunkCount,
 		})
 	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list collections: %w", err)
+	}
 
-	return collections, nil
+	return collections, total, nil
 }
 
 func (db *VectorDB) DeleteCollection(name string) error {
@@ -589,28 +1903,46 @@ func (db *VectorDB) DeleteCollection(name string) error {
 	}
 	defer tx.Rollback()
 
+	if err := db.requireCollection(tx, name); err != nil {
+		return err
+	}
+
 	// Delete embeddings for chunks in this collection
-	_, err = tx.Exec(`DELETE FROM chunk_embeddings WHERE chunk_id IN (
-		SELECT id FROM enhanced_chunks WHERE collection_name = ?
-	)`, name)
-	if err != nil {
-		return fmt.Errorf("failed to delete chunk embeddings: %w", err)
+	if err := db.deleteEmbeddings(tx, `chunk_id IN (
+		SELECT id FROM enhanced_chunks WHERE collection_name = ? AND tenant_id = ?
+	)`, name, db.tenant); err != nil {
+		return err
 	}
 
-	// Delete chunks
-	_, err = tx.Exec(`DELETE FROM enhanced_chunks WHERE collection_name = ?`, name)
+	// Delete full-text entries
+	_, err = tx.Exec(`DELETE FROM chunk_fts WHERE chunk_id IN (
+		SELECT id FROM enhanced_chunks WHERE collection_name = ? AND tenant_id = ?
+	)`, name, db.tenant)
 	if err != nil {
-		return fmt.Errorf("failed to delete chunks: %w", err)
+		return fmt.Errorf("failed to delete full-text entries: %w", err)
+	}
+	if err := db.dropTermStats(tx, name); err != nil {
+		return err
 	}
 
-	// Delete documents
-	_, err = tx.Exec(`DELETE FROM documents WHERE collection_name = ?`, name)
+	// Delete the knowledge graph
+	if err := db.deleteGraph(tx, `collection_name = ? AND tenant_id = ?`, name, db.tenant); err != nil {
+		return err
+	}
+
+	deleted, err := db.documentsToDelete(tx, `collection_name = ? AND tenant_id = ?`, name, db.tenant)
 	if err != nil {
-		return fmt.Errorf("failed to delete documents: %w", err)
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM s3_objects WHERE collection_name = ? AND tenant_id = ?`, name, db.tenant); err != nil {
+		return fmt.Errorf("failed to delete s3 object versions: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM query_log WHERE collection_name = ? AND tenant_id = ?`, name, db.tenant); err != nil {
+		return fmt.Errorf("failed to delete query log: %w", err)
 	}
 
-	// Delete collection
-	result, err := tx.Exec(`DELETE FROM collections WHERE name = ?`, name)
+	// Delete the collection; its documents and chunks are deleted with it
+	result, err := tx.Exec(`DELETE FROM collections WHERE name = ? AND tenant_id = ?`, name, db.tenant)
 	if err != nil {
 		return fmt.Errorf("failed to delete collection: %w", err)
 	}
@@ -624,37 +1956,71 @@ func (db *VectorDB) DeleteCollection(name string) error {
 		return fmt.Errorf("collection '%s' not found", name)
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	rebuildANNIndexes(db.tenant, name)
+	db.publishDeleted(deleted)
+	return nil
 }
 
 // Document management methods
-func (db *VectorDB) ListDocuments(collectionName string) ([]map[string]interface{}, error) {
+
+// ListDocuments returns the page of documents in a collection matching req, and the number of
+// documents matching in total. With a principal, only the documents their ACL allows are listed
+// and counted.
+func (db *VectorDB) ListDocuments(collectionName string, req *models.ListDocumentsRequest, principal *models.Principal) ([]map[string]interface{}, int, error) {
+	conditions := []string{"d.collection_name = ?", "d.tenant_id = ?"}
+	args := []interface{}{collectionName, db.tenant}
+	if principal != nil {
+		condition, principalArgs := documentACLCondition(principal)
+		conditions = append(conditions, condition)
+		args = append(args, principalArgs...)
+	}
+	if req.DocType != "" {
+		conditions = append(conditions, "d.doc_type = ?")
+		args = append(args, req.DocType)
+	}
+	if req.Source != "" {
+		conditions = append(conditions, `d.source LIKE ? ESCAPE '\'`)
+		args = append(args, likeSubstring(req.Source))
+	}
+	q, err := buildListQuery(req.ListOptions, conditions, args, "d.created_at", "d.id", documentSortColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM documents d`+q.where(), q.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count documents: %w", err)
+	}
+
 	sql := `
-		SELECT d.id, d.source, d.doc_type, d.created_at,
+		SELECT d.id, d.source, d.doc_type, d.created_at, d.content_hash, d.acl, d.expires_at,
+		       json_extract(d.metadata, '$.title'), json_extract(d.metadata, '$.summary'),
 		       COUNT(c.id) as chunk_count,
 		       MIN(c.created_at) as first_chunk_created,
 		       MAX(c.created_at) as last_chunk_created
 		FROM documents d
-		LEFT JOIN enhanced_chunks c ON d.id = c.document_id AND c.collection_name = ?
-		WHERE d.collection_name = ?
-		GROUP BY d.id, d.source, d.doc_type, d.created_at
-		ORDER BY d.created_at DESC`
+		LEFT JOIN enhanced_chunks c ON d.id = c.document_id AND c.collection_name = ?` + q.where() + `
+		GROUP BY d.id, d.source, d.doc_type, d.created_at, d.content_hash, d.acl, d.expires_at, d.metadata` + q.orderBy + q.limit
 
-	rows, err := db.conn.Query(sql, collectionName, collectionName)
+	rows, err := db.conn.Query(sql, append([]interface{}{collectionName}, q.args...)...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list documents: %w", err)
+		return nil, 0, fmt.Errorf("failed to list documents: %w", err)
 	}
 	defer rows.Close()
 
-	var documents []map[string]interface{}
+	documents := []map[string]interface{}{}
 	for rows.Next() {
 		var id, source, docType, createdAt string
 		var chunkCount int
-		var firstChunkCreated, lastChunkCreated *string
+		var contentHash, aclJSON, title, summary, firstChunkCreated, lastChunkCreated *string
+		var expiresAt *time.Time
 
-		err := rows.Scan(&id, &source, &docType, &createdAt, &chunkCount, &firstChunkCreated, &lastChunkCreated)
+		err := rows.Scan(&id, &source, &docType, &createdAt, &contentHash, &aclJSON, &expiresAt, &title, &summary, &chunkCount, &firstChunkCreated, &lastChunkCreated)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan document: %w", err)
+			return nil, 0, fmt.Errorf("failed to scan document: %w", err)
 		}
 
 		doc := map[string]interface{}{
@@ -664,6 +2030,21 @@ func (db *VectorDB) ListDocuments(collectionName string) ([]map[string]interface
 			"created_at":  createdAt,
 			"chunk_count": chunkCount,
 		}
+		if contentHash != nil {
+			doc["content_hash"] = *contentHash
+		}
+		if acl := parseACL(aclJSON); acl != nil {
+			doc["acl"] = acl
+		}
+		if expiresAt != nil {
+			doc["expires_at"] = expiresAt.UTC()
+		}
+		if title != nil {
+			doc["title"] = *title
+		}
+		if summary != nil {
+			doc["summary"] = *summary
+		}
 
 		if firstChunkCreated != nil {
 			doc["first_chunk_created"] = *firstChunkCreated
@@ -674,8 +2055,11 @@ func (db *VectorDB) ListDocuments(collectionName string) ([]map[string]interface
 
 		documents = append(documents, doc)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list documents: %w", err)
+	}
 
-	return documents, nil
+	return documents, total, nil
 }
 
 func (db *VectorDB) DeleteDocument(documentID string) error {
@@ -686,40 +2070,69 @@ func (db *VectorDB) DeleteDocument(documentID string) error {
 	defer tx.Rollback()
 
 	// Get document info for verification
-	var source string
-	err = tx.QueryRow(`SELECT source FROM documents WHERE id = ?`, documentID).Scan(&source)
+	deleted, err := db.documentsToDelete(tx, `id = ? AND tenant_id = ?`, documentID, db.tenant)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("document with ID '%s' not found", documentID)
-		}
-		return fmt.Errorf("failed to find document: %w", err)
+		return err
+	}
+	if len(deleted) == 0 {
+		return fmt.Errorf("document with ID '%s' not found", documentID)
 	}
+	source := deleted[0].source
 
-	// Delete embeddings for chunks of this document
-	_, err = tx.Exec(`DELETE FROM chunk_embeddings WHERE chunk_id IN (
-		SELECT id FROM enhanced_chunks WHERE document_id = ?
-	)`, documentID)
+	// Chunks of other documents that duplicate this document's chunks take over their embeddings
+	chunkIDs, err := queryStrings(tx, `SELECT id FROM enhanced_chunks WHERE document_id = ? AND tenant_id = ?`, documentID, db.tenant)
+	if err != nil {
+		return fmt.Errorf("failed to list chunks: %w", err)
+	}
+	heirs, err := db.promoteDuplicates(tx, chunkIDs, documentID)
 	if err != nil {
-		return fmt.Errorf("failed to delete chunk embeddings: %w", err)
+		return err
+	}
+
+	// Delete embeddings for chunks of this document
+	if err := db.deleteEmbeddings(tx, `chunk_id IN (
+		SELECT id FROM enhanced_chunks WHERE document_id = ? AND tenant_id = ?
+	)`, documentID, db.tenant); err != nil {
+		return err
 	}
 
-	// Delete chunks
-	result, err := tx.Exec(`DELETE FROM enhanced_chunks WHERE document_id = ?`, documentID)
+	// Delete full-text entries, counting them out of the term statistics
+	terms := make(termStatsDelta)
+	if err := db.countIndexedChunks(tx, terms, -1, `document_id = ? AND tenant_id = ?`, documentID, db.tenant); err != nil {
+		return err
+	}
+	if err := db.applyTermStats(tx, terms); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM chunk_fts WHERE chunk_id IN (
+		SELECT id FROM enhanced_chunks WHERE document_id = ? AND tenant_id = ?
+	)`, documentID, db.tenant)
 	if err != nil {
-		return fmt.Errorf("failed to delete chunks: %w", err)
+		return fmt.Errorf("failed to delete full-text entries: %w", err)
 	}
 
-	chunksDeleted, _ := result.RowsAffected()
+	// Delete the knowledge graph extracted from this document
+	if err := db.deleteGraph(tx, `chunk_id IN (
+		SELECT id FROM enhanced_chunks WHERE document_id = ? AND tenant_id = ?
+	)`, documentID, db.tenant); err != nil {
+		return err
+	}
 
-	// Delete document
-	_, err = tx.Exec(`DELETE FROM documents WHERE id = ?`, documentID)
+	// Delete the document; its chunks are deleted with it
+	_, err = tx.Exec(`DELETE FROM documents WHERE id = ? AND tenant_id = ?`, documentID, db.tenant)
 	if err != nil {
 		return fmt.Errorf("failed to delete document: %w", err)
 	}
 
-	log.Printf("Deleted document '%s' (source: %s) and %d chunks", documentID, source, chunksDeleted)
+	log.Printf("Deleted document '%s' (source: %s) and %d chunks", documentID, source, len(chunkIDs))
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.unindexEmbeddings(deleted[0].collectionName, chunkIDs)
+	db.indexStoredEmbeddings(heirs)
+	db.publishDeleted(deleted)
+	return nil
 }
 
 func (db *VectorDB) DeleteAllDocumentsInCollection(collectionName string) error {
@@ -731,7 +2144,7 @@ func (db *VectorDB) DeleteAllDocumentsInCollection(collectionName string) error
 
 	// Count documents before deletion
 	var docCount int
-	err = tx.QueryRow(`SELECT COUNT(*) FROM documents WHERE collection_name = ?`, collectionName).Scan(&docCount)
+	err = tx.QueryRow(`SELECT COUNT(*) FROM documents WHERE collection_name = ? AND tenant_id = ?`, collectionName, db.tenant).Scan(&docCount)
 	if err != nil {
 		return fmt.Errorf("failed to count documents: %w", err)
 	}
@@ -739,32 +2152,54 @@ func (db *VectorDB) DeleteAllDocumentsInCollection(collectionName string) error
 	if docCount == 0 {
 		return fmt.Errorf("no documents found in collection '%s'", collectionName)
 	}
+	deleted, err := db.documentsToDelete(tx, `collection_name = ? AND tenant_id = ?`, collectionName, db.tenant)
+	if err != nil {
+		return err
+	}
 
 	// Delete embeddings for chunks in this collection
-	_, err = tx.Exec(`DELETE FROM chunk_embeddings WHERE chunk_id IN (
-		SELECT id FROM enhanced_chunks WHERE collection_name = ?
-	)`, collectionName)
-	if err != nil {
-		return fmt.Errorf("failed to delete chunk embeddings: %w", err)
+	if err := db.deleteEmbeddings(tx, `chunk_id IN (
+		SELECT id FROM enhanced_chunks WHERE collection_name = ? AND tenant_id = ?
+	)`, collectionName, db.tenant); err != nil {
+		return err
 	}
 
-	// Delete chunks
-	result, err := tx.Exec(`DELETE FROM enhanced_chunks WHERE collection_name = ?`, collectionName)
+	// Delete full-text entries
+	_, err = tx.Exec(`DELETE FROM chunk_fts WHERE chunk_id IN (
+		SELECT id FROM enhanced_chunks WHERE collection_name = ? AND tenant_id = ?
+	)`, collectionName, db.tenant)
 	if err != nil {
-		return fmt.Errorf("failed to delete chunks: %w", err)
+		return fmt.Errorf("failed to delete full-text entries: %w", err)
+	}
+	if err := db.dropTermStats(tx, collectionName); err != nil {
+		return err
+	}
+
+	// Delete the knowledge graph
+	if err := db.deleteGraph(tx, `collection_name = ? AND tenant_id = ?`, collectionName, db.tenant); err != nil {
+		return err
 	}
 
-	chunksDeleted, _ := result.RowsAffected()
+	var chunksDeleted int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM enhanced_chunks WHERE collection_name = ? AND tenant_id = ?`, collectionName, db.tenant).Scan(&chunksDeleted)
+	if err != nil {
+		return fmt.Errorf("failed to count chunks: %w", err)
+	}
 
-	// Delete documents
-	_, err = tx.Exec(`DELETE FROM documents WHERE collection_name = ?`, collectionName)
+	// Delete documents; their chunks are deleted with them
+	_, err = tx.Exec(`DELETE FROM documents WHERE collection_name = ? AND tenant_id = ?`, collectionName, db.tenant)
 	if err != nil {
 		return fmt.Errorf("failed to delete documents: %w", err)
 	}
 
 	log.Printf("Deleted %d documents and %d chunks from collection '%s'", docCount, chunksDeleted, collectionName)
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	rebuildANNIndexes(db.tenant, collectionName)
+	db.publishDeleted(deleted)
+	return nil
 }
 
 func (db *VectorDB) GetCollectionStats(collectionName string) (map[string]interface{}, error) {
@@ -772,7 +2207,7 @@ func (db *VectorDB) GetCollectionStats(collectionName string) (map[string]interf
 
 	// Check if collection exists
 	var exists bool
-	err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM collections WHERE name = ?)`, collectionName).Scan(&exists)
+	err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM collections WHERE name = ? AND tenant_id = ?)`, collectionName, db.tenant).Scan(&exists)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check collection existence: %w", err)
 	}
@@ -783,7 +2218,7 @@ func (db *VectorDB) GetCollectionStats(collectionName string) (map[string]interf
 
 	// Get basic collection info
 	var description, createdAt string
-	err = db.conn.QueryRow(`SELECT description, created_at FROM collections WHERE name = ?`, collectionName).Scan(&description, &createdAt)
+	err = db.conn.QueryRow(`SELECT description, created_at FROM collections WHERE name = ? AND tenant_id = ?`, collectionName, db.tenant).Scan(&description, &createdAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get collection info: %w", err)
 	}
@@ -792,23 +2227,46 @@ func (db *VectorDB) GetCollectionStats(collectionName string) (map[string]interf
 	stats["description"] = description
 	stats["created_at"] = createdAt
 
+	metadata, err := db.readCollectionMetadata(db.conn, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Defaults != nil {
+		stats["defaults"] = metadata.Defaults
+	}
+	if metadata.Quantization != nil {
+		stats["quantization"] = metadata.Quantization
+	}
+	if annIndexes != nil {
+		if status := annIndexes.Status(db.tenant, collectionName); status != nil {
+			stats["ann_index"] = status
+		}
+	}
+
 	// Count documents
 	var docCount int
-	err = db.conn.QueryRow(`SELECT COUNT(*) FROM documents WHERE collection_name = ?`, collectionName).Scan(&docCount)
+	err = db.conn.QueryRow(`SELECT COUNT(*) FROM documents WHERE collection_name = ? AND tenant_id = ?`, collectionName, db.tenant).Scan(&docCount)
 	if err == nil {
 		stats["document_count"] = docCount
 	}
 
 	// Count chunks
 	var chunkCount int
-	err = db.conn.QueryRow(`SELECT COUNT(*) FROM enhanced_chunks WHERE collection_name = ?`, collectionName).Scan(&chunkCount)
+	err = db.conn.QueryRow(`SELECT COUNT(*) FROM enhanced_chunks WHERE collection_name = ? AND tenant_id = ?`, collectionName, db.tenant).Scan(&chunkCount)
 	if err == nil {
 		stats["chunk_count"] = chunkCount
 	}
 
+	// Count the distinct terms of the keyword index, the vocabulary of the term statistics
+	var termCount int
+	err = db.conn.QueryRow(`SELECT COUNT(*) FROM collection_terms WHERE collection_name = ? AND tenant_id = ?`, collectionName, db.tenant).Scan(&termCount)
+	if err == nil {
+		stats["indexed_terms"] = termCount
+	}
+
 	// Get chunk type distribution
-	chunkTypeSQL := `SELECT chunk_type, COUNT(*) FROM enhanced_chunks WHERE collection_name = ? GROUP BY chunk_type ORDER BY COUNT(*) DESC`
-	rows, err := db.conn.Query(chunkTypeSQL, collectionName)
+	chunkTypeSQL := `SELECT chunk_type, COUNT(*) FROM enhanced_chunks WHERE collection_name = ? AND tenant_id = ? GROUP BY chunk_type ORDER BY COUNT(*) DESC`
+	rows, err := db.conn.Query(chunkTypeSQL, collectionName, db.tenant)
 	if err == nil {
 		defer rows.Close()
 		chunkTypes := make(map[string]int)
@@ -823,8 +2281,8 @@ func (db *VectorDB) GetCollectionStats(collectionName string) (map[string]interf
 	}
 
 	// Get document types
-	docTypeSQL := `SELECT doc_type, COUNT(*) FROM documents WHERE collection_name = ? GROUP BY doc_type ORDER BY COUNT(*) DESC`
-	rows, err = db.conn.Query(docTypeSQL, collectionName)
+	docTypeSQL := `SELECT doc_type, COUNT(*) FROM documents WHERE collection_name = ? AND tenant_id = ? GROUP BY doc_type ORDER BY COUNT(*) DESC`
+	rows, err = db.conn.Query(docTypeSQL, collectionName, db.tenant)
 	if err == nil {
 		defer rows.Close()
 		docTypes := make(map[string]int)
@@ -841,11 +2299,12 @@ func (db *VectorDB) GetCollectionStats(collectionName string) (map[string]interf
 	return stats, nil
 }
 
-// Helper function to convert float32 slice to string slice
-func float32SliceToStringSlice(floats []float32) []string {
-	strings := make([]string, len(floats))
-	for i, f := range floats {
-		strings[i] = strconv.FormatFloat(float64(f), 'f', -1, 32)
+// serializeEmbedding encodes a vector in sqlite-vec's binary float32 format, which vec0 columns
+// and MATCH accept without parsing text and which round-trips every component exactly
+func serializeEmbedding(embedding []float32) ([]byte, error) {
+	blob, err := sqlite_vec.SerializeFloat32(embedding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize embedding: %w", err)
 	}
-	return strings
+	return blob, nil
 }
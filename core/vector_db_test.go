@@ -0,0 +1,456 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"rag-go-app/models"
+	"testing"
+	"unicode/utf8"
+)
+
+// newTestDB opens a database in a temporary directory, closed when the test ends
+func newTestDB(t *testing.T) *VectorDB {
+	t.Helper()
+	db, err := NewVectorDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewVectorDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testDocument builds a document whose chunks carry embeddings of the given dimension, so it can
+// be stored without an embedding backend
+func testDocument(id string, texts []string, dimension int) *models.Document {
+	doc := &models.Document{ID: id, Source: id + ".txt"}
+	offset := 0
+	for i, text := range texts {
+		embedding := make([]float32, dimension)
+		embedding[i%dimension] = 1
+		runes := len([]rune(text))
+		doc.Chunks = append(doc.Chunks, &models.EnhancedChunk{
+			ID:         fmt.Sprintf("%s-chunk-%d", id, i),
+			DocumentID: id,
+			Text:       text,
+			Embedding:  embedding,
+			ChunkType:  "paragraph",
+			StartPos:   offset,
+			EndPos:     offset + runes,
+			ChunkIndex: i,
+		})
+		doc.Content += text + "\n\n"
+		offset += runes + 2
+	}
+	return doc
+}
+
+// countRows returns the number of rows of table matching where
+func countRows(t *testing.T, db *VectorDB, table, where string, args ...interface{}) int {
+	t.Helper()
+	var count int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE `+where, args...).Scan(&count); err != nil {
+		t.Fatalf("count %s: %v", table, err)
+	}
+	return count
+}
+
+func TestDeleteCollectionLeavesNoRows(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"doomed", "kept"} {
+		if err := db.CreateCollection(name, "", nil, nil); err != nil {
+			t.Fatalf("CreateCollection(%s): %v", name, err)
+		}
+		docs := []*models.Document{
+			testDocument(name+"-a", []string{"alpha beta", "gamma delta"}, 4),
+			testDocument(name+"-b", []string{"epsilon zeta"}, 4),
+		}
+		if err := db.addDocuments(ctx, name, docs, 4); err != nil {
+			t.Fatalf("addDocuments(%s): %v", name, err)
+		}
+	}
+
+	if err := db.DeleteCollection("doomed"); err != nil {
+		t.Fatalf("DeleteCollection: %v", err)
+	}
+
+	byCollection := `collection_name = 'doomed'`
+	byChunk := `chunk_id LIKE 'doomed-%'`
+	for _, check := range []struct{ table, where string }{
+		{"collections", `name = 'doomed'`},
+		{"documents", byCollection},
+		{"enhanced_chunks", byCollection},
+		{floatEmbeddingTable(4), byChunk},
+		{"chunk_fts", byChunk},
+	} {
+		if n := countRows(t, db, check.table, check.where); n != 0 {
+			t.Errorf("%s has %d rows of the deleted collection, want 0", check.table, n)
+		}
+	}
+
+	// The other collection is untouched
+	if n := countRows(t, db, "enhanced_chunks", `collection_name = 'kept'`); n != 3 {
+		t.Errorf("kept collection has %d chunks, want 3", n)
+	}
+	if n := countRows(t, db, floatEmbeddingTable(4), `chunk_id LIKE 'kept-%'`); n != 3 {
+		t.Errorf("kept collection has %d embeddings, want 3", n)
+	}
+
+	var violations int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM pragma_foreign_key_check`).Scan(&violations); err != nil {
+		t.Fatalf("foreign_key_check: %v", err)
+	}
+	if violations != 0 {
+		t.Errorf("foreign_key_check reports %d violations", violations)
+	}
+}
+
+func TestAddDocumentToUnknownCollection(t *testing.T) {
+	db := newTestDB(t)
+
+	err := db.AddDocument("missing", testDocument("orphan", []string{"no home"}, 4))
+	var missing *CollectionNotFoundError
+	if !errors.As(err, &missing) {
+		t.Fatalf("AddDocument to an unknown collection: got %v, want a CollectionNotFoundError", err)
+	}
+	if n := countRows(t, db, "documents", `id = 'orphan'`); n != 0 {
+		t.Errorf("documents has %d rows for the refused document, want 0", n)
+	}
+}
+
+func TestCreateCollectionOfAnotherTenant(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	acme, globex := db.ForTenant("acme"), db.ForTenant("globex")
+
+	for _, tenant := range []*VectorDB{acme, globex} {
+		if err := tenant.CreateCollection("shared", "", nil, nil); err != nil {
+			t.Fatalf("CreateCollection(%s): %v", tenant.tenant, err)
+		}
+		docs := []*models.Document{testDocument(tenant.tenant, []string{"hello"}, 4)}
+		if err := tenant.addDocuments(ctx, "shared", docs, 4); err != nil {
+			t.Fatalf("addDocuments(%s): %v", tenant.tenant, err)
+		}
+	}
+
+	// Each tenant only finds its own chunk in its collection of the same name
+	for _, tenant := range []*VectorDB{acme, globex} {
+		chunks, _, err := tenant.QuerySimilarChunks(ctx, "shared", []float32{1, 0, 0, 0}, 5, nil)
+		if err != nil {
+			t.Fatalf("QuerySimilarChunks(%s): %v", tenant.tenant, err)
+		}
+		if len(chunks) != 1 || chunks[0].ID != tenant.tenant+"-chunk-0" {
+			t.Errorf("QuerySimilarChunks(%s) = %v, want only %s-chunk-0", tenant.tenant, chunks, tenant.tenant)
+		}
+	}
+
+	if err := globex.DeleteCollection("shared"); err != nil {
+		t.Fatalf("DeleteCollection: %v", err)
+	}
+	if n := countRows(t, db, "enhanced_chunks", `collection_name = 'shared' AND tenant_id = 'acme'`); n != 1 {
+		t.Errorf("deleting another tenant's collection left acme %d chunks, want 1", n)
+	}
+	err := db.ForTenant("initech").AddDocument("shared", testDocument("intruder", []string{"hello"}, 4))
+	var missing *CollectionNotFoundError
+	if !errors.As(err, &missing) {
+		t.Fatalf("AddDocument to another tenant's collection: got %v, want a CollectionNotFoundError", err)
+	}
+}
+
+func TestSearchIsScopedToCollection(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	// A crowded collection whose vectors are all closer to the query than the small one's
+	for name, count := range map[string]int{"crowded": 40, "small": 2} {
+		if err := db.CreateCollection(name, "", nil, nil); err != nil {
+			t.Fatalf("CreateCollection(%s): %v", name, err)
+		}
+		texts := make([]string, count)
+		for i := range texts {
+			texts[i] = fmt.Sprintf("text %d", i)
+		}
+		doc := testDocument(name, texts, 4)
+		for _, chunk := range doc.Chunks {
+			if name == "crowded" {
+				chunk.Embedding = []float32{1, 0, 0, 0}
+			} else {
+				chunk.Embedding = []float32{0, 1, 0, 0}
+			}
+		}
+		if err := db.addDocuments(ctx, name, []*models.Document{doc}, 4); err != nil {
+			t.Fatalf("addDocuments(%s): %v", name, err)
+		}
+	}
+
+	chunks, _, err := db.QuerySimilarChunks(ctx, "small", []float32{1, 0, 0, 0}, 2, nil)
+	if err != nil {
+		t.Fatalf("QuerySimilarChunks: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Errorf("QuerySimilarChunks found %d chunks of the small collection, want 2", len(chunks))
+	}
+}
+
+func TestMigrateCollectionKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	// The tables as they were when collection names were unique across tenants
+	old, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE collections (
+			name TEXT PRIMARY KEY, description TEXT,
+			embedding_model TEXT DEFAULT 'nomic-embed-text-v1.5', embedding_dimension INTEGER DEFAULT 1024,
+			metadata TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE TABLE documents (
+			id TEXT PRIMARY KEY, collection_name TEXT NOT NULL, content TEXT NOT NULL, source TEXT, doc_type TEXT,
+			metadata TEXT, chunk_count INTEGER DEFAULT 0, chunking_strategy TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (collection_name) REFERENCES collections(name) ON DELETE CASCADE)`,
+		`CREATE TABLE enhanced_chunks (
+			id TEXT PRIMARY KEY, document_id TEXT NOT NULL, collection_name TEXT NOT NULL, text TEXT NOT NULL,
+			parent_chunk_id TEXT, child_chunk_ids TEXT, section TEXT, subsection TEXT, chunk_type TEXT NOT NULL,
+			start_pos INTEGER, end_pos INTEGER, chunk_index INTEGER, keywords TEXT, metadata TEXT, confidence REAL DEFAULT 0.0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE,
+			FOREIGN KEY (collection_name) REFERENCES collections(name) ON DELETE CASCADE,
+			FOREIGN KEY (parent_chunk_id) REFERENCES enhanced_chunks(id) ON DELETE SET NULL)`,
+		`INSERT INTO collections (name, description) VALUES ('docs', 'old')`,
+		`INSERT INTO documents (id, collection_name, content) VALUES ('doc', 'docs', 'hello')`,
+		`INSERT INTO enhanced_chunks (id, document_id, collection_name, text, chunk_type, child_chunk_ids, keywords, metadata)
+			VALUES ('doc-chunk-0', 'doc', 'docs', 'hello', 'paragraph', '[]', '[]', '{}')`,
+	} {
+		if _, err := old.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	old.Close()
+
+	db, err := NewVectorDB(path)
+	if err != nil {
+		t.Fatalf("NewVectorDB: %v", err)
+	}
+	defer db.Close()
+
+	if n := countRows(t, db, "pragma_table_info('collections')", `pk > 0`); n != 2 {
+		t.Errorf("collections has %d key columns, want 2", n)
+	}
+	if n := countRows(t, db, "enhanced_chunks", `id = 'doc-chunk-0' AND tenant_id = ?`, DefaultTenant); n != 1 {
+		t.Errorf("the chunk stored before the migration is gone")
+	}
+	if err := db.ForTenant("acme").CreateCollection("docs", "", nil, nil); err != nil {
+		t.Errorf("CreateCollection of a name another tenant uses: %v", err)
+	}
+
+	// Deleting the collection still cascades to its documents and chunks
+	if err := db.DeleteCollection("docs"); err != nil {
+		t.Fatalf("DeleteCollection: %v", err)
+	}
+	if n := countRows(t, db, "documents", `id = 'doc'`); n != 0 {
+		t.Errorf("documents has %d rows of the deleted collection, want 0", n)
+	}
+	if n := countRows(t, db, "collections", `name = 'docs'`); n != 1 {
+		t.Errorf("collections has %d rows named docs, want the other tenant's", n)
+	}
+}
+
+func TestUpdateChunkTextCountsRunes(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateCollection("edits", "", nil, nil); err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	doc := testDocument("doc", []string{"plain text", "more text"}, 4)
+	if err := db.addDocuments(context.Background(), "edits", []*models.Document{doc}, 4); err != nil {
+		t.Fatalf("addDocuments: %v", err)
+	}
+
+	text := "Café 日本語 🚀 naïve"
+	if err := db.UpdateChunkText("doc-chunk-1", text, nil, []float32{0, 1, 0, 0}); err != nil {
+		t.Fatalf("UpdateChunkText: %v", err)
+	}
+	chunk, err := db.GetChunk("doc-chunk-1")
+	if err != nil {
+		t.Fatalf("GetChunk: %v", err)
+	}
+	if chunk.Text != text {
+		t.Fatalf("text = %q, want %q", chunk.Text, text)
+	}
+	if want := chunk.StartPos + utf8.RuneCountInString(text); chunk.EndPos != want {
+		t.Errorf("end_pos = %d, want start_pos + %d runes = %d", chunk.EndPos, utf8.RuneCountInString(text), want)
+	}
+}
+
+func TestCollectionsOfDifferentDimensions(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	for name, dimension := range map[string]int{"small": 4, "large": 8} {
+		if err := db.CreateCollection(name, "", nil, nil); err != nil {
+			t.Fatalf("CreateCollection(%s): %v", name, err)
+		}
+		docs := []*models.Document{testDocument(name, []string{"alpha beta", "gamma delta"}, dimension)}
+		if err := db.addDocuments(ctx, name, docs, dimension); err != nil {
+			t.Fatalf("addDocuments(%s): %v", name, err)
+		}
+	}
+
+	for name, dimension := range map[string]int{"small": 4, "large": 8} {
+		query := make([]float32, dimension)
+		query[1] = 1
+		chunks, _, err := db.QuerySimilarChunks(ctx, name, query, 1, nil)
+		if err != nil {
+			t.Fatalf("QuerySimilarChunks(%s): %v", name, err)
+		}
+		if len(chunks) != 1 || chunks[0].ID != name+"-chunk-1" {
+			t.Errorf("QuerySimilarChunks(%s) = %v, want %s-chunk-1", name, chunks, name)
+		}
+	}
+
+	// Each collection keeps to its own dimension while it holds embeddings
+	_, _, err := db.QuerySimilarChunks(ctx, "small", make([]float32, 8), 1, nil)
+	var mismatch *EmbeddingDimensionError
+	if !errors.As(err, &mismatch) || mismatch.Stored != 4 || mismatch.Got != 8 {
+		t.Fatalf("query of the wrong dimension: got %v, want an EmbeddingDimensionError", err)
+	}
+	err = db.addDocuments(ctx, "large", []*models.Document{testDocument("narrow", []string{"too short"}, 4)}, 4)
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("adding embeddings of the wrong dimension: got %v, want an EmbeddingDimensionError", err)
+	}
+
+	// An emptied collection takes any dimension
+	if err := db.DeleteDocument("small"); err != nil {
+		t.Fatalf("DeleteDocument: %v", err)
+	}
+	if err := db.addDocuments(ctx, "small", []*models.Document{testDocument("wide", []string{"now wider"}, 8)}, 8); err != nil {
+		t.Fatalf("addDocuments to the emptied collection: %v", err)
+	}
+	if dimension, err := db.storedDimension(db.conn, "small"); err != nil || dimension != 8 {
+		t.Errorf("storedDimension(small) = %d, %v, want 8", dimension, err)
+	}
+}
+
+func TestMigrateEmbeddingTables(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		layout []string // Statements turning the partitioned table back into an older layout
+	}{
+		{"shared table", []string{
+			`CREATE VIRTUAL TABLE chunk_embeddings USING vec0(chunk_id TEXT PRIMARY KEY, embedding FLOAT[4])`,
+			`INSERT INTO chunk_embeddings (chunk_id, embedding) SELECT chunk_id, embedding FROM chunk_embeddings_4`,
+			`DROP TABLE chunk_embeddings_4`,
+			`UPDATE collections SET embedding_dimension = 1024`,
+			`DELETE FROM settings WHERE name = '` + embeddingLayoutSetting + `'`,
+		}},
+		{"unpartitioned table", []string{
+			`CREATE TEMP TABLE saved AS SELECT chunk_id, embedding FROM chunk_embeddings_4`,
+			`DROP TABLE chunk_embeddings_4`,
+			`CREATE VIRTUAL TABLE chunk_embeddings_4 USING vec0(chunk_id TEXT PRIMARY KEY, embedding FLOAT[4])`,
+			`INSERT INTO chunk_embeddings_4 (chunk_id, embedding) SELECT chunk_id, embedding FROM saved`,
+			`UPDATE settings SET value = 'per_dimension' WHERE name = '` + embeddingLayoutSetting + `'`,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.db")
+			db, err := NewVectorDB(path)
+			if err != nil {
+				t.Fatalf("NewVectorDB: %v", err)
+			}
+			if err := db.CreateCollection("legacy", "", nil, nil); err != nil {
+				t.Fatalf("CreateCollection: %v", err)
+			}
+			docs := []*models.Document{testDocument("old", []string{"alpha beta", "gamma delta"}, 4)}
+			if err := db.addDocuments(context.Background(), "legacy", docs, 4); err != nil {
+				t.Fatalf("addDocuments: %v", err)
+			}
+
+			// One connection, so the temporary table stays visible
+			conn, err := db.conn.Conn(context.Background())
+			if err != nil {
+				t.Fatalf("Conn: %v", err)
+			}
+			for _, stmt := range tc.layout {
+				if _, err := conn.ExecContext(context.Background(), stmt); err != nil {
+					t.Fatalf("%s: %v", stmt, err)
+				}
+			}
+			conn.Close()
+			db.Close()
+
+			db, err = NewVectorDB(path)
+			if err != nil {
+				t.Fatalf("reopening: %v", err)
+			}
+			defer db.Close()
+
+			if n := countRows(t, db, "sqlite_master", `name = ?`, legacyEmbeddingTable); n != 0 {
+				t.Errorf("the shared embedding table is still there")
+			}
+			if n := countRows(t, db, "sqlite_master", `name = ? AND sql LIKE '%partition key%'`, floatEmbeddingTable(4)); n != 1 {
+				t.Errorf("%s is not partitioned", floatEmbeddingTable(4))
+			}
+			if n := countRows(t, db, floatEmbeddingTable(4), `chunk_id LIKE 'old-%' AND collection_name = 'legacy'`); n != 2 {
+				t.Errorf("%s has %d embeddings of the collection, want 2", floatEmbeddingTable(4), n)
+			}
+			if dimension, err := db.storedDimension(db.conn, "legacy"); err != nil || dimension != 4 {
+				t.Errorf("storedDimension(legacy) = %d, %v, want 4", dimension, err)
+			}
+			query := []float32{0, 1, 0, 0}
+			chunks, _, err := db.QuerySimilarChunks(context.Background(), "legacy", query, 1, nil)
+			if err != nil || len(chunks) != 1 || chunks[0].ID != "old-chunk-1" {
+				t.Errorf("QuerySimilarChunks after migrating = %v, %v, want old-chunk-1", chunks, err)
+			}
+		})
+	}
+}
+
+func TestSearchForSparselyVisiblePrincipal(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	if err := db.CreateCollection("restricted", "", nil, nil); err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+
+	// Alice may see 3 of 300 documents, and all the others are nearer the query
+	var docs []*models.Document
+	for i := 0; i < 300; i++ {
+		doc := testDocument(fmt.Sprintf("doc-%03d", i), []string{"text"}, 4)
+		doc.ACL = &models.DocumentACL{Users: []string{"bob"}}
+		doc.Chunks[0].Embedding = []float32{1, float32(i) / 1000, 0, 0}
+		if i%100 == 99 {
+			doc.ACL = &models.DocumentACL{Users: []string{"alice"}}
+			doc.Chunks[0].Embedding = []float32{0, 1, float32(i) / 1000, 0}
+		}
+		docs = append(docs, doc)
+	}
+	if err := db.addDocuments(ctx, "restricted", docs, 4); err != nil {
+		t.Fatalf("addDocuments: %v", err)
+	}
+
+	for _, tc := range []struct {
+		user string
+		want int
+	}{
+		{"alice", 3},
+		{"mallory", 0}, // Sees nothing; the search stops once the collection is exhausted
+	} {
+		filters := map[string]interface{}{principalFilter: &models.Principal{User: tc.user}}
+		chunks, _, err := db.QuerySimilarChunks(ctx, "restricted", []float32{1, 0, 0, 0}, 3, filters)
+		if err != nil {
+			t.Fatalf("QuerySimilarChunks(%s): %v", tc.user, err)
+		}
+		if len(chunks) != tc.want {
+			t.Errorf("QuerySimilarChunks(%s) found %d chunks, want %d", tc.user, len(chunks), tc.want)
+		}
+		for _, chunk := range chunks {
+			if chunk.DocumentID != "doc-099" && chunk.DocumentID != "doc-199" && chunk.DocumentID != "doc-299" {
+				t.Errorf("QuerySimilarChunks(%s) returned %s, which they may not see", tc.user, chunk.DocumentID)
+			}
+		}
+	}
+}
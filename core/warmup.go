@@ -0,0 +1,323 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"rag-go-app/config"
+	"rag-go-app/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultWarmupTimeout bounds the warm-up when no timeout is configured
+const defaultWarmupTimeout = 5 * time.Minute
+
+// States of the warm-up
+const (
+	WarmupRunning = "running"
+	WarmupDone    = "done"
+	WarmupFailed  = "failed" // The database could not be verified, so the server never reports ready
+)
+
+// Outcomes of a warm-up step
+const (
+	WarmupStepOK      = "ok"
+	WarmupStepFailed  = "failed"
+	WarmupStepSkipped = "skipped" // Not configured, or the warm-up ran out of time before it
+)
+
+// WarmupStep is the outcome of one step of the warm-up
+type WarmupStep struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"` // "ok", "failed" or "skipped"
+	DurationMS int64  `json:"duration_ms"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WarmupStatus reports the progress of the warm-up
+type WarmupStatus struct {
+	State      string       `json:"state"` // "running", "done" or "failed"
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Steps      []WarmupStep `json:"steps"` // Steps finished so far, in order
+}
+
+// Warmup prepares the server after it starts: it verifies the database, indexes chunks missing from
+// the keyword index, and reads collection statistics and stored embeddings so their pages are
+// cached before the first query needs them. Optionally it has the model server load its models,
+// and it waits for the ANN indexes to be built when any are configured.
+// A step other than the database check that fails is reported, and the warm-up goes on.
+type Warmup struct {
+	db      *VectorDB
+	cfg     config.WarmupConfig
+	timeout time.Duration
+
+	mu     sync.Mutex
+	status WarmupStatus
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWarmup returns a warm-up that has not been started, or nil when it is skipped
+func NewWarmup(db *VectorDB, cfg config.WarmupConfig) *Warmup {
+	if cfg.Skip {
+		return nil
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWarmupTimeout
+	}
+	return &Warmup{db: db, cfg: cfg, timeout: timeout}
+}
+
+// Start runs the warm-up in the background
+func (w *Warmup) Start() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	w.status = WarmupStatus{State: WarmupRunning, StartedAt: time.Now().UTC(), Steps: []WarmupStep{}}
+
+	go func() {
+		defer close(w.done)
+		defer cancel()
+		w.run(ctx)
+	}()
+	log.Printf("Warming up; the server reports ready once done")
+}
+
+// Stop abandons the warm-up if it is still running
+func (w *Warmup) Stop() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+}
+
+// Status returns the progress of the warm-up
+func (w *Warmup) Status() WarmupStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := w.status
+	status.Steps = append([]WarmupStep{}, w.status.Steps...)
+	return status
+}
+
+// run performs the steps in order. Steps left when the timeout passes are skipped, so a slow disk
+// or model server delays readiness by the timeout at most.
+func (w *Warmup) run(ctx context.Context) {
+	start := time.Now()
+	steps := []struct {
+		name    string
+		enabled bool
+		run     func(context.Context) (string, error)
+	}{
+		{"database", true, w.verifyDatabase},
+		{"keyword_index", true, w.db.indexMissingChunks},
+		{"collection_stats", true, w.db.readCollectionStats},
+		{"embeddings", true, w.db.readEmbeddings},
+		{"models", w.cfg.LoadModels, loadModels},
+		{"ann_indexes", annIndexes != nil, waitForANNIndexes},
+	}
+
+	for i, step := range steps {
+		result := WarmupStep{Name: step.name, Status: WarmupStepSkipped}
+		switch {
+		case !step.enabled:
+			result.Detail = "not configured"
+		case ctx.Err() != nil:
+			result.Error = "warm-up timed out"
+		default:
+			stepStart := time.Now()
+			detail, err := step.run(ctx)
+			result.DurationMS = time.Since(stepStart).Milliseconds()
+			result.Status, result.Detail = WarmupStepOK, detail
+			if err != nil {
+				result.Status, result.Error = WarmupStepFailed, err.Error()
+				log.Printf("Warm-up step %s failed: %v", step.name, err)
+			}
+		}
+
+		w.mu.Lock()
+		w.status.Steps = append(w.status.Steps, result)
+		w.mu.Unlock()
+
+		if i == 0 && result.Status == WarmupStepFailed {
+			w.finish(WarmupFailed)
+			return
+		}
+	}
+	w.finish(WarmupDone)
+	log.Printf("Warm-up finished in %v", time.Since(start).Round(time.Millisecond))
+}
+
+// finish records the final state of the warm-up
+func (w *Warmup) finish(state string) {
+	finished := time.Now().UTC()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.State = state
+	w.status.FinishedAt = &finished
+}
+
+// verifyDatabase checks that the database answers with sqlite-vec loaded and, when configured, that
+// its pages are intact
+func (w *Warmup) verifyDatabase(ctx context.Context) (string, error) {
+	if err := w.db.Ping(ctx); err != nil {
+		return "", err
+	}
+	if !w.cfg.VerifyIntegrity {
+		return "sqlite-vec loaded", nil
+	}
+
+	problems, err := queryStringsContext(ctx, w.db, `PRAGMA quick_check`)
+	if err != nil {
+		return "", fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		return "", fmt.Errorf("database integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return "integrity check passed", nil
+}
+
+// queryStringsContext returns the first column of every row of a query
+func queryStringsContext(ctx context.Context, db *VectorDB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// indexMissingChunks adds the chunks absent from the keyword index to it, such as those of a
+// database written by a version that did not index them. A read-only server leaves them out.
+func (db *VectorDB) indexMissingChunks(ctx context.Context) (string, error) {
+	if checkWritable() != nil {
+		return "skipped in read-only mode", nil
+	}
+	result, err := db.conn.ExecContext(ctx, `INSERT INTO chunk_fts (chunk_id, collection_name, text)
+		SELECT id, collection_name, rag_index(text) FROM enhanced_chunks
+		WHERE id NOT IN (SELECT chunk_id FROM chunk_fts)`)
+	if err != nil {
+		return "", fmt.Errorf("failed to index missing chunks: %w", err)
+	}
+	indexed, _ := result.RowsAffected()
+	if indexed == 0 {
+		return "every chunk is indexed", nil
+	}
+	log.Printf("Indexed %d chunks missing from the keyword index", indexed)
+
+	// The entries were added in one statement, so the statistics are recomputed rather than updated
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if err := rebuildTermStats(tx); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("indexed %d missing chunks", indexed), nil
+}
+
+// readCollectionStats reads the statistics of every collection of every tenant
+func (db *VectorDB) readCollectionStats(ctx context.Context) (string, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT tenant_id, name FROM collections ORDER BY tenant_id, name`)
+	if err != nil {
+		return "", fmt.Errorf("failed to list collections: %w", err)
+	}
+	var collections [][2]string
+	for rows.Next() {
+		var tenant, name string
+		if err := rows.Scan(&tenant, &name); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("failed to scan collection: %w", err)
+		}
+		collections = append(collections, [2]string{tenant, name})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	for i, collection := range collections {
+		if err := ctx.Err(); err != nil {
+			return fmt.Sprintf("read %d of %d collections", i, len(collections)), err
+		}
+		if _, err := db.ForTenant(collection[0]).GetCollectionStats(collection[1]); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("read %d collections", len(collections)), nil
+}
+
+// readEmbeddings reads every stored embedding, which vector searches otherwise read from disk
+func (db *VectorDB) readEmbeddings(ctx context.Context) (string, error) {
+	tables, err := existingEmbeddingTables(db.conn)
+	if err != nil {
+		return "", err
+	}
+
+	var count, size int64
+	for _, table := range tables {
+		var n, bytes int64
+		err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(LENGTH(embedding)), 0) FROM `+table.name).Scan(&n, &bytes)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", table.name, err)
+		}
+		count += n
+		size += bytes
+	}
+	return fmt.Sprintf("read %d embeddings (%.1f MiB)", count, float64(size)/(1<<20)), nil
+}
+
+// waitForANNIndexes waits for the first build of the ANN indexes, so the first searches of their
+// collections don't scan sqlite-vec
+func waitForANNIndexes(ctx context.Context) (string, error) {
+	indexes := annIndexes
+	if err := indexes.Wait(ctx); err != nil {
+		return "", fmt.Errorf("ANN indexes not built: %w", err)
+	}
+	built, vectors := 0, 0
+	for _, index := range indexes.indexes {
+		if status := indexes.Status(index.tenant, index.collection); status.State == ANNIndexReady {
+			built++
+			vectors += status.Vectors
+		}
+	}
+	return fmt.Sprintf("built %d of %d indexes with %d vectors", built, len(indexes.indexes), vectors), nil
+}
+
+// loadModels embeds a text and generates a token, so the model server has loaded the embedding and
+// chat models before the first query. The embedding cache is bypassed, since a hit would not reach
+// the server.
+func loadModels(ctx context.Context) (string, error) {
+	var errs []error
+	if _, err := sendEmbeddingRequest(ctx, []string{"warm-up"}, config.AppConfig.EmbeddingModel); err != nil {
+		errs = append(errs, fmt.Errorf("embedding model: %w", err))
+	}
+	messages := []models.ChatCompletionMessage{{Role: "user", Content: "Reply with OK."}}
+	if _, err := GenerateChatCompletion(ctx, messages, models.GenerationOptions{MaxTokens: 1}); err != nil {
+		errs = append(errs, fmt.Errorf("chat model: %w", err))
+	}
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	return "embedding and chat models loaded", nil
+}
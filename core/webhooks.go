@@ -0,0 +1,421 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"rag-go-app/config"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types sent to webhooks
+const (
+	EventDocumentAdded     = "document_added"     // A document was stored, new or as a new version of its source
+	EventDocumentDeleted   = "document_deleted"   // A document was removed, including versions replaced by a new one
+	EventCollectionCreated = "collection_created" // A collection was created
+	EventIngestionFailed   = "ingestion_failed"   // A document could not be ingested
+	EventReembedCompleted  = "reembed_completed"  // A re-embedding run swapped in the new embeddings
+)
+
+// WebhookEventTypes lists every event type, in the order they are documented
+var WebhookEventTypes = []string{
+	EventDocumentAdded, EventDocumentDeleted, EventCollectionCreated, EventIngestionFailed, EventReembedCompleted,
+}
+
+// Headers of webhook deliveries. The signature is "sha256=" followed by the hex HMAC-SHA256 of
+// the timestamp, a dot and the body, keyed with the endpoint's secret.
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookIDHeader        = "X-Webhook-ID"
+)
+
+const (
+	webhookQueueSize       = 1000 // Events waiting per endpoint before new ones are dropped
+	defaultWebhookTimeout  = 10 * time.Second
+	defaultWebhookAttempts = 5
+	webhookInitialBackoff  = time.Second
+	webhookMaxBackoff      = time.Minute
+	webhookDrainTimeout    = 10 * time.Second // Time queued events get to be delivered on shutdown
+)
+
+// WebhookEvent is the JSON body posted to webhook endpoints
+type WebhookEvent struct {
+	ID         string                 `json:"id"` // Same for every attempt, so receivers can skip redeliveries
+	Type       string                 `json:"type"`
+	Tenant     string                 `json:"tenant"`
+	Collection string                 `json:"collection,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// WebhookEndpointStatus reports the deliveries to one endpoint. Secrets are never reported.
+type WebhookEndpointStatus struct {
+	URL             string     `json:"url"`
+	Events          []string   `json:"events,omitempty"`
+	Tenant          string     `json:"tenant,omitempty"`
+	Queued          int        `json:"queued"`
+	Delivered       int        `json:"delivered"`
+	Failed          int        `json:"failed"`  // Events dropped after every attempt failed
+	Dropped         int        `json:"dropped"` // Events dropped because the queue was full
+	LastDeliveredAt *time.Time `json:"last_delivered_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+}
+
+// WebhookStatus describes the configured webhook endpoints
+type WebhookStatus struct {
+	Enabled   bool                    `json:"enabled"`
+	Endpoints []WebhookEndpointStatus `json:"endpoints,omitempty"`
+}
+
+// webhookTarget is an endpoint with its own queue, so a slow or failing endpoint only delays its
+// own events
+type webhookTarget struct {
+	cfg    config.WebhookEndpoint
+	events map[string]bool // Nil sends every type
+	queue  chan WebhookEvent
+
+	mu     sync.Mutex // Guards status
+	status WebhookEndpointStatus
+}
+
+// WebhookDispatcher delivers events to the configured endpoints in the background. Each endpoint
+// receives its events in order; a failed delivery is retried with exponential backoff before the
+// next event is sent.
+type WebhookDispatcher struct {
+	targets     []*webhookTarget
+	client      *http.Client
+	maxAttempts int
+
+	mu     sync.RWMutex // Guards closed against publishing into closed queues
+	closed bool
+
+	ctx    context.Context // Cancelled when draining at shutdown runs out of time
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWebhookDispatcher validates the webhook settings and returns a dispatcher that has not been started
+func NewWebhookDispatcher(cfg config.WebhooksConfig) (*WebhookDispatcher, error) {
+	known := make(map[string]bool, len(WebhookEventTypes))
+	for _, eventType := range WebhookEventTypes {
+		known[eventType] = true
+	}
+
+	targets := make([]*webhookTarget, 0, len(cfg.Endpoints))
+	for i, endpoint := range cfg.Endpoints {
+		parsed, err := url.Parse(endpoint.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("webhook endpoint %d: url must be an http or https URL", i)
+		}
+		if endpoint.Secret == "" {
+			return nil, fmt.Errorf("webhook endpoint %d: secret is required to sign deliveries", i)
+		}
+
+		var events map[string]bool
+		if len(endpoint.Events) > 0 {
+			events = make(map[string]bool, len(endpoint.Events))
+			for _, eventType := range endpoint.Events {
+				if !known[eventType] {
+					return nil, fmt.Errorf("webhook endpoint %d: unknown event type %q", i, eventType)
+				}
+				events[eventType] = true
+			}
+		}
+
+		targets = append(targets, &webhookTarget{
+			cfg:    endpoint,
+			events: events,
+			queue:  make(chan WebhookEvent, webhookQueueSize),
+			status: WebhookEndpointStatus{URL: endpoint.URL, Events: endpoint.Events, Tenant: endpoint.Tenant},
+		})
+	}
+
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultWebhookAttempts
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookDispatcher{
+		targets:     targets,
+		client:      &http.Client{Timeout: timeout},
+		maxAttempts: maxAttempts,
+		ctx:         ctx,
+		cancel:      cancel,
+	}, nil
+}
+
+// Start runs a delivery loop per endpoint in the background until Stop is called
+func (d *WebhookDispatcher) Start() {
+	for _, target := range d.targets {
+		d.wg.Add(1)
+		go func(target *webhookTarget) {
+			defer d.wg.Done()
+			for event := range target.queue {
+				d.deliver(target, event)
+			}
+		}(target)
+	}
+	log.Printf("Webhooks enabled: %d endpoints", len(d.targets))
+}
+
+// Stop stops accepting events and delivers the queued ones, giving up on those still pending
+// after the drain timeout
+func (d *WebhookDispatcher) Stop() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	for _, target := range d.targets {
+		close(target.queue)
+	}
+	d.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(webhookDrainTimeout):
+		log.Printf("Webhook deliveries still pending after %v, dropping them", webhookDrainTimeout)
+		d.cancel()
+		<-drained
+	}
+	d.cancel()
+}
+
+// Publish queues an event for every endpoint subscribed to it. It never blocks: when an
+// endpoint's queue is full the event is dropped for that endpoint.
+func (d *WebhookDispatcher) Publish(event WebhookEvent) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+
+	for _, target := range d.targets {
+		if (target.events != nil && !target.events[event.Type]) || (target.cfg.Tenant != "" && target.cfg.Tenant != event.Tenant) {
+			continue
+		}
+		select {
+		case target.queue <- event:
+		default:
+			target.mu.Lock()
+			target.status.Dropped++
+			target.mu.Unlock()
+			log.Printf("Webhook queue for %s is full, dropping %s event %s", target.cfg.URL, event.Type, event.ID)
+		}
+	}
+}
+
+// Status returns a copy of the delivery status of every endpoint
+func (d *WebhookDispatcher) Status() WebhookStatus {
+	status := WebhookStatus{Enabled: true, Endpoints: make([]WebhookEndpointStatus, len(d.targets))}
+	for i, target := range d.targets {
+		target.mu.Lock()
+		status.Endpoints[i] = target.status
+		target.mu.Unlock()
+		status.Endpoints[i].Queued = len(target.queue)
+	}
+	return status
+}
+
+// deliver posts an event to an endpoint, retrying with exponential backoff until it is accepted,
+// the attempts run out or the dispatcher gives up at shutdown
+func (d *WebhookDispatcher) deliver(target *webhookTarget, event WebhookEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event %s: %v", event.Type, event.ID, err)
+		return
+	}
+
+	backoff := webhookInitialBackoff
+	for attempt := 1; ; attempt++ {
+		err = d.post(target, event, body)
+		now := time.Now()
+		target.mu.Lock()
+		if err == nil {
+			target.status.Delivered++
+			target.status.LastDeliveredAt = &now
+			target.status.LastError = ""
+			target.status.LastErrorAt = nil
+		} else {
+			target.status.LastError = err.Error()
+			target.status.LastErrorAt = &now
+		}
+		target.mu.Unlock()
+		if err == nil {
+			return
+		}
+
+		var permanent *permanentWebhookError
+		if attempt == d.maxAttempts || errors.As(err, &permanent) || d.ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-d.ctx.Done():
+		}
+		backoff = min(backoff*2, webhookMaxBackoff)
+	}
+
+	target.mu.Lock()
+	target.status.Failed++
+	target.mu.Unlock()
+	log.Printf("Dropping %s event %s for %s: %v", event.Type, event.ID, target.cfg.URL, err)
+}
+
+// permanentWebhookError is a response retrying won't change, such as 400 or 404
+type permanentWebhookError struct {
+	status int
+}
+
+func (e *permanentWebhookError) Error() string {
+	return fmt.Sprintf("endpoint rejected the event with status %d", e.status)
+}
+
+// post sends one delivery attempt. 2xx responses accept the event; 408, 429 and 5xx responses
+// are retried, other statuses are not.
+func (d *WebhookDispatcher) post(target *webhookTarget, event WebhookEvent, body []byte) error {
+	req, err := http.NewRequestWithContext(d.ctx, "POST", target.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, event.ID)
+	req.Header.Set(WebhookEventHeader, event.Type)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(target.cfg.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach endpoint: %w", err)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return &permanentWebhookError{status: resp.StatusCode}
+}
+
+// SignWebhook returns the X-Webhook-Signature value of a delivery. Receivers recompute it from the
+// X-Webhook-Timestamp header and the raw body, compare in constant time, and should reject old
+// timestamps to stop replays.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var webhooks *WebhookDispatcher
+
+// SetWebhookDispatcher installs the dispatcher events are published to. Passing nil disables webhooks.
+func SetWebhookDispatcher(dispatcher *WebhookDispatcher) {
+	webhooks = dispatcher
+}
+
+// publishEvent sends an event to the webhook endpoints subscribed to it, if webhooks are enabled
+func publishEvent(tenant, eventType, collectionName string, data map[string]interface{}) {
+	if webhooks == nil {
+		return
+	}
+	webhooks.Publish(WebhookEvent{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		Tenant:     tenant,
+		Collection: collectionName,
+		CreatedAt:  time.Now().UTC(),
+		Data:       data,
+	})
+}
+
+// publishIngestion reports the outcome of ingesting a document: document_added when it was stored,
+// ingestion_failed when it could not be. Unchanged documents send nothing.
+func (r *RAGService) publishIngestion(collectionName, source string, result *IngestResult, err error) {
+	if err != nil {
+		publishEvent(r.vectorDB.tenant, EventIngestionFailed, collectionName, map[string]interface{}{
+			"source": source,
+			"error":  err.Error(),
+		})
+		return
+	}
+	if result.Status != IngestAdded && result.Status != IngestUpdated {
+		return
+	}
+	publishEvent(r.vectorDB.tenant, EventDocumentAdded, collectionName, map[string]interface{}{
+		"document_id":     result.DocumentID,
+		"source":          source,
+		"status":          result.Status,
+		"chunks_embedded": result.ChunksEmbedded,
+	})
+}
+
+// deletedDocument identifies a document about to be deleted, for its document_deleted event
+type deletedDocument struct {
+	id, source, collectionName string
+}
+
+// documentsToDelete lists the documents matching a condition on the documents table, before a
+// transaction deletes them
+func (db *VectorDB) documentsToDelete(tx *sql.Tx, where string, args ...interface{}) ([]deletedDocument, error) {
+	rows, err := tx.Query(`SELECT id, source, collection_name FROM documents WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+
+	var documents []deletedDocument
+	for rows.Next() {
+		var doc deletedDocument
+		var source sql.NullString
+		if err := rows.Scan(&doc.id, &source, &doc.collectionName); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		doc.source = source.String
+		documents = append(documents, doc)
+	}
+	return documents, rows.Err()
+}
+
+// publishDeleted sends a document_deleted event for each document, once their deletion is committed
+func (db *VectorDB) publishDeleted(documents []deletedDocument) {
+	for _, doc := range documents {
+		publishEvent(db.tenant, EventDocumentDeleted, doc.collectionName, map[string]interface{}{
+			"document_id": doc.id,
+			"source":      doc.source,
+		})
+	}
+}
@@ -1,20 +1,39 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"rag-go-app/api"
 	"rag-go-app/config"
+	"rag-go-app/core"
+	"rag-go-app/models"
+	"strings"
 	"syscall"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBenchCommand(os.Args[2:]))
+	}
+
 	// Define command-line flags
 	configPath := flag.String("config", "config.json", "Path to configuration file")
 	showHelp := flag.Bool("help", false, "Show help information")
 	showVersion := flag.Bool("version", false, "Show version information")
+	reembed := flag.String("reembed", "", "Re-embed a collection with the embedding model and exit")
+	reembedAll := flag.Bool("reembed-all", false, "Re-embed every collection of every tenant and exit")
+	reembedModel := flag.String("reembed-model", "", "Embedding model for -reembed; defaults to embedding_model from the config")
+	tenant := flag.String("tenant", core.DefaultTenant, "Tenant owning the collection given to -reembed")
+	pullReplica := flag.Bool("pull-replica", false, "Download the latest snapshot replicated to replication.s3 into replication.standby_path and exit")
+	healthcheck := flag.Bool("healthcheck", false, "Check that the server on the configured port is ready and exit (for container health checks)")
 
 	// Custom usage function
 	flag.Usage = func() {
@@ -26,6 +45,8 @@ func main() {
 		log.Printf("  %s                           # Use default config.json\n", os.Args[0])
 		log.Printf("  %s -config=prod.json         # Use custom config file\n", os.Args[0])
 		log.Printf("  %s -help                     # Show this help\n", os.Args[0])
+		log.Printf("  %s -reembed=my_documents     # Re-embed a collection after switching models\n", os.Args[0])
+		log.Printf("  %s bench -mock               # Benchmark retrieval on synthetic collections (see bench -help)\n", os.Args[0])
 	}
 
 	flag.Parse()
@@ -44,10 +65,37 @@ func main() {
 
 	// Load configuration
 	config.LoadConfig(*configPath)
+	if *healthcheck {
+		if err := probeReadiness(config.AppConfig.ServerPort, api.TLSEnabled(config.AppConfig.TLS)); err != nil {
+			log.Printf("Not ready: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	log.Printf("Configuration loaded from: %s", *configPath)
 	log.Printf("Server will run on port %s", config.AppConfig.ServerPort)
 	log.Printf("Vector DB path: %s", config.AppConfig.VectorDBPath)
-	log.Printf("LlamaCPP Base URL: %s", config.AppConfig.LlamaCPPBaseURL)
+	log.Printf("Model server: %s (provider %s)", config.AppConfig.LlamaCPPBaseURL, config.AppConfig.Provider)
+	if len(config.AppConfig.LlamaCPPFailoverURLs) > 0 {
+		log.Printf("Failover model servers: %s", strings.Join(config.AppConfig.LlamaCPPFailoverURLs, ", "))
+	}
+
+	if *pullReplica {
+		if _, err := core.PullReplica(context.Background(), config.AppConfig.Replication.S3, config.AppConfig.Replication.StandbyPath); err != nil {
+			log.Fatalf("Pulling the replica failed: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	if *reembed != "" || *reembedAll {
+		if *reembedAll {
+			*reembed = ""
+		}
+		if err := runReembed(*reembed, *tenant, *reembedModel); err != nil {
+			log.Fatalf("Re-embedding failed: %v", err)
+		}
+		os.Exit(0)
+	}
 
 	// Initialize services
 	err := api.InitializeServices(config.AppConfig.VectorDBPath)
@@ -55,40 +103,97 @@ func main() {
 		log.Fatalf("Failed to initialize services: %v", err)
 	}
 
-	// Setup graceful shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		<-c
-		log.Println("Shutting down gracefully...")
-		api.Cleanup()
-		os.Exit(0)
-	}()
-
-	// Setup and start router
+	// Setup router
 	router := api.SetupRoutes()
+	server := &http.Server{Addr: ":" + config.AppConfig.ServerPort, Handler: router}
+	server.RegisterOnShutdown(api.CloseChatSessions) // Shutdown doesn't wait for WebSocket connections
+	scheme := "HTTP"
+	if api.TLSEnabled(config.AppConfig.TLS) {
+		server.TLSConfig, err = api.ServerTLSConfig(config.AppConfig.TLS)
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		scheme = "HTTPS"
+		if config.AppConfig.TLS.ClientCAFile != "" {
+			scheme = "HTTPS with client certificates"
+		}
+	}
 
-	log.Printf("RAG server starting on port %s...", config.AppConfig.ServerPort)
+	log.Printf("RAG server starting on port %s (%s)...", config.AppConfig.ServerPort, scheme)
 	log.Println("Available endpoints:")
-	log.Println("  GET  /health                           - Health check")
+	log.Println("  GET  /health                           - Health check with dependency status")
+	log.Println("  GET  /healthz                          - Liveness probe")
+	log.Println("  GET  /readyz                           - Readiness probe (warm-up, database and model server)")
+	log.Println("  GET  /openapi.json                     - OpenAPI 3.0 specification")
+	log.Println("  GET  /docs                             - Swagger UI")
+	log.Println("  GET  /admin                            - Admin dashboard")
 	log.Println("")
 	log.Println("📚 Collection Management:")
 	log.Println("  POST   /api/v1/collections             - Create collection")
 	log.Println("  GET    /api/v1/collections             - List all collections")
 	log.Println("  GET    /api/v1/collections/:name       - Get collection statistics")
 	log.Println("  DELETE /api/v1/collections/:name       - Delete collection")
+	log.Println("  POST   /api/v1/collections/:name/reembed - Re-embed collection with a new model")
+	log.Println("  GET    /api/v1/collections/:name/reembed - Re-embedding progress")
+	log.Println("  POST   /api/v1/collections/:name/topics - Cluster a collection into labeled topics")
 	log.Println("")
 	log.Println("📄 Document Management:")
 	log.Println("  POST   /api/v1/documents               - Add document")
+	log.Println("  POST   /api/v1/documents/import        - Import pre-embedded documents")
+	log.Println("  POST   /api/v1/documents/batch         - Add documents in bulk (JSON or NDJSON)")
+	log.Println("  POST   /api/v1/collections/:name/import - Import a LangChain or LlamaIndex export")
+	log.Println("  POST   /api/v1/documents/preview       - Preview parsing and chunking without ingesting")
+	log.Println("  POST   /api/v1/collections/:name/sources/s3 - Ingest the objects of an S3 bucket")
+	log.Println("  POST   /api/v1/collections/:name/sources/web - Crawl a website into a collection")
 	log.Println("  GET    /api/v1/collections/:name/documents - List documents in collection")
+	log.Println("  GET    /api/v1/documents/:id           - Get a document with its content and chunk outline")
+	log.Println("  GET    /api/v1/documents/:id/chunks    - List the chunks of a document")
 	log.Println("  DELETE /api/v1/documents/:id           - Delete specific document")
 	log.Println("  DELETE /api/v1/collections/:name/documents - Delete all documents (requires ?confirm=true)")
+	log.Println("  GET    /api/v1/collections/:name/duplicates - Report duplicate and near-duplicate documents")
+	log.Println("  POST   /api/v1/collections/:name/duplicates/resolve - Delete duplicates of a kept document")
+	log.Println("  PATCH  /api/v1/chunks/:id              - Correct chunk text and re-embed")
+	log.Println("  GET    /api/v1/chunks/:id/similar      - Chunks most similar to a chunk")
 	log.Println("")
 	log.Println("🔍 Query & Analysis:")
 	log.Println("  POST   /api/v1/query                   - Query documents")
+	log.Println("  POST   /api/v1/search/documents        - Find documents similar to a query or document")
 	log.Println("  POST   /api/v1/analyze                 - Analyze document with metadata")
 	log.Println("  POST   /api/v1/compare-chunking        - Compare chunking strategies")
+	log.Println("  POST   /api/v1/evaluate                - Evaluate retrieval quality on a test set")
+	log.Println("  POST   /v1/chat/completions            - OpenAI-compatible chat with retrieved context")
+	log.Println("  POST   /v1/embeddings                  - OpenAI-compatible embeddings through the cache")
+	log.Println("  GET    /ws/chat                        - Chat session over a WebSocket with streamed, cancellable answers")
+	log.Println("  GET    /api/v1/analytics/queries       - Query analytics")
+	log.Println("  GET    /api/v1/usage                   - Storage used against the quotas")
+	log.Println("  GET    /api/v1/system/info             - Models, embedding dimension and database")
+	log.Println("")
+	log.Println("🛡️ Administration:")
+	log.Println("  GET    /api/v1/admin/replication       - Replication status")
+	log.Println("  POST   /api/v1/admin/replication/sync  - Replicate a snapshot now")
+	log.Println("  POST   /api/v1/admin/replication/snapshot - Receive a snapshot (follower)")
+	log.Println("  GET    /api/v1/admin/backup            - List backups")
+	log.Println("  POST   /api/v1/admin/backup            - Back up the database now")
+	log.Println("  POST   /api/v1/admin/restore           - Restore a backup")
+	log.Println("  GET    /api/v1/admin/maintenance       - Maintenance schedule and last run")
+	log.Println("  POST   /api/v1/admin/maintenance       - Prune, reindex and vacuum the database now")
+	log.Println("  POST   /api/v1/admin/fsck              - Check the database for orphaned rows")
+	log.Println("  GET    /api/v1/admin/read-only         - Whether the server refuses changes")
+	log.Println("  PUT    /api/v1/admin/read-only         - Switch read-only mode on or off")
+	log.Println("  GET    /api/v1/admin/crawler           - Scheduled website crawls")
+	log.Println("  GET    /api/v1/admin/webhooks          - Webhook delivery status")
+	log.Println("  GET    /api/v1/admin/embeddings        - Embedding cache and model server metrics")
+	log.Println("  GET    /api/v1/admin/encryption        - Encryption mode and keys in use")
+	log.Println("  POST   /api/v1/admin/encryption/rotate - Re-encrypt stored text with the current key")
+	log.Println("  GET    /api/v1/admin/roles             - Role assignments")
+	log.Println("  PUT    /api/v1/admin/roles             - Assign a role to an API key, user or claim")
+	log.Println("  DELETE /api/v1/admin/roles             - Revoke a role assignment")
+	log.Println("  GET    /api/v1/admin/audit             - Audit log of changes")
+	log.Println("  GET    /api/v1/admin/audit/export      - Export the audit log as NDJSON or CSV")
+	if config.AppConfig.Profiling.Enabled {
+		log.Println("  GET    /api/v1/admin/debug/pprof/      - Runtime profiles (pprof)")
+		log.Println("  GET    /api/v1/admin/debug/vars        - Memory statistics (expvar)")
+	}
 	log.Println()
 	log.Println("Enhanced features available:")
 	log.Println("  ✓ Intelligent structural chunking with automatic section detection")
@@ -99,7 +204,91 @@ func main() {
 	log.Println("  ✓ Metadata filtering and keyword extraction")
 	log.Println("  ✓ Position-aware query enhancement")
 
-	if err := router.Run(":" + config.AppConfig.ServerPort); err != nil {
+	// On SIGTERM, fail readiness and stop accepting connections, then give in-flight requests
+	// until the shutdown timeout before closing the database
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			serverErr <- server.ListenAndServeTLS("", "") // The certificate comes from TLSConfig
+			return
+		}
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Fatalf("Failed to start server: %v", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down gracefully...")
+	api.BeginShutdown()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(config.AppConfig.Timeouts.ShutdownSeconds)*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Requests still running at shutdown timeout: %v", err)
+	}
+	api.Cleanup()
+	log.Println("Server stopped")
+}
+
+// probeReadiness asks the local server whether it is ready. Over HTTPS the certificate is not
+// verified, since it is issued for the service's name rather than the loopback address.
+func probeReadiness(port string, useTLS bool) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	resp, err := client.Get(fmt.Sprintf("%s://127.0.0.1:%s/readyz", scheme, port))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
+	return nil
+}
+
+// runReembed re-embeds a collection, or every collection when collectionName is empty, logging
+// progress until it is done. Interrupting it leaves the stored embeddings untouched.
+func runReembed(collectionName, tenant, model string) error {
+	if _, err := core.CurrentProvider(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	vectorDB, err := core.NewVectorDB(config.AppConfig.VectorDBPath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize vector database: %w", err)
+	}
+	defer vectorDB.Close()
+	core.SetEmbeddingCache(vectorDB)
+	core.SetModelRegistry(vectorDB)
+
+	if len(config.AppConfig.Webhooks.Endpoints) > 0 {
+		webhooks, err := core.NewWebhookDispatcher(config.AppConfig.Webhooks)
+		if err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+		webhooks.Start()
+		defer webhooks.Stop()
+		core.SetWebhookDispatcher(webhooks)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ragService := core.NewRAGService(vectorDB, core.NewEmbeddingService(), core.NewLLMService()).ForTenant(tenant)
+	_, err = ragService.Reembed(ctx, collectionName, &models.ReembedRequest{Model: model}, func(status core.ReembedStatus) {
+		if status.State == core.ReembedRunning && status.EmbeddedChunks > 0 {
+			log.Printf("Re-embedded %d/%d chunks", status.EmbeddedChunks, status.TotalChunks)
+		}
+	})
+	return err
 }